@@ -2,6 +2,7 @@ package bx
 
 import (
 	"fmt"
+	"github.com/btceasypay/bitcoinpay/core/address"
 	"github.com/stretchr/testify/assert"
 	"testing"
 	"time"
@@ -123,3 +124,13 @@ func TestGPSToCompact(t *testing.T) {
 	// output :
 	// 36284416
 }
+
+func TestEcPubKeyToBech32Address(t *testing.T) {
+	s, _ := EcPubKeyToBech32Address("testnet", "02addd806e8813f85fad05b97541915eb3a1f27528d3156f2ef8166823d6722b58")
+	addr, err := address.DecodeAddress(s)
+	assert.NoError(t, err)
+	legacy, _ := EcPubKeyToAddress("testnet", "02addd806e8813f85fad05b97541915eb3a1f27528d3156f2ef8166823d6722b58")
+	legacyAddr, _ := address.DecodeAddress(legacy)
+	assert.Equal(t, legacyAddr.ScriptAddress(), addr.ScriptAddress())
+	assert.Contains(t, s, "tp1q")
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/btceasypay/bitcoinpay/common/encode/base58"
 	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/address"
 	"github.com/btceasypay/bitcoinpay/params"
 )
 
@@ -78,3 +79,37 @@ func EcPubKeyToAddressSTDO(version []byte, pubkey string) {
 	address := base58.BitcoinpayCheckEncode(h, version[:])
 	fmt.Printf("%s\n", address)
 }
+
+func EcPubKeyToBech32Address(network string, pubkey string) (string, error) {
+	var p *params.Params
+	switch network {
+	case "mainnet":
+		p = &params.MainNetParams
+	case "privnet":
+		p = &params.PrivNetParams
+	case "testnet":
+		p = &params.TestNetParams
+	case "mixnet":
+		p = &params.MixNetParams
+	default:
+		return "", fmt.Errorf("unknown bech32 network %s", network)
+	}
+
+	data, err := hex.DecodeString(pubkey)
+	if err != nil {
+		return "", err
+	}
+	addr, err := address.NewBech32PubKeyHashAddress(hash.Hash160(data), p)
+	if err != nil {
+		return "", err
+	}
+	return addr.Encode(), nil
+}
+
+func EcPubKeyToBech32AddressSTDO(network string, pubkey string) {
+	addr, err := EcPubKeyToBech32Address(network, pubkey)
+	if err != nil {
+		ErrExit(err)
+	}
+	fmt.Printf("%s\n", addr)
+}
@@ -8,15 +8,21 @@ import (
 	"fmt"
 	"github.com/btceasypay/bitcoinpay/core/message"
 	_ "github.com/btceasypay/bitcoinpay/database/ffldb"
+	_ "github.com/btceasypay/bitcoinpay/database/memdb"
 	"github.com/btceasypay/bitcoinpay/log"
+	"github.com/btceasypay/bitcoinpay/metrics"
+	"github.com/btceasypay/bitcoinpay/metrics/prometheus"
 	"github.com/btceasypay/bitcoinpay/node"
 	"github.com/btceasypay/bitcoinpay/params"
 	"github.com/btceasypay/bitcoinpay/services/common"
 	"github.com/btceasypay/bitcoinpay/services/index"
 	"github.com/btceasypay/bitcoinpay/version"
+	gometrics "github.com/rcrowley/go-metrics"
+	"net/http"
 	"os"
 	"runtime"
 	"runtime/debug"
+	"time"
 )
 
 func main() {
@@ -68,6 +74,19 @@ func bitcoinpayMain(nodeChan chan<- *node.Node) error {
 		log.Info("File logging disabled")
 	}
 
+	// Enable the Prometheus metrics server if requested.
+	if cfg.Metrics != "" {
+		go func() {
+			log.Info("Metrics server listening", "addr", cfg.Metrics)
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", prometheus.Handler(gometrics.DefaultRegistry))
+			if err := http.ListenAndServe(cfg.Metrics, mux); err != nil {
+				log.Error("Metrics server stopped", "error", err)
+			}
+		}()
+		go metrics.CollectProcessMetrics(3 * time.Second)
+	}
+
 	// Load the block database.
 	db, err := common.LoadBlockDB(cfg)
 	if err != nil {
@@ -93,6 +112,14 @@ func bitcoinpayMain(nodeChan chan<- *node.Node) error {
 
 		return nil
 	}
+	if cfg.DropAssetIndex {
+		if err := index.DropAssetIndex(db, interrupt); err != nil {
+			log.Error(fmt.Sprintf("%v", err))
+			return err
+		}
+
+		return nil
+	}
 	if cfg.DropTxIndex {
 		if err := index.DropTxIndex(db, interrupt); err != nil {
 			log.Error(fmt.Sprintf("%v", err))
@@ -95,6 +95,14 @@ func version() {
 	os.Exit(1)
 }
 
+func ecPubKeyToAddress(pubkey string) {
+	if bech32Address {
+		bx.EcPubKeyToBech32AddressSTDO(base58checkVersion.String(), pubkey)
+	} else {
+		bx.EcPubKeyToAddressSTDO(base58checkVersion.Ver, pubkey)
+	}
+}
+
 func errExit(err error) {
 	fmt.Fprintf(os.Stderr, "bx Error : %q\n", err)
 	os.Exit(1)
@@ -122,6 +130,7 @@ var derivePath bx.DerivePathFlag
 var mnemoicSeedPassphrase string
 var curve string
 var uncompressedPKFormat bool
+var bech32Address bool
 var network string
 var powType string
 var txInputs bx.TxInputsFlag
@@ -382,6 +391,7 @@ func main() {
 		cmdUsage(ecToAddrCmd, "Usage: bx ec-to-addr [ec_public_key] \n")
 	}
 	ecToAddrCmd.Var(&base58checkVersion, "v", "base58check `version` [mainnet|testnet|privnet]")
+	ecToAddrCmd.BoolVar(&bech32Address, "bech32", false, "encode the address in bech32 with the human-readable prefix of the network")
 
 	// Transaction
 	txDecodeCmd := flag.NewFlagSet("tx-decode", flag.ExitOnError)
@@ -1232,7 +1242,7 @@ BTP is the 64 bit spend amount in bitcoinpay.`)
 			if len(os.Args) == 2 || os.Args[2] == "help" || os.Args[2] == "--help" {
 				ecToAddrCmd.Usage()
 			} else {
-				bx.EcPubKeyToAddressSTDO(base58checkVersion.Ver, os.Args[len(os.Args)-1])
+				ecPubKeyToAddress(os.Args[len(os.Args)-1])
 			}
 		} else { //try from STDIN
 			src, err := ioutil.ReadAll(os.Stdin)
@@ -1240,7 +1250,7 @@ BTP is the 64 bit spend amount in bitcoinpay.`)
 				errExit(err)
 			}
 			str := strings.TrimSpace(string(src))
-			bx.EcPubKeyToAddressSTDO(base58checkVersion.Ver, str)
+			ecPubKeyToAddress(str)
 		}
 	}
 
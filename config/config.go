@@ -1,6 +1,7 @@
 package config
 
 import (
+	"github.com/btceasypay/bitcoinpay/common/hash"
 	"github.com/btceasypay/bitcoinpay/core/types"
 	"net"
 	"time"
@@ -32,22 +33,34 @@ type Config struct {
 	DropTxIndex        bool     `long:"droptxindex" description:"Deletes the hash-based transaction index from the database on start up and then exits."`
 	AddrIndex          bool     `long:"addrindex" description:"Maintain a full address-based transaction index which makes the getrawtransactions RPC available"`
 	DropAddrIndex      bool     `long:"dropaddrindex" description:"Deletes the address-based transaction index from the database on start up and then exits."`
+	AssetIndex         bool     `long:"assetindex" description:"Maintain an index of the issued assets and the asset balances which makes the asset RPCs available"`
+	DropAssetIndex     bool     `long:"dropassetindex" description:"Deletes the asset index from the database on start up and then exits."`
+	SnapshotSync       bool     `long:"snapshotsync" description:"Download the utxo set of the latest checkpoint from peers instead of connecting all blocks before it.  The blocks before the checkpoint are still downloaded in full, but only ordered until the utxo set is loaded and validated in the background afterwards"`
+	SnapshotPoint      string   `long:"snapshotpoint" description:"Use the utxo set of the given block for --snapshotsync instead of the latest checkpoint, in the form <block hash>:<utxo root>"`
+	snapshotPoint      [2]*hash.Hash
+	DropSnapshot       bool     `long:"dropsnapshot" description:"Deletes the block database on start up when the utxo snapshot it was synced from turned out invalid, so the chain is synced again from the blocks"`
+	NoCFilters         bool     `long:"nocfilters" description:"Disable committed filtering (CF) support"`
+	NoPeerBloomFilters bool     `long:"nopeerbloomfilters" description:"Disable bloom filtering support"`
 	LightNode          bool     `long:"light" description:"start as a bitcoinpay light node"`
 	SigCacheMaxSize    uint     `long:"sigcachemaxsize" description:"The maximum number of entries in the signature verification cache"`
 	DumpBlockchain     string   `long:"dumpblockchain" description:"Write blockchain as a flat file of blocks for use with addblock, to the specified filename"`
 	TestNet            bool     `long:"testnet" description:"Use the test network"`
 	MixNet             bool     `long:"mixnet" description:"Use the test mix pow network"`
 	PrivNet            bool     `long:"privnet" description:"Use the private network"`
-	DbType             string   `long:"dbtype" description:"Database backend to use for the Block Chain"`
+	DbType             string   `long:"dbtype" description:"Database backend to use for the Block Chain (ffldb, memdb)"`
 	Profile            string   `long:"profile" description:"Enable HTTP profiling on given [addr:]port -- NOTE port must be between 1024 and 65536"`
+	Metrics            string   `long:"metrics" optional:"yes" optional-value:"127.0.0.1:8235" description:"Enable the Prometheus metrics at /metrics on given [addr:]port, 127.0.0.1:8235 by default"`
 	DebugLevel         string   `short:"d" long:"debuglevel" description:"Logging level {trace, debug, info, warn, error, critical} "`
 	DebugPrintOrigins  bool     `long:"printorigin" description:"Print log debug location (file:line) "`
 	// MemPool Config
-	NoRelayPriority  bool    `long:"norelaypriority" description:"Do not require free or low-fee transactions to have high priority for relaying"`
-	FreeTxRelayLimit float64 `long:"limitfreerelay" description:"Limit relay of transactions with no transaction fee to the given amount in thousands of bytes per minute"`
-	AcceptNonStd     bool    `long:"acceptnonstd" description:"Accept and relay non-standard transactions to the network regardless of the default settings for the active network."`
-	MaxOrphanTxs     int     `long:"maxorphantx" description:"Max number of orphan transactions to keep in memory"`
-	MinTxFee         int64   `long:"mintxfee" description:"The minimum transaction fee in AtomBTP/kB."`
+	NoRelayPriority   bool    `long:"norelaypriority" description:"Do not require free or low-fee transactions to have high priority for relaying"`
+	FreeTxRelayLimit  float64 `long:"limitfreerelay" description:"Limit relay of transactions with no transaction fee to the given amount in thousands of bytes per minute"`
+	AcceptNonStd      bool    `long:"acceptnonstd" description:"Accept and relay non-standard transactions to the network regardless of the default settings for the active network."`
+	MaxOrphanTxs      int     `long:"maxorphantx" description:"Max number of orphan transactions to keep in memory"`
+	MinTxFee          int64   `long:"mintxfee" description:"The minimum transaction fee in AtomBTP/kB."`
+	RejectReplacement bool    `long:"rejectreplacement" description:"Reject transactions that attempt to replace existing transactions within the mempool through the Replace-By-Fee (RBF) signaling policy."`
+	MaxMempool        int64   `long:"maxmempool" description:"Keep the transaction memory pool below the given size in megabytes, evicting the transactions with the lowest fees"`
+	NoPersistMempool  bool    `long:"nopersistmempool" description:"Do not save the mempool on shutdown and load it on startup"`
 	// Miner
 	Generate          bool     `long:"generate" description:"Generate (mine) coins using the CPU"`
 	MiningAddrs       []string `long:"miningaddr" description:"Add the specified payment address to the list of addresses to use for generated blocks -- At least one address is required if the generate option is set"`
@@ -56,6 +69,9 @@ type Config struct {
 	BlockMaxSize      uint32   `long:"blockmaxsize" description:"Maximum block size in bytes to be used when creating a block"`
 	BlockPrioritySize uint32   `long:"blockprioritysize" description:"Size in bytes for high-priority/low-fee transactions when creating a block"`
 	miningAddrs       []types.Address
+	// Account
+	WatchAddrs []string `long:"watchaddr" description:"Add the specified address to the list of addresses whose balance and unspent outputs are tracked"`
+	watchAddrs []types.Address
 	//WebSocket support
 	RPCMaxWebsockets int `long:"rpcmaxwebsockets" description:"Max number of RPC websocket connections"`
 	//P2P
@@ -65,6 +81,16 @@ type Config struct {
 	ConnectPeers    []string `long:"connect" description:"Connect only to the specified peers at startup"`
 	ExternalIPs     []string `long:"externalip" description:"list of local addresses we claim to listen on to peers"`
 	Upnp            bool     `long:"upnp" description:"Use UPnP to map our listening port outside of NAT"`
+	Proxy           string   `long:"proxy" description:"Connect via SOCKS5 proxy (eg. 127.0.0.1:9050)"`
+	ProxyUser       string   `long:"proxyuser" description:"Username for proxy server"`
+	ProxyPass       string   `long:"proxypass" default-mask:"-" description:"Password for proxy server"`
+	OnionProxy      string   `long:"onion" description:"Connect to tor hidden services via SOCKS5 proxy (eg. 127.0.0.1:9050)"`
+	OnionProxyUser  string   `long:"onionuser" description:"Username for onion proxy server"`
+	OnionProxyPass  string   `long:"onionpass" default-mask:"-" description:"Password for onion proxy server"`
+	NoOnion         bool     `long:"noonion" description:"Disable connecting to tor hidden services"`
+	TorIsolation    bool     `long:"torisolation" description:"Enable Tor stream isolation by randomizing user credentials for each connection."`
+	TorControl      string   `long:"torcontrol" description:"Publish a tor hidden service for inbound connections through the tor control port (eg. 127.0.0.1:9051)"`
+	TorControlPass  string   `long:"torcontrolpass" default-mask:"-" description:"Password for the tor control port -- the cookie file of tor is used when not set"`
 	Whitelists      []string `long:"whitelist" description:"Add an IP network or IP that will not be banned. (eg. 192.168.1.0/24 or ::1)"`
 	whitelists      []*net.IPNet
 	MaxInbound      int `long:"maxinbound" description:"The max total of inbound peer for host"`
@@ -85,6 +111,8 @@ type Config struct {
 	Zmqpubhashtx string `long:"zmqpubhashtx" description:"Enable publish hash transaction in <address>"`
 	Zmqpubrawtx  string `long:"zmqpubrawtx" description:"Enable publish raw transaction in <address>"`
 
+	Zmqpubsequence string `long:"zmqpubsequence" description:"Enable publish block connections and mempool additions and removals in <address>"`
+
 	// Cache Invalid tx
 	CacheInvalidTx bool `long:"cacheinvalidtx" description:"Cache invalid transactions."`
 }
@@ -96,6 +124,22 @@ func (c *Config) GetMinningAddrs() []types.Address {
 func (c *Config) SetMiningAddrs(addr types.Address) {
 	c.miningAddrs = append(c.miningAddrs, addr)
 }
+func (c *Config) GetWatchAddrs() []types.Address {
+	return c.watchAddrs
+}
+
+func (c *Config) SetWatchAddrs(addr types.Address) {
+	c.watchAddrs = append(c.watchAddrs, addr)
+}
+
+func (c *Config) GetSnapshotPoint() (*hash.Hash, *hash.Hash) {
+	return c.snapshotPoint[0], c.snapshotPoint[1]
+}
+
+func (c *Config) SetSnapshotPoint(block *hash.Hash, root *hash.Hash) {
+	c.snapshotPoint = [2]*hash.Hash{block, root}
+}
+
 func (c *Config) GetWhitelists() []*net.IPNet {
 	return c.whitelists
 }
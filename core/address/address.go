@@ -6,11 +6,20 @@ import (
 	"errors"
 	"fmt"
 	"github.com/btceasypay/bitcoinpay/common/encode/base58"
+	"github.com/btceasypay/bitcoinpay/common/encode/bech32"
 	"github.com/btceasypay/bitcoinpay/common/hash"
 	"github.com/btceasypay/bitcoinpay/core/types"
 	"github.com/btceasypay/bitcoinpay/crypto/ecc"
 	"github.com/btceasypay/bitcoinpay/params"
 	"golang.org/x/crypto/ripemd160"
+	"strings"
+)
+
+// The address types encoded in the first 5 bit group of the data of a bech32
+// address.
+const (
+	bech32PubKeyHashType = 0
+	bech32ScriptHashType = 1
 )
 
 // encodeAddress returns a human-readable payment address given a ripemd160 hash
@@ -22,6 +31,23 @@ func encodeAddress(hash160 []byte, netID [2]byte) string {
 	return base58.BitcoinpayCheckEncode(hash160[:ripemd160.Size], netID[:])
 }
 
+// encodeBech32Address returns a bech32 payment address given the
+// human-readable prefix of the network, the address type and a ripemd160
+// hash.
+func encodeBech32Address(hrp string, addrType byte, hash160 []byte) string {
+	// Format is a 5 bit group for the address type (i.e. P2PKH vs P2SH),
+	// 32 groups for a RIPEMD160 hash, and 6 groups of checksum.
+	conv, err := bech32.ConvertBits(hash160[:ripemd160.Size], 8, 5, true)
+	if err != nil {
+		return ""
+	}
+	addr, err := bech32.EncodeBech32(hrp, append([]byte{addrType}, conv...))
+	if err != nil {
+		return ""
+	}
+	return addr
+}
+
 // encodePKAddress returns a human-readable payment address to a public key
 // given a serialized public key, a netID, and a signature suite.
 func encodePKAddress(serializedPK []byte, netID [2]byte, algo ecc.EcType) string {
@@ -60,9 +86,10 @@ func encodePKAddress(serializedPK []byte, netID [2]byte, algo ecc.EcType) string
 // PubKeyHashAddress is an Address for a pay-to-pubkey-hash (P2PKH)
 // transaction.
 type PubKeyHashAddress struct {
-	net   *params.Params
-	netID [2]byte
-	hash  [ripemd160.Size]byte
+	net    *params.Params
+	netID  [2]byte
+	hash   [ripemd160.Size]byte
+	bech32 bool
 }
 
 // NewAddressPubKeyHash returns a new AddressPubKeyHash.  pkHash must
@@ -87,6 +114,18 @@ func NewPubKeyHashAddress(pkHash []byte, net *params.Params, algo ecc.EcType) (*
 	return apkh, nil
 }
 
+// NewBech32PubKeyHashAddress returns a new secp256k1 PubKeyHashAddress which
+// is encoded in bech32 with the human-readable prefix of the network.  pkHash
+// must be 20 bytes.
+func NewBech32PubKeyHashAddress(pkHash []byte, net *params.Params) (*PubKeyHashAddress, error) {
+	apkh, err := NewPubKeyHashAddress(pkHash, net, ecc.ECDSA_Secp256k1)
+	if err != nil {
+		return nil, err
+	}
+	apkh.bech32 = true
+	return apkh, nil
+}
+
 // NewPubKeyHashAddressByNetId returns a new PubKeyHashAddress from net id directly instead from params
 func NewPubKeyHashAddressByNetId(pkHash []byte, netID [2]byte) (*PubKeyHashAddress,
 	error) {
@@ -128,6 +167,9 @@ func (a *PubKeyHashAddress) EcType() ecc.EcType {
 }
 func (a *PubKeyHashAddress) Encode() string {
 	//TODO error handling
+	if a.bech32 {
+		return encodeBech32Address(a.net.Bech32HRP, bech32PubKeyHashType, a.hash[:])
+	}
 	return encodeAddress(a.hash[:], a.netID)
 }
 
@@ -185,9 +227,10 @@ func (a *PubKeyHashAddress) ScriptAddress() []byte {
 // ScriptHashAddress is an Address for a pay-to-script-hash (P2SH)
 // transaction.
 type ScriptHashAddress struct {
-	net   *params.Params
-	hash  [ripemd160.Size]byte
-	netID [2]byte
+	net    *params.Params
+	hash   [ripemd160.Size]byte
+	netID  [2]byte
+	bech32 bool
 }
 
 // NewAddressScriptHashFromHash returns a new AddressScriptHash.  scriptHash
@@ -203,6 +246,18 @@ func NewAddressScriptHashFromHash(scriptHash []byte, net *params.Params) (*Scrip
 	return ash, nil
 }
 
+// NewBech32ScriptHashAddress returns a new ScriptHashAddress which is encoded
+// in bech32 with the human-readable prefix of the network.  scriptHash must
+// be 20 bytes.
+func NewBech32ScriptHashAddress(scriptHash []byte, net *params.Params) (*ScriptHashAddress, error) {
+	ash, err := NewAddressScriptHashFromHash(scriptHash, net)
+	if err != nil {
+		return nil, err
+	}
+	ash.bech32 = true
+	return ash, nil
+}
+
 // newAddressScriptHashFromHash is the internal API to create a script hash
 // address with a known leading identifier byte for a network, rather than
 // looking it up through its parameters.  This is useful when creating a new
@@ -230,6 +285,9 @@ func (a *ScriptHashAddress) Hash160() *[ripemd160.Size]byte {
 // EncodeAddress returns the string encoding of a pay-to-script-hash
 // address.  Part of the Address interface.
 func (a *ScriptHashAddress) Encode() string {
+	if a.bech32 {
+		return encodeBech32Address(a.net.Bech32HRP, bech32ScriptHashType, a.hash[:])
+	}
 	return encodeAddress(a.hash[:], a.netID)
 }
 
@@ -518,6 +576,12 @@ type ContractAddress struct {
 // DecodeAddress decodes the string encoding of an address and returns
 // the Address if addr is a valid encoding for a known address type
 func DecodeAddress(addr string) (types.Address, error) {
+	// Bech32 addresses are detected by the human-readable prefix of the
+	// network, which no base58 encoding starts with.
+	if net := detectNetworkForBech32Address(addr); net != nil {
+		return decodeBech32Address(addr, net)
+	}
+
 	// Switch on decoded length to determine the type.
 	decoded, netID, err := base58.BitcoinpayCheckDecode(addr)
 	if err != nil {
@@ -579,3 +643,46 @@ func detectNetworkForAddress(addr string) (*params.Params, error) {
 
 	return nil, fmt.Errorf("unknown network type in string encoded address")
 }
+
+// detectNetworkForBech32Address returns the network of a bech32 encoded
+// address by its human-readable prefix, or nil when the address does not
+// start with the prefix of a known network.
+func detectNetworkForBech32Address(addr string) *params.Params {
+	addr = strings.ToLower(addr)
+	for _, net := range []*params.Params{&params.MainNetParams,
+		&params.TestNetParams, &params.PrivNetParams, &params.MixNetParams} {
+		if strings.HasPrefix(addr, net.Bech32HRP+"1") {
+			return net
+		}
+	}
+	return nil
+}
+
+// decodeBech32Address decodes a bech32 encoded P2PKH or P2SH address of the
+// network.
+func decodeBech32Address(addr string, net *params.Params) (types.Address, error) {
+	hrp, data, err := bech32.DecodeBech32(addr)
+	if err != nil {
+		return nil, fmt.Errorf("decoded address is of unknown format: %v",
+			err.Error())
+	}
+	if hrp != net.Bech32HRP || len(data) < 1 {
+		return nil, ErrUnknownAddressType
+	}
+	decoded, err := bech32.ConvertBits(data[1:], 5, 8, false)
+	if err != nil {
+		return nil, fmt.Errorf("decoded address is of unknown format: %v",
+			err.Error())
+	}
+
+	switch data[0] {
+	case bech32PubKeyHashType:
+		return NewBech32PubKeyHashAddress(decoded, net)
+
+	case bech32ScriptHashType:
+		return NewBech32ScriptHashAddress(decoded, net)
+
+	default:
+		return nil, ErrUnknownAddressType
+	}
+}
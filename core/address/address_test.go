@@ -16,6 +16,7 @@ import (
 	// "fmt"
 	"encoding/hex"
 	"golang.org/x/crypto/ripemd160"
+	"strings"
 	"testing"
 )
 
@@ -333,3 +334,93 @@ func TestAddress(t *testing.T) {
 		}
 	}
 }
+
+func TestBech32Address(t *testing.T) {
+	hash160 := []byte{
+		0x8d, 0xc2, 0x68, 0xa8, 0xe2, 0x87, 0x6b, 0x94, 0x1b, 0x95,
+		0xf3, 0xbd, 0x3b, 0x71, 0x05, 0x0f, 0x00, 0x3c, 0x53, 0x83}
+	tests := []struct {
+		name string
+		addr string
+		f    func() (types.Address, error)
+		net  *params.Params
+	}{
+		{
+			name: "mainNet bech32 p2pkh",
+			addr: "bp1q3hpx328zsa4egxu47w7nkug9puqrc5urez867p",
+			f: func() (types.Address, error) {
+				return NewBech32PubKeyHashAddress(hash160, &params.MainNetParams)
+			},
+			net: &params.MainNetParams,
+		},
+		{
+			name: "testNet bech32 p2pkh",
+			addr: "tp1q3hpx328zsa4egxu47w7nkug9puqrc5ura5x77s",
+			f: func() (types.Address, error) {
+				return NewBech32PubKeyHashAddress(hash160, &params.TestNetParams)
+			},
+			net: &params.TestNetParams,
+		},
+		{
+			name: "privNet bech32 p2sh",
+			addr: "rp1p3hpx328zsa4egxu47w7nkug9puqrc5urpv2znw",
+			f: func() (types.Address, error) {
+				return NewBech32ScriptHashAddress(hash160, &params.PrivNetParams)
+			},
+			net: &params.PrivNetParams,
+		},
+		{
+			name: "mixNet bech32 p2sh",
+			addr: "xp1p3hpx328zsa4egxu47w7nkug9puqrc5ur3xwjnc",
+			f: func() (types.Address, error) {
+				return NewBech32ScriptHashAddress(hash160, &params.MixNetParams)
+			},
+			net: &params.MixNetParams,
+		},
+	}
+	for _, test := range tests {
+		addr, err := test.f()
+		if err != nil {
+			t.Fatalf("%v: creating address failed: %v", test.name, err)
+		}
+		if addr.Encode() != test.addr {
+			t.Fatalf("%v: created address %v, expected %v", test.name,
+				addr.Encode(), test.addr)
+		}
+		// Bech32 addresses are case insensitive.
+		for _, s := range []string{test.addr, strings.ToUpper(test.addr)} {
+			decoded, err := DecodeAddress(s)
+			if err != nil {
+				t.Fatalf("%v: decoding %v failed: %v", test.name, s, err)
+			}
+			if !reflect.DeepEqual(decoded, addr) {
+				t.Fatalf("%v: decoded address %#v, expected %#v", test.name,
+					decoded, addr)
+			}
+			if !IsBech32(decoded) || !IsForNetwork(decoded, test.net) {
+				t.Fatalf("%v: decoded address is not a bech32 address of "+
+					"the network", test.name)
+			}
+			if !bytes.Equal(decoded.ScriptAddress(), hash160) {
+				t.Fatalf("%v: script address %x, expected %x", test.name,
+					decoded.ScriptAddress(), hash160)
+			}
+		}
+	}
+
+	invalid := []string{
+		// Bad checksum.
+		"bp1q3hpx328zsa4egxu47w7nkug9puqrc5urez867q",
+		// Mixed case.
+		"bp1Q3hpx328zsa4egxu47w7nkug9puqrc5urez867p",
+		// Unknown address type.
+		"bp1z3hpx328zsa4egxu47w7nkug9puqrc5ur0hqvyh",
+		// Short hash.
+		"bp1q3hpx328zsa4egxu47w7nkug9puqrc5cvnqp49",
+	}
+	for _, s := range invalid {
+		if _, err := DecodeAddress(s); err == nil {
+			t.Fatalf("decoding invalid address %v succeeded", s)
+		}
+	}
+}
@@ -14,6 +14,20 @@ func IsForNetwork(addr types.Address, p *params.Params) bool {
 	switch addr := addr.(type) {
 	case *PubKeyHashAddress:
 		return addr.netID == p.PubKeyHashAddrID
+	case *ScriptHashAddress:
+		return addr.netID == p.ScriptHashAddrID
+	}
+	return false
+}
+
+// IsBech32 returns whether or not the address is encoded in bech32 with the
+// human-readable prefix of its network.
+func IsBech32(addr types.Address) bool {
+	switch addr := addr.(type) {
+	case *PubKeyHashAddress:
+		return addr.bech32
+	case *ScriptHashAddress:
+		return addr.bech32
 	}
 	return false
 }
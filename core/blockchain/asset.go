@@ -0,0 +1,232 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/engine/txscript"
+	"github.com/btceasypay/bitcoinpay/params"
+)
+
+// addAssetAmount adds the amount of the asset carried by the public key script
+// to the asset amounts, if the script is an asset script.
+func addAssetAmount(amounts map[types.AssetID]uint64, pkScript []byte) error {
+	id, amount, ok := txscript.ExtractAsset(pkScript)
+	if !ok {
+		return nil
+	}
+	if amount == 0 {
+		str := fmt.Sprintf("asset output carries no amount of asset %v", id)
+		return ruleError(ErrBadAssetAmount, str)
+	}
+	total := amounts[id] + amount
+	if total < amount {
+		str := fmt.Sprintf("total amount of asset %v overflows", id)
+		return ruleError(ErrBadAssetAmount, str)
+	}
+	amounts[id] = total
+	return nil
+}
+
+// checkAssetSanity performs context free checks on the asset outputs and the
+// asset marker of a transaction.
+func checkAssetSanity(tx *types.Transaction) error {
+	numMarkers := 0
+	assetOut := make(map[types.AssetID]uint64)
+	for _, txOut := range tx.TxOut {
+		if _, _, ok := types.ParseAssetMarker(txOut.PkScript); ok {
+			numMarkers++
+			continue
+		}
+		if err := addAssetAmount(assetOut, txOut.PkScript); err != nil {
+			return err
+		}
+	}
+
+	if numMarkers > 1 {
+		str := fmt.Sprintf("transaction has %d asset markers", numMarkers)
+		return ruleError(ErrBadAssetMarker, str)
+	}
+	// A coinbase has no inputs to carry assets from or to prove the issuer
+	// with.
+	if tx.IsCoinBase() && (numMarkers > 0 || len(assetOut) > 0) {
+		return ruleError(ErrBadAssetMarker, "coinbase transaction has "+
+			"asset outputs")
+	}
+	return nil
+}
+
+// assetIssuer returns the public key hash paid by the output the first input
+// of the transaction spends, which must be a pay-to-pubkey-hash or an asset
+// output.
+func (b *BlockChain) assetIssuer(tx *types.Tx, utxoView *UtxoViewpoint) ([]byte, error) {
+	txIn := tx.Transaction().TxIn[0]
+	utxoEntry := utxoView.LookupEntry(txIn.PreviousOut)
+	if utxoEntry == nil || utxoEntry.IsSpent() {
+		str := fmt.Sprintf("output %v referenced from transaction %s:0 "+
+			"either does not exist or has already been spent",
+			txIn.PreviousOut, tx.Hash())
+		return nil, ruleError(ErrMissingTxOut, str)
+	}
+	class, addrs, _, err := txscript.ExtractPkScriptAddrs(
+		utxoEntry.PkScript(), b.params)
+	if err != nil || len(addrs) != 1 ||
+		(class != txscript.PubKeyHashTy && class != txscript.AssetTy) {
+		str := fmt.Sprintf("first input of asset transaction %s does "+
+			"not spend a pay-to-pubkey-hash output", tx.Hash())
+		return nil, ruleError(ErrBadAssetIssuer, str)
+	}
+	return addrs[0].ScriptAddress(), nil
+}
+
+// checkAssetInputs ensures the asset amounts of the outputs of a transaction
+// are conserved from its inputs, except for the asset created by an issue
+// transaction and the amount of the asset burnt by a revocation.  The first
+// input of an issue or revoke transaction proves the signature of the issuer,
+// and only the issuer can revoke an asset.
+func (b *BlockChain) checkAssetInputs(tx *types.Tx, utxoView *UtxoViewpoint) error {
+	msgTx := tx.Transaction()
+	assetIn := make(map[types.AssetID]uint64)
+	for _, txIn := range msgTx.TxIn {
+		utxoEntry := utxoView.LookupEntry(txIn.PreviousOut)
+		if utxoEntry == nil {
+			continue
+		}
+		// The asset outputs created before the assets deployment was
+		// active were never checked, so they carry no asset.
+		active, err := b.assetsActiveAt(utxoEntry.BlockHash())
+		if err != nil {
+			return err
+		}
+		if !active {
+			continue
+		}
+		if err := addAssetAmount(assetIn, utxoEntry.PkScript()); err != nil {
+			return err
+		}
+	}
+	assetOut := make(map[types.AssetID]uint64)
+	for _, txOut := range msgTx.TxOut {
+		if err := addAssetAmount(assetOut, txOut.PkScript); err != nil {
+			return err
+		}
+	}
+
+	switch txType, id, _ := msgTx.AssetMarker(); txType {
+	case types.AssetIssue:
+		issuer, err := b.assetIssuer(tx, utxoView)
+		if err != nil {
+			return err
+		}
+		id = types.NewAssetID(issuer, &msgTx.TxIn[0].PreviousOut)
+		if assetOut[id] == 0 {
+			str := fmt.Sprintf("asset issue transaction %s issues no "+
+				"amount of asset %v", tx.Hash(), id)
+			return ruleError(ErrBadAssetAmount, str)
+		}
+		delete(assetOut, id)
+
+	case types.AssetRevoke:
+		issuer, err := b.assetIssuer(tx, utxoView)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(id.Issuer(), issuer) {
+			str := fmt.Sprintf("asset revoke transaction %s is not "+
+				"signed by the issuer of asset %v", tx.Hash(), id)
+			return ruleError(ErrBadAssetIssuer, str)
+		}
+		if assetOut[id] > assetIn[id] {
+			str := fmt.Sprintf("asset revoke transaction %s outputs "+
+				"%d of asset %v, more than its inputs %d", tx.Hash(),
+				assetOut[id], id, assetIn[id])
+			return ruleError(ErrAssetNotConserved, str)
+		}
+		delete(assetIn, id)
+		delete(assetOut, id)
+	}
+
+	for id, amount := range assetOut {
+		if assetIn[id] != amount {
+			str := fmt.Sprintf("transaction %s outputs %d of asset %v, "+
+				"but its inputs carry %d", tx.Hash(), amount, id,
+				assetIn[id])
+			return ruleError(ErrAssetNotConserved, str)
+		}
+	}
+	for id, amount := range assetIn {
+		if _, ok := assetOut[id]; !ok {
+			str := fmt.Sprintf("transaction %s burns %d of asset %v",
+				tx.Hash(), amount, id)
+			return ruleError(ErrAssetNotConserved, str)
+		}
+	}
+	return nil
+}
+
+// assetsActiveAt returns whether the assets deployment is active for the block
+// of the hash.  A block unknown to the chain, such as the zero hash of the
+// outputs of the transaction pool, is yet to be connected after the tip and
+// is assumed active, the caller checks the deployment for the tip.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) assetsActiveAt(blockHash *hash.Hash) (bool, error) {
+	node := b.index.LookupNode(blockHash)
+	if node == nil {
+		return true, nil
+	}
+	return b.isDeploymentActive(node, params.DeploymentAssets)
+}
+
+// AssetsActiveAt returns whether the assets deployment is active for the block
+// of the hash, so the indexes only track the assets the consensus rules
+// checked.
+//
+// This function MUST be called with the chain state lock held (for writes), as
+// it is when the indexes connect and disconnect blocks.
+func (b *BlockChain) AssetsActiveAt(blockHash *hash.Hash) (bool, error) {
+	return b.assetsActiveAt(blockHash)
+}
+
+// checkTransactionAssets performs the checks of the asset outputs and the
+// asset marker of a transaction and, unless it is a coinbase, ensures the
+// asset amounts are conserved from its inputs.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) checkTransactionAssets(tx *types.Tx, utxoView *UtxoViewpoint) error {
+	err := checkAssetSanity(tx.Transaction())
+	if err != nil {
+		return err
+	}
+	if tx.Transaction().IsCoinBase() {
+		return nil
+	}
+	return b.checkAssetInputs(tx, utxoView)
+}
+
+// CheckTransactionAssets checks the assets of a transaction to be included in
+// the block after the end of the main chain when the assets deployment is
+// active for that block.  It returns whether the deployment is active, so the
+// callers keep the transactions carrying assets out before the activation.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) CheckTransactionAssets(tx *types.Tx, utxoView *UtxoViewpoint) (bool, error) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	prevNode := b.index.LookupNode(b.bd.GetMainChainTip().GetHash())
+	if params.DeploymentAssets >= len(b.deployments()) {
+		return false, nil
+	}
+	state, err := b.deploymentState(prevNode, params.DeploymentAssets)
+	if err != nil || state != ThresholdActive {
+		return false, err
+	}
+	return true, b.checkTransactionAssets(tx, utxoView)
+}
@@ -0,0 +1,245 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"math"
+	"testing"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/address"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/crypto/ecc"
+	"github.com/btceasypay/bitcoinpay/engine/txscript"
+	"github.com/btceasypay/bitcoinpay/params"
+)
+
+func TestCheckAssetInputs(t *testing.T) {
+	net := &params.PrivNetParams
+	b := &BlockChain{params: net, index: newBlockIndex(nil, net)}
+	newAddr := func(b byte) types.Address {
+		pkh := make([]byte, 20)
+		pkh[0] = b
+		addr, err := address.NewPubKeyHashAddress(pkh, net, ecc.ECDSA_Secp256k1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return addr
+	}
+	issuer, holder := newAddr(1), newAddr(2)
+	scriptHash, err := address.NewAddressScriptHashFromHash(make([]byte, 20), net)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payTo := func(addr types.Address) *types.TxOutput {
+		pkScript, err := txscript.PayToAddrScript(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return types.NewTxOutput(1000, pkScript)
+	}
+	payAsset := func(addr types.Address, id *types.AssetID, amount uint64) *types.TxOutput {
+		pkScript, err := txscript.PayToAssetAddrScript(addr, id, amount)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return types.NewTxOutput(1000, pkScript)
+	}
+	marker := func(txType types.TxType, id *types.AssetID) *types.TxOutput {
+		pkScript, err := txscript.AssetMarkerScript(txType, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return types.NewTxOutput(0, pkScript)
+	}
+	newTx := func(prevOuts []*types.TxOutPoint, txOuts ...*types.TxOutput) *types.Tx {
+		tx := types.NewTransaction()
+		for _, prevOut := range prevOuts {
+			tx.AddTxIn(types.NewTxInput(prevOut, nil))
+		}
+		for _, txOut := range txOuts {
+			tx.AddTxOut(txOut)
+		}
+		return types.NewTx(tx)
+	}
+	outs := func(tx *types.Tx, indexes ...uint32) []*types.TxOutPoint {
+		prevOuts := make([]*types.TxOutPoint, len(indexes))
+		for i, index := range indexes {
+			prevOuts[i] = types.NewOutPoint(tx.Hash(), index)
+		}
+		return prevOuts
+	}
+
+	view := NewUtxoViewpoint()
+	funding := newTx(outs(types.NewTx(types.NewTransaction()), 0),
+		payTo(issuer), payTo(holder), payTo(scriptHash))
+	view.AddTxOuts(funding, &hash.Hash{})
+	id := types.NewAssetID(issuer.ScriptAddress(), outs(funding, 0)[0])
+	issue := newTx(outs(funding, 0), payAsset(holder, &id, 100),
+		marker(types.AssetIssue, nil))
+	view.AddTxOuts(issue, &hash.Hash{})
+	transfer := newTx(outs(issue, 0), payAsset(holder, &id, 60),
+		payAsset(issuer, &id, 40))
+	view.AddTxOuts(transfer, &hash.Hash{})
+	otherID := types.NewAssetID(holder.ScriptAddress(), outs(funding, 1)[0])
+
+	tests := []struct {
+		name string
+		tx   *types.Tx
+		code ErrorCode
+	}{
+		{"issue", issue, 0},
+		{"issue without amount", newTx(outs(funding, 0), payTo(holder),
+			marker(types.AssetIssue, nil)), ErrBadAssetAmount},
+		{"issue by a holder of no pubkey hash", newTx(outs(funding, 2),
+			payAsset(holder, &id, 100), marker(types.AssetIssue, nil)),
+			ErrBadAssetIssuer},
+		{"issue creating another asset", newTx(outs(funding, 1),
+			payAsset(holder, &otherID, 100), payAsset(holder, &id, 5),
+			marker(types.AssetIssue, nil)), ErrAssetNotConserved},
+		{"transfer", transfer, 0},
+		{"transfer creating the asset", newTx(outs(issue, 0),
+			payAsset(holder, &id, 60), payAsset(issuer, &id, 50)),
+			ErrAssetNotConserved},
+		{"transfer creating another asset", newTx(outs(funding, 1),
+			payAsset(holder, &otherID, 10)), ErrAssetNotConserved},
+		{"burn", newTx(outs(issue, 0), payTo(holder)),
+			ErrAssetNotConserved},
+		{"revoke", newTx(outs(transfer, 1), payAsset(issuer, &id, 10),
+			marker(types.AssetRevoke, &id)), 0},
+		{"revoke of all", newTx(outs(transfer, 1), payTo(issuer),
+			marker(types.AssetRevoke, &id)), 0},
+		{"revoke creating the asset", newTx(outs(transfer, 1),
+			payAsset(issuer, &id, 50), marker(types.AssetRevoke, &id)),
+			ErrAssetNotConserved},
+		{"revoke by a holder", newTx(outs(transfer, 0), payTo(holder),
+			marker(types.AssetRevoke, &id)), ErrBadAssetIssuer},
+		{"revoke of a held asset", newTx(outs(transfer, 1, 0), payTo(issuer),
+			marker(types.AssetRevoke, &id)), 0},
+	}
+	for _, test := range tests {
+		err := b.checkAssetInputs(test.tx, view)
+		if test.code == 0 {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", test.name, err)
+			}
+			continue
+		}
+		if rerr, ok := err.(RuleError); !ok || rerr.ErrorCode != test.code {
+			t.Errorf("%s: error %v, want %v", test.name, err, test.code)
+		}
+	}
+}
+
+func TestCheckAssetSanity(t *testing.T) {
+	var id types.AssetID
+	marker, err := txscript.AssetMarkerScript(types.AssetIssue, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := address.NewPubKeyHashAddress(make([]byte, 20),
+		&params.PrivNetParams, ecc.ECDSA_Secp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	noAmount, err := txscript.PayToAssetAddrScript(addr, &id, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := types.NewTransaction()
+	tx.AddTxIn(types.NewTxInput(types.NewOutPoint(&hash.Hash{1}, 0), nil))
+	tx.AddTxOut(types.NewTxOutput(0, marker))
+	if err := checkAssetSanity(tx); err != nil {
+		t.Fatalf("single marker: %v", err)
+	}
+	if txType := types.DetermineTxType(tx); txType != types.AssetIssue {
+		t.Fatalf("transaction type %v, want %v", txType, types.AssetIssue)
+	}
+	tx.AddTxOut(types.NewTxOutput(0, marker))
+	if err := checkAssetSanity(tx); err == nil ||
+		err.(RuleError).ErrorCode != ErrBadAssetMarker {
+		t.Fatalf("two markers: %v", err)
+	}
+	tx.TxOut = tx.TxOut[:1]
+	tx.AddTxOut(types.NewTxOutput(1000, noAmount))
+	if err := checkAssetSanity(tx); err == nil ||
+		err.(RuleError).ErrorCode != ErrBadAssetAmount {
+		t.Fatalf("output without asset amount: %v", err)
+	}
+}
+
+// TestDeploymentAssets ensures the assets are only checked once their
+// deployment is active, and the asset outputs created before carry no asset.
+func TestDeploymentAssets(t *testing.T) {
+	par := params.PrivNetParams
+	par.RuleChangeActivationThreshold = 3
+	par.MinerConfirmationWindow = 4
+	par.Deployments = map[uint32][]params.ConsensusDeployment{
+		1: {
+			params.DeploymentCheckMultiSigAlt: {BitNumber: 0, StartTime: 0, ExpireTime: math.MaxInt64},
+			params.DeploymentAssets:           {BitNumber: 1, StartTime: 0, ExpireTime: math.MaxInt64},
+		},
+	}
+	b, teardown := newVersionBitsChain(t, &par)
+	defer teardown()
+
+	addr, err := address.NewPubKeyHashAddress(make([]byte, 20), &par,
+		ecc.ECDSA_Secp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plainScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id types.AssetID
+	id[0] = 1
+	assetScript, err := txscript.PayToAssetAddrScript(addr, &id, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spend := func(prev *types.Tx, pkScript []byte) *types.Tx {
+		tx := types.NewTransaction()
+		tx.AddTxIn(types.NewTxInput(types.NewOutPoint(prev.Hash(), 0), nil))
+		tx.AddTxOut(types.NewTxOutput(1000, pkScript))
+		return types.NewTx(tx)
+	}
+
+	// An asset output forged before the activation is accepted unchecked.
+	view := NewUtxoViewpoint()
+	funding := types.NewTransaction()
+	funding.AddTxIn(types.NewTxInput(types.NewOutPoint(&hash.Hash{1}, 0), nil))
+	funding.AddTxOut(types.NewTxOutput(1000, plainScript))
+	view.AddTxOuts(types.NewTx(funding), &hash.Hash{})
+	forge := spend(types.NewTx(funding), assetScript)
+	signal := uint32(vbTopBits | 1<<(vbFirstBit+1) | 1)
+	for _, version := range []uint32{1, 1, 1, 1, signal, signal, signal, signal, 1, 1, 1} {
+		addVersionBitsNode(t, b, version)
+	}
+	active, err := b.CheckTransactionAssets(forge, view)
+	if err != nil || active {
+		t.Fatalf("assets checked before the activation: %v, %v", active, err)
+	}
+	node := addVersionBitsNode(t, b, 1)
+	view.AddTxOuts(forge, &node.hash)
+
+	// The next block is the first one checking the assets, the forged
+	// output carries no asset anymore.
+	active, err = b.CheckTransactionAssets(spend(forge, assetScript), view)
+	if rerr, ok := err.(RuleError); !active || !ok ||
+		rerr.ErrorCode != ErrAssetNotConserved {
+		t.Fatalf("forged asset transferred after the activation: %v, %v",
+			active, err)
+	}
+	active, err = b.CheckTransactionAssets(spend(forge, plainScript), view)
+	if err != nil || !active {
+		t.Fatalf("spend of a forged asset output: %v, %v", active, err)
+	}
+	node = addVersionBitsNode(t, b, 1)
+	if ok, err := b.isDeploymentActive(node, params.DeploymentAssets); err != nil || !ok {
+		t.Fatalf("block %d doesn't enforce the active deployment: %v", node.height, err)
+	}
+}
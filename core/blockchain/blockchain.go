@@ -12,8 +12,10 @@ import (
 	"github.com/btceasypay/bitcoinpay/core/types"
 	"github.com/btceasypay/bitcoinpay/database"
 	"github.com/btceasypay/bitcoinpay/engine/txscript"
+	"github.com/btceasypay/bitcoinpay/metrics"
 	"github.com/btceasypay/bitcoinpay/params"
 	"github.com/btceasypay/bitcoinpay/services/common/progresslog"
+	gometrics "github.com/rcrowley/go-metrics"
 	"os"
 	"sort"
 	"sync"
@@ -31,6 +33,12 @@ const (
 	// causing constant dynamic reloading.  This value should be larger than
 	// that for minMemoryStakeNodes.
 	minMemoryNodes = 2880
+
+	// dagInfoFlushInterval is the number of blocks after which the state of
+	// the consensus algorithm is written to the DAG info.  Encoding it grows
+	// with the DAG, so it isn't written for every block.  The state written
+	// before a crash is recalculated when the blocks are loaded.
+	dagInfoFlushInterval = 500
 )
 
 // BlockChain provides functions such as rejecting duplicate blocks, ensuring
@@ -55,6 +63,9 @@ type BlockChain struct {
 	// values.
 	subsidyCache *SubsidyCache
 
+	// processTimer measures the latency of processing the blocks.
+	processTimer gometrics.Timer
+
 	// chainLock protects concurrent access to the vast majority of the
 	// fields in this struct below this point.
 	chainLock sync.RWMutex
@@ -97,6 +108,18 @@ type BlockChain struct {
 	stateLock     sync.RWMutex
 	stateSnapshot *BestState
 
+	// utxoCommit keeps the Merkle Patricia trie commitment of the utxo
+	// set.  It is protected by the chain lock.
+	utxoCommit *utxoCommitment
+
+	// snapshot is the progress of syncing from a utxo snapshot, it is nil
+	// once all blocks are validated.  It is protected by the chain lock.
+	snapshot *utxoSnapshot
+
+	// interrupt is closed when the chain is shut down, it stops the
+	// validation of the blocks of a utxo snapshot.
+	interrupt <-chan struct{}
+
 	// pruner is the automatic pruner for block nodes and stake nodes,
 	// so that the memory may be restored by the garbage collector if
 	// it is unlikely to be referenced in the future.
@@ -108,6 +131,10 @@ type BlockChain struct {
 	// block version
 	BlockVersion uint32
 
+	// deploymentCaches caches the current deployment threshold state for
+	// blocks in each of the actively defined deployments.
+	deploymentCaches []thresholdStateCache
+
 	// Cache Invalid tx
 	CacheInvalidTx bool
 }
@@ -252,6 +279,10 @@ func New(config *Config) (*BlockChain, error) {
 	if config.BlockVersion > types.MaxBlockVersionValue {
 		return nil, AssertError(fmt.Sprintf("BlockVersion Can not bigger than %d", types.MaxBlockVersionValue))
 	}
+	deployments := par.Deployments[config.BlockVersion]
+	if err := checkDeployments(deployments); err != nil {
+		return nil, err
+	}
 
 	b := BlockChain{
 		checkpointsByLayer: checkpointsByLayer,
@@ -265,12 +296,15 @@ func New(config *Config) (*BlockChain, error) {
 		orphans:            make(map[hash.Hash]*orphanBlock),
 		BlockVersion:       config.BlockVersion,
 		CacheInvalidTx:     config.CacheInvalidTx,
+		interrupt:          config.Interrupt,
+		deploymentCaches:   newThresholdCaches(uint32(len(deployments))),
 	}
 	b.subsidyCache = NewSubsidyCache(0, b.params)
 
 	b.bd = &blockdag.BlockDAG{}
 	b.bd.Init(config.DAGType, b.CalcWeight,
 		1.0/float64(par.TargetTimePerBlock/time.Second), b.index.GetDAGBlockID, b.db)
+	b.index.bd = b.bd
 	// Initialize the chain state from the passed database.  When the db
 	// does not yet contain any chain state, both it and the chain state
 	// will be initialized to contain only the genesis block.
@@ -278,6 +312,31 @@ func New(config *Config) (*BlockChain, error) {
 		return nil, err
 	}
 
+	// Load the progress of syncing from a utxo snapshot.
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		b.snapshot, err = dbFetchUtxoSnapshot(dbTx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if b.snapshot != nil && b.snapshot.invalid {
+		return nil, errInvalidUtxoSnapshot
+	}
+
+	// Load the utxo commitment, it is built from the utxo set when the
+	// database does not have one yet.  There is none while the utxo set of
+	// a utxo snapshot is downloaded.
+	if !b.utxoSnapshotPending() {
+		utxoCommit, err := newUtxoCommitment(b.db, uint64(b.BestSnapshot().GraphState.GetMainOrder()),
+			b.params.Checkpoints, func(_ database.Tx, h *hash.Hash) int64 { return b.GetFees(h) })
+		if err != nil {
+			return nil, err
+		}
+		b.utxoCommit = utxoCommit
+	}
+
 	// Initialize and catch up all of the currently active optional indexes
 	// as needed.
 	if config.IndexManager != nil {
@@ -286,12 +345,30 @@ func New(config *Config) (*BlockChain, error) {
 			return nil, err
 		}
 	}
-	err := b.CheckCacheInvalidTxConfig()
+	// Continue validating the blocks of a loaded utxo snapshot.
+	if b.snapshot != nil && b.snapshot.loaded {
+		go b.validateUtxoSnapshot()
+	}
+	err = b.CheckCacheInvalidTxConfig()
 	if err != nil {
 		return nil, err
 	}
 	b.pruner = newChainPruner(&b)
 
+	b.processTimer = metrics.NewTimer("chain/process")
+	metrics.NewFunctionalGauge("chain/orphans", func() int64 {
+		return int64(b.GetOrphansTotal())
+	})
+	metrics.NewFunctionalGauge("dag/blocks", func() int64 {
+		return int64(b.bd.GetBlockTotal())
+	})
+	metrics.NewFunctionalGauge("dag/tips", func() int64 {
+		return int64(b.bd.GetTips().Size())
+	})
+	metrics.NewFunctionalGauge("dag/bluescore", func() int64 {
+		return int64(b.bd.GetTipsBlues())
+	})
+
 	log.Info(fmt.Sprintf("DAG Type:%s", b.bd.GetName()))
 	log.Info("Blockchain database version", "chain", b.dbInfo.version, "compression", b.dbInfo.compVer,
 		"index", b.dbInfo.bidxVer)
@@ -452,7 +529,7 @@ func (b *BlockChain) initChainState(interrupt <-chan struct{}) error {
 			if err != nil {
 				return err
 			}
-			if i != 0 && block.Block().Header.GetVersion() != b.BlockVersion {
+			if i != 0 && baseBlockVersion(block.Block().Header.GetVersion()) != b.BlockVersion {
 				return fmt.Errorf("The dag block is not match current genesis block. you can cleanup your block data base by '--cleanup'.")
 			}
 			parents := []*blockNode{}
@@ -519,6 +596,11 @@ func (b *BlockChain) IsCurrent() bool {
 //
 // This function MUST be called with the chain state lock held (for reads).
 func (b *BlockChain) isCurrent() bool {
+	// Not current while the utxo set of a utxo snapshot is downloaded.
+	if b.utxoSnapshotPending() {
+		return false
+	}
+
 	// Not current if the latest main (best) chain height is before the
 	// latest known good checkpoint (when checkpoints are enabled).
 	checkpoint := b.LatestCheckpoint()
@@ -734,6 +816,11 @@ func (b *BlockChain) connectDagChain(node *blockNode, block *types.SerializedBlo
 		if !node.IsOrdered() {
 			return true, nil
 		}
+		// Only the order is kept while the utxo set of a utxo snapshot is
+		// downloaded.
+		if b.utxoSnapshotPending() {
+			return true, b.connectBlockOrder(node, block)
+		}
 		// Perform several checks to verify the block can be connected
 		// to the main chain without violating any rules and without
 		// actually connecting the block.
@@ -848,6 +935,9 @@ func (b *BlockChain) updateBestState(node *blockNode, block *types.SerializedBlo
 		if err != nil {
 			return err
 		}
+		if b.bd.GetBlockTotal()%dagInfoFlushInterval == 0 {
+			return blockdag.DBPutDAGInfo(dbTx, b.bd)
+		}
 		return nil
 	})
 
@@ -866,6 +956,18 @@ func (b *BlockChain) updateBestState(node *blockNode, block *types.SerializedBlo
 	return nil
 }
 
+// FlushDAGInfo writes the state of the consensus algorithm to the DAG info.  It
+// is only written every dagInfoFlushInterval blocks while the blocks are
+// added, so it's called when the node shuts down to keep the latest state.
+func (b *BlockChain) FlushDAGInfo() error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	return b.db.Update(func(dbTx database.Tx) error {
+		return blockdag.DBPutDAGInfo(dbTx, b.bd)
+	})
+}
+
 // connectBlock handles connecting the passed node/block to the end of the main
 // (best) chain.
 //
@@ -878,8 +980,22 @@ func (b *BlockChain) updateBestState(node *blockNode, block *types.SerializedBlo
 //
 // This function MUST be called with the chain state lock held (for writes).
 func (b *BlockChain) connectBlock(node *blockNode, block *types.SerializedBlock, view *UtxoViewpoint, stxos []SpentTxOut) error {
+	// Apply the utxo view to the utxo commitment, its new trie nodes are
+	// written together with the rest of the block below.  The fees of the
+	// block are committed with the first output of its coinbase.
+	blockFees := calcBlockFees(block, stxos)
+	utxoRoot, err := b.utxoCommit.apply(view, func(h *hash.Hash) int64 {
+		if h.IsEqual(block.Hash()) {
+			return blockFees
+		}
+		return b.GetFees(h)
+	})
+	if err != nil {
+		return err
+	}
+
 	// Atomically insert info into the database.
-	err := b.db.Update(func(dbTx database.Tx) error {
+	err = b.db.Update(func(dbTx database.Tx) error {
 		// Add the block hash and height to the block index.
 		err := dbPutBlockIndex(dbTx, block.Hash(), node.order)
 		if err != nil {
@@ -900,6 +1016,17 @@ func (b *BlockChain) connectBlock(node *blockNode, block *types.SerializedBlock,
 		if err != nil {
 			return err
 		}
+
+		// Store the utxo commitment and its root for the order of the
+		// block.
+		err = b.utxoCommit.flush(dbTx, &utxoRoot, node.order)
+		if err != nil {
+			return err
+		}
+		err = dbPutUtxoRoot(dbTx, node.order, &utxoRoot)
+		if err != nil {
+			return err
+		}
 		// Allow the index manager to call each of the currently active
 		// optional indexes with the block being connected so they can
 		// update themselves accordingly.
@@ -912,8 +1039,10 @@ func (b *BlockChain) connectBlock(node *blockNode, block *types.SerializedBlock,
 		return nil
 	})
 	if err != nil {
+		b.utxoCommit.rollback()
 		return err
 	}
+	b.utxoCommit.setRoot(utxoRoot, node.order)
 
 	// Prune fully spent entries and mark all entries in the view unmodified
 	// now that the modifications have been committed to the database.
@@ -928,8 +1057,18 @@ func (b *BlockChain) connectBlock(node *blockNode, block *types.SerializedBlock,
 //
 // This function MUST be called with the chain state lock held (for writes).
 func (b *BlockChain) disconnectBlock(node *blockNode, block *types.SerializedBlock, view *UtxoViewpoint, stxos []SpentTxOut) error {
+	// Revert the utxo commitment to the state before the block.
+	utxoRoot, err := b.utxoCommit.apply(view, b.GetFees)
+	if err != nil {
+		return err
+	}
+	var utxoOrder uint64
+	if node.order > 0 {
+		utxoOrder = node.order - 1
+	}
+
 	// Calculate the exact subsidy produced by adding the block.
-	err := b.db.Update(func(dbTx database.Tx) error {
+	err = b.db.Update(func(dbTx database.Tx) error {
 		// Remove the block hash and order from the block index.
 		err := dbRemoveBlockIndex(dbTx, block.Hash(), int64(node.order)) //TODO, remove type conversion
 		if err != nil {
@@ -949,6 +1088,16 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *types.SerializedBlo
 		if err != nil {
 			return err
 		}
+
+		// Remove the utxo commitment root of the order of the block.
+		err = b.utxoCommit.flush(dbTx, &utxoRoot, utxoOrder)
+		if err != nil {
+			return err
+		}
+		err = dbRemoveUtxoRoot(dbTx, node.order)
+		if err != nil {
+			return err
+		}
 		// Allow the index manager to call each of the currently active
 		// optional indexes with the block being disconnected so they
 		// can update themselves accordingly.
@@ -961,8 +1110,10 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *types.SerializedBlo
 		return nil
 	})
 	if err != nil {
+		b.utxoCommit.rollback()
 		return err
 	}
+	b.utxoCommit.setRoot(utxoRoot, utxoOrder)
 
 	// Prune fully spent entries and mark all entries in the view unmodified
 	// now that the modifications have been committed to the database.
@@ -1001,6 +1152,23 @@ func (b *BlockChain) reorganizeChain(detachNodes BlockNodeList, attachNodes *lis
 	var err error
 
 	dl := len(detachNodes)
+	if dl > 0 {
+		// Notify the caller that the order of the DAG is changing, the
+		// disconnected and connected blocks are announced afterwards.
+		rd := &ReorganizationNotifyData{
+			OldHash:   detachNodes[dl-1].hash,
+			OldHeight: uint64(detachNodes[dl-1].GetHeight()),
+			NewHash:   *newBlock.Hash(),
+			NewHeight: uint64(node.GetHeight()),
+		}
+		for i := dl - 1; i >= 0; i-- {
+			rd.DetachedBlocks = append(rd.DetachedBlocks, detachNodes[i].hash)
+		}
+		for e := attachNodes.Front(); e != nil; e = e.Next() {
+			rd.AttachedBlocks = append(rd.AttachedBlocks, *e.Value.(blockdag.IBlock).GetHash())
+		}
+		b.sendNotification(Reorganization, rd)
+	}
 	for i := dl - 1; i >= 0; i-- {
 		n = detachNodes[i]
 		newn := b.index.LookupNode(n.GetHash())
@@ -1012,6 +1180,19 @@ func (b *BlockChain) reorganizeChain(detachNodes BlockNodeList, attachNodes *lis
 			panic("no ordered")
 		}
 		block.SetOrder(n.order)
+		if b.utxoSnapshotPending() {
+			err = b.disconnectBlockOrder(n, block)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		// The blocks of a utxo snapshot can't be disconnected before
+		// they are validated, there is no spend journal for them.
+		if b.snapshot != nil && n.order <= b.snapshot.order {
+			return AssertError(fmt.Sprintf("block %v of the utxo snapshot "+
+				"is disconnected before it is validated", n.hash))
+		}
 		// Load all of the utxos referenced by the block that aren't
 		// already in the view.
 		var stxos []SpentTxOut
@@ -1074,6 +1255,13 @@ func (b *BlockChain) reorganizeChain(detachNodes BlockNodeList, attachNodes *lis
 		if !n.IsOrdered() {
 			continue
 		}
+		if b.utxoSnapshotPending() {
+			err = b.connectBlockOrder(n, block)
+			if err != nil {
+				return err
+			}
+			continue
+		}
 		view := NewUtxoViewpoint()
 		view.SetViewpoints([]*hash.Hash{n.GetHash()})
 		stxos := []SpentTxOut{}
@@ -1252,6 +1440,20 @@ func (b *BlockChain) CalculateDAGDuplicateTxs(block *types.SerializedBlock) {
 }
 
 func (b *BlockChain) CalculateFees(block *types.SerializedBlock) int64 {
+	spentTxos, err := b.fetchSpendJournal(block)
+	if err != nil {
+		return 0
+	}
+	// The blocks before a utxo snapshot have no spend journal until they
+	// are validated, their fees came with the snapshot.
+	if spentTxos == nil && b.snapshot != nil {
+		return b.utxoSnapshotFees(block.Hash())
+	}
+	return calcBlockFees(block, spentTxos)
+}
+
+// calcBlockFees returns the fees of the block from the outputs it spent.
+func calcBlockFees(block *types.SerializedBlock, spentTxos []SpentTxOut) int64 {
 	transactions := block.Transactions()
 	var totalAtomOut int64
 	for i, tx := range transactions {
@@ -1262,10 +1464,6 @@ func (b *BlockChain) CalculateFees(block *types.SerializedBlock) int64 {
 			totalAtomOut += int64(txOut.Amount)
 		}
 	}
-	spentTxos, err := b.fetchSpendJournal(block)
-	if err != nil {
-		return 0
-	}
 	var totalAtomIn int64
 	if spentTxos != nil {
 		for _, st := range spentTxos {
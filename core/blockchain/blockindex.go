@@ -45,9 +45,16 @@ type blockIndex struct {
 	db     database.DB
 	params *params.Params
 
+	// bd is the DAG the pruned nodes are loaded again from.
+	bd *blockdag.BlockDAG
+
 	sync.RWMutex
 	index map[hash.Hash]*blockNode
 	dirty map[*blockNode]struct{}
+
+	// The number of pruned nodes and of pruned nodes loaded again
+	pruned uint64
+	loaded uint64
 }
 
 // newBlockIndex returns a new empty instance of a block index.  The index will
@@ -71,13 +78,18 @@ func (bi *blockIndex) lookupNode(hash *hash.Hash) *blockNode {
 }
 
 // LookupNode returns the block node identified by the provided hash.  It will
-// return nil if there is no entry for the hash.
+// return nil if there is no entry for the hash.  A pruned node is loaded again
+// from the database.
 //
 // This function is safe for concurrent access.
 func (bi *blockIndex) LookupNode(hash *hash.Hash) *blockNode {
 	bi.RLock()
 	node := bi.lookupNode(hash)
+	pruned := bi.pruned > 0
 	bi.RUnlock()
+	if node == nil && pruned {
+		node = bi.loadNode(hash)
+	}
 	return node
 }
 
@@ -104,10 +116,7 @@ func (bi *blockIndex) AddNode(node *blockNode) {
 //
 // This function is safe for concurrent access.
 func (bi *blockIndex) HaveBlock(hash *hash.Hash) bool {
-	bi.RLock()
-	_, hasBlock := bi.index[*hash]
-	bi.RUnlock()
-	return hasBlock
+	return bi.LookupNode(hash) != nil
 }
 
 // NodeStatus returns the status associated with the provided node.
@@ -137,8 +146,13 @@ func (bi *blockIndex) GetMaxOrderFromList(list []*hash.Hash) *hash.Hash {
 	return maxHash
 }
 
+// GetDAGBlockID returns the DAG block id of the node with the hash.  It is
+// called by the DAG holding its lock, so pruned nodes are not loaded again and
+// the DAG looks up their ids itself.
 func (bi *blockIndex) GetDAGBlockID(h *hash.Hash) uint {
-	bn := bi.LookupNode(h)
+	bi.RLock()
+	bn := bi.lookupNode(h)
+	bi.RUnlock()
 	if bn == nil {
 		return blockdag.MaxId
 	}
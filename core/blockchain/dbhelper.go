@@ -280,6 +280,17 @@ func (b *BlockChain) createChainState() error {
 			return err
 		}
 
+		// Create the buckets that house the DAG block hash to id
+		// mappings and the children of the DAG blocks.
+		_, err = meta.CreateBucket(dbnamespace.DagBlockIdBucketName)
+		if err != nil {
+			return err
+		}
+		_, err = meta.CreateBucket(dbnamespace.DagChildrenBucketName)
+		if err != nil {
+			return err
+		}
+
 		// Create the bucket that houses the chain block hash to height
 		// index.
 		_, err = meta.CreateBucket(dbnamespace.HashIndexBucketName)
@@ -451,6 +462,32 @@ func dbRemoveBlockIndex(dbTx database.Tx, hash *hash.Hash, order int64) error {
 	return orderIndex.Delete(serializedOrdert[:])
 }
 
+// dbPutBlockWorkSum uses an existing database transaction to store the work
+// sum of the block node, which is pruned from memory.  The bucket is created
+// on the first pruning.
+func dbPutBlockWorkSum(dbTx database.Tx, node *blockNode) error {
+	bucket, err := dbTx.Metadata().CreateBucketIfNotExists(dbnamespace.BlockWorkSumBucketName)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(node.hash[:], node.workSum.Bytes())
+}
+
+// dbFetchBlockWorkSum uses an existing database transaction to retrieve the
+// work sum of the pruned block node with the hash.  It returns nil if it was
+// not stored.
+func dbFetchBlockWorkSum(dbTx database.Tx, hash *hash.Hash) *big.Int {
+	bucket := dbTx.Metadata().Bucket(dbnamespace.BlockWorkSumBucketName)
+	if bucket == nil {
+		return nil
+	}
+	serialized := bucket.Get(hash[:])
+	if serialized == nil {
+		return nil
+	}
+	return new(big.Int).SetBytes(serialized)
+}
+
 // dbPutBestState uses an existing database transaction to update the best chain
 // state with the given parameters.
 func dbPutBestState(dbTx database.Tx, snapshot *BestState, workSum *big.Int) error {
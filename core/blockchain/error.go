@@ -335,6 +335,27 @@ const (
 	// ErrNoViewpoint
 	ErrNoViewpoint
 
+	// ErrBadAssetMarker indicates a transaction has more than one asset
+	// marker output, or a coinbase has an asset marker or asset outputs.
+	ErrBadAssetMarker
+
+	// ErrBadAssetAmount indicates an asset output carries a zero amount,
+	// or the asset amounts of a transaction overflow.
+	ErrBadAssetAmount
+
+	// ErrBadAssetIssuer indicates the first input of an asset issue or
+	// revoke transaction does not spend a pay-to-pubkey-hash output of
+	// the issuer.
+	ErrBadAssetIssuer
+
+	// ErrAssetNotConserved indicates the asset amounts of the outputs of a
+	// transaction do not match the asset amounts of its inputs.
+	ErrAssetNotConserved
+
+	// ErrBadUtxoSnapshot indicates a chunk of a utxo snapshot received from
+	// a peer is malformed, or the utxo set does not match the trusted root.
+	ErrBadUtxoSnapshot
+
 	// numErrorCodes is the maximum error code number used in tests.
 	numErrorCodes
 )
@@ -410,6 +431,12 @@ var errorCodeStrings = map[ErrorCode]string{
 
 	ErrNoBlueCoinbase: "ErrNoBlueCoinbase",
 	ErrNoViewpoint:    "ErrNoViewpoint",
+
+	ErrBadAssetMarker:    "ErrBadAssetMarker",
+	ErrBadAssetAmount:    "ErrBadAssetAmount",
+	ErrBadAssetIssuer:    "ErrBadAssetIssuer",
+	ErrAssetNotConserved: "ErrAssetNotConserved",
+	ErrBadUtxoSnapshot:   "ErrBadUtxoSnapshot",
 }
 
 // String returns the ErrorCode as a human-readable name.
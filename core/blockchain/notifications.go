@@ -36,7 +36,8 @@ const (
 	BlockDisconnected
 
 	// Reorganization indicates that a blockchain reorganization is in
-	// progress.
+	// progress.  It is sent before the blocks losing their order are
+	// disconnected, the disconnect and connect notifications follow.
 	Reorganization
 )
 
@@ -77,12 +78,22 @@ type BlockAcceptedNotifyData struct {
 }
 
 // ReorganizationNotifyData is the structure for data indicating information
-// about a reorganization.
+// about a reorganization.  In the DAG a reorganization means the order of
+// the blocks after the fork point changes, OldHash is the block that held the
+// highest order before and NewHash is the block causing the reorganization.
 type ReorganizationNotifyData struct {
 	OldHash   hash.Hash
 	OldHeight uint64
 	NewHash   hash.Hash
 	NewHeight uint64
+
+	// DetachedBlocks are the blocks that lose their order, in the order they
+	// are disconnected.
+	DetachedBlocks []hash.Hash
+
+	// AttachedBlocks are the blocks that get (re)ordered, in the order they
+	// are connected.
+	AttachedBlocks []hash.Hash
 }
 
 // Notification defines notification that is sent to the caller via the callback
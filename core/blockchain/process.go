@@ -49,8 +49,15 @@ const (
 //
 // This function is safe for concurrent access.
 func (b *BlockChain) ProcessBlock(block *types.SerializedBlock, flags BehaviorFlags) (bool, error) {
+	defer b.processTimer.UpdateSince(time.Now())
 	b.ChainRLock()
 
+	// The chain is stopped once its utxo snapshot turned out invalid.
+	if b.snapshot != nil && b.snapshot.invalid {
+		b.ChainRUnlock()
+		return false, errInvalidUtxoSnapshot
+	}
+
 	fastAdd := flags&BFFastAdd == BFFastAdd
 
 	blockHash := block.Hash()
@@ -2,25 +2,51 @@
 package blockchain
 
 import (
+	"fmt"
+	"runtime"
 	"time"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/blockdag"
+	"github.com/btceasypay/bitcoinpay/database"
 )
 
 // pruningIntervalInMinutes is the interval in which to prune the blockchain's
 // nodes and restore memory to the garbage collector.
 const pruningIntervalInMinutes = 5
 
+// minPruneDepth is the minimum number of main chain blocks below the main
+// chain tip which are kept in memory.  It is far below the stable blocks, so
+// the pruned blocks are not reorganized anymore.
+const minPruneDepth = blockdag.StableConfirmations * 100
+
 // chainPruner is used to occasionally prune the blockchain of old nodes that
 // can be freed to the garbage collector.
 type chainPruner struct {
 	chain              *BlockChain
 	lastNodeInsertTime time.Time
+
+	// depth is the number of main chain blocks below the main chain tip
+	// which are kept in memory.
+	depth uint
+
+	// The time and the duration of the last pruning
+	lastPrune         time.Time
+	lastPruneDuration time.Duration
 }
 
-// newChainPruner returns a new chain pruner.
+// newChainPruner returns a new chain pruner.  The blocks of the difficulty
+// adjustment windows are kept in memory, since they are read for every block.
 func newChainPruner(chain *BlockChain) *chainPruner {
+	depth := uint(minPruneDepth)
+	window := uint(chain.params.WorkDiffWindowSize * chain.params.WorkDiffWindows)
+	if window > depth {
+		depth = window
+	}
 	return &chainPruner{
 		chain:              chain,
 		lastNodeInsertTime: time.Now(),
+		depth:              depth,
 	}
 }
 
@@ -35,4 +61,217 @@ func (c *chainPruner) pruneChainIfNeeded() {
 		return
 	}
 	c.lastNodeInsertTime = now
+	c.prune()
+}
+
+// prune removes the block nodes and the DAG blocks more than the depth below
+// the main chain tip from memory.  They are loaded again from the database
+// when accessed.
+//
+// prune must be called with the chainLock held for writes.
+func (c *chainPruner) prune() {
+	start := time.Now()
+	mainTip := c.chain.bd.GetMainChainTip()
+	if mainTip == nil || mainTip.GetHeight() <= c.depth {
+		return
+	}
+	nodes, err := c.chain.index.prune(c.chain, mainTip.GetHeight()-c.depth)
+	if err != nil {
+		log.Error(fmt.Sprintf("Failed to prune the block index: %v", err))
+		return
+	}
+	blocks, err := c.chain.bd.Prune(c.depth)
+	if err != nil {
+		log.Error(fmt.Sprintf("Failed to prune the DAG blocks: %v", err))
+		return
+	}
+	c.lastPrune = start
+	c.lastPruneDuration = time.Since(start)
+	log.Debug(fmt.Sprintf("Pruned %d block nodes and %d DAG blocks in %v",
+		nodes, blocks, c.lastPruneDuration))
+}
+
+// MemoryStats describes the block nodes and the DAG blocks held in memory
+// and the ones pruned.
+type MemoryStats struct {
+	// The number of block nodes in memory
+	IndexNodes int
+
+	// The number of block nodes pruned so far and loaded again
+	PrunedNodes uint64
+	LoadedNodes uint64
+
+	// The statistics of the DAG blocks
+	DAG blockdag.PruneStats
+
+	// The main chain blocks below the main chain tip kept in memory
+	PruneDepth uint
+
+	// The time and the duration of the last pruning
+	LastPrune         time.Time
+	LastPruneDuration time.Duration
+
+	// The bytes of the allocated heap objects and the number of them
+	HeapAlloc   uint64
+	HeapObjects uint64
+}
+
+// MemoryStats returns the statistics of the memory used by the block nodes
+// and the DAG blocks.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) MemoryStats() *MemoryStats {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	b.chainLock.RLock()
+	lastPrune, lastPruneDuration := b.pruner.lastPrune, b.pruner.lastPruneDuration
+	b.chainLock.RUnlock()
+
+	b.index.RLock()
+	stats := &MemoryStats{
+		IndexNodes:        len(b.index.index),
+		PrunedNodes:       b.index.pruned,
+		LoadedNodes:       b.index.loaded,
+		PruneDepth:        b.pruner.depth,
+		LastPrune:         lastPrune,
+		LastPruneDuration: lastPruneDuration,
+		HeapAlloc:         ms.HeapAlloc,
+		HeapObjects:       ms.HeapObjects,
+	}
+	b.index.RUnlock()
+	stats.DAG = b.bd.GetPruneStats()
+	return stats
+}
+
+// prune removes the valid block nodes below the main height from the index.
+// The dirty nodes and the work sums of the nodes are written to the database
+// first.  It returns the number of pruned nodes.
+func (bi *blockIndex) prune(b *BlockChain, maxHeight uint) (int, error) {
+	bi.RLock()
+	pruned := []*blockNode{}
+	for _, node := range bi.index {
+		if node.dagID == 0 || node.height >= maxHeight || !node.IsOrdered() ||
+			!node.status.KnownValid() {
+			continue
+		}
+		pruned = append(pruned, node)
+	}
+	bi.RUnlock()
+
+	for _, node := range pruned {
+		err := node.FlushToDB(b)
+		if err != nil {
+			return 0, err
+		}
+	}
+	err := bi.db.Update(func(dbTx database.Tx) error {
+		for _, node := range pruned {
+			err := dbPutBlockWorkSum(dbTx, node)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	bi.Lock()
+	defer bi.Unlock()
+	for _, node := range pruned {
+		delete(bi.index, node.hash)
+		delete(bi.dirty, node)
+	}
+	// The nodes left in memory still reference their pruned parents, so
+	// the parents of the pruned nodes are replaced to free the older nodes
+	// to the garbage collector.
+	for _, node := range pruned {
+		parents := make([]*blockNode, len(node.parents))
+		for i, parent := range node.parents {
+			parents[i] = prunedParentNode(parent)
+		}
+		node.parents = parents
+	}
+	bi.pruned += uint64(len(pruned))
+	return len(pruned), nil
+}
+
+// prunedParentNode returns a node standing in for the pruned parent in the
+// parents of a node.  It only holds the fields read from the parents of a
+// node, the parent itself is looked up in the index.
+func prunedParentNode(parent *blockNode) *blockNode {
+	return &blockNode{
+		hash:   parent.hash,
+		status: parent.status,
+		order:  parent.order,
+		height: parent.height,
+		layer:  parent.layer,
+		dagID:  parent.dagID,
+	}
+}
+
+// loadNode loads the pruned node with the hash from the database and adds it
+// to the index until the next pruning.  The parents which are not in memory
+// are linked as pruned parents.  The work sum is the one stored when the node
+// was pruned.
+func (bi *blockIndex) loadNode(h *hash.Hash) *blockNode {
+	ib := bi.bd.GetBlock(h)
+	if ib == nil {
+		return nil
+	}
+	var node blockNode
+	err := bi.db.View(func(dbTx database.Tx) error {
+		block, err := dbFetchBlockByHash(dbTx, h)
+		if err != nil {
+			return err
+		}
+		parents := []*blockNode{}
+		for _, ph := range block.Block().Parents {
+			bi.RLock()
+			parent := bi.lookupNode(ph)
+			bi.RUnlock()
+			if parent == nil {
+				pib := bi.bd.GetBlock(ph)
+				if pib == nil {
+					return fmt.Errorf("Can't find parent %s", ph)
+				}
+				parent = &blockNode{
+					hash:   *ph,
+					status: BlockStatus(pib.GetStatus()),
+					order:  uint64(pib.GetOrder()),
+					height: pib.GetHeight(),
+					layer:  pib.GetLayer(),
+					dagID:  pib.GetID(),
+				}
+			}
+			parents = append(parents, parent)
+		}
+		initBlockNode(&node, &block.Block().Header, parents)
+		workSum := dbFetchBlockWorkSum(dbTx, h)
+		if workSum == nil {
+			return fmt.Errorf("No work sum of pruned block %s", h)
+		}
+		node.workSum = workSum
+		return nil
+	})
+	if err != nil {
+		log.Error(fmt.Sprintf("Failed to load pruned block node %s: %v", h, err))
+		return nil
+	}
+	node.status = BlockStatus(ib.GetStatus())
+	node.SetOrder(uint64(ib.GetOrder()))
+	node.SetHeight(ib.GetHeight())
+	node.SetLayer(ib.GetLayer())
+	node.dagID = ib.GetID()
+
+	bi.Lock()
+	defer bi.Unlock()
+	if existing := bi.lookupNode(h); existing != nil {
+		return existing
+	}
+	bi.addNode(&node)
+	bi.loaded++
+	return &node
 }
@@ -0,0 +1,63 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/database"
+	_ "github.com/btceasypay/bitcoinpay/database/ffldb"
+	"github.com/btceasypay/bitcoinpay/params"
+)
+
+// TestBlockWorkSum ensures the work sum of a pruned node is stored, so the
+// node loaded again keeps the work of its past.
+func TestBlockWorkSum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "worksum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := database.Create("ffldb", filepath.Join(dir, "db"), params.PrivNetParams.Net)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	node := &blockNode{hash: hash.Hash{1}, workSum: new(big.Int).Lsh(big.NewInt(3), 100)}
+	var stored, missing *big.Int
+	err = db.View(func(dbTx database.Tx) error {
+		missing = dbFetchBlockWorkSum(dbTx, &node.hash)
+		return nil
+	})
+	if err != nil || missing != nil {
+		t.Fatalf("work sum before the bucket exists: got %v, %v", missing, err)
+	}
+	err = db.Update(func(dbTx database.Tx) error {
+		return dbPutBlockWorkSum(dbTx, node)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.View(func(dbTx database.Tx) error {
+		stored = dbFetchBlockWorkSum(dbTx, &node.hash)
+		missing = dbFetchBlockWorkSum(dbTx, &hash.Hash{2})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored == nil || stored.Cmp(node.workSum) != 0 {
+		t.Fatalf("stored work sum %v, want %v", stored, node.workSum)
+	}
+	if missing != nil {
+		t.Fatalf("work sum of an unknown block: got %v", missing)
+	}
+}
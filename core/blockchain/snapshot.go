@@ -0,0 +1,784 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/common/util"
+	"github.com/btceasypay/bitcoinpay/core/dbnamespace"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/database"
+	"github.com/btceasypay/bitcoinpay/database/statedb"
+	"github.com/btceasypay/bitcoinpay/trie"
+)
+
+// utxoSnapshotMaxChunkSize is the maximum byte size of the utxo entries served
+// in a chunk of a utxo snapshot.
+const utxoSnapshotMaxChunkSize = 4 * 1024 * 1024
+
+// serializedUtxoSnapshotSize is the size of the serialized progress of a utxo
+// snapshot download.
+const serializedUtxoSnapshotSize = hash.HashSize*3 + 8 + 4 + 1
+
+// The flags of the serialized progress of a utxo snapshot download.
+const (
+	utxoSnapshotLoaded  = 1 << 0
+	utxoSnapshotInvalid = 1 << 1
+)
+
+// errInvalidUtxoSnapshot is returned once the blocks up to the utxo snapshot
+// the chain was synced from don't match its utxo set.
+var errInvalidUtxoSnapshot = errors.New("the utxo snapshot is invalid, " +
+	"the chain must be synced again from the blocks")
+
+// UtxoSnapshotEntry is an entry of the utxo set in a utxo snapshot.  Key is the
+// serialized outpoint and Entry the serialized utxo entry.  The first output of
+// a coinbase also carries the fees of its block, which are paid out with it
+// and can't be calculated without the spent outputs of the block.  The fees
+// are committed with the entry, so they are covered by the root.
+type UtxoSnapshotEntry struct {
+	Key   []byte
+	Entry []byte
+	Fees  uint64
+}
+
+// UtxoSnapshotChunk is a part of the utxo set at the order of a block.  The
+// entries are sorted by the hash of their keys, which is the order of the utxo
+// commitment trie, and Done is set on the last chunk.
+type UtxoSnapshotChunk struct {
+	Root    hash.Hash
+	Entries []UtxoSnapshotEntry
+	Done    bool
+}
+
+// utxoSnapshot is the progress of syncing from a utxo snapshot.  While the utxo
+// set is downloaded the blocks are only ordered, afterwards the blocks up to
+// the snapshot are validated in the background.  There is no headers first
+// phase, so the blocks before the snapshot are still downloaded in full before
+// the utxo set is asked for.
+type utxoSnapshot struct {
+	// block is the block the utxo set is taken at and root the trusted
+	// utxo commitment root at its order.
+	block hash.Hash
+	root  hash.Hash
+
+	// next is the key hash the next chunk starts at and count the number
+	// of entries received so far.
+	next  hash.Hash
+	count uint64
+
+	// loaded is set once the utxo set matched the root, order is the
+	// order of the block at that time.
+	loaded bool
+	order  uint64
+
+	// invalid is set once the blocks up to the snapshot don't match its
+	// utxo set.
+	invalid bool
+}
+
+// serializeUtxoSnapshot returns the serialization of the utxo snapshot
+// progress.
+func serializeUtxoSnapshot(s *utxoSnapshot) []byte {
+	serialized := make([]byte, serializedUtxoSnapshotSize)
+	offset := copy(serialized, s.block[:])
+	offset += copy(serialized[offset:], s.root[:])
+	offset += copy(serialized[offset:], s.next[:])
+	dbnamespace.ByteOrder.PutUint64(serialized[offset:], s.count)
+	offset += 8
+	dbnamespace.ByteOrder.PutUint32(serialized[offset:], uint32(s.order))
+	offset += 4
+	if s.loaded {
+		serialized[offset] |= utxoSnapshotLoaded
+	}
+	if s.invalid {
+		serialized[offset] |= utxoSnapshotInvalid
+	}
+	return serialized
+}
+
+// deserializeUtxoSnapshot decodes the utxo snapshot progress.
+func deserializeUtxoSnapshot(serialized []byte) (*utxoSnapshot, error) {
+	if len(serialized) != serializedUtxoSnapshotSize {
+		return nil, errDeserialize("malformed utxo snapshot")
+	}
+	s := &utxoSnapshot{}
+	offset := copy(s.block[:], serialized)
+	offset += copy(s.root[:], serialized[offset:])
+	offset += copy(s.next[:], serialized[offset:])
+	s.count = dbnamespace.ByteOrder.Uint64(serialized[offset:])
+	offset += 8
+	s.order = uint64(dbnamespace.ByteOrder.Uint32(serialized[offset:]))
+	offset += 4
+	s.loaded = serialized[offset]&utxoSnapshotLoaded != 0
+	s.invalid = serialized[offset]&utxoSnapshotInvalid != 0
+	return s, nil
+}
+
+// dbPutUtxoSnapshot uses an existing database transaction to store the
+// progress of the utxo snapshot.
+func dbPutUtxoSnapshot(dbTx database.Tx, s *utxoSnapshot) error {
+	return dbTx.Metadata().Put(dbnamespace.UtxoSnapshotKeyName, serializeUtxoSnapshot(s))
+}
+
+// dbFetchUtxoSnapshot uses an existing database transaction to fetch the
+// progress of the utxo snapshot.  Nil is returned when the chain isn't synced
+// from a utxo snapshot or its blocks were all validated.
+func dbFetchUtxoSnapshot(dbTx database.Tx) (*utxoSnapshot, error) {
+	serialized := dbTx.Metadata().Get(dbnamespace.UtxoSnapshotKeyName)
+	if serialized == nil {
+		return nil, nil
+	}
+	return deserializeUtxoSnapshot(serialized)
+}
+
+// dbPutUtxoSnapshotFees uses an existing database transaction to store the
+// fees of a block that came with the utxo snapshot.
+func dbPutUtxoSnapshotFees(dbTx database.Tx, blockHash *hash.Hash, fees uint64) error {
+	var serialized [8]byte
+	dbnamespace.ByteOrder.PutUint64(serialized[:], fees)
+	bucket := dbTx.Metadata().Bucket(dbnamespace.UtxoSnapshotFeesBucketName)
+	return bucket.Put(blockHash[:], serialized[:])
+}
+
+// dbFetchUtxoSnapshotFees uses an existing database transaction to fetch the
+// fees of a block that came with the utxo snapshot.
+func dbFetchUtxoSnapshotFees(dbTx database.Tx, blockHash *hash.Hash) (uint64, bool) {
+	bucket := dbTx.Metadata().Bucket(dbnamespace.UtxoSnapshotFeesBucketName)
+	if bucket == nil {
+		return 0, false
+	}
+	serialized := bucket.Get(blockHash[:])
+	if len(serialized) != 8 {
+		return 0, false
+	}
+	return dbnamespace.ByteOrder.Uint64(serialized), true
+}
+
+// dbResetUtxoSet uses an existing database transaction to remove the utxo
+// set, its commitment and the fees of a utxo snapshot.
+func dbResetUtxoSet(dbTx database.Tx) error {
+	meta := dbTx.Metadata()
+	for _, name := range [][]byte{dbnamespace.UtxoSetBucketName,
+		dbnamespace.UtxoTrieBucketName, dbnamespace.UtxoTrieRefBucketName,
+		dbnamespace.UtxoRootBucketName, dbnamespace.UtxoSnapshotFeesBucketName} {
+
+		if meta.Bucket(name) == nil {
+			continue
+		}
+		if err := meta.DeleteBucket(name); err != nil {
+			return err
+		}
+	}
+	if _, err := meta.CreateBucket(dbnamespace.UtxoSetBucketName); err != nil {
+		return err
+	}
+	if _, err := meta.CreateBucket(dbnamespace.UtxoSnapshotFeesBucketName); err != nil {
+		return err
+	}
+	return meta.Delete(dbnamespace.UtxoCommitmentKeyName)
+}
+
+// utxoSnapshotFees returns the fees of the block that came with the utxo
+// snapshot, or zero when there are none.
+func (b *BlockChain) utxoSnapshotFees(blockHash *hash.Hash) int64 {
+	var fees uint64
+	b.db.View(func(dbTx database.Tx) error {
+		fees, _ = dbFetchUtxoSnapshotFees(dbTx, blockHash)
+		return nil
+	})
+	return int64(fees)
+}
+
+// utxoSnapshotPending returns whether the utxo set is still downloaded.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) utxoSnapshotPending() bool {
+	return b.snapshot != nil && !b.snapshot.loaded
+}
+
+// orderedAfterUtxoSnapshot returns whether the block is ordered after the block
+// of the utxo snapshot that is downloaded.  The transactions of those blocks
+// are connected once the utxo set is loaded.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) orderedAfterUtxoSnapshot(node *blockNode) bool {
+	snapNode := b.index.LookupNode(&b.snapshot.block)
+	return snapNode != nil && snapNode.IsOrdered() && node.order > snapNode.order
+}
+
+// connectBlockOrder records the order of a block while the utxo set is
+// downloaded.  The blocks up to the utxo snapshot are indexed without their
+// spent outputs and validated in the background once the utxo set is loaded.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) connectBlockOrder(node *blockNode, block *types.SerializedBlock) error {
+	connect := !b.orderedAfterUtxoSnapshot(node)
+	if connect {
+		b.CalculateDAGDuplicateTxs(block)
+	}
+	err := b.db.Update(func(dbTx database.Tx) error {
+		err := dbPutBlockIndex(dbTx, block.Hash(), node.order)
+		if err != nil {
+			return err
+		}
+		if connect && b.indexManager != nil {
+			return b.indexManager.ConnectBlock(dbTx, block, nil)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if connect {
+		b.sendNotification(BlockConnected, []*types.SerializedBlock{block})
+	}
+	return nil
+}
+
+// disconnectBlockOrder removes the order of a block while the utxo set is
+// downloaded.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) disconnectBlockOrder(node *blockNode, block *types.SerializedBlock) error {
+	disconnect := !b.orderedAfterUtxoSnapshot(node)
+	err := b.db.Update(func(dbTx database.Tx) error {
+		err := dbRemoveBlockIndex(dbTx, block.Hash(), int64(node.order))
+		if err != nil {
+			return err
+		}
+		if disconnect && b.indexManager != nil {
+			return b.indexManager.DisconnectBlock(dbTx, block, nil)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if disconnect {
+		b.sendNotification(BlockDisconnected, block)
+	}
+	return nil
+}
+
+// StartUtxoSnapshot makes the chain sync from the utxo set at the order of the
+// block instead of connecting the blocks before it.  The utxo set is trusted
+// once its commitment root matches the root.  It can only be started before
+// any block is connected after the genesis block.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) StartUtxoSnapshot(block *hash.Hash, root *hash.Hash) error {
+	b.ChainLock()
+	defer b.ChainUnlock()
+
+	if b.snapshot != nil {
+		if b.snapshot.block == *block && b.snapshot.root == *root {
+			return nil
+		}
+		return fmt.Errorf("the chain is synced from the utxo snapshot of "+
+			"block %v with root %v", b.snapshot.block, b.snapshot.root)
+	}
+	if b.bd.GetBlockTotal() > 1 {
+		return fmt.Errorf("a utxo snapshot can't be used once blocks " +
+			"are connected")
+	}
+
+	s := &utxoSnapshot{block: *block, root: *root}
+	err := b.db.Update(func(dbTx database.Tx) error {
+		if err := dbResetUtxoSet(dbTx); err != nil {
+			return err
+		}
+		return dbPutUtxoSnapshot(dbTx, s)
+	})
+	if err != nil {
+		return err
+	}
+	b.snapshot = s
+	b.utxoCommit = nil
+	log.Info(fmt.Sprintf("Syncing from the utxo snapshot of block %v with root %v", block, root))
+	return nil
+}
+
+// UtxoSnapshotPending returns whether the utxo set of a utxo snapshot is still
+// downloaded.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) UtxoSnapshotPending() bool {
+	b.ChainRLock()
+	defer b.ChainRUnlock()
+
+	return b.utxoSnapshotPending()
+}
+
+// UtxoSnapshotRequest returns the block of the utxo snapshot and the key hash
+// the next chunk of its utxo set starts at.  False is returned when no utxo set
+// is downloaded or the block is not ordered yet.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) UtxoSnapshotRequest() (hash.Hash, hash.Hash, bool) {
+	b.ChainRLock()
+	defer b.ChainRUnlock()
+
+	if !b.utxoSnapshotPending() {
+		return hash.Hash{}, hash.Hash{}, false
+	}
+	node := b.index.LookupNode(&b.snapshot.block)
+	if node == nil || !node.IsOrdered() {
+		return hash.Hash{}, hash.Hash{}, false
+	}
+	return b.snapshot.block, b.snapshot.next, true
+}
+
+// FetchUtxoSnapshot returns the chunk of the utxo set at the order of the block
+// which starts at the key hash, with up to maxEntries entries.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) FetchUtxoSnapshot(block *hash.Hash, start *hash.Hash, maxEntries int) (*UtxoSnapshotChunk, error) {
+	b.ChainRLock()
+	defer b.ChainRUnlock()
+
+	if b.utxoCommit == nil {
+		return nil, fmt.Errorf("the utxo set is not loaded")
+	}
+	node := b.index.LookupNode(block)
+	if node == nil || !node.IsOrdered() {
+		return nil, fmt.Errorf("block %v is not ordered", block)
+	}
+	var root *hash.Hash
+	err := b.db.View(func(dbTx database.Tx) error {
+		root = dbFetchUtxoRoot(dbTx, node.order)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if root == nil {
+		return nil, fmt.Errorf("no utxo commitment root for order %d", node.order)
+	}
+	t, err := trie.NewSecure(*root, b.utxoCommit.trieDB, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	chunk := &UtxoSnapshotChunk{Root: *root}
+	size := 0
+	it := trie.NewIterator(t.NodeIterator(start[:]))
+	for len(chunk.Entries) < maxEntries && size < utxoSnapshotMaxChunkSize {
+		if !it.Next() {
+			if it.Err != nil {
+				return nil, it.Err
+			}
+			chunk.Done = true
+			break
+		}
+		if bytes.Compare(it.Key, start[:]) < 0 {
+			continue
+		}
+		key := t.GetKey(it.Key)
+		if key == nil {
+			return nil, fmt.Errorf("utxo key of %x not found", it.Key)
+		}
+		// The first output of a coinbase is committed with the fees
+		// of its block.
+		serialized, fees, err := splitUtxoFees(key, it.Value)
+		if err != nil {
+			return nil, err
+		}
+		entry := UtxoSnapshotEntry{
+			Key:   util.CopyBytes(key),
+			Entry: util.CopyBytes(serialized),
+			Fees:  fees,
+		}
+		chunk.Entries = append(chunk.Entries, entry)
+		size += len(entry.Key) + len(entry.Entry)
+	}
+	return chunk, nil
+}
+
+// checkUtxoSnapshotKey checks the key of a utxo snapshot entry is a serialized
+// outpoint.
+func checkUtxoSnapshotKey(key []byte) error {
+	if len(key) <= hash.HashSize || len(key) > hash.HashSize+maxUint32VLQSerializeSize {
+		return fmt.Errorf("utxo key %x has a bad size", key)
+	}
+	index, _ := deserializeVLQ(key[hash.HashSize:])
+	outpoint := types.TxOutPoint{OutIndex: uint32(index)}
+	copy(outpoint.Hash[:], key)
+	canonical := outpointKey(outpoint)
+	defer recycleOutpointKey(canonical)
+	if !bytes.Equal(*canonical, key) {
+		return fmt.Errorf("utxo key %x is not a serialized outpoint", key)
+	}
+	return nil
+}
+
+// ProcessUtxoSnapshot stores the chunk of the utxo set of the utxo snapshot
+// which starts at the key hash.  Once the last chunk is received, the utxo set
+// is loaded if its commitment matches the trusted root, and true is returned.
+// A rule error is returned when the chunk or the utxo set is bad, in which case
+// a bad utxo set is removed so it can be downloaded again.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ProcessUtxoSnapshot(block *hash.Hash, start *hash.Hash, chunk *UtxoSnapshotChunk) (bool, error) {
+	b.ChainLock()
+	defer b.ChainUnlock()
+
+	s := b.snapshot
+	if !b.utxoSnapshotPending() {
+		return false, AssertError("no utxo snapshot is downloaded")
+	}
+	if *block != s.block || *start != s.next {
+		str := fmt.Sprintf("utxo snapshot chunk of block %v starts at %v, "+
+			"want block %v at %v", block, start, s.block, s.next)
+		return false, ruleError(ErrBadUtxoSnapshot, str)
+	}
+	if chunk.Root != s.root {
+		str := fmt.Sprintf("utxo snapshot of block %v has root %v, want %v",
+			block, chunk.Root, s.root)
+		return false, ruleError(ErrBadUtxoSnapshot, str)
+	}
+
+	// The entries must be sorted by their key hashes, so the next chunk
+	// can start after the last one.
+	next := *start
+	last := []byte(nil)
+	err := b.db.Update(func(dbTx database.Tx) error {
+		utxoBucket := dbTx.Metadata().Bucket(dbnamespace.UtxoSetBucketName)
+		for _, e := range chunk.Entries {
+			if err := checkUtxoSnapshotKey(e.Key); err != nil {
+				return ruleError(ErrBadUtxoSnapshot, err.Error())
+			}
+			utxo, err := DeserializeUtxoEntry(e.Entry)
+			if err != nil {
+				str := fmt.Sprintf("bad utxo entry of key %x: %v", e.Key, err)
+				return ruleError(ErrBadUtxoSnapshot, str)
+			}
+			keyHash := hash.CalcHash(e.Key, hash.GetHasher(hash.Keccak_256))
+			if bytes.Compare(keyHash, next[:]) < 0 ||
+				last != nil && bytes.Compare(keyHash, last) <= 0 {
+				str := fmt.Sprintf("utxo key %x is out of order", e.Key)
+				return ruleError(ErrBadUtxoSnapshot, str)
+			}
+			last = keyHash
+
+			if err := utxoBucket.Put(util.CopyBytes(e.Key), util.CopyBytes(e.Entry)); err != nil {
+				return err
+			}
+			if e.Fees == 0 {
+				continue
+			}
+			if !utxo.IsCoinBase() || e.Key[hash.HashSize] != 0 {
+				str := fmt.Sprintf("utxo key %x has fees but is not "+
+					"the first output of a coinbase", e.Key)
+				return ruleError(ErrBadUtxoSnapshot, str)
+			}
+			err = dbPutUtxoSnapshotFees(dbTx, utxo.BlockHash(), e.Fees)
+			if err != nil {
+				return err
+			}
+		}
+
+		updated := *s
+		updated.count += uint64(len(chunk.Entries))
+		if last != nil {
+			// The next chunk starts after the last key hash.
+			copy(updated.next[:], last)
+			carry := true
+			for i := len(updated.next) - 1; i >= 0 && carry; i-- {
+				updated.next[i]++
+				carry = updated.next[i] == 0
+			}
+			if carry && !chunk.Done {
+				return ruleError(ErrBadUtxoSnapshot, "utxo snapshot "+
+					"continues after the last key")
+			}
+		}
+		if err := dbPutUtxoSnapshot(dbTx, &updated); err != nil {
+			return err
+		}
+		*s = updated
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	log.Debug(fmt.Sprintf("Received utxo snapshot chunk:entries=%d total=%d", len(chunk.Entries), s.count))
+	if !chunk.Done {
+		return false, nil
+	}
+	if err := b.loadUtxoSnapshot(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// loadUtxoSnapshot builds the utxo commitment of the downloaded utxo set and
+// checks it against the trusted root, which also covers the fees that came
+// with the coinbase outputs.  The blocks ordered after the snapshot are
+// connected then, and the ones before it are validated in the background.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) loadUtxoSnapshot() error {
+	s := b.snapshot
+	node := b.index.LookupNode(&s.block)
+	if node == nil || !node.IsOrdered() {
+		return AssertError(fmt.Sprintf("utxo snapshot block %v is not ordered", s.block))
+	}
+	c, err := newUtxoCommitment(b.db, node.order, b.params.Checkpoints, func(dbTx database.Tx, h *hash.Hash) int64 {
+		fees, _ := dbFetchUtxoSnapshotFees(dbTx, h)
+		return int64(fees)
+	})
+	if err != nil {
+		return err
+	}
+	if c.root != s.root {
+		// Start over since it is unknown which chunks were bad.
+		reset := &utxoSnapshot{block: s.block, root: s.root}
+		err := b.db.Update(func(dbTx database.Tx) error {
+			if err := dbResetUtxoSet(dbTx); err != nil {
+				return err
+			}
+			return dbPutUtxoSnapshot(dbTx, reset)
+		})
+		if err != nil {
+			return err
+		}
+		b.snapshot = reset
+		str := fmt.Sprintf("utxo set of block %v has root %v, want %v",
+			s.block, c.root, s.root)
+		return ruleError(ErrBadUtxoSnapshot, str)
+	}
+
+	loaded := *s
+	loaded.loaded = true
+	loaded.order = node.order
+	err = b.db.Update(func(dbTx database.Tx) error {
+		return dbPutUtxoSnapshot(dbTx, &loaded)
+	})
+	if err != nil {
+		return err
+	}
+	b.snapshot = &loaded
+	b.utxoCommit = c
+	log.Info(fmt.Sprintf("Loaded the utxo snapshot of block %v:outputs=%d order=%d",
+		s.block, s.count, node.order))
+
+	// Connect the blocks that were ordered while the utxo set was
+	// downloaded.
+	mainOrder := uint64(b.bd.GetMainChainTip().GetOrder())
+	for order := node.order + 1; order <= mainOrder; order++ {
+		h := b.bd.GetBlockByOrder(uint(order))
+		if h == nil {
+			continue
+		}
+		n := b.index.LookupNode(h)
+		block, err := b.fetchBlockByHash(h)
+		if n == nil || err != nil {
+			return AssertError(fmt.Sprintf("block of order %d not found", order))
+		}
+		block.SetOrder(order)
+		view := NewUtxoViewpoint()
+		view.SetViewpoints([]*hash.Hash{h})
+		stxos := []SpentTxOut{}
+		err = b.checkConnectBlock(n, block, view, &stxos)
+		if err != nil {
+			n.Invalid(b)
+			stxos = []SpentTxOut{}
+			view.Clean()
+			log.Info(fmt.Sprintf("%s", err))
+		}
+		err = b.connectBlock(n, block, view, stxos)
+		if err != nil {
+			n.Invalid(b)
+			return err
+		}
+		if !n.GetStatus().KnownInvalid() {
+			n.Valid(b)
+		}
+	}
+
+	go b.validateUtxoSnapshot()
+	return nil
+}
+
+// validateUtxoSnapshot replays the blocks up to the utxo snapshot on a utxo set
+// kept in memory.  It marks the blocks valid or invalid and stores their spend
+// journal.  Once the replayed utxo set matches the root of the snapshot, the
+// chain is the same as if it was synced from the genesis block.  Otherwise the
+// utxo snapshot is marked invalid, which stops the chain until it is synced
+// again from the blocks.
+func (b *BlockChain) validateUtxoSnapshot() {
+	b.ChainRLock()
+	s := *b.snapshot
+	b.ChainRUnlock()
+
+	log.Info(fmt.Sprintf("Validating the blocks of the utxo snapshot up to order %d", s.order))
+	start := time.Now()
+	view := NewUtxoViewpoint()
+	fees := make(map[hash.Hash]int64)
+	for order := uint64(1); order <= s.order; order++ {
+		select {
+		case <-b.interrupt:
+			return
+		default:
+		}
+
+		b.ChainLock()
+		err := b.validateUtxoSnapshotBlock(view, fees, order)
+		b.ChainUnlock()
+		if err != nil {
+			log.Error("Failed to validate the utxo snapshot", "order", order, "error", err)
+			return
+		}
+	}
+
+	t, err := trie.NewSecure(hash.Hash{}, trie.NewDatabase(statedb.NewMemDatabase()), 0)
+	if err != nil {
+		log.Error("Failed to validate the utxo snapshot", "error", err)
+		return
+	}
+	for outpoint, entry := range view.entries {
+		serialized, err := serializeUtxoEntry(entry)
+		if err != nil {
+			log.Error("Failed to validate the utxo snapshot", "error", err)
+			return
+		}
+		if isCoinbaseReward(outpoint, entry) {
+			serialized = appendUtxoFees(serialized, fees[*entry.BlockHash()])
+		}
+		key := outpointKey(outpoint)
+		err = t.TryUpdate(util.CopyBytes(*key), serialized)
+		recycleOutpointKey(key)
+		if err != nil {
+			log.Error("Failed to validate the utxo snapshot", "error", err)
+			return
+		}
+	}
+	b.ChainLock()
+	defer b.ChainUnlock()
+	if root := t.Hash(); root != s.root {
+		log.Error(fmt.Sprintf("The blocks up to order %d have the utxo root %v, "+
+			"but the utxo snapshot has %v.  The chain is stopped, restart with "+
+			"--dropsnapshot to sync it again from the blocks", s.order, root, s.root))
+		if err := b.invalidateUtxoSnapshot(); err != nil {
+			log.Error("Failed to invalidate the utxo snapshot", "error", err)
+		}
+		return
+	}
+	err = b.db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		if err := meta.DeleteBucket(dbnamespace.UtxoSnapshotFeesBucketName); err != nil {
+			return err
+		}
+		return meta.Delete(dbnamespace.UtxoSnapshotKeyName)
+	})
+	if err != nil {
+		log.Error("Failed to validate the utxo snapshot", "error", err)
+		return
+	}
+	b.snapshot = nil
+	log.Info(fmt.Sprintf("Validated the blocks of the utxo snapshot:outputs=%d time=%v",
+		len(view.entries), time.Since(start)))
+}
+
+// validateUtxoSnapshotBlock connects the block of the order to the replayed utxo
+// set in the view, and records the fees of the block which are committed with
+// the first output of its coinbase.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) validateUtxoSnapshotBlock(view *UtxoViewpoint, fees map[hash.Hash]int64, order uint64) error {
+	h := b.bd.GetBlockByOrder(uint(order))
+	if h == nil {
+		return AssertError(fmt.Sprintf("block of order %d not found", order))
+	}
+	node := b.index.LookupNode(h)
+	block, err := b.fetchBlockByHash(h)
+	if node == nil || err != nil {
+		return AssertError(fmt.Sprintf("block of order %d not found", order))
+	}
+	block.SetOrder(order)
+
+	// The inputs are taken from the replayed utxo set only, the ones it
+	// doesn't have are added as nil entries so they are not loaded from
+	// the utxo set of the database.
+	blockView := NewUtxoViewpoint()
+	blockView.SetViewpoints([]*hash.Hash{h})
+	for _, tx := range block.Transactions()[1:] {
+		for _, txIn := range tx.Transaction().TxIn {
+			blockView.entries[txIn.PreviousOut] = view.entries[txIn.PreviousOut].Clone()
+		}
+	}
+	stxos := []SpentTxOut{}
+	err = b.checkConnectBlock(node, block, blockView, &stxos)
+	if err != nil {
+		node.Invalid(b)
+		log.Info(fmt.Sprintf("%s", err))
+		return nil
+	}
+	if !node.GetStatus().KnownInvalid() {
+		node.Valid(b)
+	}
+
+	fees[*h] = calcBlockFees(block, stxos)
+	err = b.db.Update(func(dbTx database.Tx) error {
+		return dbPutSpendJournalEntry(dbTx, h, stxos)
+	})
+	if err != nil {
+		return err
+	}
+
+	for outpoint, entry := range blockView.entries {
+		if entry == nil || !entry.isModified() {
+			continue
+		}
+		if entry.IsSpent() {
+			delete(view.entries, outpoint)
+			continue
+		}
+		entry.packedFlags &^= tfModified
+		view.entries[outpoint] = entry
+	}
+	return nil
+}
+
+// invalidateUtxoSnapshot marks the utxo snapshot invalid once the blocks up to
+// it don't match its utxo set.  The chain doesn't process blocks anymore, and
+// the node only starts again once the block database is removed with
+// --dropsnapshot so the chain is synced again from the blocks.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) invalidateUtxoSnapshot() error {
+	invalid := *b.snapshot
+	invalid.invalid = true
+	err := b.db.Update(func(dbTx database.Tx) error {
+		return dbPutUtxoSnapshot(dbTx, &invalid)
+	})
+	if err != nil {
+		return err
+	}
+	b.snapshot = &invalid
+	return nil
+}
+
+// UtxoSnapshotInvalid returns whether the chain in the database was synced from
+// a utxo snapshot which turned out invalid, in which case the database must be
+// removed to sync the chain again from the blocks.
+func UtxoSnapshotInvalid(db database.DB) (bool, error) {
+	var s *utxoSnapshot
+	err := db.View(func(dbTx database.Tx) error {
+		var err error
+		s, err = dbFetchUtxoSnapshot(dbTx)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return s != nil && s.invalid, nil
+}
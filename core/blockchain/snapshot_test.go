@@ -0,0 +1,173 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"math"
+	"testing"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/dbnamespace"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/database"
+	"github.com/btceasypay/bitcoinpay/params"
+)
+
+func TestUtxoSnapshot(t *testing.T) {
+	par := params.PrivNetParams
+
+	// The serving chain has the outputs of a coinbase and a transaction
+	// in its utxo set at the order of the block.
+	src, teardown := newVersionBitsChain(t, &par)
+	defer teardown()
+	node := addVersionBitsNode(t, src, 1)
+	node.SetOrder(0)
+	view := NewUtxoViewpoint()
+	for i := byte(0); i < 2; i++ {
+		tx := types.NewTransaction()
+		prevOut := &types.TxOutPoint{Hash: hash.Hash{i}}
+		if i == 0 {
+			prevOut.OutIndex = math.MaxUint32
+		}
+		tx.AddTxIn(types.NewTxInput(prevOut, nil))
+		for j := 0; j < 3; j++ {
+			tx.AddTxOut(types.NewTxOutput(uint64(1000*(j+1)), []byte{0x51}))
+		}
+		view.AddTxOuts(types.NewTx(tx), &node.hash)
+	}
+	const fees = 500
+	err := src.db.Update(func(dbTx database.Tx) error {
+		if _, err := dbTx.Metadata().CreateBucket(dbnamespace.UtxoSetBucketName); err != nil {
+			return err
+		}
+		return dbPutUtxoView(dbTx, view)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.utxoCommit, err = newUtxoCommitment(src.db, 0, nil, func(database.Tx, *hash.Hash) int64 {
+		return fees
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := src.utxoCommit.root
+
+	// The syncing chain only has the block.
+	dst, teardown := newVersionBitsChain(t, &par)
+	defer teardown()
+	addVersionBitsNode(t, dst, 1).SetOrder(0)
+	if err := dst.StartUtxoSnapshot(&node.hash, &root); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.StartUtxoSnapshot(&node.hash, &hash.Hash{1}); err == nil {
+		t.Fatal("started another utxo snapshot")
+	}
+
+	checkRuleError := func(err error) {
+		t.Helper()
+		if rerr, ok := err.(RuleError); !ok || rerr.ErrorCode != ErrBadUtxoSnapshot {
+			t.Fatalf("got error %v, want %v", err, ErrBadUtxoSnapshot)
+		}
+	}
+	block, start, ok := dst.UtxoSnapshotRequest()
+	if !ok || block != node.hash || start != (hash.Hash{}) {
+		t.Fatalf("got request of %v at %v", block, start)
+	}
+	chunk, err := src.FetchUtxoSnapshot(&block, &start, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunk.Entries) != 4 || chunk.Done || chunk.Root != root {
+		t.Fatalf("got chunk of %d entries, done %v", len(chunk.Entries), chunk.Done)
+	}
+
+	// A chunk of another root or with unsorted entries is refused.
+	bad := *chunk
+	bad.Root = hash.Hash{1}
+	_, err = dst.ProcessUtxoSnapshot(&block, &start, &bad)
+	checkRuleError(err)
+	bad = *chunk
+	bad.Entries = []UtxoSnapshotEntry{chunk.Entries[1], chunk.Entries[0]}
+	_, err = dst.ProcessUtxoSnapshot(&block, &start, &bad)
+	checkRuleError(err)
+
+	// A tampered utxo set is removed once the last chunk doesn't match
+	// the root.
+	tamperAmount := func(chunk *UtxoSnapshotChunk) bool {
+		entry, err := DeserializeUtxoEntry(chunk.Entries[0].Entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry.amount++
+		chunk.Entries[0].Entry, err = serializeUtxoEntry(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return true
+	}
+	tamperFees := func(chunk *UtxoSnapshotChunk) bool {
+		for i := range chunk.Entries {
+			if chunk.Entries[i].Fees != 0 {
+				chunk.Entries[i].Fees++
+				return true
+			}
+		}
+		return false
+	}
+	ingest := func(tamper func(*UtxoSnapshotChunk) bool) bool {
+		t.Helper()
+		for {
+			block, start, ok := dst.UtxoSnapshotRequest()
+			if !ok {
+				t.Fatal("no utxo snapshot request")
+			}
+			chunk, err := src.FetchUtxoSnapshot(&block, &start, 4)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tamper != nil && tamper(chunk) {
+				tamper = nil
+			}
+			loaded, err := dst.ProcessUtxoSnapshot(&block, &start, chunk)
+			if chunk.Done {
+				return err == nil && loaded
+			}
+			if err != nil || loaded {
+				t.Fatalf("chunk not processed: %v", err)
+			}
+		}
+	}
+	for _, tamper := range []func(*UtxoSnapshotChunk) bool{tamperAmount, tamperFees} {
+		if ingest(tamper) {
+			t.Fatal("tampered utxo set loaded")
+		}
+		if _, start, _ := dst.UtxoSnapshotRequest(); start != (hash.Hash{}) {
+			t.Fatalf("utxo snapshot not restarted, next chunk starts at %v", start)
+		}
+	}
+	if !ingest(nil) {
+		t.Fatal("utxo set not loaded")
+	}
+	if dst.UtxoSnapshotPending() || dst.utxoCommit.root != root || dst.snapshot.count != 6 {
+		t.Fatalf("loaded root %v with %d outputs, want %v with 6", dst.utxoCommit.root,
+			dst.snapshot.count, root)
+	}
+	if got := dst.utxoSnapshotFees(&node.hash); got != fees {
+		t.Fatalf("loaded fees %d, want %d", got, fees)
+	}
+
+	// An invalid utxo snapshot is kept in the database, so the chain is
+	// synced again from the blocks.
+	dst.ChainLock()
+	err = dst.invalidateUtxoSnapshot()
+	dst.ChainUnlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if invalid, err := UtxoSnapshotInvalid(dst.db); err != nil || !invalid {
+		t.Fatalf("utxo snapshot not marked invalid: %v", err)
+	}
+}
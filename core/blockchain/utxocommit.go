@@ -0,0 +1,756 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/common/util"
+	"github.com/btceasypay/bitcoinpay/core/dbnamespace"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/database"
+	"github.com/btceasypay/bitcoinpay/database/statedb"
+	"github.com/btceasypay/bitcoinpay/params"
+	"github.com/btceasypay/bitcoinpay/trie"
+)
+
+const (
+	// utxoTrieCacheLimit is the number of commit generations the nodes of
+	// the utxo commitment trie are kept in memory after they were last
+	// used.
+	utxoTrieCacheLimit = 16
+
+	// utxoCommitBuildBatch is the number of outputs of the utxo set added
+	// to the trie in each database transaction while the utxo commitment
+	// is built.
+	utxoCommitBuildBatch = 20000
+)
+
+// utxoTrieDB adapts the utxo trie bucket of the block database to the state
+// database the trie is persisted to.  While a block is connected the trie nodes
+// are written with the database transaction of the block, so the commitment
+// can never get out of sync with the utxo set.
+type utxoTrieDB struct {
+	db database.DB
+	tx database.Tx
+}
+
+// Put stores the trie node under the key.
+func (tdb *utxoTrieDB) Put(key []byte, value []byte) error {
+	if tdb.tx != nil {
+		return dbPutUtxoTrieNode(tdb.tx, key, value)
+	}
+	return tdb.db.Update(func(dbTx database.Tx) error {
+		return dbPutUtxoTrieNode(dbTx, key, value)
+	})
+}
+
+// Get returns the trie node stored under the key.
+func (tdb *utxoTrieDB) Get(key []byte) ([]byte, error) {
+	var value []byte
+	get := func(dbTx database.Tx) error {
+		value = util.CopyBytes(dbTx.Metadata().Bucket(dbnamespace.UtxoTrieBucketName).Get(key))
+		return nil
+	}
+	var err error
+	if tdb.tx != nil {
+		err = get(tdb.tx)
+	} else {
+		err = tdb.db.View(get)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, fmt.Errorf("utxo trie node %x not found", key)
+	}
+	return value, nil
+}
+
+// Has returns whether a trie node is stored under the key.
+func (tdb *utxoTrieDB) Has(key []byte) (bool, error) {
+	value, err := tdb.Get(key)
+	return value != nil, err
+}
+
+// Delete removes the trie node stored under the key.
+func (tdb *utxoTrieDB) Delete(key []byte) error {
+	if tdb.tx != nil {
+		return tdb.tx.Metadata().Bucket(dbnamespace.UtxoTrieBucketName).Delete(key)
+	}
+	return tdb.db.Update(func(dbTx database.Tx) error {
+		return dbTx.Metadata().Bucket(dbnamespace.UtxoTrieBucketName).Delete(key)
+	})
+}
+
+// Close does nothing, the block database is closed by its owner.
+func (tdb *utxoTrieDB) Close() {}
+
+// NewBatch returns a batch which writes the trie nodes once it is written.
+func (tdb *utxoTrieDB) NewBatch() statedb.Batch {
+	return &utxoTrieBatch{tdb: tdb}
+}
+
+// utxoTrieBatch accumulates trie nodes until they are written to the utxo trie
+// bucket.
+type utxoTrieBatch struct {
+	tdb    *utxoTrieDB
+	writes [][2][]byte
+	size   int
+}
+
+// Put adds the trie node to the batch.  The key and the value are copied since
+// the trie reuses its buffers.
+func (b *utxoTrieBatch) Put(key, value []byte) error {
+	b.writes = append(b.writes, [2][]byte{util.CopyBytes(key), util.CopyBytes(value)})
+	b.size += len(value)
+	return nil
+}
+
+// ValueSize returns the size of the trie nodes in the batch.
+func (b *utxoTrieBatch) ValueSize() int {
+	return b.size
+}
+
+// Write writes the trie nodes of the batch.
+func (b *utxoTrieBatch) Write() error {
+	write := func(dbTx database.Tx) error {
+		for _, kv := range b.writes {
+			if err := dbPutUtxoTrieNode(dbTx, kv[0], kv[1]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if b.tdb.tx != nil {
+		return write(b.tdb.tx)
+	}
+	return b.tdb.db.Update(write)
+}
+
+// Reset empties the batch.
+func (b *utxoTrieBatch) Reset() {
+	b.writes = b.writes[:0]
+	b.size = 0
+}
+
+// utxoCommitment keeps a Merkle Patricia trie of the utxo set, keyed by the
+// outpoint and holding the serialized utxo entry.  The root of the trie after
+// each block is indexed by the order of the block.  Only the trie nodes of the
+// current root and of the utxo roots of the checkpoints are kept in the
+// database, the nodes are reference counted and removed once none of those
+// roots reaches them.
+type utxoCommitment struct {
+	tdb    *utxoTrieDB
+	trieDB *trie.Database
+	trie   *trie.SecureTrie
+
+	// root and order are the committed root of the trie and the order of
+	// the last block connected to it.
+	root  hash.Hash
+	order uint64
+
+	// pinned are the utxo roots of the checkpoints, whose trie nodes are
+	// never removed so their utxo snapshots can be served.
+	pinned map[hash.Hash]struct{}
+
+	// deleted are the keys removed from the trie since it was last
+	// flushed, their preimages are removed with the trie nodes.
+	deleted [][]byte
+}
+
+// UtxoProof is a Merkle proof for an outpoint against the utxo commitment root
+// of a block order.  Entry is the committed serialized utxo entry, followed by
+// the fees of its block for the first output of a coinbase, or nil when the
+// proof shows the outpoint is not in the utxo set.
+type UtxoProof struct {
+	Order uint64
+	Root  hash.Hash
+	Entry []byte
+	Proof [][]byte
+}
+
+// dbPutUtxoTrieNode uses an existing database transaction to store the trie
+// node or the key preimage under the key.  A trie node which is already stored
+// is left alone, otherwise the nodes it references gain a reference.
+func dbPutUtxoTrieNode(dbTx database.Tx, key []byte, value []byte) error {
+	bucket := dbTx.Metadata().Bucket(dbnamespace.UtxoTrieBucketName)
+	if len(key) != hash.HashSize {
+		return bucket.Put(key, value)
+	}
+	if bucket.Get(key) != nil {
+		return nil
+	}
+	children, err := trie.NodeChildren(value)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := dbReferenceUtxoTrieNode(dbTx, &child); err != nil {
+			return err
+		}
+	}
+	return bucket.Put(key, value)
+}
+
+// dbUtxoTrieNodeReferenced uses an existing database transaction to return
+// whether the trie node is referenced.
+func dbUtxoTrieNodeReferenced(dbTx database.Tx, h *hash.Hash) bool {
+	return dbTx.Metadata().Bucket(dbnamespace.UtxoTrieRefBucketName).Get(h[:]) != nil
+}
+
+// dbReferenceUtxoTrieNode uses an existing database transaction to add a
+// reference to the trie node.
+func dbReferenceUtxoTrieNode(dbTx database.Tx, h *hash.Hash) error {
+	bucket := dbTx.Metadata().Bucket(dbnamespace.UtxoTrieRefBucketName)
+	var refs uint32
+	if serialized := bucket.Get(h[:]); len(serialized) == 4 {
+		refs = dbnamespace.ByteOrder.Uint32(serialized)
+	}
+	var serialized [4]byte
+	dbnamespace.ByteOrder.PutUint32(serialized[:], refs+1)
+	return bucket.Put(h[:], serialized[:])
+}
+
+// dbReleaseUtxoTrieNode uses an existing database transaction to remove a
+// reference to the trie node.  The node is removed once nothing references it
+// anymore, which releases the nodes it references in turn.
+func dbReleaseUtxoTrieNode(dbTx database.Tx, h *hash.Hash) error {
+	meta := dbTx.Metadata()
+	nodes := meta.Bucket(dbnamespace.UtxoTrieBucketName)
+	refBucket := meta.Bucket(dbnamespace.UtxoTrieRefBucketName)
+	stack := []hash.Hash{*h}
+	for len(stack) > 0 {
+		h := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		serialized := refBucket.Get(h[:])
+		if len(serialized) != 4 {
+			continue
+		}
+		if refs := dbnamespace.ByteOrder.Uint32(serialized); refs > 1 {
+			var serialized [4]byte
+			dbnamespace.ByteOrder.PutUint32(serialized[:], refs-1)
+			if err := refBucket.Put(h[:], serialized[:]); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := refBucket.Delete(h[:]); err != nil {
+			return err
+		}
+		blob := nodes.Get(h[:])
+		if blob == nil {
+			continue
+		}
+		children, err := trie.NodeChildren(blob)
+		if err != nil {
+			return err
+		}
+		if err := nodes.Delete(h[:]); err != nil {
+			return err
+		}
+		stack = append(stack, children...)
+	}
+	return nil
+}
+
+// dbPutUtxoCommitment uses an existing database transaction to store the
+// current root of the utxo commitment and the order of the last block.
+func dbPutUtxoCommitment(dbTx database.Tx, root *hash.Hash, order uint64) error {
+	var serialized [hash.HashSize + 8]byte
+	copy(serialized[:], root[:])
+	dbnamespace.ByteOrder.PutUint64(serialized[hash.HashSize:], order)
+	return dbTx.Metadata().Put(dbnamespace.UtxoCommitmentKeyName, serialized[:])
+}
+
+// dbFetchUtxoCommitment uses an existing database transaction to fetch the
+// current root of the utxo commitment and the order of the last block.
+func dbFetchUtxoCommitment(dbTx database.Tx) (*hash.Hash, uint64, error) {
+	serialized := dbTx.Metadata().Get(dbnamespace.UtxoCommitmentKeyName)
+	if len(serialized) != hash.HashSize+8 {
+		return nil, 0, errDeserialize("malformed utxo commitment")
+	}
+	root, err := hash.NewHash(serialized[:hash.HashSize])
+	if err != nil {
+		return nil, 0, err
+	}
+	return root, dbnamespace.ByteOrder.Uint64(serialized[hash.HashSize:]), nil
+}
+
+// dbPutUtxoRoot uses an existing database transaction to index the utxo
+// commitment root by the block order.
+func dbPutUtxoRoot(dbTx database.Tx, order uint64, root *hash.Hash) error {
+	var serializedOrder [8]byte
+	dbnamespace.ByteOrder.PutUint64(serializedOrder[:], order)
+	return dbTx.Metadata().Bucket(dbnamespace.UtxoRootBucketName).Put(serializedOrder[:], root[:])
+}
+
+// dbRemoveUtxoRoot uses an existing database transaction to remove the utxo
+// commitment root of the block order.
+func dbRemoveUtxoRoot(dbTx database.Tx, order uint64) error {
+	var serializedOrder [8]byte
+	dbnamespace.ByteOrder.PutUint64(serializedOrder[:], order)
+	return dbTx.Metadata().Bucket(dbnamespace.UtxoRootBucketName).Delete(serializedOrder[:])
+}
+
+// dbFetchUtxoRoot uses an existing database transaction to fetch the utxo
+// commitment root of the block order.  Nil is returned when there is none.
+func dbFetchUtxoRoot(dbTx database.Tx, order uint64) *hash.Hash {
+	var serializedOrder [8]byte
+	dbnamespace.ByteOrder.PutUint64(serializedOrder[:], order)
+	serialized := dbTx.Metadata().Bucket(dbnamespace.UtxoRootBucketName).Get(serializedOrder[:])
+	if serialized == nil {
+		return nil
+	}
+	root, err := hash.NewHash(serialized)
+	if err != nil {
+		return nil
+	}
+	return root
+}
+
+// isCoinbaseReward returns whether the output is the first output of a
+// coinbase, which is paid out with the fees of its block.
+func isCoinbaseReward(outpoint types.TxOutPoint, entry *UtxoEntry) bool {
+	return outpoint.OutIndex == 0 && entry.IsCoinBase()
+}
+
+// appendUtxoFees returns the value the serialized utxo entry of the first
+// output of a coinbase is committed with, which is followed by the fees of its
+// block.  This way the fees that come with a utxo snapshot are covered by its
+// root.
+func appendUtxoFees(serialized []byte, fees int64) []byte {
+	value := make([]byte, len(serialized)+8)
+	copy(value, serialized)
+	dbnamespace.ByteOrder.PutUint64(value[len(serialized):], uint64(fees))
+	return value
+}
+
+// splitUtxoFees returns the serialized utxo entry and the fees of its block
+// from the committed value of the output with the key.  The fees are zero for
+// an output which is not the first output of a coinbase.
+func splitUtxoFees(key []byte, value []byte) ([]byte, uint64, error) {
+	if len(key) != hash.HashSize+1 || key[hash.HashSize] != 0 {
+		return value, 0, nil
+	}
+	entry, err := DeserializeUtxoEntry(value)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !entry.IsCoinBase() {
+		return value, 0, nil
+	}
+	if len(value) < 8 {
+		return nil, 0, errDeserialize("utxo commitment value has no fees")
+	}
+	n := len(value) - 8
+	return value[:n], dbnamespace.ByteOrder.Uint64(value[n:]), nil
+}
+
+// newUtxoCommitment loads the utxo commitment from the database.  The trie is
+// built from the utxo set when the database predates the commitment, in which
+// case only the root of the given order is known and the fees of the blocks
+// of the coinbase outputs are taken from the fees function.  The trie nodes of
+// the utxo roots of the checkpoints are never removed.
+func newUtxoCommitment(db database.DB, order uint64, checkpoints []params.Checkpoint,
+	fees func(database.Tx, *hash.Hash) int64) (*utxoCommitment, error) {
+
+	c := &utxoCommitment{
+		tdb:    &utxoTrieDB{db: db},
+		pinned: make(map[hash.Hash]struct{}),
+	}
+	c.trieDB = trie.NewDatabase(c.tdb)
+	for _, checkpoint := range checkpoints {
+		if checkpoint.UtxoRoot != nil {
+			c.pinned[*checkpoint.UtxoRoot] = struct{}{}
+		}
+	}
+
+	// The root bucket is created once the commitment is completely built.
+	var loaded bool
+	err := db.View(func(dbTx database.Tx) error {
+		if dbTx.Metadata().Bucket(dbnamespace.UtxoRootBucketName) == nil {
+			return nil
+		}
+		root, order, err := dbFetchUtxoCommitment(dbTx)
+		if err != nil {
+			return err
+		}
+		c.root, c.order = *root, order
+		loaded = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !loaded {
+		if err := c.build(db, order, fees); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.open(c.root); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// build builds the trie from the utxo set and commits its root at the order.
+// The outputs are added in batches, each written with its own database
+// transaction, and the trie nodes left behind by an interrupted build are
+// dropped first.
+func (c *utxoCommitment) build(db database.DB, order uint64, fees func(database.Tx, *hash.Hash) int64) error {
+	err := db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		for _, name := range [][]byte{dbnamespace.UtxoTrieBucketName,
+			dbnamespace.UtxoTrieRefBucketName} {
+
+			if meta.Bucket(name) != nil {
+				if err := meta.DeleteBucket(name); err != nil {
+					return err
+				}
+			}
+			if _, err := meta.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := c.open(c.root); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	count := 0
+	var next []byte
+	for done := false; !done; {
+		var keys, values [][]byte
+		err := db.View(func(dbTx database.Tx) error {
+			cursor := dbTx.Metadata().Bucket(dbnamespace.UtxoSetBucketName).Cursor()
+			ok := cursor.First()
+			if next != nil {
+				ok = cursor.Seek(next)
+			}
+			for ; ok; ok = cursor.Next() {
+				if len(keys) == utxoCommitBuildBatch {
+					next = util.CopyBytes(cursor.Key())
+					return nil
+				}
+				key, value := util.CopyBytes(cursor.Key()), util.CopyBytes(cursor.Value())
+				if len(key) == hash.HashSize+1 && key[hash.HashSize] == 0 {
+					entry, err := DeserializeUtxoEntry(value)
+					if err != nil {
+						return err
+					}
+					if entry.IsCoinBase() {
+						value = appendUtxoFees(value, fees(dbTx, entry.BlockHash()))
+					}
+				}
+				keys = append(keys, key)
+				values = append(values, value)
+			}
+			done = true
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for i := range keys {
+			if err := c.trie.TryUpdate(keys[i], values[i]); err != nil {
+				return err
+			}
+		}
+		count += len(keys)
+
+		root, err := c.commit()
+		if err != nil {
+			return err
+		}
+		err = db.Update(func(dbTx database.Tx) error {
+			return c.flushNodes(dbTx, &root)
+		})
+		if err != nil {
+			return err
+		}
+		c.root = root
+	}
+
+	err = db.Update(func(dbTx database.Tx) error {
+		if _, err := dbTx.Metadata().CreateBucket(dbnamespace.UtxoRootBucketName); err != nil {
+			return err
+		}
+		if err := dbPutUtxoCommitment(dbTx, &c.root, order); err != nil {
+			return err
+		}
+		return dbPutUtxoRoot(dbTx, order, &c.root)
+	})
+	if err != nil {
+		return err
+	}
+	c.order = order
+	log.Info(fmt.Sprintf("Built utxo commitment:outputs=%d root=%s time=%v", count, c.root, time.Since(start)))
+	return nil
+}
+
+// open replaces the trie with the one of the root.
+func (c *utxoCommitment) open(root hash.Hash) error {
+	t, err := trie.NewSecure(root, c.trieDB, utxoTrieCacheLimit)
+	if err != nil {
+		return err
+	}
+	c.trie = t
+	return nil
+}
+
+// apply applies the modified entries of the utxo view to the trie and returns
+// the new root.  The fees function returns the fees of the blocks of the first
+// outputs of the coinbases.  The trie nodes still need to be flushed with the
+// database transaction of the block.
+func (c *utxoCommitment) apply(view *UtxoViewpoint, fees func(*hash.Hash) int64) (hash.Hash, error) {
+	if err := c.update(view, fees); err != nil {
+		c.rollback()
+		return hash.Hash{}, err
+	}
+	root, err := c.commit()
+	if err != nil {
+		c.rollback()
+		return hash.Hash{}, err
+	}
+	return root, nil
+}
+
+// update applies the modified entries of the utxo view to the trie.
+func (c *utxoCommitment) update(view *UtxoViewpoint, fees func(*hash.Hash) int64) error {
+	for outpoint, entry := range view.entries {
+		if entry == nil || !entry.isModified() {
+			continue
+		}
+		key := outpointKey(outpoint)
+		var err error
+		if entry.IsSpent() {
+			err = c.trie.TryDelete(*key)
+			if err == nil {
+				c.deleted = append(c.deleted, util.CopyBytes(*key))
+			}
+		} else {
+			var serialized []byte
+			serialized, err = serializeUtxoEntry(entry)
+			if err == nil && isCoinbaseReward(outpoint, entry) {
+				serialized = appendUtxoFees(serialized, fees(entry.BlockHash()))
+			}
+			if err == nil {
+				err = c.trie.TryUpdate(*key, serialized)
+			}
+		}
+		recycleOutpointKey(key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commit hashes the trie and moves its new nodes to the trie database.
+func (c *utxoCommitment) commit() (hash.Hash, error) {
+	return c.trie.Commit(nil)
+}
+
+// flush uses an existing database transaction to write the trie nodes of the
+// root and to store it as the current root at the order.
+func (c *utxoCommitment) flush(dbTx database.Tx, root *hash.Hash, order uint64) error {
+	if err := c.flushNodes(dbTx, root); err != nil {
+		return err
+	}
+	return dbPutUtxoCommitment(dbTx, root, order)
+}
+
+// flushNodes uses an existing database transaction to write the trie nodes of
+// the root and to move the reference of the current root to it.  The trie
+// nodes only reached from the current root are removed then, unless it is the
+// utxo root of a checkpoint, as are the preimages of the deleted keys which no
+// such root holds.
+func (c *utxoCommitment) flushNodes(dbTx database.Tx, root *hash.Hash) error {
+	c.tdb.tx = dbTx
+	err := c.trieDB.Commit(*root, false)
+	c.tdb.tx = nil
+	if err != nil {
+		return err
+	}
+	// The utxo root of a checkpoint keeps a single reference, which is
+	// never released.
+	if _, ok := c.pinned[*root]; !ok || !dbUtxoTrieNodeReferenced(dbTx, root) {
+		if err := dbReferenceUtxoTrieNode(dbTx, root); err != nil {
+			return err
+		}
+	}
+	if _, ok := c.pinned[c.root]; !ok {
+		if err := dbReleaseUtxoTrieNode(dbTx, &c.root); err != nil {
+			return err
+		}
+	}
+	return c.removePreimages(dbTx)
+}
+
+// removePreimages uses an existing database transaction to remove the
+// preimages of the keys deleted from the trie, unless the key is still held by
+// the utxo root of a checkpoint.
+func (c *utxoCommitment) removePreimages(dbTx database.Tx) error {
+	if len(c.deleted) == 0 {
+		return nil
+	}
+	c.tdb.tx = dbTx
+	defer func() { c.tdb.tx = nil }()
+	var pinned []*trie.SecureTrie
+	for root := range c.pinned {
+		// The checkpoints which were not reached yet have no trie.
+		t, err := trie.NewSecure(root, c.trieDB, 0)
+		if err == nil {
+			pinned = append(pinned, t)
+		}
+	}
+
+	bucket := dbTx.Metadata().Bucket(dbnamespace.UtxoTrieBucketName)
+next:
+	for _, key := range c.deleted {
+		for _, t := range pinned {
+			value, err := t.TryGet(key)
+			if err != nil {
+				return err
+			}
+			if value != nil {
+				continue next
+			}
+		}
+		keyHash := hash.CalcHash(key, hash.GetHasher(hash.Keccak_256))
+		if err := bucket.Delete(trie.PreimageKey(keyHash)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setRoot marks the root as committed once the database transaction of the
+// block succeeded.
+func (c *utxoCommitment) setRoot(root hash.Hash, order uint64) {
+	c.root, c.order = root, order
+	c.deleted = nil
+}
+
+// rollback reopens the trie at the committed root after the database update
+// of a block failed.
+func (c *utxoCommitment) rollback() {
+	c.deleted = nil
+	if err := c.open(c.root); err != nil {
+		log.Error("Failed to reopen the utxo commitment", "root", c.root, "err", err)
+	}
+}
+
+// prove returns the proof for the outpoint against the trie of the root.
+func (c *utxoCommitment) prove(root hash.Hash, outpoint types.TxOutPoint) ([]byte, [][]byte, error) {
+	t := c.trie
+	if root != c.root {
+		var err error
+		t, err = trie.NewSecure(root, c.trieDB, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	key := outpointKey(outpoint)
+	defer recycleOutpointKey(key)
+	entry, err := t.TryGet(*key)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The secure trie proves the hashed key.
+	proofDb := statedb.NewMemDatabase()
+	keyHash := hash.CalcHash(*key, hash.GetHasher(hash.Keccak_256))
+	if err := t.Prove(keyHash, 0, proofDb); err != nil {
+		return nil, nil, err
+	}
+	proof := make([][]byte, 0, proofDb.Len())
+	for _, k := range proofDb.Keys() {
+		node, err := proofDb.Get(k)
+		if err != nil {
+			return nil, nil, err
+		}
+		proof = append(proof, node)
+	}
+	return util.CopyBytes(entry), proof, nil
+}
+
+// UtxoRoot returns the utxo commitment root after the block with the order was
+// connected.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) UtxoRoot(order uint64) (*hash.Hash, error) {
+	b.ChainRLock()
+	defer b.ChainRUnlock()
+
+	var root *hash.Hash
+	err := b.db.View(func(dbTx database.Tx) error {
+		root = dbFetchUtxoRoot(dbTx, order)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if root == nil {
+		return nil, fmt.Errorf("no utxo commitment root for order %d", order)
+	}
+	return root, nil
+}
+
+// UtxoProof returns the proof for the outpoint against the current utxo
+// commitment root.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) UtxoProof(outpoint types.TxOutPoint) (*UtxoProof, error) {
+	b.ChainRLock()
+	defer b.ChainRUnlock()
+
+	c := b.utxoCommit
+	if c == nil {
+		return nil, fmt.Errorf("the utxo set is not loaded")
+	}
+	entry, proof, err := c.prove(c.root, outpoint)
+	if err != nil {
+		return nil, err
+	}
+	return &UtxoProof{
+		Order: c.order,
+		Root:  c.root,
+		Entry: entry,
+		Proof: proof,
+	}, nil
+}
+
+// VerifyUtxoProof checks the proof for the outpoint against a trusted utxo
+// commitment root.  It returns the utxo entry of the outpoint, or nil when the
+// proof shows the outpoint is not in the utxo set.
+func VerifyUtxoProof(root *hash.Hash, outpoint types.TxOutPoint, proof [][]byte) (*UtxoEntry, error) {
+	proofDb := statedb.NewMemDatabase()
+	for _, node := range proof {
+		key := hash.CalcHash(node, hash.GetHasher(hash.Keccak_256))
+		if err := proofDb.Put(key, node); err != nil {
+			return nil, err
+		}
+	}
+	key := outpointKey(outpoint)
+	defer recycleOutpointKey(key)
+	keyHash := hash.CalcHash(*key, hash.GetHasher(hash.Keccak_256))
+	serialized, _, err := trie.VerifyProof(*root, keyHash, proofDb)
+	if err != nil {
+		return nil, err
+	}
+	if serialized == nil {
+		return nil, nil
+	}
+	return DeserializeUtxoEntry(serialized)
+}
@@ -0,0 +1,216 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/dbnamespace"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/database"
+	_ "github.com/btceasypay/bitcoinpay/database/ffldb"
+	"github.com/btceasypay/bitcoinpay/params"
+	"github.com/btceasypay/bitcoinpay/trie"
+)
+
+func TestUtxoCommitment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "utxocommit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := database.Create("ffldb", filepath.Join(dir, "db"), params.PrivNetParams.Net)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Start with the outputs of one transaction in the utxo set, the
+	// commitment is built from them.
+	blockHash := hash.Hash{1}
+	tx := types.NewTransaction()
+	tx.AddTxIn(types.NewTxInput(&types.TxOutPoint{Hash: hash.Hash{2}}, nil))
+	tx.AddTxOut(types.NewTxOutput(1000, []byte{0x51}))
+	tx.AddTxOut(types.NewTxOutput(2000, []byte{0x52}))
+	tx.AddTxOut(types.NewTxOutput(3000, []byte{0x53}))
+	view := NewUtxoViewpoint()
+	view.AddTxOuts(types.NewTx(tx), &blockHash)
+	err = db.Update(func(dbTx database.Tx) error {
+		if _, err := dbTx.Metadata().CreateBucket(dbnamespace.UtxoSetBucketName); err != nil {
+			return err
+		}
+		return dbPutUtxoView(dbTx, view)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	view.commit()
+	noFees := func(database.Tx, *hash.Hash) int64 { return 0 }
+	c, err := newUtxoCommitment(db, 0, nil, noFees)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root0 := c.root
+	// The trie nodes of the first root are kept like the ones of the utxo
+	// root of a checkpoint.
+	c.pinned[root0] = struct{}{}
+
+	spent := types.TxOutPoint{Hash: tx.TxHash(), OutIndex: 0}
+	unspent := types.TxOutPoint{Hash: tx.TxHash(), OutIndex: 1}
+	checkProof := func(root hash.Hash, outpoint types.TxOutPoint, wantAmount uint64) {
+		t.Helper()
+		entry, proof, err := c.prove(root, outpoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		verified, err := VerifyUtxoProof(&root, outpoint, proof)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wantAmount == 0 {
+			if entry != nil || verified != nil {
+				t.Fatalf("%v: proof shows an unspent output", outpoint)
+			}
+			return
+		}
+		if verified == nil || verified.Amount() != wantAmount {
+			t.Fatalf("%v: proof shows %v, want amount %d", outpoint, verified, wantAmount)
+		}
+	}
+	checkProof(root0, spent, 1000)
+	checkProof(root0, unspent, 2000)
+
+	// Spending an output changes the root, the proofs against the pinned
+	// root can still be made.
+	view.LookupEntry(spent).Spend()
+	connect := func(order uint64) hash.Hash {
+		t.Helper()
+		root, err := c.apply(view, func(*hash.Hash) int64 { return 0 })
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = db.Update(func(dbTx database.Tx) error {
+			if err := dbPutUtxoView(dbTx, view); err != nil {
+				return err
+			}
+			if err := c.flush(dbTx, &root, order); err != nil {
+				return err
+			}
+			return dbPutUtxoRoot(dbTx, order, &root)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.setRoot(root, order)
+		view.commit()
+		return root
+	}
+	root1 := connect(1)
+	if root1 == root0 {
+		t.Fatal("root not changed by spending an output")
+	}
+	checkProof(root1, spent, 0)
+	checkProof(root1, unspent, 2000)
+	checkProof(root0, spent, 1000)
+
+	// A proof doesn't verify against another root.
+	_, proof, err := c.prove(root1, unspent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyUtxoProof(&root0, unspent, proof); err == nil {
+		t.Fatal("proof verified against the wrong root")
+	}
+
+	// The trie nodes only reached from a root which is not current anymore
+	// are removed, along with the preimages of the keys only it held.
+	view.LookupEntry(unspent).Spend()
+	root2 := connect(2)
+	if _, _, err := c.prove(root1, unspent); err == nil {
+		t.Fatal("proof made against a pruned root")
+	}
+	checkProof(root2, unspent, 0)
+	checkProof(root0, unspent, 2000)
+	checkStoredNodes := func(wantPreimages int, roots ...hash.Hash) {
+		t.Helper()
+		want := make(map[hash.Hash]struct{})
+		for _, root := range roots {
+			tr, err := trie.NewSecure(root, c.trieDB, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for it := tr.NodeIterator(nil); it.Next(true); {
+				if it.Hash() != (hash.Hash{}) {
+					want[it.Hash()] = struct{}{}
+				}
+			}
+		}
+		var stored, preimages int
+		err := db.View(func(dbTx database.Tx) error {
+			bucket := dbTx.Metadata().Bucket(dbnamespace.UtxoTrieBucketName)
+			return bucket.ForEach(func(k, v []byte) error {
+				if len(k) != hash.HashSize {
+					preimages++
+					return nil
+				}
+				if _, ok := want[hash.MustBytesToHash(k)]; !ok {
+					return fmt.Errorf("unreachable trie node %x stored", k)
+				}
+				stored++
+				return nil
+			})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored != len(want) {
+			t.Fatalf("%d reachable trie nodes stored, want %d", stored, len(want))
+		}
+		if preimages != wantPreimages {
+			t.Fatalf("%d preimages stored, want %d", preimages, wantPreimages)
+		}
+	}
+	// All the outputs are held by the pinned root.
+	checkStoredNodes(3, root0, root2)
+
+	// Restoring the outputs brings back the pinned root.
+	view.AddTxOut(types.NewTx(tx), 0, &blockHash)
+	view.AddTxOut(types.NewTx(tx), 1, &blockHash)
+	if root := connect(3); root != root0 {
+		t.Fatalf("root after restoring the outputs is %v, want %v", root, root0)
+	}
+
+	// The commitment is loaded again from the database.
+	c, err = newUtxoCommitment(db, 0, nil, noFees)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.root != root0 || c.order != 3 {
+		t.Fatalf("loaded root %v at order %d, want %v at order 3", c.root, c.order, root0)
+	}
+	checkProof(root0, unspent, 2000)
+	checkStoredNodes(3, root0)
+
+	// Without the pin, spending an output removes its preimage.
+	view.LookupEntry(spent).Spend()
+	if root := connect(4); root != root1 {
+		t.Fatalf("root after spending the output again is %v, want %v", root, root1)
+	}
+	checkStoredNodes(2, root1)
+	err = db.View(func(dbTx database.Tx) error {
+		if root := dbFetchUtxoRoot(dbTx, 1); root == nil || *root != root1 {
+			t.Fatalf("root of order 1 is %v, want %v", root, root1)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -56,7 +56,9 @@ func (b *BlockChain) checkBlockSanity(block *types.SerializedBlock, timeSource M
 	header := &msgBlock.Header
 
 	// TODO It can be considered to delete in the future when it is officially launched
-	if header.GetVersion() != b.BlockVersion {
+	// The higher bits of the version vote on the deployments, so the whole
+	// version is checked rather than its lower half.
+	if !b.checkBlockVersion(header.Version) {
 		return ruleError(ErrBlockVersionTooOld, "block version too old")
 	}
 
@@ -155,7 +157,8 @@ func (b *BlockChain) checkBlockSanity(block *types.SerializedBlock, timeSource M
 		// transaction tree.
 		msgTx := tx.Transaction()
 		txType := types.DetermineTxType(msgTx)
-		if txType != types.TxTypeRegular {
+		if txType != types.TxTypeRegular && txType != types.AssetIssue &&
+			txType != types.AssetRevoke {
 			errStr := fmt.Sprintf("block contains a irregular "+
 				"transaction in the regular transaction tree at "+
 				"index %d", i)
@@ -201,13 +204,15 @@ func (b *BlockChain) checkBlockSanity(block *types.SerializedBlock, timeSource M
 	}
 
 	// The number of signature operations must be less than the maximum
-	// allowed per block.
+	// allowed per block.  Whether OP_CHECKMULTISIGALT is active depends on
+	// the position of the block, so it is only counted by
+	// checkTransactionsAndConnect.
 	totalSigOps := 0
 	for _, tx := range allTransactions {
 		// We could potentially overflow the accumulator so check for
 		// overflow.
 		lastSigOps := totalSigOps
-		totalSigOps += CountSigOps(tx)
+		totalSigOps += CountSigOps(tx, 0)
 		if totalSigOps < lastSigOps || totalSigOps > MaxSigOpsPerBlock {
 			str := fmt.Sprintf("block contains too many signature "+
 				"operations - got %v, max %v", totalSigOps,
@@ -454,22 +459,23 @@ func isNullOutpoint(outpoint *types.TxOutPoint) bool {
 // CountSigOps returns the number of signature operations for all transaction
 // input and output scripts in the provided transaction.  This uses the
 // quicker, but imprecise, signature operation counting mechanism from
-// txscript.
-func CountSigOps(tx *types.Tx) int {
+// txscript.  OP_CHECKMULTISIGALT is only counted when the script flags
+// interpret it.
+func CountSigOps(tx *types.Tx, flags txscript.ScriptFlags) int {
 	msgTx := tx.Transaction()
 
 	// Accumulate the number of signature operations in all transaction
 	// inputs.
 	totalSigOps := 0
 	for _, txIn := range msgTx.TxIn {
-		numSigOps := txscript.GetSigOpCount(txIn.SignScript)
+		numSigOps := txscript.GetSigOpCount(txIn.SignScript, flags)
 		totalSigOps += numSigOps
 	}
 
 	// Accumulate the number of signature operations in all transaction
 	// outputs.
 	for _, txOut := range msgTx.TxOut {
-		numSigOps := txscript.GetSigOpCount(txOut.PkScript)
+		numSigOps := txscript.GetSigOpCount(txOut.PkScript, flags)
 		totalSigOps += numSigOps
 	}
 
@@ -844,6 +850,15 @@ func (b *BlockChain) consensusScriptVerifyFlags(node *blockNode) (txscript.Scrip
 
 	scriptFlags |= txscript.ScriptVerifyCheckSequenceVerify
 	scriptFlags |= txscript.ScriptVerifySHA256
+
+	// Enforce OP_CHECKMULTISIGALT once its deployment is active.
+	active, err := b.isDeploymentActive(node, params.DeploymentCheckMultiSigAlt)
+	if err != nil {
+		return 0, err
+	}
+	if active {
+		scriptFlags |= txscript.ScriptVerifyCheckMultiSigAlt
+	}
 	return scriptFlags, nil
 }
 
@@ -852,10 +867,20 @@ func (b *BlockChain) consensusScriptVerifyFlags(node *blockNode) (txscript.Scrip
 // After ensuring the transaction is valid, the transaction is connected to the
 // UTXO viewpoint.  TxTree true == Regular, false == Stake
 func (b *BlockChain) checkTransactionsAndConnect(node *blockNode, block *types.SerializedBlock, subsidyCache *SubsidyCache, utxoView *UtxoViewpoint, stxos *[]SpentTxOut) error {
+	// OP_CHECKMULTISIGALT only counts as signature operations once its
+	// deployment is active, before it is an unknown opcode.
+	multiSigAltActive, err := b.isDeploymentActive(node, params.DeploymentCheckMultiSigAlt)
+	if err != nil {
+		return err
+	}
+	var sigOpFlags txscript.ScriptFlags
+	if multiSigAltActive {
+		sigOpFlags |= txscript.ScriptVerifyCheckMultiSigAlt
+	}
 	transactions := block.Transactions()
 	totalSigOpCost := 0
 	for _, tx := range transactions {
-		sigOpCost := CountSigOps(tx)
+		sigOpCost := CountSigOps(tx, sigOpFlags)
 
 		// Check for overflow or going over the limits.  We have to do
 		// this on every loop iteration to avoid overflow.
@@ -869,6 +894,13 @@ func (b *BlockChain) checkTransactionsAndConnect(node *blockNode, block *types.S
 		}
 	}
 
+	// The assets are only checked once their deployment is active, the
+	// outputs created before are plain outputs.
+	assetsActive, err := b.isDeploymentActive(node, params.DeploymentAssets)
+	if err != nil {
+		return err
+	}
+
 	var totalFees int64
 	for idx, tx := range transactions {
 		if tx.IsDuplicate && !tx.Tx.IsCoinBase() {
@@ -878,6 +910,12 @@ func (b *BlockChain) checkTransactionsAndConnect(node *blockNode, block *types.S
 		if err != nil {
 			return err
 		}
+		if assetsActive {
+			err = b.checkTransactionAssets(tx, utxoView)
+			if err != nil {
+				return err
+			}
+		}
 
 		// Sum the total fees and ensure we don't overflow the
 		// accumulator.
@@ -917,16 +955,16 @@ func SequenceLockActive(lock *SequenceLock, blockHeight int64, medianTime time.T
 // sure they don't overflow the limits.  It takes a cumulative number of sig
 // ops as an argument and increments will each call.
 // TxTree true == Regular, false == Stake
-func checkNumSigOps(tx *types.Tx, utxoView *UtxoViewpoint, index int, txTree bool, cumulativeSigOps int) (int, error) {
+func checkNumSigOps(tx *types.Tx, utxoView *UtxoViewpoint, index int, txTree bool, cumulativeSigOps int, flags txscript.ScriptFlags) (int, error) {
 
-	numsigOps := CountSigOps(tx)
+	numsigOps := CountSigOps(tx, flags)
 
 	// Since the first (and only the first) transaction has already been
 	// verified to be a coinbase transaction, use (i == 0) && TxTree as an
 	// optimization for the flag to countP2SHSigOps for whether or not the
 	// transaction is a coinbase transaction rather than having to do a
 	// full coinbase check again.
-	numP2SHSigOps, err := CountP2SHSigOps(tx, (index == 0) && txTree, utxoView)
+	numP2SHSigOps, err := CountP2SHSigOps(tx, (index == 0) && txTree, utxoView, flags)
 	if err != nil {
 		log.Trace("CountP2SHSigOps failed", "error", err)
 		return 0, err
@@ -952,8 +990,9 @@ func checkNumSigOps(tx *types.Tx, utxoView *UtxoViewpoint, index int, txTree boo
 // CountP2SHSigOps returns the number of signature operations for all input
 // transactions which are of the pay-to-script-hash type.  This uses the
 // precise, signature operation counting mechanism from the script engine which
-// requires access to the input transaction scripts.
-func CountP2SHSigOps(tx *types.Tx, isCoinBaseTx bool, utxoView *UtxoViewpoint) (int, error) {
+// requires access to the input transaction scripts.  OP_CHECKMULTISIGALT is
+// only counted when the script flags interpret it.
+func CountP2SHSigOps(tx *types.Tx, isCoinBaseTx bool, utxoView *UtxoViewpoint, flags txscript.ScriptFlags) (int, error) {
 	// Coinbase transactions have no interesting inputs.
 	if isCoinBaseTx {
 		return 0, nil
@@ -985,7 +1024,7 @@ func CountP2SHSigOps(tx *types.Tx, isCoinBaseTx bool, utxoView *UtxoViewpoint) (
 		// referenced public key script.
 		sigScript := txIn.SignScript
 		numSigOps := txscript.GetPreciseSigOpCount(sigScript, pkScript,
-			true)
+			true, flags)
 
 		// We could potentially overflow the accumulator so check for
 		// overflow.
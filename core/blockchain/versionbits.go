@@ -0,0 +1,308 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Copyright (c) 2016-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/btceasypay/bitcoinpay/params"
+)
+
+const (
+	// vbBaseVersionMask is the bitmask of the base block version of the
+	// network, which every block version must keep.
+	vbBaseVersionMask = 0x0000ffff
+
+	// vbTopBits defines the bits to set in the version to signal that the
+	// version bits scheme is being used.
+	vbTopBits = 0x20000000
+
+	// vbTopMask is the bitmask to use to determine whether or not the
+	// version bits scheme is in use.
+	vbTopMask = 0xe0000000
+
+	// vbFirstBit is the first bit of the version used to vote on the
+	// deployments.  The bit number of a deployment is counted from it, since
+	// the lower bits hold the base block version.
+	vbFirstBit = 16
+
+	// vbNumBits is the total number of bits available for use with the
+	// version bits scheme.
+	vbNumBits = 13
+)
+
+// deploymentChecker provides a thresholdConditionChecker which can be used to
+// test a specific deployment rule.  This is required for properly detecting
+// and activating consensus rule changes.
+type deploymentChecker struct {
+	deployment *params.ConsensusDeployment
+	chain      *BlockChain
+}
+
+// Ensure the deploymentChecker type implements the thresholdConditionChecker
+// interface.
+var _ thresholdConditionChecker = deploymentChecker{}
+
+// BeginTime returns the unix timestamp for the median block time after which
+// voting on a rule change starts (at the next window).
+//
+// This implementation returns the value defined by the specific deployment the
+// checker is associated with.
+//
+// This is part of the thresholdConditionChecker interface implementation.
+func (c deploymentChecker) BeginTime() uint64 {
+	return c.deployment.StartTime
+}
+
+// EndTime returns the unix timestamp for the median block time after which an
+// attempted rule change fails if it has not already been locked in or
+// activated.
+//
+// This implementation returns the value defined by the specific deployment the
+// checker is associated with.
+//
+// This is part of the thresholdConditionChecker interface implementation.
+func (c deploymentChecker) EndTime() uint64 {
+	return c.deployment.ExpireTime
+}
+
+// RuleChangeActivationThreshold is the number of blocks for which the condition
+// must be true in order to lock in a rule change.
+//
+// This implementation returns the value defined by the chain params the checker
+// is associated with.
+//
+// This is part of the thresholdConditionChecker interface implementation.
+func (c deploymentChecker) RuleChangeActivationThreshold() uint32 {
+	return c.chain.params.RuleChangeActivationThreshold
+}
+
+// MinerConfirmationWindow is the number of blocks in each threshold state
+// retarget window.
+//
+// This implementation returns the value defined by the chain params the checker
+// is associated with.
+//
+// This is part of the thresholdConditionChecker interface implementation.
+func (c deploymentChecker) MinerConfirmationWindow() uint32 {
+	return c.chain.params.MinerConfirmationWindow
+}
+
+// Condition returns true when the specific bit defined by the deployment
+// associated with the checker is set.
+//
+// This is part of the thresholdConditionChecker interface implementation.
+func (c deploymentChecker) Condition(node *blockNode) (bool, error) {
+	conditionMask := deploymentBit(c.deployment)
+	version := node.blockVersion
+	return (version&vbTopMask == vbTopBits) && (version&conditionMask != 0),
+		nil
+}
+
+// deploymentBit returns the bit of the block version voting on the deployment.
+func deploymentBit(deployment *params.ConsensusDeployment) uint32 {
+	return uint32(1) << (vbFirstBit + uint32(deployment.BitNumber))
+}
+
+// baseBlockVersion returns the base block version of the network from the
+// version of a block, without the bits voting on the deployments.
+func baseBlockVersion(version uint32) uint32 {
+	return version & vbBaseVersionMask
+}
+
+// checkBlockVersion returns whether the version of a block is the base block
+// version of the chain, or the base block version with the top bits of the
+// version bits scheme and the bits of the deployments of the chain.  Any other
+// bit is rejected.
+func (b *BlockChain) checkBlockVersion(version uint32) bool {
+	if version == b.BlockVersion {
+		return true
+	}
+	if version&vbTopMask != vbTopBits || baseBlockVersion(version) != b.BlockVersion {
+		return false
+	}
+	var bits uint32
+	deployments := b.deployments()
+	for id := range deployments {
+		bits |= deploymentBit(&deployments[id])
+	}
+	return version&^(vbTopMask|vbBaseVersionMask|bits) == 0
+}
+
+// deployments returns the deployments voted on by the blocks of the chain.
+// They are the deployments of the base block version, the deployment IDs are
+// their indexes.
+func (b *BlockChain) deployments() []params.ConsensusDeployment {
+	return b.params.Deployments[b.BlockVersion]
+}
+
+// checkDeployments ensures the deployments of the chain use distinct bits
+// within the bits available for voting.
+func checkDeployments(deployments []params.ConsensusDeployment) error {
+	var bits uint32
+	for id := range deployments {
+		deployment := &deployments[id]
+		if deployment.BitNumber >= vbNumBits {
+			return AssertError(fmt.Sprintf("deployment ID %d uses bit "+
+				"%d, the highest bit is %d", id, deployment.BitNumber,
+				vbNumBits-1))
+		}
+		bit := deploymentBit(deployment)
+		if bits&bit != 0 {
+			return AssertError(fmt.Sprintf("deployment ID %d uses the "+
+				"bit %d of another deployment", id, deployment.BitNumber))
+		}
+		bits |= bit
+	}
+	return nil
+}
+
+// calcNextBlockVersion calculates the expected version of the block after the
+// passed previous block node based on the state of started and locked in
+// rule change deployments.
+//
+// This function differs from the exported CalcNextBlockVersion in that the
+// exported version uses the current main chain tip as the previous block node
+// while this function accepts any block node.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) calcNextBlockVersion(prevNode *blockNode) (uint32, error) {
+	// Set the appropriate bits for each actively defined rule deployment
+	// that is either in the process of being voted on, or locked in for the
+	// activation at the next threshold window change.  The blocks only use
+	// the version bits scheme while there are deployments to vote on.
+	var bits uint32
+	deployments := b.deployments()
+	for id := range deployments {
+		deployment := &deployments[id]
+		cache := &b.deploymentCaches[id]
+		checker := deploymentChecker{deployment: deployment, chain: b}
+		state, err := b.thresholdState(prevNode, checker, cache)
+		if err != nil {
+			return 0, err
+		}
+		if state == ThresholdStarted || state == ThresholdLockedIn {
+			bits |= deploymentBit(deployment)
+		}
+	}
+	if bits == 0 {
+		return b.BlockVersion, nil
+	}
+	return vbTopBits | bits | b.BlockVersion, nil
+}
+
+// CalcNextBlockVersion calculates the expected version of the block after the
+// end of the current main chain.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) CalcNextBlockVersion() (uint32, error) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	prevNode := b.index.LookupNode(b.bd.GetMainChainTip().GetHash())
+	return b.calcNextBlockVersion(prevNode)
+}
+
+// deploymentState returns the current rule change threshold for a given
+// deployment ID.  The threshold is evaluated from the point of view of the
+// block node passed in as the first argument to this method.
+//
+// It is important to note that, as the variable name indicates, this function
+// expects the block node prior to the block for which the deployment state is
+// desired.  In other words, the returned deployment state is for the block
+// AFTER the passed node.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) deploymentState(prevNode *blockNode, deploymentID uint32) (ThresholdState, error) {
+	deployments := b.deployments()
+	if deploymentID >= uint32(len(deployments)) {
+		return ThresholdFailed, DeploymentError(fmt.Sprintf("%d", deploymentID))
+	}
+
+	deployment := &deployments[deploymentID]
+	checker := deploymentChecker{deployment: deployment, chain: b}
+	cache := &b.deploymentCaches[deploymentID]
+
+	return b.thresholdState(prevNode, checker, cache)
+}
+
+// isDeploymentActive returns whether the rules of the deployment apply to the
+// block of the node, which is the case when the deployment is active for the
+// block after its main parent.  A deployment the block version of the chain
+// doesn't define is never active.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) isDeploymentActive(node *blockNode, deploymentID uint32) (bool, error) {
+	if deploymentID >= uint32(len(b.deployments())) {
+		return false, nil
+	}
+	state, err := b.deploymentState(node.GetMainParent(b), deploymentID)
+	if err != nil {
+		return false, err
+	}
+	return state == ThresholdActive, nil
+}
+
+// DeploymentInfo describes a deployment and its threshold state for the block
+// after the end of the current main chain.
+type DeploymentInfo struct {
+	ID         uint32
+	BitNumber  uint8
+	StartTime  uint64
+	ExpireTime uint64
+	State      ThresholdState
+}
+
+// Deployments returns the deployments voted on by the blocks of the chain and
+// their current threshold states.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) Deployments() ([]DeploymentInfo, error) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	prevNode := b.index.LookupNode(b.bd.GetMainChainTip().GetHash())
+	deployments := b.deployments()
+	infos := make([]DeploymentInfo, 0, len(deployments))
+	for id, deployment := range deployments {
+		state, err := b.deploymentState(prevNode, uint32(id))
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, DeploymentInfo{
+			ID:         uint32(id),
+			BitNumber:  deployment.BitNumber,
+			StartTime:  deployment.StartTime,
+			ExpireTime: deployment.ExpireTime,
+			State:      state,
+		})
+	}
+	return infos, nil
+}
+
+// ThresholdState returns the current rule change threshold state of the given
+// deployment ID for the block AFTER the end of the current main chain.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ThresholdState(deploymentID uint32) (ThresholdState, error) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	prevNode := b.index.LookupNode(b.bd.GetMainChainTip().GetHash())
+	return b.deploymentState(prevNode, deploymentID)
+}
+
+// IsDeploymentActive returns true if the target deploymentID is active, and
+// false otherwise.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) IsDeploymentActive(deploymentID uint32) (bool, error) {
+	state, err := b.ThresholdState(deploymentID)
+	if err != nil {
+		return false, err
+	}
+	return state == ThresholdActive, nil
+}
@@ -0,0 +1,280 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+
+package blockchain
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/blockdag"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/core/types/pow"
+	"github.com/btceasypay/bitcoinpay/database"
+	_ "github.com/btceasypay/bitcoinpay/database/ffldb"
+	"github.com/btceasypay/bitcoinpay/engine/txscript"
+	"github.com/btceasypay/bitcoinpay/params"
+)
+
+// newVersionBitsChain returns a chain with only the block index and the DAG,
+// which the threshold states are calculated from.
+func newVersionBitsChain(t *testing.T, par *params.Params) (*BlockChain, func()) {
+	dir, err := ioutil.TempDir("", "versionbits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := database.Create("ffldb", filepath.Join(dir, "db"), par.Net)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	b := &BlockChain{
+		db:               db,
+		params:           par,
+		index:            newBlockIndex(db, par),
+		BlockVersion:     1,
+		deploymentCaches: newThresholdCaches(uint32(len(par.Deployments[1]))),
+	}
+	b.bd = &blockdag.BlockDAG{}
+	b.bd.Init("phantom", func(int64, *hash.Hash, byte) int64 { return 1 }, -1,
+		b.index.GetDAGBlockID, db)
+	return b, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// addVersionBitsNode adds a block with the version on top of the main chain.
+func addVersionBitsNode(t *testing.T, b *BlockChain, version uint32) *blockNode {
+	header := &types.BlockHeader{
+		Version:    version,
+		Difficulty: 0x207fffff,
+		Timestamp:  time.Unix(int64(1600000000+b.bd.GetBlockTotal()), 0),
+		Pow:        pow.GetInstance(pow.BLAKE2BD, 0, []byte{}),
+	}
+	var parents []*blockNode
+	if b.bd.GetBlockTotal() > 0 {
+		parents = append(parents, b.index.LookupNode(b.bd.GetMainChainTip().GetHash()))
+		header.TxRoot = hash.Hash{byte(b.bd.GetBlockTotal()), byte(b.bd.GetBlockTotal() >> 8)}
+	}
+	node := newBlockNode(header, parents)
+	_, ib := b.bd.AddBlock(node)
+	if ib == nil {
+		t.Fatalf("block %s not added", node.hash)
+	}
+	node.dagID = ib.GetID()
+	node.SetHeight(ib.GetHeight())
+	b.index.AddNode(node)
+	return node
+}
+
+func TestThresholdState(t *testing.T) {
+	par := params.PrivNetParams
+	par.RuleChangeActivationThreshold = 3
+	par.MinerConfirmationWindow = 4
+	par.Deployments = map[uint32][]params.ConsensusDeployment{
+		1: {
+			{BitNumber: 2, StartTime: 0, ExpireTime: math.MaxInt64},
+			{BitNumber: 3, StartTime: 0, ExpireTime: 1},
+			{BitNumber: 4, StartTime: math.MaxInt64, ExpireTime: math.MaxInt64},
+		},
+	}
+	b, teardown := newVersionBitsChain(t, &par)
+	defer teardown()
+
+	signal := uint32(vbTopBits | 1<<(vbFirstBit+2) | 1)
+	tests := []struct {
+		versions []uint32
+		states   []ThresholdState
+		version  uint32
+	}{
+		// The state of the first window is defined.
+		{
+			versions: []uint32{1, 1, 1},
+			states:   []ThresholdState{ThresholdDefined, ThresholdDefined, ThresholdDefined},
+			version:  1,
+		},
+		// The voting starts, unless the deployment expired.
+		{
+			versions: []uint32{1},
+			states:   []ThresholdState{ThresholdStarted, ThresholdFailed, ThresholdDefined},
+			version:  signal,
+		},
+		// Too few votes of the window, also from other bits.
+		{
+			versions: []uint32{signal, signal, 1, vbTopBits | 1<<(vbFirstBit+3) | 1},
+			states:   []ThresholdState{ThresholdStarted, ThresholdFailed, ThresholdDefined},
+			version:  signal,
+		},
+		// The votes must use the version bits scheme.
+		{
+			versions: []uint32{signal, signal, 1<<(vbFirstBit+2) | 1, 1},
+			states:   []ThresholdState{ThresholdStarted, ThresholdFailed, ThresholdDefined},
+			version:  signal,
+		},
+		// Enough votes lock the deployment in.
+		{
+			versions: []uint32{signal, 1, signal, signal},
+			states:   []ThresholdState{ThresholdLockedIn, ThresholdFailed, ThresholdDefined},
+			version:  signal,
+		},
+		// The deployment is active after the next window.
+		{
+			versions: []uint32{1, 1, 1, 1},
+			states:   []ThresholdState{ThresholdActive, ThresholdFailed, ThresholdDefined},
+			version:  1,
+		},
+	}
+	for i, test := range tests {
+		for _, version := range test.versions {
+			addVersionBitsNode(t, b, version)
+		}
+		for id, want := range test.states {
+			state, err := b.ThresholdState(uint32(id))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state != want {
+				t.Fatalf("test #%d: deployment %d is %v, want %v", i, id, state, want)
+			}
+		}
+		version, err := b.CalcNextBlockVersion()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if version != test.version {
+			t.Fatalf("test #%d: got block version %#x, want %#x", i, version, test.version)
+		}
+		if baseBlockVersion(version) != b.BlockVersion {
+			t.Fatalf("test #%d: block version %#x changes the base version", i, version)
+		}
+	}
+
+	active, err := b.IsDeploymentActive(0)
+	if err != nil || !active {
+		t.Fatalf("deployment not active: %v", err)
+	}
+	if _, err := b.ThresholdState(3); err == nil {
+		t.Fatal("got the state of an unknown deployment")
+	} else if _, ok := err.(DeploymentError); !ok {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+// TestDeploymentScriptFlags ensures OP_CHECKMULTISIGALT is only enforced by
+// the blocks once its deployment is active.
+func TestDeploymentScriptFlags(t *testing.T) {
+	par := params.PrivNetParams
+	par.RuleChangeActivationThreshold = 3
+	par.MinerConfirmationWindow = 4
+	par.Deployments = map[uint32][]params.ConsensusDeployment{
+		1: {
+			params.DeploymentCheckMultiSigAlt: {BitNumber: 0, StartTime: 0, ExpireTime: math.MaxInt64},
+		},
+	}
+	b, teardown := newVersionBitsChain(t, &par)
+	defer teardown()
+
+	hasFlag := func(node *blockNode) bool {
+		flags, err := b.consensusScriptVerifyFlags(node)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return flags&txscript.ScriptVerifyCheckMultiSigAlt != 0
+	}
+	signal := uint32(vbTopBits | 1<<vbFirstBit | 1)
+	var node *blockNode
+	for _, version := range []uint32{1, 1, 1, 1, signal, signal, signal, signal, 1, 1, 1, 1} {
+		node = addVersionBitsNode(t, b, version)
+		if hasFlag(node) {
+			t.Fatalf("block %d enforces the deployment before it is active", node.height)
+		}
+	}
+	node = addVersionBitsNode(t, b, 1)
+	if !hasFlag(node) {
+		t.Fatalf("block %d doesn't enforce the active deployment", node.height)
+	}
+
+	// Without the deployment the flag is never set.
+	par.Deployments = map[uint32][]params.ConsensusDeployment{}
+	if hasFlag(node) {
+		t.Fatal("the flag of an undefined deployment is set")
+	}
+}
+
+// TestCheckBlockVersion ensures the blocks only set the top bits of the
+// version bits scheme and the bits of the deployments above the base block
+// version.
+func TestCheckBlockVersion(t *testing.T) {
+	par := params.PrivNetParams
+	par.Deployments = map[uint32][]params.ConsensusDeployment{
+		1: {{BitNumber: 0}, {BitNumber: 2}},
+	}
+	b, teardown := newVersionBitsChain(t, &par)
+	defer teardown()
+
+	tests := []struct {
+		version uint32
+		valid   bool
+	}{
+		{1, true},
+		{vbTopBits | 1<<vbFirstBit | 1, true},
+		{vbTopBits | 1<<(vbFirstBit+2) | 1<<vbFirstBit | 1, true},
+		{vbTopBits | 1, true},
+		{2, false},
+		{vbTopBits | 1<<vbFirstBit | 2, false},
+		{1<<vbFirstBit | 1, false},
+		{vbTopBits | 1<<(vbFirstBit+1) | 1, false},
+		{vbTopBits | 1<<(vbFirstBit+vbNumBits-1) | 1, false},
+		{0x40000000 | 1<<vbFirstBit | 1, false},
+		{0xffff0001, false},
+	}
+	for _, test := range tests {
+		block := types.NewBlock(&types.Block{Header: types.BlockHeader{
+			Version: test.version,
+			Pow:     pow.GetInstance(pow.BLAKE2BD, 0, []byte{}),
+		}})
+		err := b.checkBlockSanity(block, nil, BFNone, &par)
+		rerr, ok := err.(RuleError)
+		if !ok {
+			t.Fatalf("version %#x: unexpected error %v", test.version, err)
+		}
+		if valid := rerr.ErrorCode != ErrBlockVersionTooOld; valid != test.valid {
+			t.Errorf("version %#x: got valid %v, want %v", test.version, valid,
+				test.valid)
+		}
+	}
+}
+
+func TestCheckDeployments(t *testing.T) {
+	tests := []struct {
+		deployments []params.ConsensusDeployment
+		valid       bool
+	}{
+		{nil, true},
+		{[]params.ConsensusDeployment{{BitNumber: 0}, {BitNumber: vbNumBits - 1}}, true},
+		{[]params.ConsensusDeployment{{BitNumber: vbNumBits}}, false},
+		{[]params.ConsensusDeployment{{BitNumber: 1}, {BitNumber: 1}}, false},
+	}
+	for i, test := range tests {
+		err := checkDeployments(test.deployments)
+		if (err == nil) != test.valid {
+			t.Fatalf("test #%d: got error %v, want valid %v", i, err, test.valid)
+		}
+	}
+}
+
+func TestThresholdStateString(t *testing.T) {
+	for state := ThresholdDefined; state < numThresholdsStates; state++ {
+		if state.String() == "" || state.String()[:9] != "Threshold" {
+			t.Fatalf("no name for threshold state %d", state)
+		}
+	}
+	if ThresholdState(0xff).String() != "Unknown ThresholdState (255)" {
+		t.Fatal("unexpected name of an unknown threshold state")
+	}
+}
@@ -187,6 +187,14 @@ type BlockDAG struct {
 	getBlockId GetBlockId
 
 	db database.DB
+
+	// blocksLock protects the blocks map, since pruned blocks are loaded
+	// again on access, also by the concurrent maturity checks.
+	blocksLock sync.RWMutex
+
+	// The number of pruned blocks and of pruned blocks loaded again
+	pruned uint64
+	loaded uint64
 }
 
 // Acquire the name of DAG instance
@@ -249,16 +257,18 @@ func (bd *BlockDAG) AddBlock(b IBlockData) (*list.List, IBlock) {
 	//
 	block := Block{id: bd.blockTotal, hash: *b.GetHash(), layer: 0, status: StatusNone, mainParent: MaxId}
 
+	ib := bd.instance.CreateBlock(&block)
+	bd.blocksLock.Lock()
 	if bd.blocks == nil {
 		bd.blocks = map[uint]IBlock{}
 	}
-	ib := bd.instance.CreateBlock(&block)
 	bd.blocks[block.id] = ib
 	if bd.blockTotal == 0 {
 		bd.genesis = *block.GetHash()
 	}
-	//
+	// The total is read with the blocks by the loads of the pruned blocks.
 	bd.blockTotal++
+	bd.blocksLock.Unlock()
 
 	if len(parents) > 0 {
 		block.parents = NewIdSet()
@@ -350,6 +360,13 @@ func (bd *BlockDAG) getBlock(h *hash.Hash) IBlock {
 		return nil
 	}
 	id := bd.getBlockId(h)
+	if id == MaxId && bd.db != nil {
+		// The block may be pruned from the index of the chain.
+		bd.db.View(func(dbTx database.Tx) error {
+			id, _ = DBGetDAGBlockID(dbTx, h)
+			return nil
+		})
+	}
 	if id == MaxId {
 		return nil
 	}
@@ -369,8 +386,14 @@ func (bd *BlockDAG) getBlockById(id uint) IBlock {
 	if id == MaxId {
 		return nil
 	}
+	bd.blocksLock.RLock()
 	block, ok := bd.blocks[id]
+	pruned := id < bd.blockTotal && bd.pruned > 0
+	bd.blocksLock.RUnlock()
 	if !ok {
+		if pruned {
+			return bd.loadBlock(id)
+		}
 		return nil
 	}
 	return block
@@ -1154,6 +1177,14 @@ func (bd *BlockDAG) GetBlues(parents *IdSet) uint {
 	return bd.instance.GetBlues(parents)
 }
 
+// GetTipsBlues returns the blue score of a block building on all the tips
+func (bd *BlockDAG) GetTipsBlues() uint {
+	bd.stateLock.Lock()
+	defer bd.stateLock.Unlock()
+
+	return bd.instance.GetBlues(bd.tips)
+}
+
 // IsBlue
 func (bd *BlockDAG) IsBlue(id uint) bool {
 	bd.stateLock.Lock()
@@ -1319,7 +1350,7 @@ func (bd *BlockDAG) getMainFork(ib IBlock, backward bool) IBlock {
 			} else {
 				childList := cur.GetChildren().SortHashList(false)
 				for _, v := range childList {
-					ib := cur.GetChildren().Get(v).(IBlock)
+					ib := bd.getBlockById(v)
 					queue = append(queue, ib)
 				}
 			}
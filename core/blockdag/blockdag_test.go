@@ -1,6 +1,7 @@
 package blockdag
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"github.com/btceasypay/bitcoinpay/common/hash"
@@ -10,9 +11,11 @@ import (
 	l "github.com/btceasypay/bitcoinpay/log"
 	"github.com/btceasypay/bitcoinpay/params"
 	"io"
+	"io/ioutil"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"testing"
 	"time"
 )
 
@@ -351,6 +354,73 @@ func removeBlockDB(dbPath string) error {
 	return nil
 }
 
+// reloadBlockDAG stores the blocks and the DAG info of the test DAG in a new
+// database and loads them into a new block DAG, as a node does on restart.
+// The stored DAG info is replaced by legacyInfo when it is not nil.
+func reloadBlockDAG(t *testing.T, legacyInfo []byte) *BlockDAG {
+	dir, err := ioutil.TempDir("", "blockdag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := database.Create("ffldb", filepath.Join(dir, "db"), params.ActiveNetParams.Net)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rbd := &BlockDAG{}
+	rbd.Init(bd.instance.GetName(), CalcBlockWeight, -1, onGetBlockId, db)
+	err = db.Update(func(dbTx database.Tx) error {
+		for _, name := range [][]byte{dbnamespace.BlockIndexBucketName,
+			dbnamespace.DagBlockIdBucketName, dbnamespace.DagChildrenBucketName} {
+			_, err := dbTx.Metadata().CreateBucket(name)
+			if err != nil {
+				return err
+			}
+		}
+		for i := uint(0); i < bd.GetBlockTotal(); i++ {
+			err := DBPutDAGBlock(dbTx, bd.getBlockById(i))
+			if err != nil {
+				return err
+			}
+		}
+		if legacyInfo != nil {
+			return dbTx.Metadata().Put(dbnamespace.DagInfoBucketName, legacyInfo)
+		}
+		return DBPutDAGInfo(dbTx, &bd)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Update(func(dbTx database.Tx) error {
+		err := rbd.Load(dbTx, bd.GetBlockTotal(), bd.GetGenesisHash())
+		if err != nil {
+			return err
+		}
+		return rbd.UpgradeDB(dbTx)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The DAG info is stored in the current format after the upgrade.
+	var buff bytes.Buffer
+	if err := rbd.Encode(&buff); err != nil {
+		t.Fatal(err)
+	}
+	var upgraded bool
+	db.View(func(dbTx database.Tx) error {
+		upgraded = bytes.Equal(dbTx.Metadata().Get(dbnamespace.DagInfoBucketName), buff.Bytes())
+		return nil
+	})
+	if !upgraded {
+		t.Fatal("DAG info not upgraded")
+	}
+	return rbd
+}
+
 func exit() {
 	removeBlockDB("./blocks_ffldb")
 }
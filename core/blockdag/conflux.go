@@ -2,11 +2,27 @@ package blockdag
 
 import (
 	"container/list"
+	"fmt"
 	"github.com/btceasypay/bitcoinpay/common/hash"
+	s "github.com/btceasypay/bitcoinpay/core/serialization"
 	"github.com/btceasypay/bitcoinpay/database"
 	"io"
 )
 
+// confluxStateVersion is the version of the conflux state stored in the DAG
+// info.  The DAG info written before the state was versioned is empty.
+// Version 1 only stored the version, version 2 adds the weights, the order
+// and the privot tip.
+const confluxStateVersion = 2
+
+// confluxState is the state decoded from the DAG info, it's restored when the
+// blocks are loaded.
+type confluxState struct {
+	privotTip uint
+	weights   []uint64
+	order     []uint
+}
+
 type Epoch struct {
 	main    IBlock
 	depends []IBlock
@@ -50,6 +66,9 @@ type Conflux struct {
 	bd *BlockDAG
 
 	privotTip IBlock
+
+	// The state decoded from the DAG info until the blocks are loaded
+	state *confluxState
 }
 
 func (con *Conflux) GetName() string {
@@ -352,7 +371,7 @@ func (con *Conflux) IsOnMainChain(b IBlock) bool {
 
 // return the tip of main chain
 func (con *Conflux) GetMainChainTip() IBlock {
-	return nil
+	return con.privotTip
 }
 
 // return the main parent in the parents
@@ -362,15 +381,116 @@ func (con *Conflux) GetMainParent(parents *IdSet) IBlock {
 
 // encode
 func (con *Conflux) Encode(w io.Writer) error {
+	err := s.WriteElements(w, byte(confluxStateVersion))
+	if err != nil {
+		return err
+	}
+	privotTip := uint32(MaxId)
+	if con.privotTip != nil {
+		privotTip = uint32(con.privotTip.GetID())
+	}
+	err = s.WriteElements(w, privotTip, uint32(con.bd.blockTotal))
+	if err != nil {
+		return err
+	}
+	for i := uint(0); i < con.bd.blockTotal; i++ {
+		ib := con.bd.getBlockById(i)
+		if ib == nil {
+			return fmt.Errorf("conflux block %d is missing", i)
+		}
+		err = s.WriteElements(w, ib.GetWeight(), uint32(con.bd.order[i]))
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 // decode
 func (con *Conflux) Decode(r io.Reader) error {
+	con.state = nil
+	var version byte
+	err := s.ReadElements(r, &version)
+	if err == io.EOF {
+		// Stored before the state was versioned, it is rewritten by UpgradeDB.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if version > confluxStateVersion {
+		return fmt.Errorf("unknown conflux state version %d", version)
+	}
+	if version < confluxStateVersion {
+		// The weights weren't stored, they are recalculated.
+		return nil
+	}
+	var privotTip, blockTotal uint32
+	err = s.ReadElements(r, &privotTip, &blockTotal)
+	if err != nil {
+		return err
+	}
+	state := &confluxState{
+		privotTip: uint(privotTip),
+		weights:   make([]uint64, blockTotal),
+		order:     make([]uint, blockTotal),
+	}
+	for i := uint32(0); i < blockTotal; i++ {
+		var order uint32
+		err = s.ReadElements(r, &state.weights[i], &order)
+		if err != nil {
+			return err
+		}
+		state.order[i] = uint(order)
+	}
+	con.state = state
 	return nil
 }
 
+// Load the blocks of the DAG and restore the weights, the order and the
+// privot tip decoded from the DAG info.  They weren't stored by the older
+// versions, and the DAG info is only written from time to time, so they are
+// recalculated the same way they were when the blocks were added unless they
+// were stored with the same blocks.
 func (con *Conflux) Load(dbTx database.Tx) error {
+	con.privotTip = nil
+	state := con.state
+	con.state = nil
+	if state != nil && uint(len(state.weights)) != con.bd.blockTotal {
+		log.Warn(fmt.Sprintf("The conflux state has %d blocks, but there are %d. Recalculate it.",
+			len(state.weights), con.bd.blockTotal))
+		state = nil
+	}
+	err := dbLoadDAGBlocks(dbTx, con.bd, func(ib IBlock) {
+		if state != nil {
+			ib.SetWeight(state.weights[ib.GetID()])
+			return
+		}
+		ib.SetWeight(0)
+		con.updatePrivot(ib)
+	})
+	if err != nil {
+		return err
+	}
+	con.bd.order = map[uint]uint{}
+	if con.bd.blockTotal == 0 {
+		return nil
+	}
+	if state == nil {
+		con.updateMainChain(con.bd.getGenesis(), nil, nil)
+		return nil
+	}
+	for order, id := range state.order {
+		ib := con.bd.getBlockById(id)
+		if ib == nil {
+			return fmt.Errorf("conflux order %d misses block %d", order, id)
+		}
+		ib.SetOrder(uint(order))
+		con.bd.order[uint(order)] = id
+	}
+	if state.privotTip != MaxId {
+		con.privotTip = con.bd.getBlockById(state.privotTip)
+	}
 	return nil
 }
 
@@ -37,3 +37,33 @@ func Test_GetOrder(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func Test_ConfluxReload(t *testing.T) {
+	ibd := InitBlockDAG(conflux, "CO_Blocks")
+	if ibd == nil {
+		t.FailNow()
+	}
+	con := ibd.(*Conflux)
+	dagType := []byte{GetDAGTypeIndex(conflux)}
+	for _, legacyInfo := range [][]byte{nil, dagType} {
+		rbd := reloadBlockDAG(t, legacyInfo)
+		rcon := rbd.instance.(*Conflux)
+		if !rbd.tips.IsEqual(bd.tips) {
+			t.Fatalf("reloaded tips %v, want %v", rbd.tips.List(), bd.tips.List())
+		}
+		if !rcon.GetMainChainTip().GetHash().IsEqual(con.GetMainChainTip().GetHash()) {
+			t.Fatal("reloaded privot tip is not the same")
+		}
+		if !processResult(rcon.GetMainChain(), con.GetMainChain()) {
+			t.FailNow()
+		}
+		for i := uint(0); i < bd.GetBlockTotal(); i++ {
+			if rbd.order[i] != bd.order[i] {
+				t.Fatalf("reloaded order %d is block %d, want %d", i, rbd.order[i], bd.order[i])
+			}
+			if rbd.getBlockById(i).GetWeight() != bd.getBlockById(i).GetWeight() {
+				t.Fatalf("reloaded weight of block %d is not the same", i)
+			}
+		}
+	}
+}
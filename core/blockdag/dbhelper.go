@@ -3,6 +3,7 @@ package blockdag
 import (
 	"bytes"
 	"fmt"
+	"github.com/btceasypay/bitcoinpay/common/hash"
 	"github.com/btceasypay/bitcoinpay/core/dbnamespace"
 	"github.com/btceasypay/bitcoinpay/database"
 )
@@ -21,7 +22,79 @@ func DBPutDAGBlock(dbTx database.Tx, block IBlock) error {
 	if err != nil {
 		return err
 	}
-	return bucket.Put(key, buff.Bytes())
+	err = bucket.Put(key, buff.Bytes())
+	if err != nil {
+		return err
+	}
+	return dbPutDAGBlockIndex(dbTx, block)
+}
+
+// dbPutDAGBlockIndex stores the block hash to id mapping and the block as a
+// child of its parents, so pruned blocks can be loaded again by hash and with
+// their children.
+func dbPutDAGBlockIndex(dbTx database.Tx, block IBlock) error {
+	meta := dbTx.Metadata()
+	idBucket := meta.Bucket(dbnamespace.DagBlockIdBucketName)
+	if idBucket == nil {
+		return fmt.Errorf("no %s", string(dbnamespace.DagBlockIdBucketName))
+	}
+	var serializedID [4]byte
+	dbnamespace.ByteOrder.PutUint32(serializedID[:], uint32(block.GetID()))
+	err := idBucket.Put(block.GetHash()[:], serializedID[:])
+	if err != nil {
+		return err
+	}
+	if !block.HasParents() {
+		return nil
+	}
+	childrenBucket := meta.Bucket(dbnamespace.DagChildrenBucketName)
+	if childrenBucket == nil {
+		return fmt.Errorf("no %s", string(dbnamespace.DagChildrenBucketName))
+	}
+	var key [8]byte
+	dbnamespace.ByteOrder.PutUint32(key[4:], uint32(block.GetID()))
+	for parent := range block.GetParents().GetMap() {
+		dbnamespace.ByteOrder.PutUint32(key[:4], uint32(parent))
+		err := childrenBucket.Put(key[:], []byte{0})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DBGetDAGBlockID returns the id of the DAG block with the hash.
+func DBGetDAGBlockID(dbTx database.Tx, h *hash.Hash) (uint, bool) {
+	bucket := dbTx.Metadata().Bucket(dbnamespace.DagBlockIdBucketName)
+	if bucket == nil {
+		return MaxId, false
+	}
+	data := bucket.Get(h[:])
+	if data == nil {
+		return MaxId, false
+	}
+	return uint(dbnamespace.ByteOrder.Uint32(data)), true
+}
+
+// DBGetDAGChildren returns the ids of the children of the DAG block.
+func DBGetDAGChildren(dbTx database.Tx, id uint) []uint {
+	bucket := dbTx.Metadata().Bucket(dbnamespace.DagChildrenBucketName)
+	if bucket == nil {
+		return nil
+	}
+	var prefix [4]byte
+	dbnamespace.ByteOrder.PutUint32(prefix[:], uint32(id))
+
+	var children []uint
+	cursor := bucket.Cursor()
+	for ok := cursor.Seek(prefix[:]); ok; ok = cursor.Next() {
+		key := cursor.Key()
+		if len(key) != 8 || !bytes.Equal(key[:4], prefix[:]) {
+			break
+		}
+		children = append(children, uint(dbnamespace.ByteOrder.Uint32(key[4:])))
+	}
+	return children
 }
 
 // DBGetDAGBlock get dag block data by resouce ID
@@ -80,3 +153,38 @@ func DBRemoveMainChainBlock(dbTx database.Tx, id uint) error {
 	key := serializedID[:]
 	return bucket.Delete(key)
 }
+
+// dbLoadDAGBlocks loads the blocks of the DAG in the order they were added,
+// links them to their parents and updates the tips.  The loaded function is
+// called with every block once it is linked.
+func dbLoadDAGBlocks(dbTx database.Tx, bd *BlockDAG, loaded func(ib IBlock)) error {
+	for i := uint(0); i < bd.blockTotal; i++ {
+		block := Block{id: i}
+		ib := bd.instance.CreateBlock(&block)
+		err := DBGetDAGBlock(dbTx, ib)
+		if err != nil {
+			return err
+		}
+		if i == 0 && !ib.GetHash().IsEqual(bd.GetGenesisHash()) {
+			return fmt.Errorf("genesis data mismatch")
+		}
+		// Make up for missing
+		if ib.HasParents() {
+			parentsSet := NewIdSet()
+			for k := range ib.GetParents().GetMap() {
+				parent := bd.getBlockById(k)
+				if parent == nil {
+					return fmt.Errorf("dag block %d misses parent %d", i, k)
+				}
+				parentsSet.AddPair(k, parent)
+				parent.AddChild(ib)
+			}
+			ib.GetParents().Clean()
+			ib.GetParents().AddSet(parentsSet)
+		}
+		bd.blocks[ib.GetID()] = ib
+		bd.updateTips(ib)
+		loaded(ib)
+	}
+	return nil
+}
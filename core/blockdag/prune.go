@@ -0,0 +1,324 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+
+package blockdag
+
+import (
+	"fmt"
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/database"
+	"io"
+)
+
+// prunedBlock stands in for a block which was pruned from memory in the
+// parents and children of the blocks still in memory.  It keeps the fields
+// which don't change once a block is ordered deep enough to be pruned, the
+// parents, children and status are read from the block loaded again from the
+// database.  The blocks pruned are never the genesis nor the tips, so they
+// always have parents and children.
+type prunedBlock struct {
+	bd         *BlockDAG
+	id         uint
+	hash       hash.Hash
+	mainParent uint
+	weight     uint64
+	order      uint
+	layer      uint
+	height     uint
+}
+
+func newPrunedBlock(bd *BlockDAG, ib IBlock) *prunedBlock {
+	return &prunedBlock{
+		bd:         bd,
+		id:         ib.GetID(),
+		hash:       *ib.GetHash(),
+		mainParent: ib.GetMainParent(),
+		weight:     ib.GetWeight(),
+		order:      ib.GetOrder(),
+		layer:      ib.GetLayer(),
+		height:     ib.GetHeight(),
+	}
+}
+
+// block returns the block loaded again from the database.  The failure is
+// logged by loadBlock.
+func (pb *prunedBlock) block() (IBlock, error) {
+	ib := pb.bd.getBlockById(pb.id)
+	if ib == nil {
+		return nil, fmt.Errorf("pruned dag block %d can't be loaded", pb.id)
+	}
+	return ib, nil
+}
+
+func (pb *prunedBlock) GetID() uint {
+	return pb.id
+}
+
+func (pb *prunedBlock) GetHash() *hash.Hash {
+	return &pb.hash
+}
+
+func (pb *prunedBlock) GetLayer() uint {
+	return pb.layer
+}
+
+func (pb *prunedBlock) SetOrder(o uint) {
+	pb.order = o
+	if ib, err := pb.block(); err == nil {
+		ib.SetOrder(o)
+	}
+}
+
+func (pb *prunedBlock) GetOrder() uint {
+	return pb.order
+}
+
+func (pb *prunedBlock) IsOrdered() bool {
+	return pb.order != MaxBlockOrder
+}
+
+func (pb *prunedBlock) GetParents() *IdSet {
+	ib, err := pb.block()
+	if err != nil {
+		return NewIdSet()
+	}
+	return ib.GetParents()
+}
+
+func (pb *prunedBlock) HasParents() bool {
+	return true
+}
+
+func (pb *prunedBlock) AddChild(child IBlock) {
+	if ib, err := pb.block(); err == nil {
+		ib.AddChild(child)
+	}
+}
+
+func (pb *prunedBlock) GetChildren() *IdSet {
+	ib, err := pb.block()
+	if err != nil {
+		return NewIdSet()
+	}
+	return ib.GetChildren()
+}
+
+func (pb *prunedBlock) HasChildren() bool {
+	return true
+}
+
+func (pb *prunedBlock) GetMainParent() uint {
+	return pb.mainParent
+}
+
+func (pb *prunedBlock) SetWeight(weight uint64) {
+	pb.weight = weight
+	if ib, err := pb.block(); err == nil {
+		ib.SetWeight(weight)
+	}
+}
+
+func (pb *prunedBlock) GetWeight() uint64 {
+	return pb.weight
+}
+
+func (pb *prunedBlock) GetHeight() uint {
+	return pb.height
+}
+
+func (pb *prunedBlock) SetStatus(status BlockStatus) {
+	if ib, err := pb.block(); err == nil {
+		ib.SetStatus(status)
+	}
+}
+
+func (pb *prunedBlock) GetStatus() BlockStatus {
+	ib, err := pb.block()
+	if err != nil {
+		return StatusNone
+	}
+	return ib.GetStatus()
+}
+
+func (pb *prunedBlock) Encode(w io.Writer) error {
+	ib, err := pb.block()
+	if err != nil {
+		return err
+	}
+	return ib.Encode(w)
+}
+
+func (pb *prunedBlock) Decode(r io.Reader) error {
+	ib, err := pb.block()
+	if err != nil {
+		return err
+	}
+	return ib.Decode(r)
+}
+
+// PruneStats describes the DAG blocks held in memory and the ones pruned.
+type PruneStats struct {
+	// The number of blocks in memory
+	Blocks int
+
+	// The number of blocks pruned from memory so far
+	Pruned uint64
+
+	// The number of pruned blocks loaded again from the database
+	Loaded uint64
+}
+
+// GetPruneStats returns the statistics of the DAG blocks in memory.
+func (bd *BlockDAG) GetPruneStats() PruneStats {
+	bd.blocksLock.RLock()
+	defer bd.blocksLock.RUnlock()
+
+	return PruneStats{
+		Blocks: len(bd.blocks),
+		Pruned: bd.pruned,
+		Loaded: bd.loaded,
+	}
+}
+
+// Prune removes from memory the ordered blocks whose main height is more than
+// depth below the main chain tip.  They are written to the database first and
+// loaded again when accessed.  Only the phantom DAG is pruned, the other
+// algorithms walk the whole DAG for every block.  It returns the number of
+// pruned blocks.
+func (bd *BlockDAG) Prune(depth uint) (int, error) {
+	bd.stateLock.Lock()
+	defer bd.stateLock.Unlock()
+
+	if bd.db == nil || bd.instance.GetName() != phantom {
+		return 0, nil
+	}
+	mainTip := bd.getMainChainTip()
+	if mainTip == nil || mainTip.GetHeight() <= depth {
+		return 0, nil
+	}
+	maxHeight := mainTip.GetHeight() - depth
+
+	bd.blocksLock.RLock()
+	pruned := []IBlock{}
+	for id, ib := range bd.blocks {
+		if id == 0 || bd.tips.Has(id) || !ib.IsOrdered() ||
+			ib.GetHeight() >= maxHeight {
+			continue
+		}
+		pruned = append(pruned, ib)
+	}
+	bd.blocksLock.RUnlock()
+	if len(pruned) == 0 {
+		return 0, nil
+	}
+
+	// The stored blocks may miss changes made in memory, e.g. of the order.
+	err := bd.db.Update(func(dbTx database.Tx) error {
+		for _, ib := range pruned {
+			err := DBPutDAGBlock(dbTx, ib)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	bd.blocksLock.Lock()
+	for _, ib := range pruned {
+		delete(bd.blocks, ib.GetID())
+	}
+	// The blocks left in memory must not reference the pruned blocks, so
+	// these are freed to the garbage collector.
+	for _, ib := range pruned {
+		stub := newPrunedBlock(bd, ib)
+		if ib.HasParents() {
+			for k := range ib.GetParents().GetMap() {
+				if parent, ok := bd.blocks[k]; ok {
+					parent.GetChildren().AddPair(stub.id, stub)
+				}
+			}
+		}
+		if ib.HasChildren() {
+			for k := range ib.GetChildren().GetMap() {
+				if child, ok := bd.blocks[k]; ok {
+					child.GetParents().AddPair(stub.id, stub)
+				}
+			}
+		}
+	}
+	bd.pruned += uint64(len(pruned))
+	bd.blocksLock.Unlock()
+	return len(pruned), nil
+}
+
+// loadBlock loads the pruned block with the id from the database and keeps
+// it in memory until the next pruning.  It holds the lock of the blocks from
+// the lookup to the caching, so the block is only loaded once and every
+// caller gets the same block.  Its parents and children in memory are linked
+// to it, the ones not in memory are linked as pruned blocks and loaded when
+// accessed too.
+func (bd *BlockDAG) loadBlock(id uint) IBlock {
+	bd.blocksLock.Lock()
+	defer bd.blocksLock.Unlock()
+	if block, ok := bd.blocks[id]; ok {
+		return block
+	}
+	if id >= bd.blockTotal {
+		return nil
+	}
+
+	ib := bd.instance.CreateBlock(&Block{id: id})
+	var children []uint
+	stubs := map[uint]*prunedBlock{}
+	err := bd.db.View(func(dbTx database.Tx) error {
+		err := DBGetDAGBlock(dbTx, ib)
+		if err != nil {
+			return err
+		}
+		children = DBGetDAGChildren(dbTx, id)
+		// The parents and children not in memory are pruned as well.
+		linked := append([]uint{}, children...)
+		if ib.HasParents() {
+			linked = append(linked, ib.GetParents().List()...)
+		}
+		for _, k := range linked {
+			if _, ok := bd.blocks[k]; ok {
+				continue
+			}
+			b := &Block{id: k}
+			err := DBGetDAGBlock(dbTx, b)
+			if err != nil {
+				return err
+			}
+			stubs[k] = newPrunedBlock(bd, b)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error(fmt.Sprintf("Failed to load pruned dag block %d: %v", id, err))
+		return nil
+	}
+	if ib.HasParents() {
+		for k := range ib.GetParents().GetMap() {
+			if parent, ok := bd.blocks[k]; ok {
+				ib.GetParents().AddPair(k, parent)
+				parent.AddChild(ib)
+				continue
+			}
+			ib.GetParents().AddPair(k, stubs[k])
+		}
+	}
+	for _, k := range children {
+		if child, ok := bd.blocks[k]; ok {
+			ib.AddChild(child)
+			child.GetParents().AddPair(id, ib)
+			continue
+		}
+		ib.AddChild(stubs[k])
+	}
+	bd.blocks[id] = ib
+	bd.loaded++
+	return ib
+}
@@ -0,0 +1,240 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+
+package blockdag
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/btceasypay/bitcoinpay/core/dbnamespace"
+	"github.com/btceasypay/bitcoinpay/database"
+	"github.com/btceasypay/bitcoinpay/params"
+)
+
+// tipIds returns the ids of the tips of the test DAG.
+func tipIds() *IdSet {
+	tips := NewIdSet()
+	if bd.GetBlockTotal() > 0 {
+		for _, tip := range bd.GetTipsList() {
+			tips.Add(tip.GetID())
+		}
+	}
+	return tips
+}
+
+// addStoredBlock adds a block with the parents to the DAG and stores it, as
+// the chain does for every new block.
+func addStoredBlock(t *testing.T, db database.DB, tag string, parents *IdSet) IBlock {
+	l, ib := bd.AddBlock(buildBlock(parents))
+	if l == nil || l.Len() == 0 {
+		t.Fatalf("block %s not added", tag)
+	}
+	tbMap[tag] = ib
+	err := db.Update(func(dbTx database.Tx) error {
+		return DBPutDAGBlock(dbTx, ib)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ib
+}
+
+func equalIds(a, b []uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPrune(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blockdag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := database.Create("ffldb", filepath.Join(dir, "db"), params.ActiveNetParams.Net)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	err = db.Update(func(dbTx database.Tx) error {
+		for _, name := range [][]byte{dbnamespace.BlockIndexBucketName,
+			dbnamespace.DagMainChainBucketName, dbnamespace.DagBlockIdBucketName,
+			dbnamespace.DagChildrenBucketName} {
+			_, err := dbTx.Metadata().CreateBucket(name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A long DAG with two blocks at every height.
+	bd = BlockDAG{}
+	bd.Init(phantom, CalcBlockWeight, -1, onGetBlockId, db)
+	tbMap = map[string]IBlock{}
+	addStoredBlock(t, db, "G", tipIds())
+	for i := 0; i < 150; i++ {
+		parents := tipIds()
+		addStoredBlock(t, db, fmt.Sprintf("A%d", i), parents)
+		addStoredBlock(t, db, fmt.Sprintf("B%d", i), parents)
+	}
+
+	type blockState struct {
+		order         uint
+		mainParent    uint
+		parents       []uint
+		children      []uint
+		onMainChain   bool
+		confirmations uint
+	}
+	stateOf := func(id uint) blockState {
+		ib := bd.GetBlockById(id)
+		s := blockState{
+			order:         ib.GetOrder(),
+			mainParent:    ib.GetMainParent(),
+			onMainChain:   bd.IsOnMainChain(id),
+			confirmations: bd.GetConfirmations(id),
+		}
+		if ib.HasParents() {
+			s.parents = ib.GetParents().SortList(false)
+		}
+		if ib.HasChildren() {
+			s.children = ib.GetChildren().SortList(false)
+		}
+		return s
+	}
+	total := bd.GetBlockTotal()
+	want := make([]blockState, total)
+	for id := uint(0); id < total; id++ {
+		want[id] = stateOf(id)
+	}
+	mainTip := bd.GetMainChainTip()
+
+	n, err := bd.Prune(StableConfirmations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := bd.GetPruneStats()
+	if n == 0 || stats.Blocks != int(total)-n || stats.Pruned != uint64(n) {
+		t.Fatalf("pruned %d blocks, %d of %d left in memory", n, stats.Blocks, total)
+	}
+
+	// The blocks in memory link to the pruned blocks, whose fixed fields are
+	// kept without the database and whose links are empty when they can't
+	// be loaded.
+	var stub *prunedBlock
+	bd.blocksLock.RLock()
+	for _, ib := range bd.blocks {
+		if !ib.HasParents() {
+			continue
+		}
+		for _, parent := range ib.GetParents().GetMap() {
+			if pb, ok := parent.(*prunedBlock); ok {
+				stub = pb
+			}
+		}
+	}
+	bd.blocksLock.RUnlock()
+	if stub == nil {
+		t.Fatal("no block in memory links to a pruned block")
+	}
+	var key [4]byte
+	dbnamespace.ByteOrder.PutUint32(key[:], uint32(stub.id))
+	var stored []byte
+	err = db.Update(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(dbnamespace.BlockIndexBucketName)
+		stored = append([]byte{}, bucket.Get(key[:])...)
+		return bucket.Delete(key[:])
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stub.GetHash().IsEqual(tbMap[getBlockTag(stub.id)].GetHash()) ||
+		stub.GetOrder() != want[stub.id].order ||
+		stub.GetMainParent() != want[stub.id].mainParent {
+		t.Fatalf("pruned block %d changed", stub.id)
+	}
+	if !stub.GetParents().IsEmpty() || !stub.GetChildren().IsEmpty() {
+		t.Fatalf("got the links of pruned block %d which can't be loaded", stub.id)
+	}
+	err = db.Update(func(dbTx database.Tx) error {
+		return dbTx.Metadata().Bucket(dbnamespace.BlockIndexBucketName).Put(key[:], stored)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A pruned block is loaded once, the concurrent lookups get the same
+	// block and the blocks in memory link to it.
+	var wg sync.WaitGroup
+	loaded := make([]IBlock, 8)
+	for i := range loaded {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			loaded[i] = bd.getBlockById(1)
+		}(i)
+	}
+	wg.Wait()
+	for _, ib := range loaded {
+		if ib == nil || ib != loaded[0] {
+			t.Fatal("pruned block 1 loaded more than once")
+		}
+	}
+	for k := range loaded[0].GetChildren().GetMap() {
+		child := bd.getBlockById(k)
+		if child.GetParents().Get(1) != loaded[0] {
+			t.Fatalf("child %d of the loaded block doesn't link to it", k)
+		}
+	}
+	if bd.getBlockById(1) != loaded[0] {
+		t.Fatal("loaded block 1 not kept in memory")
+	}
+
+	// The pruned blocks are loaded again as they are accessed.
+	for id := uint(0); id < total; id++ {
+		got := stateOf(id)
+		if got.order != want[id].order || got.mainParent != want[id].mainParent ||
+			got.onMainChain != want[id].onMainChain ||
+			got.confirmations != want[id].confirmations ||
+			!equalIds(got.parents, want[id].parents) ||
+			!equalIds(got.children, want[id].children) {
+			t.Fatalf("block %d changed by the pruning: got %v, want %v", id, got, want[id])
+		}
+		h := tbMap[getBlockTag(id)].GetHash()
+		if ib := bd.GetBlock(h); ib == nil || ib.GetID() != id {
+			t.Fatalf("block %d not found by hash", id)
+		}
+	}
+	if bd.GetMainChainTip().GetID() != mainTip.GetID() {
+		t.Fatal("main chain tip changed by the pruning")
+	}
+	if bd.GetPruneStats().Loaded == 0 {
+		t.Fatal("no pruned block loaded")
+	}
+
+	// The DAG keeps growing on top of the pruned blocks.
+	for i := 0; i < 20; i++ {
+		addStoredBlock(t, db, fmt.Sprintf("N%d", i), tipIds())
+	}
+	if bd.GetBlockTotal() != total+20 ||
+		bd.GetMainChainTip().GetHeight() <= mainTip.GetHeight() {
+		t.Fatal("blocks not added after the pruning")
+	}
+	if _, err := bd.Prune(StableConfirmations); err != nil {
+		t.Fatal(err)
+	}
+}
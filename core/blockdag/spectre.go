@@ -5,12 +5,30 @@ import (
 	"fmt"
 	"github.com/btceasypay/bitcoinpay/common/hash"
 	"github.com/btceasypay/bitcoinpay/common/util"
+	s "github.com/btceasypay/bitcoinpay/core/serialization"
 	"github.com/btceasypay/bitcoinpay/database"
 	"github.com/golang-collections/collections/stack"
 	"io"
 	"strconv"
 )
 
+// spectreStateVersion is the version of the spectre state stored in the DAG
+// info.  The DAG info written before the state was versioned is empty.
+// Version 1 only stored the version, version 2 adds the votes and version 3
+// adds the number of blocks and only keeps the votes of the blocks which were
+// voted on.
+const spectreStateVersion = 3
+
+// spectreState is the voting state decoded from the DAG info, it's restored
+// when the blocks are loaded.
+type spectreState struct {
+	blockTotal uint
+	candidates [2]hash.Hash
+	votes      map[hash.Hash]bool
+	dangling   *HashSet
+	sblocks    map[hash.Hash]SpectreBlock
+}
+
 type Spectre struct {
 	// The general foundation framework of DAG
 	bd *BlockDAG
@@ -27,6 +45,9 @@ type Spectre struct {
 
 	// The votes of block
 	sblocks map[hash.Hash]*SpectreBlock
+
+	// The state decoded from the DAG info until the blocks are loaded
+	state *spectreState
 }
 
 func (sp *Spectre) GetName() string {
@@ -823,15 +844,190 @@ func (sp *Spectre) GetMainParent(parents *IdSet) IBlock {
 
 // encode
 func (sp *Spectre) Encode(w io.Writer) error {
+	err := s.WriteElements(w, byte(spectreStateVersion), uint32(sp.bd.blockTotal))
+	if err != nil {
+		return err
+	}
+	// candidates, the zero hash when there is none
+	for _, c := range []IBlock{sp.candidate1, sp.candidate2} {
+		var h hash.Hash
+		if c != nil {
+			h = *c.GetHash()
+		}
+		err = s.WriteElements(w, &h)
+		if err != nil {
+			return err
+		}
+	}
+	// votes
+	voters := NewHashSet()
+	for h := range sp.votes {
+		voter := h
+		voters.Add(&voter)
+	}
+	err = s.WriteElements(w, uint32(voters.Size()))
+	if err != nil {
+		return err
+	}
+	for _, h := range voters.SortList(false) {
+		err = s.WriteElements(w, h, sp.votes[*h])
+		if err != nil {
+			return err
+		}
+	}
+	// dangling
+	err = s.WriteElements(w, uint32(sp.dangling.Size()))
+	if err != nil {
+		return err
+	}
+	for _, h := range sp.dangling.SortList(false) {
+		err = s.WriteElements(w, h)
+		if err != nil {
+			return err
+		}
+	}
+	// votes of the blocks, the blocks which weren't voted on get their
+	// initial votes back when they are loaded
+	sblocks := NewHashSet()
+	for h, sb := range sp.sblocks {
+		if sb.Votes1 < 0 && sb.Votes2 < 0 {
+			continue
+		}
+		voted := h
+		sblocks.Add(&voted)
+	}
+	err = s.WriteElements(w, uint32(sblocks.Size()))
+	if err != nil {
+		return err
+	}
+	for _, h := range sblocks.SortList(false) {
+		sb := sp.sblocks[*h]
+		err = s.WriteElements(w, h, int32(sb.Votes1), int32(sb.Votes2))
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 // decode
 func (sp *Spectre) Decode(r io.Reader) error {
+	sp.state = nil
+	var version byte
+	err := s.ReadElements(r, &version)
+	if err == io.EOF {
+		// Stored before the state was versioned, it is rewritten by UpgradeDB.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if version > spectreStateVersion {
+		return fmt.Errorf("unknown spectre state version %d", version)
+	}
+	if version < spectreStateVersion {
+		// The votes weren't stored, they are counted again.
+		return nil
+	}
+	var blockTotal uint32
+	err = s.ReadElements(r, &blockTotal)
+	if err != nil {
+		return err
+	}
+	state := &spectreState{
+		blockTotal: uint(blockTotal),
+		votes:      make(map[hash.Hash]bool),
+		dangling:   NewHashSet(),
+		sblocks:    map[hash.Hash]SpectreBlock{},
+	}
+	for i := range state.candidates {
+		err = s.ReadElements(r, &state.candidates[i])
+		if err != nil {
+			return err
+		}
+	}
+	var size uint32
+	err = s.ReadElements(r, &size)
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < size; i++ {
+		var voter hash.Hash
+		var vote bool
+		err = s.ReadElements(r, &voter, &vote)
+		if err != nil {
+			return err
+		}
+		state.votes[voter] = vote
+	}
+	err = s.ReadElements(r, &size)
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < size; i++ {
+		var h hash.Hash
+		err = s.ReadElements(r, &h)
+		if err != nil {
+			return err
+		}
+		state.dangling.Add(&h)
+	}
+	err = s.ReadElements(r, &size)
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < size; i++ {
+		var h hash.Hash
+		var votes1, votes2 int32
+		err = s.ReadElements(r, &h, &votes1, &votes2)
+		if err != nil {
+			return err
+		}
+		state.sblocks[h] = SpectreBlock{hash: h, Votes1: int(votes1), Votes2: int(votes2)}
+	}
+	sp.state = state
 	return nil
 }
 
+// Load the blocks of the DAG and restore the votes decoded from the DAG info.
+// The votes weren't stored by the older versions, and the DAG info is only
+// written from time to time, so the votes are counted again when the blocks
+// are voted on unless they were stored with the same blocks.
 func (sp *Spectre) Load(dbTx database.Tx) error {
+	sp.sblocks = map[hash.Hash]*SpectreBlock{}
+	sp.votes = make(map[hash.Hash]bool)
+	sp.dangling = NewHashSet()
+	sp.candidate1, sp.candidate2 = nil, nil
+	state := sp.state
+	sp.state = nil
+	if state != nil && state.blockTotal != sp.bd.blockTotal {
+		log.Warn(fmt.Sprintf("The spectre state has %d blocks, but there are %d. Count the votes again.",
+			state.blockTotal, sp.bd.blockTotal))
+		state = nil
+	}
+	err := dbLoadDAGBlocks(dbTx, sp.bd, func(ib IBlock) {
+		sp.AddBlock(ib)
+		if state == nil {
+			return
+		}
+		if sb, ok := state.sblocks[*ib.GetHash()]; ok {
+			sp.sblocks[sb.hash].Votes1 = sb.Votes1
+			sp.sblocks[sb.hash].Votes2 = sb.Votes2
+		}
+		if ib.GetHash().IsEqual(&state.candidates[0]) {
+			sp.candidate1 = ib
+		}
+		if ib.GetHash().IsEqual(&state.candidates[1]) {
+			sp.candidate2 = ib
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if state != nil {
+		sp.votes = state.votes
+		sp.dangling = state.dangling
+	}
 	return nil
 }
 
@@ -1,8 +1,11 @@
 package blockdag
 
 import (
+	"bytes"
 	"fmt"
+	"reflect"
 	"sort"
+	"testing"
 )
 
 func Log(sp *Spectre) {
@@ -40,3 +43,89 @@ func TestSpectre1(t *testing.T) {
 		}
 	}
 }*/
+
+func TestSpectreReload(t *testing.T) {
+	ibd := InitBlockDAG(spectre, "SP_Blocks")
+	if ibd == nil {
+		t.FailNow()
+	}
+	sp := ibd.(*Spectre)
+	dagType := []byte{GetDAGTypeIndex(spectre)}
+	for _, legacyInfo := range [][]byte{dagType, nil} {
+		if legacyInfo == nil {
+			// Vote so there are votes to store, the legacy DAG info
+			// has none.
+			b1, b2 := bd.getBlockById(1), bd.getBlockById(2)
+			sp.candidate1, sp.candidate2 = b1, b2
+			sp.voteFirst(*b1.GetHash())
+			sp.voteSecond(*b2.GetHash())
+			sp.dangling.Add(bd.getBlockById(3).GetHash())
+			sp.sblocks[*b1.GetHash()].Votes1 = 1
+			sp.sblocks[*b2.GetHash()].Votes2 = 2
+		}
+		rbd := reloadBlockDAG(t, legacyInfo)
+		rsp := rbd.instance.(*Spectre)
+		if rbd.GetBlockTotal() != bd.GetBlockTotal() || len(rsp.sblocks) != len(sp.sblocks) {
+			t.Fatalf("reloaded %d blocks, want %d", rbd.GetBlockTotal(), bd.GetBlockTotal())
+		}
+		if !rbd.tips.IsEqual(bd.tips) {
+			t.Fatalf("reloaded tips %v, want %v", rbd.tips.List(), bd.tips.List())
+		}
+		for i := uint(0); i < bd.GetBlockTotal(); i++ {
+			rb, b := rbd.getBlockById(i), bd.getBlockById(i)
+			if !rb.GetHash().IsEqual(b.GetHash()) || rb.HasParents() != b.HasParents() ||
+				(b.HasParents() && !rb.GetParents().IsEqual(b.GetParents())) ||
+				rb.HasChildren() != b.HasChildren() {
+				t.Fatalf("reloaded block %d is not the same", i)
+			}
+		}
+		if legacyInfo != nil {
+			continue
+		}
+		if !reflect.DeepEqual(rsp.votes, sp.votes) || !rsp.dangling.IsEqual(sp.dangling) {
+			t.Fatalf("reloaded votes %v, want %v", rsp.votes, sp.votes)
+		}
+		if rsp.candidate1 == nil || rsp.candidate2 == nil ||
+			!rsp.candidate1.GetHash().IsEqual(sp.candidate1.GetHash()) ||
+			!rsp.candidate2.GetHash().IsEqual(sp.candidate2.GetHash()) {
+			t.Fatal("reloaded candidates are not the same")
+		}
+		for h, sb := range sp.sblocks {
+			if *rsp.sblocks[h] != *sb {
+				t.Fatalf("reloaded votes of block %s are %v, want %v", h, rsp.sblocks[h], sb)
+			}
+		}
+	}
+
+	// Only the blocks which were voted on keep their votes in the DAG info.
+	var info bytes.Buffer
+	if err := bd.Encode(&info); err != nil {
+		t.Fatal(err)
+	}
+	decoded := &Spectre{bd: &BlockDAG{}}
+	if err := decoded.Decode(bytes.NewReader(info.Bytes()[1:])); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.state.sblocks) != 2 {
+		t.Fatalf("stored the votes of %d blocks, want 2", len(decoded.state.sblocks))
+	}
+
+	// The state stored with fewer blocks is stale, the votes are counted
+	// again.
+	bd.blockTotal--
+	info.Reset()
+	err := bd.Encode(&info)
+	bd.blockTotal++
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp := reloadBlockDAG(t, info.Bytes()).instance.(*Spectre)
+	if len(rsp.votes) != 0 || rsp.candidate1 != nil || rsp.candidate2 != nil {
+		t.Fatalf("restored the stale votes %v", rsp.votes)
+	}
+	for h, sb := range rsp.sblocks {
+		if sb.Votes1 != -1 || sb.Votes2 != -1 {
+			t.Fatalf("restored the stale votes of block %s: %v", h, sb)
+		}
+	}
+}
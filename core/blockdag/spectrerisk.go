@@ -2,6 +2,7 @@ package blockdag
 
 import (
 	"fmt"
+	"github.com/btceasypay/bitcoinpay/common/hash"
 	"gonum.org/v1/gonum/floats"
 	"gonum.org/v1/gonum/mat"
 	"gonum.org/v1/gonum/stat/distuv"
@@ -19,9 +20,19 @@ const tol = 1e-10
 // antiPast: min(|future(x')|), where x' is x or any block in anticone(x)
 // and x is the block we want to confirm, ideally this should be
 // about waitingTime * lambda.
-func GetRisk(N int, alpha float64, lambda float64, delay float64, waitingTime uint, antiPast int) float64 {
-	if N < 3 || antiPast <= 0 {
-		return 0
+func GetRisk(N int, alpha float64, lambda float64, delay float64, waitingTime uint, antiPast int) (float64, error) {
+	vect, err := riskStationary(N, alpha, lambda, delay)
+	if err != nil {
+		return 0, err
+	}
+	return hiddenRisk(vect, alpha, lambda, delay, waitingTime, antiPast), nil
+}
+
+// riskStationary returns the stationary distribution of the attacker's lead,
+// which only depends on the network and the attacker.
+func riskStationary(N int, alpha float64, lambda float64, delay float64) (*mat.VecDense, error) {
+	if N < 3 {
+		return nil, fmt.Errorf("the risk needs at least 3 states, not %d", N)
 	}
 	delta := alpha * lambda * delay
 
@@ -47,7 +58,7 @@ func GetRisk(N int, alpha float64, lambda float64, delay float64, waitingTime ui
 	var eig mat.Eigen
 	ok := eig.Factorize(tMat, mat.EigenLeft)
 	if !ok {
-		fmt.Println("Eigendecomposition failed")
+		return nil, fmt.Errorf("eigendecomposition failed")
 	}
 
 	ceigenvalues := eig.Values(nil)
@@ -65,8 +76,7 @@ func GetRisk(N int, alpha float64, lambda float64, delay float64, waitingTime ui
 		break
 	}
 	if featuresIndex == -1 {
-		fmt.Println("eigen vector failed")
-		return 0
+		return nil, fmt.Errorf("no eigenvector of the eigenvalue 1")
 	}
 	ceigenvectors := eig.LeftVectorsTo(nil)
 	r, _ := ceigenvectors.Dims()
@@ -80,12 +90,21 @@ func GetRisk(N int, alpha float64, lambda float64, delay float64, waitingTime ui
 	vecRMod := 1 / vecMod
 	vect := mat.NewVecDense(r, vecData)
 	vect.ScaleVec(vecRMod, vect)
+	return vect, nil
+}
 
+// hiddenRisk returns the risk of the anti past after the waiting time with the
+// stationary distribution of the attacker's lead.  Nothing is built on a block
+// without anti past, so it can be reverted for sure.
+func hiddenRisk(vect *mat.VecDense, alpha float64, lambda float64, delay float64, waitingTime uint, antiPast int) float64 {
+	if antiPast <= 0 {
+		return 1
+	}
 	a := (float64(waitingTime) + 2*delay) * alpha * lambda
 	pa := distuv.Poisson{Lambda: a}
 	qa := alpha / (1 - alpha)
 	riskHidden := 0.0
-	for i := 0; i < N; i++ {
+	for i := 0; i < vect.Len(); i++ {
 		sum_m := 0.0
 		mg := antiPast - i - 1
 		mj := int(math.Max(float64(mg), 0))
@@ -97,3 +116,161 @@ func GetRisk(N int, alpha float64, lambda float64, delay float64, waitingTime ui
 	}
 	return riskHidden
 }
+
+// GetRiskWaitingTime returns how many more seconds to wait until the risk of
+// GetRisk falls below epsilon, assuming the anti past grows by lambda blocks
+// per second. It returns maxWait when the risk does not fall below epsilon
+// within maxWait seconds.
+func GetRiskWaitingTime(N int, alpha float64, lambda float64, delay float64, waitingTime uint, antiPast int, epsilon float64, maxWait uint) (uint, error) {
+	vect, err := riskStationary(N, alpha, lambda, delay)
+	if err != nil {
+		return 0, err
+	}
+	wait := searchRisk(int(maxWait), func(wait int) bool {
+		ap := antiPast + int(float64(wait)*lambda)
+		return hiddenRisk(vect, alpha, lambda, delay, waitingTime+uint(wait), ap) < epsilon
+	})
+	return uint(wait), nil
+}
+
+// GetRiskAntiPast returns the smallest anti past whose risk of GetRisk is
+// below epsilon after the waiting time, or maxAntiPast when the risk doesn't
+// fall below epsilon within it.  A larger anti past makes no difference to
+// whether the block is confirmed.
+func GetRiskAntiPast(N int, alpha float64, lambda float64, delay float64, waitingTime uint, epsilon float64, maxAntiPast int) (int, error) {
+	vect, err := riskStationary(N, alpha, lambda, delay)
+	if err != nil {
+		return 0, err
+	}
+	return searchRisk(maxAntiPast, func(ap int) bool {
+		return hiddenRisk(vect, alpha, lambda, delay, waitingTime, ap) < epsilon
+	}), nil
+}
+
+// searchRisk returns the smallest n within 0 and max for which the risk is
+// below epsilon, or max when there is none.  The risk decreases as n grows,
+// so a large enough n is found by doubling it and then bisected.
+func searchRisk(max int, below func(n int) bool) int {
+	if max <= 0 || below(0) {
+		return 0
+	}
+	low, high := 0, 1
+	for !below(high) {
+		if high >= max {
+			return max
+		}
+		low, high = high, high*2
+		if high > max {
+			high = max
+		}
+	}
+	for high-low > 1 {
+		mid := low + (high-low)/2
+		if below(mid) {
+			high = mid
+		} else {
+			low = mid
+		}
+	}
+	return high
+}
+
+// GetAntiPast returns the size of the anticone of the block and its anti
+// past, the minimum size of the future set of the block and of every block in
+// its anticone, which is the antiPast parameter of GetRisk.  The future sets
+// are only counted up to enough blocks, the anti past GetRiskAntiPast found
+// confirming the block.  Once the future set of the block holds enough blocks
+// the walk stops there and the anti past is enough, the anticone isn't
+// counted and its size is -1.  No more than maxBlocks blocks of the anticone
+// of the block are walked, otherwise an error is returned.  The state lock is
+// released between the future sets of the anticone blocks.
+func (bd *BlockDAG) GetAntiPast(h *hash.Hash, enough int, maxBlocks int) (int, int, error) {
+	bd.stateLock.Lock()
+	block := bd.getBlock(h)
+	if block == nil {
+		bd.stateLock.Unlock()
+		return 0, 0, fmt.Errorf("block %s is not in the DAG", h)
+	}
+	futureSet := NewIdSet()
+	if !bd.getLimitedFutureSet(futureSet, block, enough) || futureSet.Size() >= enough {
+		bd.stateLock.Unlock()
+		return -1, enough, nil
+	}
+	anticone := NewIdSet()
+	bs := NewIdSet()
+	bs.AddPair(block.GetID(), block)
+	for _, v := range bd.tips.GetMap() {
+		bd.recLimitedAnticone(bs, futureSet, anticone, v.(IBlock), maxBlocks)
+	}
+	bd.stateLock.Unlock()
+	if anticone.Size() > maxBlocks {
+		return 0, 0, fmt.Errorf("the anticone of block %s has more than %d blocks", h, maxBlocks)
+	}
+
+	antiPast := futureSet.Size()
+	// The blocks added meanwhile only grow the future sets.  A future set
+	// is only counted until it's not smaller than the anti past.
+	for _, id := range anticone.SortList(false) {
+		if antiPast == 0 {
+			break
+		}
+		bd.stateLock.Lock()
+		ib := bd.getBlockById(id)
+		fs := NewIdSet()
+		if ib != nil {
+			bd.getLimitedFutureSet(fs, ib, antiPast)
+		}
+		bd.stateLock.Unlock()
+		if ib != nil && fs.Size() < antiPast {
+			antiPast = fs.Size()
+		}
+	}
+	return anticone.Size(), antiPast, nil
+}
+
+// getLimitedFutureSet adds the future set of the block to fs until it holds
+// limit blocks.  It returns whether the whole future set was added.
+func (bd *BlockDAG) getLimitedFutureSet(fs *IdSet, b IBlock, limit int) bool {
+	queue := []IBlock{b}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		children := cur.GetChildren()
+		if children == nil {
+			continue
+		}
+		for k, v := range children.GetMap() {
+			if fs.Has(k) {
+				continue
+			}
+			if fs.Size() >= limit {
+				return false
+			}
+			ib := v.(IBlock)
+			fs.AddPair(k, ib)
+			queue = append(queue, ib)
+		}
+	}
+	return true
+}
+
+// recLimitedAnticone is recAnticone stopping once the anticone holds more than
+// limit blocks.
+func (bd *BlockDAG) recLimitedAnticone(bs *IdSet, futureSet *IdSet, anticone *IdSet, ib IBlock, limit int) {
+	if anticone.Size() > limit || bs.Has(ib.GetID()) || anticone.Has(ib.GetID()) {
+		return
+	}
+	children := ib.GetChildren()
+	if children != nil && children.Size() > 0 && !isVirtualTip(bs, futureSet, anticone, children) {
+		return
+	}
+	if !futureSet.Has(ib.GetID()) {
+		anticone.AddPair(ib.GetID(), ib)
+	}
+	if !ib.HasParents() {
+		return
+	}
+	for _, v := range ib.GetParents().GetMap() {
+		bd.recLimitedAnticone(bs, futureSet, anticone, v.(IBlock), limit)
+	}
+}
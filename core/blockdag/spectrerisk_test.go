@@ -6,7 +6,123 @@ import (
 )
 
 func TestOnlineRiskInSpectre(t *testing.T) {
-	if floats.EqualWithinAbs(GetRisk(300, 0.1, 10, 5, 10, 30), 0.1509544, tol) {
+	risk, err := GetRisk(300, 0.1, 10, 5, 10, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if floats.EqualWithinAbs(risk, 0.1509544, tol) {
 		t.FailNow()
 	}
+	if _, err := GetRisk(2, 0.1, 10, 5, 10, 30); err == nil {
+		t.Fatal("expected the risk of too few states to fail")
+	}
+	if risk, err := GetRisk(100, 0.1, 10, 5, 10, 0); err != nil || risk != 1 {
+		t.Fatalf("risk without anti past is %v (%v), want 1", risk, err)
+	}
+}
+
+func TestRiskWaitingTime(t *testing.T) {
+	const epsilon = 0.001
+	risk := func(wait uint, ap int) float64 {
+		r, err := GetRisk(100, 0.1, 0.1, 5, wait, ap)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	wait, err := GetRiskWaitingTime(100, 0.1, 0.1, 5, 0, 1, epsilon, 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait == 0 || wait >= 3600 {
+		t.Fatalf("unexpected waiting time %d", wait)
+	}
+	ap := 1 + int(float64(wait)*0.1)
+	if r := risk(wait, ap); r >= epsilon {
+		t.Fatalf("risk %v after waiting %d seconds", r, wait)
+	}
+	ap = 1 + int(float64(wait-1)*0.1)
+	if r := risk(wait-1, ap); r < epsilon {
+		t.Fatalf("risk %v is below epsilon before waiting %d seconds", r, wait)
+	}
+	if wait, err := GetRiskWaitingTime(100, 0.1, 0.1, 5, 0, 1, epsilon, 10); err != nil || wait != 10 {
+		t.Fatalf("waiting time %d is not limited (%v)", wait, err)
+	}
+}
+
+func TestRiskAntiPast(t *testing.T) {
+	const epsilon = 0.001
+	ap, err := GetRiskAntiPast(100, 0.1, 10, 5, 10, epsilon, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ap <= 1 || ap >= 1000 {
+		t.Fatalf("unexpected anti past %d", ap)
+	}
+	if r, _ := GetRisk(100, 0.1, 10, 5, 10, ap); r >= epsilon {
+		t.Fatalf("risk %v of anti past %d", r, ap)
+	}
+	if r, _ := GetRisk(100, 0.1, 10, 5, 10, ap-1); r < epsilon {
+		t.Fatalf("risk %v is below epsilon before anti past %d", r, ap)
+	}
+	if ap, err := GetRiskAntiPast(100, 0.1, 10, 5, 10, epsilon, 3); err != nil || ap != 3 {
+		t.Fatalf("anti past %d is not limited (%v)", ap, err)
+	}
+}
+
+func TestGetAntiPast(t *testing.T) {
+	ibd := InitBlockDAG(phantom, "PH_fig2-blocks")
+	if ibd == nil {
+		t.FailNow()
+	}
+	total := int(bd.GetBlockTotal())
+	for id := uint(0); id < bd.GetBlockTotal(); id++ {
+		ib := bd.GetBlockById(id)
+		anticoneSize, antiPast, err := bd.GetAntiPast(ib.GetHash(), total, total)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The anti past is the smallest future set of the block and
+		// its anticone.
+		bd.stateLock.Lock()
+		anticone := bd.getAnticone(ib, nil)
+		fs := NewIdSet()
+		bd.getFutureSet(fs, ib)
+		want := fs.Size()
+		for _, v := range anticone.GetMap() {
+			afs := NewIdSet()
+			bd.getFutureSet(afs, v.(IBlock))
+			if afs.Size() < want {
+				want = afs.Size()
+			}
+		}
+		bd.stateLock.Unlock()
+		if anticoneSize != anticone.Size() || antiPast != want {
+			t.Fatalf("block %s: got anticone %d and anti past %d, want %d and %d",
+				getBlockTag(id), anticoneSize, antiPast, anticone.Size(), want)
+		}
+
+		// The walk stops once the future set holds enough blocks, the
+		// anticone isn't counted.
+		anticoneSize, antiPast, err = bd.GetAntiPast(ib.GetHash(), 1, total)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fs.Size() >= 1 && (anticoneSize != -1 || antiPast != 1) {
+			t.Fatalf("block %s: got anticone %d and anti past %d, want -1 and 1",
+				getBlockTag(id), anticoneSize, antiPast)
+		}
+		if fs.Size() == 0 && (anticoneSize != anticone.Size() || antiPast != 0) {
+			t.Fatalf("block %s: got anticone %d and anti past %d, want %d and 0",
+				getBlockTag(id), anticoneSize, antiPast, anticone.Size())
+		}
+
+		// The walk of the anticone is limited.
+		if anticone.Size() > 0 {
+			if _, _, err := bd.GetAntiPast(ib.GetHash(), total, 0); err == nil {
+				t.Fatalf("block %s: expected the walk of the anticone to be limited",
+					getBlockTag(id))
+			}
+		}
+	}
 }
@@ -1,6 +1,7 @@
 package blockdag
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/btceasypay/bitcoinpay/core/dbnamespace"
 	"github.com/btceasypay/bitcoinpay/database"
@@ -9,9 +10,61 @@ import (
 
 // update db to new version
 func (bd *BlockDAG) UpgradeDB(dbTx database.Tx) error {
+	err := bd.upgradeDAGInfo(dbTx)
+	if err != nil {
+		return err
+	}
+	err = bd.upgradeBlockIndex(dbTx)
+	if err != nil {
+		return err
+	}
 	return bd.upgradeMainChain(dbTx)
 }
 
+// upgradeBlockIndex builds the block hash to id and the children buckets,
+// which are needed to load the pruned blocks again.
+func (bd *BlockDAG) upgradeBlockIndex(dbTx database.Tx) error {
+	meta := dbTx.Metadata()
+	if meta.Bucket(dbnamespace.DagBlockIdBucketName) != nil {
+		return nil
+	}
+	_, err := meta.CreateBucket(dbnamespace.DagBlockIdBucketName)
+	if err != nil {
+		return err
+	}
+	if meta.Bucket(dbnamespace.DagChildrenBucketName) == nil {
+		_, err = meta.CreateBucket(dbnamespace.DagChildrenBucketName)
+		if err != nil {
+			return err
+		}
+	}
+	ubiStart := time.Now()
+	for i := uint(0); i < bd.blockTotal; i++ {
+		err := dbPutDAGBlockIndex(dbTx, bd.getBlockById(i))
+		if err != nil {
+			return err
+		}
+	}
+	log.Info(fmt.Sprintf("Build DAG block index buckets:%v/%d", time.Since(ubiStart), bd.blockTotal))
+	return nil
+}
+
+// upgradeDAGInfo rewrites the DAG info when it was stored by an older version,
+// e.g. the conflux and spectre state before it was versioned.
+func (bd *BlockDAG) upgradeDAGInfo(dbTx database.Tx) error {
+	var buff bytes.Buffer
+	err := bd.Encode(&buff)
+	if err != nil {
+		return err
+	}
+	serializedData := dbTx.Metadata().Get(dbnamespace.DagInfoBucketName)
+	if bytes.Equal(serializedData, buff.Bytes()) {
+		return nil
+	}
+	log.Info(fmt.Sprintf("Upgrade DAG info of %s", bd.instance.GetName()))
+	return dbTx.Metadata().Put(dbnamespace.DagInfoBucketName, buff.Bytes())
+}
+
 func (bd *BlockDAG) upgradeMainChain(dbTx database.Tx) error {
 	meta := dbTx.Metadata()
 	mchBucket := meta.Bucket(dbnamespace.DagMainChainBucketName)
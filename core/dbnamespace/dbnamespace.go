@@ -73,4 +73,44 @@ var (
 
 	// DAG Main Chain Blocks
 	DagMainChainBucketName = []byte("dagmainchain")
+
+	// DagBlockIdBucketName is the name of the db bucket used to house the
+	// block hash to DAG block id mappings.
+	DagBlockIdBucketName = []byte("dagblockid")
+
+	// DagChildrenBucketName is the name of the db bucket used to house the
+	// children of the DAG blocks, keyed by the parent and the child id.
+	DagChildrenBucketName = []byte("dagchildren")
+
+	// BlockWorkSumBucketName is the name of the db bucket used to house the
+	// work sums of the block nodes pruned from memory, keyed by the hash.
+	BlockWorkSumBucketName = []byte("blockworksum")
+
+	// UtxoTrieBucketName is the name of the db bucket used to house the
+	// nodes of the utxo commitment trie.
+	UtxoTrieBucketName = []byte("utxotrie")
+
+	// UtxoTrieRefBucketName is the name of the db bucket used to house the
+	// reference counts of the nodes of the utxo commitment trie.
+	UtxoTrieRefBucketName = []byte("utxotrieref")
+
+	// UtxoRootBucketName is the name of the db bucket used to house the
+	// block order -> utxo commitment root index.
+	UtxoRootBucketName = []byte("utxoroot")
+
+	// UtxoCommitmentKeyName is the name of the db key used to store the
+	// current utxo commitment root and the order it was committed at.
+	UtxoCommitmentKeyName = []byte("utxocommitment")
+
+	// UtxoSnapshotKeyName is the name of the db key used to store the
+	// progress of a utxo snapshot download.
+	UtxoSnapshotKeyName = []byte("utxosnapshot")
+
+	// UtxoSnapshotFeesBucketName is the name of the db bucket used to house
+	// the fees of the blocks that came with a utxo snapshot.
+	UtxoSnapshotFeesBucketName = []byte("utxosnapfees")
+
+	// FeeEstimatorKeyName is the name of the db key used to store the
+	// observations of the fee estimator.
+	FeeEstimatorKeyName = []byte("feeestimator")
 )
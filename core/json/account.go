@@ -0,0 +1,35 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+
+package json
+
+// GetBalanceResult models the data from the getbalance command.
+type GetBalanceResult struct {
+	Address     string  `json:"address"`
+	Confirmed   float64 `json:"confirmed"`
+	Spendable   float64 `json:"spendable"`
+	Unconfirmed float64 `json:"unconfirmed"`
+}
+
+// ListUnspentResult models a successful response from the listunspent
+// command.
+type ListUnspentResult struct {
+	TxId          string  `json:"txid"`
+	Vout          uint32  `json:"vout"`
+	Address       string  `json:"address"`
+	ScriptPubKey  string  `json:"scriptPubKey"`
+	Amount        float64 `json:"amount"`
+	Confirmations int64   `json:"confirmations"`
+	Coinbase      bool    `json:"coinbase"`
+	Spendable     bool    `json:"spendable"`
+}
+
+// AddressHistoryResult models an entry of the getaddresshistory command.
+type AddressHistoryResult struct {
+	TxId          string  `json:"txid"`
+	BlockHash     string  `json:"blockhash"`
+	Order         uint64  `json:"order"`
+	Confirmations int64   `json:"confirmations"`
+	Txsvalid      bool    `json:"txsvalid"`
+	Received      float64 `json:"received"`
+	Sent          float64 `json:"sent"`
+}
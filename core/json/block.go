@@ -2,6 +2,8 @@
 
 package json
 
+import "encoding/json"
+
 type ProofData struct {
 	EdgeBits     int    `json:"edge_bits"`
 	CircleNonces string `json:"circle_nonces"`
@@ -18,21 +20,75 @@ type PowResult struct {
 // BlockVerboseResult models the data from the getblock command when the
 // verbose flag is set.  When the verbose flag is not set, getblock returns a
 // hex-encoded string.
-
+//
+// The transactions of the block are listed in Tx when only their hashes were
+// requested and in RawTx when the full transactions were requested.
 type BlockVerboseResult struct {
-	Hash          string        `json:"hash"`
-	Confirmations int64         `json:"confirmations"`
-	Size          int32         `json:"size"`
-	Height        int64         `json:"height"`
-	Version       int32         `json:"version"`
-	TxRoot        string        `json:"txRoot"`
-	Tx            []string      `json:"tx,omitempty"`
-	RawTx         []TxRawResult `json:"rawtx,omitempty"`
-	Time          int64         `json:"time"`
-	PowResult     PowResult     `json:"pow"`
-	Difficulty    uint32        `json:"difficulty"`
-	PreviousHash  string        `json:"previousblockhash"`
-	NextHash      string        `json:"nextblockhash,omitempty"`
+	Hash           string        `json:"hash"`
+	Txsvalid       bool          `json:"txsvalid"`
+	Confirmations  int64         `json:"confirmations"`
+	Version        uint32        `json:"version"`
+	Weight         int64         `json:"weight"`
+	Height         uint64        `json:"height"`
+	TxRoot         string        `json:"txRoot"`
+	Order          *uint64       `json:"order,omitempty"`
+	Tx             []string      `json:"-"`
+	RawTx          []TxRawResult `json:"-"`
+	TransactionFee uint64        `json:"transactionfee,omitempty"`
+	StateRoot      string        `json:"stateRoot"`
+	Bits           string        `json:"bits"`
+	Difficulty     uint32        `json:"difficulty"`
+	PowResult      PowResult     `json:"pow"`
+	Timestamp      string        `json:"timestamp"`
+	ParentRoot     string        `json:"parentroot"`
+	Parents        []string      `json:"parents"`
+	Children       []string      `json:"children"`
+}
+
+// UnmarshalJSON decodes the block and sorts the transactions into Tx or RawTx
+// depending on their form.
+func (b *BlockVerboseResult) UnmarshalJSON(data []byte) error {
+	type plain BlockVerboseResult
+	aux := struct {
+		*plain
+		Transactions []json.RawMessage `json:"transactions"`
+	}{plain: (*plain)(b)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	b.Tx, b.RawTx = nil, nil
+	for _, raw := range aux.Transactions {
+		if isString(raw) {
+			var txid string
+			if err := json.Unmarshal(raw, &txid); err != nil {
+				return err
+			}
+			b.Tx = append(b.Tx, txid)
+			continue
+		}
+		var tx TxRawResult
+		if err := json.Unmarshal(raw, &tx); err != nil {
+			return err
+		}
+		b.RawTx = append(b.RawTx, tx)
+	}
+	return nil
+}
+
+// MarshalJSON encodes the block with the transactions of Tx, or of RawTx when
+// the full transactions are set, as UnmarshalJSON expects them.
+func (b BlockVerboseResult) MarshalJSON() ([]byte, error) {
+	type plain BlockVerboseResult
+	aux := struct {
+		plain
+		Transactions interface{} `json:"transactions,omitempty"`
+	}{plain: plain(b)}
+	if len(b.RawTx) > 0 {
+		aux.Transactions = b.RawTx
+	} else if len(b.Tx) > 0 {
+		aux.Transactions = b.Tx
+	}
+	return json.Marshal(aux)
 }
 
 // GetBlockHeaderVerboseResult models the data from the getblockheader command when
@@ -50,3 +106,27 @@ type GetBlockHeaderVerboseResult struct {
 	Time          int64     `json:"time"`
 	PowResult     PowResult `json:"pow"`
 }
+
+// DeploymentResult models the data of a deployment returned by the
+// getdeploymentinfo command.
+type DeploymentResult struct {
+	ID         uint32 `json:"id"`
+	Bit        uint8  `json:"bit"`
+	StartTime  uint64 `json:"starttime"`
+	ExpireTime uint64 `json:"expiretime"`
+	Status     string `json:"status"`
+}
+
+// GetDeploymentInfoResult models the data from the getdeploymentinfo command.
+type GetDeploymentInfoResult struct {
+	BlockVersion uint32             `json:"blockversion"`
+	Deployments  []DeploymentResult `json:"deployments"`
+}
+
+// UtxoProofResult models the data from the getutxoproof command.
+type UtxoProofResult struct {
+	Order uint64   `json:"order"`
+	Root  string   `json:"root"`
+	Entry string   `json:"entry,omitempty"`
+	Proof []string `json:"proof"`
+}
@@ -50,6 +50,21 @@ type GetPeerInfoResult struct {
 	GraphState GetGraphStateResult `json:"graphstate"`
 }
 
+// GetMemoryInfoResult models the data returned from the getMemoryInfo command.
+type GetMemoryInfoResult struct {
+	IndexNodes        int    `json:"indexnodes"`
+	PrunedNodes       uint64 `json:"prunednodes"`
+	LoadedNodes       uint64 `json:"loadednodes"`
+	DAGBlocks         int    `json:"dagblocks"`
+	PrunedDAGBlocks   uint64 `json:"pruneddagblocks"`
+	LoadedDAGBlocks   uint64 `json:"loadeddagblocks"`
+	PruneDepth        uint   `json:"prunedepth"`
+	LastPrune         int64  `json:"lastprune,omitempty"`
+	LastPruneDuration string `json:"lastpruneduration,omitempty"`
+	HeapAlloc         uint64 `json:"heapalloc"`
+	HeapObjects       uint64 `json:"heapobjects"`
+}
+
 // GetGraphStateResult data
 type GetGraphStateResult struct {
 	Tips       []string `json:"tips"`
@@ -62,3 +77,11 @@ type GetBanlistResult struct {
 	Host   string `json:"host"`
 	Expire string `json:"expire"`
 }
+
+// GetAddedNodeInfoResult describes a node added with --addpeer, --connect or
+// addNode.
+type GetAddedNodeInfoResult struct {
+	AddedNode string `json:"addednode"`
+	Connected bool   `json:"connected"`
+	ID        int32  `json:"id,omitempty"`
+}
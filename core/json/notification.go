@@ -0,0 +1,48 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+
+package json
+
+// BlockNotifyResult models the data sent to the newBlocks, blockConnected and
+// blockDisconnected subscribers.
+type BlockNotifyResult struct {
+	Hash    string   `json:"hash"`
+	Order   uint64   `json:"order"`
+	Height  uint64   `json:"height"`
+	Parents []string `json:"parents"`
+	Time    int64    `json:"time"`
+	Tx      []string `json:"tx"`
+}
+
+// ReorganizationNotifyResult models the data sent to the reorganization
+// subscribers when the order of the DAG changes.  The detached blocks are
+// listed in the order they are disconnected, the attached ones in the order
+// they are connected.
+type ReorganizationNotifyResult struct {
+	OldHash   string   `json:"oldhash"`
+	OldHeight uint64   `json:"oldheight"`
+	NewHash   string   `json:"newhash"`
+	NewHeight uint64   `json:"newheight"`
+	Detached  []string `json:"detached"`
+	Attached  []string `json:"attached"`
+}
+
+// TxNotifyResult models the data sent to the newTransactions subscribers
+// when a transaction is accepted into the memory pool.
+type TxNotifyResult struct {
+	Txid     string `json:"txid"`
+	Size     int    `json:"size"`
+	Fee      int64  `json:"fee"`
+	FeePerKB int64  `json:"feeperkb"`
+	Time     int64  `json:"time"`
+	Hex      string `json:"hex,omitempty"`
+}
+
+// TipsNotifyResult models the data sent to the newTips subscribers whenever
+// the set of DAG tips changes.
+type TipsNotifyResult struct {
+	MainTip    string   `json:"maintip"`
+	Tips       []string `json:"tips"`
+	MainOrder  uint32   `json:"mainorder"`
+	MainHeight uint32   `json:"mainheight"`
+	Layer      uint32   `json:"layer"`
+}
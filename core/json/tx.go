@@ -135,3 +135,54 @@ type PrevOut struct {
 	Addresses []string `json:"addresses,omitempty"`
 	Value     float64  `json:"value"`
 }
+
+// EstimateSmartFeeResult models the data from the estimatesmartfee command.
+type EstimateSmartFeeResult struct {
+	FeeRate float64 `json:"feerate"`
+	Blocks  int64   `json:"blocks"`
+}
+
+// TxConfirmationRiskResult models the data from the gettxconfirmationrisk
+// command.  The anticone size is -1 when the future set of the block already
+// confirms it and the anticone isn't counted.
+type TxConfirmationRiskResult struct {
+	BlockHash     string  `json:"blockhash"`
+	Confirmations uint    `json:"confirmations"`
+	AnticoneSize  int     `json:"anticonesize"`
+	AntiPast      int     `json:"antipast"`
+	Elapsed       int64   `json:"elapsed"`
+	Risk          float64 `json:"risk"`
+	Epsilon       float64 `json:"epsilon"`
+	Confirmed     bool    `json:"confirmed"`
+	WaitTime      uint    `json:"waittime"`
+}
+
+// SaveMempoolResult models the data from the savemempool command.
+type SaveMempoolResult struct {
+	Txs      int    `json:"txs"`
+	Filename string `json:"filename"`
+}
+
+// CreateAssetIssueResult models the data from the createassetissuetransaction
+// command.
+type CreateAssetIssueResult struct {
+	Hex     string `json:"hex"`
+	AssetID string `json:"assetid"`
+}
+
+// AssetInfoResult models the data from the getassetinfo and listassets
+// commands.
+type AssetInfoResult struct {
+	AssetID string `json:"assetid"`
+	Issuer  string `json:"issuer"`
+	IssueTx string `json:"issuetx"`
+	Issued  uint64 `json:"issued"`
+	Revoked uint64 `json:"revoked"`
+	Supply  uint64 `json:"supply"`
+}
+
+// AssetBalanceResult models the data from the getassetbalances command.
+type AssetBalanceResult struct {
+	AssetID string `json:"assetid"`
+	Amount  uint64 `json:"amount"`
+}
@@ -84,13 +84,13 @@ func BuildMerkleTreeStore(transactions []*types.Tx, witness bool) []*hash.Hash {
 		// When there is no right child, the parent is generated by
 		// hashing the concatenation of the left child with itself.
 		case merkles[i+1] == nil:
-			newHash := hashMerkleBranches(merkles[i], merkles[i])
+			newHash := HashMerkleBranches(merkles[i], merkles[i])
 			merkles[offset] = newHash
 
 		// The normal case sets the parent node to the hash of the
 		// concatentation of the left and right children.
 		default:
-			newHash := hashMerkleBranches(merkles[i], merkles[i+1])
+			newHash := HashMerkleBranches(merkles[i], merkles[i+1])
 			merkles[offset] = newHash
 		}
 		offset++
@@ -110,10 +110,10 @@ func calcMerkleRoot(txns []*types.Transaction) hash.Hash {
 	return *merkles[len(merkles)-1]
 }
 
-// hashMerkleBranches takes two hashes, treated as the left and right tree
+// HashMerkleBranches takes two hashes, treated as the left and right tree
 // nodes, and returns the hash of their concatenation.  This is a helper
 // function used to aid in the generation of a merkle tree.
-func hashMerkleBranches(left *hash.Hash, right *hash.Hash) *hash.Hash {
+func HashMerkleBranches(left *hash.Hash, right *hash.Hash) *hash.Hash {
 	// Concatenate the left and right nodes.
 	var h [hash.HashSize * 2]byte
 	copy(h[:hash.HashSize], left[:])
@@ -197,13 +197,13 @@ func BuildParentsMerkleTreeStore(parents []*hash.Hash) []*hash.Hash {
 			// When there is no right child, the parent is generated by
 			// hashing the concatenation of the left child with itself.
 		case merkles[i+1] == nil:
-			newHash := hashMerkleBranches(merkles[i], merkles[i])
+			newHash := HashMerkleBranches(merkles[i], merkles[i])
 			merkles[offset] = newHash
 
 			// The normal case sets the parent node to the hash of the
 			// concatentation of the left and right children.
 		default:
-			newHash := hashMerkleBranches(merkles[i], merkles[i+1])
+			newHash := HashMerkleBranches(merkles[i], merkles[i+1])
 			merkles[offset] = newHash
 		}
 		offset++
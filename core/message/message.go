@@ -70,6 +70,13 @@ const (
 	CmdCFilter      = "cfilter"
 	CmdCFHeaders    = "cfheaders"
 	CmdCFTypes      = "cftypes"
+	CmdFilterAdd    = "filteradd"
+	CmdFilterClear  = "filterclear"
+	CmdFilterLoad   = "filterload"
+	CmdMerkleBlock  = "merkleblock"
+
+	CmdGetUtxoSnapshot = "getutxosnap"
+	CmdUtxoSnapshot    = "utxosnap"
 )
 
 // Message is an interface that describes a Bitcoinpay message.  A type that
@@ -134,29 +141,33 @@ func makeEmptyMessage(command string) (Message, error) {
 		msg = &MsgSyncPoint{}
 	case CmdFeeFilter:
 		msg = &MsgFeeFilter{}
+	case CmdGetCFilter:
+		msg = &MsgGetCFilter{}
+	case CmdGetCFHeaders:
+		msg = &MsgGetCFHeaders{}
+	case CmdGetCFTypes:
+		msg = &MsgGetCFTypes{}
+	case CmdCFilter:
+		msg = &MsgCFilter{}
+	case CmdCFHeaders:
+		msg = &MsgCFHeaders{}
+	case CmdCFTypes:
+		msg = &MsgCFTypes{}
+	case CmdFilterAdd:
+		msg = &MsgFilterAdd{}
+	case CmdFilterClear:
+		msg = &MsgFilterClear{}
+	case CmdFilterLoad:
+		msg = &MsgFilterLoad{}
+	case CmdMerkleBlock:
+		msg = &MsgMerkleBlock{}
+	case CmdGetUtxoSnapshot:
+		msg = &MsgGetUtxoSnapshot{}
+	case CmdUtxoSnapshot:
+		msg = &MsgUtxoSnapshot{}
 	/*
 		case CmdSendHeaders:
 			msg = &MsgSendHeaders{}
-
-
-
-		case CmdGetCFilter:
-			msg = &MsgGetCFilter{}
-
-		case CmdGetCFHeaders:
-			msg = &MsgGetCFHeaders{}
-
-		case CmdGetCFTypes:
-			msg = &MsgGetCFTypes{}
-
-		case CmdCFilter:
-			msg = &MsgCFilter{}
-
-		case CmdCFHeaders:
-			msg = &MsgCFHeaders{}
-
-		case CmdCFTypes:
-			msg = &MsgCFTypes{}
 	*/
 
 	default:
@@ -192,7 +203,7 @@ func readMessageHeader(r io.Reader) (int, *messageHeader, error) {
 	s.ReadElements(hr, &hdr.magic, &command, &hdr.length, &hdr.checksum)
 
 	// Strip trailing zeros from command string.
-	hdr.command = string(bytes.TrimRight(command[:], string(0)))
+	hdr.command = string(bytes.TrimRight(command[:], "\x00"))
 
 	return n, &hdr, nil
 }
@@ -8,6 +8,7 @@ package message
 
 import (
 	"fmt"
+	"github.com/btceasypay/bitcoinpay/core/protocol"
 	s "github.com/btceasypay/bitcoinpay/core/serialization"
 	"github.com/btceasypay/bitcoinpay/core/types"
 	"io"
@@ -78,7 +79,15 @@ func (msg *MsgAddr) Decode(r io.Reader, pver uint32) error {
 	msg.AddrList = make([]*types.NetAddress, 0, count)
 	for i := uint64(0); i < count; i++ {
 		na := &addrList[i]
-		err := types.ReadNetAddress(r, pver, na, true)
+		if pver < protocol.AddrV2Version {
+			err = types.ReadNetAddress(r, pver, na, true)
+		} else {
+			err = types.ReadNetAddressV2(r, pver, na, true)
+		}
+		// The addresses of the networks which aren't known are skipped.
+		if err == types.ErrUnknownNetAddr {
+			continue
+		}
 		if err != nil {
 			return err
 		}
@@ -105,7 +114,15 @@ func (msg *MsgAddr) Encode(w io.Writer, pver uint32) error {
 	}
 
 	for _, na := range msg.AddrList {
-		err = types.WriteNetAddress(w, pver, na, true)
+		if pver >= protocol.AddrV2Version {
+			err = types.WriteNetAddressV2(w, pver, na, true)
+		} else if na.IsTorV3() {
+			str := fmt.Sprintf("version 3 onion address needs protocol "+
+				"version %v [pver %v]", protocol.AddrV2Version, pver)
+			return messageError("MsgAddr.Encode", str)
+		} else {
+			err = types.WriteNetAddress(w, pver, na, true)
+		}
 		if err != nil {
 			return err
 		}
@@ -124,6 +141,9 @@ func (msg *MsgAddr) Command() string {
 // receiver.  This is part of the Message interface implementation.
 func (msg *MsgAddr) MaxPayloadLength(pver uint32) uint32 {
 	// Num addresses (varInt) + max allowed addresses.
+	if pver >= protocol.AddrV2Version {
+		return s.MaxVarIntPayload + (MaxAddrPerMsg * types.MaxNetAddressPayloadV2(pver))
+	}
 	return s.MaxVarIntPayload + (MaxAddrPerMsg * types.MaxNetAddressPayload(pver))
 }
 
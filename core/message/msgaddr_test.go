@@ -0,0 +1,87 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package message
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/btceasypay/bitcoinpay/core/protocol"
+	"github.com/btceasypay/bitcoinpay/core/types"
+)
+
+// TestMsgAddrV2 ensures the version 3 onion addresses are relayed with the wide
+// encoding of the addresses, the addresses of unknown networks are skipped and
+// the version 3 onion addresses aren't sent to the older peers.
+func TestMsgAddrV2(t *testing.T) {
+	ts := time.Unix(time.Now().Unix(), 0)
+	ipv4 := types.NewNetAddressTimestamp(ts, protocol.Full,
+		net.ParseIP("1.2.3.4").To4(), 8130)
+	ipv6 := types.NewNetAddressTimestamp(ts, protocol.Full,
+		net.ParseIP("2001:db8::1"), 8130)
+	torV3 := types.NewNetAddressTorV3(bytes.Repeat([]byte{0xab}, 32), 8130,
+		protocol.Full)
+	torV3.Timestamp = ts
+
+	msg := NewMsgAddr()
+	if err := msg.AddAddresses(ipv4, ipv6, torV3); err != nil {
+		t.Fatal(err)
+	}
+	pver := protocol.AddrV2Version
+	var buf bytes.Buffer
+	if err := msg.Encode(&buf, pver); err != nil {
+		t.Fatal(err)
+	}
+	if uint32(buf.Len()) > msg.MaxPayloadLength(pver) {
+		t.Fatalf("encoded %d bytes, max %d", buf.Len(), msg.MaxPayloadLength(pver))
+	}
+	decoded := NewMsgAddr()
+	if err := decoded.Decode(bytes.NewReader(buf.Bytes()), pver); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, msg) {
+		t.Fatalf("got %v, want %v", decoded.AddrList, msg.AddrList)
+	}
+
+	// An address of an unknown network is skipped.
+	var unknown bytes.Buffer
+	unknown.Write([]byte{0x02})
+	types.WriteNetAddressV2(&unknown, pver, ipv4, true)
+	unknown.Write(buf.Bytes()[1:5])               // timestamp
+	unknown.Write(make([]byte, 8))                // services
+	unknown.Write([]byte{0x05, 0x02, 0xff, 0xff}) // network 5, 2 bytes
+	unknown.Write([]byte{0x1f, 0xc2})             // port
+	decoded = NewMsgAddr()
+	if err := decoded.Decode(bytes.NewReader(unknown.Bytes()), pver); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded.AddrList, []*types.NetAddress{ipv4}) {
+		t.Fatalf("got %v, want only %v", decoded.AddrList, ipv4)
+	}
+
+	// The older peers read the legacy encoding, which has no room for the
+	// version 3 onion addresses.
+	buf.Reset()
+	if err := msg.Encode(&buf, pver-1); err == nil {
+		t.Fatal("expected encoding a version 3 onion address to fail")
+	}
+	legacy := NewMsgAddr()
+	legacy.AddAddresses(ipv4, ipv6)
+	buf.Reset()
+	if err := legacy.Encode(&buf, pver-1); err != nil {
+		t.Fatal(err)
+	}
+	decoded = NewMsgAddr()
+	if err := decoded.Decode(bytes.NewReader(buf.Bytes()), pver-1); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.AddrList) != 2 || !decoded.AddrList[0].IP.Equal(ipv4.IP) ||
+		!decoded.AddrList[1].IP.Equal(ipv6.IP) {
+		t.Fatalf("got %v, want %v", decoded.AddrList, legacy.AddrList)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package message
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/protocol"
+)
+
+// TestCFMessagesRoundTrip ensures the committed filter messages decode to what
+// was encoded, framed as they are sent to the peers.
+func TestCFMessagesRoundTrip(t *testing.T) {
+	pver := protocol.ProtocolVersion
+	blockHash := hash.HashH([]byte("block"))
+	stopHash := hash.HashH([]byte("stop"))
+
+	cfheaders := NewMsgCFHeaders()
+	cfheaders.FilterType = GCSFilterRegular
+	cfheaders.StopHash = stopHash
+	cfheaders.PrevFilterHeader = hash.HashH([]byte("prev"))
+	for i := 0; i < 3; i++ {
+		h := hash.HashH([]byte{byte(i)})
+		if err := cfheaders.AddCFHash(&h); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		msg  Message
+	}{
+		{"getcfilter", NewMsgGetCFilter(GCSFilterRegular, &blockHash)},
+		{"cfilter", NewMsgCFilter(GCSFilterRegular, &blockHash, []byte{1, 2, 3, 4})},
+		{"empty cfilter", NewMsgCFilter(GCSFilterRegular, &blockHash, []byte{})},
+		{"getcfheaders", NewMsgGetCFHeaders(GCSFilterRegular, 42, &stopHash)},
+		{"cfheaders", cfheaders},
+		{"getcftypes", NewMsgGetCFTypes()},
+		{"cftypes", NewMsgCFTypes([]FilterType{GCSFilterRegular})},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := WriteMessage(&buf, test.msg, pver, protocol.MainNet); err != nil {
+			t.Errorf("%s: write: %v", test.name, err)
+			continue
+		}
+		msg, _, err := ReadMessage(&buf, pver, protocol.MainNet)
+		if err != nil {
+			t.Errorf("%s: read: %v", test.name, err)
+			continue
+		}
+		if msg.Command() != test.msg.Command() {
+			t.Errorf("%s: got command %s, want %s", test.name,
+				msg.Command(), test.msg.Command())
+			continue
+		}
+		if !reflect.DeepEqual(msg, test.msg) {
+			t.Errorf("%s: got %+v, want %+v", test.name, msg, test.msg)
+		}
+	}
+}
+
+// TestCFMessagesLimits ensures the committed filter messages beyond their
+// limits are neither encoded nor decoded.
+func TestCFMessagesLimits(t *testing.T) {
+	pver := protocol.ProtocolVersion
+	blockHash := hash.HashH([]byte("block"))
+
+	cfilter := NewMsgCFilter(GCSFilterRegular, &blockHash,
+		make([]byte, MaxCFilterDataSize+1))
+	if err := cfilter.Encode(&bytes.Buffer{}, pver); err == nil {
+		t.Error("expected oversized cfilter to fail encoding")
+	}
+
+	cfheaders := NewMsgCFHeaders()
+	for i := 0; i < MaxCFHeadersPerMsg; i++ {
+		if err := cfheaders.AddCFHash(&blockHash); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cfheaders.AddCFHash(&blockHash); err == nil {
+		t.Error("expected AddCFHash beyond the limit to fail")
+	}
+
+	// Forge a cfheaders message with one hash too many.
+	var buf bytes.Buffer
+	if err := cfheaders.Encode(&buf, pver); err != nil {
+		t.Fatal(err)
+	}
+	raw := buf.Bytes()
+	// The count is a 3 byte varint after the filter type and the two
+	// hashes, bump its low byte.
+	raw[1+2*hash.HashSize+1]++
+	if err := new(MsgCFHeaders).Decode(bytes.NewReader(raw), pver); err == nil {
+		t.Error("expected cfheaders with too many hashes to fail decoding")
+	}
+
+	cftypes := NewMsgCFTypes(make([]FilterType, MaxFilterTypesPerMsg+1))
+	if err := cftypes.Encode(&bytes.Buffer{}, pver); err == nil {
+		t.Error("expected cftypes with too many filter types to fail encoding")
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Copyright (c) 2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package message
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	s "github.com/btceasypay/bitcoinpay/core/serialization"
+)
+
+const (
+	// MaxCFHeadersPerMsg is the maximum number of committed filter hashes
+	// that can be in a single cfheaders message.
+	MaxCFHeadersPerMsg = 2000
+)
+
+// MsgCFHeaders implements the Message interface and represents a cfheaders
+// message.  It is used to deliver the committed filter hashes in response to
+// a getcfheaders (MsgGetCFHeaders) message.  The filter header of the block
+// before the first one is included, so the receiver can rebuild the chain of
+// filter headers up to StopHash.
+type MsgCFHeaders struct {
+	FilterType       FilterType
+	StopHash         hash.Hash
+	PrevFilterHeader hash.Hash
+	FilterHashes     []*hash.Hash
+}
+
+// AddCFHash adds a new filter hash to the message.
+func (msg *MsgCFHeaders) AddCFHash(h *hash.Hash) error {
+	if len(msg.FilterHashes)+1 > MaxCFHeadersPerMsg {
+		str := fmt.Sprintf("too many block headers in message [max %v]",
+			MaxCFHeadersPerMsg)
+		return messageError("MsgCFHeaders.AddCFHash", str)
+	}
+
+	msg.FilterHashes = append(msg.FilterHashes, h)
+	return nil
+}
+
+// Decode decodes r using the protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgCFHeaders) Decode(r io.Reader, pver uint32) error {
+	var err error
+	msg.FilterType, err = readFilterType(r)
+	if err != nil {
+		return err
+	}
+	err = s.ReadElements(r, &msg.StopHash, &msg.PrevFilterHeader)
+	if err != nil {
+		return err
+	}
+
+	// Read number of filter hashes and limit to max.
+	count, err := s.ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if count > MaxCFHeadersPerMsg {
+		str := fmt.Sprintf("too many committed filter hashes for "+
+			"message [count %v, max %v]", count, MaxCFHeadersPerMsg)
+		return messageError("MsgCFHeaders.Decode", str)
+	}
+
+	// Create a contiguous slice of hashes to deserialize into in order to
+	// reduce the number of allocations.
+	hashes := make([]hash.Hash, count)
+	msg.FilterHashes = make([]*hash.Hash, 0, count)
+	for i := uint64(0); i < count; i++ {
+		h := &hashes[i]
+		if err := s.ReadElements(r, h); err != nil {
+			return err
+		}
+		msg.AddCFHash(h)
+	}
+	return nil
+}
+
+// Encode encodes the receiver to w using the protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgCFHeaders) Encode(w io.Writer, pver uint32) error {
+	// Limit to max committed hashes per message.
+	count := len(msg.FilterHashes)
+	if count > MaxCFHeadersPerMsg {
+		str := fmt.Sprintf("too many committed filter hashes for "+
+			"message [count %v, max %v]", count, MaxCFHeadersPerMsg)
+		return messageError("MsgCFHeaders.Encode", str)
+	}
+
+	err := s.WriteElements(w, uint8(msg.FilterType), &msg.StopHash,
+		&msg.PrevFilterHeader)
+	if err != nil {
+		return err
+	}
+	err = s.WriteVarInt(w, pver, uint64(count))
+	if err != nil {
+		return err
+	}
+	for _, h := range msg.FilterHashes {
+		if err := s.WriteElements(w, h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgCFHeaders) Command() string {
+	return CmdCFHeaders
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgCFHeaders) MaxPayloadLength(pver uint32) uint32 {
+	// Filter type + stop hash + prev filter header + num hashes (varInt) +
+	// max allowed hashes.
+	return 1 + hash.HashSize + hash.HashSize + MaxVarIntPayload +
+		(MaxCFHeadersPerMsg * hash.HashSize)
+}
+
+// NewMsgCFHeaders returns a new cfheaders message that conforms to the
+// Message interface.  See MsgCFHeaders for details.
+func NewMsgCFHeaders() *MsgCFHeaders {
+	return &MsgCFHeaders{
+		FilterHashes: make([]*hash.Hash, 0, MaxCFHeadersPerMsg),
+	}
+}
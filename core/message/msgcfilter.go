@@ -0,0 +1,109 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Copyright (c) 2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package message
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	s "github.com/btceasypay/bitcoinpay/core/serialization"
+)
+
+// FilterType is used to represent a filter type.
+type FilterType uint8
+
+const (
+	// GCSFilterRegular is the regular filter type.
+	GCSFilterRegular FilterType = iota
+)
+
+const (
+	// MaxCFilterDataSize is the maximum byte size of a committed filter.
+	// The maximum size is currently defined as 256KiB.
+	MaxCFilterDataSize = 256 * 1024
+)
+
+// String returns the FilterType in human-readable form.
+func (t FilterType) String() string {
+	switch t {
+	case GCSFilterRegular:
+		return "regular"
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(t))
+}
+
+// readFilterType reads a filter type from r.
+func readFilterType(r io.Reader) (FilterType, error) {
+	var t uint8
+	err := s.ReadElements(r, &t)
+	return FilterType(t), err
+}
+
+// MsgCFilter implements the Message interface and represents a cfilter
+// message.  It is used to deliver a committed filter in response to a
+// getcfilter (MsgGetCFilter) message.
+type MsgCFilter struct {
+	FilterType FilterType
+	BlockHash  hash.Hash
+	Data       []byte
+}
+
+// Decode decodes r using the protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgCFilter) Decode(r io.Reader, pver uint32) error {
+	var err error
+	msg.FilterType, err = readFilterType(r)
+	if err != nil {
+		return err
+	}
+	err = s.ReadElements(r, &msg.BlockHash)
+	if err != nil {
+		return err
+	}
+	msg.Data, err = s.ReadVarBytes(r, pver, MaxCFilterDataSize, "cfilter data")
+	return err
+}
+
+// Encode encodes the receiver to w using the protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgCFilter) Encode(w io.Writer, pver uint32) error {
+	size := len(msg.Data)
+	if size > MaxCFilterDataSize {
+		str := fmt.Sprintf("cfilter size too large for message "+
+			"[size %v, max %v]", size, MaxCFilterDataSize)
+		return messageError("MsgCFilter.Encode", str)
+	}
+	err := s.WriteElements(w, uint8(msg.FilterType), &msg.BlockHash)
+	if err != nil {
+		return err
+	}
+	return s.WriteVarBytes(w, pver, msg.Data)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgCFilter) Command() string {
+	return CmdCFilter
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgCFilter) MaxPayloadLength(pver uint32) uint32 {
+	return uint32(s.VarIntSerializeSize(MaxCFilterDataSize)) +
+		MaxCFilterDataSize + hash.HashSize + 1
+}
+
+// NewMsgCFilter returns a new cfilter message that conforms to the Message
+// interface.  See MsgCFilter for details.
+func NewMsgCFilter(filterType FilterType, blockHash *hash.Hash,
+	data []byte) *MsgCFilter {
+	return &MsgCFilter{
+		FilterType: filterType,
+		BlockHash:  *blockHash,
+		Data:       data,
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Copyright (c) 2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package message
+
+import (
+	"fmt"
+	"io"
+
+	s "github.com/btceasypay/bitcoinpay/core/serialization"
+)
+
+// MaxFilterTypesPerMsg is the maximum number of filter types allowed per
+// message.
+const MaxFilterTypesPerMsg = 256
+
+// MsgGetCFTypes is the getcftypes message.  It is used to request the filter
+// types supported by a peer.
+type MsgGetCFTypes struct{}
+
+// Decode decodes the receiver from w using the protocol encoding.  This is
+// part of the Message interface implementation.
+func (msg *MsgGetCFTypes) Decode(r io.Reader, pver uint32) error {
+	return nil
+}
+
+// Encode encodes the receiver to w using the protocol encoding.  This is
+// part of the Message interface implementation.
+func (msg *MsgGetCFTypes) Encode(w io.Writer, pver uint32) error {
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgGetCFTypes) Command() string {
+	return CmdGetCFTypes
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgGetCFTypes) MaxPayloadLength(pver uint32) uint32 {
+	return 0
+}
+
+// NewMsgGetCFTypes returns a new getcftypes message that conforms to the
+// Message interface.
+func NewMsgGetCFTypes() *MsgGetCFTypes {
+	return &MsgGetCFTypes{}
+}
+
+// MsgCFTypes is the cftypes message.  It is used to deliver the filter types
+// supported by a peer in response to a getcftypes (MsgGetCFTypes) message.
+type MsgCFTypes struct {
+	SupportedFilters []FilterType
+}
+
+// Decode decodes r using the protocol encoding into the receiver.  This is
+// part of the Message interface implementation.
+func (msg *MsgCFTypes) Decode(r io.Reader, pver uint32) error {
+	// Read the number of filter types supported.
+	count, err := s.ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if count > MaxFilterTypesPerMsg {
+		str := fmt.Sprintf("too many filter types for message "+
+			"[count %v, max %v]", count, MaxFilterTypesPerMsg)
+		return messageError("MsgCFTypes.Decode", str)
+	}
+
+	// Read each filter type.
+	msg.SupportedFilters = make([]FilterType, count)
+	for i := uint64(0); i < count; i++ {
+		msg.SupportedFilters[i], err = readFilterType(r)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Encode encodes the receiver to w using the protocol encoding.  This is
+// part of the Message interface implementation.
+func (msg *MsgCFTypes) Encode(w io.Writer, pver uint32) error {
+	if len(msg.SupportedFilters) > MaxFilterTypesPerMsg {
+		str := fmt.Sprintf("too many filter types for message "+
+			"[count %v, max %v]", len(msg.SupportedFilters),
+			MaxFilterTypesPerMsg)
+		return messageError("MsgCFTypes.Encode", str)
+	}
+
+	// Write length of supported filters slice.  We assume it's deduplicated.
+	err := s.WriteVarInt(w, pver, uint64(len(msg.SupportedFilters)))
+	if err != nil {
+		return err
+	}
+	for _, t := range msg.SupportedFilters {
+		if err := s.WriteElements(w, uint8(t)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgCFTypes) Command() string {
+	return CmdCFTypes
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgCFTypes) MaxPayloadLength(pver uint32) uint32 {
+	// Num filter types (varInt) + max allowed filter types.
+	return MaxVarIntPayload + MaxFilterTypesPerMsg
+}
+
+// NewMsgCFTypes returns a new cftypes message that conforms to the Message
+// interface.  See MsgCFTypes for details.
+func NewMsgCFTypes(filterTypes []FilterType) *MsgCFTypes {
+	return &MsgCFTypes{
+		SupportedFilters: filterTypes,
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Copyright (c) 2014-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package message
+
+import (
+	"fmt"
+	"io"
+
+	s "github.com/btceasypay/bitcoinpay/core/serialization"
+)
+
+const (
+	// MaxFilterAddDataSize is the maximum byte size of a data
+	// element to add to the Bloom filter.  It is equal to the
+	// maximum element size of a script.
+	MaxFilterAddDataSize = 520
+)
+
+// MsgFilterAdd implements the Message interface and represents a filteradd
+// message.  It is used to add a data element to an existing Bloom filter.
+//
+// This message was not added until the BIP37 bloom filtering was supported
+// by the protocol.
+type MsgFilterAdd struct {
+	Data []byte
+}
+
+// Decode decodes r using the protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgFilterAdd) Decode(r io.Reader, pver uint32) error {
+	var err error
+	msg.Data, err = s.ReadVarBytes(r, pver, MaxFilterAddDataSize,
+		"filteradd data")
+	return err
+}
+
+// Encode encodes the receiver to w using the protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgFilterAdd) Encode(w io.Writer, pver uint32) error {
+	size := len(msg.Data)
+	if size > MaxFilterAddDataSize {
+		str := fmt.Sprintf("filteradd size too large for message "+
+			"[size %v, max %v]", size, MaxFilterAddDataSize)
+		return messageError("MsgFilterAdd.Encode", str)
+	}
+
+	return s.WriteVarBytes(w, pver, msg.Data)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgFilterAdd) Command() string {
+	return CmdFilterAdd
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgFilterAdd) MaxPayloadLength(pver uint32) uint32 {
+	return uint32(s.VarIntSerializeSize(MaxFilterAddDataSize)) +
+		MaxFilterAddDataSize
+}
+
+// NewMsgFilterAdd returns a new filteradd message that conforms to the
+// Message interface.  See MsgFilterAdd for details.
+func NewMsgFilterAdd(data []byte) *MsgFilterAdd {
+	return &MsgFilterAdd{
+		Data: data,
+	}
+}
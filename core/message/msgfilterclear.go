@@ -0,0 +1,47 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Copyright (c) 2014-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package message
+
+import (
+	"io"
+)
+
+// MsgFilterClear implements the Message interface and represents a filterclear
+// message which is used to reset a Bloom filter.
+//
+// This message was not added until the BIP37 bloom filtering was supported
+// by the protocol and has no payload.
+type MsgFilterClear struct{}
+
+// Decode decodes r using the protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgFilterClear) Decode(r io.Reader, pver uint32) error {
+	return nil
+}
+
+// Encode encodes the receiver to w using the protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgFilterClear) Encode(w io.Writer, pver uint32) error {
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgFilterClear) Command() string {
+	return CmdFilterClear
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgFilterClear) MaxPayloadLength(pver uint32) uint32 {
+	return 0
+}
+
+// NewMsgFilterClear returns a new filterclear message that conforms to the
+// Message interface.  See MsgFilterClear for details.
+func NewMsgFilterClear() *MsgFilterClear {
+	return &MsgFilterClear{}
+}
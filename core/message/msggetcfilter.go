@@ -0,0 +1,60 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Copyright (c) 2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package message
+
+import (
+	"io"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	s "github.com/btceasypay/bitcoinpay/core/serialization"
+)
+
+// MsgGetCFilter implements the Message interface and represents a getcfilter
+// message.  It is used to request a committed filter for a block.
+type MsgGetCFilter struct {
+	FilterType FilterType
+	BlockHash  hash.Hash
+}
+
+// Decode decodes r using the protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgGetCFilter) Decode(r io.Reader, pver uint32) error {
+	var err error
+	msg.FilterType, err = readFilterType(r)
+	if err != nil {
+		return err
+	}
+	return s.ReadElements(r, &msg.BlockHash)
+}
+
+// Encode encodes the receiver to w using the protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgGetCFilter) Encode(w io.Writer, pver uint32) error {
+	return s.WriteElements(w, uint8(msg.FilterType), &msg.BlockHash)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgGetCFilter) Command() string {
+	return CmdGetCFilter
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgGetCFilter) MaxPayloadLength(pver uint32) uint32 {
+	// Filter type + block hash.
+	return 1 + hash.HashSize
+}
+
+// NewMsgGetCFilter returns a new getcfilter message that conforms to the
+// Message interface using the passed parameters and defaults for the
+// remaining fields.
+func NewMsgGetCFilter(filterType FilterType, blockHash *hash.Hash) *MsgGetCFilter {
+	return &MsgGetCFilter{
+		FilterType: filterType,
+		BlockHash:  *blockHash,
+	}
+}
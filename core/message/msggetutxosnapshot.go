@@ -0,0 +1,56 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package message
+
+import (
+	"io"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	s "github.com/btceasypay/bitcoinpay/core/serialization"
+)
+
+// MsgGetUtxoSnapshot implements the Message interface and represents a
+// getutxosnap message.  It is used to request the next chunk of the utxo set
+// at the order of a block.  The entries of the utxo set are sorted by the
+// hash of their keys and the chunk starts at the first entry whose key hash
+// is not below Start.
+type MsgGetUtxoSnapshot struct {
+	BlockHash hash.Hash
+	Start     hash.Hash
+}
+
+// Decode decodes r using the protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgGetUtxoSnapshot) Decode(r io.Reader, pver uint32) error {
+	return s.ReadElements(r, &msg.BlockHash, &msg.Start)
+}
+
+// Encode encodes the receiver to w using the protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgGetUtxoSnapshot) Encode(w io.Writer, pver uint32) error {
+	return s.WriteElements(w, &msg.BlockHash, &msg.Start)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgGetUtxoSnapshot) Command() string {
+	return CmdGetUtxoSnapshot
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgGetUtxoSnapshot) MaxPayloadLength(pver uint32) uint32 {
+	// Block hash + start.
+	return hash.HashSize * 2
+}
+
+// NewMsgGetUtxoSnapshot returns a new getutxosnap message that conforms to the
+// Message interface using the passed parameters.
+func NewMsgGetUtxoSnapshot(blockHash *hash.Hash, start *hash.Hash) *MsgGetUtxoSnapshot {
+	return &MsgGetUtxoSnapshot{
+		BlockHash: *blockHash,
+		Start:     *start,
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package message
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	s "github.com/btceasypay/bitcoinpay/core/serialization"
+)
+
+const (
+	// MaxUtxoSnapshotEntriesPerMsg is the maximum number of utxo entries
+	// that can be in a single utxosnap message.
+	MaxUtxoSnapshotEntriesPerMsg = 4096
+
+	// MaxUtxoSnapshotKeySize is the maximum byte size of the key of a utxo
+	// entry, which is the serialized outpoint.
+	MaxUtxoSnapshotKeySize = 64
+
+	// MaxUtxoSnapshotEntrySize is the maximum byte size of a serialized
+	// utxo entry.
+	MaxUtxoSnapshotEntrySize = 16 * 1024
+)
+
+// UtxoSnapshotEntry is an entry of the utxo set in a utxosnap message.  Fees
+// are the fees of the block of the first output of a coinbase, which are paid
+// out with it, and zero for other outputs.
+type UtxoSnapshotEntry struct {
+	Key   []byte
+	Entry []byte
+	Fees  uint64
+}
+
+// MsgUtxoSnapshot implements the Message interface and represents a utxosnap
+// message.  It is used to deliver a chunk of the utxo set in response to a
+// getutxosnap (MsgGetUtxoSnapshot) message.  Root is the utxo commitment root
+// at the order of the block the entries belong to, and Done is set on the last
+// chunk of the utxo set.
+type MsgUtxoSnapshot struct {
+	BlockHash hash.Hash
+	Start     hash.Hash
+	Root      hash.Hash
+	Entries   []*UtxoSnapshotEntry
+	Done      bool
+}
+
+// AddEntry adds a new utxo entry to the message.
+func (msg *MsgUtxoSnapshot) AddEntry(entry *UtxoSnapshotEntry) error {
+	if len(msg.Entries)+1 > MaxUtxoSnapshotEntriesPerMsg {
+		str := fmt.Sprintf("too many utxo entries in message [max %v]",
+			MaxUtxoSnapshotEntriesPerMsg)
+		return messageError("MsgUtxoSnapshot.AddEntry", str)
+	}
+
+	msg.Entries = append(msg.Entries, entry)
+	return nil
+}
+
+// Decode decodes r using the protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgUtxoSnapshot) Decode(r io.Reader, pver uint32) error {
+	err := s.ReadElements(r, &msg.BlockHash, &msg.Start, &msg.Root)
+	if err != nil {
+		return err
+	}
+
+	// Read number of utxo entries and limit to max.
+	count, err := s.ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if count > MaxUtxoSnapshotEntriesPerMsg {
+		str := fmt.Sprintf("too many utxo entries for message "+
+			"[count %v, max %v]", count, MaxUtxoSnapshotEntriesPerMsg)
+		return messageError("MsgUtxoSnapshot.Decode", str)
+	}
+
+	msg.Entries = make([]*UtxoSnapshotEntry, 0, count)
+	for i := uint64(0); i < count; i++ {
+		entry := UtxoSnapshotEntry{}
+		entry.Key, err = s.ReadVarBytes(r, pver, MaxUtxoSnapshotKeySize,
+			"utxo entry key")
+		if err != nil {
+			return err
+		}
+		entry.Entry, err = s.ReadVarBytes(r, pver, MaxUtxoSnapshotEntrySize,
+			"utxo entry")
+		if err != nil {
+			return err
+		}
+		entry.Fees, err = s.ReadVarInt(r, pver)
+		if err != nil {
+			return err
+		}
+		msg.AddEntry(&entry)
+	}
+
+	return s.ReadElements(r, &msg.Done)
+}
+
+// Encode encodes the receiver to w using the protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgUtxoSnapshot) Encode(w io.Writer, pver uint32) error {
+	count := len(msg.Entries)
+	if count > MaxUtxoSnapshotEntriesPerMsg {
+		str := fmt.Sprintf("too many utxo entries for message "+
+			"[count %v, max %v]", count, MaxUtxoSnapshotEntriesPerMsg)
+		return messageError("MsgUtxoSnapshot.Encode", str)
+	}
+
+	err := s.WriteElements(w, &msg.BlockHash, &msg.Start, &msg.Root)
+	if err != nil {
+		return err
+	}
+	err = s.WriteVarInt(w, pver, uint64(count))
+	if err != nil {
+		return err
+	}
+	for _, entry := range msg.Entries {
+		err = s.WriteVarBytes(w, pver, entry.Key)
+		if err != nil {
+			return err
+		}
+		err = s.WriteVarBytes(w, pver, entry.Entry)
+		if err != nil {
+			return err
+		}
+		err = s.WriteVarInt(w, pver, entry.Fees)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.WriteElements(w, msg.Done)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgUtxoSnapshot) Command() string {
+	return CmdUtxoSnapshot
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgUtxoSnapshot) MaxPayloadLength(pver uint32) uint32 {
+	return MaxMessagePayload
+}
+
+// NewMsgUtxoSnapshot returns a new utxosnap message that conforms to the
+// Message interface.  See MsgUtxoSnapshot for details.
+func NewMsgUtxoSnapshot(blockHash *hash.Hash, start *hash.Hash, root *hash.Hash) *MsgUtxoSnapshot {
+	return &MsgUtxoSnapshot{
+		BlockHash: *blockHash,
+		Start:     *start,
+		Root:      *root,
+		Entries:   make([]*UtxoSnapshotEntry, 0, MaxUtxoSnapshotEntriesPerMsg),
+	}
+}
@@ -16,7 +16,12 @@ const (
 	InitialProcotolVersion uint32 = 20
 
 	// ProtocolVersion is the latest protocol version this package supports.
-	ProtocolVersion uint32 = 22
+	ProtocolVersion uint32 = 23
+
+	// AddrV2Version is the protocol version which added the network id and
+	// the variable length address to the addresses of the addr message, so
+	// the version 3 onion addresses can be relayed.
+	AddrV2Version uint32 = 23
 )
 
 // Network represents which Bitcoinpay network a message belongs to.
@@ -72,4 +77,7 @@ const (
 
 	// a peer supports committed filters (CFs).
 	CF
+
+	// a peer serves snapshots of its utxo set.
+	UtxoSnapshot
 )
@@ -0,0 +1,126 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+
+package types
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+)
+
+const (
+	// AssetIDSize is the size of an asset ID.  It consists of the hash160
+	// of the issuer public key followed by 12 bytes of the hash of the
+	// outpoint spent by the first input of the issue transaction.
+	AssetIDSize = 32
+
+	// assetIssuerSize is the size of the issuer public key hash in an
+	// asset ID.
+	assetIssuerSize = 20
+
+	// opReturn is the OP_RETURN opcode starting the null data output
+	// script which marks an asset transaction.
+	opReturn = 0x6a
+)
+
+// assetMarkerMagic prefixes the data of the null data output which marks an
+// asset transaction.
+var assetMarkerMagic = []byte("bpa")
+
+// AssetID identifies a colored asset created by an AssetIssue transaction.
+type AssetID [AssetIDSize]byte
+
+// NewAssetID returns the ID of the asset issued by the holder of the public
+// key hash with a transaction whose first input spends the outpoint.  Since
+// an outpoint can only be spent once, the asset ID is unique.
+func NewAssetID(issuer []byte, issueOut *TxOutPoint) AssetID {
+	var id AssetID
+	copy(id[:assetIssuerSize], issuer)
+
+	var b [hash.HashSize + 4]byte
+	copy(b[:], issueOut.Hash[:])
+	binary.LittleEndian.PutUint32(b[hash.HashSize:], issueOut.OutIndex)
+	copy(id[assetIssuerSize:], hash.DoubleHashB(b[:]))
+	return id
+}
+
+// NewAssetIDFromStr returns the asset ID of a hex string.
+func NewAssetIDFromStr(s string) (*AssetID, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != AssetIDSize {
+		return nil, fmt.Errorf("invalid asset ID length of %d, want %d",
+			len(b), AssetIDSize)
+	}
+	var id AssetID
+	copy(id[:], b)
+	return &id, nil
+}
+
+// Issuer returns the hash160 of the public key of the asset issuer, which is
+// the only one allowed to revoke the asset.
+func (id *AssetID) Issuer() []byte {
+	return id[:assetIssuerSize]
+}
+
+// String returns the asset ID as a hex string.
+func (id AssetID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// AssetMarkerData returns the data of the null data output which marks an
+// asset issue transaction, or the revocation of the asset ID.
+func AssetMarkerData(txType TxType, id *AssetID) []byte {
+	data := make([]byte, 0, len(assetMarkerMagic)+1+AssetIDSize)
+	data = append(data, assetMarkerMagic...)
+	data = append(data, byte(txType))
+	if txType == AssetRevoke {
+		data = append(data, id[:]...)
+	}
+	return data
+}
+
+// ParseAssetMarker returns the transaction type and, for a revocation, the
+// asset ID of the asset marker output script.
+func ParseAssetMarker(pkScript []byte) (TxType, AssetID, bool) {
+	// The marker is a null data script pushing the data directly, so the
+	// push opcode is the data length:
+	//  OP_RETURN OP_DATA_N <"bpa" type [asset id]>
+	var id AssetID
+	if len(pkScript) < 2 || pkScript[0] != opReturn ||
+		int(pkScript[1]) != len(pkScript)-2 {
+		return TxTypeRegular, id, false
+	}
+	data := pkScript[2:]
+	if len(data) <= len(assetMarkerMagic) ||
+		!bytes.HasPrefix(data, assetMarkerMagic) {
+		return TxTypeRegular, id, false
+	}
+	txType := TxType(data[len(assetMarkerMagic)])
+	data = data[len(assetMarkerMagic)+1:]
+	switch {
+	case txType == AssetIssue && len(data) == 0:
+	case txType == AssetRevoke && len(data) == AssetIDSize:
+		copy(id[:], data)
+	default:
+		return TxTypeRegular, id, false
+	}
+	return txType, id, true
+}
+
+// AssetMarker returns the transaction type and, for a revocation, the asset
+// ID of the first asset marker output of the transaction.  It returns false
+// when the transaction has no asset marker.
+func (tx *Transaction) AssetMarker() (TxType, AssetID, bool) {
+	for _, txOut := range tx.TxOut {
+		if txType, id, ok := ParseAssetMarker(txOut.PkScript); ok {
+			return txType, id, true
+		}
+	}
+	return TxTypeRegular, AssetID{}, false
+}
@@ -9,6 +9,7 @@ package types
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"github.com/btceasypay/bitcoinpay/common/network"
 	"github.com/btceasypay/bitcoinpay/core/protocol"
 	s "github.com/btceasypay/bitcoinpay/core/serialization"
@@ -22,6 +23,26 @@ import (
 // a TCP address as required.
 var ErrInvalidNetAddr = errors.New("provided net.Addr is not a net.TCPAddr")
 
+// ErrUnknownNetAddr describes an error that indicates an address read from the
+// wide encoding belongs to a network this package doesn't know.  The address
+// is read in full, so the caller can skip it and read on.
+var ErrUnknownNetAddr = errors.New("address of an unknown network")
+
+// TorV3KeySize is the size of the ed25519 public key identifying a version 3
+// tor onion service.
+const TorV3KeySize = 32
+
+// The networks of the addresses in the wide encoding.
+const (
+	netAddrIPv4  uint8 = 1
+	netAddrIPv6  uint8 = 2
+	netAddrTorV3 uint8 = 4
+)
+
+// maxNetAddrV2Size is the largest address the wide encoding reads, even for
+// the networks which aren't known.
+const maxNetAddrV2Size = 512
+
 // MaxNetAddressPayload returns the max payload size for the NetAddress
 // based on the protocol version.
 func MaxNetAddressPayload(pver uint32) uint32 {
@@ -34,6 +55,14 @@ func MaxNetAddressPayload(pver uint32) uint32 {
 	return plen
 }
 
+// MaxNetAddressPayloadV2 returns the max payload size for the NetAddress in
+// the wide encoding used by the addr message since AddrV2Version.
+func MaxNetAddressPayloadV2(pver uint32) uint32 {
+	// Timestamp 4 bytes + services 8 bytes + network 1 byte + address
+	// length (varInt) 3 bytes + address + port 2 bytes.
+	return 18 + maxNetAddrV2Size
+}
+
 // NetAddress defines information about a peer on the network including the time
 // it was last seen, the services it supports, its IP address, and port.
 type NetAddress struct {
@@ -46,9 +75,14 @@ type NetAddress struct {
 	// Bitfield which identifies the services supported by the address.
 	Services protocol.ServiceFlag
 
-	// IP address of the peer.
+	// IP address of the peer.  It is nil for a version 3 onion address.
 	IP net.IP
 
+	// TorV3 is the public key of the version 3 onion service of the peer,
+	// which doesn't fit in an IP.  It is only relayed with the wide
+	// encoding of the addr message.
+	TorV3 []byte
+
 	// Port the peer is using.  This is encoded in big endian on the wire
 	// which differs from most everything else.
 	Port uint16
@@ -59,6 +93,11 @@ func (na *NetAddress) HasService(service protocol.ServiceFlag) bool {
 	return na.Services&service == service
 }
 
+// IsTorV3 returns whether the address is a version 3 onion address.
+func (na *NetAddress) IsTorV3() bool {
+	return len(na.TorV3) == TorV3KeySize
+}
+
 // AddService adds service as a supported service by the peer generating the
 // message.
 func (na *NetAddress) AddService(service protocol.ServiceFlag) {
@@ -87,6 +126,15 @@ func NewNetAddressTimestamp(
 	return &na
 }
 
+// NewNetAddressTorV3 returns a new NetAddress using the provided public key of
+// a version 3 onion service, port, and supported services with defaults for
+// the remaining fields.
+func NewNetAddressTorV3(pubKey []byte, port uint16, services protocol.ServiceFlag) *NetAddress {
+	na := NewNetAddressTimestamp(time.Now(), services, nil, port)
+	na.TorV3 = pubKey
+	return na
+}
+
 // NewNetAddress returns a new NetAddress using the provided TCP address and
 // supported services with defaults for the remaining fields.
 //
@@ -207,3 +255,89 @@ func WriteNetAddress(w io.Writer, pver uint32, na *NetAddress, ts bool) error {
 	// Sigh.  protocol mixes little and big endian.
 	return binary.Write(w, binary.BigEndian, na.Port)
 }
+
+// ReadNetAddressV2 reads a NetAddress in the wide encoding from r.  The
+// encoding carries the network of the address and an address of a variable
+// length, so the addresses which don't fit in an IP, such as the version 3
+// onion addresses, can be relayed.  ErrUnknownNetAddr is returned once an
+// address of an unknown network is read.
+func ReadNetAddressV2(r io.Reader, pver uint32, na *NetAddress, ts bool) error {
+	if ts {
+		err := s.ReadElements(r, (*s.Uint32Time)(&na.Timestamp))
+		if err != nil {
+			return err
+		}
+	}
+
+	var network uint8
+	err := s.ReadElements(r, &na.Services, &network)
+	if err != nil {
+		return err
+	}
+	addr, err := s.ReadVarBytes(r, pver, maxNetAddrV2Size, "address")
+	if err != nil {
+		return err
+	}
+	port, err := s.BinarySerializer.Uint16(r, binary.BigEndian)
+	if err != nil {
+		return err
+	}
+
+	*na = NetAddress{
+		Timestamp: na.Timestamp,
+		Services:  na.Services,
+		Port:      port,
+	}
+	size := 0
+	switch network {
+	case netAddrIPv4:
+		size = net.IPv4len
+		na.IP = net.IP(addr)
+	case netAddrIPv6:
+		size = net.IPv6len
+		na.IP = net.IP(addr)
+	case netAddrTorV3:
+		size = TorV3KeySize
+		na.TorV3 = addr
+	default:
+		return ErrUnknownNetAddr
+	}
+	if len(addr) != size {
+		return fmt.Errorf("address of network %d is %d bytes, want %d",
+			network, len(addr), size)
+	}
+	return nil
+}
+
+// WriteNetAddressV2 serializes a NetAddress to w in the wide encoding read by
+// ReadNetAddressV2.
+func WriteNetAddressV2(w io.Writer, pver uint32, na *NetAddress, ts bool) error {
+	if ts {
+		err := s.WriteElements(w, uint32(na.Timestamp.Unix()))
+		if err != nil {
+			return err
+		}
+	}
+
+	var network uint8
+	var addr []byte
+	switch {
+	case na.IsTorV3():
+		network, addr = netAddrTorV3, na.TorV3
+	case na.IP.To4() != nil:
+		network, addr = netAddrIPv4, na.IP.To4()
+	default:
+		// Ensure to always write 16 bytes even if the ip is nil.
+		network, addr = netAddrIPv6, make([]byte, net.IPv6len)
+		copy(addr, na.IP.To16())
+	}
+	err := s.WriteElements(w, na.Services, network)
+	if err != nil {
+		return err
+	}
+	err = s.WriteVarBytes(w, pver, addr)
+	if err != nil {
+		return err
+	}
+	return binary.Write(w, binary.BigEndian, na.Port)
+}
@@ -219,10 +219,12 @@ func (t *Transaction) AddTxOut(to *TxOutput) {
 	t.TxOut = append(t.TxOut, to)
 }
 
-// DetermineTxType determines the type of stake transaction a transaction is; if
-// none, it returns that it is an assumed regular tx.
+// DetermineTxType determines the type of a transaction from its asset marker
+// output; if none, it returns that it is an assumed regular tx.
 func DetermineTxType(tx *Transaction) TxType {
-	//TODO txType
+	if txType, _, ok := tx.AssetMarker(); ok {
+		return txType
+	}
 	return TxTypeRegular
 }
 
@@ -13,6 +13,8 @@ import (
 	"time"
 
 	"github.com/btceasypay/bitcoinpay/database/ffldb/treap"
+	"github.com/btceasypay/bitcoinpay/metrics"
+	gometrics "github.com/rcrowley/go-metrics"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/iterator"
 	"github.com/syndtr/goleveldb/leveldb/util"
@@ -369,6 +371,9 @@ type dbCache struct {
 	flushInterval time.Duration
 	lastFlush     time.Time
 
+	// flushTimer measures the number and the latency of the flushes.
+	flushTimer gometrics.Timer
+
 	// The following fields hold the keys that need to be stored or deleted
 	// from the underlying database once the cache is full, enough time has
 	// passed, or when the database is shutting down.  Note that these are
@@ -502,6 +507,7 @@ func (c *dbCache) flush() error {
 	if err := c.commitTreaps(cachedKeys, cachedRemove); err != nil {
 		return err
 	}
+	c.flushTimer.UpdateSince(c.lastFlush)
 
 	// Clear the cache since it has been flushed.
 	c.cacheLock.Lock()
@@ -644,6 +650,7 @@ func newDbCache(ldb *leveldb.DB, store *blockStore, maxSize uint64, flushInterva
 		maxSize:       maxSize,
 		flushInterval: time.Second * time.Duration(flushIntervalSecs),
 		lastFlush:     time.Now(),
+		flushTimer:    metrics.NewTimer("ffldb/cache/flush"),
 		cachedKeys:    treap.NewImmutable(),
 		cachedRemove:  treap.NewImmutable(),
 	}
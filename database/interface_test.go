@@ -0,0 +1,415 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package database_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/database"
+	_ "github.com/btceasypay/bitcoinpay/database/ffldb"
+	_ "github.com/btceasypay/bitcoinpay/database/memdb"
+	"github.com/btceasypay/bitcoinpay/params"
+)
+
+// testDrivers are the database drivers the interface tests are run against.
+var testDrivers = []string{"ffldb", "memdb"}
+
+// createTestDB creates a new database of the driver in a temporary directory.
+// The returned function closes the database and removes the directory.
+func createTestDB(t *testing.T, dbType string) (database.DB, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "interfacetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := database.Create(dbType, filepath.Join(dir, "db"),
+		params.PrivNetParams.Net)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("Create %s: %v", dbType, err)
+	}
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// checkErrorCode returns an error unless err is a database.Error with the
+// error code.  The tests return it from the transactions, since failing the
+// test inside them would leave the database locked.
+func checkErrorCode(desc string, err error, code database.ErrorCode) error {
+	if dbErr, ok := err.(database.Error); !ok || dbErr.ErrorCode != code {
+		return fmt.Errorf("%s: unexpected error - got %v, want %v", desc,
+			err, code)
+	}
+	return nil
+}
+
+// TestInterface runs the tests of the database interface against all of the
+// drivers.
+func TestInterface(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(database.DB) error
+	}{
+		{"buckets", testBuckets},
+		{"cursor", testCursor},
+		{"transactions", testTransactions},
+		{"blocks", testBlocks},
+	}
+	for _, dbType := range testDrivers {
+		for _, test := range tests {
+			t.Run(dbType+"/"+test.name, func(t *testing.T) {
+				db, teardown := createTestDB(t, dbType)
+				defer teardown()
+				if err := test.fn(db); err != nil {
+					t.Fatal(err)
+				}
+			})
+		}
+	}
+}
+
+// testBuckets ensures keys and nested buckets are created, fetched and deleted
+// as expected.
+func testBuckets(db database.DB) error {
+	err := db.Update(func(tx database.Tx) error {
+		meta := tx.Metadata()
+		if !meta.Writable() {
+			return errors.New("Writable: metadata bucket is not writable")
+		}
+		parent, err := meta.CreateBucket([]byte("parent"))
+		if err != nil {
+			return err
+		}
+		_, err = meta.CreateBucket([]byte("parent"))
+		err = checkErrorCode("CreateBucket existing", err,
+			database.ErrBucketExists)
+		if err != nil {
+			return err
+		}
+		_, err = meta.CreateBucket(nil)
+		err = checkErrorCode("CreateBucket empty", err,
+			database.ErrBucketNameRequired)
+		if err != nil {
+			return err
+		}
+		b, err := meta.CreateBucketIfNotExists([]byte("parent"))
+		if err != nil || b == nil {
+			return fmt.Errorf("CreateBucketIfNotExists: unexpected "+
+				"error %v", err)
+		}
+
+		child, err := parent.CreateBucket([]byte("child"))
+		if err != nil {
+			return err
+		}
+		if _, err := child.CreateBucket([]byte("grandchild")); err != nil {
+			return err
+		}
+		if err := parent.Put([]byte("key"), []byte("parent")); err != nil {
+			return err
+		}
+		if err := child.Put([]byte("key"), []byte("child")); err != nil {
+			return err
+		}
+		return checkErrorCode("Put empty", child.Put(nil, nil),
+			database.ErrKeyRequired)
+	})
+	if err != nil {
+		return err
+	}
+
+	return db.Update(func(tx database.Tx) error {
+		parent := tx.Metadata().Bucket([]byte("parent"))
+		if parent == nil {
+			return errors.New("Bucket: parent bucket not found")
+		}
+		child := parent.Bucket([]byte("child"))
+		if child == nil {
+			return errors.New("Bucket: child bucket not found")
+		}
+		if got := parent.Get([]byte("key")); !bytes.Equal(got, []byte("parent")) {
+			return fmt.Errorf("Get: unexpected value - got %q, want %q",
+				got, "parent")
+		}
+		if got := child.Get([]byte("key")); !bytes.Equal(got, []byte("child")) {
+			return fmt.Errorf("Get: unexpected value - got %q, want %q",
+				got, "child")
+		}
+
+		var buckets [][]byte
+		err := parent.ForEachBucket(func(k []byte) error {
+			buckets = append(buckets, k)
+			return nil
+		})
+		if err != nil || len(buckets) != 1 || !bytes.Equal(buckets[0], []byte("child")) {
+			return fmt.Errorf("ForEachBucket: unexpected buckets %q (%v)",
+				buckets, err)
+		}
+
+		// Deleting the child removes its keys and nested buckets.
+		if err := parent.DeleteBucket([]byte("child")); err != nil {
+			return err
+		}
+		err = checkErrorCode("DeleteBucket missing",
+			parent.DeleteBucket([]byte("child")), database.ErrBucketNotFound)
+		if err != nil {
+			return err
+		}
+		if parent.Bucket([]byte("child")) != nil {
+			return errors.New("Bucket: deleted child bucket found")
+		}
+		child, err = parent.CreateBucket([]byte("child"))
+		if err != nil {
+			return err
+		}
+		if child.Get([]byte("key")) != nil || child.Bucket([]byte("grandchild")) != nil {
+			return errors.New("CreateBucket: recreated bucket is not empty")
+		}
+
+		if err := parent.Delete([]byte("key")); err != nil {
+			return err
+		}
+		if parent.Get([]byte("key")) != nil {
+			return errors.New("Delete: deleted key found")
+		}
+		return nil
+	})
+}
+
+// testCursor ensures cursors iterate the keys and nested buckets of a bucket in
+// order.
+func testCursor(db database.DB) error {
+	keys := []string{"a", "b", "c", "d"}
+	err := db.Update(func(tx database.Tx) error {
+		b, err := tx.Metadata().CreateBucket([]byte("cursor"))
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := b.Put([]byte(k), []byte("v"+k)); err != nil {
+				return err
+			}
+		}
+		_, err = b.CreateBucket([]byte("nested"))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// Keys are ordered before nested buckets.
+	want := fmt.Sprint(append(keys, "nested"))
+	err = db.View(func(tx database.Tx) error {
+		c := tx.Metadata().Bucket([]byte("cursor")).Cursor()
+		var got []string
+		for ok := c.First(); ok; ok = c.Next() {
+			got = append(got, string(c.Key()))
+		}
+		if fmt.Sprint(got) != want {
+			return fmt.Errorf("Next: unexpected keys - got %v, want %v",
+				got, want)
+		}
+
+		got = got[:0]
+		for ok := c.Last(); ok; ok = c.Prev() {
+			got = append([]string{string(c.Key())}, got...)
+		}
+		if fmt.Sprint(got) != want {
+			return fmt.Errorf("Prev: unexpected keys - got %v, want %v",
+				got, want)
+		}
+
+		if !c.Last() || c.Value() != nil {
+			return fmt.Errorf("Value: unexpected value %q for nested "+
+				"bucket", c.Value())
+		}
+		if !c.Seek([]byte("bb")) || !bytes.Equal(c.Key(), []byte("c")) ||
+			!bytes.Equal(c.Value(), []byte("vc")) {
+
+			return fmt.Errorf("Seek: unexpected key %q", c.Key())
+		}
+		if !c.Next() || !bytes.Equal(c.Key(), []byte("d")) {
+			return fmt.Errorf("Next: unexpected key %q after seek",
+				c.Key())
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return db.Update(func(tx database.Tx) error {
+		b := tx.Metadata().Bucket([]byte("cursor"))
+		c := b.Cursor()
+		if !c.First() {
+			return errors.New("First: no keys")
+		}
+		if err := c.Delete(); err != nil {
+			return err
+		}
+		if !c.Next() || !bytes.Equal(c.Key(), []byte("b")) {
+			return fmt.Errorf("Next: unexpected key %q after delete",
+				c.Key())
+		}
+		if b.Get([]byte("a")) != nil {
+			return errors.New("Delete: deleted key found")
+		}
+		if !c.Last() {
+			return errors.New("Last: no keys")
+		}
+		return checkErrorCode("Delete bucket", c.Delete(),
+			database.ErrIncompatibleValue)
+	})
+}
+
+// testTransactions ensures the changes of transactions are only seen once
+// committed and closed transactions and databases are refused.
+func testTransactions(db database.DB) error {
+	key, value := []byte("key"), []byte("value")
+	errRollback := errors.New("rollback")
+	err := db.Update(func(tx database.Tx) error {
+		if err := tx.Metadata().Put(key, value); err != nil {
+			return err
+		}
+
+		// Other transactions don't see uncommitted changes.
+		err := db.View(func(tx database.Tx) error {
+			if tx.Metadata().Get(key) != nil {
+				return errors.New("View: uncommitted key found")
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if err != errRollback {
+		return fmt.Errorf("Update: unexpected error %v", err)
+	}
+
+	var closedTx database.Tx
+	err = db.View(func(tx database.Tx) error {
+		if tx.Metadata().Get(key) != nil {
+			return errors.New("View: rolled back key found")
+		}
+		err := checkErrorCode("Put read-only", tx.Metadata().Put(key, value),
+			database.ErrTxNotWritable)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Metadata().CreateBucket(key)
+		closedTx = tx
+		return checkErrorCode("CreateBucket read-only", err,
+			database.ErrTxNotWritable)
+	})
+	if err != nil {
+		return err
+	}
+	_, err = closedTx.HasBlock(params.PrivNetParams.GenesisHash)
+	if err := checkErrorCode("HasBlock closed", err, database.ErrTxClosed); err != nil {
+		return err
+	}
+
+	err = db.Update(func(tx database.Tx) error {
+		return tx.Metadata().Put(key, value)
+	})
+	if err != nil {
+		return err
+	}
+	err = db.View(func(tx database.Tx) error {
+		if got := tx.Metadata().Get(key); !bytes.Equal(got, value) {
+			return fmt.Errorf("Get: unexpected value - got %q, want %q",
+				got, value)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := db.Close(); err != nil {
+		return err
+	}
+	err = db.View(func(tx database.Tx) error {
+		return nil
+	})
+	return checkErrorCode("View closed", err, database.ErrDbNotOpen)
+}
+
+// testBlocks ensures blocks are stored and fetched as expected.
+func testBlocks(db database.DB) error {
+	block := types.NewBlock(params.PrivNetParams.GenesisBlock)
+	blockHash := block.Hash()
+	blockBytes, err := block.Bytes()
+	if err != nil {
+		return err
+	}
+
+	err = db.Update(func(tx database.Tx) error {
+		if err := tx.StoreBlock(block); err != nil {
+			return err
+		}
+		return checkErrorCode("StoreBlock existing", tx.StoreBlock(block),
+			database.ErrBlockExists)
+	})
+	if err != nil {
+		return err
+	}
+
+	return db.View(func(tx database.Tx) error {
+		err := checkErrorCode("StoreBlock read-only", tx.StoreBlock(block),
+			database.ErrTxNotWritable)
+		if err != nil {
+			return err
+		}
+
+		if has, err := tx.HasBlock(blockHash); err != nil || !has {
+			return fmt.Errorf("HasBlock: unexpected result %v (%v)",
+				has, err)
+		}
+		got, err := tx.FetchBlock(blockHash)
+		if err != nil || !bytes.Equal(got, blockBytes) {
+			return fmt.Errorf("FetchBlock: unexpected block (%v)", err)
+		}
+		got, err = tx.FetchBlockHeader(blockHash)
+		if err != nil || !bytes.Equal(got, blockBytes[:types.MaxBlockHeaderPayload]) {
+			return fmt.Errorf("FetchBlockHeader: unexpected header (%v)",
+				err)
+		}
+		region := database.BlockRegion{Hash: blockHash, Offset: 4, Len: 32}
+		got, err = tx.FetchBlockRegion(&region)
+		if err != nil || !bytes.Equal(got, blockBytes[4:36]) {
+			return fmt.Errorf("FetchBlockRegion: unexpected region (%v)",
+				err)
+		}
+		region.Offset = uint32(len(blockBytes)) - 1
+		_, err = tx.FetchBlockRegion(&region)
+		err = checkErrorCode("FetchBlockRegion invalid", err,
+			database.ErrBlockRegionInvalid)
+		if err != nil {
+			return err
+		}
+
+		missing := *blockHash
+		missing[0] ^= 0xff
+		if has, err := tx.HasBlock(&missing); err != nil || has {
+			return fmt.Errorf("HasBlock: unexpected result %v (%v)",
+				has, err)
+		}
+		_, err = tx.FetchBlock(&missing)
+		return checkErrorCode("FetchBlock missing", err,
+			database.ErrBlockNotFound)
+	})
+}
@@ -0,0 +1,1193 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package memdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/database"
+	"github.com/btceasypay/bitcoinpay/database/ffldb/treap"
+)
+
+const (
+	// blockHdrSize is the size of a block header.  This is simply the
+	// constant from wire and is only provided here for convenience since
+	// wire.MaxBlockHeaderPayload is quite long.
+	blockHdrSize = types.MaxBlockHeaderPayload
+)
+
+var (
+	// bucketIndexPrefix is the prefix used for all entries in the bucket
+	// index.
+	bucketIndexPrefix = []byte("bidx")
+
+	// curBucketIDKeyName is the name of the key used to keep track of the
+	// current bucket ID counter.
+	curBucketIDKeyName = []byte("bidx-cbid")
+
+	// metadataBucketID is the ID of the top-level metadata bucket.
+	// It is the value 0 encoded as an unsigned big-endian uint32.
+	metadataBucketID = [4]byte{}
+)
+
+// Common error strings.
+const (
+	// errDbNotOpenStr is the text to use for the database.ErrDbNotOpen
+	// error code.
+	errDbNotOpenStr = "database is not open"
+
+	// errTxClosedStr is the text to use for the database.ErrTxClosed error
+	// code.
+	errTxClosedStr = "database tx is closed"
+)
+
+// makeDbErr creates a database.Error given a set of arguments.
+func makeDbErr(c database.ErrorCode, desc string, err error) database.Error {
+	return database.Error{ErrorCode: c, Description: desc, Err: err}
+}
+
+// prefixLimit returns the exclusive limit key of the range of all keys with the
+// prefix, or nil when there is none.
+func prefixLimit(prefix []byte) []byte {
+	limit := make([]byte, len(prefix))
+	copy(limit, prefix)
+	for i := len(limit) - 1; i >= 0; i-- {
+		if limit[i] < 0xff {
+			limit[i]++
+			return limit[:i+1]
+		}
+	}
+	return nil
+}
+
+// rangeIterator is a treap iterator over the keys with a prefix.
+type rangeIterator struct {
+	*treap.Iterator
+	start []byte
+	limit []byte
+}
+
+// newRangeIterator returns an iterator over the keys of the treap with the
+// prefix.
+func newRangeIterator(t *treap.Immutable, prefix []byte) *rangeIterator {
+	limit := prefixLimit(prefix)
+	return &rangeIterator{
+		Iterator: t.Iterator(prefix, limit),
+		start:    prefix,
+		limit:    limit,
+	}
+}
+
+// Seek moves the iterator to the first key that is greater than or equal to
+// the given key, which may be outside of the range of the iterator.
+func (iter *rangeIterator) Seek(key []byte) bool {
+	if bytes.Compare(key, iter.start) < 0 {
+		return iter.First()
+	}
+	if iter.limit != nil && bytes.Compare(key, iter.limit) >= 0 {
+		key = iter.limit
+	}
+	return iter.Iterator.Seek(key)
+}
+
+// cursor is an internal type used to represent a cursor over key/value pairs
+// and nested buckets of a bucket and implements the database.Cursor interface.
+// It iterates the treaps of the transaction at the time it was created, so the
+// keys it deletes don't move it.
+type cursor struct {
+	bucket     *bucket
+	keyIter    *rangeIterator
+	bucketIter *rangeIterator
+	current    *rangeIterator
+}
+
+// Enforce cursor implements the database.Cursor interface.
+var _ database.Cursor = (*cursor)(nil)
+
+// Bucket returns the bucket the cursor was created for.
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) Bucket() database.Bucket {
+	// Ensure transaction state is valid.
+	if err := c.bucket.tx.checkClosed(); err != nil {
+		return nil
+	}
+
+	return c.bucket
+}
+
+// Delete removes the current key/value pair the cursor is at without
+// invalidating the cursor.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrIncompatibleValue if attempted when the cursor points to a nested
+//     bucket
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) Delete() error {
+	// Ensure transaction state is valid.
+	if err := c.bucket.tx.checkClosed(); err != nil {
+		return err
+	}
+
+	// Ensure the transaction is writable.
+	if !c.bucket.tx.writable {
+		str := "deleting a value requires a writable database transaction"
+		return makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+
+	// Error if the cursor is exhausted.
+	if c.current == nil {
+		str := "cursor is exhausted"
+		return makeDbErr(database.ErrIncompatibleValue, str, nil)
+	}
+
+	// Do not allow buckets to be deleted via the cursor.
+	if c.current == c.bucketIter {
+		str := "buckets may not be deleted from a cursor"
+		return makeDbErr(database.ErrIncompatibleValue, str, nil)
+	}
+
+	c.bucket.tx.deleteKey(c.current.Key())
+	return nil
+}
+
+// chooseIterator sets the current iterator to the valid one with the smaller
+// key when the cursor is moved forwards, or the larger key when it is moved
+// backwards.
+func (c *cursor) chooseIterator(forwards bool) bool {
+	keyValid, bucketValid := c.keyIter.Valid(), c.bucketIter.Valid()
+	switch {
+	case !keyValid && !bucketValid:
+		c.current = nil
+		return false
+	case !bucketValid:
+		c.current = c.keyIter
+	case !keyValid:
+		c.current = c.bucketIter
+	default:
+		compare := bytes.Compare(c.keyIter.Key(), c.bucketIter.Key())
+		if (forwards && compare > 0) || (!forwards && compare < 0) {
+			c.current = c.bucketIter
+		} else {
+			c.current = c.keyIter
+		}
+	}
+	return true
+}
+
+// First positions the cursor at the first key/value pair and returns whether or
+// not the pair exists.
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) First() bool {
+	// Ensure transaction state is valid.
+	if err := c.bucket.tx.checkClosed(); err != nil {
+		return false
+	}
+
+	c.keyIter.First()
+	c.bucketIter.First()
+	return c.chooseIterator(true)
+}
+
+// Last positions the cursor at the last key/value pair and returns whether or
+// not the pair exists.
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) Last() bool {
+	// Ensure transaction state is valid.
+	if err := c.bucket.tx.checkClosed(); err != nil {
+		return false
+	}
+
+	c.keyIter.Last()
+	c.bucketIter.Last()
+	return c.chooseIterator(false)
+}
+
+// Next moves the cursor one key/value pair forward and returns whether or not
+// the pair exists.
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) Next() bool {
+	// Ensure transaction state is valid.
+	if err := c.bucket.tx.checkClosed(); err != nil {
+		return false
+	}
+
+	// Nothing to return if cursor is exhausted.
+	if c.current == nil {
+		return false
+	}
+
+	// Move both iterators after the current key, so the cursor can change
+	// direction.
+	key := c.current.Key()
+	for _, iter := range []*rangeIterator{c.keyIter, c.bucketIter} {
+		if iter.Seek(key) && bytes.Equal(iter.Key(), key) {
+			iter.Next()
+		}
+	}
+	return c.chooseIterator(true)
+}
+
+// Prev moves the cursor one key/value pair backward and returns whether or not
+// the pair exists.
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) Prev() bool {
+	// Ensure transaction state is valid.
+	if err := c.bucket.tx.checkClosed(); err != nil {
+		return false
+	}
+
+	// Nothing to return if cursor is exhausted.
+	if c.current == nil {
+		return false
+	}
+
+	// Move both iterators before the current key, so the cursor can change
+	// direction.
+	key := c.current.Key()
+	for _, iter := range []*rangeIterator{c.keyIter, c.bucketIter} {
+		if iter.Seek(key) {
+			iter.Prev()
+		} else {
+			iter.Last()
+		}
+	}
+	return c.chooseIterator(false)
+}
+
+// Seek positions the cursor at the first key/value pair that is greater than or
+// equal to the passed seek key.  Returns false if no suitable key was found.
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) Seek(seek []byte) bool {
+	// Ensure transaction state is valid.
+	if err := c.bucket.tx.checkClosed(); err != nil {
+		return false
+	}
+
+	c.keyIter.Seek(bucketizedKey(c.bucket.id, seek))
+	c.bucketIter.Seek(bucketIndexKey(c.bucket.id, seek))
+	return c.chooseIterator(true)
+}
+
+// Key returns the current key the cursor is pointing to.
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) Key() []byte {
+	// Ensure transaction state is valid.
+	if err := c.bucket.tx.checkClosed(); err != nil {
+		return nil
+	}
+
+	// Nothing to return if cursor is exhausted.
+	if c.current == nil {
+		return nil
+	}
+
+	// The key is after the bucket index prefix and parent ID when the
+	// cursor is pointing to a nested bucket, and after the bucket ID
+	// otherwise.
+	if c.current == c.bucketIter {
+		return c.current.Key()[len(bucketIndexPrefix)+4:]
+	}
+	return c.current.Key()[len(c.bucket.id):]
+}
+
+// Value returns the current value the cursor is pointing to.  This will be nil
+// for nested buckets.
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) Value() []byte {
+	// Ensure transaction state is valid.
+	if err := c.bucket.tx.checkClosed(); err != nil {
+		return nil
+	}
+
+	// Nothing to return if cursor is exhausted or pointing to a nested
+	// bucket.
+	if c.current == nil || c.current == c.bucketIter {
+		return nil
+	}
+	return c.current.Value()
+}
+
+// newCursor returns a new cursor over the keys and nested buckets of the
+// bucket.
+func newCursor(b *bucket) *cursor {
+	return &cursor{
+		bucket:     b,
+		keyIter:    newRangeIterator(b.tx.meta, b.id[:]),
+		bucketIter: newRangeIterator(b.tx.meta, bucketIndexKey(b.id, nil)),
+	}
+}
+
+// bucket is an internal type used to represent a collection of key/value pairs
+// and implements the database.Bucket interface.
+type bucket struct {
+	tx *transaction
+	id [4]byte
+}
+
+// Enforce bucket implements the database.Bucket interface.
+var _ database.Bucket = (*bucket)(nil)
+
+// bucketIndexKey returns the actual key to use for storing and retrieving a
+// child bucket in the bucket index.  This is required because additional
+// information is needed to distinguish nested buckets with the same name.
+func bucketIndexKey(parentID [4]byte, key []byte) []byte {
+	// The serialized bucket index key format is:
+	//   <bucketindexprefix><parentbucketid><bucketname>
+	indexKey := make([]byte, len(bucketIndexPrefix)+4+len(key))
+	copy(indexKey, bucketIndexPrefix)
+	copy(indexKey[len(bucketIndexPrefix):], parentID[:])
+	copy(indexKey[len(bucketIndexPrefix)+4:], key)
+	return indexKey
+}
+
+// bucketizedKey returns the actual key to use for storing and retrieving a key
+// for the provided bucket ID.  This is required because bucketizing is handled
+// through the use of a unique prefix per bucket.
+func bucketizedKey(bucketID [4]byte, key []byte) []byte {
+	// The serialized block index key format is:
+	//   <bucketid><key>
+	bKey := make([]byte, 4+len(key))
+	copy(bKey, bucketID[:])
+	copy(bKey[4:], key)
+	return bKey
+}
+
+// Bucket retrieves a nested bucket with the given key.  Returns nil if
+// the bucket does not exist.
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) Bucket(key []byte) database.Bucket {
+	// Ensure transaction state is valid.
+	if err := b.tx.checkClosed(); err != nil {
+		return nil
+	}
+
+	// Attempt to fetch the ID for the child bucket.  The bucket does not
+	// exist if the bucket index entry does not exist.
+	childID := b.tx.meta.Get(bucketIndexKey(b.id, key))
+	if childID == nil {
+		return nil
+	}
+
+	childBucket := &bucket{tx: b.tx}
+	copy(childBucket.id[:], childID)
+	return childBucket
+}
+
+// CreateBucket creates and returns a new nested bucket with the given key.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrBucketExists if the bucket already exists
+//   - ErrBucketNameRequired if the key is empty
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) CreateBucket(key []byte) (database.Bucket, error) {
+	// Ensure transaction state is valid.
+	if err := b.tx.checkClosed(); err != nil {
+		return nil, err
+	}
+
+	// Ensure the transaction is writable.
+	if !b.tx.writable {
+		str := "create bucket requires a writable database transaction"
+		return nil, makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+
+	// Ensure a key was provided.
+	if len(key) == 0 {
+		str := "create bucket requires a key"
+		return nil, makeDbErr(database.ErrBucketNameRequired, str, nil)
+	}
+
+	// Ensure bucket does not already exist.
+	bidxKey := bucketIndexKey(b.id, key)
+	if b.tx.meta.Has(bidxKey) {
+		str := "bucket already exists"
+		return nil, makeDbErr(database.ErrBucketExists, str, nil)
+	}
+
+	// Add the new bucket to the bucket index.
+	childID := b.tx.nextBucketID()
+	b.tx.putKey(bidxKey, childID[:])
+	return &bucket{tx: b.tx, id: childID}, nil
+}
+
+// CreateBucketIfNotExists creates and returns a new nested bucket with the
+// given key if it does not already exist.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrBucketNameRequired if the key is empty
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) CreateBucketIfNotExists(key []byte) (database.Bucket, error) {
+	// Ensure transaction state is valid.
+	if err := b.tx.checkClosed(); err != nil {
+		return nil, err
+	}
+
+	// Ensure the transaction is writable.
+	if !b.tx.writable {
+		str := "create bucket requires a writable database transaction"
+		return nil, makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+
+	// Return existing bucket if it already exists, otherwise create it.
+	if bucket := b.Bucket(key); bucket != nil {
+		return bucket, nil
+	}
+	return b.CreateBucket(key)
+}
+
+// DeleteBucket removes a nested bucket with the given key.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrBucketNotFound if the specified bucket does not exist
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) DeleteBucket(key []byte) error {
+	// Ensure transaction state is valid.
+	if err := b.tx.checkClosed(); err != nil {
+		return err
+	}
+
+	// Ensure the transaction is writable.
+	if !b.tx.writable {
+		str := "delete bucket requires a writable database transaction"
+		return makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+
+	// Attempt to fetch the ID for the child bucket.  The bucket does not
+	// exist if the bucket index entry does not exist.
+	bidxKey := bucketIndexKey(b.id, key)
+	childID := b.tx.meta.Get(bidxKey)
+	if childID == nil {
+		str := fmt.Sprintf("bucket %q does not exist", key)
+		return makeDbErr(database.ErrBucketNotFound, str, nil)
+	}
+
+	// Remove all nested buckets and their keys.  The iterators walk the
+	// treap from before the deletions.
+	childIDs := [][]byte{childID}
+	for len(childIDs) > 0 {
+		childID = childIDs[len(childIDs)-1]
+		childIDs = childIDs[:len(childIDs)-1]
+
+		var id [4]byte
+		copy(id[:], childID)
+		c := newCursor(&bucket{tx: b.tx, id: id})
+		for ok := c.keyIter.First(); ok; ok = c.keyIter.Next() {
+			b.tx.deleteKey(c.keyIter.Key())
+		}
+		for ok := c.bucketIter.First(); ok; ok = c.bucketIter.Next() {
+			childIDs = append(childIDs, c.bucketIter.Value())
+			b.tx.deleteKey(c.bucketIter.Key())
+		}
+	}
+
+	b.tx.deleteKey(bidxKey)
+	return nil
+}
+
+// Cursor returns a new cursor, allowing for iteration over the bucket's
+// key/value pairs and nested buckets in forward or backward order.
+//
+// You must seek to a position using the First, Last, or Seek functions before
+// calling the Next, Prev, Key, or Value functions.  Failure to do so will
+// result in the same return values as an exhausted cursor, which is false for
+// the Prev and Next functions and nil for Key and Value functions.
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) Cursor() database.Cursor {
+	return newCursor(b)
+}
+
+// ForEach invokes the passed function with every key/value pair in the bucket.
+// This does not include nested buckets or the key/value pairs within those
+// nested buckets.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) ForEach(fn func(k, v []byte) error) error {
+	// Ensure transaction state is valid.
+	if err := b.tx.checkClosed(); err != nil {
+		return err
+	}
+
+	// Invoke the callback for each key.  Return the error returned from
+	// the callback when it is non-nil.
+	iter := newCursor(b).keyIter
+	for ok := iter.First(); ok; ok = iter.Next() {
+		err := fn(iter.Key()[len(b.id):], iter.Value())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ForEachBucket invokes the passed function with the key of every nested bucket
+// in the current bucket.  This does not include any nested buckets within those
+// nested buckets.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) ForEachBucket(fn func(k []byte) error) error {
+	// Ensure transaction state is valid.
+	if err := b.tx.checkClosed(); err != nil {
+		return err
+	}
+
+	// Invoke the callback for each nested bucket.  Return the error
+	// returned from the callback when it is non-nil.
+	iter := newCursor(b).bucketIter
+	for ok := iter.First(); ok; ok = iter.Next() {
+		err := fn(iter.Key()[len(bucketIndexPrefix)+4:])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Writable returns whether or not the bucket is writable.
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) Writable() bool {
+	return b.tx.writable
+}
+
+// Put saves the specified key/value pair to the bucket.  Keys that do not
+// already exist are added and keys that already exist are overwritten.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrKeyRequired if the key is empty
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) Put(key, value []byte) error {
+	// Ensure transaction state is valid.
+	if err := b.tx.checkClosed(); err != nil {
+		return err
+	}
+
+	// Ensure the transaction is writable.
+	if !b.tx.writable {
+		str := "setting a key requires a writable database transaction"
+		return makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+
+	// Ensure a key was provided.
+	if len(key) == 0 {
+		str := "put requires a key"
+		return makeDbErr(database.ErrKeyRequired, str, nil)
+	}
+
+	b.tx.putKey(bucketizedKey(b.id, key), value)
+	return nil
+}
+
+// Get returns the value for the given key.  Returns nil if the key does not
+// exist in this bucket.  An empty slice is returned for keys that exist but
+// have no value assigned.
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) Get(key []byte) []byte {
+	// Ensure transaction state is valid.
+	if err := b.tx.checkClosed(); err != nil {
+		return nil
+	}
+
+	// Nothing to return if there is no key.
+	if len(key) == 0 {
+		return nil
+	}
+
+	return b.tx.meta.Get(bucketizedKey(b.id, key))
+}
+
+// Delete removes the specified key from the bucket.  Deleting a key that does
+// not exist does not return an error.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrKeyRequired if the key is empty
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) Delete(key []byte) error {
+	// Ensure transaction state is valid.
+	if err := b.tx.checkClosed(); err != nil {
+		return err
+	}
+
+	// Ensure the transaction is writable.
+	if !b.tx.writable {
+		str := "deleting a value requires a writable database transaction"
+		return makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+
+	// Nothing to do if there is no key.
+	if len(key) == 0 {
+		return nil
+	}
+
+	b.tx.deleteKey(bucketizedKey(b.id, key))
+	return nil
+}
+
+// transaction represents a database transaction.  It can either be read-only or
+// read-write and implements the database.Tx interface.  The metadata and the
+// blocks are immutable treaps, a writable transaction replaces them with the
+// updated treaps and commits by handing those to the database.
+type transaction struct {
+	managed    bool // Is the transaction managed?
+	closed     bool // Is the transaction closed?
+	writable   bool // Is the transaction writable?
+	db         *db  // DB instance the tx was created from.
+	metaBucket *bucket
+
+	meta   *treap.Immutable
+	blocks *treap.Immutable
+}
+
+// Enforce transaction implements the database.Tx interface.
+var _ database.Tx = (*transaction)(nil)
+
+// checkClosed returns an error if the the database or transaction is closed.
+func (tx *transaction) checkClosed() error {
+	// The transaction is no longer valid if it has been closed.
+	if tx.closed {
+		return makeDbErr(database.ErrTxClosed, errTxClosedStr, nil)
+	}
+
+	return nil
+}
+
+// putKey adds the provided key to the metadata of the transaction.
+func (tx *transaction) putKey(key, value []byte) {
+	tx.meta = tx.meta.Put(key, value)
+}
+
+// deleteKey removes the provided key from the metadata of the transaction.
+func (tx *transaction) deleteKey(key []byte) {
+	tx.meta = tx.meta.Delete(key)
+}
+
+// nextBucketID returns the next bucket ID to use for creating a new bucket.
+func (tx *transaction) nextBucketID() [4]byte {
+	curBucketNum := binary.BigEndian.Uint32(tx.meta.Get(curBucketIDKeyName))
+
+	var nextBucketID [4]byte
+	binary.BigEndian.PutUint32(nextBucketID[:], curBucketNum+1)
+	tx.putKey(curBucketIDKeyName, nextBucketID[:])
+	return nextBucketID
+}
+
+// Metadata returns the top-most bucket for all metadata storage.
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) Metadata() database.Bucket {
+	return tx.metaBucket
+}
+
+// StoreBlock stores the provided block into the database.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrBlockExists when the block hash already exists
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) StoreBlock(block *types.SerializedBlock) error {
+	// Ensure transaction state is valid.
+	if err := tx.checkClosed(); err != nil {
+		return err
+	}
+
+	// Ensure the transaction is writable.
+	if !tx.writable {
+		str := "store block requires a writable database transaction"
+		return makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+
+	// Reject the block if it already exists.
+	blockHash := block.Hash()
+	if tx.blocks.Has(blockHash[:]) {
+		str := fmt.Sprintf("block %s already exists", blockHash)
+		return makeDbErr(database.ErrBlockExists, str, nil)
+	}
+
+	blockBytes, err := block.Bytes()
+	if err != nil {
+		str := fmt.Sprintf("failed to get serialized bytes for block %s",
+			blockHash)
+		return makeDbErr(database.ErrDriverSpecific, str, err)
+	}
+
+	tx.blocks = tx.blocks.Put(blockHash[:], blockBytes)
+	dblog.Trace("Stored block", "hash", blockHash)
+	return nil
+}
+
+// HasBlock returns whether or not a block with the given hash exists in the
+// database.
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) HasBlock(hash *hash.Hash) (bool, error) {
+	// Ensure transaction state is valid.
+	if err := tx.checkClosed(); err != nil {
+		return false, err
+	}
+
+	return tx.blocks.Has(hash[:]), nil
+}
+
+// HasBlocks returns whether or not the blocks with the provided hashes exist in
+// the database.
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) HasBlocks(hashes []hash.Hash) ([]bool, error) {
+	// Ensure transaction state is valid.
+	if err := tx.checkClosed(); err != nil {
+		return nil, err
+	}
+
+	results := make([]bool, len(hashes))
+	for i := range hashes {
+		results[i] = tx.blocks.Has(hashes[i][:])
+	}
+
+	return results, nil
+}
+
+// fetchBlock returns the serialized block of the hash.
+func (tx *transaction) fetchBlock(hash *hash.Hash) ([]byte, error) {
+	blockBytes := tx.blocks.Get(hash[:])
+	if blockBytes == nil {
+		str := fmt.Sprintf("block %s does not exist", hash)
+		return nil, makeDbErr(database.ErrBlockNotFound, str, nil)
+	}
+
+	return blockBytes, nil
+}
+
+// FetchBlockHeader returns the raw serialized bytes for the block header
+// identified by the given hash.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrBlockNotFound if the requested block hash does not exist
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) FetchBlockHeader(hash *hash.Hash) ([]byte, error) {
+	// Ensure transaction state is valid.
+	if err := tx.checkClosed(); err != nil {
+		return nil, err
+	}
+
+	blockBytes, err := tx.fetchBlock(hash)
+	if err != nil {
+		return nil, err
+	}
+	endOffset := blockHdrSize
+	if endOffset > len(blockBytes) {
+		endOffset = len(blockBytes)
+	}
+	return blockBytes[0:endOffset:endOffset], nil
+}
+
+// FetchBlockHeaders returns the raw serialized bytes for the block headers
+// identified by the given hashes.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrBlockNotFound if any of the request block hashes do not exist
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) FetchBlockHeaders(hashes []hash.Hash) ([][]byte, error) {
+	headers := make([][]byte, len(hashes))
+	for i := range hashes {
+		header, err := tx.FetchBlockHeader(&hashes[i])
+		if err != nil {
+			return nil, err
+		}
+		headers[i] = header
+	}
+
+	return headers, nil
+}
+
+// FetchBlock returns the raw serialized bytes for the block identified by the
+// given hash.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrBlockNotFound if the requested block hash does not exist
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) FetchBlock(hash *hash.Hash) ([]byte, error) {
+	// Ensure transaction state is valid.
+	if err := tx.checkClosed(); err != nil {
+		return nil, err
+	}
+
+	return tx.fetchBlock(hash)
+}
+
+// FetchBlocks returns the raw serialized bytes for the blocks identified by the
+// given hashes.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrBlockNotFound if any of the requested block hashed do not exist
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) FetchBlocks(hashes []hash.Hash) ([][]byte, error) {
+	blocks := make([][]byte, len(hashes))
+	for i := range hashes {
+		block, err := tx.FetchBlock(&hashes[i])
+		if err != nil {
+			return nil, err
+		}
+		blocks[i] = block
+	}
+
+	return blocks, nil
+}
+
+// FetchBlockRegion returns the raw serialized bytes for the given block region.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrBlockNotFound if the requested block hash does not exist
+//   - ErrBlockRegionInvalid if the region exceeds the bounds of the associated
+//     block
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) FetchBlockRegion(region *database.BlockRegion) ([]byte, error) {
+	// Ensure transaction state is valid.
+	if err := tx.checkClosed(); err != nil {
+		return nil, err
+	}
+
+	blockBytes, err := tx.fetchBlock(region.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ensure the region is within the bounds of the block.
+	blockLen := uint32(len(blockBytes))
+	endOffset := region.Offset + region.Len
+	if endOffset < region.Offset || endOffset > blockLen {
+		str := fmt.Sprintf("block %s region offset %d, length %d "+
+			"exceeds block length of %d", region.Hash,
+			region.Offset, region.Len, blockLen)
+		return nil, makeDbErr(database.ErrBlockRegionInvalid, str, nil)
+	}
+
+	return blockBytes[region.Offset:endOffset:endOffset], nil
+}
+
+// FetchBlockRegions returns the raw serialized bytes for the given block
+// regions.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrBlockNotFound if any of the requested block hashed do not exist
+//   - ErrBlockRegionInvalid if one or more region exceed the bounds of the
+//     associated block
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) FetchBlockRegions(regions []database.BlockRegion) ([][]byte, error) {
+	blockRegions := make([][]byte, len(regions))
+	for i := range regions {
+		regionBytes, err := tx.FetchBlockRegion(&regions[i])
+		if err != nil {
+			return nil, err
+		}
+		blockRegions[i] = regionBytes
+	}
+
+	return blockRegions, nil
+}
+
+// close marks the transaction closed then releases the transaction read lock,
+// and the write lock when the transaction is writable.
+func (tx *transaction) close() {
+	tx.closed = true
+	tx.meta = nil
+	tx.blocks = nil
+
+	tx.db.closeLock.RUnlock()
+
+	// Release the writer lock for writable transactions to unblock any
+	// other write transaction which are possibly waiting.
+	if tx.writable {
+		tx.db.writeLock.Unlock()
+	}
+}
+
+// Commit commits all changes that have been made to the metadata or block
+// storage.
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) Commit() error {
+	// Prevent commits on managed transactions.
+	if tx.managed {
+		tx.close()
+		panic("managed transaction commit not allowed")
+	}
+
+	// Ensure transaction state is valid.
+	if err := tx.checkClosed(); err != nil {
+		return err
+	}
+
+	// Regardless of whether the commit succeeds, the transaction is closed
+	// on return.
+	defer tx.close()
+
+	// Ensure the transaction is writable.
+	if !tx.writable {
+		str := "Commit requires a writable database transaction"
+		return makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+
+	tx.db.stateLock.Lock()
+	tx.db.meta = tx.meta
+	tx.db.blocks = tx.blocks
+	tx.db.stateLock.Unlock()
+	return nil
+}
+
+// Rollback undoes all changes that have been made to the metadata or block
+// storage.
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) Rollback() error {
+	// Prevent rollbacks on managed transactions.
+	if tx.managed {
+		tx.close()
+		panic("managed transaction rollback not allowed")
+	}
+
+	// Ensure transaction state is valid.
+	if err := tx.checkClosed(); err != nil {
+		return err
+	}
+
+	tx.close()
+	return nil
+}
+
+// db represents a collection of namespaces which are kept in memory and
+// implements the database.DB interface.  All database access is performed
+// through transactions which are obtained through the specific Namespace.
+type db struct {
+	writeLock sync.Mutex   // Limit to one write transaction at a time.
+	closeLock sync.RWMutex // Make database close block while txns active.
+	closed    bool         // Is the database closed?
+
+	// meta and blocks are the treaps of the last committed transaction.
+	stateLock sync.RWMutex
+	meta      *treap.Immutable
+	blocks    *treap.Immutable
+}
+
+// Enforce db implements the database.DB interface.
+var _ database.DB = (*db)(nil)
+
+// newDB returns a new empty memory database.
+func newDB() *db {
+	return &db{
+		meta:   treap.NewImmutable().Put(curBucketIDKeyName, metadataBucketID[:]),
+		blocks: treap.NewImmutable(),
+	}
+}
+
+// Type returns the database driver type the current database instance was
+// created with.
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) Type() string {
+	return dbType
+}
+
+// begin is the implementation function for the Begin database method.  See its
+// documentation for more details.
+//
+// This function is only separate because it returns the internal transaction
+// which is used by the managed transaction code while the database method
+// returns the interface.
+func (db *db) begin(writable bool) (*transaction, error) {
+	// Whenever a new writable transaction is started, grab the write lock
+	// to ensure only a single write transaction can be active at the same
+	// time.  This lock will not be released until the transaction is
+	// closed (via Rollback or Commit).
+	if writable {
+		db.writeLock.Lock()
+	}
+
+	// Whenever a new transaction is started, grab a read lock against the
+	// database to ensure Close will wait for the transaction to finish.
+	// This lock will not be released until the transaction is closed (via
+	// Rollback or Commit).
+	db.closeLock.RLock()
+	if db.closed {
+		db.closeLock.RUnlock()
+		if writable {
+			db.writeLock.Unlock()
+		}
+		return nil, makeDbErr(database.ErrDbNotOpen, errDbNotOpenStr,
+			nil)
+	}
+
+	db.stateLock.RLock()
+	tx := &transaction{
+		writable: writable,
+		db:       db,
+		meta:     db.meta,
+		blocks:   db.blocks,
+	}
+	db.stateLock.RUnlock()
+	tx.metaBucket = &bucket{tx: tx, id: metadataBucketID}
+	return tx, nil
+}
+
+// rollbackOnPanic rolls the passed transaction back if the code in the calling
+// function panics.  This is needed since the mutex on a transaction must be
+// released and a panic in called code would prevent that from happening.
+//
+// NOTE: This can only be handled manually for managed transactions since they
+// control the life-cycle of the transaction.  As the documentation on Begin
+// calls out, callers opting to use manual transactions will have to ensure the
+// transaction is rolled back on panic if it desires that functionality as well
+// or the database will fail to close since the read-lock will never be
+// released.
+func rollbackOnPanic(tx *transaction) {
+	if err := recover(); err != nil {
+		tx.managed = false
+		_ = tx.Rollback()
+		panic(err)
+	}
+}
+
+// View invokes the passed function in the context of a managed read-only
+// transaction with the root bucket for the namespace.  Any errors returned from
+// the user-supplied function are returned from this function.
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) View(fn func(database.Tx) error) error {
+	// Start a read-only transaction.
+	tx, err := db.begin(false)
+	if err != nil {
+		return err
+	}
+
+	// Since the user-provided function might panic, ensure the transaction
+	// releases all mutexes and resources.  There is no guarantee the caller
+	// won't use recover and keep going.  Thus, the database must still be
+	// in a usable state on panics due to caller issues.
+	defer rollbackOnPanic(tx)
+
+	tx.managed = true
+	err = fn(tx)
+	tx.managed = false
+	if err != nil {
+		// The error is ignored here because nothing was written yet
+		// and regardless of a rollback failure, the tx is closed now
+		// anyways.
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Rollback()
+}
+
+// Update invokes the passed function in the context of a managed read-write
+// transaction with the root bucket for the namespace.  Any errors returned from
+// the user-supplied function will cause the transaction to be rolled back and
+// are returned from this function.  Otherwise, the transaction is committed
+// when the user-supplied function returns a nil error.
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) Update(fn func(database.Tx) error) error {
+	// Start a read-write transaction.
+	tx, err := db.begin(true)
+	if err != nil {
+		return err
+	}
+
+	// Since the user-provided function might panic, ensure the transaction
+	// releases all mutexes and resources.  There is no guarantee the caller
+	// won't use recover and keep going.  Thus, the database must still be
+	// in a usable state on panics due to caller issues.
+	defer rollbackOnPanic(tx)
+
+	tx.managed = true
+	err = fn(tx)
+	tx.managed = false
+	if err != nil {
+		// The error is ignored here because nothing was written yet
+		// and regardless of a rollback failure, the tx is closed now
+		// anyways.
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Close cleanly shuts down the database and releases all data.  This function
+// will block until all database transactions have been finalized (rolled back
+// or committed).
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) Close() error {
+	// Since all transactions have a read lock on this mutex, this will
+	// cause Close to wait for all readers to complete.
+	db.closeLock.Lock()
+	defer db.closeLock.Unlock()
+
+	if db.closed {
+		return makeDbErr(database.ErrDbNotOpen, errDbNotOpenStr, nil)
+	}
+	db.closed = true
+
+	db.stateLock.Lock()
+	db.meta = nil
+	db.blocks = nil
+	db.stateLock.Unlock()
+	return nil
+}
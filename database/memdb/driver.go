@@ -0,0 +1,88 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package memdb
+
+import (
+	"fmt"
+	"github.com/btceasypay/bitcoinpay/core/protocol"
+	"github.com/btceasypay/bitcoinpay/database"
+	"github.com/btceasypay/bitcoinpay/log"
+)
+
+var dblog log.Logger
+
+const (
+	dbType = "memdb"
+)
+
+// parseArgs parses the arguments from the database Open/Create methods.  They
+// are the same as the ones of ffldb so the drivers can be swapped, but nothing
+// is written to the database path.
+func parseArgs(funcName string, args ...interface{}) (string, protocol.Network, error) {
+	if len(args) != 2 {
+		return "", 0, fmt.Errorf("invalid arguments to %s.%s -- "+
+			"expected database path and block network", dbType,
+			funcName)
+	}
+
+	dbPath, ok := args[0].(string)
+	if !ok {
+		return "", 0, fmt.Errorf("first argument to %s.%s is invalid -- "+
+			"expected database path string", dbType, funcName)
+	}
+
+	network, ok := args[1].(protocol.Network)
+	if !ok {
+		return "", 0, fmt.Errorf("second argument to %s.%s is invalid -- "+
+			"expected block network", dbType, funcName)
+	}
+
+	return dbPath, network, nil
+}
+
+// openDBDriver is the callback provided during driver registration that opens
+// an existing database for use.  A memory database is gone once it is closed,
+// so there is never one to open.
+func openDBDriver(args ...interface{}) (database.DB, error) {
+	dbPath, _, err := parseArgs("Open", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	str := fmt.Sprintf("database %q does not exist", dbPath)
+	return nil, makeDbErr(database.ErrDbDoesNotExist, str, nil)
+}
+
+// createDBDriver is the callback provided during driver registration that
+// creates, initializes, and opens a database for use.
+func createDBDriver(args ...interface{}) (database.DB, error) {
+	dbPath, _, err := parseArgs("Create", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	dblog.Debug("Created memory database", "path", dbPath)
+	return newDB(), nil
+}
+
+// useLogger is the callback provided during driver registration that sets the
+// current logger to the provided one.
+func useLogger(logger log.Logger) {
+	dblog = logger
+}
+
+func init() {
+	// Register the driver.
+	driver := database.Driver{
+		DbType:    dbType,
+		Create:    createDBDriver,
+		Open:      openDBDriver,
+		UseLogger: useLogger,
+	}
+	if err := database.RegisterDriver(driver); err != nil {
+		panic(fmt.Sprintf("Failed to regiser database driver '%s': %v",
+			dbType, err))
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import (
+	"encoding/binary"
+
+	"github.com/btceasypay/bitcoinpay/core/address"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/crypto/ecc"
+)
+
+// isAsset returns true if the script passed is a pay-to-pubkey-hash script
+// tagged with the asset ID and the amount of the asset it carries, false
+// otherwise.
+func isAsset(pops []ParsedOpcode) bool {
+	// The tag is dropped from the stack before the pubkey hash script
+	// runs:
+	//  <asset id> <amount> OP_2DROP OP_DUP OP_HASH160 <hash>
+	//  OP_EQUALVERIFY OP_CHECKSIG
+	return len(pops) == 8 &&
+		pops[0].opcode.value == OP_DATA_32 &&
+		pops[1].opcode.value == OP_DATA_8 &&
+		pops[2].opcode.value == OP_2DROP &&
+		isPubkeyHash(pops[3:])
+}
+
+// PayToAssetAddrScript creates a new script to pay a transaction output
+// carrying the amount of the asset to a secp256k1 pubkey hash address.
+func PayToAssetAddrScript(addr types.Address, id *types.AssetID,
+	amount uint64) ([]byte, error) {
+	pkh, ok := addr.(*address.PubKeyHashAddress)
+	if !ok || pkh.EcType() != ecc.ECDSA_Secp256k1 {
+		return nil, ErrUnsupportedAddress
+	}
+
+	var amountData [8]byte
+	binary.LittleEndian.PutUint64(amountData[:], amount)
+	return NewScriptBuilder().AddData(id[:]).AddData(amountData[:]).
+		AddOp(OP_2DROP).AddOp(OP_DUP).AddOp(OP_HASH160).
+		AddData(pkh.ScriptAddress()).AddOp(OP_EQUALVERIFY).
+		AddOp(OP_CHECKSIG).Script()
+}
+
+// ExtractAsset returns the asset ID and the amount of the asset carried by an
+// asset output script.  It returns false when the script is not an asset
+// script.
+func ExtractAsset(pkScript []byte) (types.AssetID, uint64, bool) {
+	var id types.AssetID
+	pops, err := parseScript(pkScript)
+	if err != nil || !isAsset(pops) {
+		return id, 0, false
+	}
+	copy(id[:], pops[0].data)
+	return id, binary.LittleEndian.Uint64(pops[1].data), true
+}
+
+// AssetMarkerScript returns the null data script which marks an asset issue
+// transaction, or the revocation of the asset by its issuer.
+func AssetMarkerScript(txType types.TxType, id *types.AssetID) ([]byte, error) {
+	return NewScriptBuilder().AddOp(OP_RETURN).
+		AddData(types.AssetMarkerData(txType, id)).Script()
+}
@@ -71,6 +71,11 @@ const (
 	// OP_UNKNOWN192) as the OP_SHA256 opcode which consumes the top item of
 	// the data stack and replaces it with the sha256 of it.
 	ScriptVerifySHA256
+
+	// ScriptVerifyCheckMultiSigAlt defines whether to treat opcode 193
+	// (previously OP_UNKNOWN193) as the OP_CHECKMULTISIGALT opcode which
+	// verifies multiple Ed25519 or secp256k1 Schnorr signatures.
+	ScriptVerifyCheckMultiSigAlt
 )
 
 const (
@@ -240,7 +240,7 @@ const (
 	OP_CHECKSIGALT         = 0xbe // 190 Alternative checksig op (ed25519/snnor)       //TODO, refactor name
 	OP_CHECKSIGALTVERIFY   = 0xbf // 191 Alternative checksigverify op (ed25519/snnor) //TODO, refactor name
 	OP_SHA256              = 0xc0 // 192
-	OP_UNKNOWN193          = 0xc1 // 193
+	OP_CHECKMULTISIGALT    = 0xc1 // 193 Alternative checkmultisig op (ed25519/schnorr)
 	OP_UNKNOWN194          = 0xc2 // 194
 	OP_UNKNOWN195          = 0xc3 // 195
 	OP_UNKNOWN196          = 0xc4 // 196
@@ -533,8 +533,10 @@ var opcodeArray = [256]Opcode{
 	OP_CHECKSIGALT:       {OP_CHECKSIGALT, "OP_CHECKSIGALT", 1, opcodeCheckSigAlt},
 	OP_CHECKSIGALTVERIFY: {OP_CHECKSIGALTVERIFY, "OP_CHECKSIGALTVERIFY", 1, opcodeCheckSigAltVerify},
 
+	// Alternative checkmultisig opcode.
+	OP_CHECKMULTISIGALT: {OP_CHECKMULTISIGALT, "OP_CHECKMULTISIGALT", 1, opcodeCheckMultiSigAlt},
+
 	// Undefined opcodes.
-	OP_UNKNOWN193: {OP_UNKNOWN193, "OP_UNKNOWN193", 1, opcodeNop},
 	OP_UNKNOWN194: {OP_UNKNOWN194, "OP_UNKNOWN194", 1, opcodeNop},
 	OP_UNKNOWN195: {OP_UNKNOWN195, "OP_UNKNOWN195", 1, opcodeNop},
 	OP_UNKNOWN196: {OP_UNKNOWN196, "OP_UNKNOWN196", 1, opcodeNop},
@@ -876,7 +878,7 @@ func opcodeNop(op *ParsedOpcode, vm *Engine) error {
 	switch op.opcode.value {
 	case OP_NOP1, OP_NOP4, OP_NOP5, OP_NOP6,
 		OP_NOP7, OP_NOP8, OP_NOP9, OP_NOP10,
-		OP_UNKNOWN193, OP_UNKNOWN194, OP_UNKNOWN195,
+		OP_UNKNOWN194, OP_UNKNOWN195,
 		OP_UNKNOWN196, OP_UNKNOWN197, OP_UNKNOWN198, OP_UNKNOWN199,
 		OP_UNKNOWN200, OP_UNKNOWN201, OP_UNKNOWN202, OP_UNKNOWN203,
 		OP_UNKNOWN204, OP_UNKNOWN205, OP_UNKNOWN206, OP_UNKNOWN207,
@@ -3047,6 +3049,180 @@ func opcodeCheckSigAltVerify(op *ParsedOpcode, vm *Engine) error {
 	return err
 }
 
+// altSigSuite returns the signature algorithm of the alternative signature
+// type and the length of its serialized public keys.
+func altSigSuite(sigType sigTypes) (ecc.DSA, int) {
+	switch sigType {
+	case edwards:
+		return ecc.Ed25519, 32
+	case secSchnorr:
+		return ecc.SecSchnorr, 33
+	}
+	return nil, 0
+}
+
+// opcodeCheckMultiSigAlt works like opcodeCheckMultiSig for the alternative
+// signature types of opcodeCheckSigAlt.  The top item on the stack is the
+// signature type, followed by the integer number of public keys, that many
+// public keys, the integer number of signatures and that many signatures.
+// Like opcodeCheckSigAlt, a zero signature type results in false and unknown
+// signature types result in true, so that future alternative signature
+// methods may be added.
+//
+// The opcode is treated as OP_UNKNOWN193 unless the flag to interpret it as
+// the OP_CHECKMULTISIGALT opcode is set.
+//
+// Stack transformation:
+// [... [sig ...] numsigs [pubkey ...] numpubkeys sigtype] -> [... bool]
+func opcodeCheckMultiSigAlt(op *ParsedOpcode, vm *Engine) error {
+	if !vm.hasFlag(ScriptVerifyCheckMultiSigAlt) {
+		if vm.hasFlag(ScriptDiscourageUpgradableNops) {
+			return errors.New("OP_UNKNOWN193 reserved for upgrades")
+		}
+		return nil
+	}
+
+	sigType, err := vm.dstack.PopInt(altSigSuitesMaxscriptNumLen)
+	if err != nil {
+		return err
+	}
+	switch sigTypes(sigType) {
+	case sigTypes(0):
+		// Zero case; pre-softfork clients will return 0 in this case as well.
+		vm.dstack.PushBool(false)
+		return nil
+	case edwards, secSchnorr:
+	default:
+		// Caveat: All unknown signature types return true, allowing for future
+		// softforks with other new signature types.
+		vm.dstack.PushBool(true)
+		return nil
+	}
+	suite, pubKeyLen := altSigSuite(sigTypes(sigType))
+
+	numKeys, err := vm.dstack.PopInt(mathOpCodeMaxScriptNumLen)
+	if err != nil {
+		return err
+	}
+
+	numPubKeys := int(numKeys.Int32())
+	if numPubKeys < 0 || numPubKeys > MaxPubKeysPerMultiSig {
+		return ErrStackTooManyPubKeys
+	}
+	vm.numOps += numPubKeys
+	if vm.numOps > MaxOpsPerScript {
+		return ErrStackTooManyOperations
+	}
+
+	pubKeys := make([][]byte, 0, numPubKeys)
+	for i := 0; i < numPubKeys; i++ {
+		pubKey, err := vm.dstack.PopByteArray()
+		if err != nil {
+			return err
+		}
+		pubKeys = append(pubKeys, pubKey)
+	}
+
+	numSigs, err := vm.dstack.PopInt(mathOpCodeMaxScriptNumLen)
+	if err != nil {
+		return err
+	}
+	numSignatures := int(numSigs.Int32())
+	if numSignatures < 0 {
+		return fmt.Errorf("number of signatures '%d' is less than 0",
+			numSignatures)
+	}
+	if numSignatures > numPubKeys {
+		return fmt.Errorf("more signatures than pubkeys: %d > %d",
+			numSignatures, numPubKeys)
+	}
+
+	signatures := make([][]byte, 0, numSignatures)
+	for i := 0; i < numSignatures; i++ {
+		signature, err := vm.dstack.PopByteArray()
+		if err != nil {
+			return err
+		}
+		signatures = append(signatures, signature)
+	}
+
+	// Get script starting from the most recent OP_CODESEPARATOR.
+	script := vm.subScript()
+
+	// Remove any of the signatures since there is no way for a signature to
+	// sign itself.
+	for _, signature := range signatures {
+		script = removeOpcodeByData(script, signature)
+	}
+
+	success := true
+	numPubKeys++
+	pubKeyIdx := -1
+	signatureIdx := 0
+	for numSignatures > 0 {
+		// When there are more signatures than public keys remaining,
+		// there is no way to succeed since too many signatures are
+		// invalid, so exit early.
+		pubKeyIdx++
+		numPubKeys--
+		if numSignatures > numPubKeys {
+			success = false
+			break
+		}
+
+		rawSig := signatures[signatureIdx]
+		pubKey := pubKeys[pubKeyIdx]
+
+		// Schnorr signatures are 65 bytes in length (64 bytes for
+		// [r,s] and 1 byte appened to the end for hashType), skip to
+		// the next pubkey if the signature is empty or has a wrong
+		// size.
+		if len(rawSig) != 65 {
+			continue
+		}
+
+		// Split the signature into hash type and signature components.
+		hashType := SigHashType(rawSig[len(rawSig)-1])
+		if err := vm.checkHashTypeEncoding(hashType); err != nil {
+			return err
+		}
+		signature, err := suite.ParseSignature(rawSig[:len(rawSig)-1])
+		if err != nil {
+			continue
+		}
+		if len(pubKey) != pubKeyLen {
+			continue
+		}
+		parsedPubKey, err := suite.ParsePubKey(pubKey)
+		if err != nil {
+			continue
+		}
+
+		// Generate the signature hash based on the signature hash type.
+		var prefixHash *hash.Hash
+		if hashType&sigHashMask == SigHashAll {
+			if optimizeSigVerification {
+				ph := vm.tx.CachedTxHash()
+				prefixHash = ph
+			}
+		}
+		h, err := calcSignatureHash(script, hashType, &vm.tx, vm.txIdx,
+			prefixHash)
+		if err != nil {
+			return err
+		}
+
+		if suite.Verify(parsedPubKey, h, signature.GetR(), signature.GetS()) {
+			// PubKey verified, move on to the next signature.
+			signatureIdx++
+			numSignatures--
+		}
+	}
+
+	vm.dstack.PushBool(success)
+	return nil
+}
+
 // OpcodeByName is a map that can be used to lookup an opcode by its
 // human-readable name (OP_CHECKMULTISIG, OP_CHECKSIG, etc).
 var OpcodeByName = make(map[string]byte)
@@ -285,8 +285,9 @@ func asSmallInt(op *Opcode) int {
 // getSigOpCount is the implementation function for counting the number of
 // signature operations in the script provided by pops. If precise mode is
 // requested then we attempt to count the number of operations for a multisig
-// op. Otherwise we use the maximum.
-func getSigOpCount(pops []ParsedOpcode, precise bool) int {
+// op. Otherwise we use the maximum.  OP_CHECKMULTISIGALT is only counted when
+// the flags interpret it, before it is an unknown opcode.
+func getSigOpCount(pops []ParsedOpcode, precise bool, flags ScriptFlags) int {
 	nSigs := 0
 	for i, pop := range pops {
 		switch pop.opcode.value {
@@ -312,6 +313,19 @@ func getSigOpCount(pops []ParsedOpcode, precise bool) int {
 			} else {
 				nSigs += MaxPubKeysPerMultiSig
 			}
+		case OP_CHECKMULTISIGALT:
+			if flags&ScriptVerifyCheckMultiSigAlt == 0 {
+				break
+			}
+			// The number of pubkeys is followed by the signature
+			// type.
+			if precise && i > 1 &&
+				pops[i-2].opcode.value >= OP_1 &&
+				pops[i-2].opcode.value <= OP_16 {
+				nSigs += asSmallInt(pops[i-2].opcode)
+			} else {
+				nSigs += MaxPubKeysPerMultiSig
+			}
 		default:
 			// Not a sigop.
 		}
@@ -322,28 +336,30 @@ func getSigOpCount(pops []ParsedOpcode, precise bool) int {
 
 // GetSigOpCount provides a quick count of the number of signature operations
 // in a script. a CHECKSIG operations counts for 1, and a CHECK_MULTISIG for 20.
-// If the script fails to parse, then the count up to the point of failure is
+// OP_CHECKMULTISIGALT counts for 20 as well when the flags interpret it.  If
+// the script fails to parse, then the count up to the point of failure is
 // returned.
-func GetSigOpCount(script []byte) int {
+func GetSigOpCount(script []byte, flags ScriptFlags) int {
 	// Don't check error since parseScript returns the parsed-up-to-error
 	// list of pops.
 	pops, _ := parseScript(script)
-	return getSigOpCount(pops, false)
+	return getSigOpCount(pops, false, flags)
 }
 
 // GetPreciseSigOpCount returns the number of signature operations in
 // scriptPubKey.  If bip16 is true then scriptSig may be searched for the
 // Pay-To-Script-Hash script in order to find the precise number of signature
-// operations in the transaction.  If the script fails to parse, then the count
-// up to the point of failure is returned.
-func GetPreciseSigOpCount(scriptSig, scriptPubKey []byte, bip16 bool) int {
+// operations in the transaction.  OP_CHECKMULTISIGALT is only counted when the
+// flags interpret it.  If the script fails to parse, then the count up to the
+// point of failure is returned.
+func GetPreciseSigOpCount(scriptSig, scriptPubKey []byte, bip16 bool, flags ScriptFlags) int {
 	// Don't check error since parseScript returns the parsed-up-to-error
 	// list of pops.
 	pops, _ := parseScript(scriptPubKey)
 
 	// Treat non P2SH transactions as normal.
 	if !(bip16 && isScriptHash(pops)) {
-		return getSigOpCount(pops, true)
+		return getSigOpCount(pops, true, flags)
 	}
 
 	// The public key script is a pay-to-script-hash, so parse the signature
@@ -373,7 +389,7 @@ func GetPreciseSigOpCount(scriptSig, scriptPubKey []byte, bip16 bool) int {
 	// dictate signature operations are counted up to the first parse
 	// failure.
 	shPops, _ := parseScript(shScript)
-	return getSigOpCount(shPops, true)
+	return getSigOpCount(shPops, true, flags)
 }
 
 // IsUnspendable returns whether the passed public key script is unspendable, or
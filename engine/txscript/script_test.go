@@ -0,0 +1,57 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestSigOpCountMultiSigAlt ensures OP_CHECKMULTISIGALT only counts as
+// signature operations once the flags interpret it, before its deployment is
+// active it is an unknown opcode.
+func TestSigOpCountMultiSigAlt(t *testing.T) {
+	builder := NewScriptBuilder().AddOp(OP_2)
+	for i := byte(1); i <= 3; i++ {
+		builder.AddData(bytes.Repeat([]byte{i}, 32))
+	}
+	script, err := builder.AddOp(OP_3).AddData([]byte{byte(edwards)}).
+		AddOp(OP_CHECKMULTISIGALT).Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigScript, err := NewScriptBuilder().AddOp(OP_0).AddData(script).Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2shScript, err := NewScriptBuilder().AddOp(OP_HASH160).
+		AddData(make([]byte, 20)).AddOp(OP_EQUAL).Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		flags   ScriptFlags
+		count   int
+		precise int
+	}{
+		{"before activation", 0, 0, 0},
+		{"active", ScriptVerifyCheckMultiSigAlt, MaxPubKeysPerMultiSig, 3},
+	}
+	for _, test := range tests {
+		if n := GetSigOpCount(script, test.flags); n != test.count {
+			t.Errorf("%s: got %d sigops, want %d", test.name, n, test.count)
+		}
+		if n := GetPreciseSigOpCount(nil, script, true, test.flags); n != test.precise {
+			t.Errorf("%s: got %d precise sigops, want %d", test.name, n,
+				test.precise)
+		}
+		if n := GetPreciseSigOpCount(sigScript, p2shScript, true, test.flags); n != test.precise {
+			t.Errorf("%s: got %d P2SH sigops, want %d", test.name, n,
+				test.precise)
+		}
+	}
+}
@@ -191,6 +191,34 @@ func signMultiSig(tx *types.Transaction, idx int, subScript []byte, hashType Sig
 	return script, signed == nRequired
 }
 
+// signMultiSigAlt signs as many of the outputs in the provided alternative
+// signature multisig script as possible, like signMultiSig.
+func signMultiSigAlt(tx *types.Transaction, idx int, subScript []byte, hashType SigHashType,
+	addresses []types.Address, nRequired int, kdb KeyDB) ([]byte, bool) {
+	builder := NewScriptBuilder()
+	signed := 0
+	for _, addr := range addresses {
+		key, _, err := kdb.GetKey(addr)
+		if err != nil {
+			continue
+		}
+		sig, err := RawTxInSignatureAlt(tx, idx, subScript, hashType, key,
+			sigTypes(addr.EcType()))
+		if err != nil {
+			continue
+		}
+
+		builder.AddData(sig)
+		signed++
+		if signed == nRequired {
+			break
+		}
+	}
+
+	script, _ := builder.Script()
+	return script, signed == nRequired
+}
+
 // handleStakeOutSign is a convenience function for reducing code clutter in
 // sign. It handles the signing of stake outputs.
 func handleStakeOutSign(chainParams *params.Params, tx *types.Transaction, idx int,
@@ -283,7 +311,7 @@ func sign(chainParams *params.Params, tx *types.Transaction, idx int,
 
 		return script, class, addresses, nrequired, nil
 
-	case PubKeyHashTy:
+	case PubKeyHashTy, AssetTy:
 		// look up key for address
 		key, compressed, err := kdb.GetKey(addresses[0])
 		if err != nil {
@@ -326,6 +354,11 @@ func sign(chainParams *params.Params, tx *types.Transaction, idx int,
 			addresses, nrequired, kdb)
 		return script, class, addresses, nrequired, nil
 
+	case MultiSigAltTy:
+		script, _ := signMultiSigAlt(tx, idx, subScript, hashType,
+			addresses, nrequired, kdb)
+		return script, class, addresses, nrequired, nil
+
 	case StakeSubmissionTy:
 		return handleStakeOutSign(chainParams, tx, idx, subScript, hashType, kdb,
 			sdb, addresses, class, subClass, nrequired)
@@ -405,6 +438,9 @@ func mergeScripts(chainParams *params.Params, tx *types.Transaction, idx int,
 	case MultiSigTy:
 		return mergeMultiSig(tx, idx, addresses, nRequired, pkScript,
 			sigScript, prevScript)
+	case MultiSigAltTy:
+		return mergeMultiSigAlt(tx, idx, addresses, nRequired, pkScript,
+			sigScript, prevScript)
 
 	// It doesn't actually make sense to merge anything other than multiig
 	// and scripthash (because it could contain multisig). Everything else
@@ -543,6 +579,100 @@ sigLoop:
 	return script
 }
 
+// mergeMultiSigAlt combines the two signature scripts sigScript and
+// prevScript that both provide signatures for the alternative signature
+// multisig pkScript in output idx of tx, like mergeMultiSig.
+func mergeMultiSigAlt(tx *types.Transaction, idx int, addresses []types.Address,
+	nRequired int, pkScript, sigScript, prevScript []byte) []byte {
+
+	// This is an internal only function and we already parsed this script
+	// as ok for alternative signature multisig.
+	pkPops, _ := parseScript(pkScript)
+	sigType, _ := ExtractPkScriptAltSigType(pkScript)
+	suite, _ := altSigSuite(sigTypes(sigType))
+
+	sigPops, err := parseScript(sigScript)
+	if err != nil || len(sigPops) == 0 {
+		return prevScript
+	}
+
+	prevPops, err := parseScript(prevScript)
+	if err != nil || len(prevPops) == 0 {
+		return sigScript
+	}
+
+	possibleSigs := make([][]byte, 0, len(sigPops)+len(prevPops))
+	for _, pops := range [][]ParsedOpcode{sigPops, prevPops} {
+		for _, pop := range pops {
+			if len(pop.data) != 0 {
+				possibleSigs = append(possibleSigs, pop.data)
+			}
+		}
+	}
+
+	// Match the signatures to the pubkeys verifying them, anything that
+	// doesn't parse or doesn't verify is thrown away.
+	addrToSig := make(map[string][]byte)
+sigLoop:
+	for _, sig := range possibleSigs {
+		if len(sig) < 1 {
+			continue
+		}
+		tSig := sig[:len(sig)-1]
+		hashType := SigHashType(sig[len(sig)-1])
+
+		pSig, err := suite.ParseSignature(tSig)
+		if err != nil {
+			continue
+		}
+
+		h, err := calcSignatureHash(pkPops, hashType, tx, idx, nil)
+		if err != nil {
+			continue
+		}
+
+		for _, addr := range addresses {
+			pubKey, err := suite.ParsePubKey(addr.ScriptAddress())
+			if err != nil {
+				continue
+			}
+
+			// We only can take one signature per public key so if
+			// we already have one, we can throw this away.
+			if suite.Verify(pubKey, h, pSig.GetR(), pSig.GetS()) {
+				aStr := addr.Encode()
+				if _, ok := addrToSig[aStr]; !ok {
+					addrToSig[aStr] = sig
+				}
+				continue sigLoop
+			}
+		}
+	}
+
+	builder := NewScriptBuilder()
+	doneSigs := 0
+	// This assumes that addresses are in the same order as in the script.
+	for _, addr := range addresses {
+		sig, ok := addrToSig[addr.Encode()]
+		if !ok {
+			continue
+		}
+		builder.AddData(sig)
+		doneSigs++
+		if doneSigs == nRequired {
+			break
+		}
+	}
+
+	// padding for missing ones.
+	for i := doneSigs; i < nRequired; i++ {
+		builder.AddOp(OP_0)
+	}
+
+	script, _ := builder.Script()
+	return script
+}
+
 // KeyDB is an interface type provided to SignTxOutput, it encapsulates
 // any user state required to get the private keys for an address.
 type KeyDB interface {
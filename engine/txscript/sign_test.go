@@ -0,0 +1,177 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import (
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/address"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/crypto/ecc"
+	"github.com/btceasypay/bitcoinpay/params"
+)
+
+func TestSignMultiSigAlt(t *testing.T) {
+	net := &params.PrivNetParams
+	suites := []struct {
+		dsa     ecc.DSA
+		newAddr func(pk []byte) (types.Address, error)
+	}{
+		{ecc.Ed25519, func(pk []byte) (types.Address, error) {
+			return address.NewEdwardsPubKeyAddress(pk, net)
+		}},
+		{ecc.SecSchnorr, func(pk []byte) (types.Address, error) {
+			return address.NewSecSchnorrPubKeyAddress(pk, net)
+		}},
+	}
+	for _, suite := range suites {
+		keys := make(map[string]ecc.PrivateKey)
+		addrs := make([]types.Address, 3)
+		for i := range addrs {
+			priv, _, _, err := suite.dsa.GenerateKey(rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			key, pub := suite.dsa.PrivKeyFromBytes(priv)
+			addrs[i], err = suite.newAddr(pub.Serialize())
+			if err != nil {
+				t.Fatal(err)
+			}
+			keys[addrs[i].Encode()] = key
+		}
+		pkScript, err := MultiSigAltScript(addrs, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if class := GetScriptClass(DefaultScriptVersion, pkScript); class != MultiSigAltTy {
+			t.Fatalf("script class %v, want %v", class, MultiSigAltTy)
+		}
+		class, extracted, nRequired, err := ExtractPkScriptAddrs(pkScript, net)
+		if err != nil || class != MultiSigAltTy || len(extracted) != 3 ||
+			nRequired != 2 {
+			t.Fatalf("extracted %v %v %d %v", class, extracted, nRequired, err)
+		}
+		if numPubKeys, numSigs, err := CalcMultiSigStats(pkScript); err != nil ||
+			numPubKeys != 3 || numSigs != 2 {
+			t.Fatalf("multisig stats %d %d %v", numPubKeys, numSigs, err)
+		}
+
+		tx := types.NewTransaction()
+		tx.AddTxIn(types.NewTxInput(types.NewOutPoint(&hash.Hash{1}, 0), nil))
+		tx.AddTxOut(types.NewTxOutput(1, pkScript))
+
+		// Each holder signs with a single key, the signatures are merged.
+		signWith := func(addr types.Address, prev []byte) []byte {
+			kdb := KeyClosure(func(a types.Address) (ecc.PrivateKey, bool, error) {
+				if a.Encode() != addr.Encode() {
+					return nil, false, errors.New("no key")
+				}
+				return keys[a.Encode()], true, nil
+			})
+			sigScript, err := SignTxOutput(net, tx, 0, pkScript, SigHashAll,
+				kdb, nil, prev, addr.EcType())
+			if err != nil {
+				t.Fatal(err)
+			}
+			return sigScript
+		}
+		execute := func(sigScript []byte, flags ScriptFlags) error {
+			tx.TxIn[0].SignScript = sigScript
+			vm, err := NewEngine(pkScript, tx, 0, flags, 0, nil)
+			if err != nil {
+				return err
+			}
+			return vm.Execute()
+		}
+		flags := ScriptBip16 | ScriptVerifyCleanStack | ScriptVerifyCheckMultiSigAlt
+		sigScript := signWith(addrs[2], nil)
+		if err := execute(sigScript, flags); err == nil {
+			t.Fatal("script with one of two signatures is valid")
+		}
+		sigScript = signWith(addrs[0], sigScript)
+		if err := execute(sigScript, flags); err != nil {
+			t.Fatalf("merged signatures: %v", err)
+		}
+		if err := execute(signWith(addrs[1], sigScript), flags); err != nil {
+			t.Fatalf("signatures merged with a third one: %v", err)
+		}
+
+		// The opcode is an upgradable NOP without the flag.
+		if err := execute(sigScript, ScriptBip16); err != nil {
+			t.Fatalf("opcode as a NOP: %v", err)
+		}
+		if err := execute(sigScript, ScriptBip16|ScriptDiscourageUpgradableNops); err == nil {
+			t.Fatal("upgradable NOP is not discouraged")
+		}
+	}
+}
+
+func TestSignAsset(t *testing.T) {
+	net := &params.PrivNetParams
+	priv, _, _, err := ecc.Secp256k1.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, pub := ecc.Secp256k1.PrivKeyFromBytes(priv)
+	pubAddr, err := address.NewSecpPubKeyCompressedAddress(pub, net)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := pubAddr.PKHAddress()
+	id := types.AssetID{1, 2, 3}
+	pkScript, err := PayToAssetAddrScript(addr, &id, 21)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if class := GetScriptClass(DefaultScriptVersion, pkScript); class != AssetTy {
+		t.Fatalf("script class %v, want %v", class, AssetTy)
+	}
+	if gotID, amount, ok := ExtractAsset(pkScript); !ok || gotID != id || amount != 21 {
+		t.Fatalf("extracted asset %v %d %v", gotID, amount, ok)
+	}
+	class, addrs, _, err := ExtractPkScriptAddrs(pkScript, net)
+	if err != nil || class != AssetTy || len(addrs) != 1 ||
+		addrs[0].Encode() != addr.Encode() {
+		t.Fatalf("extracted %v %v %v", class, addrs, err)
+	}
+	if _, err := PayToAssetAddrScript(pubAddr, &id, 21); err != ErrUnsupportedAddress {
+		t.Fatalf("asset script to a pubkey: %v", err)
+	}
+
+	tx := types.NewTransaction()
+	tx.AddTxIn(types.NewTxInput(types.NewOutPoint(&hash.Hash{1}, 0), nil))
+	tx.AddTxOut(types.NewTxOutput(1, pkScript))
+	kdb := KeyClosure(func(types.Address) (ecc.PrivateKey, bool, error) {
+		return key, true, nil
+	})
+	sigScript, err := SignTxOutput(net, tx, 0, pkScript, SigHashAll, kdb, nil,
+		nil, ecc.ECDSA_Secp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.TxIn[0].SignScript = sigScript
+	vm, err := NewEngine(pkScript, tx, 0, ScriptBip16|ScriptVerifyCleanStack, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.Execute(); err != nil {
+		t.Fatalf("asset output spend: %v", err)
+	}
+
+	marker, err := AssetMarkerScript(types.AssetRevoke, &id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if class := GetScriptClass(DefaultScriptVersion, marker); class != NullDataTy {
+		t.Fatalf("marker script class %v, want %v", class, NullDataTy)
+	}
+	if txType, gotID, ok := types.ParseAssetMarker(marker); !ok ||
+		txType != types.AssetRevoke || gotID != id {
+		t.Fatalf("parsed marker %v %v %v", txType, gotID, ok)
+	}
+}
@@ -39,6 +39,8 @@ const (
 	StakeSubChangeTy                     // Change for stake submission tx.
 	PubkeyAltTy                          // Alternative signature pubkey.
 	PubkeyHashAltTy                      // Alternative signature pubkey hash.
+	MultiSigAltTy                        // Alternative signature multi signature.
+	AssetTy                              // Asset tagged pay pubkey hash.
 )
 
 // Script Interface provide a abstract layer to support new Script parsing from opcode
@@ -120,11 +122,13 @@ var scriptClassToName = []string{
 	PubkeyHashAltTy:   "pubkeyhashalt",
 	ScriptHashTy:      "scripthash",
 	MultiSigTy:        "multisig",
+	MultiSigAltTy:     "multisigalt",
 	NullDataTy:        "nulldata",
 	StakeSubmissionTy: "stakesubmission",
 	StakeGenTy:        "stakegen",
 	StakeRevocationTy: "stakerevoke",
 	StakeSubChangeTy:  "sstxchange",
+	AssetTy:           "asset",
 }
 
 // String implements the Stringer interface by returning the name of
@@ -263,6 +267,45 @@ func isMultiSig(pops []ParsedOpcode) bool {
 	return true
 }
 
+// isMultiSigAlt returns true if the passed script is an alternative signature
+// multisig transaction, false otherwise.
+func isMultiSigAlt(pops []ParsedOpcode) bool {
+	// The absolute minimum is 1 pubkey:
+	// OP_0/OP_1-16 <pubkey> OP_1 <type> OP_CHECKMULTISIGALT
+	l := len(pops)
+	if l < 5 {
+		return false
+	}
+	if !isSmallInt(pops[0].opcode) {
+		return false
+	}
+	if !isSmallInt(pops[l-3].opcode) {
+		return false
+	}
+	if pops[l-1].opcode.value != OP_CHECKMULTISIGALT {
+		return false
+	}
+
+	// Verify the number of pubkeys specified matches the actual number
+	// of pubkeys provided.
+	if l-3-1 != asSmallInt(pops[l-3].opcode) {
+		return false
+	}
+
+	// Ed25519 pubkeys are 32 bytes and secp256k1 Schnorr pubkeys are 33
+	// bytes.
+	_, pubKeyLen := altSigSuite(sigTypes(extractOneBytePush(pops[l-2])))
+	if pubKeyLen == 0 {
+		return false
+	}
+	for _, pop := range pops[1 : l-3] {
+		if len(pop.data) != pubKeyLen {
+			return false
+		}
+	}
+	return true
+}
+
 // IsMultisigScript takes a script, parses it, then returns whether or
 // not it is a multisignature script.
 func IsMultisigScript(script []byte) (bool, error) {
@@ -288,7 +331,7 @@ func IsMultisigSigScript(script []byte) bool {
 		return false
 	}
 
-	return isMultiSig(subPops)
+	return isMultiSig(subPops) || isMultiSigAlt(subPops)
 }
 
 // isNullData returns true if the passed script is a null data transaction,
@@ -420,6 +463,8 @@ func typeOfScript(pops []ParsedOpcode) ScriptClass {
 		return ScriptHashTy
 	} else if isMultiSig(pops) {
 		return MultiSigTy
+	} else if isMultiSigAlt(pops) {
+		return MultiSigAltTy
 	} else if isNullData(pops) {
 		return NullDataTy
 	} else if isStakeSubmission(pops) {
@@ -430,6 +475,8 @@ func typeOfScript(pops []ParsedOpcode) ScriptClass {
 		return StakeRevocationTy
 	} else if isSStxChange(pops) {
 		return StakeSubChangeTy
+	} else if isAsset(pops) {
+		return AssetTy
 	}
 
 	return NonStandardTy
@@ -468,6 +515,9 @@ func expectedInputs(pops []ParsedOpcode, class ScriptClass,
 	case PubKeyHashTy:
 		return 2
 
+	case AssetTy:
+		return 2
+
 	case StakeSubmissionTy:
 		if subclass == PubKeyHashTy {
 			return 2
@@ -506,6 +556,10 @@ func expectedInputs(pops []ParsedOpcode, class ScriptClass,
 		// for the extra push that is required to compensate.
 		return asSmallInt(pops[0].opcode)
 
+	case MultiSigAltTy:
+		// Alternative signature multisig has no extra push either.
+		return asSmallInt(pops[0].opcode)
+
 	case NullDataTy:
 		fallthrough
 	default:
@@ -604,7 +658,7 @@ func ContainsStakeOpCodes(pkScript []byte) (bool, error) {
 // CalcScriptInfo returns a structure providing data about the provided script
 // pair.  It will error if the pair is in someway invalid such that they can not
 // be analysed, i.e. if they do not parse or the pkScript is not a push-only
-// script
+// script.  The signature operations of OP_CHECKMULTISIGALT are counted.
 func CalcScriptInfo(sigScript, pkScript []byte, bip16 bool) (*ScriptInfo, error) {
 	sigPops, err := parseScript(sigScript)
 	if err != nil {
@@ -657,9 +711,9 @@ func CalcScriptInfo(sigScript, pkScript []byte, bip16 bool) (*ScriptInfo, error)
 		} else {
 			si.ExpectedInputs += shInputs
 		}
-		si.SigOps = getSigOpCount(shPops, true)
+		si.SigOps = getSigOpCount(shPops, true, ScriptVerifyCheckMultiSigAlt)
 	} else {
-		si.SigOps = getSigOpCount(pkPops, true)
+		si.SigOps = getSigOpCount(pkPops, true, ScriptVerifyCheckMultiSigAlt)
 	}
 
 	return si, nil
@@ -667,7 +721,8 @@ func CalcScriptInfo(sigScript, pkScript []byte, bip16 bool) (*ScriptInfo, error)
 
 // CalcMultiSigStats returns the number of public keys and signatures from
 // a multi-signature transaction script.  The passed script MUST already be
-// known to be a multi-signature script.
+// known to be a multi-signature or an alternative signature multi-signature
+// script.
 func CalcMultiSigStats(script []byte) (int, int, error) {
 	pops, err := parseScript(script)
 	if err != nil {
@@ -685,8 +740,16 @@ func CalcMultiSigStats(script []byte) (int, int, error) {
 		return 0, 0, ErrStackUnderflow
 	}
 
+	// The number of pubkeys of an alternative signature multi-signature
+	// script is followed by the signature type:
+	//  NUM_SIGS PUBKEY PUBKEY... NUM_PUBKEYS TYPE OP_CHECKMULTISIGALT
+	numPubKeysLoc := len(pops) - 2
+	if pops[len(pops)-1].opcode.value == OP_CHECKMULTISIGALT {
+		numPubKeysLoc--
+	}
+
 	numSigs := asSmallInt(pops[0].opcode)
-	numPubKeys := asSmallInt(pops[len(pops)-2].opcode)
+	numPubKeys := asSmallInt(pops[numPubKeysLoc].opcode)
 	return numPubKeys, numSigs, nil
 }
 
@@ -1142,6 +1205,46 @@ func MultiSigScript(pubkeys []*address.SecpPubKeyAddress, nrequired int) ([]byte
 	return builder.Script()
 }
 
+// MultiSigAltScript returns a valid script for an alternative signature
+// multisignature redemption where nrequired of the keys in pubkeys are
+// required to have signed the transaction for success.  The keys must all be
+// either Ed25519 or secp256k1 Schnorr public key addresses.  An
+// ErrBadNumRequired will be returned if nrequired is larger than the number of
+// keys provided.
+func MultiSigAltScript(pubkeys []types.Address, nrequired int) ([]byte,
+	error) {
+	if len(pubkeys) < nrequired {
+		return nil, ErrBadNumRequired
+	}
+
+	var sigType sigTypes
+	for i, key := range pubkeys {
+		var keyType sigTypes
+		switch key.(type) {
+		case *address.EdwardsPubKeyAddress:
+			keyType = edwards
+		case *address.SecSchnorrPubKeyAddress:
+			keyType = secSchnorr
+		default:
+			return nil, ErrUnsupportedAddress
+		}
+		if i > 0 && keyType != sigType {
+			return nil, ErrUnsupportedAddress
+		}
+		sigType = keyType
+	}
+
+	builder := NewScriptBuilder().AddInt64(int64(nrequired))
+	for _, key := range pubkeys {
+		builder.AddData(key.ScriptAddress())
+	}
+	builder.AddInt64(int64(len(pubkeys)))
+	builder.AddData([]byte{byte(sigType)})
+	builder.AddOp(OP_CHECKMULTISIGALT)
+
+	return builder.Script()
+}
+
 // PushedData returns an array of byte slices containing any pushed data found
 // in the passed script.  This includes OP_0, but not OP_1 - OP_16.
 func PushedData(script []byte) ([][]byte, error) {
@@ -1171,8 +1274,12 @@ func GetMultisigMandN(script []byte) (uint8, uint8, error) {
 		return 0, 0, err
 	}
 
+	numPubKeysLoc := len(pops) - 2
+	if pops[len(pops)-1].opcode.value == OP_CHECKMULTISIGALT {
+		numPubKeysLoc--
+	}
 	requiredSigs := uint8(asSmallInt(pops[0].opcode))
-	numPubKeys := uint8(asSmallInt(pops[len(pops)-2].opcode))
+	numPubKeys := uint8(asSmallInt(pops[numPubKeysLoc].opcode))
 
 	return requiredSigs, numPubKeys, nil
 }
@@ -1257,6 +1364,18 @@ func ExtractPkScriptAddrs(pkScript []byte,
 			addrs = append(addrs, addr)
 		}
 
+	case AssetTy:
+		// An asset script is of the form:
+		//  <asset id> <amount> OP_2DROP OP_DUP OP_HASH160 <hash>
+		//  OP_EQUALVERIFY OP_CHECKSIG
+		// Therefore the pubkey hash is the 6th item on the stack.
+		requiredSigs = 1
+		addr, err := address.NewPubKeyHashAddress(pops[5].data,
+			chainParams, ecc.ECDSA_Secp256k1)
+		if err == nil {
+			addrs = append(addrs, addr)
+		}
+
 	case StakeSubmissionTy:
 		// A pay-to-stake-submission-hash script is of the form:
 		//  OP_SSTX ... P2PKH or P2SH
@@ -1334,6 +1453,37 @@ func ExtractPkScriptAddrs(pkScript []byte,
 			}
 		}
 
+	case MultiSigAltTy:
+		// An alternative signature multi-signature script is of the
+		// form:
+		//  <numsigs> <pubkey>... <numpubkeys> <type> OP_CHECKMULTISIGALT
+		// Therefore the number of required signatures is the 1st item
+		// on the stack and the number of public keys is the 3rd to
+		// last item on the stack.
+		requiredSigs = asSmallInt(pops[0].opcode)
+		numPubKeys := asSmallInt(pops[len(pops)-3].opcode)
+		suite, _ := ExtractPkScriptAltSigType(pkScript)
+
+		// Extract the public keys while skipping any that are invalid.
+		addrs = make([]types.Address, 0, numPubKeys)
+		for i := 0; i < numPubKeys; i++ {
+			var addr types.Address
+			var err error
+			switch suite {
+			case ecc.EdDSA_Ed25519:
+				addr, err = address.NewEdwardsPubKeyAddress(
+					pops[i+1].data, chainParams)
+			case ecc.ECDSA_SecpSchnorr:
+				addr, err = address.NewSecSchnorrPubKeyAddress(
+					pops[i+1].data, chainParams)
+			default:
+				continue
+			}
+			if err == nil {
+				addrs = append(addrs, addr)
+			}
+		}
+
 	case NullDataTy:
 		// Null data transactions have no addresses or required
 		// signatures.
@@ -1384,13 +1534,16 @@ func ExtractPkScriptAltSigType(pkScript []byte) (ecc.EcType, error) {
 
 	isPKA := isPubkeyAlt(pops)
 	isPKHA := isPubkeyHashAlt(pops)
-	if !(isPKA || isPKHA) {
+	isMSA := isMultiSigAlt(pops)
+	if !(isPKA || isPKHA || isMSA) {
 		return -1, fmt.Errorf("wrong script type")
 	}
 
 	sigTypeLoc := 1
 	if isPKHA {
 		sigTypeLoc = 4
+	} else if isMSA {
+		sigTypeLoc = len(pops) - 2
 	}
 
 	valInt := extractOneBytePush(pops[sigTypeLoc])
@@ -10,6 +10,7 @@
 package metrics
 
 import (
+	"fmt"
 	"github.com/btceasypay/bitcoinpay/log"
 	"os"
 	"runtime"
@@ -57,6 +58,35 @@ func NewMeter(name string) metrics.Meter {
 	return metrics.GetOrRegisterMeter(name, metrics.DefaultRegistry)
 }
 
+// NewGauge create a new metrics Gauge, either a real one of a NOP stub depending
+// on the metrics flag.
+func NewGauge(name string) metrics.Gauge {
+	if !Enabled {
+		return new(metrics.NilGauge)
+	}
+	return metrics.GetOrRegisterGauge(name, metrics.DefaultRegistry)
+}
+
+// NewFunctionalGauge create a new metrics Gauge reading its value from the
+// function, either a real one of a NOP stub depending on the metrics flag.  It
+// replaces the gauge registered with the name before, so the gauge reads the
+// latest instance of a service.
+func NewFunctionalGauge(name string, f func() int64) metrics.Gauge {
+	if !Enabled {
+		return new(metrics.NilGauge)
+	}
+	g := metrics.NewFunctionalGauge(f)
+	metrics.DefaultRegistry.Unregister(name)
+	metrics.DefaultRegistry.Register(name, g)
+	return g
+}
+
+// Labeled returns the name of the metric with the label.  The metrics named
+// alike are exported as one metric family with the labels.
+func Labeled(name, label, value string) string {
+	return fmt.Sprintf("%s{%s=%q}", name, label, value)
+}
+
 // NewTimer create a new metrics Timer, either a real one of a NOP stub depending
 // on the metrics flag.
 func NewTimer(name string) metrics.Timer {
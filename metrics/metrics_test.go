@@ -0,0 +1,28 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+//
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"testing"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+func TestNewFunctionalGauge(t *testing.T) {
+	name := Labeled("test/gauge", "instance", "latest")
+	if name != `test/gauge{instance="latest"}` {
+		t.Fatalf("unexpected labeled name %s", name)
+	}
+	NewFunctionalGauge(name, func() int64 { return 1 })
+	NewFunctionalGauge(name, func() int64 { return 2 })
+	defer metrics.DefaultRegistry.Unregister(name)
+
+	// The gauge reads the latest function registered with the name.
+	g, ok := metrics.DefaultRegistry.Get(name).(metrics.Gauge)
+	if !ok || g.Value() != 2 {
+		t.Fatalf("unexpected gauge %v", metrics.DefaultRegistry.Get(name))
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+//
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// The parts code inspired & originated from
+// https://github.com/ethereum/go-ethereum/metrics/prometheus
+
+// Package prometheus exposes the metrics in the Prometheus text format.
+package prometheus
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	bpmetrics "github.com/btceasypay/bitcoinpay/metrics"
+	"github.com/rcrowley/go-metrics"
+)
+
+// quantiles are the quantiles exported for the timers and histograms.
+var quantiles = []float64{0.5, 0.75, 0.95, 0.99, 0.999}
+
+// Handler returns an HTTP handler serving the metrics of the registry in the
+// Prometheus text format.
+func Handler(reg metrics.Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write(Collect(reg))
+	})
+}
+
+// Collect returns the metrics of the registry in the Prometheus text format.
+// Metric names are converted to Prometheus names by replacing the separators
+// with underscores, the metrics named with labels by bpmetrics.Labeled are
+// exported as one metric family and durations are exported in seconds.
+func Collect(reg metrics.Registry) []byte {
+	all := make(map[string]interface{})
+	reg.Each(func(name string, i interface{}) {
+		all[name] = i
+	})
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	c := collector{}
+	for _, name := range names {
+		family, labels := splitName(name)
+		switch m := all[name].(type) {
+		case metrics.Counter:
+			c.addValue(family, labels, "counter", float64(m.Count()))
+		case metrics.Gauge:
+			c.addValue(family, labels, "gauge", float64(m.Value()))
+		case metrics.GaugeFloat64:
+			c.addValue(family, labels, "gauge", m.Value())
+		case metrics.Meter:
+			c.addValue(family, labels, "counter", float64(m.Snapshot().Count()))
+		case metrics.Histogram:
+			s := m.Snapshot()
+			c.addSummary(family, labels, s.Count(), float64(s.Sum()),
+				s.Percentiles(quantiles), 1)
+		case metrics.Timer:
+			s := m.Snapshot()
+			c.addSummary(family+"_seconds", labels, s.Count(),
+				float64(s.Sum()), s.Percentiles(quantiles), float64(time.Second))
+		case bpmetrics.ResettingTimer:
+			s := m.Snapshot()
+			values := s.Values()
+			if len(values) == 0 {
+				continue
+			}
+			ps := s.Percentiles(quantiles)
+			fps := make([]float64, len(ps))
+			for i, p := range ps {
+				fps[i] = float64(p)
+			}
+			c.addSummary(family+"_seconds", labels, int64(len(values)),
+				s.Mean()*float64(len(values)), fps, float64(time.Second))
+		}
+	}
+	return c.buf.Bytes()
+}
+
+// splitName returns the Prometheus metric family name and the labels of the
+// metric name.
+func splitName(name string) (string, string) {
+	var labels string
+	if i := strings.IndexByte(name, '{'); i >= 0 && strings.HasSuffix(name, "}") {
+		name, labels = name[:i], name[i+1:len(name)-1]
+	}
+	family := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' ||
+			r >= '0' && r <= '9' || r == '_' || r == ':' {
+			return r
+		}
+		return '_'
+	}, name)
+	return family, labels
+}
+
+// collector writes the metric families in the Prometheus text format.
+type collector struct {
+	buf    bytes.Buffer
+	family string
+}
+
+// addType writes the type of the metric family, unless the family is written
+// already.
+func (c *collector) addType(family, typ string) {
+	if family == c.family {
+		return
+	}
+	c.family = family
+	fmt.Fprintf(&c.buf, "# TYPE %s %s\n", family, typ)
+}
+
+// addSample writes a sample with the labels.
+func (c *collector) addSample(name string, labels string, value float64) {
+	if labels != "" {
+		name += "{" + labels + "}"
+	}
+	fmt.Fprintf(&c.buf, "%s %s\n", name, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+func (c *collector) addValue(family, labels, typ string, value float64) {
+	c.addType(family, typ)
+	c.addSample(family, labels, value)
+}
+
+// addSummary writes the quantiles, the sum and the count of the samples, the
+// values are divided by the unit.
+func (c *collector) addSummary(family, labels string, count int64, sum float64,
+	ps []float64, unit float64) {
+	c.addType(family, "summary")
+	for i, q := range quantiles {
+		quantile := fmt.Sprintf("quantile=\"%s\"", strconv.FormatFloat(q, 'g', -1, 64))
+		if labels != "" {
+			quantile = labels + "," + quantile
+		}
+		c.addSample(family, quantile, ps[i]/unit)
+	}
+	c.addSample(family+"_sum", labels, sum/unit)
+	c.addSample(family+"_count", labels, float64(count))
+}
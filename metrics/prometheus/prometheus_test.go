@@ -0,0 +1,58 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+//
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package prometheus
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	bpmetrics "github.com/btceasypay/bitcoinpay/metrics"
+	"github.com/rcrowley/go-metrics"
+)
+
+func TestHandler(t *testing.T) {
+	reg := metrics.NewRegistry()
+	sent := metrics.NewCounter()
+	sent.Inc(3)
+	reg.Register("p2p/bytes/sent", sent)
+	reg.Register(bpmetrics.Labeled("p2p/peers", "direction", "outbound"),
+		metrics.NewFunctionalGauge(func() int64 { return 2 }))
+	inbound := metrics.NewGauge()
+	inbound.Update(5)
+	reg.Register(bpmetrics.Labeled("p2p/peers", "direction", "inbound"), inbound)
+	timer := metrics.NewTimer()
+	timer.Update(2 * time.Second)
+	reg.Register(bpmetrics.Labeled("rpc/duration", "method", "getBlockCount"), timer)
+
+	want := `# TYPE p2p_bytes_sent counter
+p2p_bytes_sent 3
+# TYPE p2p_peers gauge
+p2p_peers{direction="inbound"} 5
+p2p_peers{direction="outbound"} 2
+# TYPE rpc_duration_seconds summary
+rpc_duration_seconds{method="getBlockCount",quantile="0.5"} 2
+rpc_duration_seconds{method="getBlockCount",quantile="0.75"} 2
+rpc_duration_seconds{method="getBlockCount",quantile="0.95"} 2
+rpc_duration_seconds{method="getBlockCount",quantile="0.99"} 2
+rpc_duration_seconds{method="getBlockCount",quantile="0.999"} 2
+rpc_duration_seconds_sum{method="getBlockCount"} 2
+rpc_duration_seconds_count{method="getBlockCount"} 1
+`
+	rec := httptest.NewRecorder()
+	Handler(reg).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := ioutil.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != want {
+		t.Fatalf("unexpected metrics:\n%s\nwant:\n%s", body, want)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4" {
+		t.Fatalf("unexpected content type %s", ct)
+	}
+}
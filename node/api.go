@@ -12,6 +12,7 @@ import (
 	"github.com/btceasypay/bitcoinpay/core/message"
 	"github.com/btceasypay/bitcoinpay/core/protocol"
 	"github.com/btceasypay/bitcoinpay/core/types/pow"
+	"github.com/btceasypay/bitcoinpay/p2p/connmgr"
 	"github.com/btceasypay/bitcoinpay/params"
 	"github.com/btceasypay/bitcoinpay/rpc"
 	"github.com/btceasypay/bitcoinpay/services/common"
@@ -154,6 +155,27 @@ func (api *PublicBlockChainAPI) GetRpcInfo() (interface{}, error) {
 	return jrs, nil
 }
 
+// Return the memory used by the block nodes and the DAG blocks
+func (api *PublicBlockChainAPI) GetMemoryInfo() (interface{}, error) {
+	ms := api.node.blockManager.GetChain().MemoryStats()
+	ret := &json.GetMemoryInfoResult{
+		IndexNodes:      ms.IndexNodes,
+		PrunedNodes:     ms.PrunedNodes,
+		LoadedNodes:     ms.LoadedNodes,
+		DAGBlocks:       ms.DAG.Blocks,
+		PrunedDAGBlocks: ms.DAG.Pruned,
+		LoadedDAGBlocks: ms.DAG.Loaded,
+		PruneDepth:      ms.PruneDepth,
+		HeapAlloc:       ms.HeapAlloc,
+		HeapObjects:     ms.HeapObjects,
+	}
+	if !ms.LastPrune.IsZero() {
+		ret.LastPrune = ms.LastPrune.Unix()
+		ret.LastPruneDuration = ms.LastPruneDuration.String()
+	}
+	return ret, nil
+}
+
 func getGraphStateResult(gs *blockdag.GraphState) *json.GetGraphStateResult {
 	if gs != nil {
 		mainTip := gs.GetMainChainTip()
@@ -211,6 +233,57 @@ func (api *PrivateBlockChainAPI) RemoveBan(host *string) (interface{}, error) {
 	return true, nil
 }
 
+// SetBan bans an IP, a subnet in the CIDR notation or an onion host for the
+// duration, which defaults to the ban duration of the misbehaving peers.
+func (api *PrivateBlockChainAPI) SetBan(subnet string, duration *string) (interface{}, error) {
+	dur := connmgr.BanDuration
+	if duration != nil {
+		d, err := time.ParseDuration(*duration)
+		if err != nil {
+			return nil, err
+		}
+		dur = d
+	}
+	if dur <= 0 {
+		return nil, fmt.Errorf("error:Must greater than 0 (duration =%v)", dur)
+	}
+	if err := api.node.node.peerServer.SetBan(subnet, dur); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+// AddNode adds or removes a permanent peer, or connects to a peer once
+func (api *PrivateBlockChainAPI) AddNode(addr string, cmd string) (interface{}, error) {
+	if err := api.node.node.peerServer.AddNode(addr, cmd); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+// DisconnectNode disconnects a peer by its id or address
+func (api *PrivateBlockChainAPI) DisconnectNode(target string) (interface{}, error) {
+	if err := api.node.node.peerServer.DisconnectNode(target); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+// GetAddedNodeInfo returns the nodes added with --addpeer, --connect or
+// addNode, whether or not they are connected and the ID of their peer.
+func (api *PrivateBlockChainAPI) GetAddedNodeInfo() (interface{}, error) {
+	nodes := api.node.node.peerServer.GetAddedNodeInfo()
+	infos := []*json.GetAddedNodeInfoResult{}
+	for _, node := range nodes {
+		infos = append(infos, &json.GetAddedNodeInfoResult{
+			AddedNode: node.Addr,
+			Connected: node.Connected,
+			ID:        node.PeerID,
+		})
+	}
+	return infos, nil
+}
+
 // SetRpcMaxClients
 func (api *PrivateBlockChainAPI) SetRpcMaxClients(max int) (interface{}, error) {
 	if max <= 0 {
@@ -27,10 +27,14 @@ type BitcoinpayFull struct {
 	node *Node
 	// msg notifier
 	nfManager notify.Notify
+	// rpc subscriptions of the notifier
+	notifyMgr *notifymgr.NotifyMgr
 	// database
 	db database.DB
 	// account/wallet service
 	acctmanager *acct.AccountManager
+	// committed filter index
+	cfIndex *index.CfIndex
 	// block manager handles all incoming blocks.
 	blockManager *blkmgr.BlockManager
 	// tx manager
@@ -86,13 +90,17 @@ func (qm *BitcoinpayFull) APIs() []rpc.API {
 	apis = append(apis, qm.cpuMiner.APIs()...)
 	apis = append(apis, qm.blockManager.API())
 	apis = append(apis, qm.txManager.APIs()...)
+	apis = append(apis, qm.notifyMgr.APIs()...)
+	if qm.cfIndex != nil {
+		apis = append(apis, qm.cfIndex.APIs()...)
+	}
 	apis = append(apis, qm.apis()...)
 	return apis
 }
 func newBitcoinpayFullNode(node *Node) (*BitcoinpayFull, error) {
 
 	// account manager
-	acctmgr, err := acct.New()
+	acctmgr, err := acct.New(node.DB, node.Params, node.Config.GetWatchAddrs())
 	if err != nil {
 		return nil, err
 	}
@@ -117,13 +125,31 @@ func newBitcoinpayFullNode(node *Node) (*BitcoinpayFull, error) {
 		addrIndex = index.NewAddrIndex(qm.db, node.Params)
 		indexes = append(indexes, addrIndex)
 	}
+	var assetIndex *index.AssetIndex
+	if cfg.AssetIndex {
+		log.Info("Asset index is enabled")
+		assetIndex = index.NewAssetIndex(qm.db, node.Params)
+		indexes = append(indexes, assetIndex)
+	}
+	var acctIndex *acct.AccountManager
+	if acctmgr.Enabled() {
+		log.Info("Account index is enabled")
+		acctIndex = acctmgr
+		indexes = append(indexes, acctIndex)
+	}
+	if !cfg.NoCFilters {
+		log.Info("Committed filter index is enabled")
+		qm.cfIndex = index.NewCfIndex(qm.db)
+		indexes = append(indexes, qm.cfIndex)
+	}
 	// index-manager
 	var indexManager blockchain.IndexManager
 	if len(indexes) > 0 {
 		indexManager = index.NewManager(qm.db, indexes, node.Params)
 	}
 
-	qm.nfManager = &notifymgr.NotifyMgr{Server: node.peerServer, RpcServer: node.rpcServer}
+	qm.notifyMgr = &notifymgr.NotifyMgr{Server: node.peerServer, RpcServer: node.rpcServer}
+	qm.nfManager = qm.notifyMgr
 
 	// block-manager
 	bm, err := blkmgr.NewBlockManager(qm.nfManager, indexManager, node.DB, qm.timeSource, qm.sigCache, node.Config, node.Params,
@@ -132,9 +158,10 @@ func newBitcoinpayFullNode(node *Node) (*BitcoinpayFull, error) {
 		return nil, err
 	}
 	qm.blockManager = bm
+	acctmgr.SetChain(bm.GetChain())
 
 	// txmanager
-	tm, err := tx.NewTxManager(bm, txIndex, addrIndex, cfg, qm.nfManager, qm.sigCache, node.DB)
+	tm, err := tx.NewTxManager(bm, txIndex, addrIndex, assetIndex, acctIndex, cfg, qm.nfManager, qm.sigCache, node.DB)
 	if err != nil {
 		return nil, err
 	}
@@ -144,6 +171,7 @@ func newBitcoinpayFullNode(node *Node) (*BitcoinpayFull, error) {
 	node.peerServer.BlockManager = bm
 	node.peerServer.TimeSource = qm.timeSource
 	node.peerServer.TxMemPool = qm.txManager.MemPool().(*mempool.TxPool)
+	node.peerServer.CfIndex = qm.cfIndex
 
 	// Cpu Miner
 	// Create the mining policy based on the configuration options.
@@ -155,7 +183,7 @@ func newBitcoinpayFullNode(node *Node) (*BitcoinpayFull, error) {
 		BlockPrioritySize: cfg.BlockPrioritySize,
 		TxMinFreeFee:      cfg.MinTxFee, //TODO, duplicated config item with mem-pool
 		StandardVerifyFlags: func() (txscript.ScriptFlags, error) {
-			return common.StandardScriptVerifyFlags()
+			return common.StandardScriptVerifyFlags(bm.GetChain())
 		}, //TODO, duplicated config item with mem-pool
 	}
 	// defaultNumWorkers is the default number of workers to use for mining
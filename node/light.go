@@ -3,9 +3,11 @@ package node
 
 import (
 	"github.com/btceasypay/bitcoinpay/config"
+	"github.com/btceasypay/bitcoinpay/core/blockchain"
 	"github.com/btceasypay/bitcoinpay/database"
 	"github.com/btceasypay/bitcoinpay/p2p/peerserver"
 	"github.com/btceasypay/bitcoinpay/rpc"
+	"github.com/btceasypay/bitcoinpay/services/hdrmgr"
 )
 
 // BitcoinpayLight implements the bitcoinpay light node service.
@@ -13,26 +15,40 @@ type BitcoinpayLight struct {
 	// database
 	db     database.DB
 	config *config.Config
+
+	// header manager syncing the block headers from the full nodes
+	headerManager *hdrmgr.HeaderManager
 }
 
 func (light *BitcoinpayLight) Start(server *peerserver.PeerServer) error {
 	log.Debug("Starting bitcoinpay light node service")
+	light.headerManager.Start()
 	return nil
 }
 
 func (light *BitcoinpayLight) Stop() error {
 	log.Debug("Stopping bitcoinpay light node service")
-	return nil
+	return light.headerManager.Stop()
 }
 
 func (light *BitcoinpayLight) APIs() []rpc.API {
-	return []rpc.API{}
+	return light.headerManager.APIs()
 }
 
 func newBitcoinpayLight(n *Node) (*BitcoinpayLight, error) {
+	timeSource := blockchain.NewMedianTime()
+	hm, err := hdrmgr.New(n.DB, timeSource, n.Config, n.Params)
+	if err != nil {
+		return nil, err
+	}
 	light := BitcoinpayLight{
-		config: n.Config,
-		db:     n.DB,
+		config:        n.Config,
+		db:            n.DB,
+		headerManager: hm,
 	}
+
+	// prepare peerServer
+	n.peerServer.HeaderManager = hm
+	n.peerServer.TimeSource = timeSource
 	return &light, nil
 }
@@ -1,6 +1,8 @@
 package notify
 
 import (
+	"github.com/btceasypay/bitcoinpay/core/blockchain"
+	"github.com/btceasypay/bitcoinpay/core/blockdag"
 	"github.com/btceasypay/bitcoinpay/core/message"
 	"github.com/btceasypay/bitcoinpay/core/types"
 )
@@ -11,4 +13,6 @@ type Notify interface {
 	AnnounceNewTransactions(newTxs []*types.TxDesc)
 	RelayInventory(invVect *message.InvVect, data interface{})
 	BroadcastMessage(msg message.Message)
+	NotifyBlockChain(n *blockchain.Notification)
+	NotifyGraphState(gs *blockdag.GraphState)
 }
@@ -7,6 +7,7 @@
 package addmgr
 
 import (
+	"bytes"
 	"container/list"
 	crand "crypto/rand"
 	"encoding/base32"
@@ -17,6 +18,7 @@ import (
 	"github.com/btceasypay/bitcoinpay/core/protocol"
 	"github.com/btceasypay/bitcoinpay/core/types"
 	"github.com/btceasypay/bitcoinpay/log"
+	"golang.org/x/crypto/sha3"
 	"io"
 	"math/rand"
 	"net"
@@ -666,6 +668,17 @@ func (a *AddrManager) HostToNetAddress(host string, port uint16, services protoc
 		}
 		prefix := []byte{0xfd, 0x87, 0xd8, 0x7e, 0xeb, 0x43}
 		ip = net.IP(append(prefix, data...))
+	} else if len(host) == torV3HostSize && strings.HasSuffix(host, ".onion") {
+		pubKey, err := decodeTorV3(host)
+		if err != nil {
+			return nil, err
+		}
+		return types.NewNetAddressTorV3(pubKey, port, services), nil
+	} else if strings.HasSuffix(host, ".onion") {
+		// Other onion addresses aren't known, so they are mapped to the
+		// unspecified address, which is never added or advertised as it
+		// is unroutable.
+		ip = net.IPv4zero
 	} else if ip = net.ParseIP(host); ip == nil {
 		ips, err := a.lookupFunc(host)
 		if err != nil {
@@ -680,10 +693,58 @@ func (a *AddrManager) HostToNetAddress(host string, port uint16, services protoc
 	return types.NewNetAddressIPPort(ip, port, services), nil
 }
 
+// torV3HostSize is the length of a version 3 onion address, which is the
+// 56 char base32 of the public key, checksum and version + ".onion".
+const torV3HostSize = 62
+
+// torV3Version is the version byte ending a version 3 onion address.
+const torV3Version = 0x03
+
+// torV3Checksum returns the checksum of a version 3 onion address for the
+// public key.
+func torV3Checksum(pubKey []byte) []byte {
+	data := append([]byte(".onion checksum"), pubKey...)
+	sum := sha3.Sum256(append(data, torV3Version))
+	return sum[:2]
+}
+
+// encodeTorV3 returns the version 3 onion address of the public key.
+func encodeTorV3(pubKey []byte) string {
+	data := append(append([]byte{}, pubKey...), torV3Checksum(pubKey)...)
+	data = append(data, torV3Version)
+	return strings.ToLower(base32.StdEncoding.EncodeToString(data)) + ".onion"
+}
+
+// decodeTorV3 returns the public key of the version 3 onion address, after
+// checking its version and checksum.
+func decodeTorV3(host string) ([]byte, error) {
+	data, err := base32.StdEncoding.DecodeString(
+		strings.ToUpper(strings.TrimSuffix(host, ".onion")))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != types.TorV3KeySize+3 {
+		return nil, fmt.Errorf("invalid onion address %s", host)
+	}
+	pubKey := data[:types.TorV3KeySize]
+	if data[types.TorV3KeySize+2] != torV3Version {
+		return nil, fmt.Errorf("unknown onion address version %d of %s",
+			data[types.TorV3KeySize+2], host)
+	}
+	if !bytes.Equal(data[types.TorV3KeySize:types.TorV3KeySize+2],
+		torV3Checksum(pubKey)) {
+		return nil, fmt.Errorf("invalid checksum of onion address %s", host)
+	}
+	return pubKey, nil
+}
+
 // ipString returns a string for the ip from the provided NetAddress. If the
 // ip is in the range used for Tor addresses then it will be transformed into
 // the relevant .onion address.
 func ipString(na *types.NetAddress) string {
+	if na.IsTorV3() {
+		return encodeTorV3(na.TorV3)
+	}
 	if isOnionCatTor(na) {
 		// We know now that na.IP is long enogh.
 		base32 := base32.StdEncoding.EncodeToString(na.IP[6:])
@@ -932,7 +993,7 @@ func (a *AddrManager) SetServices(addr *types.NetAddress, services protocol.Serv
 // with the given priority.
 func (a *AddrManager) AddLocalAddress(na *types.NetAddress, priority AddressPriority) error {
 	if !IsRoutable(na) {
-		return fmt.Errorf("address %s is not routable", na.IP)
+		return fmt.Errorf("address %s is not routable", ipString(na))
 	}
 
 	a.lamtx.Lock()
@@ -970,8 +1031,8 @@ func getReachabilityFrom(localAddr, remoteAddr *types.NetAddress) int {
 		return Unreachable
 	}
 
-	if isOnionCatTor(remoteAddr) {
-		if isOnionCatTor(localAddr) {
+	if isTor(remoteAddr) {
+		if isTor(localAddr) {
 			return Private
 		}
 
@@ -1012,7 +1073,7 @@ func getReachabilityFrom(localAddr, remoteAddr *types.NetAddress) int {
 		tunnelled = true
 	}
 
-	if !IsRoutable(localAddr) {
+	if !IsRoutable(localAddr) || isTor(localAddr) {
 		return Default
 	}
 
@@ -1051,15 +1112,15 @@ func (a *AddrManager) GetBestLocalAddress(remoteAddr *types.NetAddress) *types.N
 		}
 	}
 	if bestAddress != nil {
-		log.Debug(fmt.Sprintf("Suggesting address %s:%d for %s:%d", bestAddress.IP,
-			bestAddress.Port, remoteAddr.IP, remoteAddr.Port))
+		log.Debug(fmt.Sprintf("Suggesting address %s for %s",
+			NetAddressKey(bestAddress), NetAddressKey(remoteAddr)))
 	} else {
-		log.Debug(fmt.Sprintf("No worthy address for %s:%d", remoteAddr.IP,
-			remoteAddr.Port))
+		log.Debug(fmt.Sprintf("No worthy address for %s",
+			NetAddressKey(remoteAddr)))
 
 		// Send something unroutable if nothing suitable.
 		var ip net.IP
-		if !isIPv4(remoteAddr) && !isOnionCatTor(remoteAddr) {
+		if !isIPv4(remoteAddr) && !isTor(remoteAddr) {
 			ip = net.IPv6zero
 		} else {
 			ip = net.IPv4zero
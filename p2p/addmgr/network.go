@@ -121,6 +121,12 @@ func isOnionCatTor(na *types.NetAddress) bool {
 	return onionCatNet.Contains(na.IP)
 }
 
+// isTor returns whether or not the passed address is a Tor address, either in
+// the OnionCat range or a version 3 onion address.
+func isTor(na *types.NetAddress) bool {
+	return na.IsTorV3() || isOnionCatTor(na)
+}
+
 // isRFC1918 returns whether or not the passed address is part of the IPv4
 // private network address space as defined by RFC1918 (10.0.0.0/8,
 // 172.16.0.0/12, or 192.168.0.0/16).
@@ -227,6 +233,9 @@ func isValid(na *types.NetAddress) bool {
 // the public internet.  This is true as long as the address is valid and is not
 // in any reserved ranges.
 func IsRoutable(na *types.NetAddress) bool {
+	if na.IsTorV3() {
+		return true
+	}
 	return isValid(na) && !(isRFC1918(na) || isRFC2544(na) ||
 		isRFC3927(na) || isRFC4862(na) || isRFC3849(na) ||
 		isRFC4843(na) || isRFC5737(na) || isRFC6598(na) ||
@@ -268,6 +277,10 @@ func GroupKey(na *types.NetAddress) string {
 		}
 		return ip.Mask(net.CIDRMask(16, 32)).String()
 	}
+	if na.IsTorV3() {
+		// group is keyed off the first 4 bits of the public key.
+		return fmt.Sprintf("tor:%d", na.TorV3[0]>>4)
+	}
 	if isOnionCatTor(na) {
 		// group is keyed off the first 4 bits of the actual onion key.
 		return fmt.Sprintf("tor:%d", na.IP[6]&((1<<4)-1))
@@ -477,6 +477,40 @@ func (cm *ConnManager) NewConnReq() {
 	cm.Connect(c)
 }
 
+// Register assigns an id to the connection request and registers it as a
+// pending connection attempt, so it can be canceled with the Remove method
+// before Connect is called for it.  It returns false when the connection
+// manager is stopping.
+func (cm *ConnManager) Register(c *ConnReq) bool {
+	if atomic.LoadInt32(&cm.stop) != 0 {
+		return false
+	}
+	if atomic.LoadUint64(&c.id) != 0 {
+		return true
+	}
+	atomic.StoreUint64(&c.id, atomic.AddUint64(&cm.connReqCount, 1))
+
+	// Submit a request of a pending connection attempt to the
+	// connection manager. By registering the id before the
+	// connection is even established, we'll be able to later
+	// cancel the connection via the Remove method.
+	done := make(chan struct{})
+	select {
+	case cm.requests <- registerPending{c, done}:
+	case <-cm.quit:
+		return false
+	}
+
+	// Wait for the registration to successfully add the pending
+	// conn req to the conn manager's internal state.
+	select {
+	case <-done:
+	case <-cm.quit:
+		return false
+	}
+	return true
+}
+
 // Connect assigns an id and dials a connection to the address of the
 // connection request.
 func (cm *ConnManager) Connect(c *ConnReq) {
@@ -491,27 +525,8 @@ func (cm *ConnManager) Connect(c *ConnReq) {
 		return
 	}
 
-	if atomic.LoadUint64(&c.id) == 0 {
-		atomic.StoreUint64(&c.id, atomic.AddUint64(&cm.connReqCount, 1))
-
-		// Submit a request of a pending connection attempt to the
-		// connection manager. By registering the id before the
-		// connection is even established, we'll be able to later
-		// cancel the connection via the Remove method.
-		done := make(chan struct{})
-		select {
-		case cm.requests <- registerPending{c, done}:
-		case <-cm.quit:
-			return
-		}
-
-		// Wait for the registration to successfully add the pending
-		// conn req to the conn manager's internal state.
-		select {
-		case <-done:
-		case <-cm.quit:
-			return
-		}
+	if !cm.Register(c) {
+		return
 	}
 	log.Debug(fmt.Sprintf("Attempting to connect to %v", c))
 	conn, err := cm.cfg.Dial(c.Addr.Network(), c.Addr.String())
@@ -104,36 +104,56 @@ type MessageListeners struct {
 
 	// OnFeeFilter
 	OnFeeFilter func(p *Peer, msg *message.MsgFeeFilter)
-	/*
-		// OnSendHeaders is invoked when a peer receives a sendheaders message.
-		OnSendHeaders func(p *Peer, msg *message.MsgSendHeaders)
 
-		// OnCFilter is invoked when a peer receives a cfilter wire message.
-		OnCFilter func(p *Peer, msg *message.MsgCFilter)
+	// OnGetCFilter is invoked when a peer receives a getcfilter wire
+	// message.
+	OnGetCFilter func(p *Peer, msg *message.MsgGetCFilter)
+
+	// OnGetCFHeaders is invoked when a peer receives a getcfheaders
+	// wire message.
+	OnGetCFHeaders func(p *Peer, msg *message.MsgGetCFHeaders)
 
-		// OnCFHeaders is invoked when a peer receives a cfheaders wire
-		// message.
-		OnCFHeaders func(p *Peer, msg *message.MsgCFHeaders)
+	// OnGetCFTypes is invoked when a peer receives a getcftypes wire
+	// message.
+	OnGetCFTypes func(p *Peer, msg *message.MsgGetCFTypes)
 
-		// OnCFTypes is invoked when a peer receives a cftypes wire message.
-		OnCFTypes func(p *Peer, msg *message.MsgCFTypes)
+	// OnCFilter is invoked when a peer receives a cfilter wire message.
+	OnCFilter func(p *Peer, msg *message.MsgCFilter)
 
-		// OnHeaders is invoked when a peer receives a headers wire message.
-		OnHeaders func(p *Peer, msg *message.MsgHeaders)
+	// OnCFHeaders is invoked when a peer receives a cfheaders wire
+	// message.
+	OnCFHeaders func(p *Peer, msg *message.MsgCFHeaders)
 
-		// OnGetCFilter is invoked when a peer receives a getcfilter wire
-		// message.
-		OnGetCFilter func(p *Peer, msg *message.MsgGetCFilter)
+	// OnCFTypes is invoked when a peer receives a cftypes wire message.
+	OnCFTypes func(p *Peer, msg *message.MsgCFTypes)
 
-		// OnGetCFHeaders is invoked when a peer receives a getcfheaders
-		// wire message.
-		OnGetCFHeaders func(p *Peer, msg *message.MsgGetCFHeaders)
+	// OnFilterAdd is invoked when a peer receives a filteradd wire message.
+	OnFilterAdd func(p *Peer, msg *message.MsgFilterAdd)
 
-		// OnGetCFTypes is invoked when a peer receives a getcftypes wire
-		// message.
-		OnGetCFTypes func(p *Peer, msg *message.MsgGetCFTypes)
+	// OnFilterClear is invoked when a peer receives a filterclear wire
+	// message.
+	OnFilterClear func(p *Peer, msg *message.MsgFilterClear)
+
+	// OnFilterLoad is invoked when a peer receives a filterload wire
+	// message.
+	OnFilterLoad func(p *Peer, msg *message.MsgFilterLoad)
 
-		// OnFeeFilter is invoked when a peer receives a feefilter wire message.
-		OnFeeFilter func(p *Peer, msg *message.MsgFeeFilter)
+	// OnGetUtxoSnapshot is invoked when a peer receives a getutxosnap wire
+	// message.
+	OnGetUtxoSnapshot func(p *Peer, msg *message.MsgGetUtxoSnapshot)
+
+	// OnUtxoSnapshot is invoked when a peer receives a utxosnap wire
+	// message.
+	OnUtxoSnapshot func(p *Peer, msg *message.MsgUtxoSnapshot)
+
+	// OnMerkleBlock is invoked when a peer receives a merkleblock wire
+	// message.
+	OnMerkleBlock func(p *Peer, msg *message.MsgMerkleBlock)
+
+	// OnHeaders is invoked when a peer receives a headers wire message.
+	OnHeaders func(p *Peer, msg *message.MsgHeaders)
+	/*
+		// OnSendHeaders is invoked when a peer receives a sendheaders message.
+		OnSendHeaders func(p *Peer, msg *message.MsgSendHeaders)
 	*/
 }
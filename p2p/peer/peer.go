@@ -186,9 +186,20 @@ func (p *Peer) PushAddrMsg(addresses []*types.NetAddress) ([]*types.NetAddress,
 		return nil, nil
 	}
 
+	// The version 3 onion addresses are only relayed to the peers which
+	// read the wide encoding of the addresses.
 	msg := message.NewMsgAddr()
-	msg.AddrList = make([]*types.NetAddress, len(addresses))
-	copy(msg.AddrList, addresses)
+	msg.AddrList = make([]*types.NetAddress, 0, len(addresses))
+	wide := p.ProtocolVersion() >= protocol.AddrV2Version
+	for _, na := range addresses {
+		if na.IsTorV3() && !wide {
+			continue
+		}
+		msg.AddrList = append(msg.AddrList, na)
+	}
+	if len(msg.AddrList) == 0 {
+		return nil, nil
+	}
 
 	// Randomize the addresses sent if there are more than the maximum allowed.
 	if len(msg.AddrList) > message.MaxAddrPerMsg {
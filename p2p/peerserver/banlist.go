@@ -0,0 +1,239 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peerserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btceasypay/bitcoinpay/log"
+)
+
+// banListFilename is the name of the file in the data directory which keeps
+// the banned hosts and subnets across restarts.
+const banListFilename = "banlist.json"
+
+// serializedBan is the format of a ban in the ban list file.
+type serializedBan struct {
+	Subnet string `json:"subnet"`
+	Until  int64  `json:"until"`
+}
+
+// banList keeps the banned hosts and subnets in the ban list file.  The hosts
+// are keyed by their IP and the subnets by their CIDR notation.  The tor hidden
+// services, which have no IP, are keyed by their onion host and have no
+// subnet.
+//
+// When the file fails to load, the bans are only kept in memory, so the file
+// isn't saved over and can still be fixed by hand.
+type banList struct {
+	mtx      sync.Mutex
+	file     string
+	readOnly bool
+	subnets  map[string]*net.IPNet
+	until    map[string]time.Time
+}
+
+// newBanList returns the ban list kept in the file.  The bans which have
+// expired are dropped.
+func newBanList(file string) *banList {
+	bl := &banList{
+		file:    file,
+		subnets: make(map[string]*net.IPNet),
+		until:   make(map[string]time.Time),
+	}
+	if err := bl.load(); err != nil {
+		log.Error("Failed to load ban list, the bans won't be saved",
+			"file", file, "error", err)
+		bl.readOnly = true
+	}
+	return bl
+}
+
+// parseBanSubnet parses an IP, a subnet in the CIDR notation or an onion host.
+// It returns the key of the ban, which is the IP for the subnets of a single
+// host, and a nil subnet for an onion host.
+func parseBanSubnet(subnet string) (string, *net.IPNet, error) {
+	_, ipnet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		ip := net.ParseIP(subnet)
+		if ip == nil {
+			if isOnionHost(subnet) {
+				return strings.ToLower(subnet), nil, nil
+			}
+			return "", nil, fmt.Errorf("invalid IP or subnet %q", subnet)
+		}
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		ipnet = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	}
+	if ones, bits := ipnet.Mask.Size(); ones == bits {
+		return ipnet.IP.String(), ipnet, nil
+	}
+	return ipnet.String(), ipnet, nil
+}
+
+// banContains returns whether or not the ban of the key and the subnet covers
+// the host.
+func banContains(key string, ipnet *net.IPNet, host string) bool {
+	if ipnet == nil {
+		return strings.EqualFold(key, host)
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ipnet.Contains(ip)
+}
+
+// load reads the bans from the file.  The invalid bans are skipped.
+func (bl *banList) load() error {
+	f, err := os.Open(bl.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var bans []serializedBan
+	if err := json.NewDecoder(f).Decode(&bans); err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, ban := range bans {
+		key, ipnet, err := parseBanSubnet(ban.Subnet)
+		if err != nil {
+			log.Warn("Skipping invalid ban", "file", bl.file, "error", err)
+			continue
+		}
+		until := time.Unix(ban.Until, 0)
+		if now.Before(until) && until.After(bl.until[key]) {
+			bl.subnets[key] = ipnet
+			bl.until[key] = until
+		}
+	}
+	log.Info(fmt.Sprintf("Loaded %d bans from file '%s'", len(bl.until), bl.file))
+	return nil
+}
+
+// save writes the bans to the file, unless it failed to load.  It must be
+// called with the mutex held.
+func (bl *banList) save() {
+	if bl.readOnly {
+		return
+	}
+
+	bans := make([]serializedBan, 0, len(bl.until))
+	for key, until := range bl.until {
+		bans = append(bans, serializedBan{Subnet: key, Until: until.Unix()})
+	}
+
+	// Write a temporary file and then move it into place.
+	tmpfile := bl.file + ".new"
+	w, err := os.Create(tmpfile)
+	if err != nil {
+		log.Error("Failed to create ban list file", "file", tmpfile, "error", err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(bans); err != nil {
+		w.Close()
+		log.Error("Failed to encode ban list file", "file", tmpfile, "error", err)
+		return
+	}
+	if err := w.Close(); err != nil {
+		log.Error("Failed to close ban list file", "file", tmpfile, "error", err)
+		return
+	}
+	if err := os.Rename(tmpfile, bl.file); err != nil {
+		log.Error("Failed to write ban list file", "file", bl.file, "error", err)
+	}
+}
+
+// Ban bans the IP, subnet or onion host until the given time.
+func (bl *banList) Ban(subnet string, until time.Time) error {
+	key, ipnet, err := parseBanSubnet(subnet)
+	if err != nil {
+		return err
+	}
+
+	bl.mtx.Lock()
+	defer bl.mtx.Unlock()
+
+	bl.subnets[key] = ipnet
+	bl.until[key] = until
+	bl.save()
+	return nil
+}
+
+// Unban lifts the ban of the IP, subnet or onion host, or of all of them when
+// subnet is empty.  It returns whether or not there was such a ban.
+func (bl *banList) Unban(subnet string) bool {
+	bl.mtx.Lock()
+	defer bl.mtx.Unlock()
+
+	if subnet == "" {
+		bl.subnets = make(map[string]*net.IPNet)
+		bl.until = make(map[string]time.Time)
+		bl.save()
+		return true
+	}
+	key, _, err := parseBanSubnet(subnet)
+	if err != nil {
+		return false
+	}
+	if _, ok := bl.until[key]; !ok {
+		return false
+	}
+	delete(bl.subnets, key)
+	delete(bl.until, key)
+	bl.save()
+	return true
+}
+
+// IsBanned returns whether or not the host is banned and until when.  The bans
+// which have expired are removed.
+func (bl *banList) IsBanned(host string) (time.Time, bool) {
+	bl.mtx.Lock()
+	defer bl.mtx.Unlock()
+
+	now := time.Now()
+	var banEnd time.Time
+	changed := false
+	for key, ipnet := range bl.subnets {
+		until := bl.until[key]
+		if !now.Before(until) {
+			log.Info("Ban expired", "subnet", key)
+			delete(bl.subnets, key)
+			delete(bl.until, key)
+			changed = true
+			continue
+		}
+		if banContains(key, ipnet, host) && until.After(banEnd) {
+			banEnd = until
+		}
+	}
+	if changed {
+		bl.save()
+	}
+	return banEnd, !banEnd.IsZero()
+}
+
+// List returns the banned hosts and subnets and until when they are banned.
+func (bl *banList) List() map[string]time.Time {
+	bl.mtx.Lock()
+	defer bl.mtx.Unlock()
+
+	bans := make(map[string]time.Time, len(bl.until))
+	for key, until := range bl.until {
+		bans[key] = until
+	}
+	return bans
+}
@@ -0,0 +1,276 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peerserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestParseBanSubnet ensures the IPs, subnets and onion hosts are keyed the
+// same whichever way they are written.
+func TestParseBanSubnet(t *testing.T) {
+	tests := []struct {
+		subnet string
+		key    string
+		ipnet  string
+		err    bool
+	}{
+		{subnet: "1.2.3.4", key: "1.2.3.4", ipnet: "1.2.3.4/32"},
+		{subnet: "1.2.3.4/32", key: "1.2.3.4", ipnet: "1.2.3.4/32"},
+		{subnet: "::ffff:1.2.3.4", key: "1.2.3.4", ipnet: "1.2.3.4/32"},
+		{subnet: "1.2.3.0/24", key: "1.2.3.0/24", ipnet: "1.2.3.0/24"},
+		{subnet: "1.2.3.4/24", key: "1.2.3.0/24", ipnet: "1.2.3.0/24"},
+		{subnet: "2001:db8::1", key: "2001:db8::1", ipnet: "2001:db8::1/128"},
+		{subnet: "2001:db8::1/128", key: "2001:db8::1", ipnet: "2001:db8::1/128"},
+		{subnet: "2001:db8::/32", key: "2001:db8::/32", ipnet: "2001:db8::/32"},
+		{subnet: "abcdefghijklmnop.onion", key: "abcdefghijklmnop.onion"},
+		{subnet: "ABCDEFGHIJKLMNOP.onion", key: "abcdefghijklmnop.onion"},
+		{subnet: "", err: true},
+		{subnet: "seed.example", err: true},
+		{subnet: "1.2.3.4/33", err: true},
+		{subnet: "1.2.3.4:8130", err: true},
+	}
+	for _, test := range tests {
+		key, ipnet, err := parseBanSubnet(test.subnet)
+		if test.err {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %s", test.subnet, key)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.subnet, err)
+			continue
+		}
+		if key != test.key {
+			t.Errorf("%q: got key %s, want %s", test.subnet, key, test.key)
+		}
+		switch {
+		case test.ipnet == "" && ipnet != nil:
+			t.Errorf("%q: got subnet %v, want none", test.subnet, ipnet)
+		case test.ipnet != "" && (ipnet == nil || ipnet.String() != test.ipnet):
+			t.Errorf("%q: got subnet %v, want %s", test.subnet, ipnet, test.ipnet)
+		}
+	}
+}
+
+// TestBanListIsBanned ensures the hosts in the banned subnets and the banned
+// onion hosts are reported until the latest of their bans ends.
+func TestBanListIsBanned(t *testing.T) {
+	dir, err := ioutil.TempDir("", "banlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bl := newBanList(filepath.Join(dir, banListFilename))
+
+	now := time.Now()
+	bans := []struct {
+		subnet string
+		until  time.Time
+	}{
+		{"10.0.0.0/8", now.Add(time.Hour)},
+		{"10.1.2.3", now.Add(2 * time.Hour)},
+		{"2001:db8::/32", now.Add(time.Hour)},
+		{"abcdefghijklmnop.onion", now.Add(3 * time.Hour)},
+	}
+	for _, ban := range bans {
+		if err := bl.Ban(ban.subnet, ban.until); err != nil {
+			t.Fatalf("ban %s: %v", ban.subnet, err)
+		}
+	}
+	if err := bl.Ban("seed.example", now.Add(time.Hour)); err == nil {
+		t.Fatal("expected banning a host name to fail")
+	}
+
+	tests := []struct {
+		host   string
+		banned bool
+		until  time.Time
+	}{
+		{"10.200.0.1", true, bans[0].until},
+		{"10.1.2.3", true, bans[1].until},
+		{"::ffff:10.1.2.3", true, bans[1].until},
+		{"11.0.0.1", false, time.Time{}},
+		{"2001:db8:1::1", true, bans[2].until},
+		{"2001:db9::1", false, time.Time{}},
+		{"abcdefghijklmnop.onion", true, bans[3].until},
+		{"ABCDEFGHIJKLMNOP.onion", true, bans[3].until},
+		{"bcdefghijklmnopq.onion", false, time.Time{}},
+		{"seed.example", false, time.Time{}},
+		{"", false, time.Time{}},
+	}
+	for _, test := range tests {
+		until, banned := bl.IsBanned(test.host)
+		if banned != test.banned || !until.Equal(test.until) {
+			t.Errorf("%q: got %v until %v, want %v until %v", test.host,
+				banned, until, test.banned, test.until)
+		}
+	}
+
+	if !bl.Unban("ABCDEFGHIJKLMNOP.onion") {
+		t.Fatal("expected the onion host to be unbanned")
+	}
+	if _, banned := bl.IsBanned("abcdefghijklmnop.onion"); banned {
+		t.Fatal("unbanned onion host still banned")
+	}
+	if bl.Unban("abcdefghijklmnop.onion") {
+		t.Fatal("unbanned an onion host which isn't banned")
+	}
+}
+
+// TestBanListExpiry ensures the expired bans are dropped, both when the list
+// is loaded and when it is checked.
+func TestBanListExpiry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "banlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, banListFilename)
+
+	now := time.Now()
+	stored := []serializedBan{
+		{Subnet: "1.2.3.4", Until: now.Add(-time.Hour).Unix()},
+		{Subnet: "5.6.7.0/24", Until: now.Add(time.Hour).Unix()},
+		{Subnet: "abcdefghijklmnop.onion", Until: now.Add(-time.Minute).Unix()},
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	bl := newBanList(file)
+	bans := bl.List()
+	if len(bans) != 1 {
+		t.Fatalf("got bans %v, want only 5.6.7.0/24", bans)
+	}
+	if _, ok := bans["5.6.7.0/24"]; !ok {
+		t.Fatalf("got bans %v, want 5.6.7.0/24", bans)
+	}
+
+	// A ban expiring while the list is in use is removed from the file as
+	// well once a host is checked.
+	if err := bl.Ban("9.9.9.9", now.Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, banned := bl.IsBanned("9.9.9.9"); banned {
+		t.Fatal("expired ban still in effect")
+	}
+	bans = newBanList(file).List()
+	if _, ok := bans["9.9.9.9"]; ok || len(bans) != 1 {
+		t.Fatalf("got stored bans %v, want only 5.6.7.0/24", bans)
+	}
+}
+
+// TestBanListRoundTrip ensures the bans are saved to the file and loaded back
+// the same.
+func TestBanListRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "banlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, banListFilename)
+
+	// The file keeps whole seconds.
+	until := time.Unix(time.Now().Add(time.Hour).Unix(), 0)
+	bl := newBanList(file)
+	want := map[string]time.Time{
+		"1.2.3.4":                until,
+		"1.2.3.0/24":             until.Add(time.Minute),
+		"2001:db8::/32":          until.Add(2 * time.Minute),
+		"abcdefghijklmnop.onion": until.Add(3 * time.Minute),
+	}
+	for subnet, until := range want {
+		if err := bl.Ban(subnet, until); err != nil {
+			t.Fatalf("ban %s: %v", subnet, err)
+		}
+	}
+
+	loaded := newBanList(file)
+	got := loaded.List()
+	if len(got) != len(want) {
+		t.Fatalf("got bans %v, want %v", got, want)
+	}
+	for key, until := range want {
+		if !got[key].Equal(until) {
+			t.Errorf("%s: got %v, want %v", key, got[key], until)
+		}
+	}
+	if _, banned := loaded.IsBanned("1.2.3.200"); !banned {
+		t.Error("loaded subnet ban not in effect")
+	}
+	if _, banned := loaded.IsBanned("abcdefghijklmnop.onion"); !banned {
+		t.Error("loaded onion ban not in effect")
+	}
+
+	// Lifting all the bans empties the file.
+	loaded.Unban("")
+	if bans := newBanList(file).List(); len(bans) != 0 {
+		t.Fatalf("got bans %v after unbanning all", bans)
+	}
+}
+
+// TestBanListLoad ensures the invalid bans in the file are skipped, and a file
+// which fails to load isn't saved over.
+func TestBanListLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "banlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, banListFilename)
+
+	until := time.Unix(time.Now().Add(time.Hour).Unix(), 0)
+	stored := []serializedBan{
+		{Subnet: "seed.example", Until: until.Unix()},
+		{Subnet: "1.2.3.4", Until: until.Unix()},
+		{Subnet: "1.2.3.4/33", Until: until.Unix()},
+		{Subnet: "1.2.3.4/32", Until: until.Add(-time.Minute).Unix()},
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	bans := newBanList(file).List()
+	if len(bans) != 1 || !bans["1.2.3.4"].Equal(until) {
+		t.Fatalf("got bans %v, want only 1.2.3.4 until %v", bans, until)
+	}
+
+	// The bans still take effect when the file is corrupt, but they are
+	// only kept in memory.
+	corrupt := []byte(`[{"subnet": "1.2.3.4", "until": `)
+	if err := ioutil.WriteFile(file, corrupt, 0600); err != nil {
+		t.Fatal(err)
+	}
+	bl := newBanList(file)
+	if err := bl.Ban("5.6.7.8", until); err != nil {
+		t.Fatal(err)
+	}
+	if _, banned := bl.IsBanned("5.6.7.8"); !banned {
+		t.Fatal("ban not in effect")
+	}
+	bl.Unban("")
+	data, err = ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, corrupt) {
+		t.Fatalf("ban list file saved over as %q", data)
+	}
+}
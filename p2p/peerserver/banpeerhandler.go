@@ -21,6 +21,12 @@ func (s *PeerServer) BanPeer(msg *BanPeerMsg) {
 // handleBanPeerMsg deals with banning peers.  It is invoked from the
 // peerHandler goroutine.
 func (s *PeerServer) handleBanPeerMsg(state *peerState, msg *BanPeerMsg) {
+	// The inbound peers of the hidden service share the address of tor,
+	// so they are only disconnected.
+	if msg.sp.onion {
+		log.Info(fmt.Sprintf("Not banning tor hidden service peer %s", msg.sp))
+		return
+	}
 	host, _, err := net.SplitHostPort(msg.sp.Addr())
 	if err != nil {
 		log.Debug(fmt.Sprintf("can't split ban peer %s %v", msg.sp.Addr(), err))
@@ -29,7 +35,9 @@ func (s *PeerServer) handleBanPeerMsg(state *peerState, msg *BanPeerMsg) {
 	direction := directionString(msg.sp.Inbound())
 	log.Info(fmt.Sprintf("Banned peer %s (%s) for %v", host, direction,
 		connmgr.BanDuration))
-	state.banned[host] = time.Now().Add(msg.dur)
+	if err := state.banned.Ban(host, time.Now().Add(msg.dur)); err != nil {
+		log.Debug(fmt.Sprintf("can't ban peer %s %v", host, err))
+	}
 }
 
 // addBanScore increases the persistent and decaying ban score fields by the
@@ -0,0 +1,39 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peerserver
+
+import (
+	"fmt"
+	"github.com/btceasypay/bitcoinpay/core/message"
+	"github.com/btceasypay/bitcoinpay/log"
+	"time"
+)
+
+// feeFilterInterval is the interval the peers are informed of changes of the
+// minimum fee of the mempool at.
+const feeFilterInterval = 10 * time.Minute
+
+// pushFeeFilter sends the minimum fee of the mempool to the peer in a
+// feefilter message when it changed since it was last sent, so the peer does
+// not relay the transactions the mempool rejects.  It is invoked from the
+// peerHandler goroutine.
+func (s *PeerServer) pushFeeFilter(sp *serverPeer) {
+	if s.TxMemPool == nil || !sp.Connected() || sp.relayTxDisabled() {
+		return
+	}
+	minFee := int64(s.TxMemPool.MinFee())
+	if minFee == sp.sentFeeFilter {
+		return
+	}
+	log.Trace(fmt.Sprintf("Sending feefilter of %d atoms/kB to %s", minFee, sp))
+	sp.QueueMessage(message.NewMsgFeeFilter(minFee), nil)
+	sp.sentFeeFilter = minFee
+}
+
+// handleFeeFilterTick informs all peers of changes of the minimum fee of the
+// mempool.  It is invoked from the peerHandler goroutine.
+func (s *PeerServer) handleFeeFilterTick(state *peerState) {
+	state.forAllPeers(s.pushFeeFilter)
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peerserver
+
+import (
+	"fmt"
+
+	"github.com/btceasypay/bitcoinpay/core/blockdag"
+	"github.com/btceasypay/bitcoinpay/core/message"
+	"github.com/btceasypay/bitcoinpay/core/protocol"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/log"
+	"github.com/btceasypay/bitcoinpay/p2p/addmgr"
+	"github.com/btceasypay/bitcoinpay/p2p/peer"
+	"github.com/satori/go.uuid"
+)
+
+// newLightPeerConfig returns the configuration for the given serverPeer of the
+// light node, which only syncs the block headers from its peers.
+func newLightPeerConfig(sp *serverPeer) *peer.Config {
+	return &peer.Config{
+		Listeners: peer.MessageListeners{
+			OnVersion:    sp.OnLightVersion,
+			OnGetAddr:    sp.OnGetAddr,
+			OnAddr:       sp.OnAddr,
+			OnRead:       sp.OnRead,
+			OnWrite:      sp.OnWrite,
+			OnInv:        sp.OnLightInv,
+			OnHeaders:    sp.OnHeaders,
+			OnGraphState: sp.OnLightGraphState,
+			OnSyncResult: sp.OnLightSyncResult,
+			OnSyncPoint:  sp.OnLightSyncPoint,
+		},
+		NewestGS:         sp.newestLightGS,
+		HostToNetAddress: sp.server.addrManager.HostToNetAddress,
+		UserAgentName:    userAgentName,
+		UserAgentVersion: userAgentVersion,
+		ChainParams:      sp.server.chainParams,
+		Services:         sp.server.services,
+		DisableRelayTx:   true,
+		ProtocolVersion:  maxProtocolVersion,
+		TrickleInterval:  sp.server.cfg.TrickleInterval,
+	}
+}
+
+// newestLightGS returns the graph state the light node adopted from its peers.
+func (sp *serverPeer) newestLightGS() (*blockdag.GraphState, error) {
+	return sp.server.HeaderManager.GraphState(), nil
+}
+
+// OnLightVersion is invoked when a peer of the light node receives a version
+// wire message.  Only full nodes are connected to, since the light node syncs
+// the headers from them.
+func (sp *serverPeer) OnLightVersion(p *peer.Peer, msg *message.MsgVersion) *message.MsgReject {
+	if !uuid.Equal(p.UUID(), uuid.Nil) && sp.server.HasPeer(p.UUID()) {
+		return message.NewMsgReject(msg.Command(), message.RejectDuplicate, "duplicate peer version message")
+	}
+	isInbound := sp.Inbound()
+	remoteAddr := sp.NA()
+	if !sp.onion && sp.server.state.IsBanPeer(remoteAddr.IP.String()) {
+		return message.NewMsgReject(msg.Command(), message.RejectBan, "ban peer version message")
+	}
+	if sp.server.state.IsMaxInboundPeer(sp) {
+		return message.NewMsgReject(msg.Command(), message.RejectMaxInbound, "max inbound peer version message")
+	}
+	addrManager := sp.server.addrManager
+	if !sp.server.cfg.PrivNet && !isInbound {
+		addrManager.SetServices(remoteAddr, msg.Services)
+	}
+
+	// Ignore peers that have a protcol version that is too old.  The peer
+	// negotiation logic will disconnect it after this callback returns.
+	if msg.ProtocolVersion < int32(protocol.InitialProcotolVersion) {
+		return nil
+	}
+	// Reject outbound peers that are not full nodes.
+	wantServices := protocol.Full
+	if !isInbound && !protocol.HasServices(msg.Services, wantServices) {
+		missingServices := protocol.MissingServices(msg.Services, wantServices)
+		log.Debug(fmt.Sprintf("Rejecting peer %s with services %v due to not "+
+			"providing desired services %v", sp.Peer, msg.Services,
+			missingServices))
+		reason := fmt.Sprintf("required services %#x not offered",
+			uint64(missingServices))
+		return message.NewMsgReject(msg.Command(), message.RejectNonstandard, reason)
+	}
+
+	if !sp.server.cfg.PrivNet && !isInbound {
+		// Advertise the local address when the server accepts incoming
+		// connections and the headers are synced.
+		if !sp.server.cfg.DisableListen && sp.server.HeaderManager.IsCurrent() {
+			lna := addrManager.GetBestLocalAddress(remoteAddr)
+			if addmgr.IsRoutable(lna) {
+				addresses := []*types.NetAddress{lna}
+				sp.pushAddrMsg(addresses)
+			}
+		}
+		if addrManager.NeedMoreAddresses() {
+			p.QueueMessage(message.NewMsgGetAddr(), nil)
+		}
+		addrManager.Good(remoteAddr)
+	}
+
+	// The light node never relays transactions.
+	sp.setDisableRelayTx(true)
+
+	// Add the remote peer time as a sample for creating an offset against
+	// the local clock, which the header timestamps are checked against.
+	sp.server.TimeSource.AddTimeSample(p.Addr(), msg.Timestamp)
+
+	// Signal the header manager this peer is a new sync candidate.
+	sp.server.HeaderManager.NewPeer(sp.syncPeer)
+
+	// Add valid peer to the server.
+	sp.server.AddPeer(sp)
+	return nil
+}
+
+// OnLightInv is invoked when a peer of the light node receives an inv message.
+// The header manager requests the headers of the announced blocks.
+func (sp *serverPeer) OnLightInv(p *peer.Peer, msg *message.MsgInv) {
+	if len(msg.InvList) > 0 {
+		sp.server.HeaderManager.QueueInv(msg, sp.syncPeer)
+	}
+}
+
+// OnHeaders is invoked when a peer of the light node receives a headers
+// message.
+func (sp *serverPeer) OnHeaders(p *peer.Peer, msg *message.MsgHeaders) {
+	sp.server.HeaderManager.QueueHeaders(msg, sp.syncPeer)
+}
+
+// OnLightGraphState is invoked when a peer of the light node receives a
+// graphstate message.
+func (sp *serverPeer) OnLightGraphState(p *peer.Peer, msg *message.MsgGraphState) {
+	p.UpdateLastGS(msg.GS)
+	sp.server.HeaderManager.QueueGraphState(msg.GS, sp.syncPeer)
+}
+
+// OnLightSyncResult is invoked when a peer of the light node receives a
+// syncresult message.
+func (sp *serverPeer) OnLightSyncResult(p *peer.Peer, msg *message.MsgSyncResult) {
+	p.UpdateLastGS(msg.GS)
+	sp.server.HeaderManager.QueueGraphState(msg.GS, sp.syncPeer)
+}
+
+// OnLightSyncPoint is invoked when a peer of the light node receives a
+// syncpoint message.  The sync point is on the main chain of the peer.
+func (sp *serverPeer) OnLightSyncPoint(p *peer.Peer, msg *message.MsgSyncPoint) {
+	p.UpdateLastGS(msg.GS)
+	sp.server.HeaderManager.QueueSyncPoint(msg.SyncPoint, sp.syncPeer)
+}
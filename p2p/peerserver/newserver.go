@@ -8,10 +8,12 @@ import (
 	"github.com/btceasypay/bitcoinpay/core/protocol"
 	"github.com/btceasypay/bitcoinpay/core/types"
 	"github.com/btceasypay/bitcoinpay/log"
+	"github.com/btceasypay/bitcoinpay/metrics"
 	"github.com/btceasypay/bitcoinpay/p2p/addmgr"
 	"github.com/btceasypay/bitcoinpay/p2p/connmgr"
 	"github.com/btceasypay/bitcoinpay/params"
 	"net"
+	"path/filepath"
 	"strconv"
 	"time"
 )
@@ -19,6 +21,15 @@ import (
 func NewPeerServer(cfg *config.Config, chainParams *params.Params) (*PeerServer, error) {
 
 	services := defaultServices
+	if cfg.NoPeerBloomFilters {
+		services &^= protocol.Bloom
+	}
+	if cfg.NoCFilters {
+		services &^= protocol.CF
+	}
+	if cfg.LightNode {
+		services = protocol.Light
+	}
 
 	s := PeerServer{
 		services:    services,
@@ -31,6 +42,19 @@ func NewPeerServer(cfg *config.Config, chainParams *params.Params) (*PeerServer,
 		relayInv:    make(chan relayMsg, cfg.MaxPeers),
 		broadcast:   make(chan broadcastMsg, cfg.MaxPeers),
 		quit:        make(chan struct{}),
+
+		inboundPeersGauge:    metrics.NewGauge(metrics.Labeled("p2p/peers", "direction", "inbound")),
+		outboundPeersGauge:   metrics.NewGauge(metrics.Labeled("p2p/peers", "direction", "outbound")),
+		bytesReceivedCounter: metrics.NewCounter("p2p/bytes/received"),
+		bytesSentCounter:     metrics.NewCounter("p2p/bytes/sent"),
+	}
+	s.state = &peerState{
+		inboundPeers:    make(map[int32]*serverPeer),
+		persistentPeers: make(map[int32]*serverPeer),
+		outboundPeers:   make(map[int32]*serverPeer),
+		banned:          newBanList(filepath.Join(cfg.DataDir, banListFilename)),
+		outboundGroups:  make(map[string]int),
+		addedNodes:      make(map[string]*connmgr.ConnReq),
 	}
 	if cfg.BanDuration > 0 {
 		connmgr.BanDuration = cfg.BanDuration
@@ -39,7 +63,8 @@ func NewPeerServer(cfg *config.Config, chainParams *params.Params) (*PeerServer,
 	if cfg.BanThreshold > 0 {
 		connmgr.BanThreshold = cfg.BanThreshold
 	}
-	amgr := addmgr.New(cfg.DataDir, cfg.GetAddrPercent, net.LookupIP)
+	s.setupProxies(cfg)
+	amgr := addmgr.New(cfg.DataDir, cfg.GetAddrPercent, s.lookup)
 	var listeners []net.Listener
 	var nat NAT
 	if !cfg.DisableListen {
@@ -110,6 +135,27 @@ func NewPeerServer(cfg *config.Config, chainParams *params.Params) (*PeerServer,
 				}
 			}
 		}
+
+		// Publish a tor hidden service for the inbound peers, which are
+		// accepted on a listener of their own.
+		if cfg.TorControl != "" {
+			listener, onion, err := s.publishHiddenService(chainParams.DefaultPort)
+			if err != nil {
+				log.Warn("Can't publish tor hidden service", "error", err)
+			} else {
+				log.Info("Published tor hidden service", "addr", onion)
+				listeners = append(listeners, listener)
+				port, _ := strconv.ParseUint(chainParams.DefaultPort, 10, 16)
+				na, err := amgr.HostToNetAddress(onion, uint16(port), services)
+				if err == nil {
+					err = amgr.AddLocalAddress(na, addmgr.ManualPrio)
+				}
+				if err != nil {
+					log.Warn("Not advertising tor hidden service", "addr", onion,
+						"error", err)
+				}
+			}
+		}
 	}
 
 	// Only setup a function to return new addresses to connect to when
@@ -142,11 +188,12 @@ func NewPeerServer(cfg *config.Config, chainParams *params.Params) (*PeerServer,
 			if addr.GetAttempts() > 1 && time.Since(addr.LastAttempt()) < 10*time.Minute {
 				return nil, errors.New("no valid connect address")
 			}
-			if s.state.IsBanPeer(addr.NetAddress().IP.String()) {
+			addrString := addmgr.NetAddressKey(addr.NetAddress())
+			host, _, err := net.SplitHostPort(addrString)
+			if err != nil || s.state.IsBanPeer(host) {
 				return nil, errors.New("no valid connect address")
 			}
-			addrString := addmgr.NetAddressKey(addr.NetAddress())
-			return addrStringToNetAddr(addrString)
+			return s.addrStringToNetAddr(addrString)
 		}
 	}
 	// Create a connection manager.
@@ -171,21 +218,23 @@ func NewPeerServer(cfg *config.Config, chainParams *params.Params) (*PeerServer,
 	s.connManager = cmgr
 	s.nat = nat
 
-	// Start up persistent peers.
+	// Add the persistent peers, which are connected once the server
+	// starts.
 	permanentPeers := cfg.ConnectPeers
 	if len(permanentPeers) == 0 {
 		permanentPeers = cfg.AddPeers
 	}
 	for _, addr := range permanentPeers {
-		tcpAddr, err := addrStringToNetAddr(addr)
+		tcpAddr, err := s.addrStringToNetAddr(addr)
 		if err != nil {
 			return nil, err
 		}
 
-		go s.connManager.Connect(&connmgr.ConnReq{
+		c := &connmgr.ConnReq{
 			Addr:      tcpAddr,
 			Permanent: true,
-		})
+		}
+		s.state.addedNodes[addr] = c
 	}
 
 	return &s, nil
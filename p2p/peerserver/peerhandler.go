@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/btceasypay/bitcoinpay/log"
 	"github.com/btceasypay/bitcoinpay/p2p/addmgr"
+	"github.com/btceasypay/bitcoinpay/p2p/connmgr"
 	"net"
 	"sync/atomic"
 )
@@ -29,7 +30,7 @@ func (s *PeerServer) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 		sp.Disconnect()
 		return false
 	}
-	if state.IsBanPeer(host) {
+	if !sp.onion && state.IsBanPeer(host) {
 		sp.Disconnect()
 		return false
 	}
@@ -58,6 +59,10 @@ func (s *PeerServer) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 			state.outboundPeers[sp.ID()] = sp
 		}
 	}
+	s.updatePeerMetrics(state)
+
+	// Inform the peer of the minimum fee of the mempool.
+	s.pushFeeFilter(sp)
 
 	return true
 }
@@ -77,10 +82,14 @@ func (s *PeerServer) handleDonePeerMsg(state *peerState, sp *serverPeer) {
 		if !sp.Inbound() && sp.VersionKnown() {
 			state.outboundGroups[addmgr.GroupKey(sp.NA())]--
 		}
-		if !sp.Inbound() && sp.connReq != nil {
+		// The connection requests removed from the connection manager
+		// must not be retried.
+		if !sp.Inbound() && sp.connReq != nil &&
+			sp.connReq.State() != connmgr.ConnDisconnected {
 			s.connManager.Disconnect(sp.connReq.ID())
 		}
 		delete(list, sp.ID())
+		s.updatePeerMetrics(state)
 		log.Debug("Removed peer", "peer", sp)
 		return
 	}
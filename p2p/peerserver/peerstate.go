@@ -3,6 +3,7 @@ package peerserver
 import (
 	"fmt"
 	"github.com/btceasypay/bitcoinpay/log"
+	"github.com/btceasypay/bitcoinpay/p2p/connmgr"
 	"time"
 )
 
@@ -12,8 +13,12 @@ type peerState struct {
 	inboundPeers    map[int32]*serverPeer
 	outboundPeers   map[int32]*serverPeer
 	persistentPeers map[int32]*serverPeer
-	banned          map[string]time.Time
+	banned          *banList
 	outboundGroups  map[string]int
+
+	// addedNodes are the connection requests of the permanent peers added
+	// with --addpeer, --connect or the addNode RPC, keyed by their address.
+	addedNodes map[string]*connmgr.ConnReq
 }
 
 // Count returns the count of all known peers.
@@ -43,14 +48,10 @@ func (ps *peerState) forAllOutboundPeers(closure func(sp *serverPeer)) {
 }
 
 func (ps *peerState) IsBanPeer(host string) bool {
-	if banEnd, ok := ps.banned[host]; ok {
-		if time.Now().Before(banEnd) {
-			log.Debug(fmt.Sprintf("Peer %s is banned for another %v - disconnecting",
-				host, time.Until(banEnd)))
-			return true
-		}
-		log.Info("Peer is no longer banned", "peer", host)
-		delete(ps.banned, host)
+	if banEnd, ok := ps.banned.IsBanned(host); ok {
+		log.Debug(fmt.Sprintf("Peer %s is banned for another %v - disconnecting",
+			host, time.Until(banEnd)))
+		return true
 	}
 	return false
 }
@@ -0,0 +1,150 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peerserver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/btceasypay/bitcoinpay/config"
+	"github.com/btceasypay/bitcoinpay/log"
+	"github.com/btceasypay/bitcoinpay/p2p/connmgr"
+	"golang.org/x/net/proxy"
+)
+
+// dialFunc is the signature of the functions dialing the peers.
+type dialFunc func(network, addr string, timeout time.Duration) (net.Conn, error)
+
+// onionAddr implements the net.Addr interface and represents a tor address.
+type onionAddr struct {
+	addr string
+}
+
+// String returns the onion address.
+//
+// This is part of the net.Addr interface.
+func (oa *onionAddr) String() string {
+	return oa.addr
+}
+
+// Network returns "onion".
+//
+// This is part of the net.Addr interface.
+func (oa *onionAddr) Network() string {
+	return "onion"
+}
+
+// Ensure onionAddr implements the net.Addr interface.
+var _ net.Addr = (*onionAddr)(nil)
+
+// socksProxy dials connections through a SOCKS5 proxy.
+type socksProxy struct {
+	addr     string
+	username string
+	password string
+
+	// torIsolation makes each connection use random credentials, so tor
+	// sends it through its own circuit.
+	torIsolation bool
+}
+
+// dial connects to the address through the proxy.  The timeout covers the
+// handshake with the proxy as well.
+func (p *socksProxy) dial(network, addr string, timeout time.Duration) (net.Conn, error) {
+	var auth *proxy.Auth
+	if p.torIsolation {
+		var b [16]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return nil, err
+		}
+		auth = &proxy.Auth{
+			User:     hex.EncodeToString(b[:8]),
+			Password: hex.EncodeToString(b[8:]),
+		}
+	} else if p.username != "" || p.password != "" {
+		auth = &proxy.Auth{User: p.username, Password: p.password}
+	}
+	dialer, err := proxy.SOCKS5("tcp", p.addr, auth, proxy.Direct)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return dialer.(proxy.ContextDialer).DialContext(ctx, network, addr)
+}
+
+// setupProxies sets the functions used to dial the peers and to resolve host
+// names depending on the proxy options.  The default is to dial directly and to
+// use the system DNS resolver.  With --proxy, the peers are dialed through the
+// proxy and the host names are resolved by it, since it is treated as tor
+// unless --noonion or --onion is given.  --onion dials the tor hidden services
+// through another proxy, and --noonion doesn't dial them at all.
+func (s *PeerServer) setupProxies(cfg *config.Config) {
+	s.dial = net.DialTimeout
+	s.lookup = net.LookupIP
+	if cfg.Proxy != "" {
+		// Tor isolation overrides the credentials of the proxy unless
+		// there is an onion proxy, whose credentials are overridden
+		// then.
+		torIsolation := cfg.TorIsolation && cfg.OnionProxy == ""
+		if torIsolation && (cfg.ProxyUser != "" || cfg.ProxyPass != "") {
+			log.Warn("Tor isolation set -- overriding specified proxy user credentials")
+		}
+		p := &socksProxy{
+			addr:         cfg.Proxy,
+			username:     cfg.ProxyUser,
+			password:     cfg.ProxyPass,
+			torIsolation: torIsolation,
+		}
+		s.dial = p.dial
+		if !cfg.NoOnion && cfg.OnionProxy == "" {
+			s.lookup = func(host string) ([]net.IP, error) {
+				return connmgr.TorLookupIP(host, cfg.Proxy)
+			}
+		}
+	}
+
+	s.onionDial = s.dial
+	if cfg.OnionProxy != "" {
+		if cfg.TorIsolation && (cfg.OnionProxyUser != "" || cfg.OnionProxyPass != "") {
+			log.Warn("Tor isolation set -- overriding specified onion proxy user credentials")
+		}
+		p := &socksProxy{
+			addr:         cfg.OnionProxy,
+			username:     cfg.OnionProxyUser,
+			password:     cfg.OnionProxyPass,
+			torIsolation: cfg.TorIsolation,
+		}
+		s.onionDial = p.dial
+
+		// The proxy of --proxy isn't tor when --onion is given as well,
+		// so the host names are resolved by the onion proxy instead.
+		if cfg.Proxy != "" {
+			s.lookup = func(host string) ([]net.IP, error) {
+				return connmgr.TorLookupIP(host, cfg.OnionProxy)
+			}
+		}
+	}
+
+	// Tor hidden services can only be reached through a proxy.
+	if cfg.NoOnion || (cfg.Proxy == "" && cfg.OnionProxy == "") {
+		s.onionDial = nil
+	}
+}
+
+// isOnionHost returns whether or not the host is a tor hidden service.
+func isOnionHost(host string) bool {
+	return strings.HasSuffix(strings.ToLower(host), ".onion")
+}
+
+// errOnionDisabled is returned when a tor hidden service is dialed without a
+// proxy or with --noonion.
+var errOnionDisabled = errors.New("tor has been disabled")
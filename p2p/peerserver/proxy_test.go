@@ -0,0 +1,435 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peerserver
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/btceasypay/bitcoinpay/config"
+)
+
+// socksRequest is a request received by the fake SOCKS5 proxy.
+type socksRequest struct {
+	cmd  byte
+	user string
+	pass string
+	addr string
+}
+
+// fakeSocksProxy is a SOCKS5 proxy which records the requests it receives.
+// It answers the connect requests without connecting anywhere and resolves
+// every host to 10.0.0.1 for the tor resolve requests.
+type fakeSocksProxy struct {
+	net.Listener
+	requests chan socksRequest
+}
+
+// newFakeSocksProxy starts a fake SOCKS5 proxy on the loopback address.
+func newFakeSocksProxy(t *testing.T) *fakeSocksProxy {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeSocksProxy{Listener: l, requests: make(chan socksRequest, 10)}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				p.serve(c)
+			}()
+		}
+	}()
+	return p
+}
+
+// serve handles a connection to the proxy.
+func (p *fakeSocksProxy) serve(c net.Conn) error {
+	var req socksRequest
+	hdr := make([]byte, 2)
+	if _, err := io.ReadFull(c, hdr); err != nil {
+		return err
+	}
+	methods := make([]byte, hdr[1])
+	if _, err := io.ReadFull(c, methods); err != nil {
+		return err
+	}
+	method := byte(0)
+	for _, m := range methods {
+		if m == 2 {
+			method = 2
+		}
+	}
+	if _, err := c.Write([]byte{5, method}); err != nil {
+		return err
+	}
+	if method == 2 {
+		readString := func() (string, error) {
+			n := make([]byte, 1)
+			if _, err := io.ReadFull(c, n); err != nil {
+				return "", err
+			}
+			s := make([]byte, n[0])
+			_, err := io.ReadFull(c, s)
+			return string(s), err
+		}
+		if _, err := io.ReadFull(c, hdr[:1]); err != nil {
+			return err
+		}
+		var err error
+		if req.user, err = readString(); err != nil {
+			return err
+		}
+		if req.pass, err = readString(); err != nil {
+			return err
+		}
+		if _, err := c.Write([]byte{1, 0}); err != nil {
+			return err
+		}
+	}
+
+	hdr = make([]byte, 4)
+	if _, err := io.ReadFull(c, hdr); err != nil {
+		return err
+	}
+	req.cmd = hdr[1]
+	var host string
+	switch hdr[3] {
+	case 1, 4:
+		ip := make(net.IP, 4)
+		if hdr[3] == 4 {
+			ip = make(net.IP, 16)
+		}
+		if _, err := io.ReadFull(c, ip); err != nil {
+			return err
+		}
+		host = ip.String()
+	case 3:
+		n := make([]byte, 1)
+		if _, err := io.ReadFull(c, n); err != nil {
+			return err
+		}
+		name := make([]byte, n[0])
+		if _, err := io.ReadFull(c, name); err != nil {
+			return err
+		}
+		host = string(name)
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(c, port); err != nil {
+		return err
+	}
+	req.addr = net.JoinHostPort(host,
+		strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+	p.requests <- req
+
+	_, err := c.Write([]byte{5, 0, 0, 1, 10, 0, 0, 1, 0, 0})
+	return err
+}
+
+// request returns the next request received by the proxy.
+func (p *fakeSocksProxy) request(t *testing.T) socksRequest {
+	select {
+	case req := <-p.requests:
+		return req
+	case <-time.After(5 * time.Second):
+		t.Fatal("no request received by the proxy")
+	}
+	return socksRequest{}
+}
+
+// TestSocksProxyDial ensures the connections are requested from the proxy
+// with the configured credentials, or random ones with tor isolation.
+func TestSocksProxyDial(t *testing.T) {
+	fp := newFakeSocksProxy(t)
+	defer fp.Close()
+
+	tests := []struct {
+		name  string
+		proxy socksProxy
+		addr  string
+		user  string
+		pass  string
+	}{
+		{"no credentials", socksProxy{}, "1.2.3.4:8130", "", ""},
+		{"credentials", socksProxy{username: "user", password: "pass"},
+			"1.2.3.4:8130", "user", "pass"},
+		{"onion", socksProxy{}, "abcdefghijklmnop.onion:8130", "", ""},
+	}
+	for _, test := range tests {
+		test.proxy.addr = fp.Addr().String()
+		c, err := test.proxy.dial("tcp", test.addr, time.Second)
+		if err != nil {
+			t.Errorf("%s: dial: %v", test.name, err)
+			continue
+		}
+		c.Close()
+		req := fp.request(t)
+		want := socksRequest{cmd: 1, user: test.user, pass: test.pass,
+			addr: test.addr}
+		if req != want {
+			t.Errorf("%s: got request %+v, want %+v", test.name, req, want)
+		}
+	}
+
+	// Tor isolation replaces the credentials by random ones for each
+	// connection.
+	p := socksProxy{addr: fp.Addr().String(), username: "user",
+		password: "pass", torIsolation: true}
+	var users []string
+	for i := 0; i < 2; i++ {
+		c, err := p.dial("tcp", "1.2.3.4:8130", time.Second)
+		if err != nil {
+			t.Fatalf("isolated dial: %v", err)
+		}
+		c.Close()
+		req := fp.request(t)
+		if len(req.user) != 16 || len(req.pass) != 16 || req.user == "user" {
+			t.Fatalf("isolated dial: got credentials %q, %q", req.user, req.pass)
+		}
+		users = append(users, req.user)
+	}
+	if users[0] == users[1] {
+		t.Fatalf("isolated dials share the credentials %q", users[0])
+	}
+
+	// The timeout covers the handshake with a proxy which doesn't answer.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			defer c.Close()
+			time.Sleep(5 * time.Second)
+		}
+	}()
+	p = socksProxy{addr: l.Addr().String()}
+	start := time.Now()
+	if _, err := p.dial("tcp", "1.2.3.4:8130", 100*time.Millisecond); err == nil {
+		t.Fatal("expected the dial through a silent proxy to fail")
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatalf("dial through a silent proxy took %v", time.Since(start))
+	}
+}
+
+// TestSetupProxies ensures the peers are dialed and the host names resolved
+// through the proxies the options call for.
+func TestSetupProxies(t *testing.T) {
+	proxy := newFakeSocksProxy(t)
+	defer proxy.Close()
+	onion := newFakeSocksProxy(t)
+	defer onion.Close()
+
+	// The wanted proxies are nil for a direct connection or lookup, and
+	// the wanted users are "*" for random credentials.
+	tests := []struct {
+		name        string
+		cfg         config.Config
+		dial        *fakeSocksProxy
+		dialUser    string
+		lookup      *fakeSocksProxy
+		onionDial   *fakeSocksProxy
+		onionUser   string
+		onionNoDial bool
+	}{{
+		name:        "no proxy",
+		onionNoDial: true,
+	}, {
+		name:      "proxy",
+		cfg:       config.Config{Proxy: "proxy", ProxyUser: "user", ProxyPass: "pass"},
+		dial:      proxy,
+		dialUser:  "user",
+		lookup:    proxy,
+		onionDial: proxy,
+		onionUser: "user",
+	}, {
+		name:        "proxy without onion",
+		cfg:         config.Config{Proxy: "proxy", NoOnion: true},
+		dial:        proxy,
+		onionNoDial: true,
+	}, {
+		name:      "proxy with tor isolation",
+		cfg:       config.Config{Proxy: "proxy", ProxyUser: "user", ProxyPass: "pass", TorIsolation: true},
+		dial:      proxy,
+		dialUser:  "*",
+		lookup:    proxy,
+		onionDial: proxy,
+		onionUser: "*",
+	}, {
+		name:      "onion proxy",
+		cfg:       config.Config{OnionProxy: "onion", OnionProxyUser: "onionuser", OnionProxyPass: "pass"},
+		onionDial: onion,
+		onionUser: "onionuser",
+	}, {
+		name: "proxy and onion proxy",
+		cfg: config.Config{Proxy: "proxy", ProxyUser: "user", ProxyPass: "pass",
+			OnionProxy: "onion", OnionProxyUser: "onionuser", OnionProxyPass: "pass",
+			TorIsolation: true},
+		dial:      proxy,
+		dialUser:  "user",
+		lookup:    onion,
+		onionDial: onion,
+		onionUser: "*",
+	}, {
+		name:        "onion disabled",
+		cfg:         config.Config{Proxy: "proxy", OnionProxy: "onion", NoOnion: true},
+		dial:        proxy,
+		lookup:      onion,
+		onionNoDial: true,
+	}}
+
+	checkUser := func(name string, req socksRequest, want string) {
+		if want == "*" {
+			if len(req.user) != 16 {
+				t.Errorf("%s: got user %q, want random credentials", name, req.user)
+			}
+		} else if req.user != want {
+			t.Errorf("%s: got user %q, want %q", name, req.user, want)
+		}
+	}
+	isFunc := func(f, want interface{}) bool {
+		return reflect.ValueOf(f).Pointer() == reflect.ValueOf(want).Pointer()
+	}
+	for _, test := range tests {
+		cfg := test.cfg
+		if cfg.Proxy != "" {
+			cfg.Proxy = proxy.Addr().String()
+		}
+		if cfg.OnionProxy != "" {
+			cfg.OnionProxy = onion.Addr().String()
+		}
+		s := &PeerServer{}
+		s.setupProxies(&cfg)
+
+		if test.dial == nil {
+			if !isFunc(s.dial, net.DialTimeout) {
+				t.Errorf("%s: peers are not dialed directly", test.name)
+			}
+		} else {
+			c, err := s.dial("tcp", "1.2.3.4:8130", time.Second)
+			if err != nil {
+				t.Errorf("%s: dial: %v", test.name, err)
+			} else {
+				c.Close()
+				checkUser(test.name, test.dial.request(t), test.dialUser)
+			}
+		}
+
+		if test.lookup == nil {
+			if !isFunc(s.lookup, net.LookupIP) {
+				t.Errorf("%s: host names are not resolved directly", test.name)
+			}
+		} else {
+			ips, err := s.lookup("seed.example")
+			if err != nil || len(ips) != 1 || !ips[0].Equal(net.IPv4(10, 0, 0, 1)) {
+				t.Errorf("%s: lookup: got %v, %v", test.name, ips, err)
+			}
+			req := test.lookup.request(t)
+			if req.cmd != 0xF0 || req.addr != "seed.example:0" {
+				t.Errorf("%s: got lookup request %+v", test.name, req)
+			}
+		}
+
+		if test.onionNoDial {
+			if s.onionDial != nil {
+				t.Errorf("%s: onion addresses are dialed", test.name)
+			}
+			continue
+		}
+		if s.onionDial == nil {
+			t.Errorf("%s: onion addresses are not dialed", test.name)
+			continue
+		}
+		c, err := s.onionDial("tcp", "abcdefghijklmnop.onion:8130", time.Second)
+		if err != nil {
+			t.Errorf("%s: onion dial: %v", test.name, err)
+			continue
+		}
+		c.Close()
+		req := test.onionDial.request(t)
+		if req.addr != "abcdefghijklmnop.onion:8130" {
+			t.Errorf("%s: got onion request %+v", test.name, req)
+		}
+		checkUser(test.name, req, test.onionUser)
+	}
+}
+
+// TestAddrStringToNetAddr ensures the host names are resolved and the onion
+// addresses are kept as they are unless tor is disabled.
+func TestAddrStringToNetAddr(t *testing.T) {
+	s := &PeerServer{
+		lookup: func(host string) ([]net.IP, error) {
+			if host != "seed.example" {
+				return nil, nil
+			}
+			return []net.IP{net.IPv4(10, 0, 0, 2)}, nil
+		},
+	}
+
+	tests := []struct {
+		addr      string
+		onionDial bool
+		want      net.Addr
+		err       bool
+	}{
+		{"1.2.3.4:8130", false, &net.TCPAddr{IP: net.ParseIP("1.2.3.4"), Port: 8130}, false},
+		{"[::1]:8130", false, &net.TCPAddr{IP: net.ParseIP("::1"), Port: 8130}, false},
+		{"seed.example:8130", false, &net.TCPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 8130}, false},
+		{"unknown.example:8130", false, nil, true},
+		{"abcdefghijklmnop.onion:8130", true, &onionAddr{addr: "abcdefghijklmnop.onion:8130"}, false},
+		{"ABCDEFGHIJKLMNOP.ONION:8130", true, &onionAddr{addr: "ABCDEFGHIJKLMNOP.ONION:8130"}, false},
+		{"abcdefghijklmnop.onion:8130", false, nil, true},
+		{"1.2.3.4", false, nil, true},
+		{"1.2.3.4:port", false, nil, true},
+	}
+	for _, test := range tests {
+		s.onionDial = nil
+		if test.onionDial {
+			s.onionDial = net.DialTimeout
+		}
+		addr, err := s.addrStringToNetAddr(test.addr)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %v", test.addr, addr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.addr, err)
+			continue
+		}
+		if !reflect.DeepEqual(addr, test.want) {
+			t.Errorf("%s: got %v, want %v", test.addr, addr, test.want)
+		}
+	}
+
+	s.onionDial = nil
+	if _, err := s.addrStringToNetAddr("abcdefghijklmnop.onion:8130"); err != errOnionDisabled {
+		t.Errorf("onion address with tor disabled: got %v, want %v", err,
+			errOnionDisabled)
+	}
+	addr, _ := s.addrStringToNetAddr("1.2.3.4:8130")
+	if addr.Network() != "tcp" {
+		t.Errorf("got network %s, want tcp", addr.Network())
+	}
+	s.onionDial = net.DialTimeout
+	addr, _ = s.addrStringToNetAddr("abcdefghijklmnop.onion:8130")
+	if addr.Network() != "onion" {
+		t.Errorf("got network %s, want onion", addr.Network())
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/btceasypay/bitcoinpay/common/hash"
 	"github.com/btceasypay/bitcoinpay/core/message"
 	"github.com/btceasypay/bitcoinpay/log"
+	"github.com/btceasypay/bitcoinpay/services/bloom"
 )
 
 // pushBlockMsg sends a block message for the provided block hash to the
@@ -32,3 +33,63 @@ func (s *PeerServer) pushBlockMsg(sp *serverPeer, hash *hash.Hash, doneChan chan
 
 	return nil
 }
+
+// pushMerkleBlockMsg sends a merkleblock message for the provided block hash to
+// the connected peer.  Since a merkle block requires the peer to have a filter
+// loaded, this call will simply be ignored if there is no filter loaded.  An
+// error is returned if the block hash is not known.
+func (s *PeerServer) pushMerkleBlockMsg(sp *serverPeer, hash *hash.Hash,
+	doneChan chan<- struct{}, waitChan <-chan struct{}) error {
+
+	// Do not send a response if the peer doesn't have a filter loaded.
+	if !sp.filter.IsLoaded() {
+		if doneChan != nil {
+			doneChan <- struct{}{}
+		}
+		return nil
+	}
+
+	// Fetch the raw block bytes from the database.
+	block, err := sp.server.BlockManager.GetChain().FetchBlockByHash(hash)
+	if err != nil {
+		log.Trace("Unable to fetch requested block hash", "hash", hash,
+			"error", err)
+
+		if doneChan != nil {
+			doneChan <- struct{}{}
+		}
+		return err
+	}
+
+	// Generate a merkle block by filtering the requested block according
+	// to the filter for the peer.
+	merkle, matchedTxIndices := bloom.NewMerkleBlock(block, sp.filter)
+
+	// Once we have fetched data wait for any previous operation to finish.
+	if waitChan != nil {
+		<-waitChan
+	}
+
+	// Send the merkleblock.  Only send the done channel with this message
+	// if no transactions will be sent afterwards.
+	var dc chan<- struct{}
+	if len(matchedTxIndices) == 0 {
+		dc = doneChan
+	}
+	sp.QueueMessage(merkle, dc)
+
+	// Finally, send any matched transactions.
+	blkTransactions := block.Block().Transactions
+	for i, txIndex := range matchedTxIndices {
+		// Only send the done channel on the final transaction.
+		var dc chan<- struct{}
+		if i == len(matchedTxIndices)-1 {
+			dc = doneChan
+		}
+		if txIndex < uint32(len(blkTransactions)) {
+			sp.QueueMessage(&message.MsgTx{Tx: blkTransactions[txIndex]}, dc)
+		}
+	}
+
+	return nil
+}
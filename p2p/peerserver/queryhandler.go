@@ -7,7 +7,12 @@ package peerserver
 
 import (
 	"errors"
+	"fmt"
+	"github.com/btceasypay/bitcoinpay/log"
+	"github.com/btceasypay/bitcoinpay/p2p/connmgr"
 	"github.com/satori/go.uuid"
+	"net"
+	"time"
 )
 
 type getConnCountMsg struct {
@@ -24,7 +29,7 @@ type getOutboundGroup struct {
 }
 
 type getAddedNodesMsg struct {
-	reply chan []*serverPeer
+	reply chan []AddedNodeInfo
 }
 
 type disconnectNodeMsg struct {
@@ -39,10 +44,16 @@ type connectNodeMsg struct {
 }
 
 type removeNodeMsg struct {
-	cmp   func(*serverPeer) bool
+	addr  string
 	reply chan error
 }
 
+type setBanMsg struct {
+	subnet string
+	until  time.Time
+	reply  chan error
+}
+
 type getPeerMsg struct {
 	uuid  uuid.UUID
 	reply chan bool
@@ -72,9 +83,68 @@ func (s *PeerServer) handleQuery(state *peerState, querymsg interface{}) {
 		msg.reply <- peers
 
 	case connectNodeMsg:
-		msg.reply <- errors.New("not support")
+		if _, ok := state.addedNodes[msg.addr]; ok {
+			msg.reply <- errors.New("node already added")
+			return
+		}
+		if state.Count() >= s.cfg.MaxPeers {
+			msg.reply <- errors.New("max peers reached")
+			return
+		}
+		netAddr, err := s.addrStringToNetAddr(msg.addr)
+		if err != nil {
+			msg.reply <- err
+			return
+		}
+		c := &connmgr.ConnReq{
+			Addr:      netAddr,
+			Permanent: msg.permanent,
+		}
+		// Register the request before replying, so a remove right
+		// after the add finds it.
+		if !s.connManager.Register(c) {
+			msg.reply <- errors.New("server is shutting down")
+			return
+		}
+		if msg.permanent {
+			state.addedNodes[msg.addr] = c
+		}
+		go s.connManager.Connect(c)
+		msg.reply <- nil
+
 	case removeNodeMsg:
-		msg.reply <- errors.New("not support")
+		c, ok := state.addedNodes[msg.addr]
+		if !ok {
+			msg.reply <- errors.New("node not found")
+			return
+		}
+		delete(state.addedNodes, msg.addr)
+
+		// Stop connecting to the node, its peer is disconnected by the
+		// connection manager.  The requests of the added nodes are
+		// registered, so they always have an ID.
+		s.connManager.Remove(c.ID())
+		msg.reply <- nil
+
+	case setBanMsg:
+		if err := state.banned.Ban(msg.subnet, msg.until); err != nil {
+			msg.reply <- err
+			return
+		}
+		log.Info(fmt.Sprintf("Banned %s until %v", msg.subnet, msg.until))
+		key, ipnet, _ := parseBanSubnet(msg.subnet)
+		state.forAllPeers(func(sp *serverPeer) {
+			host, _, err := net.SplitHostPort(sp.Addr())
+			if err != nil || sp.onion {
+				return
+			}
+			if banContains(key, ipnet, host) {
+				log.Info("Disconnecting banned peer", "peer", sp)
+				sp.Disconnect()
+			}
+		})
+		msg.reply <- nil
+
 	case getOutboundGroup:
 		count, ok := state.outboundGroups[msg.key]
 		if ok {
@@ -83,10 +153,33 @@ func (s *PeerServer) handleQuery(state *peerState, querymsg interface{}) {
 			msg.reply <- 0
 		}
 	case getAddedNodesMsg:
-		peers := make([]*serverPeer, 0)
-		msg.reply <- peers
+		nodes := make([]AddedNodeInfo, 0, len(state.addedNodes))
+		for addr, c := range state.addedNodes {
+			node := AddedNodeInfo{Addr: addr}
+			for _, sp := range state.persistentPeers {
+				if sp.connReq == c && sp.Connected() {
+					node.Connected = true
+					node.PeerID = sp.ID()
+					break
+				}
+			}
+			nodes = append(nodes, node)
+		}
+		msg.reply <- nodes
+
 	case disconnectNodeMsg:
-		msg.reply <- errors.New("not support")
+		found := false
+		state.forAllPeers(func(sp *serverPeer) {
+			if msg.cmp(sp) {
+				sp.Disconnect()
+				found = true
+			}
+		})
+		if !found {
+			msg.reply <- errors.New("peer not found")
+			return
+		}
+		msg.reply <- nil
 
 	case getPeerMsg:
 		has := false
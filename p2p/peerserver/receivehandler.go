@@ -39,7 +39,7 @@ func (sp *serverPeer) OnVersion(p *peer.Peer, msg *message.MsgVersion) *message.
 	}
 	isInbound := sp.Inbound()
 	remoteAddr := sp.NA()
-	if sp.server.state.IsBanPeer(remoteAddr.IP.String()) {
+	if !sp.onion && sp.server.state.IsBanPeer(remoteAddr.IP.String()) {
 		return message.NewMsgReject(msg.Command(), message.RejectBan, "ban peer version message")
 	}
 	if sp.server.state.IsMaxInboundPeer(sp) {
@@ -231,6 +231,27 @@ func (sp *serverPeer) OnBlock(p *peer.Peer, msg *message.MsgBlock, buf []byte) {
 	log.Trace("OnBlock done, sp.syncPeer.BlockProcessed")
 }
 
+// OnGetUtxoSnapshot is invoked when a peer receives a getutxosnap wire message.
+// It sends the requested chunk of the utxo set at the order of the block.
+func (sp *serverPeer) OnGetUtxoSnapshot(_ *peer.Peer, msg *message.MsgGetUtxoSnapshot) {
+	snap, err := sp.server.BlockManager.ServeUtxoSnapshot(msg)
+	if err != nil {
+		log.Debug(fmt.Sprintf("Could not obtain utxo snapshot of %v: %v", msg.BlockHash, err))
+		return
+	}
+	sp.QueueMessage(snap, nil)
+}
+
+// OnUtxoSnapshot is invoked when a peer receives a utxosnap wire message.  It
+// blocks until the chunk of the utxo set has been fully processed.
+func (sp *serverPeer) OnUtxoSnapshot(_ *peer.Peer, msg *message.MsgUtxoSnapshot) {
+	sp.server.BlockManager.QueueUtxoSnapshot(msg, sp.syncPeer)
+	score := <-sp.syncPeer.BlockProcessed
+	if score > connmgr.NoneScore {
+		sp.addBanScore(0, uint32(score), "onutxosnap")
+	}
+}
+
 // OnGetBlocks is invoked when a peer receives a getblocks wire message.
 func (sp *serverPeer) OnGetBlocks(p *peer.Peer, msg *message.MsgGetBlocks) {
 	if msg.GS.IsGenesis() && !msg.GS.GetTips().HasOnly(sp.server.chainParams.GenesisHash) {
@@ -389,6 +410,8 @@ func (sp *serverPeer) OnGetData(p *peer.Peer, msg *message.MsgGetData) {
 			err = sp.server.pushTxMsg(sp, &iv.Hash, c, waitChan)
 		case message.InvTypeBlock:
 			err = sp.server.pushBlockMsg(sp, &iv.Hash, c, waitChan)
+		case message.InvTypeFilteredBlock:
+			err = sp.server.pushMerkleBlockMsg(sp, &iv.Hash, c, waitChan)
 		default:
 			log.Warn("Unknown type in inventory request", "type", iv.Type)
 			continue
@@ -512,6 +535,12 @@ func (sp *serverPeer) OnMemPool(_ *peer.Peer, msg *message.MsgMemPool) {
 	invMsg := message.NewMsgInvSizeHint(uint(len(txDescs)))
 
 	for _, txDesc := range txDescs {
+		// Either add all transactions when there is no bloom filter,
+		// or only the transactions that match the filter when there is
+		// one.
+		if sp.filter.IsLoaded() && !sp.filter.MatchTxAndUpdate(txDesc.Tx) {
+			continue
+		}
 		iv := message.NewInvVect(message.InvTypeTx, txDesc.Tx.Hash())
 		invMsg.AddInvVect(iv)
 		if len(invMsg.InvList)+1 > message.MaxInvPerMsg {
@@ -523,3 +552,143 @@ func (sp *serverPeer) OnMemPool(_ *peer.Peer, msg *message.MsgMemPool) {
 		sp.QueueMessage(invMsg, nil)
 	}
 }
+
+// OnGetCFilter is invoked when a peer receives a getcfilter wire message.
+func (sp *serverPeer) OnGetCFilter(_ *peer.Peer, msg *message.MsgGetCFilter) {
+	// Ignore getcfilter requests if not in sync or the index is disabled.
+	cfIndex := sp.server.CfIndex
+	if cfIndex == nil || !sp.server.BlockManager.IsCurrent() {
+		return
+	}
+
+	filterBytes, err := cfIndex.FilterByBlockHash(&msg.BlockHash, msg.FilterType)
+	if err != nil {
+		log.Debug(fmt.Sprintf("Could not obtain cfilter for %v: %v", msg.BlockHash, err))
+		return
+	}
+
+	filterMsg := message.NewMsgCFilter(msg.FilterType, &msg.BlockHash, filterBytes)
+	sp.QueueMessage(filterMsg, nil)
+}
+
+// OnGetCFHeaders is invoked when a peer receives a getcfheader wire message.
+func (sp *serverPeer) OnGetCFHeaders(_ *peer.Peer, msg *message.MsgGetCFHeaders) {
+	// Ignore getcfheader requests if not in sync or the index is disabled.
+	cfIndex := sp.server.CfIndex
+	if cfIndex == nil || !sp.server.BlockManager.IsCurrent() {
+		return
+	}
+
+	// The filter headers are chained in DAG order, so the range ends at the
+	// order of the stop block.
+	bd := sp.server.BlockManager.GetChain().BlockDAG()
+	stop := bd.GetBlock(&msg.StopHash)
+	if stop == nil || !stop.IsOrdered() {
+		log.Debug(fmt.Sprintf("Unknown or unordered stop block %v in getcfheaders", msg.StopHash))
+		return
+	}
+	stopOrder := uint64(stop.GetOrder())
+	if msg.StartOrder > stopOrder {
+		return
+	}
+	if stopOrder-msg.StartOrder >= message.MaxCFHeadersPerMsg {
+		stopOrder = msg.StartOrder + message.MaxCFHeadersPerMsg - 1
+	}
+
+	filterHashes, prevHeader, err := cfIndex.FilterHashesByOrderRange(msg.FilterType,
+		msg.StartOrder, stopOrder)
+	if err != nil {
+		log.Debug(fmt.Sprintf("Could not obtain cfilter hashes: %v", err))
+		return
+	}
+
+	headersMsg := message.NewMsgCFHeaders()
+	headersMsg.FilterType = msg.FilterType
+	headersMsg.PrevFilterHeader = *prevHeader
+	if h := bd.GetBlockByOrder(uint(stopOrder)); h != nil {
+		headersMsg.StopHash = *h
+	}
+	for _, filterHash := range filterHashes {
+		headersMsg.AddCFHash(filterHash)
+	}
+	sp.QueueMessage(headersMsg, nil)
+}
+
+// OnGetCFTypes is invoked when a peer receives a getcftypes wire message.
+func (sp *serverPeer) OnGetCFTypes(_ *peer.Peer, msg *message.MsgGetCFTypes) {
+	// Ignore getcftypes requests if the index is disabled.
+	if sp.server.CfIndex == nil {
+		return
+	}
+
+	cfTypesMsg := message.NewMsgCFTypes([]message.FilterType{message.GCSFilterRegular})
+	sp.QueueMessage(cfTypesMsg, nil)
+}
+
+// enforceNodeBloomFlag disconnects the peer if the server is not configured to
+// allow bloom filters.
+func (sp *serverPeer) enforceNodeBloomFlag(cmd string) bool {
+	if sp.server.services&protocol.Bloom != protocol.Bloom {
+		log.Debug(fmt.Sprintf("%s sent an unsupported %s request -- disconnecting",
+			sp, cmd))
+		sp.Disconnect()
+		return false
+	}
+	return true
+}
+
+// OnFilterAdd is invoked when a peer receives a filteradd wire message and is
+// used by remote peers to add data to an already loaded bloom filter.  The peer
+// will be disconnected if a filter is not loaded when this message is received
+// or the server is not configured to allow bloom filters.
+func (sp *serverPeer) OnFilterAdd(_ *peer.Peer, msg *message.MsgFilterAdd) {
+	// Disconnect and/or ban depending on the node bloom services flag and
+	// negotiated protocol version.
+	if !sp.enforceNodeBloomFlag(msg.Command()) {
+		return
+	}
+
+	if !sp.filter.IsLoaded() {
+		log.Debug(fmt.Sprintf("%s sent a filteradd request with no filter loaded -- disconnecting", sp))
+		sp.Disconnect()
+		return
+	}
+
+	sp.filter.Add(msg.Data)
+}
+
+// OnFilterClear is invoked when a peer receives a filterclear wire message and
+// is used by remote peers to clear an already loaded bloom filter.  The peer
+// will be disconnected if a filter is not loaded when this message is received
+// or the server is not configured to allow bloom filters.
+func (sp *serverPeer) OnFilterClear(_ *peer.Peer, msg *message.MsgFilterClear) {
+	// Disconnect and/or ban depending on the node bloom services flag and
+	// negotiated protocol version.
+	if !sp.enforceNodeBloomFlag(msg.Command()) {
+		return
+	}
+
+	if !sp.filter.IsLoaded() {
+		log.Debug(fmt.Sprintf("%s sent a filterclear request with no filter loaded -- disconnecting", sp))
+		sp.Disconnect()
+		return
+	}
+
+	sp.filter.Unload()
+}
+
+// OnFilterLoad is invoked when a peer receives a filterload wire message and it
+// is used to load a bloom filter that should be used for delivering merkle
+// blocks and associated transactions that match the filter.  The peer will be
+// disconnected if the server is not configured to allow bloom filters.
+func (sp *serverPeer) OnFilterLoad(_ *peer.Peer, msg *message.MsgFilterLoad) {
+	// Disconnect and/or ban depending on the node bloom services flag and
+	// negotiated protocol version.
+	if !sp.enforceNodeBloomFlag(msg.Command()) {
+		return
+	}
+
+	sp.setDisableRelayTx(false)
+
+	sp.filter.Reload(msg)
+}
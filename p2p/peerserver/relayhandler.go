@@ -5,7 +5,6 @@ import (
 	"github.com/btceasypay/bitcoinpay/core/message"
 	"github.com/btceasypay/bitcoinpay/core/types"
 	"github.com/btceasypay/bitcoinpay/log"
-	"github.com/btceasypay/bitcoinpay/services/mempool"
 	"sync/atomic"
 )
 
@@ -44,13 +43,28 @@ func (s *PeerServer) handleRelayInvMsg(state *peerState, msg relayMsg) {
 				return
 			}
 
-			txD, ok := msg.data.(*mempool.TxDesc)
+			txD, ok := msg.data.(*types.TxDesc)
 			if ok {
 				feeFilter := atomic.LoadInt64(&sp.feeFilter)
 				if feeFilter > 0 && txD.FeePerKB < feeFilter {
 					return
 				}
 			}
+
+			// Don't relay the transaction if there is a bloom
+			// filter loaded and the transaction doesn't match it.
+			if sp.filter.IsLoaded() {
+				txD, ok := msg.data.(*types.TxDesc)
+				if !ok {
+					log.Warn("Underlying data for tx inv " +
+						"relay is not a transaction")
+					return
+				}
+
+				if !sp.filter.MatchTxAndUpdate(txD.Tx) {
+					return
+				}
+			}
 		} else if msg.invVect.Type == message.InvTypeBlock {
 			gs = s.BlockManager.GetChain().BestSnapshot().GraphState
 			sp.QueueInventoryImmediate(msg.invVect, gs)
@@ -20,11 +20,15 @@ import (
 	"github.com/btceasypay/bitcoinpay/p2p/peer"
 	"github.com/btceasypay/bitcoinpay/params"
 	"github.com/btceasypay/bitcoinpay/services/blkmgr"
+	"github.com/btceasypay/bitcoinpay/services/hdrmgr"
+	"github.com/btceasypay/bitcoinpay/services/index"
 	"github.com/btceasypay/bitcoinpay/services/mempool"
 	"github.com/btceasypay/bitcoinpay/version"
+	gometrics "github.com/rcrowley/go-metrics"
 	"github.com/satori/go.uuid"
 	"net"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -32,7 +36,7 @@ import (
 
 const (
 	// the default services supported by the node
-	defaultServices = protocol.Full | protocol.CF
+	defaultServices = protocol.Full | protocol.Bloom | protocol.CF | protocol.UtxoSnapshot
 
 	// the default services that are required to be supported
 	defaultRequiredServices = protocol.Full
@@ -81,6 +85,16 @@ type PeerServer struct {
 	connManager *connmgr.ConnManager
 	nat         NAT
 
+	// dial and onionDial connect to the peers and to the tor hidden
+	// services, the latter is nil when they can't be reached.  lookup
+	// resolves host names.  They depend on the proxy options.
+	dial      dialFunc
+	onionDial dialFunc
+	lookup    func(string) ([]net.IP, error)
+
+	// torController keeps the hidden service published with --torcontrol.
+	torController *torController
+
 	newPeers  chan *serverPeer
 	donePeers chan *serverPeer
 	banPeers  chan *BanPeerMsg
@@ -99,10 +113,21 @@ type PeerServer struct {
 	TimeSource   blockchain.MedianTimeSource
 	BlockManager *blkmgr.BlockManager
 	TxMemPool    *mempool.TxPool
+	CfIndex      *index.CfIndex
+
+	// HeaderManager syncs the block headers when running as a light node,
+	// the block manager is not used then.
+	HeaderManager *hdrmgr.HeaderManager
 
 	services protocol.ServiceFlag
 
 	state *peerState
+
+	// Metrics of the connected peers and of the bytes transferred.
+	inboundPeersGauge    gometrics.Gauge
+	outboundPeersGauge   gometrics.Gauge
+	bytesReceivedCounter gometrics.Counter
+	bytesSentCounter     gometrics.Counter
 }
 
 // OutboundGroupCount returns the number of peers connected to the given
@@ -119,7 +144,8 @@ func (s *PeerServer) OutboundGroupCount(key string) int {
 // for disconnection.
 func (s *PeerServer) inboundPeerConnected(c *connmgr.ConnReq) {
 	sp := newServerPeer(s, false)
-	sp.isWhitelisted = isWhitelisted(s.cfg, c.Conn().RemoteAddr())
+	_, sp.onion = c.Conn().(*onionConn)
+	sp.isWhitelisted = !sp.onion && isWhitelisted(s.cfg, c.Conn().RemoteAddr())
 	sp.Peer = peer.NewInboundPeer(newPeerConfig(sp))
 	sp.syncPeer.Peer = sp.Peer
 	sp.connReq = c
@@ -150,32 +176,39 @@ func (s *PeerServer) outboundPeerConnected(c *connmgr.ConnReq) {
 
 // newPeerConfig returns the configuration for the given serverPeer.
 func newPeerConfig(sp *serverPeer) *peer.Config {
-
+	if sp.server.HeaderManager != nil {
+		return newLightPeerConfig(sp)
+	}
 	return &peer.Config{
 		Listeners: peer.MessageListeners{
-			OnVersion:        sp.OnVersion,
-			OnGetAddr:        sp.OnGetAddr,
-			OnAddr:           sp.OnAddr,
-			OnRead:           sp.OnRead,
-			OnWrite:          sp.OnWrite,
-			OnGetBlocks:      sp.OnGetBlocks,
-			OnGetHeaders:     sp.OnGetHeaders,
-			OnBlock:          sp.OnBlock,
-			OnGetData:        sp.OnGetData,
-			OnInv:            sp.OnInv,
-			OnGetMiningState: sp.OnGetMiningState,
-			OnMiningState:    sp.OnMiningState,
-			OnTx:             sp.OnTx,
-			OnGraphState:     sp.OnGraphState,
-			OnMemPool:        sp.OnMemPool,
-			OnSyncResult:     sp.OnSyncResult,
-			OnSyncDAG:        sp.OnSyncDAG,
-			OnSyncPoint:      sp.OnSyncPoint,
-			OnFeeFilter:      sp.OnFeeFilter,
+			OnVersion:         sp.OnVersion,
+			OnGetAddr:         sp.OnGetAddr,
+			OnAddr:            sp.OnAddr,
+			OnRead:            sp.OnRead,
+			OnWrite:           sp.OnWrite,
+			OnGetBlocks:       sp.OnGetBlocks,
+			OnGetHeaders:      sp.OnGetHeaders,
+			OnBlock:           sp.OnBlock,
+			OnGetData:         sp.OnGetData,
+			OnInv:             sp.OnInv,
+			OnGetMiningState:  sp.OnGetMiningState,
+			OnMiningState:     sp.OnMiningState,
+			OnTx:              sp.OnTx,
+			OnGraphState:      sp.OnGraphState,
+			OnMemPool:         sp.OnMemPool,
+			OnSyncResult:      sp.OnSyncResult,
+			OnSyncDAG:         sp.OnSyncDAG,
+			OnSyncPoint:       sp.OnSyncPoint,
+			OnFeeFilter:       sp.OnFeeFilter,
+			OnGetCFilter:      sp.OnGetCFilter,
+			OnGetCFHeaders:    sp.OnGetCFHeaders,
+			OnGetCFTypes:      sp.OnGetCFTypes,
+			OnFilterAdd:       sp.OnFilterAdd,
+			OnFilterClear:     sp.OnFilterClear,
+			OnFilterLoad:      sp.OnFilterLoad,
+			OnGetUtxoSnapshot: sp.OnGetUtxoSnapshot,
+			OnUtxoSnapshot:    sp.OnUtxoSnapshot,
 			//OnHeaders:        sp.OnHeaders,
-			//OnGetCFilter:     sp.OnGetCFilter,
-			//OnGetCFHeaders:   sp.OnGetCFHeaders,
-			//OnGetCFTypes:     sp.OnGetCFTypes,
 		},
 		NewestGS:         sp.newestGS,
 		HostToNetAddress: sp.server.addrManager.HostToNetAddress,
@@ -186,6 +219,7 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 		DisableRelayTx:   sp.server.cfg.BlocksOnly,
 		ProtocolVersion:  maxProtocolVersion,
 		TrickleInterval:  sp.server.cfg.TrickleInterval,
+		Proxy:            sp.server.cfg.Proxy,
 	}
 }
 
@@ -217,8 +251,9 @@ func isWhitelisted(cfg *config.Config, addr net.Addr) bool {
 
 // addrStringToNetAddr takes an address in the form of 'host:port' and returns
 // a net.Addr which maps to the original address with any host names resolved
-// to IP addresses.
-func addrStringToNetAddr(addr string) (net.Addr, error) {
+// to IP addresses.  Tor addresses can't be resolved, so an onion address is
+// returned for them instead.
+func (s *PeerServer) addrStringToNetAddr(addr string) (net.Addr, error) {
 	host, strPort, err := net.SplitHostPort(addr)
 	if err != nil {
 		return nil, err
@@ -237,8 +272,15 @@ func addrStringToNetAddr(addr string) (net.Addr, error) {
 		}, nil
 	}
 
+	if isOnionHost(host) {
+		if s.onionDial == nil {
+			return nil, errOnionDisabled
+		}
+		return &onionAddr{addr: addr}, nil
+	}
+
 	// Attempt to look up an IP address associated with the parsed host.
-	ips, err := net.LookupIP(host)
+	ips, err := s.lookup(host)
 	if err != nil {
 		return nil, err
 	}
@@ -280,6 +322,11 @@ func (p *PeerServer) Stop() error {
 	}
 	log.Warn("Stopping P2P Server")
 
+	// Remove the tor hidden service.
+	if p.torController != nil {
+		p.torController.Close()
+	}
+
 	// Signal the remaining goroutines to quit.
 	close(p.quit)
 	log.Warn("wait for P2P stop ...")
@@ -304,12 +351,22 @@ func (s *PeerServer) AddPeer(sp *serverPeer) {
 // counter for the server.  It is safe for concurrent access.
 func (s *PeerServer) AddBytesReceived(bytesReceived uint64) {
 	atomic.AddUint64(&s.bytesReceived, bytesReceived)
+	s.bytesReceivedCounter.Inc(int64(bytesReceived))
 }
 
 // AddBytesSent adds the passed number of bytes to the total bytes sent counter
 // for the server.  It is safe for concurrent access.
 func (s *PeerServer) AddBytesSent(bytesSent uint64) {
 	atomic.AddUint64(&s.bytesSent, bytesSent)
+	s.bytesSentCounter.Inc(int64(bytesSent))
+}
+
+// updatePeerMetrics updates the metrics of the connected peers.  It is invoked
+// from the peerHandler goroutine.
+func (s *PeerServer) updatePeerMetrics(state *peerState) {
+	s.inboundPeersGauge.Update(int64(len(state.inboundPeers)))
+	s.outboundPeersGauge.Update(int64(len(state.outboundPeers) +
+		len(state.persistentPeers)))
 }
 
 // peerDoneHandler handles peer disconnects by notifiying the server that it's
@@ -321,8 +378,12 @@ func (s *PeerServer) peerDoneHandler(sp *serverPeer) {
 
 	// Only tell block manager we are gone if we ever told it we existed.
 	if sp.VersionKnown() && !sp.connReq.Ban {
-		log.Trace("peerDoneHandler send blkmgr donePeerMsg ")
-		s.BlockManager.DonePeer(sp.syncPeer)
+		if s.HeaderManager != nil {
+			s.HeaderManager.DonePeer(sp.syncPeer)
+		} else {
+			log.Trace("peerDoneHandler send blkmgr donePeerMsg ")
+			s.BlockManager.DonePeer(sp.syncPeer)
+		}
 	}
 	close(sp.quit)
 	log.Trace("stop peerDoneHandler")
@@ -337,18 +398,11 @@ func (s *PeerServer) peerHandler() {
 
 	log.Trace("Starting peer handler")
 
-	state := &peerState{
-		inboundPeers:    make(map[int32]*serverPeer),
-		persistentPeers: make(map[int32]*serverPeer),
-		outboundPeers:   make(map[int32]*serverPeer),
-		banned:          make(map[string]time.Time),
-		outboundGroups:  make(map[string]int),
-	}
-	s.state = state
+	state := s.state
 
 	if !s.cfg.DisableDNSSeed {
 		// Add peers discovered through DNS to the address manager.
-		connmgr.SeedFromDNS(s.chainParams, defaultRequiredServices, net.LookupIP, func(addrs []*types.NetAddress) {
+		connmgr.SeedFromDNS(s.chainParams, defaultRequiredServices, s.lookup, func(addrs []*types.NetAddress) {
 			// Bitcoind uses a lookup of the dns seeder here. This
 			// is rather strange since the values looked up by the
 			// DNS seed lookups will vary quite a lot.
@@ -359,6 +413,16 @@ func (s *PeerServer) peerHandler() {
 	}
 	go s.connManager.Start()
 
+	// Connect to the persistent peers.  They are registered first, so they
+	// can be removed before the connection attempts begin.
+	for _, c := range state.addedNodes {
+		s.connManager.Register(c)
+		go s.connManager.Connect(c)
+	}
+
+	feeFilterTicker := time.NewTicker(feeFilterInterval)
+	defer feeFilterTicker.Stop()
+
 out:
 	for {
 		select {
@@ -387,6 +451,10 @@ out:
 		case qmsg := <-s.query:
 			s.handleQuery(state, qmsg)
 
+		// The minimum fee of the mempool rises when it is full.
+		case <-feeFilterTicker.C:
+			s.handleFeeFilterTick(state)
+
 		case <-s.quit:
 			// Disconnect all peers on server shutdown.
 			state.forAllPeers(func(sp *serverPeer) {
@@ -429,9 +497,16 @@ func (s *PeerServer) BroadcastMessage(msg message.Message, exclPeers ...*serverP
 	s.broadcast <- bmsg
 }
 
-// Dial connects to the address on the named network.
+// Dial connects to the address on the named network.  Tor hidden services are
+// dialed through the onion proxy.
 func (s *PeerServer) Dial(network, addr string) (net.Conn, error) {
-	return net.DialTimeout(network, addr, defaultConnectTimeout)
+	if network == "onion" || strings.Contains(addr, ".onion:") {
+		if s.onionDial == nil {
+			return nil, errOnionDisabled
+		}
+		return s.onionDial("tcp", addr, defaultConnectTimeout)
+	}
+	return s.dial(network, addr, defaultConnectTimeout)
 }
 
 // ConnectedCount returns the number of currently connected peers.
@@ -458,18 +533,67 @@ func (s *PeerServer) HasPeer(uuid uuid.UUID) bool {
 }
 
 func (s *PeerServer) GetBanlist() map[string]time.Time {
-	return s.state.banned
+	return s.state.banned.List()
 }
 
 func (s *PeerServer) RemoveBan(host string) {
 	if len(host) == 0 {
-		s.state.banned = map[string]time.Time{}
+		s.state.banned.Unban("")
 		log.Trace("Remove all ban")
 		return
 	}
-	_, ok := s.state.banned[host]
-	if ok {
-		delete(s.state.banned, host)
+	if s.state.banned.Unban(host) {
 		log.Trace(fmt.Sprintf("RemoveBan:%s", host))
 	}
 }
+
+// SetBan bans the IP, the subnet in the CIDR notation or the onion host for
+// the duration and disconnects the peers in it.
+func (s *PeerServer) SetBan(subnet string, dur time.Duration) error {
+	replyChan := make(chan error)
+	s.query <- setBanMsg{subnet: subnet, until: time.Now().Add(dur), reply: replyChan}
+	return <-replyChan
+}
+
+// AddedNodeInfo describes a node added with --addpeer, --connect or AddNode.
+type AddedNodeInfo struct {
+	Addr      string
+	Connected bool
+	PeerID    int32
+}
+
+// AddNode adds the node to the permanent peers with "add", removes it from
+// them with "remove", or connects to it once with "onetry".
+func (s *PeerServer) AddNode(addr string, cmd string) error {
+	replyChan := make(chan error)
+	switch cmd {
+	case "add":
+		s.query <- connectNodeMsg{addr: addr, permanent: true, reply: replyChan}
+	case "remove":
+		s.query <- removeNodeMsg{addr: addr, reply: replyChan}
+	case "onetry":
+		s.query <- connectNodeMsg{addr: addr, permanent: false, reply: replyChan}
+	default:
+		return fmt.Errorf("invalid command %q, expected add, remove or onetry", cmd)
+	}
+	return <-replyChan
+}
+
+// DisconnectNode disconnects the peer with the ID or the address.
+func (s *PeerServer) DisconnectNode(target string) error {
+	cmp := func(sp *serverPeer) bool { return sp.Addr() == target }
+	if id, err := strconv.ParseInt(target, 10, 32); err == nil {
+		cmp = func(sp *serverPeer) bool { return sp.ID() == int32(id) }
+	}
+	replyChan := make(chan error)
+	s.query <- disconnectNodeMsg{cmp: cmp, reply: replyChan}
+	return <-replyChan
+}
+
+// GetAddedNodeInfo returns the nodes added with --addpeer, --connect or
+// AddNode.
+func (s *PeerServer) GetAddedNodeInfo() []AddedNodeInfo {
+	replyChan := make(chan []AddedNodeInfo)
+	s.query <- getAddedNodesMsg{reply: replyChan}
+	return <-replyChan
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/btceasypay/bitcoinpay/p2p/addmgr"
 	"github.com/btceasypay/bitcoinpay/p2p/connmgr"
 	"github.com/btceasypay/bitcoinpay/p2p/peer"
+	"github.com/btceasypay/bitcoinpay/services/bloom"
 	"sync"
 	"sync/atomic"
 )
@@ -35,6 +36,11 @@ type serverPeer struct {
 	banScore       connmgr.DynamicBanScore
 	quit           chan struct{}
 
+	// onion is set for the inbound peers of the tor hidden service.  They
+	// all connect from the address of tor, so they are neither whitelisted
+	// nor banned by it.
+	onion bool
+
 	// addrsSent tracks whether or not the peer has responded to a getaddr
 	// request.  It is used to prevent more than one response per connection.
 	addrsSent bool
@@ -44,6 +50,14 @@ type serverPeer struct {
 
 	// Use to fee filter
 	feeFilter int64
+
+	// sentFeeFilter is the minimum fee last sent to the peer in a feefilter
+	// message.  It is only used by the peerHandler goroutine.
+	sentFeeFilter int64
+
+	// filter is the bloom filter loaded by the peer, transactions are only
+	// relayed to it when they match the loaded filter.
+	filter *bloom.Filter
 }
 
 // newServerPeer returns a new serverPeer instance. The peer needs to be set by
@@ -53,6 +67,7 @@ func newServerPeer(s *PeerServer, isPersistent bool) *serverPeer {
 		server:         s,
 		persistent:     isPersistent,
 		knownAddresses: make(map[string]struct{}),
+		filter:         bloom.LoadFilter(nil),
 		quit:           make(chan struct{}),
 		syncPeer: &peer.ServerPeer{
 			TxProcessed:     make(chan struct{}, 1),
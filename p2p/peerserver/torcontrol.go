@@ -0,0 +1,240 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peerserver
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// torControlOK is the status code of the successful replies of the tor
+	// control port.
+	torControlOK = 250
+
+	// onionKeyFilename is the name of the file in the data directory which
+	// keeps the private key of the hidden service, so its address stays
+	// the same across restarts.
+	onionKeyFilename = "onion_key"
+
+	// onionKeyType is the type of the private keys of the version 3 hidden
+	// services.  The version 2 services are no longer supported since tor
+	// 0.4.6.
+	onionKeyType = "ED25519-V3"
+)
+
+// torController publishes a tor hidden service through the tor control port.
+// The service is removed by tor once the connection to the control port is
+// closed.
+type torController struct {
+	conn *textproto.Conn
+}
+
+// newTorController connects to the tor control port and authenticates with the
+// password, or with the cookie file of tor when there is no password.
+func newTorController(addr, password string) (*torController, error) {
+	c, err := net.DialTimeout("tcp", addr, defaultConnectTimeout)
+	if err != nil {
+		return nil, err
+	}
+	tc := &torController{conn: textproto.NewConn(c)}
+	if err := tc.authenticate(password); err != nil {
+		tc.Close()
+		return nil, err
+	}
+	return tc, nil
+}
+
+// command sends the command to the control port and returns the lines of the
+// reply.
+func (tc *torController) command(format string, args ...interface{}) ([]string, error) {
+	id, err := tc.conn.Cmd(format, args...)
+	if err != nil {
+		return nil, err
+	}
+	tc.conn.StartResponse(id)
+	defer tc.conn.EndResponse(id)
+
+	_, msg, err := tc.conn.ReadResponse(torControlOK)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(msg, "\n"), nil
+}
+
+// authenticate authenticates the connection to the control port.
+func (tc *torController) authenticate(password string) error {
+	if password != "" {
+		_, err := tc.command("AUTHENTICATE %s", quoteTorString(password))
+		return err
+	}
+
+	lines, err := tc.command("PROTOCOLINFO 1")
+	if err != nil {
+		return err
+	}
+	var methods []string
+	var cookieFile string
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "AUTH ") {
+			continue
+		}
+		for _, field := range strings.Fields(line)[1:] {
+			switch {
+			case strings.HasPrefix(field, "METHODS="):
+				methods = strings.Split(field[len("METHODS="):], ",")
+			case strings.HasPrefix(field, "COOKIEFILE="):
+				cookieFile, err = strconv.Unquote(field[len("COOKIEFILE="):])
+				if err != nil {
+					return fmt.Errorf("invalid tor cookie file %s",
+						field[len("COOKIEFILE="):])
+				}
+			}
+		}
+	}
+
+	for _, method := range methods {
+		switch method {
+		case "NULL":
+			_, err := tc.command("AUTHENTICATE")
+			return err
+
+		case "COOKIE":
+			cookie, err := ioutil.ReadFile(cookieFile)
+			if err != nil {
+				return err
+			}
+			_, err = tc.command("AUTHENTICATE %s", hex.EncodeToString(cookie))
+			return err
+		}
+	}
+	return errors.New("the tor control port requires a password -- " +
+		"set it with --torcontrolpass")
+}
+
+// addOnion publishes a hidden service with the private key, or a new version 3
+// service when the key is empty, which forwards the connections to the port to the target
+// address.  It returns the service ID, which is the onion address without the
+// .onion suffix, and the private key of a new service.
+func (tc *torController) addOnion(key string, port string, target string) (string, string, error) {
+	flags := ""
+	if key == "" {
+		key = "NEW:" + onionKeyType
+	} else {
+		flags = " Flags=DiscardPK"
+	}
+	lines, err := tc.command("ADD_ONION %s%s Port=%s,%s", key, flags, port,
+		target)
+	if err != nil {
+		return "", "", err
+	}
+
+	var serviceID, privateKey string
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "ServiceID="):
+			serviceID = line[len("ServiceID="):]
+		case strings.HasPrefix(line, "PrivateKey="):
+			privateKey = line[len("PrivateKey="):]
+		}
+	}
+	if serviceID == "" {
+		return "", "", errors.New("no service ID in the reply of the " +
+			"tor control port")
+	}
+	return serviceID, privateKey, nil
+}
+
+// Close closes the connection to the control port, which removes the hidden
+// service.
+func (tc *torController) Close() error {
+	return tc.conn.Close()
+}
+
+// quoteTorString returns the string quoted as required by the tor control
+// protocol.
+func quoteTorString(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	return `"` + s + `"`
+}
+
+// onionListener accepts the connections tor forwards to the hidden service.
+// They all come from the address of tor, so they are returned as onionConn to
+// tell them from the other inbound connections.
+type onionListener struct {
+	net.Listener
+}
+
+// Accept waits for and returns the next connection to the hidden service.
+//
+// This is part of the net.Listener interface.
+func (l *onionListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &onionConn{Conn: c}, nil
+}
+
+// onionConn is an inbound connection through the tor hidden service.
+type onionConn struct {
+	net.Conn
+}
+
+// publishHiddenService publishes a tor hidden service for the peers connecting
+// on the port.  Tor forwards them to a listener of their own on the loopback
+// address, which is returned with the onion address of the service.  The
+// private key of the service is kept in the data directory.
+func (s *PeerServer) publishHiddenService(port string) (net.Listener, string, error) {
+	tc, err := newTorController(s.cfg.TorControl, s.cfg.TorControlPass)
+	if err != nil {
+		return nil, "", err
+	}
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		tc.Close()
+		return nil, "", err
+	}
+	fail := func(err error) (net.Listener, string, error) {
+		listener.Close()
+		tc.Close()
+		return nil, "", err
+	}
+
+	// The keys of other service versions, which tor no longer supports, are
+	// replaced.
+	keyFile := filepath.Join(s.cfg.DataDir, onionKeyFilename)
+	key, err := ioutil.ReadFile(keyFile)
+	if err != nil && !os.IsNotExist(err) {
+		return fail(err)
+	}
+	onionKey := strings.TrimSpace(string(key))
+	if !strings.HasPrefix(onionKey, onionKeyType+":") {
+		onionKey = ""
+	}
+	serviceID, privateKey, err := tc.addOnion(onionKey, port,
+		listener.Addr().String())
+	if err != nil {
+		return fail(err)
+	}
+	if privateKey != "" {
+		err := ioutil.WriteFile(keyFile, []byte(privateKey), 0600)
+		if err != nil {
+			return fail(err)
+		}
+	}
+
+	s.torController = tc
+	return &onionListener{Listener: listener}, serviceID + ".onion", nil
+}
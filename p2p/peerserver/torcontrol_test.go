@@ -0,0 +1,207 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peerserver
+
+import (
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// fakeTorControl answers the commands sent on the other end of the pipe with
+// the replies in order, and returns the commands it received once the replies
+// are sent or the pipe is closed.
+func fakeTorControl(c net.Conn, replies []string) <-chan []string {
+	done := make(chan []string, 1)
+	go func() {
+		var cmds []string
+		tc := textproto.NewConn(c)
+		defer func() {
+			tc.Close()
+			done <- cmds
+		}()
+		for _, reply := range replies {
+			cmd, err := tc.ReadLine()
+			if err != nil {
+				return
+			}
+			cmds = append(cmds, cmd)
+			if err := tc.PrintfLine("%s", reply); err != nil {
+				return
+			}
+		}
+	}()
+	return done
+}
+
+// newPipeTorController returns a controller talking to a fake control port
+// which answers with the replies.
+func newPipeTorController(replies []string) (*torController, <-chan []string) {
+	client, server := net.Pipe()
+	done := fakeTorControl(server, replies)
+	return &torController{conn: textproto.NewConn(client)}, done
+}
+
+// TestTorControllerAuthenticate ensures the controller authenticates with the
+// methods offered by the control port.
+func TestTorControllerAuthenticate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "torcontrol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cookieFile := filepath.Join(dir, "control_auth_cookie")
+	if err := ioutil.WriteFile(cookieFile, []byte{0x01, 0xab, 0xff}, 0600); err != nil {
+		t.Fatal(err)
+	}
+	protocolInfo := func(auth string) string {
+		return "250-PROTOCOLINFO 1\r\n250-" + auth +
+			"\r\n250-VERSION Tor=\"0.3.5.8\"\r\n250 OK"
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		replies  []string
+		cmds     []string
+		err      bool
+	}{{
+		name:     "password",
+		password: `pa"ss\word`,
+		replies:  []string{"250 OK"},
+		cmds:     []string{`AUTHENTICATE "pa\"ss\\word"`},
+	}, {
+		name:    "null",
+		replies: []string{protocolInfo("AUTH METHODS=NULL"), "250 OK"},
+		cmds:    []string{"PROTOCOLINFO 1", "AUTHENTICATE"},
+	}, {
+		name: "cookie",
+		replies: []string{protocolInfo("AUTH METHODS=COOKIE,SAFECOOKIE COOKIEFILE=" +
+			strconv.Quote(cookieFile)), "250 OK"},
+		cmds: []string{"PROTOCOLINFO 1", "AUTHENTICATE 01abff"},
+	}, {
+		name:    "password required",
+		replies: []string{protocolInfo("AUTH METHODS=HASHEDPASSWORD")},
+		cmds:    []string{"PROTOCOLINFO 1"},
+		err:     true,
+	}, {
+		name:    "missing cookie",
+		replies: []string{protocolInfo(`AUTH METHODS=COOKIE COOKIEFILE="/nonexistent/cookie"`)},
+		cmds:    []string{"PROTOCOLINFO 1"},
+		err:     true,
+	}, {
+		name:    "bad cookie file",
+		replies: []string{protocolInfo("AUTH METHODS=COOKIE COOKIEFILE=cookie")},
+		cmds:    []string{"PROTOCOLINFO 1"},
+		err:     true,
+	}, {
+		name:     "rejected",
+		password: "wrong",
+		replies:  []string{"515 Authentication failed: Password did not match"},
+		cmds:     []string{`AUTHENTICATE "wrong"`},
+		err:      true,
+	}}
+	for _, test := range tests {
+		tc, done := newPipeTorController(test.replies)
+		err := tc.authenticate(test.password)
+		tc.Close()
+		cmds := <-done
+		if test.err != (err != nil) {
+			t.Errorf("%s: got error %v, want error %v", test.name, err, test.err)
+		}
+		if !reflect.DeepEqual(cmds, test.cmds) {
+			t.Errorf("%s: got commands %q, want %q", test.name, cmds, test.cmds)
+		}
+	}
+}
+
+// TestTorControllerAddOnion ensures the hidden services are requested as
+// version 3 services and the replies of the control port are parsed.
+func TestTorControllerAddOnion(t *testing.T) {
+	tests := []struct {
+		name       string
+		key        string
+		reply      string
+		cmd        string
+		serviceID  string
+		privateKey string
+		err        bool
+	}{{
+		name:       "new service",
+		reply:      "250-ServiceID=abcdefghijklmnopqrstuvwxyz234567abcdefghijklmnopqrstuvwx\r\n250-PrivateKey=ED25519-V3:c2VjcmV0\r\n250 OK",
+		cmd:        "ADD_ONION NEW:ED25519-V3 Port=8130,127.0.0.1:40000",
+		serviceID:  "abcdefghijklmnopqrstuvwxyz234567abcdefghijklmnopqrstuvwx",
+		privateKey: "ED25519-V3:c2VjcmV0",
+	}, {
+		name:      "stored key",
+		key:       "ED25519-V3:c2VjcmV0",
+		reply:     "250-ServiceID=abcdefghijklmnopqrstuvwxyz234567abcdefghijklmnopqrstuvwx\r\n250 OK",
+		cmd:       "ADD_ONION ED25519-V3:c2VjcmV0 Flags=DiscardPK Port=8130,127.0.0.1:40000",
+		serviceID: "abcdefghijklmnopqrstuvwxyz234567abcdefghijklmnopqrstuvwx",
+	}, {
+		name:  "no service ID",
+		reply: "250 OK",
+		cmd:   "ADD_ONION NEW:ED25519-V3 Port=8130,127.0.0.1:40000",
+		err:   true,
+	}, {
+		name:  "rejected",
+		reply: "512 Invalid key type",
+		cmd:   "ADD_ONION NEW:ED25519-V3 Port=8130,127.0.0.1:40000",
+		err:   true,
+	}}
+	for _, test := range tests {
+		tc, done := newPipeTorController([]string{test.reply})
+		serviceID, privateKey, err := tc.addOnion(test.key, "8130",
+			"127.0.0.1:40000")
+		tc.Close()
+		cmds := <-done
+		if test.err != (err != nil) {
+			t.Errorf("%s: got error %v, want error %v", test.name, err, test.err)
+		}
+		if len(cmds) != 1 || cmds[0] != test.cmd {
+			t.Errorf("%s: got commands %q, want %q", test.name, cmds, test.cmd)
+		}
+		if serviceID != test.serviceID || privateKey != test.privateKey {
+			t.Errorf("%s: got %q, %q, want %q, %q", test.name, serviceID,
+				privateKey, test.serviceID, test.privateKey)
+		}
+	}
+}
+
+// TestOnionListener ensures the connections accepted for the hidden service
+// are told from the other inbound connections.
+func TestOnionListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ol := &onionListener{Listener: l}
+	defer ol.Close()
+
+	go func() {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err == nil {
+			c.Close()
+		}
+	}()
+	c, err := ol.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, ok := c.(*onionConn); !ok {
+		t.Fatalf("accepted %T, want *onionConn", c)
+	}
+
+	ol.Close()
+	if _, err := ol.Accept(); err == nil {
+		t.Fatal("expected accepting on a closed listener to fail")
+	}
+}
@@ -44,9 +44,14 @@ var CPUMinerThreads = 1
 // Each checkpoint is selected based upon several factors.  See the
 // documentation for blockchain.IsCheckpointCandidate for details on the
 // selection criteria.
+//
+// UtxoRoot is the utxo commitment root at the order of the checkpoint block.
+// It is optional and lets new nodes download the utxo set from peers instead
+// of replaying the blocks before the checkpoint.
 type Checkpoint struct {
-	Layer uint64
-	Hash  *hash.Hash
+	Layer    uint64
+	Hash     *hash.Hash
+	UtxoRoot *hash.Hash
 }
 
 // DNSSeed identifies a DNS seed.
@@ -75,6 +80,24 @@ type ConsensusDeployment struct {
 	ExpireTime uint64
 }
 
+// Constants that define the deployment offset in the deployments of the block
+// version for each deployment.  This is useful to be able to get the details
+// of a specific deployment by name.
+const (
+	// DeploymentCheckMultiSigAlt defines the rule change deployment ID for
+	// the OP_CHECKMULTISIGALT opcode.
+	DeploymentCheckMultiSigAlt = iota
+
+	// DeploymentAssets defines the rule change deployment ID for the asset
+	// outputs and their issuance and transfer rules.
+	DeploymentAssets
+
+	// DefinedDeployments is the number of currently defined deployments.
+	// It must always come last since it is used to determine how many
+	// defined deployments there currently are.
+	DefinedDeployments
+)
+
 // Params defines a bitcoinpay network by its parameters.  These parameters may be
 // used by bitcoinpay applications to differentiate networks as well as addresses
 // and keys for one network from those intended for use on another network.
@@ -222,6 +245,10 @@ type Params struct {
 	// for any given address encoded as a string.
 	NetworkAddressPrefix string
 
+	// Bech32HRP is the human-readable prefix of the bech32 encoded
+	// addresses of the network.
+	Bech32HRP string
+
 	// Address encoding magics
 	PubKeyAddrID     [2]byte // First 2 bytes of a P2PK address
 	PubKeyHashAddrID [2]byte // First 2 bytes of P2PKH address
@@ -84,10 +84,26 @@ var MainNetParams = Params{
 	// Checkpoints ordered from oldest to newest.
 	Checkpoints: []Checkpoint{},
 
-	Deployments: map[uint32][]ConsensusDeployment{},
+	RuleChangeActivationThreshold: 1916, // 95% of MinerConfirmationWindow
+	MinerConfirmationWindow:       2016,
+	Deployments: map[uint32][]ConsensusDeployment{
+		1: {
+			DeploymentCheckMultiSigAlt: {
+				BitNumber:  0,
+				StartTime:  1798761600, // 2027-01-01 00:00:00 +0000 UTC
+				ExpireTime: 1830297600, // 2028-01-01 00:00:00 +0000 UTC
+			},
+			DeploymentAssets: {
+				BitNumber:  1,
+				StartTime:  1798761600, // 2027-01-01 00:00:00 +0000 UTC
+				ExpireTime: 1830297600, // 2028-01-01 00:00:00 +0000 UTC
+			},
+		},
+	},
 
 	// Address encoding magics
 	NetworkAddressPrefix: "N",
+	Bech32HRP:            "bp",
 	PubKeyAddrID:         [2]byte{0x0c, 0x3e}, // starts with Nk
 	PubKeyHashAddrID:     [2]byte{0x0c, 0x41}, // starts with Nm
 	PKHEdwardsAddrID:     [2]byte{0x0c, 0x30}, // starts with Ne
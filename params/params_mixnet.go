@@ -90,10 +90,26 @@ var MixNetParams = Params{
 
 	// Consensus rule change deployments.
 	//
-	Deployments: map[uint32][]ConsensusDeployment{},
+	RuleChangeActivationThreshold: 1512, // 75% of MinerConfirmationWindow
+	MinerConfirmationWindow:       2016,
+	Deployments: map[uint32][]ConsensusDeployment{
+		18: {
+			DeploymentCheckMultiSigAlt: {
+				BitNumber:  0,
+				StartTime:  1790812800, // 2026-10-01 00:00:00 +0000 UTC
+				ExpireTime: 1822348800, // 2027-10-01 00:00:00 +0000 UTC
+			},
+			DeploymentAssets: {
+				BitNumber:  1,
+				StartTime:  1790812800, // 2026-10-01 00:00:00 +0000 UTC
+				ExpireTime: 1822348800, // 2027-10-01 00:00:00 +0000 UTC
+			},
+		},
+	},
 
 	// Address encoding magics
 	NetworkAddressPrefix: "X",
+	Bech32HRP:            "xp",
 	PubKeyAddrID:         [2]byte{0x11, 0x6e}, // starts with Xx
 	PubKeyHashAddrID:     [2]byte{0x11, 0x53}, // starts with Xm
 	PKHEdwardsAddrID:     [2]byte{0x11, 0x3c}, // starts with Xc
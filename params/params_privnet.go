@@ -10,6 +10,7 @@ import (
 	"github.com/btceasypay/bitcoinpay/common"
 	"github.com/btceasypay/bitcoinpay/core/protocol"
 	"github.com/btceasypay/bitcoinpay/core/types/pow"
+	"math"
 	"math/big"
 	"time"
 )
@@ -113,10 +114,26 @@ var PrivNetParams = Params{
 	Checkpoints: nil,
 
 	// Consensus rule change deployments.
-	Deployments: map[uint32][]ConsensusDeployment{},
+	RuleChangeActivationThreshold: 108, // 75% of MinerConfirmationWindow
+	MinerConfirmationWindow:       144,
+	Deployments: map[uint32][]ConsensusDeployment{
+		12: {
+			DeploymentCheckMultiSigAlt: {
+				BitNumber:  0,
+				StartTime:  0,             // Always available for vote
+				ExpireTime: math.MaxInt64, // Never expires
+			},
+			DeploymentAssets: {
+				BitNumber:  1,
+				StartTime:  0,             // Always available for vote
+				ExpireTime: math.MaxInt64, // Never expires
+			},
+		},
+	},
 
 	// Address encoding magics
 	NetworkAddressPrefix: "R",
+	Bech32HRP:            "rp",
 	PubKeyAddrID:         [2]byte{0x0d, 0xef}, // starts with Rk
 	PubKeyHashAddrID:     [2]byte{0x0d, 0xf1}, // starts with Rm
 	PKHEdwardsAddrID:     [2]byte{0x0d, 0xdf}, // starts with Re
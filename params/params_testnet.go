@@ -95,10 +95,26 @@ var TestNetParams = Params{
 
 	// Consensus rule change deployments.
 	//
-	Deployments: map[uint32][]ConsensusDeployment{},
+	RuleChangeActivationThreshold: 1512, // 75% of MinerConfirmationWindow
+	MinerConfirmationWindow:       2016,
+	Deployments: map[uint32][]ConsensusDeployment{
+		12: {
+			DeploymentCheckMultiSigAlt: {
+				BitNumber:  0,
+				StartTime:  1790812800, // 2026-10-01 00:00:00 +0000 UTC
+				ExpireTime: 1822348800, // 2027-10-01 00:00:00 +0000 UTC
+			},
+			DeploymentAssets: {
+				BitNumber:  1,
+				StartTime:  1790812800, // 2026-10-01 00:00:00 +0000 UTC
+				ExpireTime: 1822348800, // 2027-10-01 00:00:00 +0000 UTC
+			},
+		},
+	},
 
 	// Address encoding magics
 	NetworkAddressPrefix: "T",
+	Bech32HRP:            "tp",
 	PubKeyAddrID:         [2]byte{0x0f, 0x0f}, // starts with Tk
 	PubKeyHashAddrID:     [2]byte{0x0f, 0x12}, // starts with Tm
 	PKHEdwardsAddrID:     [2]byte{0x0f, 0x01}, // starts with Te
@@ -26,6 +26,8 @@ const (
 	subscribeMethodSuffix    = "_subscribe"
 	unsubscribeMethodSuffix  = "_unsubscribe"
 	notificationMethodSuffix = "_subscription"
+	subscribeMethod          = "subscribe"
+	unsubscribeMethod        = "unsubscribe"
 )
 
 // These are all service namespace in node
@@ -194,6 +196,11 @@ func parseRequest(incomingMsg json.RawMessage) ([]rpcRequest, bool, Error) {
 
 		id := &in[i].Id
 
+		// bare subscribe/unsubscribe calls belong to the default namespace
+		if r.Method == subscribeMethod || r.Method == unsubscribeMethod {
+			r.Method = DefaultServiceNameSpace + serviceMethodSeparator + r.Method
+		}
+
 		// subscribe are special, they will always use `subscriptionMethod` as first param in the payload
 		if strings.HasSuffix(r.Method, subscribeMethodSuffix) {
 			requests[i] = rpcRequest{id: id, isPubSub: true}
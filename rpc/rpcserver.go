@@ -10,6 +10,7 @@ import (
 	"github.com/btceasypay/bitcoinpay/common/util"
 	"github.com/btceasypay/bitcoinpay/config"
 	"github.com/btceasypay/bitcoinpay/log"
+	"github.com/btceasypay/bitcoinpay/metrics"
 	"github.com/deckarep/golang-set"
 	"golang.org/x/net/context"
 	"io"
@@ -46,6 +47,8 @@ type RpcServer struct {
 
 	authsha                [sha256.Size]byte
 	numClients             int32
+	numWebsockets          int32
+	listeners              []net.Listener
 	statusLines            map[int]string
 	requestProcessShutdown chan struct{}
 
@@ -139,6 +142,9 @@ func (s *RpcServer) Start() error {
 func (s *RpcServer) Stop() {
 	if atomic.CompareAndSwapInt32(&s.run, 1, 0) {
 		log.Debug("RPC Server is stopping")
+		for _, listener := range s.listeners {
+			listener.Close()
+		}
 		s.codecsMu.Lock()
 		defer s.codecsMu.Unlock()
 		s.codecs.Each(func(c interface{}) bool {
@@ -186,10 +192,15 @@ func (s *RpcServer) startHTTP(listenAddrs []string) error {
 		// Read and respond to the request.
 		s.jsonRPCRead(w, r)
 	})
+	// Websocket endpoint, serves requests and subscriptions on a
+	// persistent connection.
+	rpcServeMux.HandleFunc(websocketPath, s.handleWebsocket)
+
 	listeners, err := parseListeners(s.config, listenAddrs)
 	if err != nil {
 		return err
 	}
+	s.listeners = listeners
 	for _, listener := range listeners {
 		s.wg.Add(1)
 		go func(listener net.Listener) {
@@ -603,7 +614,10 @@ func (s *RpcServer) handle(ctx context.Context, codec ServerCodec, req *serverRe
 
 	s.AddRequstStatus(req)
 	// execute RPC method and return result
+	start := time.Now()
 	reply := req.callb.method.Func.Call(arguments)
+	metrics.NewTimer(metrics.Labeled("rpc/duration", "method",
+		formatName(req.callb.method.Name))).UpdateSince(start)
 	s.RemoveRequstStatus(req)
 	if len(reply) == 0 {
 		return codec.CreateResponse(req.id, nil), nil
@@ -130,6 +130,13 @@ func (n *Notifier) Closed() <-chan interface{} {
 	return n.codec.Closed()
 }
 
+// Close closes the RPC connection of the notifier, which ends all of its
+// subscriptions.  The client notices the closed connection and can subscribe
+// again.
+func (n *Notifier) Close() {
+	n.codec.Close()
+}
+
 // unsubscribe a subscription.
 // If the subscription could not be found ErrSubscriptionNotFound is returned.
 func (n *Notifier) unsubscribe(id ID) error {
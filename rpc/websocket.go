@@ -0,0 +1,193 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+//
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// The parts code inspired by
+// https://github.com/ethereum/go-ethereum/rpc
+
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/btceasypay/bitcoinpay/log"
+	"golang.org/x/net/context"
+	"golang.org/x/net/websocket"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// websocketPath is the path on the RPC listeners which upgrades the
+// connection to a websocket.
+const websocketPath = "/ws"
+
+// websocketJSONCodec is a custom JSON codec with payload size enforcement and
+// special number parsing.
+var websocketJSONCodec = websocket.Codec{
+	// Marshal is the stock JSON marshaller used by the websocket library too.
+	Marshal: func(v interface{}) ([]byte, byte, error) {
+		msg, err := json.Marshal(v)
+		return msg, websocket.TextFrame, err
+	},
+	// Unmarshal is a specialized unmarshaller to properly convert numbers.
+	Unmarshal: func(msg []byte, payloadType byte, v interface{}) error {
+		dec := json.NewDecoder(bytes.NewReader(msg))
+		dec.UseNumber()
+
+		return dec.Decode(v)
+	},
+}
+
+// ServeCodec reads incoming requests from codec, calls the appropriate callback and writes
+// the response back using the given codec. It will block until the codec is closed or the
+// server is stopped. In either case the codec is closed.
+func (s *RpcServer) ServeCodec(ctx context.Context, codec ServerCodec, options CodecOption) {
+	defer codec.Close()
+	s.serveRequest(ctx, codec, false, options)
+}
+
+// websocketHandler returns a handler that serves JSON-RPC to websocket
+// connections. Callers must authenticate the request before handing it
+// over, the handshake only checks the origin.
+func (s *RpcServer) websocketHandler(r *http.Request) http.Handler {
+	return websocket.Server{
+		Handshake: func(cfg *websocket.Config, req *http.Request) error {
+			origin, err := websocket.Origin(cfg, req)
+			if err != nil {
+				return err
+			}
+			return s.checkOrigin(origin, req)
+		},
+		Handler: func(conn *websocket.Conn) {
+			// The http server enforces a read timeout for the initial
+			// handshake, websocket clients are long lived so clear it.
+			conn.SetDeadline(time.Time{})
+			conn.MaxPayloadBytes = maxRequestContentLength
+
+			encoder := func(v interface{}) error {
+				return websocketJSONCodec.Send(conn, v)
+			}
+			decoder := func(v interface{}) error {
+				return websocketJSONCodec.Receive(conn, v)
+			}
+
+			ctx := context.Background()
+			ctx = context.WithValue(ctx, "remote", r.RemoteAddr)
+			ctx = context.WithValue(ctx, "scheme", "ws")
+			ctx = context.WithValue(ctx, "local", r.Host)
+
+			log.Debug("New websocket client", "remote", r.RemoteAddr)
+			s.ServeCodec(ctx, NewCodec(conn, encoder, decoder),
+				OptionMethodInvocation|OptionSubscriptions)
+			log.Debug("Websocket client disconnected", "remote", r.RemoteAddr)
+		},
+	}
+}
+
+// handleWebsocket authenticates the request, enforces the websocket client
+// limit and upgrades the connection.
+func (s *RpcServer) handleWebsocket(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&s.run) != 1 { // server stopped
+		http.Error(w, "503 Server is shutting down.", http.StatusServiceUnavailable)
+		return
+	}
+
+	_, err := s.checkAuth(r, true)
+	if err != nil {
+		jsonAuthFail(w)
+		return
+	}
+
+	// Limit the number of websocket connections to max allowed and keep
+	// track of the number of connected websocket clients.
+	if s.limitWebsockets(w, r.RemoteAddr) {
+		return
+	}
+	defer s.decrementWebsockets()
+
+	s.websocketHandler(r).ServeHTTP(w, r)
+}
+
+// limitWebsockets adds one to the number of connected websocket clients, or
+// responds with a 503 service unavailable and returns true if adding another
+// websocket client would exceed the maximum allowed.  The caller must call
+// decrementWebsockets once the client is gone when it returns false.
+//
+// This function is safe for concurrent access.
+func (s *RpcServer) limitWebsockets(w http.ResponseWriter, remoteAddr string) bool {
+	for {
+		n := atomic.LoadInt32(&s.numWebsockets)
+		if int(n+1) > s.config.RPCMaxWebsockets {
+			log.Info("RPC websocket clients exceeded", "max", s.config.RPCMaxWebsockets,
+				"client", remoteAddr)
+			http.Error(w, "503 Too busy.  Try again later.",
+				http.StatusServiceUnavailable)
+			return true
+		}
+		if atomic.CompareAndSwapInt32(&s.numWebsockets, n, n+1) {
+			return false
+		}
+	}
+}
+
+// decrementWebsockets subtracts one from the number of connected websocket
+// clients.
+//
+// This function is safe for concurrent access.
+func (s *RpcServer) decrementWebsockets() {
+	atomic.AddInt32(&s.numWebsockets, -1)
+}
+
+// checkOrigin rejects the websocket handshakes of the browser pages which are
+// not served from one of the RPC listen hosts.  Clients which send no origin,
+// which is the case of everything but browsers, are accepted.
+func (s *RpcServer) checkOrigin(origin *url.URL, r *http.Request) error {
+	if origin == nil {
+		return nil
+	}
+	host := strings.ToLower(origin.Hostname())
+	for _, listenAddr := range s.config.RPCListeners {
+		listenHost, _, err := net.SplitHostPort(listenAddr)
+		if err != nil {
+			listenHost = listenAddr
+		}
+		listenHost = strings.ToLower(strings.Trim(listenHost, "[]"))
+		if host == listenHost {
+			return nil
+		}
+		ip := net.ParseIP(listenHost)
+		if listenHost == "localhost" || (ip != nil && ip.IsLoopback()) {
+			if isLoopbackHost(host) {
+				return nil
+			}
+		}
+		// Listening on all interfaces, the pages served by the node
+		// itself come from the host the client connected to.
+		if listenHost == "" || (ip != nil && ip.IsUnspecified()) {
+			reqHost, _, err := net.SplitHostPort(r.Host)
+			if err != nil {
+				reqHost = r.Host
+			}
+			if host == strings.ToLower(strings.Trim(reqHost, "[]")) {
+				return nil
+			}
+		}
+	}
+	log.Info("Rejected websocket origin", "origin", origin, "client", r.RemoteAddr)
+	return fmt.Errorf("origin %s not allowed", origin)
+}
+
+// isLoopbackHost returns whether or not the host is localhost or a loopback IP.
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,219 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+//
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/btceasypay/bitcoinpay/config"
+	"golang.org/x/net/websocket"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+type wsTestService struct{}
+
+func (s *wsTestService) Echo(str string) (interface{}, error) {
+	return str, nil
+}
+
+func (s *wsTestService) Ticks(ctx context.Context) (*Subscription, error) {
+	notifier, supported := NotifierFromContext(ctx)
+	if !supported {
+		return nil, ErrNotificationsUnsupported
+	}
+	sub := notifier.CreateSubscription()
+	go func() {
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for i := 0; ; i++ {
+			select {
+			case <-ticker.C:
+				notifier.Notify(sub.ID, i)
+			case <-sub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+	return sub, nil
+}
+
+func newWsTestServer(t *testing.T, maxWebsockets int) *RpcServer {
+	cfg := &config.Config{
+		RPCListeners:     []string{"127.0.0.1:0"},
+		RPCUser:          "user",
+		RPCPass:          "pass",
+		RPCMaxClients:    10,
+		RPCMaxWebsockets: maxWebsockets,
+		DisableTLS:       true,
+	}
+	s, err := NewRPCServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RegisterService(DefaultServiceNameSpace, &wsTestService{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func dialWs(s *RpcServer, user, pass string) (*websocket.Conn, error) {
+	return dialWsOrigin(s, user, pass, "http://localhost/")
+}
+
+func dialWsOrigin(s *RpcServer, user, pass, origin string) (*websocket.Conn, error) {
+	url := fmt.Sprintf("ws://%s%s", s.listeners[0].Addr(), websocketPath)
+	wsCfg, err := websocket.NewConfig(url, origin)
+	if err != nil {
+		return nil, err
+	}
+	login := base64.StdEncoding.EncodeToString([]byte(user + ":" + pass))
+	wsCfg.Header = http.Header{"Authorization": {"Basic " + login}}
+	return websocket.DialConfig(wsCfg)
+}
+
+type wsTestMessage struct {
+	Id     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Result json.RawMessage `json:"result"`
+	Error  *jsonError      `json:"error"`
+	Params struct {
+		Subscription string          `json:"subscription"`
+		Result       json.RawMessage `json:"result"`
+	} `json:"params"`
+}
+
+func TestWebsocketSubscription(t *testing.T) {
+	s := newWsTestServer(t, 1)
+	defer s.Stop()
+
+	conn, err := dialWs(s, "user", "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// plain method calls work on the same connection
+	req := `{"jsonrpc":"2.0","id":1,"method":"echo","params":["hello"]}`
+	if err := websocket.Message.Send(conn, req); err != nil {
+		t.Fatal(err)
+	}
+	var msg wsTestMessage
+	if err := websocket.JSON.Receive(conn, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if string(msg.Result) != `"hello"` {
+		t.Fatalf("unexpected echo result %s", msg.Result)
+	}
+
+	req = `{"jsonrpc":"2.0","id":2,"method":"subscribe","params":["ticks"]}`
+	if err := websocket.Message.Send(conn, req); err != nil {
+		t.Fatal(err)
+	}
+	msg = wsTestMessage{}
+	if err := websocket.JSON.Receive(conn, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Error != nil {
+		t.Fatalf("subscribe failed: %v", msg.Error)
+	}
+	var subID string
+	if err := json.Unmarshal(msg.Result, &subID); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		msg = wsTestMessage{}
+		if err := websocket.JSON.Receive(conn, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Method != DefaultServiceNameSpace+notificationMethodSuffix {
+			t.Fatalf("unexpected notification method %s", msg.Method)
+		}
+		if msg.Params.Subscription != subID {
+			t.Fatalf("notification for subscription %s, want %s",
+				msg.Params.Subscription, subID)
+		}
+	}
+
+	req = fmt.Sprintf(`{"jsonrpc":"2.0","id":3,"method":"unsubscribe","params":["%s"]}`, subID)
+	if err := websocket.Message.Send(conn, req); err != nil {
+		t.Fatal(err)
+	}
+	// skip notifications already in flight until the unsubscribe reply
+	for {
+		msg = wsTestMessage{}
+		if err := websocket.JSON.Receive(conn, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if string(msg.Id) == "3" {
+			break
+		}
+	}
+	if msg.Error != nil || string(msg.Result) != "true" {
+		t.Fatalf("unsubscribe failed: %s %v", msg.Result, msg.Error)
+	}
+}
+
+func TestWebsocketLimits(t *testing.T) {
+	s := newWsTestServer(t, 1)
+	defer s.Stop()
+
+	if _, err := dialWs(s, "user", "wrong"); err == nil {
+		t.Fatal("expected unauthenticated websocket to be rejected")
+	}
+	if _, err := dialWsOrigin(s, "user", "pass", "http://evil.example/"); err == nil {
+		t.Fatal("expected websocket from a foreign origin to be rejected")
+	}
+
+	conn, err := dialWs(s, "user", "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := dialWs(s, "user", "pass"); err == nil {
+		t.Fatal("expected websocket beyond rpcmaxwebsockets to be rejected")
+	}
+}
+
+func TestWebsocketConcurrentLimit(t *testing.T) {
+	const max = 3
+	s := newWsTestServer(t, max)
+	defer s.Stop()
+
+	var wg sync.WaitGroup
+	conns := make(chan *websocket.Conn, 4*max)
+	for i := 0; i < 4*max; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if conn, err := dialWs(s, "user", "pass"); err == nil {
+				conns <- conn
+			}
+		}()
+	}
+	wg.Wait()
+	close(conns)
+
+	n := 0
+	for conn := range conns {
+		conn.Close()
+		n++
+	}
+	if n > max {
+		t.Fatalf("%d websockets accepted, want at most %d", n, max)
+	}
+}
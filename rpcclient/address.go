@@ -0,0 +1,54 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+//
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpcclient
+
+import (
+	"context"
+
+	"github.com/btceasypay/bitcoinpay/core/json"
+)
+
+// CheckAddress reports whether addr is a valid address of the network, one
+// of privnet, testnet, mainnet or mixnet.
+func (c *Client) CheckAddress(ctx context.Context, addr string, network string) (bool, error) {
+	var result bool
+	err := c.Call(ctx, &result, "checkAddress", addr, network)
+	return result, err
+}
+
+// GetBalance returns the balance of an address watched by the node.  Only
+// outputs with at least minConf confirmations count in the confirmed balance,
+// the node default is used when minConf is nil.
+func (c *Client) GetBalance(ctx context.Context, addr string, minConf *uint) (*json.GetBalanceResult, error) {
+	var result json.GetBalanceResult
+	if err := c.Call(ctx, &result, "getBalance", addr, minConf); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ListUnspent returns the unspent outputs of the addresses watched by the
+// node with between minConf and maxConf confirmations.  All watched addresses
+// are listed when addrs is empty.
+func (c *Client) ListUnspent(ctx context.Context, minConf *uint, maxConf *uint,
+	addrs []string) ([]json.ListUnspentResult, error) {
+	var result []json.ListUnspentResult
+	if err := c.Call(ctx, &result, "listUnspent", minConf, maxConf, addrs); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetAddressHistory returns up to count confirmed transactions involving an
+// address watched by the node in DAG order, skipping the first skip ones.
+func (c *Client) GetAddressHistory(ctx context.Context, addr string, skip uint,
+	count uint) ([]json.AddressHistoryResult, error) {
+	var result []json.AddressHistoryResult
+	if err := c.Call(ctx, &result, "getAddressHistory", addr, skip, count); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
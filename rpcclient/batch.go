@@ -0,0 +1,71 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+//
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpcclient
+
+import (
+	"context"
+	"fmt"
+)
+
+// BatchElem is a request in a batch call.
+type BatchElem struct {
+	Method string
+	Args   []interface{}
+	// The result is unmarshaled into this field.  Result must be set to a
+	// non-nil pointer value of the desired type, otherwise the response will
+	// be discarded.
+	Result interface{}
+	// Error is set if the server returns an error for this request, or if
+	// unmarshaling into Result fails.  It is not set for I/O errors.
+	Error error
+}
+
+// BatchCall sends all given requests as a single batch and waits for the
+// server to return a response for all of them.
+//
+// In contrast to Call, BatchCall only returns I/O errors.  Any error specific
+// to a request is reported through the Error field of the corresponding
+// BatchElem.
+func (c *Client) BatchCall(ctx context.Context, b []BatchElem) error {
+	if len(b) == 0 {
+		return nil
+	}
+	reqs := make([]*jsonRequest, len(b))
+	byID := make(map[string]int, len(b))
+	for i, elem := range b {
+		reqs[i] = c.newRequest(elem.Method, elem.Args...)
+		byID[string(reqs[i].Id)] = i
+	}
+
+	var (
+		msgs []*jsonMessage
+		err  error
+	)
+	if c.ws != nil {
+		msgs, err = c.ws.batchCall(ctx, reqs)
+	} else {
+		msgs, err = c.sendHTTP(ctx, reqs, true)
+	}
+	if err != nil {
+		return err
+	}
+
+	answered := make([]bool, len(b))
+	for _, msg := range msgs {
+		i, ok := byID[string(msg.Id)]
+		if !ok || answered[i] {
+			continue
+		}
+		answered[i] = true
+		b[i].Error = msg.decodeResult(b[i].Result)
+	}
+	for i := range b {
+		if !answered[i] {
+			b[i].Error = fmt.Errorf("no response for request %s", reqs[i].Id)
+		}
+	}
+	return nil
+}
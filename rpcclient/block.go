@@ -0,0 +1,305 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+//
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpcclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/blockchain"
+	"github.com/btceasypay/bitcoinpay/core/json"
+	"github.com/btceasypay/bitcoinpay/core/types"
+)
+
+// decodeHashes converts the hex encoded hashes of a result.
+func decodeHashes(strs []string) ([]*hash.Hash, error) {
+	hashes := make([]*hash.Hash, 0, len(strs))
+	for _, s := range strs {
+		h, err := hash.NewHashFromStr(s)
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, h)
+	}
+	return hashes, nil
+}
+
+// callHash performs a call whose result is a hex encoded hash.
+func (c *Client) callHash(ctx context.Context, method string, args ...interface{}) (*hash.Hash, error) {
+	var result string
+	if err := c.Call(ctx, &result, method, args...); err != nil {
+		return nil, err
+	}
+	return hash.NewHashFromStr(result)
+}
+
+// callBlock performs a call whose result is a hex encoded block.
+func (c *Client) callBlock(ctx context.Context, method string, args ...interface{}) (*types.SerializedBlock, error) {
+	var result string
+	if err := c.Call(ctx, &result, method, args...); err != nil {
+		return nil, err
+	}
+	serialized, err := hex.DecodeString(result)
+	if err != nil {
+		return nil, err
+	}
+	return types.NewBlockFromBytes(serialized)
+}
+
+// callBlockVerbose performs a call whose result is a verbose block.
+func (c *Client) callBlockVerbose(ctx context.Context, method string, args ...interface{}) (*json.BlockVerboseResult, error) {
+	var result json.BlockVerboseResult
+	if err := c.Call(ctx, &result, method, args...); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetBlockhash returns the hash of the block with the given DAG order.
+func (c *Client) GetBlockhash(ctx context.Context, order uint) (*hash.Hash, error) {
+	return c.callHash(ctx, "getBlockhash", order)
+}
+
+// GetBlockhashByRange returns the hashes of the blocks with a DAG order from
+// start to end.
+func (c *Client) GetBlockhashByRange(ctx context.Context, start uint, end uint) ([]*hash.Hash, error) {
+	var result []string
+	if err := c.Call(ctx, &result, "getBlockhashByRange", start, end); err != nil {
+		return nil, err
+	}
+	return decodeHashes(result)
+}
+
+// GetBlock returns the block with the given hash.
+func (c *Client) GetBlock(ctx context.Context, h *hash.Hash) (*types.SerializedBlock, error) {
+	return c.callBlock(ctx, "getBlock", h.String(), false)
+}
+
+// GetBlockVerbose returns a description of the block with the given hash.
+// The transactions are listed with all details when fullTx is set, by hash
+// otherwise.
+func (c *Client) GetBlockVerbose(ctx context.Context, h *hash.Hash, fullTx bool) (*json.BlockVerboseResult, error) {
+	return c.callBlockVerbose(ctx, "getBlock", h.String(), true, true, fullTx)
+}
+
+// GetBlockV2Verbose works like GetBlockVerbose but reports the fees of the
+// block apart from the coinbase amount.
+func (c *Client) GetBlockV2Verbose(ctx context.Context, h *hash.Hash, fullTx bool) (*json.BlockVerboseResult, error) {
+	return c.callBlockVerbose(ctx, "getBlockV2", h.String(), true, true, fullTx)
+}
+
+// GetBlockByOrder returns the block with the given DAG order.
+func (c *Client) GetBlockByOrder(ctx context.Context, order uint64) (*types.SerializedBlock, error) {
+	return c.callBlock(ctx, "getBlockByOrder", order, false)
+}
+
+// GetBlockByOrderVerbose returns a description of the block with the given
+// DAG order.
+func (c *Client) GetBlockByOrderVerbose(ctx context.Context, order uint64, fullTx bool) (*json.BlockVerboseResult, error) {
+	return c.callBlockVerbose(ctx, "getBlockByOrder", order, true, true, fullTx)
+}
+
+// GetBlockByNum returns the block with the given order in the DAG of the
+// node.
+func (c *Client) GetBlockByNum(ctx context.Context, num uint64) (*types.SerializedBlock, error) {
+	return c.callBlock(ctx, "getBlockByNum", num, false)
+}
+
+// GetBlockByNumVerbose returns a description of the block with the given
+// order in the DAG of the node.
+func (c *Client) GetBlockByNumVerbose(ctx context.Context, num uint64, fullTx bool) (*json.BlockVerboseResult, error) {
+	return c.callBlockVerbose(ctx, "getBlockByNum", num, true, true, fullTx)
+}
+
+// GetBlockByID returns the block with the given order in the DAG of the
+// node.
+//
+// Deprecated: use GetBlockByNum.
+func (c *Client) GetBlockByID(ctx context.Context, id uint64) (*types.SerializedBlock, error) {
+	return c.callBlock(ctx, "getBlockByID", id, false)
+}
+
+// GetBestBlockHash returns the hash of the main chain tip.
+func (c *Client) GetBestBlockHash(ctx context.Context) (*hash.Hash, error) {
+	return c.callHash(ctx, "getBestBlockHash")
+}
+
+// GetBlockCount returns the number of ordered blocks.
+func (c *Client) GetBlockCount(ctx context.Context) (uint64, error) {
+	var result uint64
+	err := c.Call(ctx, &result, "getBlockCount")
+	return result, err
+}
+
+// GetBlockTotal returns the number of blocks in the DAG, including the ones
+// not ordered yet.
+func (c *Client) GetBlockTotal(ctx context.Context) (uint64, error) {
+	var result uint64
+	err := c.Call(ctx, &result, "getBlockTotal")
+	return result, err
+}
+
+// GetBlockHeader returns the header of the block with the given hash.
+func (c *Client) GetBlockHeader(ctx context.Context, h *hash.Hash) (*types.BlockHeader, error) {
+	var result string
+	if err := c.Call(ctx, &result, "getBlockHeader", h.String(), false); err != nil {
+		return nil, err
+	}
+	serialized, err := hex.DecodeString(result)
+	if err != nil {
+		return nil, err
+	}
+	var header types.BlockHeader
+	if err := header.Deserialize(bytes.NewReader(serialized)); err != nil {
+		return nil, err
+	}
+	return &header, nil
+}
+
+// GetBlockHeaderVerbose returns a description of the header of the block
+// with the given hash.
+func (c *Client) GetBlockHeaderVerbose(ctx context.Context, h *hash.Hash) (*json.GetBlockHeaderVerboseResult, error) {
+	var result json.GetBlockHeaderVerboseResult
+	if err := c.Call(ctx, &result, "getBlockHeader", h.String(), true); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// IsOnMainChain reports whether the block with the given hash is on the main
+// chain of the DAG.
+func (c *Client) IsOnMainChain(ctx context.Context, h *hash.Hash) (bool, error) {
+	var result string
+	if err := c.Call(ctx, &result, "isOnMainChain", h.String()); err != nil {
+		return false, err
+	}
+	return strconv.ParseBool(result)
+}
+
+// GetMainChainHeight returns the height of the DAG main chain.
+func (c *Client) GetMainChainHeight(ctx context.Context) (uint64, error) {
+	var result string
+	if err := c.Call(ctx, &result, "getMainChainHeight"); err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(result, 10, 64)
+}
+
+// GetBlockWeight returns the weight of the block with the given hash.
+func (c *Client) GetBlockWeight(ctx context.Context, h *hash.Hash) (int64, error) {
+	var result string
+	if err := c.Call(ctx, &result, "getBlockWeight", h.String()); err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(result, 10, 64)
+}
+
+// GetOrphansTotal returns the number of orphan blocks.
+func (c *Client) GetOrphansTotal(ctx context.Context) (int, error) {
+	var result int
+	err := c.Call(ctx, &result, "getOrphansTotal")
+	return result, err
+}
+
+// IsBlue reports the color of the block with the given hash: 0 for not blue,
+// 1 for blue and 2 when it can't be determined yet.
+func (c *Client) IsBlue(ctx context.Context, h *hash.Hash) (int, error) {
+	var result int
+	err := c.Call(ctx, &result, "isBlue", h.String())
+	return result, err
+}
+
+// IsCurrent reports whether the node believes it is synced with the network.
+func (c *Client) IsCurrent(ctx context.Context) (bool, error) {
+	var result bool
+	err := c.Call(ctx, &result, "isCurrent")
+	return result, err
+}
+
+// Tips returns the hashes of the tips of the DAG.
+func (c *Client) Tips(ctx context.Context) ([]*hash.Hash, error) {
+	var result []string
+	if err := c.Call(ctx, &result, "tips"); err != nil {
+		return nil, err
+	}
+	return decodeHashes(result)
+}
+
+// GetCoinbase returns the hex encoded data pushed by the coinbase signature
+// script of the block.  The height and extra nonce are only included when
+// verbose is set.
+func (c *Client) GetCoinbase(ctx context.Context, h *hash.Hash, verbose bool) ([]string, error) {
+	var result []string
+	if err := c.Call(ctx, &result, "getCoinbase", h.String(), verbose); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetFees returns the transaction fees collected by the block.
+func (c *Client) GetFees(ctx context.Context, h *hash.Hash) (int64, error) {
+	var result int64
+	err := c.Call(ctx, &result, "getFees", h.String())
+	return result, err
+}
+
+// GetCFilter returns the serialized committed filter of the block, with the
+// number of items first.  The result can be decoded by cf.FromNBytes.
+func (c *Client) GetCFilter(ctx context.Context, h *hash.Hash, filterType uint8) ([]byte, error) {
+	var result string
+	if err := c.Call(ctx, &result, "getCFilter", h.String(), filterType); err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(result)
+}
+
+// GetCFHeader returns the committed filter header of the block.
+func (c *Client) GetCFHeader(ctx context.Context, h *hash.Hash, filterType uint8) (*hash.Hash, error) {
+	return c.callHash(ctx, "getCFHeader", h.String(), filterType)
+}
+
+// GetUtxoRoot returns the utxo commitment root after the block with the DAG
+// order was connected.
+func (c *Client) GetUtxoRoot(ctx context.Context, order uint64) (*hash.Hash, error) {
+	return c.callHash(ctx, "getUtxoRoot", order)
+}
+
+// GetUtxoProof returns the Merkle proof of the output against the current utxo
+// commitment root of the node.
+func (c *Client) GetUtxoProof(ctx context.Context, txHash *hash.Hash, vout uint32) (*json.UtxoProofResult, error) {
+	var result json.UtxoProofResult
+	if err := c.Call(ctx, &result, "getUtxoProof", txHash.String(), vout); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetVerifiedUtxo fetches the proof of the output and verifies it against the
+// trusted utxo commitment root, so the node doesn't need to be trusted.  It
+// returns nil when the proof shows the output is spent or doesn't exist.
+func (c *Client) GetVerifiedUtxo(ctx context.Context, root *hash.Hash, txHash *hash.Hash,
+	vout uint32) (*blockchain.UtxoEntry, error) {
+	result, err := c.GetUtxoProof(ctx, txHash, vout)
+	if err != nil {
+		return nil, err
+	}
+	if result.Root != root.String() {
+		return nil, fmt.Errorf("utxo proof is for root %s, not %s", result.Root, root)
+	}
+	proof := make([][]byte, 0, len(result.Proof))
+	for _, s := range result.Proof {
+		node, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		proof = append(proof, node)
+	}
+	return blockchain.VerifyUtxoProof(root, types.TxOutPoint{Hash: *txHash, OutIndex: vout}, proof)
+}
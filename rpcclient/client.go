@@ -0,0 +1,272 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+//
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package rpcclient implements a typed client for the JSON-RPC API of a
+// bitcoinpay node.
+//
+// Calls are sent as HTTP POST requests by default.  When Config.Websocket is
+// set the client keeps a websocket connection to the node instead, which is
+// required to receive subscription notifications.
+package rpcclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+)
+
+const jsonrpcVersion = "2.0"
+
+var (
+	// ErrClientQuit is returned by calls on a closed client.
+	ErrClientQuit = errors.New("client is closed")
+
+	// ErrNotificationsUnsupported is returned when subscribing over a client
+	// which is not connected by websocket.
+	ErrNotificationsUnsupported = errors.New("notifications require a websocket connection")
+
+	// ErrNoResult is returned when the server replied without a result.
+	ErrNoResult = errors.New("no result in JSON-RPC response")
+)
+
+// Config describes how to connect to the RPC server of a node.
+type Config struct {
+	// Host is the host:port of the RPC server.
+	Host string
+
+	// User and Pass are the credentials for the HTTP basic authentication.
+	User string
+	Pass string
+
+	// Certificates are the PEM encoded certificates the TLS certificate of
+	// the server is verified against, usually the contents of the rpc.cert
+	// file the node generated.  The system roots are used when empty.
+	Certificates []byte
+
+	// DisableTLS connects without TLS.
+	DisableTLS bool
+
+	// Websocket sends all requests over a single websocket connection,
+	// which enables subscriptions.
+	Websocket bool
+}
+
+// Error is an error returned by the RPC server.
+type Error struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (err *Error) Error() string {
+	if err.Message == "" {
+		return fmt.Sprintf("json-rpc error %d", err.Code)
+	}
+	return err.Message
+}
+
+// ErrorCode returns the JSON-RPC error code.
+func (err *Error) ErrorCode() int {
+	return err.Code
+}
+
+type jsonRequest struct {
+	Version string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  []interface{}   `json:"params"`
+}
+
+// jsonMessage is a response or a notification sent by the server.
+type jsonMessage struct {
+	Version string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+}
+
+func (msg *jsonMessage) isNotification() bool {
+	return len(msg.Id) == 0 && msg.Method != ""
+}
+
+// decodeResult unmarshals the result of the response into result.
+func (msg *jsonMessage) decodeResult(result interface{}) error {
+	if msg.Error != nil {
+		return msg.Error
+	}
+	if len(msg.Result) == 0 {
+		return ErrNoResult
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(msg.Result, result)
+}
+
+// Client is a connection to the RPC server of a node.  It is safe for
+// concurrent use.
+type Client struct {
+	config     *Config
+	url        string
+	idCounter  uint64
+	httpClient *http.Client
+	ws         *wsConn
+}
+
+// Dial creates a new client for the RPC server described by cfg.  When
+// websockets are enabled the connection is established before Dial returns.
+func Dial(ctx context.Context, cfg *Config) (*Client, error) {
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	scheme := "https"
+	if cfg.DisableTLS {
+		scheme = "http"
+	}
+	c := &Client{
+		config: cfg,
+		url:    scheme + "://" + cfg.Host,
+		httpClient: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}
+	if cfg.Websocket {
+		c.ws, err = dialWebsocket(ctx, cfg, tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// newTLSConfig returns the TLS configuration for cfg, nil when TLS is
+// disabled.
+func newTLSConfig(cfg *Config) (*tls.Config, error) {
+	if cfg.DisableTLS {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(cfg.Certificates) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(cfg.Certificates) {
+			return nil, errors.New("no valid certificate in Certificates")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// Close closes the client, aborting any in-flight requests and
+// subscriptions.
+func (c *Client) Close() {
+	if c.ws != nil {
+		c.ws.close(ErrClientQuit)
+	}
+	if t, ok := c.httpClient.Transport.(*http.Transport); ok {
+		t.CloseIdleConnections()
+	}
+}
+
+func (c *Client) nextID() json.RawMessage {
+	id := atomic.AddUint64(&c.idCounter, 1)
+	return json.RawMessage(strconv.FormatUint(id, 10))
+}
+
+func (c *Client) newRequest(method string, args ...interface{}) *jsonRequest {
+	if args == nil {
+		args = []interface{}{}
+	}
+	return &jsonRequest{
+		Version: jsonrpcVersion,
+		Id:      c.nextID(),
+		Method:  method,
+		Params:  args,
+	}
+}
+
+// Call performs a JSON-RPC call with the given arguments and unmarshals the
+// result into result if no error occurred.  The result must be a pointer so
+// it can be filled in, or nil to discard the result.
+//
+// The call is aborted when ctx is canceled before the response arrived.
+func (c *Client) Call(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	req := c.newRequest(method, args...)
+	var (
+		msg *jsonMessage
+		err error
+	)
+	if c.ws != nil {
+		msg, err = c.ws.call(ctx, req, nil)
+	} else {
+		var msgs []*jsonMessage
+		msgs, err = c.sendHTTP(ctx, req, false)
+		if err == nil {
+			msg = msgs[0]
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return msg.decodeResult(result)
+}
+
+// sendHTTP posts the request, a single *jsonRequest or a batch of them, and
+// returns the responses.
+func (c *Client) sendHTTP(ctx context.Context, msg interface{}, batch bool) ([]*jsonMessage, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if c.config.User != "" || c.config.Pass != "" {
+		req.SetBasicAuth(c.config.User, c.config.Pass)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(respBody))
+	}
+
+	var msgs []*jsonMessage
+	if batch {
+		err = json.Unmarshal(respBody, &msgs)
+	} else {
+		var single jsonMessage
+		err = json.Unmarshal(respBody, &single)
+		msgs = []*jsonMessage{&single}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON-RPC response: %v", err)
+	}
+	return msgs, nil
+}
@@ -0,0 +1,407 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+//
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpcclient
+
+import (
+	"context"
+	"encoding/hex"
+	stdjson "encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/common/marshal"
+	"github.com/btceasypay/bitcoinpay/config"
+	"github.com/btceasypay/bitcoinpay/core/blockchain"
+	"github.com/btceasypay/bitcoinpay/core/json"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/core/types/pow"
+	"github.com/btceasypay/bitcoinpay/params"
+	"github.com/btceasypay/bitcoinpay/rpc"
+	"github.com/btceasypay/bitcoinpay/services/notifymgr"
+)
+
+// testBlockAPI serves a subset of the block API for a single block.
+type testBlockAPI struct {
+	block *types.SerializedBlock
+}
+
+func (api *testBlockAPI) GetBlockCount() (interface{}, error) {
+	return uint(42), nil
+}
+
+func (api *testBlockAPI) IsOnMainChain(h hash.Hash) (interface{}, error) {
+	if !h.IsEqual(api.block.Hash()) {
+		return nil, rpc.RpcInternalError("no block", "Block not found: "+h.String())
+	}
+	return "true", nil
+}
+
+func (api *testBlockAPI) GetBlock(h hash.Hash, verbose *bool, inclTx *bool, fullTx *bool) (interface{}, error) {
+	if !h.IsEqual(api.block.Hash()) {
+		return nil, rpc.RpcInternalError("no block", "Block not found: "+h.String())
+	}
+	if verbose == nil || !*verbose {
+		blkBytes, err := api.block.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		return hex.EncodeToString(blkBytes), nil
+	}
+	return marshal.MarshalJsonBlock(api.block, *inclTx, *fullTx, &params.PrivNetParams,
+		1, nil, true, true, 0, 0)
+}
+
+// Wait blocks until the request is canceled.
+func (api *testBlockAPI) Wait(ctx context.Context) (interface{}, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(10 * time.Second):
+		return "timeout", nil
+	}
+}
+
+type testMinerAPI struct{}
+
+func (api *testMinerAPI) Generate(numBlocks uint32, powType pow.PowType) ([]string, error) {
+	hashes := make([]string, numBlocks)
+	for i := range hashes {
+		hashes[i] = hash.HashH([]byte{byte(i), byte(powType)}).String()
+	}
+	return hashes, nil
+}
+
+func newTestBlock() *types.SerializedBlock {
+	tx := types.NewTransaction()
+	tx.AddTxIn(types.NewTxInput(types.NewOutPoint(&hash.Hash{1}, 0), []byte{}))
+	tx.AddTxOut(types.NewTxOutput(100, []byte{}))
+	return types.NewBlock(&types.Block{
+		Header:       types.BlockHeader{Pow: pow.GetInstance(pow.BLAKE2BD, 7, []byte{})},
+		Transactions: []*types.Transaction{tx},
+	})
+}
+
+// freeAddr returns a local address which is free to listen on.
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+type testServer struct {
+	*rpc.RpcServer
+	cfg    *config.Config
+	block  *types.SerializedBlock
+	ntmgr  *notifymgr.NotifyMgr
+	tmpDir string
+}
+
+// newTestServer starts an rpc server with the test services.  TLS uses the
+// certificate the server generates on start.
+func newTestServer(t *testing.T, disableTLS bool) *testServer {
+	tmpDir, err := ioutil.TempDir("", "rpcclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{
+		RPCListeners:     []string{freeAddr(t)},
+		RPCUser:          "user",
+		RPCPass:          "pass",
+		RPCCert:          filepath.Join(tmpDir, "rpc.cert"),
+		RPCKey:           filepath.Join(tmpDir, "rpc.key"),
+		RPCMaxClients:    10,
+		RPCMaxWebsockets: 10,
+		DisableTLS:       disableTLS,
+	}
+	server, err := rpc.NewRPCServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{
+		RpcServer: server,
+		cfg:       cfg,
+		block:     newTestBlock(),
+		ntmgr:     &notifymgr.NotifyMgr{RpcServer: server},
+		tmpDir:    tmpDir,
+	}
+	apis := append(s.ntmgr.APIs(),
+		rpc.API{NameSpace: rpc.DefaultServiceNameSpace, Service: &testBlockAPI{s.block}},
+		rpc.API{NameSpace: rpc.MinerNameSpace, Service: &testMinerAPI{}})
+	for _, api := range apis {
+		if err := server.RegisterService(api.NameSpace, api.Service); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func (s *testServer) stop() {
+	s.Stop()
+	os.RemoveAll(s.tmpDir)
+}
+
+func (s *testServer) dial(t *testing.T, websocket bool) *Client {
+	cfg := &Config{
+		Host:       s.cfg.RPCListeners[0],
+		User:       s.cfg.RPCUser,
+		Pass:       s.cfg.RPCPass,
+		DisableTLS: s.cfg.DisableTLS,
+		Websocket:  websocket,
+	}
+	if !cfg.DisableTLS {
+		certs, err := ioutil.ReadFile(s.cfg.RPCCert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.Certificates = certs
+	}
+	c, err := Dial(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestClientTLS(t *testing.T) {
+	s := newTestServer(t, false)
+	defer s.stop()
+
+	for _, websocket := range []bool{false, true} {
+		c := s.dial(t, websocket)
+		count, err := c.GetBlockCount(context.Background())
+		c.Close()
+		if err != nil {
+			t.Fatalf("websocket %v: %v", websocket, err)
+		}
+		if count != 42 {
+			t.Fatalf("websocket %v: got block count %d, want 42", websocket, count)
+		}
+	}
+
+	// wrong credentials
+	certs, err := ioutil.ReadFile(s.cfg.RPCCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := Dial(context.Background(), &Config{
+		Host:         s.cfg.RPCListeners[0],
+		User:         "user",
+		Pass:         "wrong",
+		Certificates: certs,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.GetBlockCount(context.Background())
+	c.Close()
+	if err == nil {
+		t.Fatal("expected call with wrong credentials to fail")
+	}
+
+	// unknown certificate
+	c, err = Dial(context.Background(), &Config{
+		Host: s.cfg.RPCListeners[0],
+		User: "user",
+		Pass: "pass",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.GetBlockCount(context.Background())
+	c.Close()
+	if err == nil {
+		t.Fatal("expected call with an untrusted certificate to fail")
+	}
+}
+
+func TestClientTypedResults(t *testing.T) {
+	s := newTestServer(t, true)
+	defer s.stop()
+	c := s.dial(t, false)
+	defer c.Close()
+	ctx := context.Background()
+
+	block, err := c.GetBlock(ctx, s.block.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !block.Hash().IsEqual(s.block.Hash()) {
+		t.Fatalf("got block %s, want %s", block.Hash(), s.block.Hash())
+	}
+
+	txHash := s.block.Transactions()[0].Hash().String()
+	verbose, err := c.GetBlockVerbose(ctx, s.block.Hash(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verbose.Hash != s.block.Hash().String() || verbose.Order == nil ||
+		len(verbose.Tx) != 1 || verbose.Tx[0] != txHash || len(verbose.RawTx) != 0 {
+		t.Fatalf("unexpected verbose block %+v", verbose)
+	}
+	verbose, err = c.GetBlockVerbose(ctx, s.block.Hash(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verbose.Tx) != 0 || len(verbose.RawTx) != 1 || verbose.RawTx[0].Txid != txHash {
+		t.Fatalf("unexpected verbose block with full transactions %+v", verbose)
+	}
+
+	// The block keeps its transactions through a marshal round trip.
+	data, err := stdjson.Marshal(verbose)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded json.BlockVerboseResult
+	if err := stdjson.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Hash != verbose.Hash || len(decoded.RawTx) != 1 ||
+		decoded.RawTx[0].Txid != txHash {
+		t.Fatalf("unexpected round trip of verbose block %s", data)
+	}
+
+	onMainChain, err := c.IsOnMainChain(ctx, s.block.Hash())
+	if err != nil || !onMainChain {
+		t.Fatalf("isOnMainChain: got %v %v, want true", onMainChain, err)
+	}
+	_, err = c.IsOnMainChain(ctx, &hash.ZeroHash)
+	if _, ok := err.(*Error); !ok {
+		t.Fatalf("expected rpc error for unknown block, got %v", err)
+	}
+
+	hashes, err := c.Generate(ctx, 3, pow.BLAKE2BD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 3 {
+		t.Fatalf("generate: got %d hashes, want 3", len(hashes))
+	}
+}
+
+func TestClientBatch(t *testing.T) {
+	s := newTestServer(t, true)
+	defer s.stop()
+
+	for _, websocket := range []bool{false, true} {
+		c := s.dial(t, websocket)
+		var (
+			count       uint64
+			onMainChain string
+			unknown     string
+		)
+		batch := []BatchElem{
+			{Method: "getBlockCount", Result: &count},
+			{Method: "isOnMainChain", Args: []interface{}{s.block.Hash().String()}, Result: &onMainChain},
+			{Method: "noSuchMethod", Result: &unknown},
+		}
+		err := c.BatchCall(context.Background(), batch)
+		c.Close()
+		if err != nil {
+			t.Fatalf("websocket %v: %v", websocket, err)
+		}
+		if batch[0].Error != nil || count != 42 {
+			t.Fatalf("websocket %v: getBlockCount got %d %v", websocket, count, batch[0].Error)
+		}
+		if batch[1].Error != nil || onMainChain != "true" {
+			t.Fatalf("websocket %v: isOnMainChain got %s %v", websocket, onMainChain, batch[1].Error)
+		}
+		if batch[2].Error == nil {
+			t.Fatalf("websocket %v: expected an error for an unknown method", websocket)
+		}
+	}
+}
+
+func TestClientContextCancel(t *testing.T) {
+	s := newTestServer(t, true)
+	defer s.stop()
+
+	for _, websocket := range []bool{false, true} {
+		c := s.dial(t, websocket)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		start := time.Now()
+		err := c.Call(ctx, nil, "wait")
+		cancel()
+		if err != context.DeadlineExceeded {
+			t.Fatalf("websocket %v: got error %v, want %v", websocket, err, context.DeadlineExceeded)
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("websocket %v: call was not aborted", websocket)
+		}
+		// the client is still usable afterwards
+		if _, err := c.GetBlockCount(context.Background()); err != nil {
+			t.Fatalf("websocket %v: %v", websocket, err)
+		}
+		c.Close()
+	}
+}
+
+func TestClientSubscription(t *testing.T) {
+	s := newTestServer(t, true)
+	defer s.stop()
+
+	c := s.dial(t, false)
+	_, err := c.SubscribeBlockConnected(context.Background(), make(chan *json.BlockNotifyResult))
+	c.Close()
+	if err != ErrNotificationsUnsupported {
+		t.Fatalf("got error %v, want %v", err, ErrNotificationsUnsupported)
+	}
+
+	c = s.dial(t, true)
+	defer c.Close()
+	blocks := make(chan *json.BlockNotifyResult)
+	sub, err := c.SubscribeBlockConnected(context.Background(), blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// subscriptions are activated after the reply was written
+	time.Sleep(50 * time.Millisecond)
+
+	s.ntmgr.NotifyBlockChain(&blockchain.Notification{
+		Type: blockchain.BlockConnected,
+		Data: []*types.SerializedBlock{s.block},
+	})
+	select {
+	case block := <-blocks:
+		if block.Hash != s.block.Hash().String() {
+			t.Fatalf("got block %s, want %s", block.Hash, s.block.Hash())
+		}
+	case err := <-sub.Err():
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for notification")
+	}
+
+	sub.Unsubscribe()
+	if _, ok := <-sub.Err(); ok {
+		t.Fatal("expected the error channel to be closed after unsubscribing")
+	}
+
+	// closing the client ends the subscriptions
+	sub, err = c.SubscribeBlockConnected(context.Background(), blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	select {
+	case err := <-sub.Err():
+		if err != ErrClientQuit {
+			t.Fatalf("got error %v, want %v", err, ErrClientQuit)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the subscription to end")
+	}
+}
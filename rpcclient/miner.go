@@ -0,0 +1,52 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+//
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpcclient
+
+import (
+	"context"
+	"encoding/hex"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/json"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/core/types/pow"
+	"github.com/btceasypay/bitcoinpay/rpc"
+)
+
+// GetBlockTemplate returns a template to mine a new block on.
+func (c *Client) GetBlockTemplate(ctx context.Context, capabilities []string) (*json.GetBlockTemplateResult, error) {
+	if capabilities == nil {
+		capabilities = []string{}
+	}
+	var result json.GetBlockTemplateResult
+	if err := c.Call(ctx, &result, "getBlockTemplate", capabilities); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SubmitBlock submits a mined block to the node.  The returned message
+// describes whether the node accepted the block.
+func (c *Client) SubmitBlock(ctx context.Context, block *types.SerializedBlock) (string, error) {
+	serialized, err := block.Bytes()
+	if err != nil {
+		return "", err
+	}
+	var result string
+	err = c.Call(ctx, &result, "submitBlock", hex.EncodeToString(serialized))
+	return result, err
+}
+
+// Generate mines numBlocks blocks with the CPU miner of the node and returns
+// their hashes.
+func (c *Client) Generate(ctx context.Context, numBlocks uint32, powType pow.PowType) ([]*hash.Hash, error) {
+	var result []string
+	err := c.Call(ctx, &result, rpc.MinerNameSpace+"_generate", numBlocks, powType)
+	if err != nil {
+		return nil, err
+	}
+	return decodeHashes(result)
+}
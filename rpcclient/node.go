@@ -0,0 +1,104 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+//
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpcclient
+
+import (
+	"context"
+
+	"github.com/btceasypay/bitcoinpay/core/json"
+	"github.com/btceasypay/bitcoinpay/rpc"
+)
+
+// GetNodeInfo returns information about the node.
+func (c *Client) GetNodeInfo(ctx context.Context) (*json.InfoNodeResult, error) {
+	var result json.InfoNodeResult
+	if err := c.Call(ctx, &result, "getNodeInfo"); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetPeerInfo returns information about the connected peers.
+func (c *Client) GetPeerInfo(ctx context.Context) ([]*json.GetPeerInfoResult, error) {
+	var result []*json.GetPeerInfoResult
+	if err := c.Call(ctx, &result, "getPeerInfo"); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetRpcInfo returns the statistics of the RPC methods which were called.
+func (c *Client) GetRpcInfo(ctx context.Context) ([]*rpc.JsonRequestStatus, error) {
+	var result []*rpc.JsonRequestStatus
+	if err := c.Call(ctx, &result, "getRpcInfo"); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Stop requests the node to shut down.
+func (c *Client) Stop(ctx context.Context) (string, error) {
+	var result string
+	err := c.Call(ctx, &result, rpc.TestNameSpace+"_stop")
+	return result, err
+}
+
+// Banlist returns the banned hosts.
+func (c *Client) Banlist(ctx context.Context) ([]*json.GetBanlistResult, error) {
+	var result []*json.GetBanlistResult
+	if err := c.Call(ctx, &result, rpc.TestNameSpace+"_banlist"); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// RemoveBan lifts the ban of host, or of all hosts when host is empty.
+func (c *Client) RemoveBan(ctx context.Context, host string) error {
+	return c.Call(ctx, nil, rpc.TestNameSpace+"_removeBan", host)
+}
+
+// SetBan bans an IP, a subnet in the CIDR notation or an onion host for the
+// duration, such as "24h".  The node's default ban duration is used when duration is empty.
+func (c *Client) SetBan(ctx context.Context, subnet string, duration string) error {
+	if duration == "" {
+		return c.Call(ctx, nil, rpc.TestNameSpace+"_setBan", subnet)
+	}
+	return c.Call(ctx, nil, rpc.TestNameSpace+"_setBan", subnet, duration)
+}
+
+// AddNode adds addr to the permanent peers with "add", removes it from them
+// with "remove", or connects to it once with "onetry".
+func (c *Client) AddNode(ctx context.Context, addr string, cmd string) error {
+	return c.Call(ctx, nil, rpc.TestNameSpace+"_addNode", addr, cmd)
+}
+
+// DisconnectNode disconnects the peer with the id or address target.
+func (c *Client) DisconnectNode(ctx context.Context, target string) error {
+	return c.Call(ctx, nil, rpc.TestNameSpace+"_disconnectNode", target)
+}
+
+// GetAddedNodeInfo returns the permanent peers and whether they are connected.
+func (c *Client) GetAddedNodeInfo(ctx context.Context) ([]*json.GetAddedNodeInfoResult, error) {
+	var result []*json.GetAddedNodeInfoResult
+	if err := c.Call(ctx, &result, rpc.TestNameSpace+"_getAddedNodeInfo"); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SetRpcMaxClients changes the maximum number of concurrent RPC clients of
+// the node and returns the new limit.
+func (c *Client) SetRpcMaxClients(ctx context.Context, max int) (int, error) {
+	var result int
+	err := c.Call(ctx, &result, rpc.TestNameSpace+"_setRpcMaxClients", max)
+	return result, err
+}
+
+// SetLogLevel changes the log levels of the node, level has the same format
+// as the --debuglevel option.
+func (c *Client) SetLogLevel(ctx context.Context, level string) error {
+	return c.Call(ctx, nil, rpc.LogNameSpace+"_setLogLevel", level)
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+//
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpcclient
+
+import (
+	"context"
+
+	"github.com/btceasypay/bitcoinpay/core/json"
+	"github.com/btceasypay/bitcoinpay/rpc"
+)
+
+// SubscribeNewBlocks sends every block accepted by the node to ch.
+func (c *Client) SubscribeNewBlocks(ctx context.Context, ch chan<- *json.BlockNotifyResult) (*ClientSubscription, error) {
+	return c.Subscribe(ctx, rpc.DefaultServiceNameSpace, ch, "newBlocks")
+}
+
+// SubscribeBlockConnected sends every block connected to the DAG order to ch.
+func (c *Client) SubscribeBlockConnected(ctx context.Context, ch chan<- *json.BlockNotifyResult) (*ClientSubscription, error) {
+	return c.Subscribe(ctx, rpc.DefaultServiceNameSpace, ch, "blockConnected")
+}
+
+// SubscribeBlockDisconnected sends every block disconnected from the DAG
+// order to ch.
+func (c *Client) SubscribeBlockDisconnected(ctx context.Context, ch chan<- *json.BlockNotifyResult) (*ClientSubscription, error) {
+	return c.Subscribe(ctx, rpc.DefaultServiceNameSpace, ch, "blockDisconnected")
+}
+
+// SubscribeReorganization sends a notification to ch whenever the order of
+// the DAG changes.
+func (c *Client) SubscribeReorganization(ctx context.Context, ch chan<- *json.ReorganizationNotifyResult) (*ClientSubscription, error) {
+	return c.Subscribe(ctx, rpc.DefaultServiceNameSpace, ch, "reorganization")
+}
+
+// SubscribeNewTransactions sends every transaction accepted into the memory
+// pool to ch.  The serialized transaction is included when fullTx is set.
+func (c *Client) SubscribeNewTransactions(ctx context.Context, ch chan<- *json.TxNotifyResult,
+	fullTx bool) (*ClientSubscription, error) {
+	return c.Subscribe(ctx, rpc.DefaultServiceNameSpace, ch, "newTransactions", fullTx)
+}
+
+// SubscribeNewTips sends the tips of the DAG to ch whenever they change.
+func (c *Client) SubscribeNewTips(ctx context.Context, ch chan<- *json.TipsNotifyResult) (*ClientSubscription, error) {
+	return c.Subscribe(ctx, rpc.DefaultServiceNameSpace, ch, "newTips")
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+//
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/btceasypay/bitcoinpay/rpc"
+)
+
+// subscriptionQueueSize is the number of notifications buffered for a
+// subscription whose channel isn't read fast enough.  The subscription fails
+// with ErrSubscriptionQueueOverflow once it is exceeded.
+const subscriptionQueueSize = 1024
+
+// unsubscribeTimeout bounds the unsubscribe request sent to the server.
+const unsubscribeTimeout = 5 * time.Second
+
+// ErrSubscriptionQueueOverflow is returned through the Err channel of a
+// subscription whose notifications were not consumed in time.
+var ErrSubscriptionQueueOverflow = errors.New("subscription queue overflow")
+
+// ClientSubscription is a subscription established through Subscribe.
+type ClientSubscription struct {
+	client    *Client
+	conn      *wsConn
+	namespace string
+	id        string
+	channel   reflect.Value
+	etype     reflect.Type
+
+	in       chan json.RawMessage
+	quitCh   chan struct{}
+	err      chan error
+	quitOnce sync.Once
+}
+
+// Subscribe calls the "<namespace>_subscribe" method with the topic and the
+// given arguments, registering a subscription.  Notifications of the
+// subscription are decoded into the element type of channel, which must be a
+// writable channel, and sent to it.
+//
+// Subscriptions require a websocket connection.  Slow consumers are not
+// allowed to block the connection: the subscription is dropped when too many
+// notifications are waiting to be sent to channel.
+func (c *Client) Subscribe(ctx context.Context, namespace string, channel interface{},
+	topic string, args ...interface{}) (*ClientSubscription, error) {
+	chanVal := reflect.ValueOf(channel)
+	if chanVal.Kind() != reflect.Chan || chanVal.Type().ChanDir()&reflect.SendDir == 0 {
+		panic("channel given to Subscribe must be a writable channel")
+	}
+	if chanVal.IsNil() {
+		panic("channel given to Subscribe must not be nil")
+	}
+	if c.ws == nil {
+		return nil, ErrNotificationsUnsupported
+	}
+	if namespace == "" {
+		namespace = rpc.DefaultServiceNameSpace
+	}
+
+	sub := &ClientSubscription{
+		client:    c,
+		conn:      c.ws,
+		namespace: namespace,
+		channel:   chanVal,
+		etype:     chanVal.Type().Elem(),
+		in:        make(chan json.RawMessage, subscriptionQueueSize),
+		quitCh:    make(chan struct{}),
+		err:       make(chan error, 1),
+	}
+	req := c.newRequest(namespace+"_subscribe", append([]interface{}{topic}, args...)...)
+	msg, err := c.ws.call(ctx, req, sub)
+	if err != nil {
+		return nil, err
+	}
+	if err := msg.decodeResult(nil); err != nil {
+		return nil, err
+	}
+	go sub.forward()
+	return sub, nil
+}
+
+// ID returns the id the server assigned to the subscription.
+func (sub *ClientSubscription) ID() string {
+	return sub.id
+}
+
+// Err returns the subscription error channel.  The error channel receives a
+// value if there is an issue with the subscription, e.g. the connection was
+// closed or the notifications were not consumed in time.  It is closed when
+// Unsubscribe is called.
+func (sub *ClientSubscription) Err() <-chan error {
+	return sub.err
+}
+
+// Unsubscribe unsubscribes the notification and closes the error channel.
+// It can safely be called more than once.
+func (sub *ClientSubscription) Unsubscribe() {
+	if sub.quit(nil) {
+		sub.requestUnsubscribe()
+	}
+}
+
+// quit stops the subscription, reporting err if it is not nil.  It returns
+// false when the subscription was already stopped.
+func (sub *ClientSubscription) quit(err error) bool {
+	stopped := false
+	sub.quitOnce.Do(func() {
+		sub.conn.removeSub(sub)
+		if err != nil {
+			sub.err <- err
+		}
+		close(sub.quitCh)
+		close(sub.err)
+		stopped = true
+	})
+	return stopped
+}
+
+// requestUnsubscribe tells the server to stop sending notifications.
+func (sub *ClientSubscription) requestUnsubscribe() {
+	ctx, cancel := context.WithTimeout(context.Background(), unsubscribeTimeout)
+	defer cancel()
+	req := sub.client.newRequest(sub.namespace+"_unsubscribe", sub.id)
+	if _, err := sub.conn.call(ctx, req, nil); err != nil {
+		log.Debug("Failed to unsubscribe", "id", sub.id, "error", err)
+	}
+}
+
+// deliver queues a notification, it must not block the read loop of the
+// connection.
+func (sub *ClientSubscription) deliver(result json.RawMessage) {
+	select {
+	case sub.in <- result:
+	default:
+		if sub.quit(ErrSubscriptionQueueOverflow) {
+			go sub.requestUnsubscribe()
+		}
+	}
+}
+
+// forward decodes the queued notifications and sends them to the channel of
+// the subscription.
+func (sub *ClientSubscription) forward() {
+	quit := reflect.ValueOf(sub.quitCh)
+	for {
+		select {
+		case result := <-sub.in:
+			val := reflect.New(sub.etype)
+			if err := json.Unmarshal(result, val.Interface()); err != nil {
+				if sub.quit(err) {
+					go sub.requestUnsubscribe()
+				}
+				return
+			}
+			cases := []reflect.SelectCase{
+				{Dir: reflect.SelectSend, Chan: sub.channel, Send: val.Elem()},
+				{Dir: reflect.SelectRecv, Chan: quit},
+			}
+			if chosen, _, _ := reflect.Select(cases); chosen == 1 {
+				return
+			}
+		case <-sub.quitCh:
+			return
+		}
+	}
+}
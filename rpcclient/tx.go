@@ -0,0 +1,276 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+//
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpcclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"time"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/json"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/rpc"
+)
+
+// TransactionInput represents the inputs to a transaction.  Specifically a
+// transaction hash and output number pair.
+type TransactionInput struct {
+	Txid string `json:"txid"`
+	Vout uint32 `json:"vout"`
+}
+
+// decodeTx decodes a hex encoded transaction.
+func decodeTx(txHex string) (*types.Transaction, error) {
+	serialized, err := hex.DecodeString(txHex)
+	if err != nil {
+		return nil, err
+	}
+	var tx types.Transaction
+	if err := tx.Deserialize(bytes.NewReader(serialized)); err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+// callTx performs a call whose result is a hex encoded transaction.
+func (c *Client) callTx(ctx context.Context, method string, args ...interface{}) (*types.Transaction, error) {
+	var result string
+	if err := c.Call(ctx, &result, method, args...); err != nil {
+		return nil, err
+	}
+	return decodeTx(result)
+}
+
+// callTxVerbose performs a call whose result is a verbose transaction.
+func (c *Client) callTxVerbose(ctx context.Context, method string, args ...interface{}) (*json.TxRawResult, error) {
+	var result json.TxRawResult
+	if err := c.Call(ctx, &result, method, args...); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// CreateRawTransaction returns a new unsigned transaction spending the inputs
+// and paying the amounts to the addresses.  The lock time is optional.
+func (c *Client) CreateRawTransaction(ctx context.Context, inputs []TransactionInput,
+	amounts map[string]uint64, lockTime *int64) (*types.Transaction, error) {
+	return c.callTx(ctx, "createRawTransaction", inputs, amounts, lockTime)
+}
+
+// DecodeRawTransaction returns a description of the serialized transaction.
+func (c *Client) DecodeRawTransaction(ctx context.Context, serializedTx []byte) (*json.TxRawResult, error) {
+	return c.callTxVerbose(ctx, "decodeRawTransaction", hex.EncodeToString(serializedTx))
+}
+
+// SendRawTransaction submits the transaction to the node and returns its
+// hash.  Transactions paying unusually high fees are rejected unless
+// allowHighFees is set.
+func (c *Client) SendRawTransaction(ctx context.Context, tx *types.Transaction, allowHighFees bool) (*hash.Hash, error) {
+	serialized, err := tx.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	return c.callHash(ctx, "sendRawTransaction", hex.EncodeToString(serialized), allowHighFees)
+}
+
+// GetRawTransaction returns the transaction with the given id.
+func (c *Client) GetRawTransaction(ctx context.Context, txHash *hash.Hash) (*types.Transaction, error) {
+	return c.callTx(ctx, "getRawTransaction", txHash.String(), false)
+}
+
+// GetRawTransactionVerbose returns a description of the transaction with the
+// given id.
+func (c *Client) GetRawTransactionVerbose(ctx context.Context, txHash *hash.Hash) (*json.TxRawResult, error) {
+	return c.callTxVerbose(ctx, "getRawTransaction", txHash.String(), true)
+}
+
+// GetRawTransactionByHash returns the transaction with the given full hash.
+func (c *Client) GetRawTransactionByHash(ctx context.Context, txHash *hash.Hash) (*types.Transaction, error) {
+	return c.callTx(ctx, "getRawTransactionByHash", txHash.String(), false)
+}
+
+// GetRawTransactionByHashVerbose returns a description of the transaction
+// with the given full hash.
+func (c *Client) GetRawTransactionByHashVerbose(ctx context.Context, txHash *hash.Hash) (*json.TxRawResult, error) {
+	return c.callTxVerbose(ctx, "getRawTransactionByHash", txHash.String(), true)
+}
+
+// GetRawTransactions returns up to count transactions involving the address,
+// skipping the first skip ones.  The node must run with the address index.
+func (c *Client) GetRawTransactions(ctx context.Context, addr string, skip uint, count uint,
+	reverse bool) ([]*types.Transaction, error) {
+	var result []string
+	err := c.Call(ctx, &result, "getRawTransactions", addr, false, count, skip,
+		reverse, false)
+	if err != nil {
+		return nil, err
+	}
+	txs := make([]*types.Transaction, 0, len(result))
+	for _, txHex := range result {
+		tx, err := decodeTx(txHex)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// GetRawTransactionsVerbose works like GetRawTransactions but returns a
+// description of the transactions.  The previous outputs of the inputs are
+// included when vinExtra is set, filterAddrs limits them to the given
+// addresses.
+func (c *Client) GetRawTransactionsVerbose(ctx context.Context, addr string, skip uint, count uint,
+	reverse bool, vinExtra bool, filterAddrs []string) ([]json.GetRawTransactionsResult, error) {
+	var result []json.GetRawTransactionsResult
+	err := c.Call(ctx, &result, "getRawTransactions", addr, vinExtra, count, skip,
+		reverse, true, filterAddrs)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetUtxo returns the unspent transaction output, nil when it is spent or
+// doesn't exist.  The memory pool is searched too when includeMempool is set.
+func (c *Client) GetUtxo(ctx context.Context, txHash *hash.Hash, vout uint32,
+	includeMempool bool) (*json.GetUtxoResult, error) {
+	var result *json.GetUtxoResult
+	if err := c.Call(ctx, &result, "getUtxo", txHash.String(), vout, includeMempool); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// TxSign signs the inputs of the transaction paying to the pay-to-pubkey-hash
+// address of the hex encoded private key and returns the signed transaction.
+func (c *Client) TxSign(ctx context.Context, privKeyHex string, tx *types.Transaction) (*types.Transaction, error) {
+	serialized, err := tx.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	return c.callTx(ctx, rpc.TestNameSpace+"_txSign", privKeyHex, hex.EncodeToString(serialized))
+}
+
+// GetMempool returns the ids of the transactions in the memory pool.
+func (c *Client) GetMempool(ctx context.Context) ([]*hash.Hash, error) {
+	var result []string
+	if err := c.Call(ctx, &result, "getMempool", nil, false); err != nil {
+		return nil, err
+	}
+	return decodeHashes(result)
+}
+
+// GetTxConfirmationRisk returns the risk that the block of the transaction is
+// reverted by an attacker with the fraction of the hash power.  The result is
+// confirmed when the risk is below epsilon, the security level of the network
+// is used when epsilon is zero.
+func (c *Client) GetTxConfirmationRisk(ctx context.Context, txHash *hash.Hash, attackerFraction float64,
+	epsilon float64) (*json.TxConfirmationRiskResult, error) {
+	var eps *float64
+	if epsilon != 0 {
+		eps = &epsilon
+	}
+	var result json.TxConfirmationRiskResult
+	err := c.Call(ctx, &result, "getTxConfirmationRisk", txHash.String(), attackerFraction, eps)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// WaitTxConfirmationRisk polls the confirmation risk of the transaction until
+// it is below epsilon and returns the last result.  The estimated wait of the
+// node is used as the poll interval, limited to between one second and one
+// minute.
+func (c *Client) WaitTxConfirmationRisk(ctx context.Context, txHash *hash.Hash, attackerFraction float64,
+	epsilon float64) (*json.TxConfirmationRiskResult, error) {
+	for {
+		result, err := c.GetTxConfirmationRisk(ctx, txHash, attackerFraction, epsilon)
+		if err != nil {
+			return nil, err
+		}
+		if result.Confirmed {
+			return result, nil
+		}
+		wait := time.Duration(result.WaitTime) * time.Second
+		if wait < time.Second {
+			wait = time.Second
+		} else if wait > time.Minute {
+			wait = time.Minute
+		}
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// CreateAssetIssueTransaction returns a new unsigned transaction issuing a new
+// asset to the addresses of the asset amounts, each of them must be paid an
+// amount too.  The issuer is the holder of the output spent by the first
+// input.
+func (c *Client) CreateAssetIssueTransaction(ctx context.Context, inputs []TransactionInput,
+	amounts map[string]uint64, assetAmounts map[string]uint64,
+	lockTime *int64) (*types.Transaction, *types.AssetID, error) {
+	var result json.CreateAssetIssueResult
+	err := c.Call(ctx, &result, "createAssetIssueTransaction", inputs, amounts,
+		assetAmounts, lockTime)
+	if err != nil {
+		return nil, nil, err
+	}
+	tx, err := decodeTx(result.Hex)
+	if err != nil {
+		return nil, nil, err
+	}
+	id, err := types.NewAssetIDFromStr(result.AssetID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tx, id, nil
+}
+
+// CreateAssetTransaction returns a new unsigned transaction transferring the
+// asset to the addresses of the asset amounts.  When revoke is set the issuer
+// revokes the amount of the asset of the inputs which is not transferred.
+func (c *Client) CreateAssetTransaction(ctx context.Context, inputs []TransactionInput,
+	amounts map[string]uint64, id *types.AssetID, assetAmounts map[string]uint64,
+	revoke bool, lockTime *int64) (*types.Transaction, error) {
+	return c.callTx(ctx, "createAssetTransaction", inputs, amounts, id.String(),
+		assetAmounts, revoke, lockTime)
+}
+
+// GetAssetInfo returns the issuer, the issue transaction and the supply of the
+// asset.
+func (c *Client) GetAssetInfo(ctx context.Context, id *types.AssetID) (*json.AssetInfoResult, error) {
+	var result json.AssetInfoResult
+	if err := c.Call(ctx, &result, "getAssetInfo", id.String()); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ListAssets returns the issuer, the issue transaction and the supply of all
+// the assets.
+func (c *Client) ListAssets(ctx context.Context) ([]json.AssetInfoResult, error) {
+	var result []json.AssetInfoResult
+	if err := c.Call(ctx, &result, "listAssets"); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetAssetBalances returns the amounts of the assets held by the address.
+func (c *Client) GetAssetBalances(ctx context.Context, addr string) ([]json.AssetBalanceResult, error) {
+	var result []json.AssetBalanceResult
+	if err := c.Call(ctx, &result, "getAssetBalances", addr); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
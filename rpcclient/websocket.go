@@ -0,0 +1,311 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+//
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpcclient
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// websocketPath is the path of the websocket endpoint of the server.
+	websocketPath = "/ws"
+
+	notificationMethodSuffix = "_subscription"
+)
+
+// wsOp is a request waiting for its responses.  A batch is a single
+// operation with one response per request.
+type wsOp struct {
+	resp chan *jsonMessage
+	sub  *ClientSubscription // set for subscribe requests
+}
+
+// wsConn is a websocket connection to the server which multiplexes requests
+// and subscriptions.
+type wsConn struct {
+	conn    *websocket.Conn
+	sendMtx sync.Mutex
+
+	mtx     sync.Mutex
+	pending map[string]*wsOp
+	subs    map[string]*ClientSubscription
+	err     error // set when the connection was closed
+	closing chan struct{}
+}
+
+// dialWebsocket connects to the websocket endpoint of the server.  Canceling
+// ctx aborts the dial and the handshake.
+func dialWebsocket(ctx context.Context, cfg *Config, tlsConfig *tls.Config) (*wsConn, error) {
+	scheme, origin := "wss", "https"
+	if cfg.DisableTLS {
+		scheme, origin = "ws", "http"
+	}
+	wsCfg, err := websocket.NewConfig(scheme+"://"+cfg.Host+websocketPath,
+		origin+"://"+cfg.Host+"/")
+	if err != nil {
+		return nil, err
+	}
+	if cfg.User != "" || cfg.Pass != "" {
+		login := base64.StdEncoding.EncodeToString([]byte(cfg.User + ":" + cfg.Pass))
+		wsCfg.Header = http.Header{"Authorization": {"Basic " + login}}
+	}
+
+	var dialer net.Dialer
+	rawConn, err := dialer.DialContext(ctx, "tcp", cfg.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	// The websocket package has no context support, close the connection
+	// to abort the handshakes when ctx is canceled.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			rawConn.Close()
+		case <-done:
+		}
+	}()
+
+	conn := rawConn
+	if tlsConfig != nil {
+		tlsConfig = tlsConfig.Clone()
+		if host, _, err := net.SplitHostPort(cfg.Host); err == nil {
+			tlsConfig.ServerName = host
+		}
+		tlsConn := tls.Client(rawConn, tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			rawConn.Close()
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	ws, err := websocket.NewClient(wsCfg, conn)
+	if err != nil {
+		rawConn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	c := &wsConn{
+		conn:    ws,
+		pending: make(map[string]*wsOp),
+		subs:    make(map[string]*ClientSubscription),
+		closing: make(chan struct{}),
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+// readLoop dispatches the messages of the server until the connection is
+// closed.
+func (c *wsConn) readLoop() {
+	for {
+		var raw json.RawMessage
+		if err := websocket.JSON.Receive(c.conn, &raw); err != nil {
+			c.close(err)
+			return
+		}
+		var msgs []*jsonMessage
+		if isBatch(raw) {
+			if err := json.Unmarshal(raw, &msgs); err != nil {
+				log.Debug("Invalid JSON-RPC batch response", "error", err)
+				continue
+			}
+		} else {
+			var msg jsonMessage
+			if err := json.Unmarshal(raw, &msg); err != nil {
+				log.Debug("Invalid JSON-RPC message", "error", err)
+				continue
+			}
+			msgs = append(msgs, &msg)
+		}
+		for _, msg := range msgs {
+			if msg.isNotification() {
+				c.handleNotification(msg)
+			} else {
+				c.handleResponse(msg)
+			}
+		}
+	}
+}
+
+func (c *wsConn) handleNotification(msg *jsonMessage) {
+	if !strings.HasSuffix(msg.Method, notificationMethodSuffix) {
+		log.Debug("Unexpected JSON-RPC notification", "method", msg.Method)
+		return
+	}
+	var params struct {
+		Subscription string          `json:"subscription"`
+		Result       json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		log.Debug("Invalid JSON-RPC notification", "error", err)
+		return
+	}
+	c.mtx.Lock()
+	sub := c.subs[params.Subscription]
+	c.mtx.Unlock()
+	if sub != nil {
+		sub.deliver(params.Result)
+	}
+}
+
+func (c *wsConn) handleResponse(msg *jsonMessage) {
+	c.mtx.Lock()
+	op, ok := c.pending[string(msg.Id)]
+	if !ok {
+		c.mtx.Unlock()
+		log.Debug("Unsolicited JSON-RPC response", "id", string(msg.Id))
+		return
+	}
+	delete(c.pending, string(msg.Id))
+	// Register the subscription before reading any further message, the
+	// server sends notifications right after the reply.
+	if op.sub != nil && msg.Error == nil {
+		if err := json.Unmarshal(msg.Result, &op.sub.id); err == nil {
+			c.subs[op.sub.id] = op.sub
+		}
+	}
+	c.mtx.Unlock()
+	op.resp <- msg
+}
+
+// send registers op for the ids of the requests and writes msg to the
+// connection.
+func (c *wsConn) send(op *wsOp, msg interface{}, reqs ...*jsonRequest) error {
+	c.mtx.Lock()
+	if c.err != nil {
+		c.mtx.Unlock()
+		return c.err
+	}
+	for _, req := range reqs {
+		c.pending[string(req.Id)] = op
+	}
+	c.mtx.Unlock()
+
+	c.sendMtx.Lock()
+	err := websocket.JSON.Send(c.conn, msg)
+	c.sendMtx.Unlock()
+	if err != nil {
+		c.forget(reqs)
+		return err
+	}
+	return nil
+}
+
+// forget removes the requests from the pending ones and returns how many of
+// them were still waiting for a response.
+func (c *wsConn) forget(reqs []*jsonRequest) int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	n := 0
+	for _, req := range reqs {
+		if _, ok := c.pending[string(req.Id)]; ok {
+			delete(c.pending, string(req.Id))
+			n++
+		}
+	}
+	return n
+}
+
+// wait collects the responses of op.
+func (c *wsConn) wait(ctx context.Context, op *wsOp, reqs []*jsonRequest) ([]*jsonMessage, error) {
+	msgs := make([]*jsonMessage, 0, len(reqs))
+	for len(msgs) < len(reqs) {
+		select {
+		case msg := <-op.resp:
+			msgs = append(msgs, msg)
+		case <-ctx.Done():
+			// Responses which arrived in the meantime are already
+			// queued, take them to not lose a subscription.
+			if c.forget(reqs) == 0 && op.sub != nil {
+				return append(msgs, <-op.resp), nil
+			}
+			return nil, ctx.Err()
+		case <-c.closing:
+			return nil, c.err
+		}
+	}
+	return msgs, nil
+}
+
+func (c *wsConn) call(ctx context.Context, req *jsonRequest, sub *ClientSubscription) (*jsonMessage, error) {
+	op := &wsOp{resp: make(chan *jsonMessage, 1), sub: sub}
+	reqs := []*jsonRequest{req}
+	if err := c.send(op, req, reqs...); err != nil {
+		return nil, err
+	}
+	msgs, err := c.wait(ctx, op, reqs)
+	if err != nil {
+		return nil, err
+	}
+	return msgs[0], nil
+}
+
+func (c *wsConn) batchCall(ctx context.Context, reqs []*jsonRequest) ([]*jsonMessage, error) {
+	op := &wsOp{resp: make(chan *jsonMessage, len(reqs))}
+	if err := c.send(op, reqs, reqs...); err != nil {
+		return nil, err
+	}
+	return c.wait(ctx, op, reqs)
+}
+
+// close shuts down the connection, failing all pending requests and
+// subscriptions with err.
+func (c *wsConn) close(err error) {
+	c.mtx.Lock()
+	if c.err != nil {
+		c.mtx.Unlock()
+		return
+	}
+	c.err = err
+	close(c.closing)
+	subs := c.subs
+	c.subs = make(map[string]*ClientSubscription)
+	c.mtx.Unlock()
+
+	c.conn.Close()
+	for _, sub := range subs {
+		sub.quit(err)
+	}
+}
+
+// removeSub drops the subscription from the connection.
+func (c *wsConn) removeSub(sub *ClientSubscription) {
+	c.mtx.Lock()
+	if c.subs[sub.id] == sub {
+		delete(c.subs, sub.id)
+	}
+	c.mtx.Unlock()
+}
+
+// isBatch returns true when the first non-whitespace characters is '['
+func isBatch(msg json.RawMessage) bool {
+	for _, c := range msg {
+		// skip insignificant whitespace (http://www.ietf.org/rfc/rfc4627.txt)
+		if c == 0x20 || c == 0x09 || c == 0x0a || c == 0x0d {
+			continue
+		}
+		return c == '['
+	}
+	return false
+}
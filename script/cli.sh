@@ -340,6 +340,35 @@ function remove_ban(){
   get_result "$data"
 }
 
+function set_ban(){
+  local subnet=$1
+  local duration=$2
+  if [ "$duration" == "" ]; then
+    local data='{"jsonrpc":"2.0","method":"test_setBan","params":["'$subnet'"],"id":1}'
+  else
+    local data='{"jsonrpc":"2.0","method":"test_setBan","params":["'$subnet'","'$duration'"],"id":1}'
+  fi
+  get_result "$data"
+}
+
+function add_node(){
+  local addr=$1
+  local cmd=$2
+  local data='{"jsonrpc":"2.0","method":"test_addNode","params":["'$addr'","'$cmd'"],"id":1}'
+  get_result "$data"
+}
+
+function disconnect_node(){
+  local target=$1
+  local data='{"jsonrpc":"2.0","method":"test_disconnectNode","params":["'$target'"],"id":1}'
+  get_result "$data"
+}
+
+function get_added_node_info(){
+  local data='{"jsonrpc":"2.0","method":"test_getAddedNodeInfo","params":[],"id":null}'
+  get_result "$data"
+}
+
 function set_rpc_maxclients(){
   local max=$1
   local data='{"jsonrpc":"2.0","method":"test_setRpcMaxClients","params":['$max'],"id":null}'
@@ -454,6 +483,10 @@ function usage(){
   echo "  stop"
   echo "  banlist"
   echo "  removeban"
+  echo "  setban <ip|subnet> [duration]"
+  echo "  addnode <addr> <add|remove|onetry>"
+  echo "  disconnectnode <id|addr>"
+  echo "  addednodeinfo"
   echo "  loglevel [trace, debug, info, warn, error, critical]"
   echo "block  :"
   echo "  block <order|hash>"
@@ -818,6 +851,22 @@ elif [ "$1" == "removeban" ]; then
   shift
   remove_ban $@
 
+elif [ "$1" == "setban" ]; then
+  shift
+  set_ban $@
+
+elif [ "$1" == "addnode" ]; then
+  shift
+  add_node $@
+
+elif [ "$1" == "disconnectnode" ]; then
+  shift
+  disconnect_node $@
+
+elif [ "$1" == "addednodeinfo" ]; then
+  shift
+  get_added_node_info | jq .
+
 ## Tx
 elif [ "$1" == "tx" ]; then
   shift
@@ -1,14 +1,91 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+//
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
 package acct
 
 import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/blockchain"
+	"github.com/btceasypay/bitcoinpay/core/dbnamespace"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/database"
+	"github.com/btceasypay/bitcoinpay/engine/txscript"
 	"github.com/btceasypay/bitcoinpay/log"
+	"github.com/btceasypay/bitcoinpay/params"
 	"github.com/btceasypay/bitcoinpay/rpc"
+	"github.com/btceasypay/bitcoinpay/services/index"
 )
 
-// account manager communicate with various backends for signing transactions.
+const (
+	// acctIndexName is the human-readable name for the index.
+	acctIndexName = "account index"
+
+	// outpointSize is the size of a serialized outpoint, the transaction
+	// hash followed by the output index.
+	outpointSize = hash.HashSize + 4
+)
+
+var (
+	// acctIndexKey is the key of the account index and the db bucket used
+	// to house it.
+	acctIndexKey = []byte("acctidx")
+
+	// acctOutsBucketName is the name of the nested bucket which houses the
+	// outputs paid to the watched addresses.
+	acctOutsBucketName = []byte("outs")
+
+	// acctHistoryBucketName is the name of the nested bucket which houses
+	// the transactions involving the watched addresses.
+	acctHistoryBucketName = []byte("hist")
+
+	// acctWatchedKeyName is the key of the watched addresses the index was
+	// built for.
+	acctWatchedKeyName = []byte("watched")
+
+	// byteOrder is the preferred byte order used for serializing numeric
+	// fields for storage in the database.
+	byteOrder = binary.LittleEndian
+)
+
+// AccountManager tracks the balances, the spendable outputs and the history
+// of a configured set of watched addresses.
+//
+// The confirmed state is maintained as an index which is driven by the index
+// manager, so it is updated atomically with the blocks connected to and
+// disconnected from the DAG order.  The outputs recorded by the index are
+// only candidates, their state is always resolved against the utxo set of
+// the chain.  The unconfirmed state is kept in memory and driven by the
+// memory pool.
 type AccountManager struct {
+	db     database.DB
+	params *params.Params
+	chain  *blockchain.BlockChain
+
+	// watched maps the encoded watched addresses to the decoded ones.
+	watched map[string]types.Address
+
+	// The following fields track the transactions of the memory pool which
+	// involve the watched addresses.
+	unconfirmedLock sync.RWMutex
+	unconfirmed     map[hash.Hash]*unconfirmedTx
+	spentByMempool  map[types.TxOutPoint]hash.Hash
 }
 
+// Ensure the AccountManager type implements the Indexer interface.
+var _ index.Indexer = (*AccountManager)(nil)
+
+// Ensure the AccountManager type implements the NeedsInputser interface.
+var _ index.NeedsInputser = (*AccountManager)(nil)
+
 func (a *AccountManager) Start() error {
 	log.Debug("Starting account manager")
 	return nil
@@ -19,17 +96,523 @@ func (a *AccountManager) Stop() error {
 	return nil
 }
 
-func (a AccountManager) APIs() []rpc.API {
+func (a *AccountManager) APIs() []rpc.API {
 	return []rpc.API{
 		{
 			NameSpace: rpc.DefaultServiceNameSpace,
-			Service:   NewPublicAccountManagerAPI(&a),
+			Service:   NewPublicAccountManagerAPI(a),
 			Public:    true,
 		},
 	}
 }
 
-func New() (*AccountManager, error) {
-	a := AccountManager{}
+// SetChain sets the chain the account manager resolves the watched outputs
+// against.  It must be called before the account manager is queried.
+func (a *AccountManager) SetChain(chain *blockchain.BlockChain) {
+	a.chain = chain
+}
+
+// Enabled returns whether any address is watched.
+func (a *AccountManager) Enabled() bool {
+	return len(a.watched) > 0
+}
+
+// IsWatched returns whether the encoded address is watched.
+func (a *AccountManager) IsWatched(addr string) bool {
+	_, ok := a.watched[addr]
+	return ok
+}
+
+// watchedList returns the encoded watched addresses in sorted order.
+func (a *AccountManager) watchedList() []string {
+	addrs := make([]string, 0, len(a.watched))
+	for addr := range a.watched {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+// watchedAddrs returns the encoded watched addresses the public key script
+// pays to.
+func (a *AccountManager) watchedAddrs(pkScript []byte) []string {
+	// Nothing to track if the script is non-standard or otherwise doesn't
+	// contain any addresses.
+	_, addrs, _, err := txscript.ExtractPkScriptAddrs(pkScript, a.params)
+	if err != nil {
+		return nil
+	}
+	var result []string
+	for _, addr := range addrs {
+		encoded := addr.Encode()
+		if a.IsWatched(encoded) {
+			result = append(result, encoded)
+		}
+	}
+	return result
+}
+
+// Key returns the database key to use for the index as a byte slice.
+//
+// This is part of the Indexer interface.
+func (a *AccountManager) Key() []byte {
+	return acctIndexKey
+}
+
+// Name returns the human-readable name of the index.
+//
+// This is part of the Indexer interface.
+func (a *AccountManager) Name() string {
+	return acctIndexName
+}
+
+// Create is invoked when the indexer manager determines the index needs
+// to be created for the first time.  It creates the buckets for the outputs
+// and the history of the watched addresses and records the addresses the
+// index is built for.
+//
+// This is part of the Indexer interface.
+func (a *AccountManager) Create(dbTx database.Tx) error {
+	bucket, err := dbTx.Metadata().CreateBucket(acctIndexKey)
+	if err != nil {
+		return err
+	}
+	if _, err := bucket.CreateBucket(acctOutsBucketName); err != nil {
+		return err
+	}
+	if _, err := bucket.CreateBucket(acctHistoryBucketName); err != nil {
+		return err
+	}
+	return bucket.Put(acctWatchedKeyName, []byte(strings.Join(a.watchedList(), ",")))
+}
+
+// Init is only provided to satisfy the Indexer interface as there is nothing
+// to initialize for this index.
+//
+// This is part of the Indexer interface.
+func (a *AccountManager) Init() error {
+	return nil
+}
+
+// NeedsInputs signals that the index requires the referenced inputs in order
+// to properly create the index.
+//
+// This implements the NeedsInputser interface.
+func (a *AccountManager) NeedsInputs() bool {
+	return true
+}
+
+// ConnectBlock is invoked by the index manager when a new block has been
+// connected to the DAG order.  It records the outputs paying to the watched
+// addresses and the transactions involving them.
+//
+// This is part of the Indexer interface.
+func (a *AccountManager) ConnectBlock(dbTx database.Tx, block *types.SerializedBlock, stxos []blockchain.SpentTxOut) error {
+	outs, history := a.indexBlock(block, stxos)
+	bucket := dbTx.Metadata().Bucket(acctIndexKey)
+	outsBucket := bucket.Bucket(acctOutsBucketName)
+	for key, out := range outs {
+		if err := outsBucket.Put([]byte(key), out.serialize()); err != nil {
+			return err
+		}
+	}
+	histBucket := bucket.Bucket(acctHistoryBucketName)
+	for key, entry := range history {
+		if err := histBucket.Put([]byte(key), entry.serialize()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DisconnectBlock is invoked by the index manager when a block has been
+// disconnected from the DAG order.  It removes everything ConnectBlock
+// recorded for the block.
+//
+// This is part of the Indexer interface.
+func (a *AccountManager) DisconnectBlock(dbTx database.Tx, block *types.SerializedBlock, stxos []blockchain.SpentTxOut) error {
+	outs, history := a.indexBlock(block, stxos)
+	bucket := dbTx.Metadata().Bucket(acctIndexKey)
+	outsBucket := bucket.Bucket(acctOutsBucketName)
+	for key := range outs {
+		if err := outsBucket.Delete([]byte(key)); err != nil {
+			return err
+		}
+	}
+	histBucket := bucket.Bucket(acctHistoryBucketName)
+	for key := range history {
+		if err := histBucket.Delete([]byte(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexBlock returns the outputs of the block paying to the watched addresses
+// and the history entries of the transactions involving them, both keyed by
+// their serialized database keys.
+func (a *AccountManager) indexBlock(block *types.SerializedBlock,
+	stxos []blockchain.SpentTxOut) (map[string]*acctOut, map[string]*historyEntry) {
+	order := uint32(block.Order())
+	outs := make(map[string]*acctOut)
+	history := make(map[string]*historyEntry)
+	entry := func(addr string, txHash *hash.Hash) *historyEntry {
+		key := string(historyKey(addr, order, txHash))
+		e := history[key]
+		if e == nil {
+			e = &historyEntry{}
+			history[key] = e
+		}
+		return e
+	}
+
+	stxoIndex := 0
+	for txIdx, tx := range block.Transactions() {
+		if tx.IsDuplicate {
+			continue
+		}
+		msgTx := tx.Transaction()
+
+		// Coinbases do not reference any inputs.  The spent outputs are
+		// not available for blocks which are invalid in the DAG, so only
+		// their outputs are recorded.
+		if txIdx != 0 && stxoIndex < len(stxos) {
+			for range msgTx.TxIn {
+				if stxoIndex >= len(stxos) {
+					break
+				}
+				stxo := stxos[stxoIndex]
+				stxoIndex++
+				for _, addr := range a.watchedAddrs(stxo.PkScript) {
+					entry(addr, tx.Hash()).sent += stxo.Amount
+				}
+			}
+		}
+
+		for i, txOut := range msgTx.TxOut {
+			for _, addr := range a.watchedAddrs(txOut.PkScript) {
+				op := types.NewOutPoint(tx.Hash(), uint32(i))
+				outs[string(outKey(addr, op))] = &acctOut{
+					amount:   txOut.Amount,
+					order:    order,
+					coinbase: txIdx == 0,
+				}
+				entry(addr, tx.Hash()).received += txOut.Amount
+			}
+		}
+	}
+	return outs, history
+}
+
+// addrKey returns the key prefix of all entries of the address.  The address
+// is length prefixed so the entries of an address never share a prefix with
+// the ones of another address.
+func addrKey(addr string) []byte {
+	key := make([]byte, 1+len(addr))
+	key[0] = byte(len(addr))
+	copy(key[1:], addr)
+	return key
+}
+
+// -----------------------------------------------------------------------------
+// The outputs bucket maps every output paying to a watched address to the
+// amount, the order of the block and whether it was created by a coinbase.
+//
+// The serialized key format is:
+//
+//   <addr len><addr><tx hash><output index>
+//
+//   Field           Type             Size
+//   addr len        uint8            1
+//   addr            string           addr len
+//   tx hash         hash.Hash        32
+//   output index    uint32           4
+//
+// The serialized value format is:
+//
+//   <amount><order><flags>
+//
+//   Field           Type             Size
+//   amount          uint64           8
+//   order           uint32           4
+//   flags           uint8            1 (bit 0 is set for coinbase outputs)
+// -----------------------------------------------------------------------------
+
+// acctOut is an output paying to a watched address.
+type acctOut struct {
+	amount   uint64
+	order    uint32
+	coinbase bool
+}
+
+// outKey returns the outputs bucket key of the output paying to the address.
+func outKey(addr string, op *types.TxOutPoint) []byte {
+	key := addrKey(addr)
+	serialized := make([]byte, len(key)+outpointSize)
+	copy(serialized, key)
+	copy(serialized[len(key):], op.Hash[:])
+	byteOrder.PutUint32(serialized[len(key)+hash.HashSize:], op.OutIndex)
+	return serialized
+}
+
+// decodeOutKey returns the outpoint of an outputs bucket key.
+func decodeOutKey(key []byte) (*types.TxOutPoint, error) {
+	if len(key) < outpointSize {
+		return nil, fmt.Errorf("unexpected end of data for account output key")
+	}
+	serialized := key[len(key)-outpointSize:]
+	var h hash.Hash
+	copy(h[:], serialized[:hash.HashSize])
+	return types.NewOutPoint(&h, byteOrder.Uint32(serialized[hash.HashSize:])), nil
+}
+
+func (o *acctOut) serialize() []byte {
+	serialized := make([]byte, 13)
+	byteOrder.PutUint64(serialized[0:8], o.amount)
+	byteOrder.PutUint32(serialized[8:12], o.order)
+	if o.coinbase {
+		serialized[12] = 1
+	}
+	return serialized
+}
+
+func deserializeAcctOut(serialized []byte) (*acctOut, error) {
+	if len(serialized) < 13 {
+		return nil, fmt.Errorf("unexpected end of data for account output")
+	}
+	return &acctOut{
+		amount:   byteOrder.Uint64(serialized[0:8]),
+		order:    byteOrder.Uint32(serialized[8:12]),
+		coinbase: serialized[12]&1 == 1,
+	}, nil
+}
+
+// -----------------------------------------------------------------------------
+// The history bucket maps every transaction involving a watched address to
+// the amounts it paid to and spent from the address.  The order is stored in
+// big endian so the entries of an address are iterated in DAG order.
+//
+// The serialized key format is:
+//
+//   <addr len><addr><order><tx hash>
+//
+//   Field           Type             Size
+//   addr len        uint8            1
+//   addr            string           addr len
+//   order           uint32           4
+//   tx hash         hash.Hash        32
+//
+// The serialized value format is:
+//
+//   <received><sent>
+//
+//   Field           Type             Size
+//   received        uint64           8
+//   sent            uint64           8
+// -----------------------------------------------------------------------------
+
+// historyEntry is a transaction involving a watched address.
+type historyEntry struct {
+	order    uint32
+	txHash   hash.Hash
+	received uint64
+	sent     uint64
+}
+
+// historyKey returns the history bucket key of the transaction involving the
+// address.
+func historyKey(addr string, order uint32, txHash *hash.Hash) []byte {
+	key := addrKey(addr)
+	serialized := make([]byte, len(key)+4+hash.HashSize)
+	copy(serialized, key)
+	binary.BigEndian.PutUint32(serialized[len(key):], order)
+	copy(serialized[len(key)+4:], txHash[:])
+	return serialized
+}
+
+func (e *historyEntry) serialize() []byte {
+	serialized := make([]byte, 16)
+	byteOrder.PutUint64(serialized[0:8], e.received)
+	byteOrder.PutUint64(serialized[8:16], e.sent)
+	return serialized
+}
+
+func deserializeHistoryEntry(key []byte, serialized []byte) (*historyEntry, error) {
+	if len(key) < 4+hash.HashSize || len(serialized) < 16 {
+		return nil, fmt.Errorf("unexpected end of data for account history")
+	}
+	key = key[len(key)-4-hash.HashSize:]
+	e := &historyEntry{
+		order:    binary.BigEndian.Uint32(key[:4]),
+		received: byteOrder.Uint64(serialized[0:8]),
+		sent:     byteOrder.Uint64(serialized[8:16]),
+	}
+	copy(e.txHash[:], key[4:])
+	return e, nil
+}
+
+// fetchOuts returns the outputs recorded for the address.
+func (a *AccountManager) fetchOuts(addr string) (map[types.TxOutPoint]*acctOut, error) {
+	outs := make(map[types.TxOutPoint]*acctOut)
+	err := a.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(acctIndexKey)
+		if bucket == nil {
+			return nil
+		}
+		prefix := addrKey(addr)
+		cursor := bucket.Bucket(acctOutsBucketName).Cursor()
+		for ok := cursor.Seek(prefix); ok && bytes.HasPrefix(cursor.Key(), prefix); ok = cursor.Next() {
+			op, err := decodeOutKey(cursor.Key())
+			if err != nil {
+				return err
+			}
+			out, err := deserializeAcctOut(cursor.Value())
+			if err != nil {
+				return err
+			}
+			outs[*op] = out
+		}
+		return nil
+	})
+	return outs, err
+}
+
+// fetchHistory returns the transactions recorded for the address in DAG
+// order.
+func (a *AccountManager) fetchHistory(addr string) ([]*historyEntry, error) {
+	var history []*historyEntry
+	err := a.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(acctIndexKey)
+		if bucket == nil {
+			return nil
+		}
+		prefix := addrKey(addr)
+		cursor := bucket.Bucket(acctHistoryBucketName).Cursor()
+		for ok := cursor.Seek(prefix); ok && bytes.HasPrefix(cursor.Key(), prefix); ok = cursor.Next() {
+			e, err := deserializeHistoryEntry(cursor.Key(), cursor.Value())
+			if err != nil {
+				return err
+			}
+			history = append(history, e)
+		}
+		return nil
+	})
+	return history, err
+}
+
+// unspentOut is an unspent output paying to a watched address, resolved
+// against the utxo set of the chain.
+type unspentOut struct {
+	outPoint      types.TxOutPoint
+	pkScript      []byte
+	amount        uint64
+	confirmations uint
+	coinbase      bool
+	spendable     bool
+}
+
+// unspent returns the unspent outputs paying to the address.  Outputs spent by
+// a transaction of the memory pool are not spendable.
+func (a *AccountManager) unspent(addr string) ([]*unspentOut, error) {
+	if a.chain == nil {
+		return nil, fmt.Errorf("account manager is not attached to a chain")
+	}
+	outs, err := a.fetchOuts(addr)
+	if err != nil {
+		return nil, err
+	}
+	bd := a.chain.BlockDAG()
+	mainTip := bd.GetMainChainTip()
+	result := make([]*unspentOut, 0, len(outs))
+	for op, out := range outs {
+		entry, err := a.chain.FetchUtxoEntry(op)
+		if err != nil {
+			return nil, err
+		}
+		// The output is spent, or the block creating it is invalid.
+		if entry == nil || entry.IsSpent() || a.chain.IsInvalidOut(entry) {
+			continue
+		}
+		ib := bd.GetBlock(entry.BlockHash())
+		if ib == nil {
+			continue
+		}
+		u := &unspentOut{
+			outPoint:      op,
+			pkScript:      entry.PkScript(),
+			amount:        entry.Amount(),
+			confirmations: bd.GetConfirmations(ib.GetID()),
+			coinbase:      out.coinbase,
+			spendable:     !a.isSpentByMempool(op),
+		}
+		if u.coinbase {
+			if op.OutIndex == 0 {
+				u.amount += uint64(a.chain.GetFees(entry.BlockHash()))
+			}
+			if u.spendable {
+				err := bd.CheckBlueAndMatureMT([]uint{ib.GetID()}, []uint{mainTip.GetID()},
+					uint(a.params.CoinbaseMaturity))
+				u.spendable = err == nil
+			}
+		}
+		result = append(result, u)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].confirmations != result[j].confirmations {
+			return result[i].confirmations > result[j].confirmations
+		}
+		c := bytes.Compare(result[i].outPoint.Hash[:], result[j].outPoint.Hash[:])
+		if c != 0 {
+			return c < 0
+		}
+		return result[i].outPoint.OutIndex < result[j].outPoint.OutIndex
+	})
+	return result, nil
+}
+
+// resetIfChanged drops the index when it was built for a different set of
+// watched addresses, so the index manager creates and catches it up again.
+func (a *AccountManager) resetIfChanged() error {
+	return a.db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		bucket := meta.Bucket(acctIndexKey)
+		if bucket == nil {
+			return nil
+		}
+		watched := strings.Join(a.watchedList(), ",")
+		if string(bucket.Get(acctWatchedKeyName)) == watched {
+			return nil
+		}
+		log.Info("Watched addresses changed, rebuilding the account index")
+		if err := meta.DeleteBucket(acctIndexKey); err != nil {
+			return err
+		}
+		tips := meta.Bucket(dbnamespace.IndexTipsBucketName)
+		if tips == nil {
+			return nil
+		}
+		return tips.Delete(acctIndexKey)
+	})
+}
+
+// New returns an account manager watching the passed addresses.  When any
+// address is watched the account manager must be registered with the index
+// manager, which keeps its confirmed state in sync with the DAG.
+func New(db database.DB, p *params.Params, watchAddrs []types.Address) (*AccountManager, error) {
+	a := AccountManager{
+		db:             db,
+		params:         p,
+		watched:        make(map[string]types.Address),
+		unconfirmed:    make(map[hash.Hash]*unconfirmedTx),
+		spentByMempool: make(map[types.TxOutPoint]hash.Hash),
+	}
+	for _, addr := range watchAddrs {
+		a.watched[addr.Encode()] = addr
+	}
+	if a.Enabled() {
+		if err := a.resetIfChanged(); err != nil {
+			return nil, err
+		}
+	}
 	return &a, nil
 }
@@ -0,0 +1,225 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+
+package acct
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/address"
+	"github.com/btceasypay/bitcoinpay/core/blockchain"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/core/types/pow"
+	"github.com/btceasypay/bitcoinpay/crypto/ecc"
+	"github.com/btceasypay/bitcoinpay/database"
+	_ "github.com/btceasypay/bitcoinpay/database/ffldb"
+	"github.com/btceasypay/bitcoinpay/engine/txscript"
+	"github.com/btceasypay/bitcoinpay/params"
+)
+
+// testAddr returns a pay-to-pubkey-hash address of the private network and
+// the script paying to it.
+func testAddr(t *testing.T, b byte) (types.Address, []byte) {
+	h160 := make([]byte, 20)
+	h160[0] = b
+	addr, err := address.NewPubKeyHashAddress(h160, &params.PrivNetParams, ecc.ECDSA_Secp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return addr, script
+}
+
+// newTestDB creates a database in a temporary directory.
+func newTestDB(t *testing.T) (database.DB, func()) {
+	dir, err := ioutil.TempDir("", "acct")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := database.Create("ffldb", filepath.Join(dir, "db"), params.PrivNetParams.Net)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// newTestTx returns a transaction spending the outpoints and paying the
+// amounts to the scripts.
+func newTestTx(ins []*types.TxOutPoint, scripts [][]byte, amounts []uint64) *types.Tx {
+	tx := types.NewTransaction()
+	for _, in := range ins {
+		tx.AddTxIn(types.NewTxInput(in, nil))
+	}
+	for i, script := range scripts {
+		tx.AddTxOut(types.NewTxOutput(amounts[i], script))
+	}
+	return types.NewTx(tx)
+}
+
+// newTestBlock returns a block with the transactions at the order.
+func newTestBlock(order uint64, txs ...*types.Tx) *types.SerializedBlock {
+	msgBlock := &types.Block{
+		Header: types.BlockHeader{Pow: pow.GetInstance(pow.BLAKE2BD, uint32(order), []byte{})},
+	}
+	for _, tx := range txs {
+		msgBlock.Transactions = append(msgBlock.Transactions, tx.Transaction())
+	}
+	block := types.NewBlock(msgBlock)
+	block.SetOrder(order)
+	return block
+}
+
+func TestAccountIndex(t *testing.T) {
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	addr1, script1 := testAddr(t, 1)
+	_, script2 := testAddr(t, 2)
+	a, err := New(db, &params.PrivNetParams, []types.Address{addr1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	watched := addr1.Encode()
+	if err := db.Update(a.Create); err != nil {
+		t.Fatal(err)
+	}
+
+	coinbase1 := newTestTx([]*types.TxOutPoint{types.NewOutPoint(&hash.ZeroHash, ^uint32(0))},
+		[][]byte{script1, script2}, []uint64{50, 10})
+	block1 := newTestBlock(0, coinbase1)
+
+	coinbase2 := newTestTx([]*types.TxOutPoint{types.NewOutPoint(&hash.ZeroHash, ^uint32(0))},
+		[][]byte{script2}, []uint64{50})
+	spend := newTestTx([]*types.TxOutPoint{types.NewOutPoint(coinbase1.Hash(), 0)},
+		[][]byte{script1, script2}, []uint64{20, 30})
+	block2 := newTestBlock(1, coinbase2, spend)
+	stxos := []blockchain.SpentTxOut{{Amount: 50, PkScript: script1, IsCoinBase: true}}
+
+	err = db.Update(func(dbTx database.Tx) error {
+		if err := a.ConnectBlock(dbTx, block1, nil); err != nil {
+			return err
+		}
+		return a.ConnectBlock(dbTx, block2, stxos)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outs, err := a.fetchOuts(watched)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outs) != 2 {
+		t.Fatalf("got %d outputs, want 2", len(outs))
+	}
+	out := outs[*types.NewOutPoint(coinbase1.Hash(), 0)]
+	if out == nil || out.amount != 50 || out.order != 0 || !out.coinbase {
+		t.Fatalf("unexpected coinbase output %+v", out)
+	}
+	out = outs[*types.NewOutPoint(spend.Hash(), 0)]
+	if out == nil || out.amount != 20 || out.order != 1 || out.coinbase {
+		t.Fatalf("unexpected output %+v", out)
+	}
+
+	history, err := a.fetchHistory(watched)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("got %d history entries, want 2", len(history))
+	}
+	if history[0].txHash != *coinbase1.Hash() || history[0].received != 50 || history[0].sent != 0 {
+		t.Fatalf("unexpected first history entry %+v", history[0])
+	}
+	if history[1].txHash != *spend.Hash() || history[1].received != 20 || history[1].sent != 50 {
+		t.Fatalf("unexpected second history entry %+v", history[1])
+	}
+
+	// Disconnecting the block removes everything it recorded.
+	err = db.Update(func(dbTx database.Tx) error {
+		return a.DisconnectBlock(dbTx, block2, stxos)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	outs, err = a.fetchOuts(watched)
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err = a.fetchHistory(watched)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outs) != 1 || len(history) != 1 {
+		t.Fatalf("got %d outputs and %d history entries after disconnect, want 1 and 1",
+			len(outs), len(history))
+	}
+
+	// Watching another set of addresses drops the index so it is rebuilt.
+	addr2, _ := testAddr(t, 2)
+	if _, err := New(db, &params.PrivNetParams, []types.Address{addr1, addr2}); err != nil {
+		t.Fatal(err)
+	}
+	outs, err = a.fetchOuts(watched)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outs) != 0 {
+		t.Fatalf("got %d outputs after changing the watched addresses, want 0", len(outs))
+	}
+}
+
+func TestAccountUnconfirmed(t *testing.T) {
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	addr1, script1 := testAddr(t, 1)
+	_, script2 := testAddr(t, 2)
+	a, err := New(db, &params.PrivNetParams, []types.Address{addr1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	watched := addr1.Encode()
+
+	funding := newTestTx([]*types.TxOutPoint{types.NewOutPoint(&hash.ZeroHash, 1)},
+		[][]byte{script1}, []uint64{100})
+	view := blockchain.NewUtxoViewpoint()
+	view.AddTxOuts(funding, &hash.ZeroHash)
+
+	spend := newTestTx([]*types.TxOutPoint{types.NewOutPoint(funding.Hash(), 0)},
+		[][]byte{script2, script1}, []uint64{60, 30})
+	a.AddUnconfirmedTx(spend, view)
+
+	received, sent := a.unconfirmedBalance(watched)
+	if received != 30 || sent != 100 {
+		t.Fatalf("got received %d sent %d, want 30 and 100", received, sent)
+	}
+	op := *types.NewOutPoint(funding.Hash(), 0)
+	if !a.isSpentByMempool(op) {
+		t.Fatal("output spent by the memory pool is not tracked")
+	}
+
+	// Transactions not involving the watched addresses are ignored.
+	other := newTestTx([]*types.TxOutPoint{types.NewOutPoint(&hash.ZeroHash, 2)},
+		[][]byte{script2}, []uint64{10})
+	a.AddUnconfirmedTx(other, view)
+	if len(a.unconfirmed) != 1 {
+		t.Fatalf("got %d unconfirmed transactions, want 1", len(a.unconfirmed))
+	}
+
+	a.RemoveUnconfirmedTx(spend.Hash())
+	received, sent = a.unconfirmedBalance(watched)
+	if received != 0 || sent != 0 || a.isSpentByMempool(op) {
+		t.Fatal("removed transaction is still tracked")
+	}
+}
@@ -1,16 +1,151 @@
 package acct
 
-// PublicEthereumAPI provides an API to access Ethereum full node-related
-// information.
+import (
+	"encoding/hex"
+
+	"github.com/btceasypay/bitcoinpay/core/blockchain"
+	"github.com/btceasypay/bitcoinpay/core/json"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/rpc"
+)
+
+// defaultMinConf is the default number of confirmations an output needs to
+// count in the confirmed balance.
+const defaultMinConf = 1
+
+// PublicAccountManagerAPI provides an API to access the balances, the unspent
+// outputs and the history of the watched addresses.
 type PublicAccountManagerAPI struct {
 	a *AccountManager
 }
 
-// NewPublicEthereumAPI creates a new Ethereum protocol API for full nodes.
+// NewPublicAccountManagerAPI creates a new API for the account manager.
 func NewPublicAccountManagerAPI(a *AccountManager) *PublicAccountManagerAPI {
 	return &PublicAccountManagerAPI{a}
 }
 
-func (api *PublicAccountManagerAPI) GetBalance() int32 {
-	return 0
+// checkWatched returns an error when the address is not watched.
+func (api *PublicAccountManagerAPI) checkWatched(addr string) error {
+	if !api.a.IsWatched(addr) {
+		return rpc.RpcInvalidError("Address %s is not watched, use --watchaddr", addr)
+	}
+	return nil
+}
+
+// GetBalance returns the balance of the watched address.  The confirmed
+// balance includes the outputs with at least minConf confirmations, the
+// spendable one only the mature outputs not spent by the memory pool, and
+// the unconfirmed one is the net amount of the memory pool transactions.
+func (api *PublicAccountManagerAPI) GetBalance(addr string, minConf *uint) (interface{}, error) {
+	if err := api.checkWatched(addr); err != nil {
+		return nil, err
+	}
+	min := uint(defaultMinConf)
+	if minConf != nil {
+		min = *minConf
+	}
+	unspent, err := api.a.unspent(addr)
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Account balance")
+	}
+	var confirmed, spendable uint64
+	for _, u := range unspent {
+		if u.confirmations < min {
+			continue
+		}
+		confirmed += u.amount
+		if u.spendable {
+			spendable += u.amount
+		}
+	}
+	received, sent := api.a.unconfirmedBalance(addr)
+	return json.GetBalanceResult{
+		Address:     addr,
+		Confirmed:   types.Amount(confirmed).ToUnit(types.AmountCoin),
+		Spendable:   types.Amount(spendable).ToUnit(types.AmountCoin),
+		Unconfirmed: types.Amount(int64(received) - int64(sent)).ToUnit(types.AmountCoin),
+	}, nil
+}
+
+// ListUnspent returns the unspent outputs of the watched addresses with
+// between minConf and maxConf confirmations.  All watched addresses are listed
+// when addrs is empty.
+func (api *PublicAccountManagerAPI) ListUnspent(minConf *uint, maxConf *uint, addrs []string) (interface{}, error) {
+	min := uint(defaultMinConf)
+	if minConf != nil {
+		min = *minConf
+	}
+	if len(addrs) == 0 {
+		addrs = api.a.watchedList()
+	}
+	result := []json.ListUnspentResult{}
+	for _, addr := range addrs {
+		if err := api.checkWatched(addr); err != nil {
+			return nil, err
+		}
+		unspent, err := api.a.unspent(addr)
+		if err != nil {
+			return nil, rpc.RpcInternalError(err.Error(), "List unspent")
+		}
+		for _, u := range unspent {
+			if u.confirmations < min || (maxConf != nil && u.confirmations > *maxConf) {
+				continue
+			}
+			result = append(result, json.ListUnspentResult{
+				TxId:          u.outPoint.Hash.String(),
+				Vout:          u.outPoint.OutIndex,
+				Address:       addr,
+				ScriptPubKey:  hex.EncodeToString(u.pkScript),
+				Amount:        types.Amount(u.amount).ToUnit(types.AmountCoin),
+				Confirmations: int64(u.confirmations),
+				Coinbase:      u.coinbase,
+				Spendable:     u.spendable,
+			})
+		}
+	}
+	return result, nil
+}
+
+// GetAddressHistory returns the confirmed transactions involving the watched
+// address in DAG order, skipping the first skip ones and returning at most
+// count of them.
+func (api *PublicAccountManagerAPI) GetAddressHistory(addr string, skip *uint, count *uint) (interface{}, error) {
+	if err := api.checkWatched(addr); err != nil {
+		return nil, err
+	}
+	history, err := api.a.fetchHistory(addr)
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Address history")
+	}
+	if skip != nil {
+		if *skip >= uint(len(history)) {
+			history = nil
+		} else {
+			history = history[*skip:]
+		}
+	}
+	if count != nil && *count < uint(len(history)) {
+		history = history[:*count]
+	}
+	result := make([]json.AddressHistoryResult, 0, len(history))
+	for _, e := range history {
+		r := json.AddressHistoryResult{
+			TxId:     e.txHash.String(),
+			Order:    uint64(e.order),
+			Received: types.Amount(e.received).ToUnit(types.AmountCoin),
+			Sent:     types.Amount(e.sent).ToUnit(types.AmountCoin),
+		}
+		if api.a.chain != nil {
+			bd := api.a.chain.BlockDAG()
+			if h := bd.GetBlockByOrder(uint(e.order)); h != nil {
+				if ib := bd.GetBlock(h); ib != nil {
+					r.BlockHash = h.String()
+					r.Confirmations = int64(bd.GetConfirmations(ib.GetID()))
+					r.Txsvalid = !blockchain.BlockStatus(ib.GetStatus()).KnownInvalid()
+				}
+			}
+		}
+		result = append(result, r)
+	}
+	return result, nil
 }
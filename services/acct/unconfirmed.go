@@ -0,0 +1,126 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+//
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package acct
+
+import (
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/blockchain"
+	"github.com/btceasypay/bitcoinpay/core/types"
+)
+
+// unconfirmedTx is a transaction of the memory pool involving the watched
+// addresses.
+type unconfirmedTx struct {
+	// received and sent map the encoded addresses to the amounts the
+	// transaction pays to and spends from them.
+	received map[string]uint64
+	sent     map[string]uint64
+
+	// spends are the watched outputs spent by the transaction.
+	spends []types.TxOutPoint
+}
+
+// AddUnconfirmedTx records the amounts the transaction pays to and spends
+// from the watched addresses.
+//
+// NOTE: This transaction MUST have already been validated by the memory pool
+// before calling this function with it and have all of the inputs available in
+// the provided utxo view.
+//
+// This function is safe for concurrent access.
+func (a *AccountManager) AddUnconfirmedTx(tx *types.Tx, utxoView *blockchain.UtxoViewpoint) {
+	if !a.Enabled() {
+		return
+	}
+	utx := &unconfirmedTx{
+		received: make(map[string]uint64),
+		sent:     make(map[string]uint64),
+	}
+	msgTx := tx.Transaction()
+	for _, txIn := range msgTx.TxIn {
+		entry := utxoView.LookupEntry(txIn.PreviousOut)
+		if entry == nil {
+			// Ignore missing entries.  This should never happen
+			// in practice since the function comments specifically
+			// call out all inputs must be available.
+			continue
+		}
+		addrs := a.watchedAddrs(entry.PkScript())
+		if len(addrs) == 0 {
+			continue
+		}
+		amount := entry.Amount()
+		if entry.IsCoinBase() && txIn.PreviousOut.OutIndex == 0 && a.chain != nil {
+			amount += uint64(a.chain.GetFees(entry.BlockHash()))
+		}
+		for _, addr := range addrs {
+			utx.sent[addr] += amount
+		}
+		utx.spends = append(utx.spends, txIn.PreviousOut)
+	}
+	for _, txOut := range msgTx.TxOut {
+		for _, addr := range a.watchedAddrs(txOut.PkScript) {
+			utx.received[addr] += txOut.Amount
+		}
+	}
+	if len(utx.received) == 0 && len(utx.sent) == 0 {
+		return
+	}
+
+	a.unconfirmedLock.Lock()
+	a.unconfirmed[*tx.Hash()] = utx
+	for _, op := range utx.spends {
+		a.spentByMempool[op] = *tx.Hash()
+	}
+	a.unconfirmedLock.Unlock()
+}
+
+// RemoveUnconfirmedTx removes the passed transaction from the unconfirmed
+// state of the watched addresses.
+//
+// This function is safe for concurrent access.
+func (a *AccountManager) RemoveUnconfirmedTx(txHash *hash.Hash) {
+	a.unconfirmedLock.Lock()
+	defer a.unconfirmedLock.Unlock()
+
+	utx, ok := a.unconfirmed[*txHash]
+	if !ok {
+		return
+	}
+	for _, op := range utx.spends {
+		if spender, ok := a.spentByMempool[op]; ok && spender == *txHash {
+			delete(a.spentByMempool, op)
+		}
+	}
+	delete(a.unconfirmed, *txHash)
+}
+
+// unconfirmedBalance returns the amounts the transactions of the memory pool
+// pay to and spend from the address.
+//
+// This function is safe for concurrent access.
+func (a *AccountManager) unconfirmedBalance(addr string) (received uint64, sent uint64) {
+	a.unconfirmedLock.RLock()
+	defer a.unconfirmedLock.RUnlock()
+
+	for _, utx := range a.unconfirmed {
+		received += utx.received[addr]
+		sent += utx.sent[addr]
+	}
+	return received, sent
+}
+
+// isSpentByMempool returns whether a transaction of the memory pool spends
+// the output.
+//
+// This function is safe for concurrent access.
+func (a *AccountManager) isSpentByMempool(op types.TxOutPoint) bool {
+	a.unconfirmedLock.RLock()
+	defer a.unconfirmedLock.RUnlock()
+
+	_, ok := a.spentByMempool[op]
+	return ok
+}
@@ -3,10 +3,11 @@
 package address
 
 import (
-	"github.com/btceasypay/bitcoinpay/common/encode/base58"
 	"github.com/btceasypay/bitcoinpay/config"
+	"github.com/btceasypay/bitcoinpay/core/address"
 	"github.com/btceasypay/bitcoinpay/params"
 	"github.com/btceasypay/bitcoinpay/rpc"
+	"strings"
 	"sync"
 )
 
@@ -42,8 +43,8 @@ func (c *AddressApi) APIs() []rpc.API {
 	}
 }
 
-func (api *PublicAddressAPI) CheckAddress(address string, network string) (interface{}, error) {
-	_, ver, err := base58.BitcoinpayCheckDecode(address)
+func (api *PublicAddressAPI) CheckAddress(addr string, network string) (interface{}, error) {
+	a, err := address.DecodeAddress(addr)
 	if err != nil {
 		return false, rpc.RpcInvalidError("Invalid address :" + err.Error())
 	}
@@ -60,9 +61,13 @@ func (api *PublicAddressAPI) CheckAddress(address string, network string) (inter
 	default:
 		return false, rpc.RpcInvalidError("Invalid network : privnet | testnet | mainnet | mixnet")
 	}
-	if p.PubKeyHashAddrID != ver {
+	if !address.IsForNetwork(a, p) {
+		prefix, actual := p.NetworkAddressPrefix, addr[0:1]
+		if address.IsBech32(a) {
+			prefix, actual = p.Bech32HRP, strings.ToLower(addr[:strings.LastIndexByte(addr, '1')])
+		}
 		return false, rpc.RpcRuleError("address prefix error , need %s , actual: %s,network not match,please check it",
-			p.NetworkAddressPrefix, address[0:1])
+			prefix, actual)
 	}
 	return true, nil
 }
@@ -415,3 +415,70 @@ func (api *PublicBlockAPI) GetCoinbase(h hash.Hash, verbose *bool) (interface{},
 func (api *PublicBlockAPI) GetFees(h hash.Hash) (interface{}, error) {
 	return api.bm.chain.GetFees(&h), nil
 }
+
+// GetDeploymentInfo returns the deployments voted on by the blocks, their state
+// for the next block and the version of the next block.
+func (api *PublicBlockAPI) GetDeploymentInfo() (interface{}, error) {
+	deployments, err := api.bm.chain.Deployments()
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Deployments")
+	}
+	version, err := api.bm.chain.CalcNextBlockVersion()
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Block version")
+	}
+	result := &json.GetDeploymentInfoResult{
+		BlockVersion: version,
+		Deployments:  make([]json.DeploymentResult, 0, len(deployments)),
+	}
+	for _, d := range deployments {
+		result.Deployments = append(result.Deployments, json.DeploymentResult{
+			ID:         d.ID,
+			Bit:        d.BitNumber,
+			StartTime:  d.StartTime,
+			ExpireTime: d.ExpireTime,
+			Status:     deploymentStatus[d.State],
+		})
+	}
+	return result, nil
+}
+
+// deploymentStatus maps the threshold states to the status of the deployments
+// returned by the RPCs.
+var deploymentStatus = map[blockchain.ThresholdState]string{
+	blockchain.ThresholdDefined:  "defined",
+	blockchain.ThresholdStarted:  "started",
+	blockchain.ThresholdLockedIn: "lockedin",
+	blockchain.ThresholdActive:   "active",
+	blockchain.ThresholdFailed:   "failed",
+}
+
+// GetUtxoRoot returns the utxo commitment root after the block with the order
+// was connected.
+func (api *PublicBlockAPI) GetUtxoRoot(order uint64) (interface{}, error) {
+	root, err := api.bm.chain.UtxoRoot(order)
+	if err != nil {
+		return nil, rpc.RpcInvalidError("%v", err)
+	}
+	return root.String(), nil
+}
+
+// GetUtxoProof returns the Merkle proof of the output against the current utxo
+// commitment root.  The serialized utxo entry is only included when the output
+// is unspent.
+func (api *PublicBlockAPI) GetUtxoProof(txHash hash.Hash, vout uint32) (interface{}, error) {
+	proof, err := api.bm.chain.UtxoProof(types.TxOutPoint{Hash: txHash, OutIndex: vout})
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Utxo proof")
+	}
+	result := &json.UtxoProofResult{
+		Order: proof.Order,
+		Root:  proof.Root.String(),
+		Entry: hex.EncodeToString(proof.Entry),
+		Proof: make([]string, 0, len(proof.Proof)),
+	}
+	for _, node := range proof.Proof {
+		result.Proof = append(result.Proof, hex.EncodeToString(node))
+	}
+	return result, nil
+}
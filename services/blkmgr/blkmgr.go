@@ -36,6 +36,10 @@ const (
 	// maxStallDuration is the time after which we will disconnect our
 	// current sync peer if we haven't made progress.
 	MaxBlockStallDuration = 3 * time.Second
+
+	// feeEstimatorSaveInterval is the number of blocks after which the fee
+	// estimator is saved, so little of it is lost when the node crashes.
+	feeEstimatorSaveInterval = 100
 )
 
 // BlockManager provides a concurrency safe block manager for handling all
@@ -86,6 +90,12 @@ type BlockManager struct {
 
 	//tx manager
 	txManager TxManager
+
+	// utxo snapshot sync, the peer and the start of the chunk that was
+	// requested last.
+	utxoSnapshotPeer *peer.ServerPeer
+	utxoSnapshotReq  hash.Hash
+	utxoSnapshotTime time.Time
 }
 
 // NewBlockManager returns a new block manager.
@@ -148,6 +158,12 @@ func NewBlockManager(ntmgr notify.Notify, indexManager blockchain.IndexManager,
 		return nil, fmt.Errorf("closing after dumping blockchain")
 	}
 
+	if cfg.SnapshotSync {
+		if err := bm.startUtxoSnapshot(); err != nil {
+			return nil, err
+		}
+	}
+
 	bm.dagSync.GSMtx.Lock()
 	bm.dagSync.GS = best.GraphState
 	bm.dagSync.GSMtx.Unlock()
@@ -159,6 +175,10 @@ func NewBlockManager(ntmgr notify.Notify, indexManager blockchain.IndexManager,
 // handleNotifyMsg handles notifications from blockchain.  It does things such
 // as request orphan block parents and relay accepted blocks to connected peers.
 func (b *BlockManager) handleNotifyMsg(notification *blockchain.Notification) {
+	// Notify the rpc subscribers first, they receive every event whether we
+	// are current or not.
+	b.notify.NotifyBlockChain(notification)
+
 	switch notification.Type {
 	// A block has been accepted into the block chain.  Relay it to other peers
 	// and possibly notify RPC clients with the winning tickets.
@@ -176,6 +196,7 @@ func (b *BlockManager) handleNotifyMsg(notification *blockchain.Notification) {
 			b.lastProgressTime = time.Now()
 		}
 		b.zmqNotify.BlockAccepted(block)
+		b.notify.NotifyGraphState(b.chain.BestSnapshot().GraphState)
 		// Don't relay if we are not current. Other peers that are current
 		// should already know about it
 		if !b.current() {
@@ -230,6 +251,15 @@ func (b *BlockManager) handleNotifyMsg(notification *blockchain.Notification) {
 		}
 
 		block := blockSlice[0]
+		// Record how long the mined transactions waited in the pool for
+		// the fee estimation, before they are removed from it.
+		b.GetTxManager().FeeEstimator().RegisterBlock(block)
+		if b.chain.BestSnapshot().GraphState.GetTotal()%feeEstimatorSaveInterval == 0 {
+			if err := b.GetTxManager().SaveFeeEstimator(); err != nil {
+				log.Error(fmt.Sprintf("Failed to save the fee estimator: %v", err))
+			}
+		}
+
 		// Remove all of the transactions (except the coinbase) in the
 		// connected block from the transaction pool.  Secondly, remove any
 		// transactions which are now double spends as a result of these
@@ -245,13 +275,6 @@ func (b *BlockManager) handleNotifyMsg(notification *blockchain.Notification) {
 			b.notify.AnnounceNewTransactions(acceptedTxs)
 		}
 
-		/*
-			if r := b.server.rpcServer; r != nil {
-				// Notify registered websocket clients of incoming block.
-				r.ntfnMgr.NotifyBlockConnected(block)
-			}
-		*/
-
 		b.zmqNotify.BlockConnected(block)
 
 	// A block has been disconnected from the main block chain.
@@ -519,6 +542,11 @@ out:
 				score := b.handleBlockMsg(msg)
 				log.Trace("notify syncPeer BlockProcessed done")
 				msg.peer.BlockProcessed <- score
+				b.maybeRequestUtxoSnapshot()
+			case *utxoSnapshotMsg:
+				log.Trace("blkmgr msgChan utxoSnapshotMsg", "msg", msg)
+				score := b.handleUtxoSnapshotMsg(msg)
+				msg.peer.BlockProcessed <- score
 			case *invMsg:
 				log.Trace("blkmgr msgChan invMsg", "msg", msg)
 				b.handleInvMsg(msg)
@@ -632,12 +660,18 @@ out:
 
 		case <-stallTicker.C:
 			b.handleStallSample()
+			b.maybeRequestUtxoSnapshot()
 
 		case <-b.quit:
 			log.Trace("blkmgr quit received, break out")
 			break out
 		}
 	}
+	// Keep the state of the consensus algorithm, so it isn't recalculated
+	// on the next start.
+	if err := b.chain.FlushDAGInfo(); err != nil {
+		log.Error("Failed to write the DAG info", "error", err)
+	}
 	b.wg.Done()
 	log.Trace("Block handler done")
 }
@@ -1054,6 +1088,11 @@ func (b *BlockManager) GetTxManager() TxManager {
 	return b.txManager
 }
 
+// ZMQNotify returns the ZeroMQ notification of the block manager.
+func (b *BlockManager) ZMQNotify() zmq.IZMQNotification {
+	return b.zmqNotify
+}
+
 // headerNode is used as a node in a list of headers that are linked together
 // between checkpoints.
 type headerNode struct {
@@ -33,6 +33,9 @@ func (b *BlockManager) handleNewPeerMsg(sp *peer.ServerPeer) {
 	if sp.SyncCandidate && b.syncPeer == nil {
 		b.startSync()
 	}
+	// Ask the new peer for the utxo snapshot if no other peer was.
+	b.maybeRequestUtxoSnapshot()
+
 	// Grab the mining state from this peer after we're synced.
 	if b.config.MiningStateSync {
 		b.syncMiningStateAfterSync(sp)
@@ -60,6 +63,10 @@ func (b *BlockManager) handleDonePeerMsg(sp *peer.ServerPeer) {
 		// peer before signaling to the sync manager.
 		b.updateSyncPeer(false)
 	}
+	if b.utxoSnapshotPeer == sp {
+		b.utxoSnapshotPeer = nil
+		b.maybeRequestUtxoSnapshot()
+	}
 }
 
 // isSyncCandidate returns whether or not the peer is a candidate to consider
@@ -12,6 +12,17 @@ import (
 
 type TxManager interface {
 	MemPool() TxPool
+
+	FeeEstimator() FeeEstimator
+
+	// SaveFeeEstimator saves the state of the fee estimator in the database.
+	SaveFeeEstimator() error
+}
+
+// FeeEstimator observes the blocks connected to the main chain to estimate
+// the fees of the transactions.
+type FeeEstimator interface {
+	RegisterBlock(block *types.SerializedBlock)
 }
 
 type TxPool interface {
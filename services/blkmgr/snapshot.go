@@ -0,0 +1,164 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blkmgr
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/btceasypay/bitcoinpay/core/blockchain"
+	"github.com/btceasypay/bitcoinpay/core/message"
+	"github.com/btceasypay/bitcoinpay/core/protocol"
+	"github.com/btceasypay/bitcoinpay/p2p/connmgr"
+	"github.com/btceasypay/bitcoinpay/p2p/peer"
+)
+
+// utxoSnapshotTimeout is how long a peer has to answer a request for a chunk
+// of a utxo snapshot before it is asked from another peer.
+const utxoSnapshotTimeout = time.Minute
+
+// startUtxoSnapshot makes the chain sync from the utxo snapshot given with
+// --snapshotpoint, or else the one of the latest checkpoint.  The blocks up to
+// the snapshot are still downloaded as usual, the utxo set is asked for once
+// its block is ordered.
+func (b *BlockManager) startUtxoSnapshot() error {
+	block, root := b.config.GetSnapshotPoint()
+	if block == nil {
+		checkpoint := b.chain.LatestCheckpoint()
+		if checkpoint == nil || checkpoint.UtxoRoot == nil {
+			log.Warn("No checkpoint with a utxo root, syncing without a utxo snapshot")
+			return nil
+		}
+		block, root = checkpoint.Hash, checkpoint.UtxoRoot
+	}
+	if !b.chain.UtxoSnapshotPending() && b.chain.BestSnapshot().GraphState.GetTotal() > 1 {
+		log.Info("The chain has blocks, syncing without a utxo snapshot")
+		return nil
+	}
+	return b.chain.StartUtxoSnapshot(block, root)
+}
+
+// maybeRequestUtxoSnapshot asks a peer for the next chunk of the utxo snapshot
+// once its block is ordered.  A request that is not answered in time is sent
+// to another peer.
+func (b *BlockManager) maybeRequestUtxoSnapshot() {
+	if atomic.LoadInt32(&b.shutdown) != 0 {
+		return
+	}
+	avoid := b.utxoSnapshotPeer
+	if avoid != nil {
+		if time.Since(b.utxoSnapshotTime) < utxoSnapshotTimeout {
+			return
+		}
+		log.Debug(fmt.Sprintf("Asking another peer for the utxo snapshot chunk "+
+			"requested from %s", avoid))
+		b.utxoSnapshotPeer = nil
+	}
+	block, start, ok := b.chain.UtxoSnapshotRequest()
+	if !ok {
+		return
+	}
+
+	// Prefer the sync peer, it has the block of the snapshot.
+	var sp *peer.ServerPeer
+	for _, p := range b.peers {
+		if p.Services()&protocol.UtxoSnapshot != protocol.UtxoSnapshot {
+			continue
+		}
+		if sp == nil || sp == avoid || p == b.syncPeer && p != avoid {
+			sp = p
+		}
+	}
+	if sp == nil {
+		return
+	}
+	b.utxoSnapshotPeer = sp
+	b.utxoSnapshotReq = start
+	b.utxoSnapshotTime = time.Now()
+	sp.QueueMessage(message.NewMsgGetUtxoSnapshot(&block, &start), nil)
+}
+
+// utxoSnapshotMsg packages a utxosnap message and the peer it came from
+// together so the block handler has access to that information.
+type utxoSnapshotMsg struct {
+	snap *message.MsgUtxoSnapshot
+	peer *peer.ServerPeer
+}
+
+// QueueUtxoSnapshot adds the passed utxosnap message and peer to the block
+// handling queue.
+func (b *BlockManager) QueueUtxoSnapshot(snap *message.MsgUtxoSnapshot, sp *peer.ServerPeer) {
+	// Don't accept more chunks if we're shutting down.
+	if atomic.LoadInt32(&b.shutdown) != 0 {
+		sp.BlockProcessed <- connmgr.NoneScore
+		return
+	}
+	b.msgChan <- &utxoSnapshotMsg{snap: snap, peer: sp}
+}
+
+// handleUtxoSnapshotMsg handles utxosnap messages from all peers.
+func (b *BlockManager) handleUtxoSnapshotMsg(msg *utxoSnapshotMsg) connmgr.BanScore {
+	snap := msg.snap
+	if msg.peer != b.utxoSnapshotPeer || snap.Start != b.utxoSnapshotReq {
+		log.Debug(fmt.Sprintf("Got unrequested utxo snapshot chunk from %s", msg.peer))
+		return connmgr.SlightScore
+	}
+
+	chunk := &blockchain.UtxoSnapshotChunk{
+		Root:    snap.Root,
+		Entries: make([]blockchain.UtxoSnapshotEntry, 0, len(snap.Entries)),
+		Done:    snap.Done,
+	}
+	for _, e := range snap.Entries {
+		chunk.Entries = append(chunk.Entries, blockchain.UtxoSnapshotEntry{
+			Key:   e.Key,
+			Entry: e.Entry,
+			Fees:  e.Fees,
+		})
+	}
+	loaded, err := b.chain.ProcessUtxoSnapshot(&snap.BlockHash, &snap.Start, chunk)
+	if err != nil {
+		if _, ok := err.(blockchain.RuleError); ok {
+			// Ask another peer for the chunk.
+			log.Warn("Rejected utxo snapshot chunk", "peer", msg.peer, "error", err)
+			b.utxoSnapshotTime = time.Time{}
+			b.maybeRequestUtxoSnapshot()
+			return connmgr.SeriousScore
+		}
+		log.Error("Failed to process utxo snapshot chunk", "error", err)
+		b.utxoSnapshotPeer = nil
+		return connmgr.NoneScore
+	}
+	b.utxoSnapshotPeer = nil
+	if !loaded {
+		b.maybeRequestUtxoSnapshot()
+	}
+	return connmgr.NoneScore
+}
+
+// ServeUtxoSnapshot returns the utxosnap message with the chunk of the utxo
+// snapshot asked for by the getutxosnap message.
+func (b *BlockManager) ServeUtxoSnapshot(req *message.MsgGetUtxoSnapshot) (*message.MsgUtxoSnapshot, error) {
+	chunk, err := b.chain.FetchUtxoSnapshot(&req.BlockHash, &req.Start,
+		message.MaxUtxoSnapshotEntriesPerMsg)
+	if err != nil {
+		return nil, err
+	}
+	msg := message.NewMsgUtxoSnapshot(&req.BlockHash, &req.Start, &chunk.Root)
+	msg.Done = chunk.Done
+	for i := range chunk.Entries {
+		e := &chunk.Entries[i]
+		err := msg.AddEntry(&message.UtxoSnapshotEntry{
+			Key:   e.Key,
+			Entry: e.Entry,
+			Fees:  e.Fees,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return msg, nil
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+
+package bloom
+
+import (
+	"testing"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/merkle"
+	"github.com/btceasypay/bitcoinpay/core/message"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/core/types/pow"
+)
+
+// TestMurmurHash3 ensures the MurmurHash3 function produces the correct hash
+// when given various seeds and data.
+func TestMurmurHash3(t *testing.T) {
+	var tests = []struct {
+		seed uint32
+		data []byte
+		out  uint32
+	}{
+		{0x00000000, []byte{}, 0x00000000},
+		{0xfba4c795, []byte{}, 0x6a396f08},
+		{0xffffffff, []byte{}, 0x81f16f39},
+		{0x00000000, []byte{0x00}, 0x514e28b7},
+		{0xfba4c795, []byte{0x00}, 0xea3f0b17},
+		{0x00000000, []byte{0xff}, 0xfd6cf10d},
+		{0x00000000, []byte{0x00, 0x11}, 0x16c6b7ab},
+		{0x00000000, []byte{0x00, 0x11, 0x22}, 0x8eb51c3d},
+		{0x00000000, []byte{0x00, 0x11, 0x22, 0x33}, 0xb4471bf8},
+		{0x00000000, []byte{0x00, 0x11, 0x22, 0x33, 0x44}, 0xe2301fa8},
+	}
+
+	for i, test := range tests {
+		result := MurmurHash3(test.seed, test.data)
+		if result != test.out {
+			t.Errorf("MurmurHash3 test #%d failed: got %v want %v",
+				i, result, test.out)
+		}
+	}
+}
+
+func TestFilterInsert(t *testing.T) {
+	f := NewFilter(3, 0, 0.01, message.BloomUpdateAll)
+
+	data := [][]byte{
+		{0x99, 0x10, 0x8a, 0xd8, 0xed},
+		{0xb5, 0xa2, 0xc7, 0x86, 0xd9},
+		{0xb9, 0x30, 0x06, 0x70, 0xb4},
+	}
+	for _, d := range data {
+		f.Add(d)
+	}
+	for _, d := range data {
+		if !f.Matches(d) {
+			t.Fatalf("filter does not match added data %x", d)
+		}
+	}
+	if f.Matches([]byte{0x19, 0x10, 0x8a, 0xd8, 0xed}) {
+		t.Fatal("filter matches data not added to it")
+	}
+
+	f.Unload()
+	if f.IsLoaded() || f.Matches(data[0]) {
+		t.Fatal("unloaded filter still matches")
+	}
+}
+
+// newTestTx returns a transaction spending the outpoint to the script.
+func newTestTx(prev *types.TxOutPoint, pkScript []byte) *types.Tx {
+	tx := types.NewTransaction()
+	tx.AddTxIn(types.NewTxInput(prev, nil))
+	tx.AddTxOut(types.NewTxOutput(1, pkScript))
+	return types.NewTx(tx)
+}
+
+func TestFilterMatchTx(t *testing.T) {
+	// A script pushing the 20 bytes of a public key hash.
+	pkHash := make([]byte, 20)
+	pkHash[0] = 0x42
+	pkScript := append([]byte{0x76, 0xa9, 0x14}, pkHash...)
+	pkScript = append(pkScript, 0x88, 0xac)
+
+	funding := newTestTx(types.NewOutPoint(&hash.ZeroHash, 1), pkScript)
+	spend := newTestTx(types.NewOutPoint(funding.Hash(), 0), []byte{0x51})
+	other := newTestTx(types.NewOutPoint(&hash.ZeroHash, 2), []byte{0x51})
+
+	f := NewFilter(10, 0, 0.0001, message.BloomUpdateAll)
+	f.Add(pkHash)
+	if !f.MatchTxAndUpdate(funding) {
+		t.Fatal("filter does not match the transaction paying to the data")
+	}
+	// The matched output is added, so the transaction spending it matches.
+	if !f.MatchesOutPoint(types.NewOutPoint(funding.Hash(), 0)) {
+		t.Fatal("matched outpoint not added to the filter")
+	}
+	if !f.MatchTxAndUpdate(spend) {
+		t.Fatal("filter does not match the transaction spending the matched output")
+	}
+	if f.MatchTxAndUpdate(other) {
+		t.Fatal("filter matches an unrelated transaction")
+	}
+
+	f = NewFilter(10, 0, 0.0001, message.BloomUpdateNone)
+	f.AddHash(other.Hash())
+	if !f.MatchTxAndUpdate(other) {
+		t.Fatal("filter does not match the transaction hash")
+	}
+}
+
+// merkleRootOf rebuilds the merkle root from the partial merkle tree of the
+// merkle block and returns the matched transaction hashes.
+func merkleRootOf(t *testing.T, msg *message.MsgMerkleBlock) (*hash.Hash, []*hash.Hash) {
+	m := merkleBlock{numTx: msg.Transactions}
+	height := uint32(0)
+	for m.calcTreeWidth(height) > 1 {
+		height++
+	}
+
+	var bitPos, hashPos int
+	var matched []*hash.Hash
+	var traverse func(height, pos uint32) *hash.Hash
+	traverse = func(height, pos uint32) *hash.Hash {
+		if bitPos >= len(msg.Flags)*8 {
+			t.Fatal("merkle block flags overflow")
+		}
+		isParent := msg.Flags[bitPos/8]&(1<<uint(bitPos%8)) != 0
+		bitPos++
+		if height == 0 || !isParent {
+			if hashPos >= len(msg.Hashes) {
+				t.Fatal("merkle block hashes overflow")
+			}
+			h := msg.Hashes[hashPos]
+			hashPos++
+			if height == 0 && isParent {
+				matched = append(matched, h)
+			}
+			return h
+		}
+		left := traverse(height-1, pos*2)
+		right := left
+		if pos*2+1 < m.calcTreeWidth(height-1) {
+			right = traverse(height-1, pos*2+1)
+		}
+		return merkle.HashMerkleBranches(left, right)
+	}
+	root := traverse(height, 0)
+	if hashPos != len(msg.Hashes) {
+		t.Fatalf("%d merkle block hashes left unused", len(msg.Hashes)-hashPos)
+	}
+	return root, matched
+}
+
+func TestMerkleBlock(t *testing.T) {
+	block := &types.Block{
+		Header: types.BlockHeader{Pow: pow.GetInstance(pow.BLAKE2BD, 0, []byte{})},
+	}
+	var txs []*types.Tx
+	for i := uint32(0); i < 7; i++ {
+		tx := newTestTx(types.NewOutPoint(&hash.ZeroHash, i), []byte{0x51})
+		txs = append(txs, tx)
+		block.Transactions = append(block.Transactions, tx.Tx)
+	}
+	merkles := merkle.BuildMerkleTreeStore(txs, false)
+	block.Header.TxRoot = *merkles[len(merkles)-1]
+
+	f := NewFilter(10, 0, 0.0001, message.BloomUpdateNone)
+	f.AddHash(txs[2].Hash())
+	f.AddHash(txs[6].Hash())
+
+	msg, indices := NewMerkleBlock(types.NewBlock(block), f)
+	if len(indices) != 2 || indices[0] != 2 || indices[1] != 6 {
+		t.Fatalf("got matched indices %v, want [2 6]", indices)
+	}
+	if msg.Transactions != 7 {
+		t.Fatalf("got %d transactions, want 7", msg.Transactions)
+	}
+
+	root, matched := merkleRootOf(t, msg)
+	if *root != block.Header.TxRoot {
+		t.Fatalf("got merkle root %v, want %v", root, block.Header.TxRoot)
+	}
+	if len(matched) != 2 || *matched[0] != txs[2].Tx.TxHash() ||
+		*matched[1] != txs[6].Tx.TxHash() {
+		t.Fatal("merkle block does not prove the matched transactions")
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package cf
+
+import "io"
+
+// bitWriter writes a stream of bits, most significant bit first.
+type bitWriter struct {
+	data []byte
+	// free is the number of unused bits of the last byte.
+	free uint
+}
+
+// writeBit appends a single bit to the stream.
+func (w *bitWriter) writeBit(bit bool) {
+	if w.free == 0 {
+		w.data = append(w.data, 0)
+		w.free = 8
+	}
+	w.free--
+	if bit {
+		w.data[len(w.data)-1] |= 1 << w.free
+	}
+}
+
+// writeBits appends the n least significant bits of v to the stream.
+func (w *bitWriter) writeBits(v uint64, n uint) {
+	for n > 0 {
+		n--
+		w.writeBit(v&(1<<n) != 0)
+	}
+}
+
+// bytes returns the written bits, the unused bits of the last byte are zero.
+func (w *bitWriter) bytes() []byte {
+	return w.data
+}
+
+// bitReader reads a stream of bits written by a bitWriter.
+type bitReader struct {
+	data []byte
+	// pos is the index of the next bit to read.
+	pos uint
+}
+
+// readBit returns the next bit of the stream.
+func (r *bitReader) readBit() (bool, error) {
+	if r.pos >= uint(len(r.data))*8 {
+		return false, io.EOF
+	}
+	bit := r.data[r.pos/8]&(0x80>>(r.pos%8)) != 0
+	r.pos++
+	return bit, nil
+}
+
+// readBits returns the next n bits of the stream.
+func (r *bitReader) readBits(n uint) (uint64, error) {
+	var v uint64
+	for i := uint(0); i < n; i++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		v <<= 1
+		if bit {
+			v |= 1
+		}
+	}
+	return v, nil
+}
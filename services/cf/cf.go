@@ -1 +1,77 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Copyright (c) 2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package cf implements the compact block filters of BIP157 and BIP158.
+//
+// A filter commits to the public key scripts created and spent by the
+// transactions of a block, so a light client can tell whether a block is
+// relevant to it without downloading the block.  The filter headers chain
+// the filters in DAG order, so a client can verify a filter against the
+// header of the previous order.
 package cf
+
+import (
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/engine/txscript"
+)
+
+const (
+	// DefaultP is the default collision probability (2^-19).
+	DefaultP = 19
+
+	// DefaultM is the default value used for the hash range.
+	DefaultM uint64 = 784931
+)
+
+// DeriveKey derives the filter key of a block from the first bytes of its
+// hash.
+func DeriveKey(h *hash.Hash) [KeySize]byte {
+	var key [KeySize]byte
+	copy(key[:], h[:KeySize])
+	return key
+}
+
+// BuildBasicFilter builds the basic filter of a block.  It includes every
+// public key script created by the transactions of the block, except the
+// data carrier ones, and the public key scripts of the outputs they spend.
+// The spent scripts are passed in the order of the inputs and are missing
+// for blocks whose transactions are invalid in the DAG.
+func BuildBasicFilter(block *types.SerializedBlock, prevOutScripts [][]byte) (*Filter, error) {
+	var data [][]byte
+	for _, tx := range block.Transactions() {
+		if tx.IsDuplicate {
+			continue
+		}
+		for _, txOut := range tx.Transaction().TxOut {
+			if len(txOut.PkScript) == 0 || txOut.PkScript[0] == txscript.OP_RETURN {
+				continue
+			}
+			data = append(data, txOut.PkScript)
+		}
+	}
+	for _, pkScript := range prevOutScripts {
+		if len(pkScript) == 0 {
+			continue
+		}
+		data = append(data, pkScript)
+	}
+	return BuildGCSFilter(DefaultP, DefaultM, DeriveKey(block.Hash()), data)
+}
+
+// MakeHeaderForFilter makes a filter chain header for a filter, given the
+// filter and the previous filter chain header.
+func MakeHeaderForFilter(filter *Filter, prevHeader *hash.Hash) hash.Hash {
+	return MakeHeaderForFilterHash(filter.Hash(), prevHeader)
+}
+
+// MakeHeaderForFilterHash makes a filter chain header for a filter, given
+// the filter hash and the previous filter chain header.
+func MakeHeaderForFilterHash(filterHash hash.Hash, prevHeader *hash.Hash) hash.Hash {
+	data := make([]byte, 2*hash.HashSize)
+	copy(data, filterHash[:])
+	copy(data[hash.HashSize:], prevHeader[:])
+	return hash.DoubleHashH(data)
+}
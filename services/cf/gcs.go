@@ -0,0 +1,258 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Copyright (c) 2016-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package cf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"sort"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	s "github.com/btceasypay/bitcoinpay/core/serialization"
+)
+
+const (
+	// KeySize is the size of the byte array required for key material for
+	// the SipHash keyed hash function.
+	KeySize = 16
+
+	// maxFilterItems is the maximum number of items a filter may hold.
+	maxFilterItems = 1<<32 - 1
+)
+
+var (
+	// ErrNTooBig signifies that the filter can't handle N items.
+	ErrNTooBig = errors.New("N is too big to fit in uint32")
+
+	// ErrPTooBig signifies that the filter can't handle `1/2**P`
+	// collision probability.
+	ErrPTooBig = errors.New("P is too big to fit in uint32")
+)
+
+// Filter describes an immutable Golomb-coded set filter as specified by
+// BIP158.  Items are hashed with SipHash-2-4 to the range [0, N*M), sorted,
+// and the differences between successive values are Golomb-Rice coded with
+// the parameter P.
+type Filter struct {
+	n          uint32
+	p          uint8
+	modulusNM  uint64
+	filterData []byte
+}
+
+// fastReduction maps v to the range [0, nm) without a division.
+func fastReduction(v uint64, nm uint64) uint64 {
+	hi, _ := bits.Mul64(v, nm)
+	return hi
+}
+
+// hashItem returns the value of the item in the range [0, nm).
+func hashItem(key [KeySize]byte, nm uint64, item []byte) uint64 {
+	k0 := binary.LittleEndian.Uint64(key[0:8])
+	k1 := binary.LittleEndian.Uint64(key[8:16])
+	return fastReduction(sipHash(k0, k1, item), nm)
+}
+
+// BuildGCSFilter builds a new GCS filter with the collision probability of
+// `1/(2**P)`, the false positive rate parameter M, key `key`, and including
+// every item of data.  Duplicate items are only added once.
+func BuildGCSFilter(P uint8, M uint64, key [KeySize]byte, data [][]byte) (*Filter, error) {
+	// Make sure the parameters will fit the hash function.
+	if uint64(len(data)) > maxFilterItems {
+		return nil, ErrNTooBig
+	}
+	if P > 32 {
+		return nil, ErrPTooBig
+	}
+
+	// Remove the duplicate items since they would be coded as a zero
+	// difference anyway.
+	seen := make(map[string]struct{}, len(data))
+	items := make([][]byte, 0, len(data))
+	for _, d := range data {
+		if _, ok := seen[string(d)]; ok {
+			continue
+		}
+		seen[string(d)] = struct{}{}
+		items = append(items, d)
+	}
+
+	f := Filter{
+		n: uint32(len(items)),
+		p: P,
+	}
+	f.modulusNM = uint64(f.n) * M
+
+	// Nothing to code if there are no items.
+	if f.n == 0 {
+		return &f, nil
+	}
+
+	values := make([]uint64, 0, len(items))
+	for _, item := range items {
+		values = append(values, hashItem(key, f.modulusNM, item))
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+	// Write the sorted list of values into the filter bitstream,
+	// compressing it using Golomb coding.
+	var w bitWriter
+	var lastValue uint64
+	for _, v := range values {
+		delta := v - lastValue
+		lastValue = v
+
+		// The quotient is written in unary, the remainder in P bits.
+		for q := delta >> P; q > 0; q-- {
+			w.writeBit(true)
+		}
+		w.writeBit(false)
+		w.writeBits(delta, uint(P))
+	}
+	f.filterData = w.bytes()
+	return &f, nil
+}
+
+// FromBytes deserializes a GCS filter from a known N, P, M and the
+// serialized filter as returned by Bytes().
+func FromBytes(N uint32, P uint8, M uint64, d []byte) (*Filter, error) {
+	if P > 32 {
+		return nil, ErrPTooBig
+	}
+	f := Filter{
+		n:          N,
+		p:          P,
+		modulusNM:  uint64(N) * M,
+		filterData: make([]byte, len(d)),
+	}
+	copy(f.filterData, d)
+	return &f, nil
+}
+
+// FromNBytes deserializes a GCS filter from a known P and M, and the
+// serialized filter as returned by NBytes().
+func FromNBytes(P uint8, M uint64, d []byte) (*Filter, error) {
+	r := bytes.NewReader(d)
+	n, err := s.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxFilterItems {
+		return nil, ErrNTooBig
+	}
+	return FromBytes(uint32(n), P, M, d[len(d)-r.Len():])
+}
+
+// Bytes returns the serialized format of the GCS filter, which does not
+// include N (but does include P and M).
+func (f *Filter) Bytes() []byte {
+	filterData := make([]byte, len(f.filterData))
+	copy(filterData, f.filterData)
+	return filterData
+}
+
+// NBytes returns the serialized format of the GCS filter with N, the format
+// used by the compact filter messages and stored by the filter index.
+func (f *Filter) NBytes() []byte {
+	var buf bytes.Buffer
+	buf.Grow(s.VarIntSerializeSize(uint64(f.n)) + len(f.filterData))
+	s.WriteVarInt(&buf, 0, uint64(f.n))
+	buf.Write(f.filterData)
+	return buf.Bytes()
+}
+
+// P returns the filter's collision probability as a negative power of 2
+// (that is, a collision probability of `1/2**20` is represented as 20).
+func (f *Filter) P() uint8 {
+	return f.p
+}
+
+// N returns the size of the data set used to build the filter.
+func (f *Filter) N() uint32 {
+	return f.n
+}
+
+// Hash returns the double hash of the serialized filter with N, which is
+// committed to by the filter header.
+func (f *Filter) Hash() hash.Hash {
+	return hash.DoubleHashH(f.NBytes())
+}
+
+// values returns a function which decodes the next value of the filter, it
+// returns io.EOF once all values are decoded.
+func (f *Filter) values() func() (uint64, error) {
+	r := bitReader{data: f.filterData}
+	var lastValue uint64
+	remaining := f.n
+	return func() (uint64, error) {
+		if remaining == 0 {
+			return 0, io.EOF
+		}
+		var q uint64
+		for {
+			bit, err := r.readBit()
+			if err != nil {
+				return 0, fmt.Errorf("corrupted filter: %v", err)
+			}
+			if !bit {
+				break
+			}
+			q++
+		}
+		rem, err := r.readBits(uint(f.p))
+		if err != nil {
+			return 0, fmt.Errorf("corrupted filter: %v", err)
+		}
+		remaining--
+		lastValue += q<<f.p | rem
+		return lastValue, nil
+	}
+}
+
+// Match checks whether a []byte value is likely (within collision
+// probability) to be a member of the set represented by the filter.
+func (f *Filter) Match(key [KeySize]byte, data []byte) (bool, error) {
+	return f.MatchAny(key, [][]byte{data})
+}
+
+// MatchAny returns checks whether any []byte value is likely (within
+// collision probability) to be a member of the set represented by the
+// filter faster than calling Match() for each value individually.
+func (f *Filter) MatchAny(key [KeySize]byte, data [][]byte) (bool, error) {
+	if f.n == 0 || len(data) == 0 {
+		return false, nil
+	}
+
+	// Create a sorted list of the hashed query values.
+	targets := make([]uint64, 0, len(data))
+	for _, d := range data {
+		targets = append(targets, hashItem(key, f.modulusNM, d))
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i] < targets[j] })
+
+	// Walk both sorted lists at once.
+	next := f.values()
+	value, err := next()
+	for _, target := range targets {
+		for err == nil && value < target {
+			value, err = next()
+		}
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if value == target {
+			return true, nil
+		}
+	}
+	return false, nil
+}
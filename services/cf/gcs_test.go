@@ -0,0 +1,142 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+
+package cf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+)
+
+// TestSipHash checks the hash function against the reference vectors of
+// SipHash-2-4, keyed with 00..0f and hashing the messages 00..(n-1).
+func TestSipHash(t *testing.T) {
+	var key [16]byte
+	for i := range key {
+		key[i] = byte(i)
+	}
+	k0 := binary.LittleEndian.Uint64(key[0:8])
+	k1 := binary.LittleEndian.Uint64(key[8:16])
+
+	tests := []uint64{
+		0x726fdb47dd0e0e31,
+		0x74f839c593dc67fd,
+		0x0d6c8009d9a94f5a,
+		0x85676696d7fb7e2d,
+	}
+	for n, want := range tests {
+		msg := make([]byte, n)
+		for i := range msg {
+			msg[i] = byte(i)
+		}
+		if got := sipHash(k0, k1, msg); got != want {
+			t.Errorf("sipHash of %d bytes: got %x, want %x", n, got, want)
+		}
+	}
+}
+
+func TestGCSFilter(t *testing.T) {
+	var key [KeySize]byte
+	copy(key[:], "bitcoinpay filter")
+
+	var contents [][]byte
+	for i := 0; i < 100; i++ {
+		contents = append(contents, []byte{byte(i), byte(i >> 8), 0xab})
+	}
+	// Duplicates are only counted once.
+	contents = append(contents, contents[0])
+
+	f, err := BuildGCSFilter(DefaultP, DefaultM, key, contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.N() != 100 {
+		t.Fatalf("got N %d, want 100", f.N())
+	}
+	if f.P() != DefaultP {
+		t.Fatalf("got P %d, want %d", f.P(), DefaultP)
+	}
+
+	for _, c := range contents {
+		match, err := f.Match(key, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !match {
+			t.Fatalf("filter does not match %x", c)
+		}
+	}
+	match, err := f.Match(key, []byte("not in the filter"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match {
+		t.Fatal("filter matches an item not added to it")
+	}
+	match, err = f.MatchAny(key, [][]byte{[]byte("missing"), contents[42]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !match {
+		t.Fatal("filter does not match any of the items")
+	}
+
+	// The serialized filter decodes to the same filter.
+	f2, err := FromNBytes(DefaultP, DefaultM, f.NBytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f2.N() != f.N() || !bytes.Equal(f2.Bytes(), f.Bytes()) || f2.Hash() != f.Hash() {
+		t.Fatal("deserialized filter differs from the original")
+	}
+	match, err = f2.Match(key, contents[7])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !match {
+		t.Fatal("deserialized filter does not match")
+	}
+}
+
+func TestEmptyFilter(t *testing.T) {
+	var key [KeySize]byte
+	f, err := BuildGCSFilter(DefaultP, DefaultM, key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.N() != 0 || len(f.Bytes()) != 0 {
+		t.Fatalf("got N %d and %d bytes, want an empty filter", f.N(), len(f.Bytes()))
+	}
+	match, err := f.Match(key, []byte{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match {
+		t.Fatal("empty filter matches")
+	}
+	if _, err := BuildGCSFilter(33, DefaultM, key, nil); err != ErrPTooBig {
+		t.Fatalf("got error %v, want %v", err, ErrPTooBig)
+	}
+}
+
+func TestFilterHeader(t *testing.T) {
+	var key [KeySize]byte
+	f, err := BuildGCSFilter(DefaultP, DefaultM, key, [][]byte{{1}, {2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var prev hash.Hash
+	header := MakeHeaderForFilter(f, &prev)
+
+	filterHash := f.Hash()
+	want := hash.DoubleHashH(append(filterHash[:], prev[:]...))
+	if header != want {
+		t.Fatalf("got header %v, want %v", header, want)
+	}
+	next := MakeHeaderForFilterHash(filterHash, &header)
+	if next == header {
+		t.Fatal("header does not commit to the previous header")
+	}
+}
@@ -1,7 +1,9 @@
 package common
 
 import (
+	"github.com/btceasypay/bitcoinpay/core/blockchain"
 	"github.com/btceasypay/bitcoinpay/engine/txscript"
+	"github.com/btceasypay/bitcoinpay/params"
 	"github.com/btceasypay/bitcoinpay/services/mempool"
 )
 
@@ -9,7 +11,17 @@ import (
 // executing transaction scripts to enforce additional checks which are required
 // for the script to be considered standard.  Note these flags are different
 // than what is required for the consensus rules in that they are more strict.
-func StandardScriptVerifyFlags() (txscript.ScriptFlags, error) {
+// OP_CHECKMULTISIGALT is only interpreted once its deployment is active.
+func StandardScriptVerifyFlags(chain *blockchain.BlockChain) (txscript.ScriptFlags, error) {
 	scriptFlags := mempool.BaseStandardVerifyFlags
+	active, err := chain.IsDeploymentActive(params.DeploymentCheckMultiSigAlt)
+	if err != nil {
+		if _, ok := err.(blockchain.DeploymentError); !ok {
+			return 0, err
+		}
+	}
+	if active {
+		scriptFlags |= txscript.ScriptVerifyCheckMultiSigAlt
+	}
 	return scriptFlags, nil
 }
@@ -3,6 +3,7 @@ package common
 import (
 	"fmt"
 	"github.com/btceasypay/bitcoinpay/config"
+	"github.com/btceasypay/bitcoinpay/core/blockchain"
 	"github.com/btceasypay/bitcoinpay/database"
 	"github.com/btceasypay/bitcoinpay/log"
 	"github.com/btceasypay/bitcoinpay/params"
@@ -46,6 +47,39 @@ func LoadBlockDB(cfg *config.Config) (database.DB, error) {
 			return nil, err
 		}
 	}
+
+	// The database of a chain synced from a utxo snapshot which turned out
+	// invalid is only removed when asked to, the chain is synced again
+	// from the blocks then.
+	invalid, err := blockchain.UtxoSnapshotInvalid(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if invalid && !cfg.DropSnapshot {
+		db.Close()
+		return nil, fmt.Errorf("the utxo snapshot the block database "+
+			"was synced from is invalid, restart with --dropsnapshot "+
+			"to delete the block database at '%s' and sync again "+
+			"from the blocks", dbPath)
+	}
+	if !invalid && cfg.DropSnapshot {
+		log.Warn("The block database was not synced from an invalid " +
+			"utxo snapshot, ignoring --dropsnapshot")
+	}
+	if invalid {
+		log.Warn("The utxo snapshot of the block database is invalid, " +
+			"syncing again from the blocks")
+		db.Close()
+		if err := removeBlockDB(dbPath); err != nil {
+			return nil, err
+		}
+		db, err = database.Create(cfg.DbType, dbPath, params.ActiveNetParams.Net)
+		if err != nil {
+			return nil, err
+		}
+		cfg.SnapshotSync = false
+	}
 	log.Info("Block database loaded")
 	return db, nil
 }
@@ -6,10 +6,13 @@ package common
 
 import (
 	"fmt"
+	"github.com/btceasypay/bitcoinpay/common/hash"
 	"github.com/btceasypay/bitcoinpay/common/util"
 	"github.com/btceasypay/bitcoinpay/config"
 	"github.com/btceasypay/bitcoinpay/core/address"
+	"github.com/btceasypay/bitcoinpay/database"
 	"github.com/btceasypay/bitcoinpay/log"
+	"github.com/btceasypay/bitcoinpay/metrics"
 	"github.com/btceasypay/bitcoinpay/p2p/peer"
 	"github.com/btceasypay/bitcoinpay/params"
 	"github.com/btceasypay/bitcoinpay/services/mempool"
@@ -33,6 +36,7 @@ const (
 	defaultBlockMinSize           = 0
 	defaultBlockMaxSize           = 375000
 	defaultMaxRPCClients          = 10
+	defaultMaxRPCWebsockets       = 25
 	defaultMaxPeers               = 125
 	defaultMiningStateSync        = false
 	defaultMaxInboundPeersPerHost = 10 // The default max total of inbound peer for host
@@ -73,9 +77,11 @@ func LoadConfig() (*config.Config, []string, error) {
 		RPCKey:            defaultRPCKeyFile,
 		RPCCert:           defaultRPCCertFile,
 		RPCMaxClients:     defaultMaxRPCClients,
+		RPCMaxWebsockets:  defaultMaxRPCWebsockets,
 		Generate:          defaultGenerate,
 		MaxPeers:          defaultMaxPeers,
 		MinTxFee:          mempool.DefaultMinRelayTxFee,
+		MaxMempool:        mempool.DefaultMaxPoolSize / 1000000,
 		BlockMinSize:      defaultBlockMinSize,
 		BlockMaxSize:      defaultBlockMaxSize,
 		SigCacheMaxSize:   defaultSigCacheMaxSize,
@@ -299,6 +305,76 @@ func LoadConfig() (*config.Config, []string, error) {
 		log.PrintOrigins(true)
 	}
 
+	// The mempool size limit can only be disabled with zero.
+	if cfg.MaxMempool < 0 {
+		err := fmt.Errorf("%s: the --maxmempool option may not be "+
+			"negative", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Validate database type.
+	if !validDbType(cfg.DbType) {
+		str := "%s: the --dbtype option is invalid -- supported " +
+			"types are %v"
+		err := fmt.Errorf(str, funcName, database.SupportedDrivers())
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Validate the proxies, they must be in the form of host:port.
+	proxies := []struct {
+		option string
+		addr   string
+	}{
+		{"--proxy", cfg.Proxy},
+		{"--onion", cfg.OnionProxy},
+		{"--torcontrol", cfg.TorControl},
+	}
+	for _, proxy := range proxies {
+		if proxy.addr == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(proxy.addr); err != nil {
+			str := "%s: the %s option '%s' is invalid: %v"
+			err := fmt.Errorf(str, funcName, proxy.option, proxy.addr, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+	if cfg.NoOnion && cfg.OnionProxy != "" {
+		err := fmt.Errorf("%s: the --noonion and --onion options may "+
+			"not be activated at the same time", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.TorIsolation && cfg.Proxy == "" && cfg.OnionProxy == "" {
+		err := fmt.Errorf("%s: the --torisolation option requires "+
+			"--proxy or --onion", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.TorControl != "" && cfg.DisableListen {
+		err := fmt.Errorf("%s: the --torcontrol and --nolisten options "+
+			"may not be activated at the same time", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// The metrics must be enabled before the services create them.
+	if cfg.Metrics != "" {
+		if _, _, err := net.SplitHostPort(cfg.Metrics); err != nil {
+			cfg.Metrics = net.JoinHostPort("", cfg.Metrics)
+		}
+		metrics.Enabled = true
+	}
+
 	// --addrindex and --dropaddrindex do not mix.
 	if cfg.AddrIndex && cfg.DropAddrIndex {
 		err := fmt.Errorf("%s: the --addrindex and --dropaddrindex "+
@@ -309,6 +385,16 @@ func LoadConfig() (*config.Config, []string, error) {
 		return nil, nil, err
 	}
 
+	// --assetindex and --dropassetindex do not mix.
+	if cfg.AssetIndex && cfg.DropAssetIndex {
+		err := fmt.Errorf("%s: the --assetindex and --dropassetindex "+
+			"options may not be activated at the same time",
+			funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// --addrindex and --droptxindex do not mix.
 	if cfg.AddrIndex && cfg.DropTxIndex {
 		err := fmt.Errorf("%s: the --addrindex and --droptxindex "+
@@ -321,6 +407,47 @@ func LoadConfig() (*config.Config, []string, error) {
 		return nil, nil, err
 	}
 
+	// --snapshotsync needs the spent outputs of the blocks before the
+	// snapshot, which the address and asset indexes and the watched
+	// addresses can't do without.
+	if cfg.SnapshotSync && (cfg.AddrIndex || cfg.AssetIndex || len(cfg.WatchAddrs) > 0) {
+		err := fmt.Errorf("%s: the --snapshotsync option may not be "+
+			"activated together with --addrindex, --assetindex or "+
+			"--watchaddr", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Check the snapshot point is valid and save the parsed version.
+	if cfg.SnapshotPoint != "" {
+		if !cfg.SnapshotSync {
+			err := fmt.Errorf("%s: the --snapshotpoint option "+
+				"requires --snapshotsync", funcName)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		parts := strings.Split(cfg.SnapshotPoint, ":")
+		var block, root *hash.Hash
+		var err error
+		if len(parts) == 2 {
+			block, err = hash.NewHashFromStr(parts[0])
+			if err == nil {
+				root, err = hash.NewHashFromStr(parts[1])
+			}
+		}
+		if len(parts) != 2 || err != nil {
+			str := "%s: snapshot point '%s' is not in the form " +
+				"<block hash>:<utxo root>"
+			err := fmt.Errorf(str, funcName, cfg.SnapshotPoint)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.SetSnapshotPoint(block, root)
+	}
+
 	// Check mining addresses are valid and saved parsed versions.
 	for _, strAddr := range cfg.MiningAddrs {
 		addr, err := address.DecodeAddress(strAddr)
@@ -343,6 +470,26 @@ func LoadConfig() (*config.Config, []string, error) {
 		cfg.SetMiningAddrs(addr)
 	}
 
+	// Check watch addresses are valid and saved parsed versions.
+	for _, strAddr := range cfg.WatchAddrs {
+		addr, err := address.DecodeAddress(strAddr)
+		if err != nil {
+			str := "%s: watch address '%s' failed to decode: %v"
+			err := fmt.Errorf(str, funcName, strAddr, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		if !address.IsForNetwork(addr, params.ActiveNetParams.Params) {
+			str := "%s: watch address '%s' is on the wrong network"
+			err := fmt.Errorf(str, funcName, strAddr)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.SetWatchAddrs(addr)
+	}
+
 	// Validate any given whitelisted IP addresses and networks.
 	if len(cfg.Whitelists) > 0 {
 		var ip net.IP
@@ -432,3 +579,14 @@ func processCustomizedDNSSeed(param *params.Params, seed []string) {
 	}
 	param.DNSSeeds = dnsseed
 }
+
+// validDbType returns whether or not dbType is a supported database type.
+func validDbType(dbType string) bool {
+	for _, knownType := range database.SupportedDrivers() {
+		if dbType == knownType {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package hdrmgr
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/json"
+	"github.com/btceasypay/bitcoinpay/rpc"
+)
+
+// APIs returns the RPC APIs of the light node, which are only based on the
+// block headers.
+func (m *HeaderManager) APIs() []rpc.API {
+	return []rpc.API{
+		{
+			NameSpace: rpc.DefaultServiceNameSpace,
+			Service:   NewPublicHeaderAPI(m),
+			Public:    true,
+		},
+	}
+}
+
+// PublicHeaderAPI provides an API to access the block headers synced by the
+// light node.
+type PublicHeaderAPI struct {
+	m *HeaderManager
+}
+
+// NewPublicHeaderAPI creates a new API for the header manager.
+func NewPublicHeaderAPI(m *HeaderManager) *PublicHeaderAPI {
+	return &PublicHeaderAPI{m}
+}
+
+// GetBlockHeader implements the getblockheader command.  The confirmations
+// are the number of headers stored after the block and the layer is not
+// known to the light node.
+func (api *PublicHeaderAPI) GetBlockHeader(h hash.Hash, verbose bool) (interface{}, error) {
+	blockHeader, index, err := api.m.HeaderByHash(&h)
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), fmt.Sprintf("Block not found: %v", h))
+	}
+	if !verbose {
+		var headerBuf bytes.Buffer
+		err := blockHeader.Serialize(&headerBuf)
+		if err != nil {
+			context := "Failed to serialize block header"
+			return nil, rpc.RpcInternalError(err.Error(), context)
+		}
+		return hex.EncodeToString(headerBuf.Bytes()), nil
+	}
+	return json.GetBlockHeaderVerboseResult{
+		Hash:          h.String(),
+		Confirmations: int64(api.m.Count() - index - 1),
+		Version:       int32(blockHeader.Version),
+		ParentRoot:    blockHeader.ParentRoot.String(),
+		TxRoot:        blockHeader.TxRoot.String(),
+		StateRoot:     blockHeader.StateRoot.String(),
+		Difficulty:    blockHeader.Difficulty,
+		Time:          blockHeader.Timestamp.Unix(),
+		PowResult:     blockHeader.Pow.GetPowResult(),
+	}, nil
+}
+
+// GetBlockCount returns the number of stored block headers.
+func (api *PublicHeaderAPI) GetBlockCount() (interface{}, error) {
+	return api.m.Count(), nil
+}
+
+// Return a list hash of the tips of the graph state adopted from the peers.
+func (api *PublicHeaderAPI) Tips() (interface{}, error) {
+	tips := []string{}
+	for _, v := range api.m.GraphState().GetTips().SortList(false) {
+		tips = append(tips, v.String())
+	}
+	return tips, nil
+}
+
+// Query whether a given block was reported on the main chain by the peers.
+// Only the main chain tips and the sync points of the peers are known to be
+// on the main chain, whether any other block is on it is unknown to the light
+// node and reported as an error rather than as false.
+func (api *PublicHeaderAPI) IsOnMainChain(h hash.Hash) (interface{}, error) {
+	if !api.m.HaveHeader(&h) {
+		return nil, rpc.RpcInternalError(fmt.Errorf("no block").Error(), fmt.Sprintf("Block not found: %v", h))
+	}
+	if !api.m.IsOnMainChain(&h) {
+		return nil, rpc.RpcInternalError("unknown main chain",
+			fmt.Sprintf("The light node does not know whether block %v is on the main chain", h))
+	}
+	return strconv.FormatBool(true), nil
+}
+
+// IsCurrent returns whether the light node believes it is synced with the
+// connected peers.
+func (api *PublicHeaderAPI) IsCurrent() (interface{}, error) {
+	return api.m.IsCurrent(), nil
+}
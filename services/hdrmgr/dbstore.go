@@ -0,0 +1,135 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package hdrmgr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/blockdag"
+	"github.com/btceasypay/bitcoinpay/core/protocol"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/database"
+)
+
+var (
+	// headersBucketName is the name of the db bucket used to house the
+	// block headers by the index they were stored at.
+	headersBucketName = []byte("lightheaders")
+
+	// headerIndexBucketName is the name of the db bucket used to house the
+	// index of the block headers by their hash.
+	headerIndexBucketName = []byte("lightheaderidx")
+
+	// mainChainBucketName is the name of the db bucket used to house the
+	// hashes of the headers the peers reported on the main chain.
+	mainChainBucketName = []byte("lightmainchain")
+
+	// graphStateKeyName is the name of the db key used to store the graph
+	// state adopted from the peers.
+	graphStateKeyName = []byte("lightgraphstate")
+)
+
+// indexKey returns the db key of the header stored at the index, which sorts
+// the headers in the order they were stored.
+func indexKey(index uint64) []byte {
+	var key [8]byte
+	binary.BigEndian.PutUint64(key[:], index)
+	return key[:]
+}
+
+// dbCreateBuckets creates the buckets used to store the headers.
+func dbCreateBuckets(dbTx database.Tx) error {
+	meta := dbTx.Metadata()
+	for _, name := range [][]byte{headersBucketName, headerIndexBucketName,
+		mainChainBucketName} {
+		if _, err := meta.CreateBucket(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dbPutHeader stores the header at the index.
+func dbPutHeader(dbTx database.Tx, index uint64, header *types.BlockHeader) error {
+	var buf bytes.Buffer
+	if err := header.Serialize(&buf); err != nil {
+		return err
+	}
+	key := indexKey(index)
+	meta := dbTx.Metadata()
+	if err := meta.Bucket(headersBucketName).Put(key, buf.Bytes()); err != nil {
+		return err
+	}
+	h := header.BlockHash()
+	return meta.Bucket(headerIndexBucketName).Put(h[:], key)
+}
+
+// dbFetchHeaderIndex returns the index of the header with the hash and
+// whether it is stored at all.
+func dbFetchHeaderIndex(dbTx database.Tx, h *hash.Hash) (uint64, bool) {
+	key := dbTx.Metadata().Bucket(headerIndexBucketName).Get(h[:])
+	if key == nil {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(key), true
+}
+
+// dbFetchHeaderByIndex returns the header stored at the index.
+func dbFetchHeaderByIndex(dbTx database.Tx, index uint64) (*types.BlockHeader, error) {
+	serialized := dbTx.Metadata().Bucket(headersBucketName).Get(indexKey(index))
+	if serialized == nil {
+		return nil, fmt.Errorf("no header at index %d", index)
+	}
+	var header types.BlockHeader
+	if err := header.Deserialize(bytes.NewReader(serialized)); err != nil {
+		return nil, err
+	}
+	return &header, nil
+}
+
+// dbFetchHeaderCount returns the number of stored headers.
+func dbFetchHeaderCount(dbTx database.Tx) uint64 {
+	cursor := dbTx.Metadata().Bucket(headersBucketName).Cursor()
+	if !cursor.Last() {
+		return 0
+	}
+	return binary.BigEndian.Uint64(cursor.Key()) + 1
+}
+
+// dbPutMainChain marks the header with the hash as on the main chain.
+func dbPutMainChain(dbTx database.Tx, h *hash.Hash) error {
+	return dbTx.Metadata().Bucket(mainChainBucketName).Put(h[:], []byte{1})
+}
+
+// dbIsMainChain returns whether the header with the hash was marked as on the
+// main chain.
+func dbIsMainChain(dbTx database.Tx, h *hash.Hash) bool {
+	return dbTx.Metadata().Bucket(mainChainBucketName).Get(h[:]) != nil
+}
+
+// dbPutGraphState stores the graph state adopted from the peers.
+func dbPutGraphState(dbTx database.Tx, gs *blockdag.GraphState) error {
+	var buf bytes.Buffer
+	if err := gs.Encode(&buf, protocol.ProtocolVersion); err != nil {
+		return err
+	}
+	return dbTx.Metadata().Put(graphStateKeyName, buf.Bytes())
+}
+
+// dbFetchGraphState returns the graph state adopted from the peers.
+func dbFetchGraphState(dbTx database.Tx) (*blockdag.GraphState, error) {
+	serialized := dbTx.Metadata().Get(graphStateKeyName)
+	if serialized == nil {
+		return nil, fmt.Errorf("no graph state stored")
+	}
+	gs := blockdag.NewGraphState()
+	if err := gs.Decode(bytes.NewReader(serialized), protocol.ProtocolVersion); err != nil {
+		return nil, err
+	}
+	return gs, nil
+}
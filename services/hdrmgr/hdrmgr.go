@@ -0,0 +1,722 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package hdrmgr implements the header manager of the light node, which syncs
+// the block headers and the graph state from the full node peers, validates
+// the headers and stores them in the database.
+package hdrmgr
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/config"
+	"github.com/btceasypay/bitcoinpay/core/blockchain"
+	"github.com/btceasypay/bitcoinpay/core/blockdag"
+	"github.com/btceasypay/bitcoinpay/core/message"
+	"github.com/btceasypay/bitcoinpay/core/protocol"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/database"
+	"github.com/btceasypay/bitcoinpay/p2p/peer"
+	"github.com/btceasypay/bitcoinpay/params"
+)
+
+const (
+	// maxRequestedHeaders is the maximum number of requested header hashes
+	// to store in memory.
+	maxRequestedHeaders = message.MaxInvPerMsg
+
+	// recentLocatorHashes is the number of the most recent headers added
+	// to the locator before the steps between the headers are doubled.
+	recentLocatorHashes = 10
+
+	// maxLocatorHashes is the maximum number of hashes of the locator sent
+	// to the sync peer.
+	maxLocatorHashes = blockdag.MaxMainLocatorNum / 2
+
+	// minGraphStatePeers is the number of full node peers which must agree
+	// on the main chain tip of a graph state before it is adopted.  Fewer
+	// peers are enough when fewer are connected, but then all of them must
+	// agree.
+	minGraphStatePeers = 2
+)
+
+// HeaderManager syncs the block headers of the light node from the full node
+// peers.  The headers are stored in the order they are received, which
+// follows the order of the DAG of the peers.
+type HeaderManager struct {
+	started  int32
+	shutdown int32
+
+	db            database.DB
+	params        *params.Params
+	timeSource    blockchain.MedianTimeSource
+	noCheckpoints bool
+
+	msgChan chan interface{}
+	quit    chan struct{}
+	wg      sync.WaitGroup
+
+	// The following fields are only accessed by the header handler.
+	peers            map[*peer.Peer]*peer.ServerPeer
+	syncPeer         *peer.ServerPeer
+	requestedHeaders map[hash.Hash]struct{}
+
+	// stateLock protects the state of the stored headers below.
+	stateLock sync.RWMutex
+	count     uint64
+	tip       hash.Hash
+	gs        *blockdag.GraphState
+}
+
+// New returns a header manager storing the headers in the database.  The
+// genesis header is stored the first time the database is used.
+func New(db database.DB, timeSource blockchain.MedianTimeSource,
+	cfg *config.Config, par *params.Params) (*HeaderManager, error) {
+
+	m := HeaderManager{
+		db:               db,
+		params:           par,
+		timeSource:       timeSource,
+		noCheckpoints:    cfg.DisableCheckpoints,
+		msgChan:          make(chan interface{}, cfg.MaxPeers*3),
+		quit:             make(chan struct{}),
+		peers:            make(map[*peer.Peer]*peer.ServerPeer),
+		requestedHeaders: make(map[hash.Hash]struct{}),
+	}
+	err := db.Update(func(dbTx database.Tx) error {
+		if dbTx.Metadata().Bucket(headersBucketName) != nil {
+			return nil
+		}
+		if err := dbCreateBuckets(dbTx); err != nil {
+			return err
+		}
+		genesis := &par.GenesisBlock.Header
+		if err := dbPutHeader(dbTx, 0, genesis); err != nil {
+			return err
+		}
+		if err := dbPutMainChain(dbTx, par.GenesisHash); err != nil {
+			return err
+		}
+		gs := blockdag.NewGraphState()
+		gs.GetTips().AddPair(par.GenesisHash, true)
+		gs.SetTotal(1)
+		return dbPutGraphState(dbTx, gs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = db.View(func(dbTx database.Tx) error {
+		m.count = dbFetchHeaderCount(dbTx)
+		tip, err := dbFetchHeaderByIndex(dbTx, m.count-1)
+		if err != nil {
+			return err
+		}
+		m.tip = tip.BlockHash()
+		m.gs, err = dbFetchGraphState(dbTx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Info(fmt.Sprintf("Loaded %d block headers, graph state %s", m.count, m.gs))
+	return &m, nil
+}
+
+// Start begins the header handler which syncs the headers from the peers.
+func (m *HeaderManager) Start() {
+	if atomic.AddInt32(&m.started, 1) != 1 {
+		return
+	}
+	log.Trace("Starting header manager")
+	m.wg.Add(1)
+	go m.headerHandler()
+}
+
+// Stop stops the header handler and waits for it to finish.
+func (m *HeaderManager) Stop() error {
+	if atomic.AddInt32(&m.shutdown, 1) != 1 {
+		log.Warn("Header manager is already in the process of shutting down")
+		return nil
+	}
+	log.Info("Header manager shutting down")
+	close(m.quit)
+	m.wg.Wait()
+	return nil
+}
+
+// GraphState returns the graph state adopted from the peers.
+func (m *HeaderManager) GraphState() *blockdag.GraphState {
+	m.stateLock.RLock()
+	defer m.stateLock.RUnlock()
+	return m.gs.Clone()
+}
+
+// Count returns the number of stored headers.
+func (m *HeaderManager) Count() uint64 {
+	m.stateLock.RLock()
+	defer m.stateLock.RUnlock()
+	return m.count
+}
+
+// HaveHeader returns whether the header with the hash is stored.
+func (m *HeaderManager) HaveHeader(h *hash.Hash) bool {
+	var ok bool
+	m.db.View(func(dbTx database.Tx) error {
+		_, ok = dbFetchHeaderIndex(dbTx, h)
+		return nil
+	})
+	return ok
+}
+
+// HeaderByHash returns the header with the hash and the index it is stored at.
+func (m *HeaderManager) HeaderByHash(h *hash.Hash) (*types.BlockHeader, uint64, error) {
+	var header *types.BlockHeader
+	var index uint64
+	err := m.db.View(func(dbTx database.Tx) error {
+		var ok bool
+		index, ok = dbFetchHeaderIndex(dbTx, h)
+		if !ok {
+			return fmt.Errorf("no header for block %s", h)
+		}
+		var err error
+		header, err = dbFetchHeaderByIndex(dbTx, index)
+		return err
+	})
+	return header, index, err
+}
+
+// IsOnMainChain returns whether the header with the hash is known to be on
+// the main chain.  The headers do not commit to their parents, so the light
+// node only knows the headers the peers sent as their main chain tips or as
+// sync points.  False means it is not known, not that the header is off the
+// main chain.
+func (m *HeaderManager) IsOnMainChain(h *hash.Hash) bool {
+	var isMain bool
+	m.db.View(func(dbTx database.Tx) error {
+		isMain = dbIsMainChain(dbTx, h)
+		return nil
+	})
+	return isMain
+}
+
+// processHeaders validates the headers and stores the ones not known yet
+// after the stored headers.  Nothing is stored when any of them is invalid.
+func (m *HeaderManager) processHeaders(headers []*types.BlockHeader) error {
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+
+	count, tip := m.count, m.tip
+	err := m.db.Update(func(dbTx database.Tx) error {
+		for _, header := range headers {
+			h := header.BlockHash()
+			if _, ok := dbFetchHeaderIndex(dbTx, &h); ok {
+				continue
+			}
+			if err := m.checkHeader(header); err != nil {
+				return fmt.Errorf("invalid header %s: %v", h, err)
+			}
+			if err := dbPutHeader(dbTx, count, header); err != nil {
+				return err
+			}
+			count++
+			tip = h
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if count != m.count {
+		log.Debug(fmt.Sprintf("Stored %d block headers, tip %s", count-m.count, tip))
+	}
+	m.count, m.tip = count, tip
+	return nil
+}
+
+// adoptGraphState adopts the graph state of a peer once all its tips are
+// stored, provided it is better than the current one and the checkpoints
+// it passed are stored.  The main chain tip of the graph state is marked as
+// on the main chain.  It returns whether the graph state was adopted.
+func (m *HeaderManager) adoptGraphState(gs *blockdag.GraphState) (bool, error) {
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+
+	if !gs.IsExcellent(m.gs) {
+		return false, nil
+	}
+	adopted := false
+	err := m.db.Update(func(dbTx database.Tx) error {
+		for _, tip := range gs.GetTips().List() {
+			if _, ok := dbFetchHeaderIndex(dbTx, tip); !ok {
+				return nil
+			}
+		}
+		if err := m.checkCheckpoints(dbTx, gs); err != nil {
+			return err
+		}
+		if err := dbPutMainChain(dbTx, gs.GetMainChainTip()); err != nil {
+			return err
+		}
+		adopted = true
+		return dbPutGraphState(dbTx, gs)
+	})
+	if err != nil || !adopted {
+		return false, err
+	}
+	m.gs = gs.Clone()
+	log.Debug(fmt.Sprintf("Adopted graph state %s", gs))
+	return true, nil
+}
+
+// markMainChain marks the stored header with the hash as on the main chain.
+func (m *HeaderManager) markMainChain(h *hash.Hash) error {
+	return m.db.Update(func(dbTx database.Tx) error {
+		if _, ok := dbFetchHeaderIndex(dbTx, h); !ok {
+			return nil
+		}
+		return dbPutMainChain(dbTx, h)
+	})
+}
+
+// syncGraphState returns the graph state sent to the sync peer.  The light
+// node only knows the last stored header and the number of headers, so the
+// peer sends the blocks which are not in the past of the last header.
+func (m *HeaderManager) syncGraphState() *blockdag.GraphState {
+	m.stateLock.RLock()
+	defer m.stateLock.RUnlock()
+
+	gs := blockdag.NewGraphState()
+	tip := m.tip
+	gs.GetTips().AddPair(&tip, true)
+	gs.SetTotal(uint(m.count))
+	return gs
+}
+
+// locator returns the hashes of the stored headers sent to the sync peer,
+// from the genesis to the last stored header.  It holds the most recent
+// headers and then doubles the steps between the older ones, so the peer
+// finds a recent header on its main chain to sync from.
+func (m *HeaderManager) locator() []*hash.Hash {
+	m.stateLock.RLock()
+	count := m.count
+	m.stateLock.RUnlock()
+
+	var indexes []uint64
+	step := uint64(1)
+	for index := count - 1; index > 0; {
+		indexes = append(indexes, index)
+		if len(indexes) >= maxLocatorHashes-1 {
+			break
+		}
+		if len(indexes) >= recentLocatorHashes {
+			step *= 2
+		}
+		if index < step {
+			break
+		}
+		index -= step
+	}
+	indexes = append(indexes, 0)
+
+	locator := make([]*hash.Hash, 0, len(indexes))
+	m.db.View(func(dbTx database.Tx) error {
+		for i := len(indexes) - 1; i >= 0; i-- {
+			header, err := dbFetchHeaderByIndex(dbTx, indexes[i])
+			if err != nil {
+				return err
+			}
+			h := header.BlockHash()
+			locator = append(locator, &h)
+		}
+		return nil
+	})
+	return locator
+}
+
+// newPeerMsg signifies a newly connected peer to the header handler.
+type newPeerMsg struct {
+	peer *peer.ServerPeer
+}
+
+// donePeerMsg signifies a newly disconnected peer to the header handler.
+type donePeerMsg struct {
+	peer *peer.ServerPeer
+}
+
+// invMsg packages an inv message and the peer it came from together.
+type invMsg struct {
+	inv  *message.MsgInv
+	peer *peer.ServerPeer
+}
+
+// headersMsg packages a headers message and the peer it came from together.
+type headersMsg struct {
+	headers *message.MsgHeaders
+	peer    *peer.ServerPeer
+}
+
+// graphStateMsg packages the graph state announced by a peer.
+type graphStateMsg struct {
+	gs   *blockdag.GraphState
+	peer *peer.ServerPeer
+}
+
+// syncPointMsg packages the sync point sent by a peer.
+type syncPointMsg struct {
+	point *hash.Hash
+	peer  *peer.ServerPeer
+}
+
+// isCurrentMsg is a message type to be sent across the message channel for
+// requesting whether or not the header manager believes it is synced with
+// the currently connected peers.
+type isCurrentMsg struct {
+	reply chan bool
+}
+
+// NewPeer informs the header manager of a newly active peer.
+func (m *HeaderManager) NewPeer(sp *peer.ServerPeer) {
+	if atomic.LoadInt32(&m.shutdown) != 0 {
+		return
+	}
+	m.msgChan <- &newPeerMsg{peer: sp}
+}
+
+// DonePeer informs the header manager that a peer has disconnected.
+func (m *HeaderManager) DonePeer(sp *peer.ServerPeer) {
+	if atomic.LoadInt32(&m.shutdown) != 0 {
+		return
+	}
+	m.msgChan <- &donePeerMsg{peer: sp}
+}
+
+// QueueInv adds the passed inv message and peer to the header handling queue.
+func (m *HeaderManager) QueueInv(inv *message.MsgInv, sp *peer.ServerPeer) {
+	if atomic.LoadInt32(&m.shutdown) != 0 {
+		return
+	}
+	m.msgChan <- &invMsg{inv: inv, peer: sp}
+}
+
+// QueueHeaders adds the passed headers message and peer to the header
+// handling queue.
+func (m *HeaderManager) QueueHeaders(headers *message.MsgHeaders, sp *peer.ServerPeer) {
+	if atomic.LoadInt32(&m.shutdown) != 0 {
+		return
+	}
+	m.msgChan <- &headersMsg{headers: headers, peer: sp}
+}
+
+// QueueGraphState adds the graph state announced by the peer to the header
+// handling queue.
+func (m *HeaderManager) QueueGraphState(gs *blockdag.GraphState, sp *peer.ServerPeer) {
+	if atomic.LoadInt32(&m.shutdown) != 0 {
+		return
+	}
+	m.msgChan <- &graphStateMsg{gs: gs, peer: sp}
+}
+
+// QueueSyncPoint adds the sync point sent by the peer to the header handling
+// queue.
+func (m *HeaderManager) QueueSyncPoint(point *hash.Hash, sp *peer.ServerPeer) {
+	if atomic.LoadInt32(&m.shutdown) != 0 {
+		return
+	}
+	m.msgChan <- &syncPointMsg{point: point, peer: sp}
+}
+
+// IsCurrent returns whether or not the header manager believes it is synced
+// with the connected peers.  It returns false once the header manager is
+// shutting down.
+func (m *HeaderManager) IsCurrent() bool {
+	if atomic.LoadInt32(&m.shutdown) != 0 {
+		return false
+	}
+	reply := make(chan bool, 1)
+	select {
+	case m.msgChan <- isCurrentMsg{reply: reply}:
+	case <-m.quit:
+		return false
+	}
+	select {
+	case current := <-reply:
+		return current
+	case <-m.quit:
+		return false
+	}
+}
+
+// headerHandler is the main handler for the header manager.  It must be run
+// as a goroutine.  It processes the messages of the peers in a separate
+// goroutine from the peer handlers, so the headers are stored in the order
+// they were received.
+func (m *HeaderManager) headerHandler() {
+out:
+	for {
+		select {
+		case msg := <-m.msgChan:
+			switch msg := msg.(type) {
+			case *newPeerMsg:
+				m.handleNewPeerMsg(msg.peer)
+			case *donePeerMsg:
+				m.handleDonePeerMsg(msg.peer)
+			case *invMsg:
+				m.handleInvMsg(msg)
+			case *headersMsg:
+				m.handleHeadersMsg(msg)
+			case *graphStateMsg:
+				m.handleGraphStateMsg(msg)
+			case *syncPointMsg:
+				if err := m.markMainChain(msg.point); err != nil {
+					log.Error("Failed to mark the sync point", "error", err)
+				}
+			case isCurrentMsg:
+				msg.reply <- m.isCurrent()
+			default:
+				log.Warn(fmt.Sprintf("Invalid message type in header handler: %T", msg))
+			}
+
+		case <-m.quit:
+			break out
+		}
+	}
+	m.wg.Done()
+	log.Trace("Header handler done")
+}
+
+// handleNewPeerMsg starts syncing from the new peer when it is the best full
+// node peer.
+func (m *HeaderManager) handleNewPeerMsg(sp *peer.ServerPeer) {
+	log.Info(fmt.Sprintf("New valid peer: %s,user-agent:%s", sp, sp.UserAgent()))
+	sp.SyncCandidate = sp.Services()&protocol.Full == protocol.Full
+	m.peers[sp.Peer] = sp
+	m.startSync()
+}
+
+// handleDonePeerMsg removes the peer and picks a new sync peer when it was
+// the sync peer.
+func (m *HeaderManager) handleDonePeerMsg(sp *peer.ServerPeer) {
+	if _, exists := m.peers[sp.Peer]; !exists {
+		log.Warn(fmt.Sprintf("Received done peer message for unknown peer %s", sp))
+		return
+	}
+	delete(m.peers, sp.Peer)
+	log.Info("Lost peer", "peer", sp)
+
+	if m.syncPeer == sp {
+		m.syncPeer = nil
+		m.requestedHeaders = make(map[hash.Hash]struct{})
+		m.startSync()
+	}
+}
+
+// handleInvMsg requests the headers of the announced blocks which are not
+// stored yet.
+func (m *HeaderManager) handleInvMsg(imsg *invMsg) {
+	sp, exists := m.peers[imsg.peer.Peer]
+	if !exists {
+		log.Warn(fmt.Sprintf("Received inv message from unknown peer %s", imsg.peer))
+		return
+	}
+	sp.UpdateLastGS(imsg.inv.GS)
+
+	var hashes []*hash.Hash
+	for _, iv := range imsg.inv.InvList {
+		if iv.Type != message.InvTypeBlock {
+			continue
+		}
+		sp.AddKnownInventory(iv)
+		if _, ok := m.requestedHeaders[iv.Hash]; ok || m.HaveHeader(&iv.Hash) {
+			continue
+		}
+		m.limitMap(m.requestedHeaders, maxRequestedHeaders)
+		m.requestedHeaders[iv.Hash] = struct{}{}
+		h := iv.Hash
+		hashes = append(hashes, &h)
+	}
+	if len(hashes) == 0 {
+		if sp == m.syncPeer {
+			// The sync peer has nothing more to send us, the sync
+			// starts again with the next announced block.
+			m.syncPeer = nil
+		}
+		m.updateGraphState(sp, imsg.inv.GS)
+		return
+	}
+
+	gs := m.syncGraphState()
+	for len(hashes) > 0 {
+		n := len(hashes)
+		if n > message.MaxBlockLocatorsPerMsg {
+			n = message.MaxBlockLocatorsPerMsg
+		}
+		sp.PushGetHeadersMsg(gs, hashes[:n])
+		hashes = hashes[n:]
+	}
+}
+
+// handleHeadersMsg stores the requested headers and adopts the graph state
+// of the peer when all its tips are stored.  Peers sending invalid headers
+// are disconnected.
+func (m *HeaderManager) handleHeadersMsg(hmsg *headersMsg) {
+	sp, exists := m.peers[hmsg.peer.Peer]
+	if !exists {
+		log.Warn(fmt.Sprintf("Received headers message from unknown peer %s", hmsg.peer))
+		return
+	}
+	sp.UpdateLastGS(hmsg.headers.GS)
+
+	headers := make([]*types.BlockHeader, 0, len(hmsg.headers.Headers))
+	for _, header := range hmsg.headers.Headers {
+		h := header.BlockHash()
+		if _, ok := m.requestedHeaders[h]; !ok {
+			log.Debug(fmt.Sprintf("Ignoring unrequested header %s from %s", h, sp))
+			continue
+		}
+		delete(m.requestedHeaders, h)
+		headers = append(headers, header)
+	}
+	if err := m.processHeaders(headers); err != nil {
+		log.Warn(fmt.Sprintf("Disconnecting peer %s: %v", sp, err))
+		sp.Disconnect()
+		return
+	}
+	if !m.updateGraphState(sp, hmsg.headers.GS) {
+		return
+	}
+	if sp != m.syncPeer {
+		m.startSync()
+		return
+	}
+
+	// Ask the sync peer for the next headers once all the requested ones
+	// arrived.
+	if len(m.requestedHeaders) == 0 {
+		if sp.LastGS().IsExcellent(m.GraphState()) {
+			m.requestSync(sp)
+		} else {
+			log.Info(fmt.Sprintf("Synced %d block headers from %s", m.Count(), sp))
+			m.syncPeer = nil
+		}
+	}
+}
+
+// handleGraphStateMsg adopts the graph state announced by the peer when all
+// its tips are stored, otherwise it starts syncing when there is no sync peer.
+func (m *HeaderManager) handleGraphStateMsg(gmsg *graphStateMsg) {
+	if m.updateGraphState(gmsg.peer, gmsg.gs) {
+		m.startSync()
+	}
+}
+
+// updateGraphState adopts the graph state of the peer when possible.  The
+// peer is disconnected and false is returned when the graph state misses a
+// checkpoint.
+func (m *HeaderManager) updateGraphState(sp *peer.ServerPeer, gs *blockdag.GraphState) bool {
+	if !m.isGraphStateConfirmed(gs) {
+		log.Trace(fmt.Sprintf("Graph state %s of peer %s is not confirmed "+
+			"by the other peers", gs, sp))
+		return true
+	}
+	if _, err := m.adoptGraphState(gs); err != nil {
+		log.Warn(fmt.Sprintf("Disconnecting peer %s: %v", sp, err))
+		sp.Disconnect()
+		return false
+	}
+	return true
+}
+
+// isGraphStateConfirmed returns whether enough full node peers announced the
+// same main chain tip as the graph state, so a single peer can not make the
+// light node adopt the graph state it made up.
+func (m *HeaderManager) isGraphStateConfirmed(gs *blockdag.GraphState) bool {
+	if gs.GetTips().IsEmpty() {
+		return false
+	}
+	mainTip := gs.GetMainChainTip()
+	candidates, confirmations := 0, 0
+	for _, sp := range m.peers {
+		if !sp.SyncCandidate {
+			continue
+		}
+		candidates++
+		lastGS := sp.LastGS()
+		if lastGS.GetTips().IsEmpty() {
+			continue
+		}
+		if lastGS.GetMainChainTip().IsEqual(mainTip) {
+			confirmations++
+		}
+	}
+	required := minGraphStatePeers
+	if candidates < required {
+		required = candidates
+	}
+	return required > 0 && confirmations >= required
+}
+
+// startSync chooses the full node peer with the best graph state to sync the
+// headers from.  When syncing is already running, it simply returns.
+func (m *HeaderManager) startSync() {
+	if m.syncPeer != nil {
+		return
+	}
+	gs := m.GraphState()
+	var bestPeer *peer.ServerPeer
+	for _, sp := range m.peers {
+		if !sp.SyncCandidate || !sp.LastGS().IsExcellent(gs) {
+			continue
+		}
+		if bestPeer == nil || sp.LastGS().IsExcellent(bestPeer.LastGS()) {
+			bestPeer = sp
+		}
+	}
+	if bestPeer == nil {
+		return
+	}
+	log.Info(fmt.Sprintf("Syncing headers to state %s from peer %s cur graph state:%s",
+		bestPeer.LastGS(), bestPeer.Addr(), gs))
+	m.syncPeer = bestPeer
+	m.requestSync(bestPeer)
+}
+
+// requestSync asks the peer for the blocks after the stored headers, which
+// it announces with an inv message.
+func (m *HeaderManager) requestSync(sp *peer.ServerPeer) {
+	sp.PushSyncDAGMsg(m.syncGraphState(), m.locator())
+}
+
+// isCurrent returns whether no full node peer announced a better graph state
+// than the adopted one.
+func (m *HeaderManager) isCurrent() bool {
+	if m.syncPeer != nil {
+		return false
+	}
+	gs := m.GraphState()
+	candidates := 0
+	for _, sp := range m.peers {
+		if !sp.SyncCandidate {
+			continue
+		}
+		candidates++
+		if sp.LastGS().IsExcellent(gs) {
+			return false
+		}
+	}
+	return candidates > 0
+}
+
+// limitMap evicts a random entry of the map when adding a new one would
+// exceed the limit.
+func (m *HeaderManager) limitMap(requested map[hash.Hash]struct{}, limit int) {
+	if len(requested)+1 > limit {
+		for h := range requested {
+			delete(requested, h)
+			return
+		}
+	}
+}
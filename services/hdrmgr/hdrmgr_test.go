@@ -0,0 +1,316 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+
+package hdrmgr
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/config"
+	"github.com/btceasypay/bitcoinpay/core/blockchain"
+	"github.com/btceasypay/bitcoinpay/core/blockdag"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/core/types/pow"
+	"github.com/btceasypay/bitcoinpay/database"
+	_ "github.com/btceasypay/bitcoinpay/database/ffldb"
+	"github.com/btceasypay/bitcoinpay/p2p/peer"
+	"github.com/btceasypay/bitcoinpay/params"
+)
+
+// testDBPath creates a temporary directory for the test database.
+func testDBPath(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "hdrmgr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "db"), func() { os.RemoveAll(dir) }
+}
+
+// newTestManager opens the database at the path, creating it when needed,
+// and returns a header manager on top of it.
+func newTestManager(t *testing.T, path string, par *params.Params,
+	cfg *config.Config) (*HeaderManager, database.DB) {
+
+	db, err := database.Open("ffldb", path, par.Net)
+	if err != nil {
+		db, err = database.Create("ffldb", path, par.Net)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := New(db, blockchain.NewMedianTime(), cfg, par)
+	if err != nil {
+		db.Close()
+		t.Fatal(err)
+	}
+	return m, db
+}
+
+// mineHeader returns a header solving the proof of work of the private network
+// at the difficulty.
+func mineHeader(t *testing.T, seed byte, difficulty uint32) *types.BlockHeader {
+	header := &types.BlockHeader{
+		Version:    1,
+		TxRoot:     hash.Hash{seed},
+		Difficulty: difficulty,
+		Timestamp:  time.Unix(time.Now().Unix(), 0),
+	}
+	for nonce := uint32(0); nonce < 1000; nonce++ {
+		header.Pow = pow.GetInstance(pow.BLAKE2BD, nonce, []byte{})
+		header.Pow.SetParams(params.PrivNetParams.PowConfig)
+		err := header.Pow.Verify(header.BlockData(), header.BlockHash(), header.Difficulty)
+		if err == nil {
+			return header
+		}
+	}
+	t.Fatal("failed to mine a header")
+	return nil
+}
+
+func TestStoreAndReload(t *testing.T) {
+	path, remove := testDBPath(t)
+	defer remove()
+	par := &params.PrivNetParams
+	cfg := &config.Config{MaxPeers: 8}
+
+	m, db := newTestManager(t, path, par, cfg)
+	if m.Count() != 1 || !m.HaveHeader(par.GenesisHash) ||
+		!m.IsOnMainChain(par.GenesisHash) {
+		t.Fatal("genesis header not stored on the main chain")
+	}
+	if !m.GraphState().IsGenesis() {
+		t.Fatalf("got graph state %s, want the genesis state", m.GraphState())
+	}
+
+	var headers []*types.BlockHeader
+	for i := byte(1); i <= 3; i++ {
+		headers = append(headers, mineHeader(t, i, 0x207fffff))
+	}
+	// Known headers are skipped.
+	if err := m.processHeaders(append(headers, headers[0])); err != nil {
+		t.Fatal(err)
+	}
+	if m.Count() != 4 {
+		t.Fatalf("got %d headers, want 4", m.Count())
+	}
+	h := headers[1].BlockHash()
+	header, index, err := m.HeaderByHash(&h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index != 2 || header.BlockHash() != h {
+		t.Fatalf("got header %s at index %d, want %s at index 2",
+			header.BlockHash(), index, h)
+	}
+	if m.IsOnMainChain(&h) {
+		t.Fatal("header not reported by a peer is on the main chain")
+	}
+	db.Close()
+
+	m, db = newTestManager(t, path, par, cfg)
+	defer db.Close()
+	tip := headers[2].BlockHash()
+	if m.Count() != 4 || m.tip != tip {
+		t.Fatalf("reloaded %d headers and tip %s, want 4 and %s", m.Count(), m.tip, tip)
+	}
+	locator := m.locator()
+	if len(locator) != 4 || *locator[0] != *par.GenesisHash || *locator[3] != tip {
+		t.Fatalf("got locator %v", locator)
+	}
+}
+
+func TestInvalidHeaders(t *testing.T) {
+	path, remove := testDBPath(t)
+	defer remove()
+	m, db := newTestManager(t, path, &params.PrivNetParams, &config.Config{MaxPeers: 8})
+	defer db.Close()
+
+	valid := mineHeader(t, 1, 0x207fffff)
+	validHash := valid.BlockHash()
+
+	// The target is above the proof of work limit.
+	tooEasy := &types.BlockHeader{
+		Difficulty: 0x2100ffff,
+		Timestamp:  valid.Timestamp,
+		Pow:        pow.GetInstance(pow.BLAKE2BD, 0, []byte{}),
+	}
+
+	// The timestamp is too far in the future.
+	future := mineHeader(t, 3, 0x207fffff)
+	future.Timestamp = future.Timestamp.Add(time.Hour)
+	for {
+		err := future.Pow.Verify(future.BlockData(), future.BlockHash(), future.Difficulty)
+		if err == nil {
+			break
+		}
+		future.Pow.SetNonce(future.Pow.GetNonce() + 1)
+	}
+
+	for _, header := range []*types.BlockHeader{tooEasy, future} {
+		if err := m.processHeaders([]*types.BlockHeader{valid, header}); err == nil {
+			t.Fatal("invalid header stored")
+		}
+		// Nothing of the batch is stored.
+		if m.Count() != 1 || m.HaveHeader(&validHash) {
+			t.Fatal("batch with an invalid header partly stored")
+		}
+	}
+}
+
+func TestAdoptGraphState(t *testing.T) {
+	path, remove := testDBPath(t)
+	defer remove()
+	par := params.PrivNetParams
+	m, db := newTestManager(t, path, &par, &config.Config{MaxPeers: 8})
+	defer db.Close()
+
+	headers := []*types.BlockHeader{mineHeader(t, 1, 0x207fffff), mineHeader(t, 2, 0x207fffff)}
+	first, second := headers[0].BlockHash(), headers[1].BlockHash()
+
+	gs := blockdag.NewGraphState()
+	gs.GetTips().AddPair(&second, true)
+	gs.GetTips().Add(&first)
+	gs.SetTotal(3)
+	gs.SetLayer(1)
+	gs.SetMainHeight(1)
+	gs.SetMainOrder(2)
+
+	// The tips are not stored yet.
+	adopted, err := m.adoptGraphState(gs)
+	if err != nil || adopted {
+		t.Fatalf("adopted graph state with unknown tips: %v", err)
+	}
+	if err := m.processHeaders(headers); err != nil {
+		t.Fatal(err)
+	}
+
+	// The graph state passed a checkpoint which is not stored.
+	missing := hash.Hash{0xff}
+	m.params.Checkpoints = []params.Checkpoint{{Layer: 1, Hash: &missing}}
+	if _, err := m.adoptGraphState(gs); err == nil {
+		t.Fatal("adopted graph state missing a checkpoint")
+	}
+	m.params.Checkpoints = []params.Checkpoint{{Layer: 1, Hash: &first}}
+
+	adopted, err = m.adoptGraphState(gs)
+	if err != nil || !adopted {
+		t.Fatalf("graph state not adopted: %v", err)
+	}
+	if !m.GraphState().IsEqual(gs) {
+		t.Fatalf("got graph state %s, want %s", m.GraphState(), gs)
+	}
+	if !m.IsOnMainChain(&second) || m.IsOnMainChain(&first) {
+		t.Fatal("main chain tip of the graph state not marked on the main chain")
+	}
+
+	// A worse graph state is not adopted.
+	worse := gs.Clone()
+	worse.SetMainOrder(1)
+	if adopted, _ := m.adoptGraphState(worse); adopted {
+		t.Fatal("adopted a worse graph state")
+	}
+
+	// The sync points are marked on the main chain.
+	if err := m.markMainChain(&first); err != nil {
+		t.Fatal(err)
+	}
+	if !m.IsOnMainChain(&first) {
+		t.Fatal("sync point not marked on the main chain")
+	}
+}
+
+// newTestPeer returns a full node peer which announced the graph state.
+func newTestPeer(gs *blockdag.GraphState) *peer.ServerPeer {
+	sp := &peer.ServerPeer{
+		Peer:          peer.NewInboundPeer(&peer.Config{}),
+		SyncCandidate: true,
+	}
+	sp.UpdateLastGS(gs)
+	return sp
+}
+
+func TestGraphStateConfirmation(t *testing.T) {
+	path, remove := testDBPath(t)
+	defer remove()
+	m, db := newTestManager(t, path, &params.PrivNetParams, &config.Config{MaxPeers: 8})
+	defer db.Close()
+
+	newGS := func(seed byte) *blockdag.GraphState {
+		gs := blockdag.NewGraphState()
+		gs.GetTips().AddPair(&hash.Hash{seed}, true)
+		gs.SetTotal(2)
+		return gs
+	}
+	addPeer := func(gs *blockdag.GraphState) {
+		sp := newTestPeer(gs)
+		m.peers[sp.Peer] = sp
+	}
+	gs := newGS(1)
+
+	if m.isGraphStateConfirmed(gs) {
+		t.Fatal("graph state confirmed without peers")
+	}
+	// A single connected peer is trusted.
+	addPeer(gs)
+	if !m.isGraphStateConfirmed(gs) {
+		t.Fatal("graph state of the only peer not confirmed")
+	}
+	// Another peer disagreeing keeps it from being adopted.
+	addPeer(newGS(2))
+	if m.isGraphStateConfirmed(gs) {
+		t.Fatal("graph state confirmed by a single peer out of two")
+	}
+	addPeer(gs)
+	if !m.isGraphStateConfirmed(gs) {
+		t.Fatal("graph state of two peers not confirmed")
+	}
+}
+
+func TestUnknownMainChain(t *testing.T) {
+	path, remove := testDBPath(t)
+	defer remove()
+	m, db := newTestManager(t, path, &params.PrivNetParams, &config.Config{MaxPeers: 8})
+	defer db.Close()
+
+	header := mineHeader(t, 1, 0x207fffff)
+	if err := m.processHeaders([]*types.BlockHeader{header}); err != nil {
+		t.Fatal(err)
+	}
+	api := NewPublicHeaderAPI(m)
+	h := header.BlockHash()
+	if res, err := api.IsOnMainChain(h); err == nil {
+		t.Fatalf("got %v for a header not known to be on the main chain, want an error", res)
+	}
+	res, err := api.IsOnMainChain(*params.PrivNetParams.GenesisHash)
+	if err != nil || res != "true" {
+		t.Fatalf("got %v %v for the genesis, want true", res, err)
+	}
+}
+
+func TestIsCurrentAfterStop(t *testing.T) {
+	path, remove := testDBPath(t)
+	defer remove()
+	m, db := newTestManager(t, path, &params.PrivNetParams, &config.Config{MaxPeers: 8})
+	defer db.Close()
+
+	m.Start()
+	if m.IsCurrent() {
+		t.Fatal("current without peers")
+	}
+	m.Stop()
+
+	done := make(chan bool)
+	go func() { done <- m.IsCurrent() }()
+	select {
+	case current := <-done:
+		if current {
+			t.Fatal("current after stop")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("IsCurrent blocked after stop")
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package hdrmgr
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/btceasypay/bitcoinpay/core/blockchain"
+	"github.com/btceasypay/bitcoinpay/core/blockdag"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/database"
+)
+
+// checkHeader performs the checks which only need the header itself: the
+// proof of work and the timestamp.  The headers do not commit to their
+// parents, so the light node can not check the difficulty adjustments and
+// does not know the main height of the header either.  The proof of work is
+// verified as of the main height where the graph weight adjustment of the
+// proof of work ends, which skips the checks depending on the main height
+// rather than applying them to a wrong one.
+func (m *HeaderManager) checkHeader(header *types.BlockHeader) error {
+	header.Pow.SetParams(m.params.PowConfig)
+	header.Pow.SetMainHeight(m.params.PowConfig.AdjustmentStartMainHeight)
+	err := header.Pow.Verify(header.BlockData(), header.BlockHash(), header.Difficulty)
+	if err != nil {
+		return err
+	}
+
+	// A block timestamp must not have a greater precision than one second.
+	if !header.Timestamp.Equal(time.Unix(header.Timestamp.Unix(), 0)) {
+		return fmt.Errorf("block timestamp of %v has a higher precision "+
+			"than one second", header.Timestamp)
+	}
+
+	// Ensure the block time is not too far in the future.
+	maxTimestamp := m.timeSource.AdjustedTime().Add(time.Second *
+		blockchain.MaxTimeOffsetSeconds)
+	if header.Timestamp.After(maxTimestamp) {
+		return fmt.Errorf("block timestamp of %v is too far in the future",
+			header.Timestamp)
+	}
+	return nil
+}
+
+// checkCheckpoints ensures the headers contain the checkpoints up to the layer
+// of the graph state, which the peers must have passed to reach it.
+func (m *HeaderManager) checkCheckpoints(dbTx database.Tx, gs *blockdag.GraphState) error {
+	if m.noCheckpoints {
+		return nil
+	}
+	for _, checkpoint := range m.params.Checkpoints {
+		if checkpoint.Layer > uint64(gs.GetLayer()) {
+			break
+		}
+		if _, ok := dbFetchHeaderIndex(dbTx, checkpoint.Hash); !ok {
+			return fmt.Errorf("graph state %s at layer %d misses the "+
+				"checkpoint %s at layer %d", gs, gs.GetLayer(),
+				checkpoint.Hash, checkpoint.Layer)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,473 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package index
+
+import (
+	"fmt"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/blockchain"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/database"
+	"github.com/btceasypay/bitcoinpay/engine/txscript"
+	"github.com/btceasypay/bitcoinpay/params"
+)
+
+const (
+	// assetIndexName is the human-readable name for the index.
+	assetIndexName = "asset index"
+
+	// assetInfoSize is the size of a serialized asset info entry.
+	assetInfoSize = hash.HashSize + 8 + 8
+
+	// assetHolderSize is the size of the public key hash of an asset
+	// holder.
+	assetHolderSize = 20
+
+	// assetBalanceKeySize is the size of a key in the balance bucket.
+	assetBalanceKeySize = assetHolderSize + types.AssetIDSize
+)
+
+var (
+	// assetIndexKey is the key of the asset index and the db bucket used
+	// to house it.
+	assetIndexKey = []byte("assetidx")
+
+	// assetInfoBucketName is the name of the nested bucket which houses
+	// the issue transaction and the issued and revoked amounts of each
+	// asset.
+	assetInfoBucketName = []byte("info")
+
+	// assetBalanceBucketName is the name of the nested bucket which houses
+	// the asset balances of the holders.
+	assetBalanceBucketName = []byte("balance")
+)
+
+// -----------------------------------------------------------------------------
+// The asset index tracks the assets created by AssetIssue transactions and the
+// amounts of them held by each public key hash.
+//
+// The serialized format for keys and values in the info bucket is:
+//   <asset id> = <issue tx hash><issued><revoked>
+//
+//   Field           Type              Size
+//   asset id        types.AssetID     32 bytes
+//   issue tx hash   hash.Hash         32 bytes
+//   issued          uint64            8 bytes
+//   revoked         uint64            8 bytes
+//
+// The serialized format for keys and values in the balance bucket is:
+//   <holder><asset id> = <amount>
+//
+//   Field           Type              Size
+//   holder          hash160           20 bytes
+//   asset id        types.AssetID     32 bytes
+//   amount          uint64            8 bytes
+//
+// Balances dropping to zero are removed from the bucket.
+// -----------------------------------------------------------------------------
+
+// AssetInfo describes an asset known by the asset index.
+type AssetInfo struct {
+	ID      types.AssetID
+	IssueTx hash.Hash
+	Issued  uint64
+	Revoked uint64
+}
+
+// AssetBalance is the amount of an asset held by a public key hash.
+type AssetBalance struct {
+	ID     types.AssetID
+	Amount uint64
+}
+
+func serializeAssetInfo(info *AssetInfo) []byte {
+	serialized := make([]byte, assetInfoSize)
+	copy(serialized, info.IssueTx[:])
+	byteOrder.PutUint64(serialized[hash.HashSize:], info.Issued)
+	byteOrder.PutUint64(serialized[hash.HashSize+8:], info.Revoked)
+	return serialized
+}
+
+func deserializeAssetInfo(id []byte, serialized []byte) (*AssetInfo, error) {
+	if len(id) != types.AssetIDSize || len(serialized) != assetInfoSize {
+		return nil, errDeserialize("unexpected asset info entry size")
+	}
+	info := &AssetInfo{
+		Issued:  byteOrder.Uint64(serialized[hash.HashSize:]),
+		Revoked: byteOrder.Uint64(serialized[hash.HashSize+8:]),
+	}
+	copy(info.ID[:], id)
+	copy(info.IssueTx[:], serialized[:hash.HashSize])
+	return info, nil
+}
+
+func assetBalanceKey(holder []byte, id *types.AssetID) []byte {
+	key := make([]byte, assetBalanceKeySize)
+	copy(key, holder)
+	copy(key[assetHolderSize:], id[:])
+	return key
+}
+
+// assetDelta is the change of the asset index caused by a block.
+type assetDelta struct {
+	// issueTxs are the issue transactions of the assets created by the
+	// block.
+	issueTxs map[types.AssetID]hash.Hash
+
+	// issued and revoked are the amounts of the assets issued and
+	// revoked by the block.
+	issued  map[types.AssetID]uint64
+	revoked map[types.AssetID]uint64
+
+	// credits and debits are the amounts of the assets received and
+	// spent by the holders, keyed by the serialized balance key.
+	credits map[string]uint64
+	debits  map[string]uint64
+}
+
+// AssetIndex implements an index of the assets issued on the DAG and of the
+// asset balances of their holders.
+type AssetIndex struct {
+	db          database.DB
+	chainParams *params.Params
+	chain       *blockchain.BlockChain
+}
+
+// Ensure the AssetIndex type implements the Indexer interface.
+var _ Indexer = (*AssetIndex)(nil)
+
+// Ensure the AssetIndex type implements the NeedsInputser interface.
+var _ NeedsInputser = (*AssetIndex)(nil)
+
+// NeedsInputs signals that the index requires the referenced inputs in order
+// to properly create the index.
+//
+// This implements the NeedsInputser interface.
+func (idx *AssetIndex) NeedsInputs() bool {
+	return true
+}
+
+// Init is only provided to satisfy the Indexer interface as there is nothing to
+// initialize for this index.
+//
+// This is part of the Indexer interface.
+func (idx *AssetIndex) Init() error {
+	return nil
+}
+
+// Key returns the database key to use for the index as a byte slice.
+//
+// This is part of the Indexer interface.
+func (idx *AssetIndex) Key() []byte {
+	return assetIndexKey
+}
+
+// Name returns the human-readable name of the index.
+//
+// This is part of the Indexer interface.
+func (idx *AssetIndex) Name() string {
+	return assetIndexName
+}
+
+// Create is invoked when the indexer manager determines the index needs to be
+// created for the first time.  It creates the buckets for the asset infos and
+// the balances.
+//
+// This is part of the Indexer interface.
+func (idx *AssetIndex) Create(dbTx database.Tx) error {
+	bucket, err := dbTx.Metadata().CreateBucket(assetIndexKey)
+	if err != nil {
+		return err
+	}
+	if _, err := bucket.CreateBucket(assetInfoBucketName); err != nil {
+		return err
+	}
+	_, err = bucket.CreateBucket(assetBalanceBucketName)
+	return err
+}
+
+// ConnectBlock is invoked by the index manager when a new block has been
+// connected to the DAG order.  It records the assets issued and revoked by the
+// block and updates the balances of the holders.
+//
+// This is part of the Indexer interface.
+func (idx *AssetIndex) ConnectBlock(dbTx database.Tx, block *types.SerializedBlock, stxos []blockchain.SpentTxOut) error {
+	delta, err := idx.indexAssets(block, stxos)
+	if err != nil {
+		return err
+	}
+	bucket := dbTx.Metadata().Bucket(assetIndexKey)
+	infoBucket := bucket.Bucket(assetInfoBucketName)
+	for id, txHash := range delta.issueTxs {
+		info := &AssetInfo{ID: id, IssueTx: txHash}
+		if err := infoBucket.Put(id[:], serializeAssetInfo(info)); err != nil {
+			return err
+		}
+	}
+	err = updateAssetInfos(infoBucket, delta, func(info *AssetInfo, id types.AssetID) {
+		info.Issued += delta.issued[id]
+		info.Revoked += delta.revoked[id]
+	})
+	if err != nil {
+		return err
+	}
+	return updateAssetBalances(bucket.Bucket(assetBalanceBucketName),
+		delta.credits, delta.debits)
+}
+
+// DisconnectBlock is invoked by the index manager when a block has been
+// disconnected from the DAG order.  It reverts everything ConnectBlock recorded
+// for the block.
+//
+// This is part of the Indexer interface.
+func (idx *AssetIndex) DisconnectBlock(dbTx database.Tx, block *types.SerializedBlock, stxos []blockchain.SpentTxOut) error {
+	delta, err := idx.indexAssets(block, stxos)
+	if err != nil {
+		return err
+	}
+	bucket := dbTx.Metadata().Bucket(assetIndexKey)
+	infoBucket := bucket.Bucket(assetInfoBucketName)
+	err = updateAssetInfos(infoBucket, delta, func(info *AssetInfo, id types.AssetID) {
+		info.Issued -= delta.issued[id]
+		info.Revoked -= delta.revoked[id]
+	})
+	if err != nil {
+		return err
+	}
+	for id := range delta.issueTxs {
+		if err := infoBucket.Delete(id[:]); err != nil {
+			return err
+		}
+	}
+	return updateAssetBalances(bucket.Bucket(assetBalanceBucketName),
+		delta.debits, delta.credits)
+}
+
+// updateAssetInfos applies the update to the infos of the assets issued or
+// revoked by the block.
+func updateAssetInfos(bucket database.Bucket, delta *assetDelta,
+	update func(info *AssetInfo, id types.AssetID)) error {
+	ids := make(map[types.AssetID]struct{})
+	for id := range delta.issued {
+		ids[id] = struct{}{}
+	}
+	for id := range delta.revoked {
+		ids[id] = struct{}{}
+	}
+	for id := range ids {
+		info, err := deserializeAssetInfo(id[:], bucket.Get(id[:]))
+		if err != nil {
+			return AssertError(fmt.Sprintf("asset %v: %v", id, err))
+		}
+		update(info, id)
+		if err := bucket.Put(id[:], serializeAssetInfo(info)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateAssetBalances adds the credits to and subtracts the debits from the
+// balances, removing the balances dropping to zero.
+func updateAssetBalances(bucket database.Bucket, credits, debits map[string]uint64) error {
+	keys := make(map[string]struct{})
+	for key := range credits {
+		keys[key] = struct{}{}
+	}
+	for key := range debits {
+		keys[key] = struct{}{}
+	}
+	for key := range keys {
+		var balance uint64
+		if serialized := bucket.Get([]byte(key)); len(serialized) == 8 {
+			balance = byteOrder.Uint64(serialized)
+		}
+		balance += credits[key]
+		if debits[key] > balance {
+			return AssertError(fmt.Sprintf("asset balance %x drops "+
+				"below zero", key))
+		}
+		balance -= debits[key]
+		if balance == 0 {
+			if err := bucket.Delete([]byte(key)); err != nil {
+				return err
+			}
+			continue
+		}
+		var serialized [8]byte
+		byteOrder.PutUint64(serialized[:], balance)
+		if err := bucket.Put([]byte(key), serialized[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexAssets returns the change of the asset index caused by the block.  The
+// transactions whose spent outputs are not available, such as the ones of a
+// block which is invalid in the DAG, did not change the utxo set and are not
+// indexed.  Like the consensus rules, the asset outputs and markers of the
+// blocks before the assets deployment is active carry no asset.
+func (idx *AssetIndex) indexAssets(block *types.SerializedBlock, stxos []blockchain.SpentTxOut) (*assetDelta, error) {
+	delta := &assetDelta{
+		issueTxs: make(map[types.AssetID]hash.Hash),
+		issued:   make(map[types.AssetID]uint64),
+		revoked:  make(map[types.AssetID]uint64),
+		credits:  make(map[string]uint64),
+		debits:   make(map[string]uint64),
+	}
+	active, err := idx.chain.AssetsActiveAt(block.Hash())
+	if err != nil || !active {
+		return delta, err
+	}
+	type inputKey struct{ txIndex, txInIndex uint32 }
+	spent := make(map[inputKey]*blockchain.SpentTxOut, len(stxos))
+	for i := range stxos {
+		spent[inputKey{stxos[i].TxIndex, stxos[i].TxInIndex}] = &stxos[i]
+	}
+
+	for txIdx, tx := range block.Transactions() {
+		// Coinbases can not carry assets.
+		if txIdx == 0 || tx.IsDuplicate {
+			continue
+		}
+		msgTx := tx.Transaction()
+		inputs := make([]*blockchain.SpentTxOut, len(msgTx.TxIn))
+		for i := range msgTx.TxIn {
+			inputs[i] = spent[inputKey{uint32(txIdx), uint32(i)}]
+			if inputs[i] == nil {
+				break
+			}
+		}
+		if len(inputs) == 0 || inputs[len(inputs)-1] == nil {
+			continue
+		}
+
+		assetIn := make(map[types.AssetID]uint64)
+		for _, stxo := range inputs {
+			id, amount, ok := txscript.ExtractAsset(stxo.PkScript)
+			if !ok {
+				continue
+			}
+			active, err := idx.chain.AssetsActiveAt(&stxo.BlockHash)
+			if err != nil {
+				return nil, err
+			}
+			if !active {
+				continue
+			}
+			assetIn[id] += amount
+			delta.debits[string(assetBalanceKey(idx.assetHolder(stxo.PkScript), &id))] += amount
+		}
+		assetOut := make(map[types.AssetID]uint64)
+		for _, txOut := range msgTx.TxOut {
+			id, amount, ok := txscript.ExtractAsset(txOut.PkScript)
+			if !ok {
+				continue
+			}
+			assetOut[id] += amount
+			delta.credits[string(assetBalanceKey(idx.assetHolder(txOut.PkScript), &id))] += amount
+		}
+
+		switch txType, id, _ := msgTx.AssetMarker(); txType {
+		case types.AssetIssue:
+			issuer := idx.assetHolder(inputs[0].PkScript)
+			id = types.NewAssetID(issuer, &msgTx.TxIn[0].PreviousOut)
+			delta.issueTxs[id] = *tx.Hash()
+			delta.issued[id] += assetOut[id]
+
+		case types.AssetRevoke:
+			if assetIn[id] > assetOut[id] {
+				delta.revoked[id] += assetIn[id] - assetOut[id]
+			}
+		}
+	}
+	return delta, nil
+}
+
+// assetHolder returns the public key hash paid by a pay-to-pubkey-hash or an
+// asset output script.
+func (idx *AssetIndex) assetHolder(pkScript []byte) []byte {
+	_, addrs, _, err := txscript.ExtractPkScriptAddrs(pkScript, idx.chainParams)
+	if err != nil || len(addrs) != 1 {
+		return nil
+	}
+	return addrs[0].ScriptAddress()
+}
+
+// AssetInfo returns the info of the asset, or nil when the asset is unknown.
+func (idx *AssetIndex) AssetInfo(id *types.AssetID) (*AssetInfo, error) {
+	var info *AssetInfo
+	err := idx.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(assetIndexKey).Bucket(assetInfoBucketName)
+		serialized := bucket.Get(id[:])
+		if serialized == nil {
+			return nil
+		}
+		var err error
+		info, err = deserializeAssetInfo(id[:], serialized)
+		return err
+	})
+	return info, err
+}
+
+// Assets returns the infos of all the assets known by the index.
+func (idx *AssetIndex) Assets() ([]*AssetInfo, error) {
+	var infos []*AssetInfo
+	err := idx.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(assetIndexKey).Bucket(assetInfoBucketName)
+		return bucket.ForEach(func(k, v []byte) error {
+			info, err := deserializeAssetInfo(k, v)
+			if err != nil {
+				return err
+			}
+			infos = append(infos, info)
+			return nil
+		})
+	})
+	return infos, err
+}
+
+// Balances returns the amounts of the assets held by the public key hash.
+func (idx *AssetIndex) Balances(holder []byte) ([]*AssetBalance, error) {
+	if len(holder) != assetHolderSize {
+		return nil, fmt.Errorf("invalid public key hash length of %d",
+			len(holder))
+	}
+	var balances []*AssetBalance
+	err := idx.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(assetIndexKey).Bucket(assetBalanceBucketName)
+		cursor := bucket.Cursor()
+		for ok := cursor.Seek(holder); ok; ok = cursor.Next() {
+			k := cursor.Key()
+			if len(k) != assetBalanceKeySize ||
+				string(k[:assetHolderSize]) != string(holder) {
+				break
+			}
+			balance := &AssetBalance{Amount: byteOrder.Uint64(cursor.Value())}
+			copy(balance.ID[:], k[assetHolderSize:])
+			balances = append(balances, balance)
+		}
+		return nil
+	})
+	return balances, err
+}
+
+// NewAssetIndex returns a new instance of an indexer that is used to create a
+// mapping of the assets and of the asset balances of their holders.
+//
+// It implements the Indexer interface which plugs into the IndexManager that in
+// turn is used by the blockchain package.  This allows the index to be
+// seamlessly maintained along with the chain.
+func NewAssetIndex(db database.DB, chainParams *params.Params) *AssetIndex {
+	return &AssetIndex{db: db, chainParams: chainParams}
+}
+
+// DropAssetIndex drops the asset index from the provided database if it
+// exists.
+func DropAssetIndex(db database.DB, interrupt <-chan struct{}) error {
+	return dropIndex(db, assetIndexKey, assetIndexName, interrupt)
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+
+package index
+
+import (
+	"encoding/hex"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/message"
+	"github.com/btceasypay/bitcoinpay/rpc"
+)
+
+// APIs returns the RPC APIs served by the committed filter index.
+func (idx *CfIndex) APIs() []rpc.API {
+	return []rpc.API{
+		{
+			NameSpace: rpc.DefaultServiceNameSpace,
+			Service:   NewPublicCfIndexAPI(idx),
+			Public:    true,
+		},
+	}
+}
+
+// PublicCfIndexAPI provides an API to access the committed filters of the
+// blocks.
+type PublicCfIndexAPI struct {
+	idx *CfIndex
+}
+
+// NewPublicCfIndexAPI creates a new API for the committed filter index.
+func NewPublicCfIndexAPI(idx *CfIndex) *PublicCfIndexAPI {
+	return &PublicCfIndexAPI{idx}
+}
+
+// filterTypeOf returns the requested filter type, the regular filter being
+// the default one.
+func filterTypeOf(filterType *uint8) (message.FilterType, error) {
+	if filterType == nil {
+		return message.GCSFilterRegular, nil
+	}
+	if *filterType > maxFilterType {
+		return 0, rpc.RpcInvalidError("Unsupported filter type %d", *filterType)
+	}
+	return message.FilterType(*filterType), nil
+}
+
+// GetCFilter returns the hex-encoded committed filter of the block.
+func (api *PublicCfIndexAPI) GetCFilter(h hash.Hash, filterType *uint8) (interface{}, error) {
+	ft, err := filterTypeOf(filterType)
+	if err != nil {
+		return nil, err
+	}
+	filterBytes, err := api.idx.FilterByBlockHash(&h, ft)
+	if err == errNoCFilter {
+		return nil, rpc.RpcInvalidError("No committed filter for block %s", h)
+	}
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Committed filter")
+	}
+	return hex.EncodeToString(filterBytes), nil
+}
+
+// GetCFHeader returns the committed filter header of the block.
+func (api *PublicCfIndexAPI) GetCFHeader(h hash.Hash, filterType *uint8) (interface{}, error) {
+	ft, err := filterTypeOf(filterType)
+	if err != nil {
+		return nil, err
+	}
+	headerBytes, err := api.idx.FilterHeaderByBlockHash(&h, ft)
+	if err == errNoCFilter {
+		return nil, rpc.RpcInvalidError("No committed filter header for block %s", h)
+	}
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Committed filter header")
+	}
+	header, err := hash.NewHash(headerBytes)
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Committed filter header")
+	}
+	return header.String(), nil
+}
@@ -0,0 +1,365 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Copyright (c) 2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package index
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/blockchain"
+	"github.com/btceasypay/bitcoinpay/core/message"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/database"
+	"github.com/btceasypay/bitcoinpay/services/cf"
+)
+
+const (
+	// cfIndexName is the human-readable name for the index.
+	cfIndexName = "committed filter index"
+)
+
+var (
+	// cfIndexParentBucketKey is the name of the parent bucket used to
+	// house the index.  The rest of the buckets live below this bucket.
+	cfIndexParentBucketKey = []byte("cfindexparentbucket")
+
+	// cfIndexKeys is an array of db bucket names used to house indexes of
+	// block hashes to cfilters.
+	cfIndexKeys = [][]byte{
+		[]byte("cf0byhashidx"),
+	}
+
+	// cfHeaderKeys is an array of db bucket names used to house indexes of
+	// block hashes to cf headers.
+	cfHeaderKeys = [][]byte{
+		[]byte("cf0headerbyhashidx"),
+	}
+
+	// cfHashKeys is an array of db bucket names used to house indexes of
+	// block hashes to cf hashes.
+	cfHashKeys = [][]byte{
+		[]byte("cf0hashbyhashidx"),
+	}
+
+	// cfOrderKeys is an array of db bucket names used to house indexes of
+	// block orders to block hashes and cf headers.  They chain the filter
+	// headers in DAG order.
+	cfOrderKeys = [][]byte{
+		[]byte("cf0headerbyorderidx"),
+	}
+
+	// maxFilterType is the highest filter type supported by the index.
+	maxFilterType = uint8(len(cfHeaderKeys) - 1)
+
+	// errNoCFilter signifies that the filter of a block is not indexed.
+	errNoCFilter = errors.New("no committed filter for the block")
+)
+
+// CfIndex implements a committed filter (cf) by hash index.
+type CfIndex struct {
+	db database.DB
+}
+
+// Ensure the CfIndex type implements the Indexer interface.
+var _ Indexer = (*CfIndex)(nil)
+
+// Ensure the CfIndex type implements the NeedsInputser interface.
+var _ NeedsInputser = (*CfIndex)(nil)
+
+// NeedsInputs signals that the index requires the referenced inputs in order
+// to properly create the index.
+//
+// This implements the NeedsInputser interface.
+func (idx *CfIndex) NeedsInputs() bool {
+	return true
+}
+
+// Init initializes the hash-based cf index. This is part of the Indexer
+// interface.
+func (idx *CfIndex) Init() error {
+	return nil // Nothing to do.
+}
+
+// Key returns the database key to use for the index as a byte slice. This is
+// part of the Indexer interface.
+func (idx *CfIndex) Key() []byte {
+	return cfIndexParentBucketKey
+}
+
+// Name returns the human-readable name of the index. This is part of the
+// Indexer interface.
+func (idx *CfIndex) Name() string {
+	return cfIndexName
+}
+
+// Create is invoked when the indexer manager determines the index needs to
+// be created for the first time. It creates buckets for the filter types
+// supported by the index.
+func (idx *CfIndex) Create(dbTx database.Tx) error {
+	meta := dbTx.Metadata()
+
+	cfIndexParentBucket, err := meta.CreateBucket(cfIndexParentBucketKey)
+	if err != nil {
+		return err
+	}
+	for _, keys := range [][][]byte{cfIndexKeys, cfHeaderKeys, cfHashKeys, cfOrderKeys} {
+		for _, bucketName := range keys {
+			_, err = cfIndexParentBucket.CreateBucket(bucketName)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// orderKey returns the key of the order buckets, in big endian so the orders
+// are iterated in sequence.
+func orderKey(order uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, order)
+	return key
+}
+
+// storeFilter stores a given filter, and performs the steps needed to
+// generate the filter's header.
+func storeFilter(dbTx database.Tx, block *types.SerializedBlock, f *cf.Filter,
+	filterType message.FilterType) error {
+	if uint8(filterType) > maxFilterType {
+		return errors.New("unsupported filter type")
+	}
+
+	// Figure out which buckets to use.
+	fkey := cfIndexKeys[filterType]
+	hkey := cfHeaderKeys[filterType]
+	hashkey := cfHashKeys[filterType]
+	okey := cfOrderKeys[filterType]
+
+	// Start by storing the filter.
+	h := block.Hash()
+	filterBytes := f.NBytes()
+	err := dbStoreFilterIdxEntry(dbTx, fkey, h[:], filterBytes)
+	if err != nil {
+		return err
+	}
+
+	// Next store the filter hash.
+	filterHash := f.Hash()
+	err = dbStoreFilterIdxEntry(dbTx, hashkey, h[:], filterHash[:])
+	if err != nil {
+		return err
+	}
+
+	// Then fetch the previous filter header in DAG order, the genesis block
+	// is chained to the zero hash.
+	var prevHeader hash.Hash
+	order := block.Order()
+	if order > 0 {
+		entry, err := dbFetchFilterIdxEntry(dbTx, okey, orderKey(order-1))
+		if err != nil {
+			return err
+		}
+		if len(entry) != 2*hash.HashSize {
+			return fmt.Errorf("missing filter header of order %d", order-1)
+		}
+		copy(prevHeader[:], entry[hash.HashSize:])
+	}
+
+	// Construct the new block's filter header, and store it.
+	fh := cf.MakeHeaderForFilterHash(filterHash, &prevHeader)
+	err = dbStoreFilterIdxEntry(dbTx, hkey, h[:], fh[:])
+	if err != nil {
+		return err
+	}
+	orderEntry := make([]byte, 2*hash.HashSize)
+	copy(orderEntry, h[:])
+	copy(orderEntry[hash.HashSize:], fh[:])
+	return dbStoreFilterIdxEntry(dbTx, okey, orderKey(order), orderEntry)
+}
+
+// ConnectBlock is invoked by the index manager when a new block has been
+// connected to the DAG order. This indexer adds a hash-to-cf mapping for
+// every passed block. This is part of the Indexer interface.
+func (idx *CfIndex) ConnectBlock(dbTx database.Tx, block *types.SerializedBlock,
+	stxos []blockchain.SpentTxOut) error {
+
+	prevScripts := make([][]byte, len(stxos))
+	for i, stxo := range stxos {
+		prevScripts[i] = stxo.PkScript
+	}
+
+	f, err := cf.BuildBasicFilter(block, prevScripts)
+	if err != nil {
+		return err
+	}
+
+	return storeFilter(dbTx, block, f, message.GCSFilterRegular)
+}
+
+// DisconnectBlock is invoked by the index manager when a block has been
+// disconnected from the DAG order.  This indexer removes the hash-to-cf
+// mapping for every passed block. This is part of the Indexer interface.
+func (idx *CfIndex) DisconnectBlock(dbTx database.Tx, block *types.SerializedBlock,
+	_ []blockchain.SpentTxOut) error {
+
+	h := block.Hash()
+	for _, key := range cfIndexKeys {
+		err := dbDeleteFilterIdxEntry(dbTx, key, h[:])
+		if err != nil {
+			return err
+		}
+	}
+	for _, key := range cfHeaderKeys {
+		err := dbDeleteFilterIdxEntry(dbTx, key, h[:])
+		if err != nil {
+			return err
+		}
+	}
+	for _, key := range cfHashKeys {
+		err := dbDeleteFilterIdxEntry(dbTx, key, h[:])
+		if err != nil {
+			return err
+		}
+	}
+	for _, key := range cfOrderKeys {
+		err := dbDeleteFilterIdxEntry(dbTx, key, orderKey(block.Order()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entryByBlockHash fetches a filter index entry of a particular type
+// (eg. filter, filter header, etc) for a filter type and block hash.
+func (idx *CfIndex) entryByBlockHash(filterTypeKeys [][]byte,
+	filterType message.FilterType, h *hash.Hash) ([]byte, error) {
+
+	if uint8(filterType) > maxFilterType {
+		return nil, errors.New("unsupported filter type")
+	}
+	key := filterTypeKeys[filterType]
+
+	var entry []byte
+	err := idx.db.View(func(dbTx database.Tx) error {
+		var err error
+		entry, err = dbFetchFilterIdxEntry(dbTx, key, h[:])
+		return err
+	})
+	if err == nil && entry == nil {
+		err = errNoCFilter
+	}
+	return entry, err
+}
+
+// FilterByBlockHash returns the serialized contents of a block's basic
+// committed filter.
+func (idx *CfIndex) FilterByBlockHash(h *hash.Hash,
+	filterType message.FilterType) ([]byte, error) {
+	return idx.entryByBlockHash(cfIndexKeys, filterType, h)
+}
+
+// FilterHeaderByBlockHash returns the serialized contents of a block's basic
+// committed filter header.
+func (idx *CfIndex) FilterHeaderByBlockHash(h *hash.Hash,
+	filterType message.FilterType) ([]byte, error) {
+	return idx.entryByBlockHash(cfHeaderKeys, filterType, h)
+}
+
+// FilterHashByBlockHash returns the serialized contents of a block's basic
+// committed filter hash.
+func (idx *CfIndex) FilterHashByBlockHash(h *hash.Hash,
+	filterType message.FilterType) ([]byte, error) {
+	return idx.entryByBlockHash(cfHashKeys, filterType, h)
+}
+
+// FilterHashesByOrderRange returns the filter hashes of the blocks from the
+// start order to the stop order in DAG order, along with the filter header
+// of the block before the start order.
+func (idx *CfIndex) FilterHashesByOrderRange(filterType message.FilterType,
+	startOrder, stopOrder uint64) ([]*hash.Hash, *hash.Hash, error) {
+
+	if uint8(filterType) > maxFilterType {
+		return nil, nil, errors.New("unsupported filter type")
+	}
+	if stopOrder < startOrder {
+		return nil, nil, fmt.Errorf("stop order %d is before start order %d",
+			stopOrder, startOrder)
+	}
+	okey := cfOrderKeys[filterType]
+	hashkey := cfHashKeys[filterType]
+
+	var prevHeader hash.Hash
+	hashes := make([]*hash.Hash, 0, stopOrder-startOrder+1)
+	err := idx.db.View(func(dbTx database.Tx) error {
+		if startOrder > 0 {
+			entry, err := dbFetchFilterIdxEntry(dbTx, okey, orderKey(startOrder-1))
+			if err != nil {
+				return err
+			}
+			if len(entry) != 2*hash.HashSize {
+				return errNoCFilter
+			}
+			copy(prevHeader[:], entry[hash.HashSize:])
+		}
+		for order := startOrder; order <= stopOrder; order++ {
+			entry, err := dbFetchFilterIdxEntry(dbTx, okey, orderKey(order))
+			if err != nil {
+				return err
+			}
+			if len(entry) != 2*hash.HashSize {
+				return errNoCFilter
+			}
+			filterHash, err := dbFetchFilterIdxEntry(dbTx, hashkey, entry[:hash.HashSize])
+			if err != nil {
+				return err
+			}
+			if len(filterHash) != hash.HashSize {
+				return errNoCFilter
+			}
+			var h hash.Hash
+			copy(h[:], filterHash)
+			hashes = append(hashes, &h)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return hashes, &prevHeader, nil
+}
+
+// dbFetchFilterIdxEntry retrieves a data blob from the filter index database.
+// An entry's absence is not considered an error.
+func dbFetchFilterIdxEntry(dbTx database.Tx, key []byte, k []byte) ([]byte, error) {
+	idx := dbTx.Metadata().Bucket(cfIndexParentBucketKey).Bucket(key)
+	return idx.Get(k), nil
+}
+
+// dbStoreFilterIdxEntry stores a data blob in the filter index database.
+func dbStoreFilterIdxEntry(dbTx database.Tx, key []byte, k []byte, f []byte) error {
+	idx := dbTx.Metadata().Bucket(cfIndexParentBucketKey).Bucket(key)
+	return idx.Put(k, f)
+}
+
+// dbDeleteFilterIdxEntry deletes a data blob from the filter index database.
+func dbDeleteFilterIdxEntry(dbTx database.Tx, key []byte, k []byte) error {
+	idx := dbTx.Metadata().Bucket(cfIndexParentBucketKey).Bucket(key)
+	return idx.Delete(k)
+}
+
+// NewCfIndex returns a new instance of an indexer that is used to create a
+// mapping of the hashes of all blocks in the blockchain to their respective
+// committed filters.
+//
+// It implements the Indexer interface which plugs into the IndexManager that
+// in turn is used by the blockchain package. This allows the index to be
+// seamlessly maintained along with the chain.
+func NewCfIndex(db database.DB) *CfIndex {
+	return &CfIndex{db: db}
+}
@@ -0,0 +1,167 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package index
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/blockchain"
+	"github.com/btceasypay/bitcoinpay/core/message"
+	"github.com/btceasypay/bitcoinpay/core/protocol"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/core/types/pow"
+	"github.com/btceasypay/bitcoinpay/database"
+	_ "github.com/btceasypay/bitcoinpay/database/memdb"
+	"github.com/btceasypay/bitcoinpay/services/cf"
+)
+
+// cfTestBlock returns a block of the order with a transaction paying to the
+// script and spending an output.
+func cfTestBlock(order uint64, pkScript []byte) *types.SerializedBlock {
+	tx := types.NewTransaction()
+	prevOut := types.NewOutPoint(&hash.Hash{byte(order)}, 0)
+	tx.AddTxIn(types.NewTxInput(prevOut, nil))
+	tx.AddTxOut(types.NewTxOutput(uint64(order+1), pkScript))
+
+	msgBlock := &types.Block{
+		Header: types.BlockHeader{Pow: pow.GetInstance(pow.BLAKE2BD, uint32(order), []byte{})},
+	}
+	msgBlock.AddTransaction(tx)
+	block := types.NewBlock(msgBlock)
+	block.SetOrder(order)
+	return block
+}
+
+// TestCfIndex connects a small chain to the index, checks its filters and the
+// chain of filter headers, and disconnects the tip.
+func TestCfIndex(t *testing.T) {
+	db, err := database.Create("memdb", "cfindex", protocol.MainNet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	idx := NewCfIndex(db)
+	err = db.Update(func(dbTx database.Tx) error {
+		return idx.Create(dbTx)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const numBlocks = 4
+	blocks := make([]*types.SerializedBlock, numBlocks)
+	spent := make([][]byte, numBlocks)
+	for i := range blocks {
+		pkScript := []byte{0x76, 0xa9, 0x14, byte(i), 0x88, 0xac}
+		blocks[i] = cfTestBlock(uint64(i), pkScript)
+		spent[i] = []byte{0x51, byte(i)}
+	}
+	for i, block := range blocks {
+		stxos := []blockchain.SpentTxOut{{PkScript: spent[i]}}
+		err := db.Update(func(dbTx database.Tx) error {
+			return idx.ConnectBlock(dbTx, block, stxos)
+		})
+		if err != nil {
+			t.Fatalf("connect block %d: %v", i, err)
+		}
+	}
+
+	// The filters match the created and the spent scripts, and the headers
+	// chain the filter hashes in order.
+	var prevHeader hash.Hash
+	wantHashes := make([]*hash.Hash, numBlocks)
+	for i, block := range blocks {
+		filterBytes, err := idx.FilterByBlockHash(block.Hash(), message.GCSFilterRegular)
+		if err != nil {
+			t.Fatalf("filter of block %d: %v", i, err)
+		}
+		f, err := cf.FromNBytes(cf.DefaultP, cf.DefaultM, filterBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key := cf.DeriveKey(block.Hash())
+		created := block.Transactions()[0].Tx.TxOut[0].PkScript
+		for _, script := range [][]byte{created, spent[i]} {
+			match, err := f.Match(key, script)
+			if err != nil || !match {
+				t.Fatalf("filter of block %d doesn't match %x: %v", i, script, err)
+			}
+		}
+
+		filterHash := f.Hash()
+		gotHash, err := idx.FilterHashByBlockHash(block.Hash(), message.GCSFilterRegular)
+		if err != nil || !bytes.Equal(gotHash, filterHash[:]) {
+			t.Fatalf("filter hash of block %d: got %x, want %x (%v)", i,
+				gotHash, filterHash, err)
+		}
+		wantHashes[i] = &filterHash
+
+		header := cf.MakeHeaderForFilter(f, &prevHeader)
+		gotHeader, err := idx.FilterHeaderByBlockHash(block.Hash(), message.GCSFilterRegular)
+		if err != nil || !bytes.Equal(gotHeader, header[:]) {
+			t.Fatalf("filter header of block %d: got %x, want %x (%v)", i,
+				gotHeader, header, err)
+		}
+		prevHeader = header
+	}
+
+	hashes, prev, err := idx.FilterHashesByOrderRange(message.GCSFilterRegular, 1,
+		numBlocks-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != numBlocks-1 {
+		t.Fatalf("got %d filter hashes, want %d", len(hashes), numBlocks-1)
+	}
+	for i, h := range hashes {
+		if !h.IsEqual(wantHashes[i+1]) {
+			t.Fatalf("filter hash %d: got %s, want %s", i+1, h, wantHashes[i+1])
+		}
+	}
+	firstHeader, _ := idx.FilterHeaderByBlockHash(blocks[0].Hash(), message.GCSFilterRegular)
+	if !bytes.Equal(prev[:], firstHeader) {
+		t.Fatalf("previous filter header: got %s, want %x", prev, firstHeader)
+	}
+	if _, _, err := idx.FilterHashesByOrderRange(message.GCSFilterRegular, 2, 1); err == nil {
+		t.Fatal("expected a reversed order range to fail")
+	}
+
+	// Disconnecting the tip removes its entries, and the range can't reach
+	// it anymore.
+	tip := blocks[numBlocks-1]
+	err = db.Update(func(dbTx database.Tx) error {
+		return idx.DisconnectBlock(dbTx, tip, nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := idx.FilterByBlockHash(tip.Hash(), message.GCSFilterRegular); err != errNoCFilter {
+		t.Fatalf("filter of the disconnected tip: got %v, want %v", err, errNoCFilter)
+	}
+	if _, err := idx.FilterHeaderByBlockHash(tip.Hash(), message.GCSFilterRegular); err != errNoCFilter {
+		t.Fatalf("filter header of the disconnected tip: got %v, want %v", err, errNoCFilter)
+	}
+	_, _, err = idx.FilterHashesByOrderRange(message.GCSFilterRegular, 0, numBlocks-1)
+	if err != errNoCFilter {
+		t.Fatalf("range over the disconnected tip: got %v, want %v", err, errNoCFilter)
+	}
+
+	// Reconnecting it chains its header to the same previous header.
+	err = db.Update(func(dbTx database.Tx) error {
+		stxos := []blockchain.SpentTxOut{{PkScript: spent[numBlocks-1]}}
+		return idx.ConnectBlock(dbTx, tip, stxos)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotHeader, err := idx.FilterHeaderByBlockHash(tip.Hash(), message.GCSFilterRegular)
+	if err != nil || !bytes.Equal(gotHeader, prevHeader[:]) {
+		t.Fatalf("filter header of the reconnected tip: got %x, want %s (%v)",
+			gotHeader, prevHeader, err)
+	}
+}
@@ -226,7 +226,7 @@ func (idx *ExistsAddrIndex) ConnectBlock(dbTx database.Tx, block *types.Serializ
 					// Non-standard outputs are skipped.
 					continue
 				}
-				if class != txscript.MultiSigTy {
+				if class != txscript.MultiSigTy && class != txscript.MultiSigAltTy {
 					// This should never happen, but be paranoid.
 					continue
 				}
@@ -318,7 +318,7 @@ func (idx *ExistsAddrIndex) addUnconfirmedTx(tx *types.Transaction) {
 				// Non-standard outputs are skipped.
 				continue
 			}
-			if class != txscript.MultiSigTy {
+			if class != txscript.MultiSigTy && class != txscript.MultiSigAltTy {
 				// This should never happen, but be paranoid.
 				continue
 			}
@@ -83,6 +83,9 @@ func (m *Manager) Init(chain *blockchain.BlockChain, interrupt <-chan struct{})
 		if err := indexer.Init(); err != nil {
 			return err
 		}
+		if assetIndex, ok := indexer.(*AssetIndex); ok {
+			assetIndex.chain = chain
+		}
 		if indexer.Name() == txIndexName {
 			indexer.(*TxIndex).chain = chain
 			if chain.CacheInvalidTx {
@@ -176,12 +179,11 @@ func (m *Manager) Init(chain *blockchain.BlockChain, interrupt <-chan struct{})
 			}
 			orderShow := int64(order)
 			if order == math.MaxUint32 {
-				lowestOrder = -1
-				indexerOrders[i] = -1
 				orderShow = -1
-			} else if int64(order) < lowestOrder {
-				lowestOrder = int64(order)
-				indexerOrders[i] = int64(order)
+			}
+			indexerOrders[i] = orderShow
+			if orderShow < lowestOrder {
+				lowestOrder = orderShow
 			}
 			log.Debug(fmt.Sprintf("Current %s tip", indexer.Name()),
 				"order", orderShow, "hash", h)
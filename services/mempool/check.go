@@ -150,7 +150,7 @@ func checkPkScriptStandard(pkScript []byte,
 	*/
 
 	switch scriptClass {
-	case txscript.MultiSigTy:
+	case txscript.MultiSigTy, txscript.MultiSigAltTy:
 		numPubKeys, numSigs, err := txscript.CalcMultiSigStats(pkScript)
 		if err != nil {
 			str := fmt.Sprintf("multi-signature script parse "+
@@ -268,34 +268,63 @@ func isDust(txOut *types.TxOutput, minRelayTxFee types.Amount) bool {
 	return int64(txOut.Amount)*1000/(3*int64(totalSize)) < int64(minRelayTxFee)
 }
 
+// hasAssets returns whether the transaction has an asset marker or carries
+// assets in its outputs.
+func hasAssets(tx *types.Transaction) bool {
+	if _, _, ok := tx.AssetMarker(); ok {
+		return true
+	}
+	for _, txOut := range tx.TxOut {
+		if _, _, ok := txscript.ExtractAsset(txOut.PkScript); ok {
+			return true
+		}
+	}
+	return false
+}
+
 // checkPoolDoubleSpend checks whether or not the passed transaction is
 // attempting to spend coins already spent by other transactions in the pool.
-// Note it does not check for double spends against transactions already in the
-// main chain.
+// If it does, we'll check whether each of those transactions are signaling for
+// replacement.  If just one of them isn't, an error is returned.  Otherwise, a
+// boolean is returned signaling that the transaction is a replacement.  Note it
+// does not check for double spends against transactions already in the main
+// chain.
 //
 // This function MUST be called with the mempool lock held (for reads).
-func (mp *TxPool) checkPoolDoubleSpend(tx *types.Tx) error {
+func (mp *TxPool) checkPoolDoubleSpend(tx *types.Tx) (bool, error) {
+	var isReplacement bool
 	for _, txIn := range tx.Transaction().TxIn {
-		if txR, exists := mp.outpoints[txIn.PreviousOut]; exists {
+		conflict, exists := mp.outpoints[txIn.PreviousOut]
+		if !exists {
+			continue
+		}
+
+		// Reject the transaction if we don't accept replacement
+		// transactions or if it doesn't signal replacement.
+		if mp.cfg.Policy.RejectReplacement ||
+			!mp.signalsReplacement(conflict, nil) {
 			str := fmt.Sprintf("transaction %v in the pool "+
-				"already spends the same coins", txR.Hash())
-			return txRuleError(message.RejectDuplicate, str)
+				"already spends the same coins", conflict.Hash())
+			return false, txRuleError(message.RejectDuplicate, str)
 		}
+
+		isReplacement = true
 	}
-	return nil
+	return isReplacement, nil
 }
 
 // checkInputsStandard performs a series of checks on a transaction's inputs
 // to ensure they are "standard".  A standard transaction input within the
 // context of this function is one whose referenced public key script is of a
 // standard form and, for pay-to-script-hash, does not have more than
-// maxStandardP2SHSigOps signature operations.  However, it should also be noted
+// maxStandardP2SHSigOps signature operations counted with the script flags.
+// However, it should also be noted
 // that standard inputs also are those which have a clean stack after execution
 // and only contain pushed data in their signature scripts.  This function does
 // not perform those checks because the script engine already does this more
 // accurately and concisely via the txscript.ScriptVerifyCleanStack and
 // txscript.ScriptVerifySigPushOnly flags.
-func checkInputsStandard(tx *types.Tx, utxoView *blockchain.UtxoViewpoint) error {
+func checkInputsStandard(tx *types.Tx, utxoView *blockchain.UtxoViewpoint, flags txscript.ScriptFlags) error {
 
 	// NOTE: The reference implementation also does a coinbase check here,
 	// but coinbases have already been rejected prior to calling this
@@ -312,7 +341,7 @@ func checkInputsStandard(tx *types.Tx, utxoView *blockchain.UtxoViewpoint) error
 		switch txscript.GetScriptClass(txscript.DefaultScriptVersion, originPkScript) {
 		case txscript.ScriptHashTy:
 			numSigOps := txscript.GetPreciseSigOpCount(
-				txIn.SignScript, originPkScript, true)
+				txIn.SignScript, originPkScript, true, flags)
 			if numSigOps > maxStandardP2SHSigOps {
 				str := fmt.Sprintf("transaction input #%d has "+
 					"%d signature operations which is more "+
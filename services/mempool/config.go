@@ -12,6 +12,7 @@ import (
 	"github.com/btceasypay/bitcoinpay/core/types"
 	"github.com/btceasypay/bitcoinpay/engine/txscript"
 	"github.com/btceasypay/bitcoinpay/params"
+	"github.com/btceasypay/bitcoinpay/services/acct"
 	"github.com/btceasypay/bitcoinpay/services/index"
 	"time"
 )
@@ -74,6 +75,25 @@ type Config struct {
 	// This can be nil if the address index is not enabled.
 	ExistsAddrIndex *index.ExistsAddrIndex
 
+	// AcctMgr defines the optional account manager to use for tracking the
+	// unconfirmed balances of the watched addresses.
+	// This can be nil if no address is watched.
+	AcctMgr *acct.AccountManager
+
+	// FeeEstimator defines the optional fee estimator observing how long
+	// the transactions of the pool wait until they are mined.
+	FeeEstimator *FeeEstimator
+
+	// TxAccepted defines the optional function notified of the transactions
+	// added to the pool with the mempool sequence number.
+	TxAccepted func(tx *types.Tx, mempoolSequence uint64)
+
+	// TxRemoved defines the optional function notified of the transactions
+	// removed from the pool without being mined, such as the expired,
+	// replaced, evicted and double spent ones, with the mempool sequence
+	// number.
+	TxRemoved func(tx *types.Tx, mempoolSequence uint64)
+
 	// block dag
 	BD *blockdag.BlockDAG
 
@@ -0,0 +1,288 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+
+package mempool
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/types"
+)
+
+const (
+	// EstimateFeeMaxConfirms is the maximum number of blocks a fee can be
+	// estimated for.
+	EstimateFeeMaxConfirms = 25
+
+	// estimateFeeMinBucketFee is the upper fee rate in atoms/kB of the
+	// lowest fee bucket.
+	estimateFeeMinBucketFee = 1000
+
+	// estimateFeeMaxBucketFee is the upper fee rate in atoms/kB of the
+	// highest bounded fee bucket, higher fee rates are collected in a last
+	// unbounded bucket.
+	estimateFeeMaxBucketFee = 1e8
+
+	// estimateFeeBucketSpacing is the factor the upper fee rates of the
+	// consecutive fee buckets differ by.
+	estimateFeeBucketSpacing = 1.2
+
+	// estimateFeeDecay is the factor the observations are decayed with on
+	// every block, so recent blocks count more than older ones.
+	estimateFeeDecay = 0.998
+
+	// estimateFeeSufficientTxs is the number of observed transactions a
+	// group of fee buckets needs for an estimate.
+	estimateFeeSufficientTxs = 10
+
+	// estimateFeeSuccessThreshold is the share of the transactions of a
+	// group of fee buckets that must have been mined within the target for
+	// its fee rate to be estimated.
+	estimateFeeSuccessThreshold = 0.85
+
+	// estimateFeeSaveVersion is the version of the saved estimator.
+	estimateFeeSaveVersion = 1
+)
+
+// ErrInsufficientFeeData is returned by EstimateFee when too few transactions
+// were mined yet to estimate the fee for the target.
+var ErrInsufficientFeeData = errors.New("insufficient data to estimate the fee")
+
+// feeBucket houses the decayed observations of the mined transactions of a
+// fee rate range.
+type feeBucket struct {
+	// txCount is the number of transactions mined.
+	txCount float64
+
+	// feeSum is the sum of the fee rates of the mined transactions.
+	feeSum float64
+
+	// confirmed holds at index i the number of transactions mined within
+	// i+1 blocks.
+	confirmed [EstimateFeeMaxConfirms]float64
+}
+
+// observedTx is a transaction of the pool waiting to be mined.
+type observedTx struct {
+	bucket   int
+	feePerKB int64
+	observed uint32
+}
+
+// FeeEstimator estimates the fee rate a transaction needs to be mined within
+// a number of blocks.  It observes how many blocks the transactions of the
+// pool wait until they are mined, grouped in exponentially spaced fee rate
+// buckets.  The number of blocks is counted in connected blocks, so in DAG
+// orders.  The fee rate of a target is the lowest at which most transactions
+// were mined within the target, where the transactions still waiting longer
+// count as not mined.
+//
+// The estimator is safe for concurrent access.
+type FeeEstimator struct {
+	mtx sync.RWMutex
+
+	// blocks is the number of blocks registered.
+	blocks uint32
+
+	// limits are the upper fee rates of the buckets.
+	limits  []float64
+	buckets []feeBucket
+
+	observed map[hash.Hash]observedTx
+}
+
+// NewFeeEstimator returns a new fee estimator without observations.
+func NewFeeEstimator() *FeeEstimator {
+	var limits []float64
+	for limit := float64(estimateFeeMinBucketFee); limit <= estimateFeeMaxBucketFee; limit *= estimateFeeBucketSpacing {
+		limits = append(limits, limit)
+	}
+	limits = append(limits, math.Inf(1))
+	return &FeeEstimator{
+		limits:   limits,
+		buckets:  make([]feeBucket, len(limits)),
+		observed: make(map[hash.Hash]observedTx),
+	}
+}
+
+// bucketIndex returns the index of the bucket of the fee rate.
+func (ef *FeeEstimator) bucketIndex(feePerKB int64) int {
+	return sort.SearchFloat64s(ef.limits, float64(feePerKB))
+}
+
+// ObserveTransaction starts tracking the transaction of the pool paying the
+// fee per kilobyte until it is mined.  Transactions depending on other
+// transactions of the pool should not be observed, since they are not mined
+// for their own fee.
+func (ef *FeeEstimator) ObserveTransaction(txHash *hash.Hash, feePerKB int64) {
+	ef.mtx.Lock()
+	defer ef.mtx.Unlock()
+
+	if _, ok := ef.observed[*txHash]; ok {
+		return
+	}
+	ef.observed[*txHash] = observedTx{
+		bucket:   ef.bucketIndex(feePerKB),
+		feePerKB: feePerKB,
+		observed: ef.blocks,
+	}
+}
+
+// RemoveTransaction stops tracking the transaction, when it leaves the pool
+// without being mined.
+func (ef *FeeEstimator) RemoveTransaction(txHash *hash.Hash) {
+	ef.mtx.Lock()
+	delete(ef.observed, *txHash)
+	ef.mtx.Unlock()
+}
+
+// RegisterBlock records how many blocks the observed transactions mined by
+// the connected block waited.  It must be called for every connected block in
+// order, before its transactions are removed from the pool.
+func (ef *FeeEstimator) RegisterBlock(block *types.SerializedBlock) {
+	ef.mtx.Lock()
+	defer ef.mtx.Unlock()
+
+	// Decay the older observations first.
+	for i := range ef.buckets {
+		bucket := &ef.buckets[i]
+		bucket.txCount *= estimateFeeDecay
+		bucket.feeSum *= estimateFeeDecay
+		for c := range bucket.confirmed {
+			bucket.confirmed[c] *= estimateFeeDecay
+		}
+	}
+
+	ef.blocks++
+	for _, tx := range block.Transactions() {
+		otx, ok := ef.observed[*tx.Hash()]
+		if !ok {
+			continue
+		}
+		delete(ef.observed, *tx.Hash())
+
+		bucket := &ef.buckets[otx.bucket]
+		bucket.txCount++
+		bucket.feeSum += float64(otx.feePerKB)
+		for c := int(ef.blocks-otx.observed) - 1; c < len(bucket.confirmed); c++ {
+			bucket.confirmed[c]++
+		}
+	}
+}
+
+// EstimateFee returns the estimated fee per kilobyte for a transaction to be
+// mined within the number of blocks.  ErrInsufficientFeeData is returned when
+// too few transactions were mined yet.
+func (ef *FeeEstimator) EstimateFee(target uint32) (int64, error) {
+	if target < 1 || target > EstimateFeeMaxConfirms {
+		return 0, fmt.Errorf("target %d is not within 1 and %d", target,
+			EstimateFeeMaxConfirms)
+	}
+
+	ef.mtx.RLock()
+	defer ef.mtx.RUnlock()
+
+	// The transactions of the pool which already waited for the target
+	// count as not mined within the target.
+	waiting := make([]float64, len(ef.buckets))
+	for _, otx := range ef.observed {
+		if ef.blocks-otx.observed >= target {
+			waiting[otx.bucket]++
+		}
+	}
+
+	// Group the buckets from the highest fee rate down until they have
+	// enough transactions, the lowest group mining enough of them within
+	// the target gives the estimate.
+	var estimate, total, confirmed, txCount, feeSum float64
+	for i := len(ef.buckets) - 1; i >= 0; i-- {
+		bucket := &ef.buckets[i]
+		total += bucket.txCount + waiting[i]
+		confirmed += bucket.confirmed[target-1]
+		txCount += bucket.txCount
+		feeSum += bucket.feeSum
+		if total < estimateFeeSufficientTxs {
+			continue
+		}
+		if confirmed/total < estimateFeeSuccessThreshold {
+			break
+		}
+		if txCount > 0 {
+			estimate = feeSum / txCount
+		}
+		total, confirmed, txCount, feeSum = 0, 0, 0, 0
+	}
+	if estimate == 0 {
+		return 0, ErrInsufficientFeeData
+	}
+	return int64(math.Round(estimate)), nil
+}
+
+// Save serializes the observations of the mined transactions, so the
+// estimator can be restored with RestoreFeeEstimator.  The transactions still
+// waiting are not saved, they are observed again when the pool is loaded.
+func (ef *FeeEstimator) Save() []byte {
+	ef.mtx.RLock()
+	defer ef.mtx.RUnlock()
+
+	var buf bytes.Buffer
+	write := func(data interface{}) {
+		// Writing to a bytes.Buffer never fails.
+		binary.Write(&buf, binary.LittleEndian, data)
+	}
+	write(uint32(estimateFeeSaveVersion))
+	write(ef.blocks)
+	write(uint32(len(ef.buckets)))
+	for i := range ef.buckets {
+		bucket := &ef.buckets[i]
+		write(bucket.txCount)
+		write(bucket.feeSum)
+		write(&bucket.confirmed)
+	}
+	return buf.Bytes()
+}
+
+// RestoreFeeEstimator returns the fee estimator saved with Save.
+func RestoreFeeEstimator(data []byte) (*FeeEstimator, error) {
+	ef := NewFeeEstimator()
+	r := bytes.NewReader(data)
+	var version, numBuckets uint32
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return nil, err
+	}
+	if version != estimateFeeSaveVersion {
+		return nil, fmt.Errorf("unknown version %d of the saved fee "+
+			"estimator", version)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &ef.blocks); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &numBuckets); err != nil {
+		return nil, err
+	}
+	if int(numBuckets) != len(ef.buckets) {
+		return nil, fmt.Errorf("saved fee estimator has %d buckets, "+
+			"want %d", numBuckets, len(ef.buckets))
+	}
+	for i := range ef.buckets {
+		bucket := &ef.buckets[i]
+		for _, data := range []interface{}{&bucket.txCount,
+			&bucket.feeSum, &bucket.confirmed} {
+			err := binary.Read(r, binary.LittleEndian, data)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("saved fee estimator has %d trailing "+
+			"bytes", r.Len())
+	}
+	return ef, nil
+}
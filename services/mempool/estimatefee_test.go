@@ -0,0 +1,117 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+
+package mempool
+
+import (
+	"testing"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/core/types/pow"
+)
+
+// estimateFeeFeed feeds the estimator with synthetic pool transactions and
+// the blocks mining them.
+type estimateFeeFeed struct {
+	ef      *FeeEstimator
+	next    uint32
+	pending map[uint32][]*types.Tx
+}
+
+// observe adds a transaction paying the fee per kilobyte to the pool, which
+// is mined after the number of blocks.
+func (f *estimateFeeFeed) observe(feePerKB int64, blocks uint32) {
+	f.next++
+	tx := newPersistTx(&hash.Hash{byte(f.next), byte(f.next >> 8),
+		byte(f.next >> 16)}, 0)
+	f.ef.ObserveTransaction(tx.Hash(), feePerKB)
+	mined := f.ef.blocks + blocks
+	f.pending[mined] = append(f.pending[mined], tx)
+}
+
+// connectBlock connects the next block mining the pending transactions.
+func (f *estimateFeeFeed) connectBlock(t *testing.T) {
+	block := types.Block{Header: types.BlockHeader{
+		Pow: pow.GetInstance(pow.BLAKE2BD, 0, []byte{}),
+	}}
+	for _, tx := range f.pending[f.ef.blocks+1] {
+		if err := block.AddTransaction(tx.Tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	delete(f.pending, f.ef.blocks+1)
+	f.ef.RegisterBlock(types.NewBlock(&block))
+}
+
+func TestEstimateFee(t *testing.T) {
+	feed := &estimateFeeFeed{
+		ef:      NewFeeEstimator(),
+		pending: make(map[uint32][]*types.Tx),
+	}
+	if _, err := feed.ef.EstimateFee(1); err != ErrInsufficientFeeData {
+		t.Fatalf("estimated without data: %v", err)
+	}
+	for _, target := range []uint32{0, EstimateFeeMaxConfirms + 1} {
+		if _, err := feed.ef.EstimateFee(target); err == nil {
+			t.Fatalf("estimated for the invalid target %d", target)
+		}
+	}
+
+	// High fee transactions are mined in the next block, low fee ones wait
+	// for five blocks and the free ones are never mined.
+	for i := 0; i < 50; i++ {
+		for j := 0; j < 4; j++ {
+			feed.observe(50000, 1)
+			feed.observe(2000, 5)
+			feed.observe(0, 1000)
+		}
+		feed.connectBlock(t)
+	}
+	tests := []struct {
+		target uint32
+		want   int64
+	}{
+		{1, 50000},
+		{4, 50000},
+		{5, 2000},
+		{EstimateFeeMaxConfirms, 2000},
+	}
+	for _, test := range tests {
+		fee, err := feed.ef.EstimateFee(test.target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fee != test.want {
+			t.Fatalf("estimated %d for %d blocks, want %d", fee,
+				test.target, test.want)
+		}
+	}
+
+	// Removed transactions are not observed anymore.
+	tx := newPersistTx(&hash.Hash{0xff}, 0)
+	feed.ef.ObserveTransaction(tx.Hash(), 1000)
+	feed.ef.RemoveTransaction(tx.Hash())
+	if _, ok := feed.ef.observed[*tx.Hash()]; ok {
+		t.Fatal("removed transaction is observed")
+	}
+
+	// The observations of the mined transactions are restored.
+	ef, err := RestoreFeeEstimator(feed.ef.Save())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ef.blocks != feed.ef.blocks || len(ef.observed) != 0 {
+		t.Fatalf("restored %d blocks and %d transactions", ef.blocks,
+			len(ef.observed))
+	}
+	for _, test := range tests {
+		fee, err := ef.EstimateFee(test.target)
+		if err != nil || fee != test.want {
+			t.Fatalf("restored estimator estimated %d for %d blocks: %v",
+				fee, test.target, err)
+		}
+	}
+	if _, err := RestoreFeeEstimator(feed.ef.Save()[:20]); err == nil {
+		t.Fatal("restored a truncated estimator")
+	}
+}
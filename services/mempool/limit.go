@@ -0,0 +1,239 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+
+package mempool
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/log"
+)
+
+const (
+	// DefaultMaxPoolSize is the default maximum size in bytes of the
+	// serialized transactions in the pool.
+	DefaultMaxPoolSize = 300 * 1000 * 1000
+
+	// rollingFeeHalfLife is the time it takes the minimum relay fee raised
+	// by evicting transactions to decay to half of its value.
+	rollingFeeHalfLife = 12 * time.Hour
+)
+
+// descendantScore returns the fee per kilobyte the transaction is evicted by.
+// It is the higher of the fee rate of the transaction and the fee rate of the
+// transaction with its descendants in the pool, so a child paying a high fee
+// keeps its parents in the pool as it gets them mined.
+func (txD *TxDesc) descendantScore() int64 {
+	score := txD.FeePerKB
+	if txD.descendantSize > 0 {
+		if rate := txD.descendantFee * 1000 / txD.descendantSize; rate > score {
+			score = rate
+		}
+	}
+	return score
+}
+
+// evictHeap is a min-heap of the transactions in the pool by descendant score,
+// the newest transaction first on equal scores.  The transactions keep their
+// index in the heap, so it is fixed as their descendants change.
+type evictHeap []*TxDesc
+
+func (h evictHeap) Len() int { return len(h) }
+
+func (h evictHeap) Less(i, j int) bool {
+	si, sj := h[i].descendantScore(), h[j].descendantScore()
+	if si != sj {
+		return si < sj
+	}
+	return h[i].Added.After(h[j].Added)
+}
+
+func (h evictHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].evictIndex = i
+	h[j].evictIndex = j
+}
+
+func (h *evictHeap) Push(x interface{}) {
+	txD := x.(*TxDesc)
+	txD.evictIndex = len(*h)
+	*h = append(*h, txD)
+}
+
+func (h *evictHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	txD := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return txD
+}
+
+// contains returns whether the transaction is in the heap.
+func (h evictHeap) contains(txD *TxDesc) bool {
+	return txD.evictIndex < len(h) && h[txD.evictIndex] == txD
+}
+
+// insertTx adds the transaction to the pool, marks the referenced outpoints as
+// spent by the pool and adds it to the descendants of its ancestors.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) insertTx(txD *TxDesc) {
+	tx := txD.Tx
+	size := int64(tx.Tx.SerializeSize())
+	mp.pool[*tx.Hash()] = txD
+	mp.poolSize += size
+	for _, txIn := range tx.Tx.TxIn {
+		mp.outpoints[txIn.PreviousOut] = tx
+	}
+
+	txD.descendantFee, txD.descendantSize = txD.Fee, size
+	heap.Push(&mp.evictQueue, txD)
+	ancestors := mp.txAncestors(tx, nil)
+	if len(mp.txDescendants(tx, nil)) == 0 {
+		mp.updateDescendants(ancestors, txD.Fee, size)
+		return
+	}
+	// The transaction was added back before the transactions spending it,
+	// e.g. when a block is disconnected.  These may already descend from
+	// the ancestors by other inputs, so the descendants are summed again.
+	ancestors[*tx.Hash()] = tx
+	for _, ancestor := range ancestors {
+		mp.sumDescendants(mp.pool[*ancestor.Hash()])
+	}
+}
+
+// sumDescendants calculates the fee and size of the transaction with its
+// descendants in the pool.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) sumDescendants(txD *TxDesc) {
+	txD.descendantFee = txD.Fee
+	txD.descendantSize = int64(txD.Tx.Tx.SerializeSize())
+	for h := range mp.txDescendants(txD.Tx, nil) {
+		descendant := mp.pool[h]
+		txD.descendantFee += descendant.Fee
+		txD.descendantSize += int64(descendant.Tx.Tx.SerializeSize())
+	}
+	if mp.evictQueue.contains(txD) {
+		heap.Fix(&mp.evictQueue, txD.evictIndex)
+	}
+}
+
+// updateDescendants adds the fee and size of a transaction added to or removed
+// from the pool to its ancestors.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) updateDescendants(ancestors map[hash.Hash]*types.Tx, fee, size int64) {
+	for h := range ancestors {
+		txD, ok := mp.pool[h]
+		if !ok {
+			continue
+		}
+		txD.descendantFee += fee
+		txD.descendantSize += size
+		if mp.evictQueue.contains(txD) {
+			heap.Fix(&mp.evictQueue, txD.evictIndex)
+		}
+	}
+}
+
+// trimToSize evicts the transactions with the lowest descendant score along
+// with the transactions spending them, until the size of the pool is within
+// the maximum size of the policy.  The minimum relay fee rises above the fee
+// rate of each evicted package, so it can not replace transactions paying a
+// higher fee.  It returns the hashes of the evicted transactions.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) trimToSize() []hash.Hash {
+	maxSize := mp.cfg.Policy.MaxPoolSize
+	if maxSize <= 0 {
+		return nil
+	}
+
+	var evicted []hash.Hash
+	for mp.poolSize > maxSize && len(mp.evictQueue) > 0 {
+		txD := mp.evictQueue[0]
+		feePerKB := txD.descendantFee * 1000 / txD.descendantSize
+		before := len(mp.pool)
+		mp.removeTransaction(txD.Tx, true)
+		evicted = append(evicted, *txD.Tx.Hash())
+		mp.bumpMinFee(feePerKB)
+
+		log.Debug(fmt.Sprintf("Evicted transaction %v (%d atoms/kB with "+
+			"descendants) and %d descendants from the full mempool",
+			txD.Tx.Hash(), feePerKB, before-len(mp.pool)-1))
+	}
+	return evicted
+}
+
+// bumpMinFee raises the minimum relay fee above the passed fee per kilobyte of
+// an evicted transaction.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) bumpMinFee(feePerKB int64) {
+	mp.decayMinFee(time.Now())
+	fee := float64(feePerKB + int64(mp.cfg.Policy.MinRelayTxFee))
+	if fee > mp.rollingMinFee {
+		mp.rollingMinFee = fee
+		log.Debug(fmt.Sprintf("Raised the minimum relay fee of the full "+
+			"mempool to %d atoms/kB", int64(fee)))
+	}
+}
+
+// decayMinFee decays the minimum relay fee raised by evicting transactions
+// to the passed time.  The raised fee is dropped once it falls below half of
+// the minimum relay fee of the policy.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) decayMinFee(now time.Time) {
+	if mp.rollingMinFee > 0 {
+		elapsed := now.Sub(mp.lastRollingFeeUpdate)
+		if elapsed > 0 {
+			mp.rollingMinFee /= math.Pow(2, float64(elapsed)/
+				float64(rollingFeeHalfLife))
+		}
+		if mp.rollingMinFee < float64(mp.cfg.Policy.MinRelayTxFee)/2 {
+			mp.rollingMinFee = 0
+		}
+	}
+	mp.lastRollingFeeUpdate = now
+}
+
+// minFee returns the current minimum fee per kilobyte for a transaction to be
+// accepted into the pool.  It is the minimum relay fee of the policy unless
+// it was raised by evicting transactions from the full pool.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) minFee() types.Amount {
+	mp.decayMinFee(time.Now())
+	fee := types.Amount(math.Round(mp.rollingMinFee))
+	if fee > mp.cfg.Policy.MinRelayTxFee {
+		return fee
+	}
+	return mp.cfg.Policy.MinRelayTxFee
+}
+
+// MinFee returns the current minimum fee in atoms per kilobyte for a
+// transaction to be accepted into the pool.  It rises above the minimum relay
+// fee when the full pool evicts transactions and decays back afterwards.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) MinFee() types.Amount {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+	return mp.minFee()
+}
+
+// Size returns the size in bytes of the serialized transactions in the pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Size() int64 {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+	return mp.poolSize
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+
+package mempool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/types"
+)
+
+// addLimitTx adds the transaction with the fee per kilobyte to the pool like
+// addTransaction, without the priority which needs the inputs.
+func addLimitTx(mp *TxPool, tx *types.Tx, feePerKB int64, added time.Time) *TxDesc {
+	txD := &TxDesc{TxDesc: types.TxDesc{
+		Tx:       tx,
+		Added:    added,
+		Fee:      feePerKB * int64(tx.Tx.SerializeSize()) / 1000,
+		FeePerKB: feePerKB,
+	}}
+	mp.insertTx(txD)
+	return txD
+}
+
+func TestTrimToSize(t *testing.T) {
+	mp := New(&Config{Policy: Policy{MinRelayTxFee: 1000}})
+	added := time.Now()
+	low := newPersistTx(&hash.Hash{1}, 0)
+	lowChild := newPersistTx(low.Hash(), 0)
+	mid := newPersistTx(&hash.Hash{2}, 0)
+	high := newPersistTx(&hash.Hash{3}, 0)
+	addLimitTx(mp, low, 2000, added)
+	addLimitTx(mp, lowChild, 50000, added)
+	addLimitTx(mp, mid, 3000, added)
+	addLimitTx(mp, high, 4000, added)
+	txSize := int64(low.Tx.SerializeSize())
+	if mp.Size() != 4*txSize {
+		t.Fatalf("pool size %d, want %d", mp.Size(), 4*txSize)
+	}
+
+	// Nothing is evicted without a limit or within the limit.
+	if evicted := mp.trimToSize(); len(evicted) != 0 {
+		t.Fatalf("evicted %v without a limit", evicted)
+	}
+	mp.cfg.Policy.MaxPoolSize = 4 * txSize
+	if evicted := mp.trimToSize(); len(evicted) != 0 {
+		t.Fatalf("evicted %v within the limit", evicted)
+	}
+	if mp.MinFee() != 1000 {
+		t.Fatalf("min fee %v without evictions", mp.MinFee())
+	}
+
+	// The child paying a high fee keeps its parent with the lowest fee rate
+	// in the pool, the lowest descendant score is evicted.
+	mp.cfg.Policy.MaxPoolSize = 2 * txSize
+	evicted := mp.trimToSize()
+	if len(evicted) != 2 || evicted[0] != *mid.Hash() || evicted[1] != *high.Hash() {
+		t.Fatalf("evicted %v, want %v and %v", evicted, mid.Hash(), high.Hash())
+	}
+	if len(mp.pool) != 2 || mp.Size() != 2*txSize {
+		t.Fatalf("pool has %d transactions of %d bytes after eviction",
+			len(mp.pool), mp.Size())
+	}
+	if _, ok := mp.pool[*low.Hash()]; !ok {
+		t.Fatal("parent of the high fee child evicted")
+	}
+	if mp.MinFee() != 5000 {
+		t.Fatalf("min fee %v after eviction, want 5000", mp.MinFee())
+	}
+
+	// The parent is evicted with its descendants, the min fee rises above
+	// the fee rate of both.
+	mp.cfg.Policy.MaxPoolSize = txSize
+	evicted = mp.trimToSize()
+	if len(evicted) != 1 || evicted[0] != *low.Hash() {
+		t.Fatalf("evicted %v, want %v", evicted, low.Hash())
+	}
+	if len(mp.pool) != 0 || len(mp.outpoints) != 0 || len(mp.evictQueue) != 0 {
+		t.Fatalf("pool has %d transactions, %d outpoints and %d queued "+
+			"after eviction", len(mp.pool), len(mp.outpoints), len(mp.evictQueue))
+	}
+	if mp.MinFee() != 27000 {
+		t.Fatalf("min fee %v after eviction, want 27000", mp.MinFee())
+	}
+
+	// The min fee only rises.
+	mp.bumpMinFee(100)
+	if mp.MinFee() != 27000 {
+		t.Fatalf("min fee %v after eviction, want 27000", mp.MinFee())
+	}
+}
+
+// TestDescendantScore ensures the fees of the descendants are kept up to date
+// as the transactions are added to and removed from the pool, in any order.
+func TestDescendantScore(t *testing.T) {
+	mp := New(&Config{})
+	added := time.Now()
+	parent := newPersistTx(&hash.Hash{1}, 0)
+	child := newPersistTx(parent.Hash(), 0)
+	grandchild := newPersistTx(child.Hash(), 0)
+	txSize := int64(parent.Tx.SerializeSize())
+
+	check := func(txD *TxDesc, score int64, n int64) {
+		t.Helper()
+		if txD.descendantScore() != score || txD.descendantSize != n*txSize {
+			t.Fatalf("got score %d of %d bytes, want %d of %d bytes",
+				txD.descendantScore(), txD.descendantSize, score, n*txSize)
+		}
+	}
+	parentD := addLimitTx(mp, parent, 1000, added)
+	childD := addLimitTx(mp, child, 3000, added)
+	grandchildD := addLimitTx(mp, grandchild, 8000, added)
+	check(parentD, 4000, 3)
+	check(childD, 5500, 2)
+	check(grandchildD, 8000, 1)
+	if mp.evictQueue[0] != parentD {
+		t.Fatal("the parent isn't the first to evict")
+	}
+
+	// The parent is mined, its descendants stay.
+	mp.removeTransaction(parent, false)
+	check(childD, 5500, 2)
+	mp.removeTransaction(grandchild, false)
+	check(childD, 3000, 1)
+
+	// Added back before its descendant, as on a disconnected block.
+	parentD = addLimitTx(mp, parent, 1000, added)
+	check(parentD, 2000, 2)
+	mp.removeTransaction(parent, true)
+	if len(mp.pool) != 0 || len(mp.evictQueue) != 0 {
+		t.Fatalf("pool has %d transactions and %d queued after removal",
+			len(mp.pool), len(mp.evictQueue))
+	}
+}
+
+func TestMinFeeDecay(t *testing.T) {
+	mp := New(&Config{Policy: Policy{MinRelayTxFee: 1000}})
+	now := time.Now()
+	tests := []struct {
+		elapsed time.Duration
+		want    float64
+	}{
+		{0, 8000},
+		{rollingFeeHalfLife, 4000},
+		{2 * rollingFeeHalfLife, 2000},
+		{3 * rollingFeeHalfLife, 1000},
+		// The fee is dropped below half of the min relay fee.
+		{5 * rollingFeeHalfLife, 0},
+	}
+	for i, test := range tests {
+		mp.rollingMinFee = 8000
+		mp.lastRollingFeeUpdate = now
+		mp.decayMinFee(now.Add(test.elapsed))
+		if mp.rollingMinFee < test.want-1 || mp.rollingMinFee > test.want+1 {
+			t.Fatalf("test #%d: decayed fee %v, want %v", i,
+				mp.rollingMinFee, test.want)
+		}
+	}
+	if mp.minFee() != 1000 {
+		t.Fatalf("min fee %v, want the min relay fee", mp.minFee())
+	}
+}
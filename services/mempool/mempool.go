@@ -6,6 +6,7 @@
 package mempool
 
 import (
+	"container/heap"
 	"container/list"
 	"fmt"
 	"github.com/btceasypay/bitcoinpay/common/hash"
@@ -35,18 +36,37 @@ type TxPool struct {
 
 	pennyTotal    float64 // exponentially decaying total for penny spends.
 	lastPennyUnix int64   // unix time of last ``penny spend''
+
+	// poolSize is the size in bytes of the serialized transactions in the
+	// pool, it is kept within the maximum size of the policy.
+	poolSize int64
+
+	// rollingMinFee is the minimum relay fee in atoms/kB raised by evicting
+	// transactions from the full pool, it decays since the last update.
+	rollingMinFee        float64
+	lastRollingFeeUpdate time.Time
+
+	// sequence is the mempool sequence number, it is incremented on every
+	// addition and removal of a transaction.
+	sequence uint64
+
+	// evictQueue orders the transactions in the pool by descendant score
+	// to evict the lowest ones from the full pool.
+	evictQueue evictHeap
 }
 
 // New returns a new memory pool for validating and storing standalone
 // transactions until they are mined into a block.
 func New(cfg *Config) *TxPool {
-	return &TxPool{
+	mp := &TxPool{
 		cfg:           *cfg,
 		pool:          make(map[hash.Hash]*TxDesc),
 		orphans:       make(map[hash.Hash]*types.Tx),
 		orphansByPrev: make(map[hash.Hash]map[hash.Hash]*types.Tx),
 		outpoints:     make(map[types.TxOutPoint]*types.Tx),
 	}
+	mp.registerMetrics()
+	return mp
 }
 
 // TxDesc is a descriptor containing a transaction in the mempool along with
@@ -57,6 +77,13 @@ type TxDesc struct {
 	// StartingPriority is the priority of the transaction when it was added
 	// to the pool.
 	StartingPriority float64
+
+	// descendantFee and descendantSize are the fee and size of the
+	// transaction with its descendants in the pool.  evictIndex is the index
+	// of the transaction in the eviction queue.
+	descendantFee  int64
+	descendantSize int64
+	evictIndex     int
 }
 
 // TxDescs returns a slice of descriptors for all the transactions in the pool.
@@ -81,6 +108,17 @@ func (mp *TxPool) TxDescs() []*TxDesc {
 //
 // This function MUST be called with the mempool lock held (for writes).
 func (mp *TxPool) removeTransaction(theTx *types.Tx, removeRedeemers bool) {
+	if mp.removeTx(theTx, removeRedeemers) && mp.cfg.TxRemoved != nil {
+		mp.cfg.TxRemoved(theTx, mp.sequence)
+	}
+}
+
+// removeTx removes the transaction and returns whether it was in the pool.
+// Unlike removeTransaction it does not notify the removal of the transaction
+// itself.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) removeTx(theTx *types.Tx, removeRedeemers bool) bool {
 	tx := theTx.Transaction()
 	txHash := theTx.Hash()
 	if removeRedeemers {
@@ -101,26 +139,44 @@ func (mp *TxPool) removeTransaction(theTx *types.Tx, removeRedeemers bool) {
 		if mp.cfg.AddrIndex != nil {
 			mp.cfg.AddrIndex.RemoveUnconfirmedTx(txHash)
 		}
+		if mp.cfg.AcctMgr != nil {
+			mp.cfg.AcctMgr.RemoveUnconfirmedTx(txHash)
+		}
+		if mp.cfg.FeeEstimator != nil {
+			mp.cfg.FeeEstimator.RemoveTransaction(txHash)
+		}
 		// Mark the referenced outpoints as unspent by the pool.
 
+		// The descendants left in the pool no longer descend from the
+		// ancestors of the transaction.
+		mp.updateDescendants(mp.txAncestors(theTx, nil),
+			-txDesc.descendantFee, -txDesc.descendantSize)
+		if mp.evictQueue.contains(txDesc) {
+			heap.Remove(&mp.evictQueue, txDesc.evictIndex)
+		}
 		for _, txIn := range txDesc.Tx.Transaction().TxIn {
 			delete(mp.outpoints, txIn.PreviousOut)
 		}
 		delete(mp.pool, *txHash)
+		mp.poolSize -= int64(txDesc.Tx.Transaction().SerializeSize())
+		mp.sequence++
 		atomic.StoreInt64(&mp.lastUpdated, time.Now().Unix())
+		return true
 	}
+	return false
 }
 
 // RemoveTransaction removes the passed transaction from the mempool. When the
 // removeRedeemers flag is set, any transactions that redeem outputs from the
 // removed transaction will also be removed recursively from the mempool, as
-// they would otherwise become orphans.
+// they would otherwise become orphans.  It is called for the transactions of
+// the connected blocks, so only the removal of the redeemers is notified.
 //
 // This function is safe for concurrent access.
 func (mp *TxPool) RemoveTransaction(tx *types.Tx, removeRedeemers bool) {
 	// Protect concurrent access.
 	mp.mtx.Lock()
-	mp.removeTransaction(tx, removeRedeemers)
+	mp.removeTx(tx, removeRedeemers)
 	mp.mtx.Unlock()
 }
 
@@ -164,10 +220,7 @@ func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint,
 		},
 		StartingPriority: CalcPriority(msgTx, utxoView, height, mp.cfg.BD),
 	}
-	mp.pool[*tx.Hash()] = txD
-	for _, txIn := range msgTx.TxIn {
-		mp.outpoints[txIn.PreviousOut] = tx
-	}
+	mp.insertTx(txD)
 	atomic.StoreInt64(&mp.lastUpdated, time.Now().Unix())
 
 	// Add unconfirmed address index entries associated with the transaction
@@ -178,6 +231,13 @@ func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint,
 	if mp.cfg.ExistsAddrIndex != nil {
 		mp.cfg.ExistsAddrIndex.AddUnconfirmedTx(msgTx)
 	}
+	if mp.cfg.AcctMgr != nil {
+		mp.cfg.AcctMgr.AddUnconfirmedTx(tx, utxoView)
+	}
+	mp.sequence++
+	if mp.cfg.TxAccepted != nil {
+		mp.cfg.TxAccepted(tx, mp.sequence)
+	}
 	return txD
 }
 
@@ -272,7 +332,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *types.Tx, isNew, rateLimit, allowHi
 	// at this point.  There is a more in-depth check that happens later
 	// after fetching the referenced transaction inputs from the main chain
 	// which examines the actual spend data and prevents double spends.
-	err = mp.checkPoolDoubleSpend(tx)
+	isReplacement, err := mp.checkPoolDoubleSpend(tx)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -351,10 +411,33 @@ func (mp *TxPool) maybeAcceptTransaction(tx *types.Tx, isNew, rateLimit, allowHi
 		return nil, nil, err
 	}
 
+	// Check the assets of the transaction once their deployment is active.
+	// Before, the assets wouldn't be checked by the blocks, so the
+	// transactions carrying assets are kept out of the pool.
+	assetsActive, err := mp.cfg.BC.CheckTransactionAssets(tx, utxoView)
+	if err != nil {
+		if cerr, ok := err.(blockchain.RuleError); ok {
+			return nil, nil, chainRuleError(cerr)
+		}
+		return nil, nil, err
+	}
+	if !assetsActive && hasAssets(msgTx) {
+		str := fmt.Sprintf("transaction %v carries assets before the "+
+			"assets deployment is active", txHash)
+		return nil, nil, txRuleError(message.RejectNonstandard, str)
+	}
+
+	// The standard script flags decide whether OP_CHECKMULTISIGALT counts as
+	// signature operations and verify the scripts below.
+	flags, err := mp.cfg.Policy.StandardVerifyFlags()
+	if err != nil {
+		return nil, nil, err
+	}
+
 	// Don't allow transactions with non-standard inputs if the mempool config
 	// forbids their acceptance and relaying.
 	if !mp.cfg.Policy.AcceptNonStd {
-		err := checkInputsStandard(tx, utxoView)
+		err := checkInputsStandard(tx, utxoView, flags)
 		if err != nil {
 			// Attempt to extract a reject code from the error so
 			// it can be retained.  When not possible, fall back to
@@ -378,7 +461,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *types.Tx, isNew, rateLimit, allowHi
 	// the coinbase address itself can contain signature operations, the
 	// maximum allowed signature operations per transaction is less than
 	// the maximum allowed signature operations per block.
-	numSigOps, err := blockchain.CountP2SHSigOps(tx, false, utxoView)
+	numSigOps, err := blockchain.CountP2SHSigOps(tx, false, utxoView, flags)
 	if err != nil {
 		if cerr, ok := err.(blockchain.RuleError); ok {
 			return nil, nil, chainRuleError(cerr)
@@ -386,7 +469,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *types.Tx, isNew, rateLimit, allowHi
 		return nil, nil, err
 	}
 
-	numSigOps += blockchain.CountSigOps(tx)
+	numSigOps += blockchain.CountSigOps(tx, flags)
 	if numSigOps > mp.cfg.Policy.MaxSigOpsPerTx {
 		str := fmt.Sprintf("transaction %v has too many sigops: %d > %d",
 			txHash, numSigOps, mp.cfg.Policy.MaxSigOpsPerTx)
@@ -404,6 +487,19 @@ func (mp *TxPool) maybeAcceptTransaction(tx *types.Tx, isNew, rateLimit, allowHi
 		return nil, nil, txRuleError(message.RejectInsufficientFee, str)
 	}
 
+	// Don't allow new transactions with fees too low to replace the
+	// transactions evicted from the full pool.
+	if poolMinFee := mp.minFee(); isNew &&
+		poolMinFee > mp.cfg.Policy.MinRelayTxFee {
+		minPoolFee := calcMinRequiredTxRelayFee(serializedSize, poolMinFee)
+		if txFee < minPoolFee {
+			str := fmt.Sprintf("transaction %v has %v fees which "+
+				"is under the required amount of %v of the full "+
+				"mempool", txHash, txFee, minPoolFee)
+			return nil, nil, txRuleError(message.RejectInsufficientFee, str)
+		}
+	}
+
 	// Require that free transactions have sufficient priority to be mined
 	// in the next block.  Transactions which are being added back to the
 	// memory pool from blocks that have been disconnected during a reorg
@@ -461,12 +557,18 @@ func (mp *TxPool) maybeAcceptTransaction(tx *types.Tx, isNew, rateLimit, allowHi
 		}
 	}
 
+	// If the transaction has any conflicts and we've made it this far, then
+	// we're processing a potential replacement.
+	var conflicts map[hash.Hash]*types.Tx
+	if isReplacement {
+		conflicts, err = mp.validateReplacement(tx, txFee)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
 	// Verify crypto signatures for each input and reject the transaction if
 	// any don't verify.
-	flags, err := mp.cfg.Policy.StandardVerifyFlags()
-	if err != nil {
-		return nil, nil, err
-	}
 	err = blockchain.ValidateTransactionScripts(tx, utxoView, flags,
 		mp.cfg.SigCache)
 	if err != nil {
@@ -476,9 +578,49 @@ func (mp *TxPool) maybeAcceptTransaction(tx *types.Tx, isNew, rateLimit, allowHi
 		return nil, nil, err
 	}
 
+	// Now that we've deemed the transaction as valid, we can add it to the
+	// mempool.  If it ended up replacing any transactions, we'll remove
+	// them first.
+	for _, conflict := range conflicts {
+		log.Debug(fmt.Sprintf("Replacing transaction %v (fee_rate=%v "+
+			"atoms/kb) with %v (fee_rate=%v atoms/kb)", conflict.Hash(),
+			mp.pool[*conflict.Hash()].FeePerKB, txHash,
+			txFee*1000/serializedSize))
+
+		// The conflict set should already include the descendants for
+		// each one, so we don't need to remove the redeemers within
+		// this call as they'll be removed eventually.
+		mp.removeTransaction(conflict, false)
+	}
+
+	// Transactions spending the outputs of the pool are mined for the fee
+	// of the package, so they are not observed by the fee estimator.
+	dependsOnPool := false
+	for _, txIn := range msgTx.TxIn {
+		if _, ok := mp.pool[txIn.PreviousOut.Hash]; ok {
+			dependsOnPool = true
+			break
+		}
+	}
+
 	// Add to transaction pool.
 	txD := mp.addTransaction(utxoView, tx, nextBlockHeight, txFee)
 
+	// Keep the pool within its maximum size, the transaction itself is
+	// rejected when its fee is too low to stay in the full pool.
+	mp.trimToSize()
+	if _, ok := mp.pool[*txHash]; !ok {
+		str := fmt.Sprintf("transaction %v has %v fees which is too "+
+			"low to enter the full mempool", txHash, txFee)
+		return nil, nil, txRuleError(message.RejectInsufficientFee, str)
+	}
+
+	// Observe how long the new transaction waits until it is mined for the
+	// fee estimation.
+	if mp.cfg.FeeEstimator != nil && isNew && !dependsOnPool {
+		mp.cfg.FeeEstimator.ObserveTransaction(txHash, txD.FeePerKB)
+	}
+
 	log.Debug("Accepted transaction", "txHash", txHash, "pool size", len(mp.pool))
 
 	return nil, txD, nil
@@ -560,6 +702,18 @@ func (mp *TxPool) ProcessTransaction(tx *types.Tx, allowOrphan, rateLimit, allow
 			acceptedTxs = append(acceptedTxs, &td.TxDesc)
 		}
 
+		// Accepting the orphans may have evicted the transactions
+		// accepted before them from the full pool.
+		if mp.cfg.Policy.MaxPoolSize > 0 {
+			inPool := acceptedTxs[:0]
+			for _, td := range acceptedTxs {
+				if _, ok := mp.pool[*td.Tx.Hash()]; ok {
+					inPool = append(inPool, td)
+				}
+			}
+			acceptedTxs = inPool
+		}
+
 		return acceptedTxs, nil
 	}
 
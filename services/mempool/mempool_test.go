@@ -0,0 +1,38 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+
+package mempool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/types"
+)
+
+func TestRemoveTransactionNotify(t *testing.T) {
+	var removed []hash.Hash
+	var sequences []uint64
+	mp := New(&Config{TxRemoved: func(tx *types.Tx, mempoolSequence uint64) {
+		removed = append(removed, *tx.Hash())
+		sequences = append(sequences, mempoolSequence)
+	}})
+	mined := newPersistTx(&hash.Hash{1}, 0)
+	redeemer := newPersistTx(mined.Hash(), 0)
+	expired := newPersistTx(&hash.Hash{2}, 0)
+	for _, tx := range []*types.Tx{mined, redeemer, expired} {
+		addLimitTx(mp, tx, 1000, time.Now())
+	}
+
+	// Only the redeemer of the mined transaction is removed without being
+	// mined.
+	mp.RemoveTransaction(mined, true)
+	mp.removeTransaction(expired, true)
+	if len(removed) != 2 || removed[0] != *redeemer.Hash() ||
+		removed[1] != *expired.Hash() {
+		t.Fatalf("unexpected removals %v", removed)
+	}
+	if sequences[0] != 1 || sequences[1] != 3 {
+		t.Fatalf("unexpected mempool sequences %v", sequences)
+	}
+}
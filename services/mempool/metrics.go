@@ -0,0 +1,38 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+
+package mempool
+
+import (
+	"github.com/btceasypay/bitcoinpay/metrics"
+)
+
+// registerMetrics registers the gauges of the transactions, the size, the
+// fees and the orphans of the pool.
+func (mp *TxPool) registerMetrics() {
+	gauge := func(name string, value func() int64) {
+		metrics.NewFunctionalGauge(name, func() int64 {
+			mp.mtx.RLock()
+			defer mp.mtx.RUnlock()
+			return value()
+		})
+	}
+	gauge("mempool/txs", func() int64 {
+		return int64(len(mp.pool))
+	})
+	gauge("mempool/bytes", func() int64 {
+		return mp.poolSize
+	})
+	gauge("mempool/fees", func() int64 {
+		var fees int64
+		for _, txDesc := range mp.pool {
+			fees += txDesc.Fee
+		}
+		return fees
+	})
+	gauge("mempool/orphans", func() int64 {
+		return int64(len(mp.orphans))
+	})
+	metrics.NewFunctionalGauge("mempool/minfee", func() int64 {
+		return int64(mp.MinFee())
+	})
+}
@@ -0,0 +1,201 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+
+package mempool
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/log"
+)
+
+// MempoolFilename is the name of the file in the data directory the
+// transactions of the pool are saved to.
+const MempoolFilename = "mempool.json"
+
+// serialisationVersion is the current version of the saved pool.
+const serialisationVersion = 1
+
+// serializedTxDesc is a transaction of the pool in the saved pool.
+type serializedTxDesc struct {
+	Tx     string
+	Added  int64
+	Height int64
+	Fee    int64
+}
+
+// serializedTxPool is the saved pool.  The transactions are saved before the
+// transactions spending them, so they are accepted in order when loaded.
+type serializedTxPool struct {
+	Version int
+	Txs     []*serializedTxDesc
+	Orphans []string
+}
+
+// serializeTx returns the hex encoded serialized transaction.
+func serializeTx(tx *types.Tx) (string, error) {
+	serializedTx, err := tx.Tx.Serialize()
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(serializedTx), nil
+}
+
+// deserializeTx returns the transaction of the hex encoded serialized
+// transaction.
+func deserializeTx(s string) (*types.Tx, error) {
+	serializedTx, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var msgTx types.Transaction
+	if err := msgTx.Deserialize(bytes.NewReader(serializedTx)); err != nil {
+		return nil, err
+	}
+	return types.NewTx(&msgTx), nil
+}
+
+// Save writes the transactions and the orphans of the pool to the file.  It
+// returns the number of saved transactions and orphans.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Save(path string) (int, error) {
+	mp.mtx.RLock()
+	stp := serializedTxPool{
+		Version: serialisationVersion,
+		Txs:     make([]*serializedTxDesc, 0, len(mp.pool)),
+		Orphans: make([]string, 0, len(mp.orphans)),
+	}
+	// The transactions spent by a transaction of the pool are saved first.
+	saved := make(map[hash.Hash]struct{}, len(mp.pool))
+	var save func(txD *TxDesc) error
+	save = func(txD *TxDesc) error {
+		if _, ok := saved[*txD.Tx.Hash()]; ok {
+			return nil
+		}
+		saved[*txD.Tx.Hash()] = struct{}{}
+		for _, txIn := range txD.Tx.Tx.TxIn {
+			if prevTxD, ok := mp.pool[txIn.PreviousOut.Hash]; ok {
+				if err := save(prevTxD); err != nil {
+					return err
+				}
+			}
+		}
+		tx, err := serializeTx(txD.Tx)
+		if err != nil {
+			return err
+		}
+		stp.Txs = append(stp.Txs, &serializedTxDesc{
+			Tx:     tx,
+			Added:  txD.Added.Unix(),
+			Height: txD.Height,
+			Fee:    txD.Fee,
+		})
+		return nil
+	}
+	var err error
+	for _, txD := range mp.pool {
+		if err = save(txD); err != nil {
+			break
+		}
+	}
+	for _, orphan := range mp.orphans {
+		if err != nil {
+			break
+		}
+		var tx string
+		if tx, err = serializeTx(orphan); err == nil {
+			stp.Orphans = append(stp.Orphans, tx)
+		}
+	}
+	mp.mtx.RUnlock()
+	if err != nil {
+		return 0, err
+	}
+
+	// Write temporary pool file and then move it into place.
+	tmpfile := path + ".new"
+	w, err := os.Create(tmpfile)
+	if err != nil {
+		return 0, fmt.Errorf("error opening file %s: %v", tmpfile, err)
+	}
+	if err := json.NewEncoder(w).Encode(&stp); err != nil {
+		w.Close()
+		return 0, fmt.Errorf("failed to encode file %s: %v", tmpfile, err)
+	}
+	if err := w.Close(); err != nil {
+		return 0, fmt.Errorf("error closing file %s: %v", tmpfile, err)
+	}
+	if err := os.Rename(tmpfile, path); err != nil {
+		return 0, fmt.Errorf("error writing file %s: %v", path, err)
+	}
+	return len(stp.Txs) + len(stp.Orphans), nil
+}
+
+// Load adds the transactions and the orphans saved to the file to the pool.
+// They are validated again as new transactions, those which are invalid now,
+// e.g. because they were mined meanwhile, are dropped.  The fees are
+// calculated again while the transactions keep the time they were added.  It
+// returns the number of the loaded transactions and orphans.  A missing file
+// loads nothing.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Load(path string) (int, error) {
+	r, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error opening file %s: %v", path, err)
+	}
+	defer r.Close()
+
+	var stp serializedTxPool
+	if err := json.NewDecoder(r).Decode(&stp); err != nil {
+		return 0, fmt.Errorf("error reading %s: %v", path, err)
+	}
+	if stp.Version != serialisationVersion {
+		return 0, fmt.Errorf("unknown version %v in serialized mempool",
+			stp.Version)
+	}
+
+	loaded := 0
+	added := make(map[hash.Hash]time.Time, len(stp.Txs))
+	process := func(s string, allowOrphan bool) *types.Tx {
+		tx, err := deserializeTx(s)
+		if err != nil {
+			log.Debug(fmt.Sprintf("Failed to deserialize saved transaction: %v", err))
+			return nil
+		}
+		_, err = mp.ProcessTransaction(tx, allowOrphan, false, true)
+		if err != nil {
+			log.Debug(fmt.Sprintf("Dropped saved transaction %v: %v", tx.Hash(), err))
+			return nil
+		}
+		loaded++
+		return tx
+	}
+	for _, std := range stp.Txs {
+		if tx := process(std.Tx, false); tx != nil {
+			added[*tx.Hash()] = time.Unix(std.Added, 0)
+		}
+	}
+	for _, orphan := range stp.Orphans {
+		process(orphan, true)
+	}
+
+	mp.mtx.Lock()
+	for h, t := range added {
+		if txD, ok := mp.pool[h]; ok {
+			txD.Added = t
+		}
+	}
+	mp.mtx.Unlock()
+	return loaded, nil
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+
+package mempool
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/types"
+)
+
+// newPersistTx returns a transaction spending the output of the previous
+// transaction.
+func newPersistTx(prev *hash.Hash, index uint32) *types.Tx {
+	tx := types.NewTransaction()
+	tx.AddTxIn(types.NewTxInput(types.NewOutPoint(prev, index), []byte{0x51}))
+	tx.AddTxOut(types.NewTxOutput(1000, []byte{0x51}))
+	return types.NewTx(tx)
+}
+
+func TestSaveMempool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mempool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, MempoolFilename)
+
+	mp := New(&Config{})
+	parent := newPersistTx(&hash.Hash{1}, 0)
+	child := newPersistTx(parent.Hash(), 0)
+	grandchild := newPersistTx(child.Hash(), 0)
+	orphan := newPersistTx(&hash.Hash{2}, 0)
+	added := time.Unix(1600000000, 0)
+	for i, tx := range []*types.Tx{grandchild, child, parent} {
+		mp.pool[*tx.Hash()] = &TxDesc{TxDesc: types.TxDesc{
+			Tx:    tx,
+			Added: added.Add(time.Duration(i) * time.Second),
+			Fee:   int64(i),
+		}}
+	}
+	mp.orphans[*orphan.Hash()] = orphan
+
+	n, err := mp.Save(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Fatalf("saved %d transactions, want 4", n)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var stp serializedTxPool
+	if err := json.NewDecoder(f).Decode(&stp); err != nil {
+		t.Fatal(err)
+	}
+	if stp.Version != serialisationVersion || len(stp.Txs) != 3 || len(stp.Orphans) != 1 {
+		t.Fatalf("unexpected saved pool %+v", stp)
+	}
+	// The spent transactions are saved first.
+	for i, want := range []*types.Tx{parent, child, grandchild} {
+		tx, err := deserializeTx(stp.Txs[i].Tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !tx.Hash().IsEqual(want.Hash()) {
+			t.Fatalf("saved transaction #%d is %v, want %v", i, tx.Hash(), want.Hash())
+		}
+		txD := mp.pool[*want.Hash()]
+		if stp.Txs[i].Added != txD.Added.Unix() || stp.Txs[i].Fee != txD.Fee {
+			t.Fatalf("saved transaction #%d lost its added time or fee", i)
+		}
+	}
+	tx, err := deserializeTx(stp.Orphans[0])
+	if err != nil || !tx.Hash().IsEqual(orphan.Hash()) {
+		t.Fatalf("orphan not saved: %v", err)
+	}
+}
+
+func TestLoadMempool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mempool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, MempoolFilename)
+
+	// Nothing is loaded without a saved pool.
+	mp := New(&Config{})
+	if n, err := mp.Load(path); n != 0 || err != nil {
+		t.Fatalf("loaded %d transactions without a file: %v", n, err)
+	}
+
+	// The pool of an unknown version is not loaded.
+	err = ioutil.WriteFile(path, []byte(`{"Version":2}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mp.Load(path); err == nil {
+		t.Fatal("loaded the pool of an unknown version")
+	}
+}
@@ -134,6 +134,16 @@ type Policy struct {
 	// MinRelayTxFee defines the minimum transaction fee in AtomBitcoinpay/kB
 	MinRelayTxFee types.Amount
 
+	// RejectReplacement, if true, rejects accepting replacement
+	// transactions using the Replace-By-Fee (RBF) signaling policy into
+	// the mempool.
+	RejectReplacement bool
+
+	// MaxPoolSize is the maximum size in bytes of the serialized
+	// transactions in the pool.  The transactions with the lowest fees are
+	// evicted from the full pool.  A size of zero disables the limit.
+	MaxPoolSize int64
+
 	// StandardVerifyFlags defines the function to retrieve the flags to
 	// use for verifying scripts for the block after the current best block.
 	// It must set the verification flags properly depending on the result
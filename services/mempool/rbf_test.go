@@ -0,0 +1,135 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+
+package mempool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/types"
+)
+
+// newRBFTx returns a transaction spending the outpoints with the sequence,
+// the output amount makes the transaction unique.
+func newRBFTx(sequence uint32, amount uint64, prevOuts ...*types.TxOutPoint) *types.Tx {
+	tx := types.NewTransaction()
+	for _, prevOut := range prevOuts {
+		txIn := types.NewTxInput(prevOut, []byte{0x51})
+		txIn.Sequence = sequence
+		tx.AddTxIn(txIn)
+	}
+	tx.AddTxOut(types.NewTxOutput(amount, []byte{0x51}))
+	tx.AddTxOut(types.NewTxOutput(amount, []byte{0x51}))
+	return types.NewTx(tx)
+}
+
+// addRBFTx adds the transaction paying the fee to the pool.
+func addRBFTx(mp *TxPool, tx *types.Tx, fee int64) {
+	addLimitTx(mp, tx, fee*1000/int64(tx.Tx.SerializeSize()), time.Now())
+	mp.pool[*tx.Hash()].Fee = fee
+}
+
+func TestSignalsReplacement(t *testing.T) {
+	mp := New(&Config{})
+	final := newRBFTx(types.MaxTxInSequenceNum, 1, types.NewOutPoint(&hash.Hash{1}, 0))
+	signals := newRBFTx(MaxRBFSequence, 1, types.NewOutPoint(&hash.Hash{2}, 0))
+	inherits := newRBFTx(types.MaxTxInSequenceNum, 1, types.NewOutPoint(signals.Hash(), 0))
+	child := newRBFTx(types.MaxTxInSequenceNum, 1, types.NewOutPoint(final.Hash(), 0))
+	for _, tx := range []*types.Tx{final, signals, inherits, child} {
+		addRBFTx(mp, tx, 1000)
+	}
+
+	tests := []struct {
+		tx   *types.Tx
+		want bool
+	}{
+		{final, false},
+		{signals, true},
+		{inherits, true},
+		{child, false},
+	}
+	for i, test := range tests {
+		if got := mp.signalsReplacement(test.tx, nil); got != test.want {
+			t.Fatalf("test #%d: signals replacement %v, want %v", i, got, test.want)
+		}
+	}
+
+	// Only the transactions signalling replacement can be double spent.
+	double := newRBFTx(types.MaxTxInSequenceNum, 2, types.NewOutPoint(&hash.Hash{1}, 0))
+	if _, err := mp.checkPoolDoubleSpend(double); err == nil {
+		t.Fatal("double spent a transaction not signalling replacement")
+	}
+	replacement := newRBFTx(types.MaxTxInSequenceNum, 2, types.NewOutPoint(&hash.Hash{2}, 0))
+	isReplacement, err := mp.checkPoolDoubleSpend(replacement)
+	if err != nil || !isReplacement {
+		t.Fatalf("replacement not accepted: %v", err)
+	}
+	mp.cfg.Policy.RejectReplacement = true
+	if _, err := mp.checkPoolDoubleSpend(replacement); err == nil {
+		t.Fatal("replacement accepted by a pool rejecting replacements")
+	}
+}
+
+func TestValidateReplacement(t *testing.T) {
+	mp := New(&Config{Policy: Policy{MinRelayTxFee: 1000}})
+	confirmed := types.NewOutPoint(&hash.Hash{1}, 0)
+	parent := newRBFTx(MaxRBFSequence, 1, confirmed)
+	child := newRBFTx(MaxRBFSequence, 1, types.NewOutPoint(parent.Hash(), 0))
+	other := newRBFTx(types.MaxTxInSequenceNum, 1, types.NewOutPoint(&hash.Hash{2}, 0))
+	addRBFTx(mp, parent, 10000)
+	addRBFTx(mp, child, 20000)
+	addRBFTx(mp, other, 1000)
+
+	conflicts := mp.txConflicts(newRBFTx(MaxRBFSequence, 2, confirmed))
+	if len(conflicts) != 2 || conflicts[*parent.Hash()] == nil ||
+		conflicts[*child.Hash()] == nil {
+		t.Fatalf("unexpected conflicts %v", conflicts)
+	}
+
+	tests := []struct {
+		name  string
+		tx    *types.Tx
+		fee   int64
+		valid bool
+	}{
+		{
+			name: "fee rate not higher than the conflicts",
+			tx:   newRBFTx(MaxRBFSequence, 2, confirmed),
+			fee:  20000,
+		},
+		{
+			name: "absolute fee not higher than the conflicts",
+			tx:   newRBFTx(MaxRBFSequence, 2, confirmed),
+			fee:  30000 + 1,
+		},
+		{
+			name: "spending a replaced transaction",
+			tx: newRBFTx(MaxRBFSequence, 2, confirmed,
+				types.NewOutPoint(child.Hash(), 0)),
+			fee: 100000,
+		},
+		{
+			name: "spending a new unconfirmed output",
+			tx: newRBFTx(MaxRBFSequence, 2, confirmed,
+				types.NewOutPoint(other.Hash(), 0)),
+			fee: 100000,
+		},
+		{
+			name:  "valid replacement",
+			tx:    newRBFTx(MaxRBFSequence, 2, confirmed),
+			fee:   100000,
+			valid: true,
+		},
+	}
+	for _, test := range tests {
+		conflicts, err := mp.validateReplacement(test.tx, test.fee)
+		if test.valid != (err == nil) {
+			t.Fatalf("%s: got error %v", test.name, err)
+		}
+		if test.valid && len(conflicts) != 2 {
+			t.Fatalf("%s: replaces %d transactions, want 2", test.name,
+				len(conflicts))
+		}
+	}
+}
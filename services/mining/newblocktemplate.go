@@ -30,8 +30,10 @@ import (
 // value, age of inputs, and size.  Transactions which consist of larger
 // amounts, older inputs, and small sizes have the highest priority.  Second, a
 // fee per kilobyte is calculated for each transaction.  Transactions with a
-// higher fee per kilobyte are preferred.  Finally, the block generation related
-// policy settings are all taken into account.
+// higher fee per kilobyte are preferred.  The fee per kilobyte of a transaction
+// is raised to the fee rate of the package it forms with a child spending it
+// in the source pool, so the child pays for its parents.  Finally, the block
+// generation related policy settings are all taken into account.
 //
 // Transactions which only spend outputs from other transactions already in the
 // block chain are immediately added to a priority queue which either
@@ -139,7 +141,7 @@ func NewBlockTemplate(policy *Policy, params *params.Params,
 		return nil, err
 	}
 
-	coinbaseSigOpCost := int64(blockchain.CountSigOps(coinbaseTx))
+	coinbaseSigOpCost := int64(blockchain.CountSigOps(coinbaseTx, scriptFlags))
 	// Get the current source transactions and create a priority queue to
 	// hold the transactions which are ready for inclusion into a block
 	// along with some priority related and fee metadata.  Reserve the same
@@ -149,6 +151,10 @@ func NewBlockTemplate(policy *Policy, params *params.Params,
 	sourceTxns := txSource.MiningDescs()
 	sortedByFee := policy.BlockPrioritySize == 0
 	weightedRandQueue := newWeightedRandQueue(len(sourceTxns))
+	// The transactions are ranked by the fee rates of the packages with
+	// their unconfirmed ancestors, so a child paying a high fee pulls its
+	// parents into the block.
+	packageFeeRates := calcPackageFeeRates(sourceTxns)
 	// Create a slice to hold the transactions to be included in the
 	// generated block with reserved space.  Also create a utxo view to
 	// house all of the input transactions so multiple lookups can be
@@ -249,6 +255,9 @@ mempoolLoop:
 		// Calculate the fee in Satoshi/kB.
 		weirandItem.feePerKB = txDesc.FeePerKB
 		weirandItem.fee = txDesc.Fee
+		weirandItem.packageFeePerKB = packageFeeRates[*tx.Hash()]
+		weirandItem.packageFee = weirandItem.packageFeePerKB *
+			int64(tx.Tx.SerializeSize()) / 1000
 
 		// Add the transaction to the priority queue to mark it ready
 		// for inclusion in the block unless it has dependencies.
@@ -294,7 +303,7 @@ mempoolLoop:
 
 		// Enforce maximum signature operation cost per block.  Also
 		// check for overflow.
-		sigOpCost := blockchain.CountSigOps(tx)
+		sigOpCost := blockchain.CountSigOps(tx, scriptFlags)
 		if blockSigOpCost+int64(sigOpCost) < blockSigOpCost ||
 			blockSigOpCost+int64(sigOpCost) > blockchain.MaxSigOpsPerBlock {
 			log.Trace(fmt.Sprintf("Skipping tx %s because it would "+
@@ -304,13 +313,13 @@ mempoolLoop:
 		}
 
 		// Skip free transactions once the block is larger than the
-		// minimum block size.
+		// minimum block size, unless a child pays for them.
 		if sortedByFee &&
-			weirandItem.feePerKB < int64(policy.TxMinFreeFee) &&
+			weirandItem.packageFeePerKB < int64(policy.TxMinFreeFee) &&
 			(blockPlusTxSize >= policy.BlockMinSize) {
-			log.Trace(fmt.Sprintf("Skipping tx %s with feePerKB %.2d "+
+			log.Trace(fmt.Sprintf("Skipping tx %s with package feePerKB %.2d "+
 				"< TxMinFreeFee %d and block size %d >= "+
-				"minBlockSize %d", tx.Hash(), weirandItem.feePerKB,
+				"minBlockSize %d", tx.Hash(), weirandItem.packageFeePerKB,
 				policy.TxMinFreeFee, blockPlusTxSize,
 				policy.BlockMinSize))
 			logSkippedDeps(tx, deps)
@@ -326,6 +335,13 @@ mempoolLoop:
 			logSkippedDeps(tx, deps)
 			continue
 		}
+		_, err = blockManager.GetChain().CheckTransactionAssets(tx, blockUtxos)
+		if err != nil {
+			log.Trace(fmt.Sprintf("Skipping tx %s due to error in "+
+				"CheckTransactionAssets: %v", tx.Hash(), err))
+			logSkippedDeps(tx, deps)
+			continue
+		}
 		err = blockchain.ValidateTransactionScripts(tx, blockUtxos,
 			scriptFlags, sigCache)
 		if err != nil {
@@ -419,8 +435,12 @@ mempoolLoop:
 		return nil, miningRuleError(ErrGettingDifficulty, err.Error())
 	}
 
-	// Choose the block version to generate based on the network.
-	blockVersion := BlockVersion(params.Net)
+	// Choose the block version to generate based on the network and the
+	// state of the deployments voted on.
+	blockVersion, err := blockManager.GetChain().CalcNextBlockVersion()
+	if err != nil {
+		return nil, err
+	}
 
 	// Create a new block ready to be solved.
 	merkles := merkle.BuildMerkleTreeStore(blockTxns, false)
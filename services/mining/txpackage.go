@@ -0,0 +1,66 @@
+package mining
+
+import (
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/types"
+)
+
+// calcPackageFeeRates returns the package fee per kilobyte of the passed
+// transactions of the source pool.  The ancestor package of a transaction is
+// the transaction with all of its unconfirmed ancestors, which have to be
+// included in the block before it.  The package fee rate of a transaction is
+// the highest fee rate of the ancestor packages it is part of, so it is at
+// least its own fee rate and a child paying a higher fee raises the fee rate
+// of its parents (child pays for parent).
+func calcPackageFeeRates(descs []*types.TxDesc) map[hash.Hash]int64 {
+	pool := make(map[hash.Hash]*types.TxDesc, len(descs))
+	sizes := make(map[hash.Hash]int64, len(descs))
+	rates := make(map[hash.Hash]int64, len(descs))
+	for _, desc := range descs {
+		h := *desc.Tx.Hash()
+		pool[h] = desc
+		sizes[h] = int64(desc.Tx.Tx.SerializeSize())
+		rates[h] = desc.FeePerKB
+	}
+
+	// The ancestors of each transaction are only collected once.
+	ancestors := make(map[hash.Hash]map[hash.Hash]struct{}, len(descs))
+	var txAncestors func(desc *types.TxDesc) map[hash.Hash]struct{}
+	txAncestors = func(desc *types.TxDesc) map[hash.Hash]struct{} {
+		if txAncs, ok := ancestors[*desc.Tx.Hash()]; ok {
+			return txAncs
+		}
+		txAncs := make(map[hash.Hash]struct{})
+		for _, txIn := range desc.Tx.Tx.TxIn {
+			parent, ok := pool[txIn.PreviousOut.Hash]
+			if !ok {
+				continue
+			}
+			txAncs[txIn.PreviousOut.Hash] = struct{}{}
+			for h := range txAncestors(parent) {
+				txAncs[h] = struct{}{}
+			}
+		}
+		ancestors[*desc.Tx.Hash()] = txAncs
+		return txAncs
+	}
+
+	for _, desc := range descs {
+		txAncs := txAncestors(desc)
+		if len(txAncs) == 0 {
+			continue
+		}
+		fee, size := desc.Fee, sizes[*desc.Tx.Hash()]
+		for h := range txAncs {
+			fee += pool[h].Fee
+			size += sizes[h]
+		}
+		rate := fee * 1000 / size
+		for h := range txAncs {
+			if rate > rates[h] {
+				rates[h] = rate
+			}
+		}
+	}
+	return rates
+}
@@ -0,0 +1,58 @@
+package mining
+
+import (
+	"testing"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/core/types"
+)
+
+// newPackageTxDesc returns the descriptor of a transaction spending the
+// outputs of the parents and paying the fee.
+func newPackageTxDesc(fee int64, parents ...*hash.Hash) *types.TxDesc {
+	tx := types.NewTransaction()
+	for _, parent := range parents {
+		tx.AddTxIn(types.NewTxInput(types.NewOutPoint(parent, 0), []byte{0x51}))
+	}
+	tx.AddTxOut(types.NewTxOutput(uint64(fee), []byte{0x51}))
+	return &types.TxDesc{
+		Tx:       types.NewTx(tx),
+		Fee:      fee,
+		FeePerKB: fee * 1000 / int64(tx.SerializeSize()),
+	}
+}
+
+func TestCalcPackageFeeRates(t *testing.T) {
+	parent := newPackageTxDesc(0, &hash.Hash{1})
+	child := newPackageTxDesc(10000, parent.Tx.Hash())
+	lowChild := newPackageTxDesc(100, parent.Tx.Hash())
+	single := newPackageTxDesc(5000, &hash.Hash{2})
+	grandchild := newPackageTxDesc(1000, child.Tx.Hash())
+	rates := calcPackageFeeRates([]*types.TxDesc{grandchild, lowChild, child,
+		single, parent})
+
+	size := func(desc *types.TxDesc) int64 {
+		return int64(desc.Tx.Tx.SerializeSize())
+	}
+	childPackage := (parent.Fee + child.Fee) * 1000 / (size(parent) + size(child))
+	tests := []struct {
+		name string
+		desc *types.TxDesc
+		want int64
+	}{
+		{"parent pulled by the child", parent, childPackage},
+		{"child paying for the parent", child, child.FeePerKB},
+		{"child paying less than the package", lowChild, lowChild.FeePerKB},
+		{"grandchild", grandchild, grandchild.FeePerKB},
+		{"transaction without ancestors", single, single.FeePerKB},
+	}
+	for _, test := range tests {
+		if rates[*test.desc.Tx.Hash()] != test.want {
+			t.Fatalf("%s: package fee rate %d, want %d", test.name,
+				rates[*test.desc.Tx.Hash()], test.want)
+		}
+	}
+	if childPackage <= parent.FeePerKB || childPackage >= child.FeePerKB {
+		t.Fatalf("unexpected package fee rate %d", childPackage)
+	}
+}
@@ -14,9 +14,26 @@ type WeightedRandTx struct {
 	priority float64
 	feePerKB int64
 
+	// packageFeePerKB is the fee per kilobyte of the best package of
+	// transactions which includes this one with its unconfirmed
+	// ancestors, so a child paying a high fee pulls its parents into the
+	// block.  packageFee is the fee the transaction is weighted with for
+	// that fee rate.
+	packageFeePerKB int64
+	packageFee      int64
+
 	dependsOn map[hash.Hash]struct{}
 }
 
+// weight returns the weight of the transaction in the queue, which is its
+// fee or the fee of its package when higher.
+func (tx *WeightedRandTx) weight() int64 {
+	if tx.packageFee > tx.fee {
+		return tx.packageFee + 1
+	}
+	return tx.fee + 1
+}
+
 // The Queue for weighted rand tx
 type WeightedRandQueue struct {
 	totalFee int64
@@ -31,7 +48,7 @@ func (wq *WeightedRandQueue) Len() int {
 // Push item to WeightedRandQueue
 func (wq *WeightedRandQueue) Push(tx *WeightedRandTx) {
 	wq.items = append(wq.items, tx)
-	wq.totalFee += tx.fee + 1
+	wq.totalFee += tx.weight()
 }
 
 // Pop item from WeightedRandQueue
@@ -45,13 +62,13 @@ func (wq *WeightedRandQueue) Pop() *WeightedRandTx {
 	index := int(0)
 	var item *WeightedRandTx
 	for index, item = range wq.items {
-		total += item.fee
-		if total >= factor {
+		total += item.weight()
+		if total > factor {
 			break
 		}
 	}
 	wq.items = append(wq.items[:index], wq.items[index+1:]...)
-	total = total - item.fee - 1
+	wq.totalFee -= item.weight()
 
 	return item
 }
@@ -0,0 +1,66 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+
+package notifymgr
+
+import (
+	"context"
+	"github.com/btceasypay/bitcoinpay/rpc"
+)
+
+func (ntmgr *NotifyMgr) APIs() []rpc.API {
+	return []rpc.API{
+		{
+			NameSpace: rpc.DefaultServiceNameSpace,
+			Service:   NewPublicNotifyAPI(ntmgr),
+			Public:    true,
+		},
+	}
+}
+
+// PublicNotifyAPI provides the subscriptions of block chain and mempool
+// events, only available on websocket connections.
+type PublicNotifyAPI struct {
+	ntmgr *NotifyMgr
+}
+
+func NewPublicNotifyAPI(ntmgr *NotifyMgr) *PublicNotifyAPI {
+	return &PublicNotifyAPI{ntmgr}
+}
+
+// NewBlocks sends every block accepted into the block DAG.
+func (api *PublicNotifyAPI) NewBlocks(ctx context.Context) (*rpc.Subscription, error) {
+	return api.ntmgr.subscribe(ctx, &rpcSub{topic: topicNewBlocks})
+}
+
+// BlockConnected sends every block connected in DAG order, including the
+// blocks reconnected by a reorganization.
+func (api *PublicNotifyAPI) BlockConnected(ctx context.Context) (*rpc.Subscription, error) {
+	return api.ntmgr.subscribe(ctx, &rpcSub{topic: topicBlockConnected})
+}
+
+// BlockDisconnected sends every block losing its order, in the order they
+// are disconnected.
+func (api *PublicNotifyAPI) BlockDisconnected(ctx context.Context) (*rpc.Subscription, error) {
+	return api.ntmgr.subscribe(ctx, &rpcSub{topic: topicBlockDisconnected})
+}
+
+// Reorganization sends the re-ordering of the DAG before the affected blocks
+// are disconnected and connected again.
+func (api *PublicNotifyAPI) Reorganization(ctx context.Context) (*rpc.Subscription, error) {
+	return api.ntmgr.subscribe(ctx, &rpcSub{topic: topicReorganization})
+}
+
+// NewTransactions sends every transaction accepted into the mempool, the
+// serialized transaction is included if fullTx is set.
+func (api *PublicNotifyAPI) NewTransactions(ctx context.Context, fullTx *bool) (*rpc.Subscription, error) {
+	sub := &rpcSub{topic: topicNewTransactions}
+	if fullTx != nil {
+		sub.fullTx = *fullTx
+	}
+	return api.ntmgr.subscribe(ctx, sub)
+}
+
+// NewTips sends the DAG tips whenever the tip set changes.
+func (api *PublicNotifyAPI) NewTips(ctx context.Context) (*rpc.Subscription, error) {
+	return api.ntmgr.subscribe(ctx, &rpcSub{topic: topicNewTips})
+}
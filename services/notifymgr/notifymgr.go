@@ -1,10 +1,12 @@
 package notifymgr
 
 import (
+	"github.com/btceasypay/bitcoinpay/core/blockdag"
 	"github.com/btceasypay/bitcoinpay/core/message"
 	"github.com/btceasypay/bitcoinpay/core/types"
 	"github.com/btceasypay/bitcoinpay/p2p/peerserver"
 	"github.com/btceasypay/bitcoinpay/rpc"
+	"sync"
 )
 
 // NotifyMgr manage message announce & relay & notification between mempool, websocket, gbt long pull
@@ -12,6 +14,11 @@ import (
 type NotifyMgr struct {
 	Server    *peerserver.PeerServer
 	RpcServer *rpc.RpcServer
+
+	// rpc subscriptions, see subscription.go
+	subsMtx sync.RWMutex
+	clients map[*rpc.Notifier]*rpcClient
+	lastGS  *blockdag.GraphState
 }
 
 // AnnounceNewTransactions generates and relays inventory vectors and notifies
@@ -27,9 +34,9 @@ func (ntmgr *NotifyMgr) AnnounceNewTransactions(newTxs []*types.TxDesc) {
 		iv := message.NewInvVect(message.InvTypeTx, tx.Tx.Hash())
 		// reply to p2p
 		ntmgr.RelayInventory(iv, tx)
-		// reply to rpc
-
 	}
+	// reply to rpc
+	ntmgr.notifyNewTransactions(newTxs)
 }
 
 // RelayInventory relays the passed inventory vector to all connected peers
@@ -0,0 +1,283 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+
+package notifymgr
+
+import (
+	"context"
+	"encoding/hex"
+	"github.com/btceasypay/bitcoinpay/core/blockchain"
+	"github.com/btceasypay/bitcoinpay/core/blockdag"
+	"github.com/btceasypay/bitcoinpay/core/json"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/rpc"
+)
+
+// The topics rpc clients can subscribe to.
+const (
+	topicNewBlocks         = "newBlocks"
+	topicBlockConnected    = "blockConnected"
+	topicBlockDisconnected = "blockDisconnected"
+	topicReorganization    = "reorganization"
+	topicNewTransactions   = "newTransactions"
+	topicNewTips           = "newTips"
+)
+
+// maxPendingEvents is the number of events queued for a single rpc client
+// before it is considered lagging and all its subscriptions are dropped.
+const maxPendingEvents = 1024
+
+// rpcSub is a single subscription of a client.
+type rpcSub struct {
+	topic  string
+	fullTx bool
+}
+
+// rpcEvent is an event queued for delivery to a subscription.
+type rpcEvent struct {
+	id   rpc.ID
+	data interface{}
+}
+
+// rpcClient holds all subscriptions of a single rpc connection.  Events for
+// all topics are delivered through the same queue, so a client observes them
+// in the order the chain and the mempool produced them.
+type rpcClient struct {
+	notifier *rpc.Notifier
+	subs     map[rpc.ID]*rpcSub
+	events   chan *rpcEvent
+	quit     chan struct{}
+}
+
+// subscribe creates a subscription of the given topic for the rpc connection
+// of ctx.
+func (ntmgr *NotifyMgr) subscribe(ctx context.Context, sub *rpcSub) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return nil, rpc.ErrNotificationsUnsupported
+	}
+	subscription := notifier.CreateSubscription()
+
+	ntmgr.subsMtx.Lock()
+	if ntmgr.clients == nil {
+		ntmgr.clients = make(map[*rpc.Notifier]*rpcClient)
+	}
+	client, ok := ntmgr.clients[notifier]
+	if !ok {
+		client = &rpcClient{
+			notifier: notifier,
+			subs:     make(map[rpc.ID]*rpcSub),
+			events:   make(chan *rpcEvent, maxPendingEvents),
+			quit:     make(chan struct{}),
+		}
+		ntmgr.clients[notifier] = client
+		go ntmgr.clientHandler(client)
+	}
+	client.subs[subscription.ID] = sub
+	ntmgr.subsMtx.Unlock()
+
+	go func() {
+		select {
+		case <-subscription.Err():
+			ntmgr.subsMtx.Lock()
+			delete(client.subs, subscription.ID)
+			ntmgr.subsMtx.Unlock()
+		case <-client.quit:
+		}
+	}()
+	log.Debug("New rpc subscription", "topic", sub.topic, "id", subscription.ID)
+	return subscription, nil
+}
+
+// clientHandler delivers the queued events of a client until the connection
+// is closed or the client is dropped.
+func (ntmgr *NotifyMgr) clientHandler(client *rpcClient) {
+	defer ntmgr.removeClient(client)
+	for {
+		select {
+		case ev := <-client.events:
+			if err := client.notifier.Notify(ev.id, ev.data); err != nil {
+				log.Debug("Failed to send rpc notification", "error", err)
+				return
+			}
+		case <-client.notifier.Closed():
+			return
+		case <-client.quit:
+			return
+		}
+	}
+}
+
+// removeClient drops the client and all of its subscriptions.
+func (ntmgr *NotifyMgr) removeClient(client *rpcClient) {
+	ntmgr.subsMtx.Lock()
+	defer ntmgr.subsMtx.Unlock()
+	if ntmgr.clients[client.notifier] != client {
+		return
+	}
+	delete(ntmgr.clients, client.notifier)
+	close(client.quit)
+}
+
+// publish queues the event built by makeEvent for every subscription of the
+// topic.  makeEvent is only called when there are subscribers.
+func (ntmgr *NotifyMgr) publish(topic string, makeEvent func(sub *rpcSub) interface{}) {
+	var lagging []*rpcClient
+
+	ntmgr.subsMtx.RLock()
+	for _, client := range ntmgr.clients {
+		for id, sub := range client.subs {
+			if sub.topic != topic {
+				continue
+			}
+			select {
+			case client.events <- &rpcEvent{id: id, data: makeEvent(sub)}:
+				continue
+			default:
+			}
+			lagging = append(lagging, client)
+			break
+		}
+	}
+	ntmgr.subsMtx.RUnlock()
+
+	// Clients which can't keep up would miss events and end up with an
+	// inconsistent view of the DAG, so drop them instead.  Their connection
+	// is closed, so they don't keep waiting on subscriptions which no
+	// longer receive events.
+	for _, client := range lagging {
+		log.Warn("Dropping lagging rpc client subscriptions",
+			"pending", len(client.events))
+		ntmgr.removeClient(client)
+		client.notifier.Close()
+	}
+}
+
+// NotifyBlockChain forwards the block chain notification to the rpc
+// subscribers of the matching topic.
+func (ntmgr *NotifyMgr) NotifyBlockChain(n *blockchain.Notification) {
+	switch n.Type {
+	case blockchain.BlockAccepted:
+		band, ok := n.Data.(*blockchain.BlockAcceptedNotifyData)
+		if !ok {
+			return
+		}
+		ntmgr.publishBlock(topicNewBlocks, band.Block)
+
+	case blockchain.BlockConnected:
+		blockSlice, ok := n.Data.([]*types.SerializedBlock)
+		if !ok || len(blockSlice) != 1 {
+			return
+		}
+		ntmgr.publishBlock(topicBlockConnected, blockSlice[0])
+
+	case blockchain.BlockDisconnected:
+		block, ok := n.Data.(*types.SerializedBlock)
+		if !ok {
+			return
+		}
+		ntmgr.publishBlock(topicBlockDisconnected, block)
+
+	case blockchain.Reorganization:
+		rd, ok := n.Data.(*blockchain.ReorganizationNotifyData)
+		if !ok {
+			return
+		}
+		ntmgr.publish(topicReorganization, func(*rpcSub) interface{} {
+			result := &json.ReorganizationNotifyResult{
+				OldHash:   rd.OldHash.String(),
+				OldHeight: rd.OldHeight,
+				NewHash:   rd.NewHash.String(),
+				NewHeight: rd.NewHeight,
+				Detached:  make([]string, 0, len(rd.DetachedBlocks)),
+				Attached:  make([]string, 0, len(rd.AttachedBlocks)),
+			}
+			for _, h := range rd.DetachedBlocks {
+				result.Detached = append(result.Detached, h.String())
+			}
+			for _, h := range rd.AttachedBlocks {
+				result.Attached = append(result.Attached, h.String())
+			}
+			return result
+		})
+	}
+}
+
+// publishBlock sends the block to the subscribers of the topic.
+func (ntmgr *NotifyMgr) publishBlock(topic string, block *types.SerializedBlock) {
+	var result *json.BlockNotifyResult
+	ntmgr.publish(topic, func(*rpcSub) interface{} {
+		if result != nil {
+			return result
+		}
+		header := &block.Block().Header
+		result = &json.BlockNotifyResult{
+			Hash:    block.Hash().String(),
+			Order:   block.Order(),
+			Height:  uint64(block.Height()),
+			Parents: make([]string, 0, len(block.Block().Parents)),
+			Time:    header.Timestamp.Unix(),
+			Tx:      make([]string, 0, len(block.Transactions())),
+		}
+		for _, p := range block.Block().Parents {
+			result.Parents = append(result.Parents, p.String())
+		}
+		for _, tx := range block.Transactions() {
+			result.Tx = append(result.Tx, tx.Hash().String())
+		}
+		return result
+	})
+}
+
+// NotifyGraphState sends the tips of the graph state to the newTips
+// subscribers if the set of tips changed since the last call.
+func (ntmgr *NotifyMgr) NotifyGraphState(gs *blockdag.GraphState) {
+	if gs == nil {
+		return
+	}
+	ntmgr.subsMtx.Lock()
+	if ntmgr.lastGS != nil && ntmgr.lastGS.GetTips().IsEqual(gs.GetTips()) {
+		ntmgr.subsMtx.Unlock()
+		return
+	}
+	ntmgr.lastGS = gs.Clone()
+	ntmgr.subsMtx.Unlock()
+
+	ntmgr.publish(topicNewTips, func(*rpcSub) interface{} {
+		mainTip := gs.GetMainChainTip()
+		result := &json.TipsNotifyResult{
+			MainTip:    mainTip.String(),
+			Tips:       []string{},
+			MainOrder:  uint32(gs.GetMainOrder()),
+			MainHeight: uint32(gs.GetMainHeight()),
+			Layer:      uint32(gs.GetLayer()),
+		}
+		for _, tip := range gs.GetTips().List() {
+			result.Tips = append(result.Tips, tip.String())
+		}
+		return result
+	})
+}
+
+// notifyNewTransactions sends the transactions accepted into the mempool to
+// the newTransactions subscribers.
+func (ntmgr *NotifyMgr) notifyNewTransactions(newTxs []*types.TxDesc) {
+	for _, txD := range newTxs {
+		tx := txD
+		ntmgr.publish(topicNewTransactions, func(sub *rpcSub) interface{} {
+			msgTx := tx.Tx.Transaction()
+			result := &json.TxNotifyResult{
+				Txid:     tx.Tx.Hash().String(),
+				Size:     msgTx.SerializeSize(),
+				Fee:      tx.Fee,
+				FeePerKB: tx.FeePerKB,
+				Time:     tx.Added.Unix(),
+			}
+			if sub.fullTx {
+				if txBytes, err := msgTx.Serialize(); err == nil {
+					result.Hex = hex.EncodeToString(txBytes)
+				}
+			}
+			return result
+		})
+	}
+}
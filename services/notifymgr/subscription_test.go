@@ -0,0 +1,214 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+
+package notifymgr
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/config"
+	"github.com/btceasypay/bitcoinpay/core/blockchain"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/core/types/pow"
+	"github.com/btceasypay/bitcoinpay/rpc"
+	"golang.org/x/net/websocket"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// freeAddr returns a local address which is free to listen on.
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+type testNotification struct {
+	Id     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Params struct {
+		Subscription string          `json:"subscription"`
+		Result       json.RawMessage `json:"result"`
+	} `json:"params"`
+}
+
+// startTestServer starts an rpc server serving the subscriptions of a new
+// NotifyMgr and connects a websocket client to it.
+func startTestServer(t *testing.T) (*NotifyMgr, *websocket.Conn, func()) {
+	addr := freeAddr(t)
+	cfg := &config.Config{
+		RPCListeners:     []string{addr},
+		RPCUser:          "user",
+		RPCPass:          "pass",
+		RPCMaxClients:    1,
+		RPCMaxWebsockets: 1,
+		DisableTLS:       true,
+	}
+	server, err := rpc.NewRPCServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ntmgr := &NotifyMgr{RpcServer: server}
+	for _, api := range ntmgr.APIs() {
+		if err := server.RegisterService(api.NameSpace, api.Service); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	wsCfg, err := websocket.NewConfig("ws://"+addr+"/ws", "http://localhost/")
+	if err != nil {
+		server.Stop()
+		t.Fatal(err)
+	}
+	login := base64.StdEncoding.EncodeToString([]byte("user:pass"))
+	wsCfg.Header = http.Header{"Authorization": {"Basic " + login}}
+	conn, err := websocket.DialConfig(wsCfg)
+	if err != nil {
+		server.Stop()
+		t.Fatal(err)
+	}
+	return ntmgr, conn, func() {
+		conn.Close()
+		server.Stop()
+	}
+}
+
+func TestSubscriptionOrdering(t *testing.T) {
+	ntmgr, conn, stop := startTestServer(t)
+	defer stop()
+
+	subIDs := make(map[string]string)
+	for i, topic := range []string{topicBlockDisconnected, topicReorganization, topicBlockConnected} {
+		req := fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"subscribe","params":["%s"]}`, i, topic)
+		if err := websocket.Message.Send(conn, req); err != nil {
+			t.Fatal(err)
+		}
+		var reply testNotification
+		if err := websocket.JSON.Receive(conn, &reply); err != nil {
+			t.Fatal(err)
+		}
+		var id string
+		if err := json.Unmarshal(reply.Result, &id); err != nil {
+			t.Fatalf("subscribe %s: %v", topic, err)
+		}
+		subIDs[id] = topic
+	}
+	// subscriptions are activated after the reply was written
+	time.Sleep(50 * time.Millisecond)
+
+	newTestBlock := func(nonce uint32) *types.SerializedBlock {
+		return types.NewBlock(&types.Block{Header: types.BlockHeader{
+			Pow: pow.GetInstance(pow.BLAKE2BD, nonce, []byte{}),
+		}})
+	}
+	oldBlock := newTestBlock(1)
+	newBlock := newTestBlock(2)
+	ntmgr.NotifyBlockChain(&blockchain.Notification{
+		Type: blockchain.Reorganization,
+		Data: &blockchain.ReorganizationNotifyData{
+			OldHash:        *oldBlock.Hash(),
+			NewHash:        *newBlock.Hash(),
+			DetachedBlocks: []hash.Hash{*oldBlock.Hash()},
+			AttachedBlocks: []hash.Hash{*newBlock.Hash(), *oldBlock.Hash()},
+		},
+	})
+	ntmgr.NotifyBlockChain(&blockchain.Notification{
+		Type: blockchain.BlockDisconnected, Data: oldBlock})
+	ntmgr.NotifyBlockChain(&blockchain.Notification{
+		Type: blockchain.BlockConnected, Data: []*types.SerializedBlock{newBlock}})
+	ntmgr.NotifyBlockChain(&blockchain.Notification{
+		Type: blockchain.BlockConnected, Data: []*types.SerializedBlock{oldBlock}})
+
+	expected := []struct {
+		topic string
+		hash  string
+	}{
+		{topicReorganization, newBlock.Hash().String()},
+		{topicBlockDisconnected, oldBlock.Hash().String()},
+		{topicBlockConnected, newBlock.Hash().String()},
+		{topicBlockConnected, oldBlock.Hash().String()},
+	}
+	for i, want := range expected {
+		var ntfn testNotification
+		if err := websocket.JSON.Receive(conn, &ntfn); err != nil {
+			t.Fatal(err)
+		}
+		topic := subIDs[ntfn.Params.Subscription]
+		if topic != want.topic {
+			t.Fatalf("notification %d: got topic %s, want %s", i, topic, want.topic)
+		}
+		var result struct {
+			Hash    string `json:"hash"`
+			NewHash string `json:"newhash"`
+		}
+		if err := json.Unmarshal(ntfn.Params.Result, &result); err != nil {
+			t.Fatal(err)
+		}
+		got := result.Hash
+		if topic == topicReorganization {
+			got = result.NewHash
+		}
+		if got != want.hash {
+			t.Fatalf("notification %d: got block %s, want %s", i, got, want.hash)
+		}
+	}
+}
+
+// TestLaggingClient ensures a client which doesn't keep up with its
+// notifications is dropped and its connection closed, rather than left
+// subscribed without receiving events.
+func TestLaggingClient(t *testing.T) {
+	ntmgr, conn, stop := startTestServer(t)
+	defer stop()
+
+	req := `{"jsonrpc":"2.0","id":1,"method":"subscribe","params":["blockConnected"]}`
+	if err := websocket.Message.Send(conn, req); err != nil {
+		t.Fatal(err)
+	}
+	var reply testNotification
+	if err := websocket.JSON.Receive(conn, &reply); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// The client doesn't read, so the events pile up once the socket
+	// buffers are full.
+	block := types.NewBlock(&types.Block{Header: types.BlockHeader{
+		Pow: pow.GetInstance(pow.BLAKE2BD, 1, []byte{}),
+	}})
+	dropped := false
+	for i := 0; i < 1000000 && !dropped; i++ {
+		ntmgr.NotifyBlockChain(&blockchain.Notification{
+			Type: blockchain.BlockConnected, Data: []*types.SerializedBlock{block}})
+		ntmgr.subsMtx.RLock()
+		dropped = len(ntmgr.clients) == 0
+		ntmgr.subsMtx.RUnlock()
+	}
+	if !dropped {
+		t.Fatal("lagging client not dropped")
+	}
+
+	// The notifications sent before the client was dropped are followed
+	// by the end of the connection.
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for {
+		var msg string
+		err := websocket.Message.Receive(conn, &msg)
+		if err == nil {
+			continue
+		}
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			t.Fatal("connection of the dropped client not closed")
+		}
+		break
+	}
+}
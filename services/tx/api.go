@@ -9,6 +9,8 @@ import (
 	"github.com/btceasypay/bitcoinpay/common/marshal"
 	"github.com/btceasypay/bitcoinpay/core/address"
 	"github.com/btceasypay/bitcoinpay/core/blockchain"
+	"github.com/btceasypay/bitcoinpay/core/blockdag"
+	"github.com/btceasypay/bitcoinpay/core/blockdag/anticone"
 	"github.com/btceasypay/bitcoinpay/core/json"
 	"github.com/btceasypay/bitcoinpay/core/message"
 	"github.com/btceasypay/bitcoinpay/core/protocol"
@@ -52,13 +54,35 @@ func NewPublicTxAPI(tm *TxManager) *PublicTxAPI {
 type TransactionInput struct {
 	Txid string `json:"txid"`
 	Vout uint32 `json:"vout"`
+	// Sequence of the input, a sequence up to mempool.MaxRBFSequence
+	// signals that the transaction can be replaced paying a higher fee.
+	Sequence *uint32 `json:"sequence,omitempty"`
 }
 
 type Amounts map[string]uint64 //{\"address\":amount,...}
 
 func (api *PublicTxAPI) CreateRawTransaction(inputs []TransactionInput,
 	amounts Amounts, lockTime *int64) (interface{}, error) {
+	mtx, err := api.newRawTransaction(inputs, amounts, lockTime)
+	if err != nil {
+		return nil, err
+	}
+
+	// Return the serialized and hex-encoded transaction.  Note that this
+	// is intentionally not directly returning because the first return
+	// value is a string and it would result in returning an empty string to
+	// the client instead of nothing (nil) in the case of an error.
+	mtxHex, err := marshal.MessageToHex(&message.MsgTx{Tx: mtx})
+	if err != nil {
+		return nil, err
+	}
+	return mtxHex, nil
+}
 
+// newRawTransaction returns a new unsigned transaction spending the inputs and
+// paying the amounts to the addresses.
+func (api *PublicTxAPI) newRawTransaction(inputs []TransactionInput,
+	amounts Amounts, lockTime *int64) (*types.Transaction, error) {
 	// Validate the locktime, if given.
 	if lockTime != nil &&
 		(*lockTime < 0 || *lockTime > int64(types.MaxTxInSequenceNum)) {
@@ -75,7 +99,9 @@ func (api *PublicTxAPI) CreateRawTransaction(inputs []TransactionInput,
 		}
 		prevOut := types.NewOutPoint(txHash, input.Vout)
 		txIn := types.NewTxInput(prevOut, []byte{})
-		if lockTime != nil && *lockTime != 0 {
+		if input.Sequence != nil {
+			txIn.Sequence = *input.Sequence
+		} else if lockTime != nil && *lockTime != 0 {
 			txIn.Sequence = types.MaxTxInSequenceNum - 1
 		}
 		mtx.AddTxIn(txIn)
@@ -126,16 +152,7 @@ func (api *PublicTxAPI) CreateRawTransaction(inputs []TransactionInput,
 	if lockTime != nil {
 		mtx.LockTime = uint32(*lockTime)
 	}
-
-	// Return the serialized and hex-encoded transaction.  Note that this
-	// is intentionally not directly returning because the first return
-	// value is a string and it would result in returning an empty string to
-	// the client instead of nothing (nil) in the case of an error.
-	mtxHex, err := marshal.MessageToHex(&message.MsgTx{Tx: mtx})
-	if err != nil {
-		return nil, err
-	}
-	return mtxHex, nil
+	return mtx, nil
 }
 
 func (api *PublicTxAPI) DecodeRawTransaction(hexTx string) (interface{}, error) {
@@ -668,6 +685,140 @@ func (api *PublicTxAPI) GetRawTransactions(addre string, vinext *bool, count *ui
 	return srtList, nil
 }
 
+// EstimateSmartFee returns the estimated fee in coins per kilobyte for a
+// transaction to be mined within the number of blocks, at least the minimum
+// fee of the mempool.
+func (api *PublicTxAPI) EstimateSmartFee(confTarget int64) (interface{}, error) {
+	if confTarget < 1 || confTarget > mempool.EstimateFeeMaxConfirms {
+		return nil, rpc.RpcInvalidError("Confirmation target %d is not "+
+			"within 1 and %d", confTarget, mempool.EstimateFeeMaxConfirms)
+	}
+	feePerKB, err := api.txManager.feeEstimator.EstimateFee(uint32(confTarget))
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Estimate fee")
+	}
+	feeRate := types.Amount(feePerKB)
+	if minFee := api.txManager.txMemPool.MinFee(); feeRate < minFee {
+		feeRate = minFee
+	}
+	return &json.EstimateSmartFeeResult{
+		FeeRate: feeRate.ToCoin(),
+		Blocks:  confTarget,
+	}, nil
+}
+
+const (
+	// riskChainLength is the number of states of the attacker's lead used to
+	// calculate the confirmation risk.
+	riskChainLength = 100
+
+	// maxRiskWaitTime is the longest wait in seconds estimated by
+	// getTxConfirmationRisk.
+	maxRiskWaitTime = 24 * 60 * 60
+
+	// maxRiskAntiPast is the largest anti past counted by
+	// getTxConfirmationRisk, the risk of any larger one is far below every
+	// sensible epsilon.
+	maxRiskAntiPast = 10000
+
+	// maxRiskBlocks is the most blocks of the anticone of the block walked
+	// by getTxConfirmationRisk.
+	maxRiskBlocks = 100000
+)
+
+// GetTxConfirmationRisk returns the risk that the block containing the
+// transaction is reverted by an attacker with the fraction of the hash power,
+// and the estimated seconds to wait until the risk is below epsilon, the
+// security level of the network by default.  The anti past is only counted
+// until it confirms the block.
+func (api *PublicTxAPI) GetTxConfirmationRisk(txHash hash.Hash, attackerFraction float64, epsilon *float64) (interface{}, error) {
+	if attackerFraction <= 0 || attackerFraction >= 0.5 {
+		return nil, rpc.RpcInvalidError("Attacker fraction %v is not "+
+			"within 0 and 0.5", attackerFraction)
+	}
+	par := api.txManager.bm.ChainParams()
+	delay := par.BlockDelay
+	if delay <= 0 {
+		delay = anticone.BlockDelay
+	}
+	lambda := par.BlockRate
+	if lambda <= 0 {
+		lambda = 1 / par.TargetTimePerBlock.Seconds()
+	}
+	eps := par.SecurityLevel
+	if eps <= 0 {
+		eps = anticone.SecurityLevel
+	}
+	if epsilon != nil {
+		if *epsilon <= 0 || *epsilon >= 1 {
+			return nil, rpc.RpcInvalidError("Epsilon %v is not within 0 "+
+				"and 1", *epsilon)
+		}
+		eps = *epsilon
+	}
+
+	txIndex := api.txManager.txIndex
+	if txIndex == nil {
+		return nil, fmt.Errorf("the transaction index " +
+			"must be enabled to query the blockchain (specify --txindex in configuration)")
+	}
+	blockRegion, err := txIndex.TxBlockRegion(txHash)
+	if err != nil {
+		return nil, errors.New("Failed to retrieve transaction location")
+	}
+	if blockRegion == nil {
+		return nil, rpc.RpcNoTxInfoError(&txHash)
+	}
+	bc := api.txManager.bm.GetChain()
+	block, err := bc.FetchBlockByHash(blockRegion.Hash)
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Fetch block")
+	}
+	ib := bc.BlockDAG().GetBlock(blockRegion.Hash)
+	if ib == nil {
+		return nil, rpc.RpcNoTxInfoError(&txHash)
+	}
+	elapsed := int64(time.Since(block.Block().Header.Timestamp).Seconds())
+	if elapsed < 0 {
+		elapsed = 0
+	}
+
+	// The anti past confirming the block is enough, the walk of the DAG
+	// stops there and the block is reported as confirmed.
+	enough, err := blockdag.GetRiskAntiPast(riskChainLength, attackerFraction,
+		lambda, delay, uint(elapsed), eps, maxRiskAntiPast)
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Risk")
+	}
+	anticoneSize, antiPast, err := bc.BlockDAG().GetAntiPast(blockRegion.Hash,
+		enough, maxRiskBlocks)
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Anti past")
+	}
+	risk, err := blockdag.GetRisk(riskChainLength, attackerFraction, lambda,
+		delay, uint(elapsed), antiPast)
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Risk")
+	}
+	waitTime, err := blockdag.GetRiskWaitingTime(riskChainLength,
+		attackerFraction, lambda, delay, uint(elapsed), antiPast, eps,
+		maxRiskWaitTime)
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Risk waiting time")
+	}
+	return &json.TxConfirmationRiskResult{
+		BlockHash:     blockRegion.Hash.String(),
+		Confirmations: bc.BlockDAG().GetConfirmations(ib.GetID()),
+		AnticoneSize:  anticoneSize,
+		AntiPast:      antiPast,
+		Elapsed:       elapsed,
+		Risk:          risk,
+		Epsilon:       eps,
+		Confirmed:     risk < eps,
+		WaitTime:      waitTime,
+	}, nil
+}
+
 func (api *PublicTxAPI) fetchMempoolTxnsForAddress(addr types.Address, numToSkip, numRequested uint32) ([]*types.Tx, uint32) {
 	// There are no entries to return when there are less available than the
 	// number being skipped.
@@ -999,3 +1150,13 @@ func (api *PrivateTxAPI) TxSign(privkeyStr string, rawTxStr string) (interface{}
 	}
 	return mtxHex, nil
 }
+
+// SaveMempool saves the transactions of the mempool to the data directory, as
+// on shutdown.
+func (api *PrivateTxAPI) SaveMempool() (interface{}, error) {
+	n, err := api.txManager.SaveMempool()
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Save mempool")
+	}
+	return &json.SaveMempoolResult{Txs: n, Filename: api.txManager.mempoolFile()}, nil
+}
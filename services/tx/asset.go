@@ -0,0 +1,251 @@
+// Copyright (c) 2020-2021 The bitcoinpay developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package tx
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/btceasypay/bitcoinpay/common/marshal"
+	"github.com/btceasypay/bitcoinpay/core/address"
+	"github.com/btceasypay/bitcoinpay/core/json"
+	"github.com/btceasypay/bitcoinpay/core/message"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/crypto/ecc"
+	"github.com/btceasypay/bitcoinpay/engine/txscript"
+	"github.com/btceasypay/bitcoinpay/rpc"
+	"github.com/btceasypay/bitcoinpay/services/index"
+)
+
+type AssetAmounts map[string]uint64 //{\"address\":asset amount,...}
+
+// CreateAssetIssueTransaction returns a new unsigned transaction issuing a new
+// asset.  The issuer is the holder of the output spent by the first input, the
+// outputs to the addresses of the asset amounts carry the new asset.
+func (api *PublicTxAPI) CreateAssetIssueTransaction(inputs []TransactionInput,
+	amounts Amounts, assetAmounts AssetAmounts, lockTime *int64) (interface{}, error) {
+	mtx, err := api.newRawTransaction(inputs, amounts, lockTime)
+	if err != nil {
+		return nil, err
+	}
+	issuer, err := api.assetIssuer(mtx)
+	if err != nil {
+		return nil, err
+	}
+	id := types.NewAssetID(issuer, &mtx.TxIn[0].PreviousOut)
+	if err := api.addAssetOutputs(mtx, &id, assetAmounts); err != nil {
+		return nil, err
+	}
+	mtxHex, err := addAssetMarker(mtx, types.AssetIssue, &id)
+	if err != nil {
+		return nil, err
+	}
+	return json.CreateAssetIssueResult{Hex: mtxHex, AssetID: id.String()}, nil
+}
+
+// CreateAssetTransaction returns a new unsigned transaction transferring the
+// asset to the addresses of the asset amounts.  When revoke is set the issuer
+// revokes the amount of the asset of the inputs which is not transferred.
+func (api *PublicTxAPI) CreateAssetTransaction(inputs []TransactionInput,
+	amounts Amounts, assetId string, assetAmounts AssetAmounts, revoke *bool,
+	lockTime *int64) (interface{}, error) {
+	id, err := types.NewAssetIDFromStr(assetId)
+	if err != nil {
+		return nil, rpc.RpcInvalidError("Invalid asset ID: %v", err)
+	}
+	mtx, err := api.newRawTransaction(inputs, amounts, lockTime)
+	if err != nil {
+		return nil, err
+	}
+	if err := api.addAssetOutputs(mtx, id, assetAmounts); err != nil {
+		return nil, err
+	}
+	if revoke == nil || !*revoke {
+		mtxHex, err := marshal.MessageToHex(&message.MsgTx{Tx: mtx})
+		if err != nil {
+			return nil, err
+		}
+		return mtxHex, nil
+	}
+
+	issuer, err := api.assetIssuer(mtx)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(issuer, id.Issuer()) {
+		return nil, rpc.RpcInvalidError("The first input does not spend " +
+			"an output of the asset issuer")
+	}
+	mtxHex, err := addAssetMarker(mtx, types.AssetRevoke, id)
+	if err != nil {
+		return nil, err
+	}
+	return mtxHex, nil
+}
+
+// assetIssuer returns the public key hash paid by the output the first input
+// of the transaction spends.
+func (api *PublicTxAPI) assetIssuer(mtx *types.Transaction) ([]byte, error) {
+	if len(mtx.TxIn) == 0 {
+		return nil, rpc.RpcInvalidError("An asset transaction needs an " +
+			"input of the issuer")
+	}
+	prevOuts, err := api.fetchInputTxos(&message.MsgTx{Tx: mtx})
+	if err != nil {
+		return nil, err
+	}
+	prevOut := prevOuts[mtx.TxIn[0].PreviousOut]
+	class, addrs, _, err := txscript.ExtractPkScriptAddrs(prevOut.PkScript,
+		api.txManager.bm.ChainParams())
+	if err != nil || len(addrs) != 1 ||
+		(class != txscript.PubKeyHashTy && class != txscript.AssetTy) {
+		return nil, rpc.RpcInvalidError("The first input does not spend " +
+			"a pay-to-pubkey-hash output")
+	}
+	return addrs[0].ScriptAddress(), nil
+}
+
+// addAssetOutputs tags the outputs to the addresses of the asset amounts with
+// the asset.  Each address must be paid by an output of the transaction.
+func (api *PublicTxAPI) addAssetOutputs(mtx *types.Transaction, id *types.AssetID,
+	assetAmounts AssetAmounts) error {
+	for encodedAddr, amount := range assetAmounts {
+		if amount == 0 {
+			return rpc.RpcInvalidError("Invalid asset amount: 0")
+		}
+		addr, err := address.DecodeAddress(encodedAddr)
+		if err != nil {
+			return rpc.RpcAddressKeyError("Could not decode "+
+				"address: %v", err)
+		}
+		pkScript, err := txscript.PayToAddrScript(addr)
+		if err != nil {
+			return rpc.RpcInternalError(err.Error(),
+				"Pay to address script")
+		}
+		assetScript, err := txscript.PayToAssetAddrScript(addr, id, amount)
+		if err != nil {
+			return rpc.RpcAddressKeyError("Invalid type for an asset "+
+				"output: %T", addr)
+		}
+
+		var txOut *types.TxOutput
+		for _, out := range mtx.TxOut {
+			if bytes.Equal(out.PkScript, pkScript) {
+				txOut = out
+				break
+			}
+		}
+		if txOut == nil {
+			return rpc.RpcInvalidError("No amount to carry the asset "+
+				"is paid to %s", encodedAddr)
+		}
+		txOut.PkScript = assetScript
+	}
+	return nil
+}
+
+// addAssetMarker adds the asset marker output to the transaction and returns
+// the serialized and hex-encoded transaction.
+func addAssetMarker(mtx *types.Transaction, txType types.TxType,
+	id *types.AssetID) (string, error) {
+	marker, err := txscript.AssetMarkerScript(txType, id)
+	if err != nil {
+		return "", rpc.RpcInternalError(err.Error(), "Asset marker script")
+	}
+	mtx.AddTxOut(types.NewTxOutput(0, marker))
+	return marshal.MessageToHex(&message.MsgTx{Tx: mtx})
+}
+
+// GetAssetInfo returns the issuer, the issue transaction and the supply of the
+// asset.
+func (api *PublicTxAPI) GetAssetInfo(assetId string) (interface{}, error) {
+	assetIndex := api.txManager.assetIndex
+	if assetIndex == nil {
+		return nil, fmt.Errorf("Asset index must be enabled (--assetindex)")
+	}
+	id, err := types.NewAssetIDFromStr(assetId)
+	if err != nil {
+		return nil, rpc.RpcInvalidError("Invalid asset ID: %v", err)
+	}
+	info, err := assetIndex.AssetInfo(id)
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Asset index")
+	}
+	if info == nil {
+		return nil, rpc.RpcInvalidError("Unknown asset %v", id)
+	}
+	return api.assetInfoResult(info)
+}
+
+// ListAssets returns the issuer, the issue transaction and the supply of all
+// the assets.
+func (api *PublicTxAPI) ListAssets() (interface{}, error) {
+	assetIndex := api.txManager.assetIndex
+	if assetIndex == nil {
+		return nil, fmt.Errorf("Asset index must be enabled (--assetindex)")
+	}
+	infos, err := assetIndex.Assets()
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Asset index")
+	}
+	results := make([]json.AssetInfoResult, 0, len(infos))
+	for _, info := range infos {
+		result, err := api.assetInfoResult(info)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, *result)
+	}
+	return results, nil
+}
+
+func (api *PublicTxAPI) assetInfoResult(info *index.AssetInfo) (*json.AssetInfoResult, error) {
+	issuer, err := address.NewPubKeyHashAddress(info.ID.Issuer(),
+		api.txManager.bm.ChainParams(), ecc.ECDSA_Secp256k1)
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Asset issuer")
+	}
+	return &json.AssetInfoResult{
+		AssetID: info.ID.String(),
+		Issuer:  issuer.Encode(),
+		IssueTx: info.IssueTx.String(),
+		Issued:  info.Issued,
+		Revoked: info.Revoked,
+		Supply:  info.Issued - info.Revoked,
+	}, nil
+}
+
+// GetAssetBalances returns the amounts of the assets held by the address.
+func (api *PublicTxAPI) GetAssetBalances(addr string) (interface{}, error) {
+	assetIndex := api.txManager.assetIndex
+	if assetIndex == nil {
+		return nil, fmt.Errorf("Asset index must be enabled (--assetindex)")
+	}
+	decoded, err := address.DecodeAddress(addr)
+	if err != nil {
+		return nil, rpc.RpcAddressKeyError("Could not decode address: %v", err)
+	}
+	pkh, ok := decoded.(*address.PubKeyHashAddress)
+	if !ok || pkh.EcType() != ecc.ECDSA_Secp256k1 {
+		return nil, rpc.RpcAddressKeyError("Invalid type for an asset "+
+			"holder: %T", decoded)
+	}
+	if !address.IsForNetwork(pkh, api.txManager.bm.ChainParams()) {
+		return nil, rpc.RpcAddressKeyError("Wrong network: %v", addr)
+	}
+	balances, err := assetIndex.Balances(pkh.ScriptAddress())
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Asset index")
+	}
+	results := make([]json.AssetBalanceResult, 0, len(balances))
+	for _, balance := range balances {
+		results = append(results, json.AssetBalanceResult{
+			AssetID: balance.ID.String(),
+			Amount:  balance.Amount,
+		})
+	}
+	return results, nil
+}
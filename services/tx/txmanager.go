@@ -1,18 +1,22 @@
 package tx
 
 import (
+	"fmt"
 	"github.com/btceasypay/bitcoinpay/common/hash"
 	"github.com/btceasypay/bitcoinpay/config"
 	"github.com/btceasypay/bitcoinpay/core/blockchain"
 	"github.com/btceasypay/bitcoinpay/core/blockdag"
+	"github.com/btceasypay/bitcoinpay/core/dbnamespace"
 	"github.com/btceasypay/bitcoinpay/core/types"
 	"github.com/btceasypay/bitcoinpay/database"
 	"github.com/btceasypay/bitcoinpay/engine/txscript"
 	"github.com/btceasypay/bitcoinpay/node/notify"
+	"github.com/btceasypay/bitcoinpay/services/acct"
 	"github.com/btceasypay/bitcoinpay/services/blkmgr"
 	"github.com/btceasypay/bitcoinpay/services/common"
 	"github.com/btceasypay/bitcoinpay/services/index"
 	"github.com/btceasypay/bitcoinpay/services/mempool"
+	"path/filepath"
 	"time"
 )
 
@@ -23,6 +27,10 @@ type TxManager struct {
 
 	// addr index
 	addrIndex *index.AddrIndex
+
+	// asset index
+	assetIndex *index.AssetIndex
+
 	// mempool hold tx that need to be mined into blocks and relayed to other peers.
 	txMemPool *mempool.TxPool
 
@@ -34,25 +42,104 @@ type TxManager struct {
 
 	//invalidTx hash->block hash
 	invalidTx map[hash.Hash]*blockdag.HashSet
+
+	// config
+	cfg *config.Config
+
+	// feeEstimator estimates the fees from the transactions mined from the
+	// mempool, it is saved in the database every few blocks and on shutdown.
+	feeEstimator *mempool.FeeEstimator
 }
 
 func (tm *TxManager) Start() error {
 	log.Info("Starting tx manager")
+	if !tm.cfg.NoPersistMempool {
+		path := tm.mempoolFile()
+		n, err := tm.txMemPool.Load(path)
+		if err != nil {
+			log.Error(fmt.Sprintf("Failed to load the mempool: %v", err))
+		} else if n > 0 {
+			log.Info(fmt.Sprintf("Loaded %d transactions from file '%s'", n, path))
+		}
+	}
 	return nil
 }
 
 func (tm *TxManager) Stop() error {
 	log.Info("Stopping tx manager")
+	if !tm.cfg.NoPersistMempool {
+		if _, err := tm.SaveMempool(); err != nil {
+			log.Error(fmt.Sprintf("Failed to save the mempool: %v", err))
+		}
+	}
+	if err := tm.SaveFeeEstimator(); err != nil {
+		log.Error(fmt.Sprintf("Failed to save the fee estimator: %v", err))
+	}
 	return nil
 }
 
+// SaveFeeEstimator saves the state of the fee estimator in the database, it
+// is restored on the next start.
+func (tm *TxManager) SaveFeeEstimator() error {
+	return tm.db.Update(func(dbTx database.Tx) error {
+		return dbTx.Metadata().Put(dbnamespace.FeeEstimatorKeyName,
+			tm.feeEstimator.Save())
+	})
+}
+
+// loadFeeEstimator returns the fee estimator saved in the database, or a new
+// one if none was saved or it can't be restored.
+func loadFeeEstimator(db database.DB) *mempool.FeeEstimator {
+	var feeEstimator *mempool.FeeEstimator
+	err := db.View(func(dbTx database.Tx) error {
+		serialized := dbTx.Metadata().Get(dbnamespace.FeeEstimatorKeyName)
+		if serialized == nil {
+			return nil
+		}
+		var err error
+		feeEstimator, err = mempool.RestoreFeeEstimator(serialized)
+		return err
+	})
+	if err != nil {
+		log.Warn(fmt.Sprintf("Failed to restore the fee estimator: %v", err))
+	}
+	if feeEstimator == nil {
+		feeEstimator = mempool.NewFeeEstimator()
+	}
+	return feeEstimator
+}
+
+// mempoolFile returns the path of the file the mempool is saved to.
+func (tm *TxManager) mempoolFile() string {
+	return filepath.Join(tm.cfg.DataDir, mempool.MempoolFilename)
+}
+
+// SaveMempool saves the transactions of the mempool to the data directory, so
+// they are loaded again on the next start.  It returns the number of the saved
+// transactions.
+func (tm *TxManager) SaveMempool() (int, error) {
+	path := tm.mempoolFile()
+	n, err := tm.txMemPool.Save(path)
+	if err != nil {
+		return 0, err
+	}
+	log.Info(fmt.Sprintf("Saved %d transactions to file '%s'", n, path))
+	return n, nil
+}
+
 func (tm *TxManager) MemPool() blkmgr.TxPool {
 	return tm.txMemPool
 }
 
+func (tm *TxManager) FeeEstimator() blkmgr.FeeEstimator {
+	return tm.feeEstimator
+}
+
 func NewTxManager(bm *blkmgr.BlockManager, txIndex *index.TxIndex,
-	addrIndex *index.AddrIndex, cfg *config.Config, ntmgr notify.Notify,
+	addrIndex *index.AddrIndex, assetIndex *index.AssetIndex, acctmgr *acct.AccountManager, cfg *config.Config, ntmgr notify.Notify,
 	sigCache *txscript.SigCache, db database.DB) (*TxManager, error) {
+	feeEstimator := loadFeeEstimator(db)
+
 	// mem-pool
 	txC := mempool.Config{
 		Policy: mempool.Policy{
@@ -64,8 +151,10 @@ func NewTxManager(bm *blkmgr.BlockManager, txIndex *index.TxIndex,
 			MaxOrphanTxSize:      mempool.DefaultMaxOrphanTxSize,
 			MaxSigOpsPerTx:       blockchain.MaxSigOpsPerBlock / 5,
 			MinRelayTxFee:        types.Amount(cfg.MinTxFee),
+			MaxPoolSize:          cfg.MaxMempool * 1000000,
+			RejectReplacement:    cfg.RejectReplacement,
 			StandardVerifyFlags: func() (txscript.ScriptFlags, error) {
-				return common.StandardScriptVerifyFlags()
+				return common.StandardScriptVerifyFlags(bm.GetChain())
 			},
 		},
 		ChainParams:      bm.ChainParams(),
@@ -78,10 +167,15 @@ func NewTxManager(bm *blkmgr.BlockManager, txIndex *index.TxIndex,
 		SigCache:         sigCache,
 		PastMedianTime:   func() time.Time { return bm.GetChain().BestSnapshot().MedianTime },
 		AddrIndex:        addrIndex,
+		AcctMgr:          acctmgr,
+		FeeEstimator:     feeEstimator,
+		TxAccepted:       bm.ZMQNotify().TransactionAccepted,
+		TxRemoved:        bm.ZMQNotify().TransactionRemoved,
 		BD:               bm.GetChain().BlockDAG(),
 		BC:               bm.GetChain(),
 	}
 	txMemPool := mempool.New(&txC)
 	invalidTx := make(map[hash.Hash]*blockdag.HashSet)
-	return &TxManager{bm, txIndex, addrIndex, txMemPool, ntmgr, db, invalidTx}, nil
+	return &TxManager{bm, txIndex, addrIndex, assetIndex, txMemPool, ntmgr, db, invalidTx, cfg,
+		feeEstimator}, nil
 }
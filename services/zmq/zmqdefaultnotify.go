@@ -3,40 +3,206 @@
 package zmq
 
 import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
 	"github.com/btceasypay/bitcoinpay/config"
 	"github.com/btceasypay/bitcoinpay/core/types"
 )
 
-// This ZeroMQ notification is default for Bitcoinpay
-// If you want to enable ZMQ for Bitcoinpay, you must use 'zmq' tags when go building
+// The topics published like Bitcoin Core, every message is made of the topic,
+// the body and the little-endian 4 byte sequence number of the topic.
+const (
+	TopicHashBlock = "hashblock"
+	TopicRawBlock  = "rawblock"
+	TopicHashTx    = "hashtx"
+	TopicRawTx     = "rawtx"
+
+	// TopicSequence publishes the block hash followed by 'C' when a block
+	// is connected and by 'D' when it is disconnected, and the transaction
+	// hash followed by 'A' when it is added to the mempool and by 'R' when
+	// it is removed without being mined, followed by the little-endian 8
+	// byte mempool sequence number.
+	TopicSequence = "sequence"
+
+	defaultBlockHashEndpoint = "tcp://*:8230"
+	defaultBlockRawEndpoint  = "tcp://*:8231"
+	defaultTxHashEndpoint    = "tcp://*:8232"
+	defaultTxRawEndpoint     = "tcp://*:8233"
+	defaultSequenceEndpoint  = "tcp://*:8234"
+)
+
+// This ZeroMQ notification is default for Bitcoinpay, it publishes with the
+// pure Go PUB sockets and needs no C library.
+// If you want to use the czmq library, you must use 'zmq' tags when go building
 type ZMQNotification struct {
+	mtx sync.Mutex
+
+	// sockets are the PUB sockets by endpoint, topics configured with the
+	// same endpoint share the socket.
+	sockets    map[string]*pubSocket
+	publishers map[string]*pubSocket
+	sequences  map[string]uint32
 }
 
 // Initialization notification
 func (zn *ZMQNotification) Init(cfg *config.Config) {
-	log.Info("ZMQ:Not Supported")
+	zn.sockets = make(map[string]*pubSocket)
+	zn.publishers = make(map[string]*pubSocket)
+	zn.sequences = make(map[string]uint32)
+
+	topics := []struct {
+		topic, endpoint, defaultEndpoint string
+	}{
+		{TopicHashBlock, cfg.Zmqpubhashblock, defaultBlockHashEndpoint},
+		{TopicRawBlock, cfg.Zmqpubrawblock, defaultBlockRawEndpoint},
+		{TopicHashTx, cfg.Zmqpubhashtx, defaultTxHashEndpoint},
+		{TopicRawTx, cfg.Zmqpubrawtx, defaultTxRawEndpoint},
+		{TopicSequence, cfg.Zmqpubsequence, defaultSequenceEndpoint},
+	}
+	for _, t := range topics {
+		endpoint := t.endpoint
+		if len(endpoint) <= 0 {
+			continue
+		}
+		if endpoint == "default" || endpoint == "*" {
+			endpoint = t.defaultEndpoint
+		}
+		log.Info(fmt.Sprintf("Initialize ZMQ publish notifier:%s %s", t.topic, endpoint))
+		sock, ok := zn.sockets[endpoint]
+		if !ok {
+			var err error
+			sock, err = listenPub(endpoint)
+			if err != nil {
+				log.Error(fmt.Sprintf("%s ZMQ Publish Notifier can't initialization:%v", t.topic, err))
+				continue
+			}
+			zn.sockets[endpoint] = sock
+		}
+		zn.publishers[t.topic] = sock
+	}
+	if zn.IsEnable() {
+		log.Info("ZMQ:Supported")
+	}
 }
 
 func (zn *ZMQNotification) IsEnable() bool {
-	return false
+	return len(zn.publishers) > 0
+}
+
+// publish sends the body with the next sequence number of the topic, if the
+// topic is published.
+func (zn *ZMQNotification) publish(topic string, body []byte) {
+	zn.mtx.Lock()
+	defer zn.mtx.Unlock()
+
+	sock, ok := zn.publishers[topic]
+	if !ok {
+		return
+	}
+	var sequence [4]byte
+	binary.LittleEndian.PutUint32(sequence[:], zn.sequences[topic])
+	zn.sequences[topic]++
+	sock.Send([][]byte{[]byte(topic), body, sequence[:]})
+}
+
+// publishes returns whether the topic is published.
+func (zn *ZMQNotification) publishes(topic string) bool {
+	zn.mtx.Lock()
+	defer zn.mtx.Unlock()
+	_, ok := zn.publishers[topic]
+	return ok
+}
+
+// hashBytes returns the hash in the byte order it is displayed in, like
+// Bitcoin Core publishes hashes.
+func hashBytes(h *hash.Hash) []byte {
+	b := make([]byte, hash.HashSize)
+	for i := range h {
+		b[hash.HashSize-1-i] = h[i]
+	}
+	return b
+}
+
+// publishTransaction publishes the hash and the raw transaction.
+func (zn *ZMQNotification) publishTransaction(tx *types.Tx) {
+	zn.publish(TopicHashTx, hashBytes(tx.Hash()))
+	if zn.publishes(TopicRawTx) {
+		txBytes, err := tx.Transaction().Serialize()
+		if err != nil {
+			log.Error(fmt.Sprintf("tx bytes:%v", err))
+			return
+		}
+		zn.publish(TopicRawTx, txBytes)
+	}
+}
+
+// publishSequence publishes the event of the hash with the label, followed by
+// the mempool sequence number of mempool events.
+func (zn *ZMQNotification) publishSequence(h *hash.Hash, label byte, mempoolSequence *uint64) {
+	body := append(hashBytes(h), label)
+	if mempoolSequence != nil {
+		var sequence [8]byte
+		binary.LittleEndian.PutUint64(sequence[:], *mempoolSequence)
+		body = append(body, sequence[:]...)
+	}
+	zn.publish(TopicSequence, body)
 }
 
 // block accepted
 func (zn *ZMQNotification) BlockAccepted(block *types.SerializedBlock) {
-
+	log.Debug(fmt.Sprintf("BlockAccepted:%s", block.Hash().String()))
+	zn.publish(TopicHashBlock, hashBytes(block.Hash()))
+	if zn.publishes(TopicRawBlock) {
+		blockBytes, err := block.Bytes()
+		if err != nil {
+			log.Error(fmt.Sprintf("block bytes:%v", err))
+			return
+		}
+		zn.publish(TopicRawBlock, blockBytes)
+	}
 }
 
 // block connected
 func (zn *ZMQNotification) BlockConnected(block *types.SerializedBlock) {
-
+	log.Debug(fmt.Sprintf("BlockConnected:%s", block.Hash().String()))
+	for _, tx := range block.Transactions() {
+		zn.publishTransaction(tx)
+	}
+	zn.publishSequence(block.Hash(), 'C', nil)
 }
 
-// block connected
+// block disconnected
 func (zn *ZMQNotification) BlockDisconnected(block *types.SerializedBlock) {
+	log.Debug(fmt.Sprintf("BlockDisconnected:%s", block.Hash().String()))
+	for _, tx := range block.Transactions() {
+		zn.publishTransaction(tx)
+	}
+	zn.publishSequence(block.Hash(), 'D', nil)
+}
 
+// transaction added to the mempool
+func (zn *ZMQNotification) TransactionAccepted(tx *types.Tx, mempoolSequence uint64) {
+	zn.publishTransaction(tx)
+	zn.publishSequence(tx.Hash(), 'A', &mempoolSequence)
+}
+
+// transaction removed from the mempool without being mined
+func (zn *ZMQNotification) TransactionRemoved(tx *types.Tx, mempoolSequence uint64) {
+	zn.publishSequence(tx.Hash(), 'R', &mempoolSequence)
 }
 
 // Shutdown
 func (zn *ZMQNotification) Shutdown() {
-
+	log.Info("ZMQ: Shutdown...")
+	zn.mtx.Lock()
+	defer zn.mtx.Unlock()
+	for endpoint, sock := range zn.sockets {
+		log.Info(fmt.Sprintf("Shutdown:ZMQ publisher %s", endpoint))
+		sock.Close()
+	}
+	zn.sockets = make(map[string]*pubSocket)
+	zn.publishers = make(map[string]*pubSocket)
 }
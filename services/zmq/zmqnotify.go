@@ -78,6 +78,17 @@ func (zn *ZMQNotification) BlockDisconnected(block *types.SerializedBlock) {
 	}
 }
 
+// transaction added to the mempool, the czmq notifiers only publish the
+// transactions of the blocks
+func (zn *ZMQNotification) TransactionAccepted(tx *types.Tx, mempoolSequence uint64) {
+
+}
+
+// transaction removed from the mempool
+func (zn *ZMQNotification) TransactionRemoved(tx *types.Tx, mempoolSequence uint64) {
+
+}
+
 // Shutdown
 func (zn *ZMQNotification) Shutdown() {
 	log.Info("ZMQ: Shutdown...")
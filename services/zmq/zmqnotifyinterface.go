@@ -23,6 +23,12 @@ type IZMQNotification interface {
 	// block connected
 	BlockDisconnected(block *types.SerializedBlock)
 
+	// transaction added to the mempool with the mempool sequence number
+	TransactionAccepted(tx *types.Tx, mempoolSequence uint64)
+
+	// transaction removed from the mempool without being mined
+	TransactionRemoved(tx *types.Tx, mempoolSequence uint64)
+
 	// Shutdown
 	Shutdown()
 }
@@ -0,0 +1,438 @@
+// +build !zmq
+
+// Copyright (c) 2020-2021 The bitcoinpay developers
+
+package zmq
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// zmtpSendQueue is the number of messages queued for a subscriber
+	// before newer messages are dropped, like the ZeroMQ high water mark.
+	zmtpSendQueue = 1000
+
+	// zmtpHandshakeTimeout is the time a subscriber has to complete the
+	// handshake after connecting.
+	zmtpHandshakeTimeout = 10 * time.Second
+
+	// zmtpMaxRecvSize is the maximum size of a frame received from a
+	// subscriber, which only sends subscriptions and commands.
+	zmtpMaxRecvSize = 64 * 1024
+
+	// The flags of a ZMTP frame.
+	zmtpFlagMore    = 0x01
+	zmtpFlagLong    = 0x02
+	zmtpFlagCommand = 0x04
+)
+
+// zmtpGreeting returns the ZMTP 3.0 greeting of a peer using the NULL
+// security mechanism.
+func zmtpGreeting() []byte {
+	greeting := make([]byte, 64)
+	greeting[0] = 0xff
+	greeting[9] = 0x7f
+	greeting[10] = 3
+	greeting[11] = 0
+	copy(greeting[12:32], "NULL")
+	return greeting
+}
+
+// zmtpWriteFrame writes a frame with the flags, the size is encoded as long
+// as needed.
+func zmtpWriteFrame(w io.Writer, flags byte, body []byte) error {
+	var buf bytes.Buffer
+	if len(body) > 255 {
+		buf.WriteByte(flags | zmtpFlagLong)
+		var size [8]byte
+		binary.BigEndian.PutUint64(size[:], uint64(len(body)))
+		buf.Write(size[:])
+	} else {
+		buf.WriteByte(flags)
+		buf.WriteByte(byte(len(body)))
+	}
+	buf.Write(body)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// zmtpWriteMessage writes the frames of a multipart message.
+func zmtpWriteMessage(w io.Writer, frames [][]byte) error {
+	var buf bytes.Buffer
+	for i, frame := range frames {
+		var flags byte
+		if i < len(frames)-1 {
+			flags = zmtpFlagMore
+		}
+		// Writing to a bytes.Buffer never fails.
+		zmtpWriteFrame(&buf, flags, frame)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// zmtpReadFrame reads a frame and returns its flags and body.  Frames larger
+// than the maximum size are rejected.
+func zmtpReadFrame(r io.Reader, maxSize uint64) (byte, []byte, error) {
+	var header [9]byte
+	if _, err := io.ReadFull(r, header[:2]); err != nil {
+		return 0, nil, err
+	}
+	flags, size := header[0], uint64(header[1])
+	if flags&zmtpFlagLong != 0 {
+		if _, err := io.ReadFull(r, header[2:]); err != nil {
+			return 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(header[1:])
+	}
+	if size > maxSize {
+		return 0, nil, fmt.Errorf("frame of %d bytes exceeds the maximum "+
+			"of %d bytes", size, maxSize)
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return flags, body, nil
+}
+
+// zmtpCommand returns the body of a command frame.
+func zmtpCommand(name string, data []byte) []byte {
+	body := append([]byte{byte(len(name))}, name...)
+	return append(body, data...)
+}
+
+// zmtpParseCommand returns the name and the data of a command frame.
+func zmtpParseCommand(body []byte) (string, []byte, error) {
+	if len(body) == 0 || len(body) < 1+int(body[0]) {
+		return "", nil, fmt.Errorf("malformed command")
+	}
+	return string(body[1 : 1+body[0]]), body[1+body[0]:], nil
+}
+
+// zmtpReadyCommand returns the body of the READY command of a socket type.
+func zmtpReadyCommand(socketType string) []byte {
+	const name = "Socket-Type"
+	data := append([]byte{byte(len(name))}, name...)
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(socketType)))
+	data = append(data, size[:]...)
+	return zmtpCommand("READY", append(data, socketType...))
+}
+
+// zmtpParseProperties returns the metadata properties of a READY command.
+func zmtpParseProperties(data []byte) (map[string]string, error) {
+	props := make(map[string]string)
+	for len(data) > 0 {
+		nameSize := int(data[0])
+		if len(data) < 1+nameSize+4 {
+			return nil, fmt.Errorf("malformed property")
+		}
+		name := string(data[1 : 1+nameSize])
+		data = data[1+nameSize:]
+		valueSize := binary.BigEndian.Uint32(data)
+		data = data[4:]
+		if uint64(len(data)) < uint64(valueSize) {
+			return nil, fmt.Errorf("malformed property %s", name)
+		}
+		props[strings.ToLower(name)] = string(data[:valueSize])
+		data = data[valueSize:]
+	}
+	return props, nil
+}
+
+// zmtpHandshake exchanges the greeting and the READY command with the peer
+// of the connection.  It returns the socket type of the peer, which must be
+// one of the accepted types.
+func zmtpHandshake(conn io.ReadWriter, socketType string, accepted ...string) (string, error) {
+	if _, err := conn.Write(zmtpGreeting()); err != nil {
+		return "", err
+	}
+	greeting := make([]byte, 64)
+	if _, err := io.ReadFull(conn, greeting); err != nil {
+		return "", err
+	}
+	if greeting[0] != 0xff || greeting[9]&0x01 == 0 {
+		return "", fmt.Errorf("invalid greeting signature")
+	}
+	if greeting[10] < 3 {
+		return "", fmt.Errorf("unsupported ZMTP version %d.%d", greeting[10],
+			greeting[11])
+	}
+	if mechanism := string(bytes.TrimRight(greeting[12:32], "\x00")); mechanism != "NULL" {
+		return "", fmt.Errorf("unsupported security mechanism %s", mechanism)
+	}
+
+	err := zmtpWriteFrame(conn, zmtpFlagCommand, zmtpReadyCommand(socketType))
+	if err != nil {
+		return "", err
+	}
+	flags, body, err := zmtpReadFrame(conn, zmtpMaxRecvSize)
+	if err != nil {
+		return "", err
+	}
+	name, data, err := zmtpParseCommand(body)
+	if err != nil {
+		return "", err
+	}
+	if flags&zmtpFlagCommand == 0 || name != "READY" {
+		return "", fmt.Errorf("expected READY command")
+	}
+	props, err := zmtpParseProperties(data)
+	if err != nil {
+		return "", err
+	}
+	peerType := props["socket-type"]
+	for _, t := range accepted {
+		if peerType == t {
+			return peerType, nil
+		}
+	}
+	return "", fmt.Errorf("incompatible socket type %s", peerType)
+}
+
+// pubPeer is a subscriber connected to a PUB socket.
+type pubPeer struct {
+	conn net.Conn
+	send chan [][]byte
+
+	// writeMtx serializes the writes of the queued messages and of the
+	// replies to the commands of the peer.
+	writeMtx sync.Mutex
+
+	mtx           sync.Mutex
+	subscriptions map[string]int
+}
+
+// subscribe adds or cancels a subscription to the topics with the prefix.
+func (p *pubPeer) subscribe(prefix string, add bool) {
+	p.mtx.Lock()
+	if add {
+		p.subscriptions[prefix]++
+	} else if p.subscriptions[prefix] > 1 {
+		p.subscriptions[prefix]--
+	} else {
+		delete(p.subscriptions, prefix)
+	}
+	p.mtx.Unlock()
+}
+
+// subscribed returns whether the peer subscribed to the topic.
+func (p *pubPeer) subscribed(topic []byte) bool {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	for prefix := range p.subscriptions {
+		if bytes.HasPrefix(topic, []byte(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// pubSocket is a ZeroMQ PUB socket speaking ZMTP 3.x over TCP with the NULL
+// security mechanism.  Messages are sent to the connected subscribers which
+// subscribed to a prefix of their first frame, and are dropped for the
+// subscribers not keeping up.
+type pubSocket struct {
+	endpoint string
+	listener net.Listener
+
+	mtx   sync.Mutex
+	peers map[*pubPeer]struct{}
+	quit  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// listenPub returns a PUB socket bound to the endpoint, only tcp://host:port
+// endpoints are supported and * stands for all interfaces.
+func listenPub(endpoint string) (*pubSocket, error) {
+	if !strings.HasPrefix(endpoint, "tcp://") {
+		return nil, fmt.Errorf("unsupported endpoint %s", endpoint)
+	}
+	addr := strings.TrimPrefix(endpoint, "tcp://")
+	if strings.HasPrefix(addr, "*:") {
+		addr = addr[1:]
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &pubSocket{
+		endpoint: endpoint,
+		listener: listener,
+		peers:    make(map[*pubPeer]struct{}),
+		quit:     make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.acceptHandler()
+	return s, nil
+}
+
+// acceptHandler accepts the connections of the subscribers.
+//
+// It must be run as a goroutine.
+func (s *pubSocket) acceptHandler() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.quit:
+				return
+			default:
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(time.Second)
+				continue
+			}
+			log.Error(fmt.Sprintf("ZMQ %s can't accept:%v", s.endpoint, err))
+			return
+		}
+		s.wg.Add(1)
+		go s.peerHandler(conn)
+	}
+}
+
+// peerHandler performs the handshake with a subscriber and then handles its
+// subscriptions until it disconnects.
+//
+// It must be run as a goroutine.
+func (s *pubSocket) peerHandler(conn net.Conn) {
+	defer s.wg.Done()
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(zmtpHandshakeTimeout))
+	_, err := zmtpHandshake(conn, "PUB", "SUB", "XSUB")
+	if err != nil {
+		log.Debug(fmt.Sprintf("ZMQ %s handshake with %s failed:%v",
+			s.endpoint, conn.RemoteAddr(), err))
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	p := &pubPeer{
+		conn:          conn,
+		send:          make(chan [][]byte, zmtpSendQueue),
+		subscriptions: make(map[string]int),
+	}
+	s.mtx.Lock()
+	select {
+	case <-s.quit:
+		s.mtx.Unlock()
+		return
+	default:
+	}
+	s.peers[p] = struct{}{}
+	s.mtx.Unlock()
+	log.Debug(fmt.Sprintf("ZMQ %s subscriber connected:%s", s.endpoint,
+		conn.RemoteAddr()))
+
+	s.wg.Add(1)
+	go s.writeHandler(p)
+	err = s.readSubscriptions(p)
+	log.Debug(fmt.Sprintf("ZMQ %s subscriber disconnected:%s %v", s.endpoint,
+		conn.RemoteAddr(), err))
+
+	s.mtx.Lock()
+	delete(s.peers, p)
+	close(p.send)
+	s.mtx.Unlock()
+}
+
+// readSubscriptions reads the subscriptions of the peer until the connection
+// fails.  Subscriptions are messages starting with 1 (subscribe) or 0
+// (cancel) in ZMTP 3.0 and SUBSCRIBE or CANCEL commands in ZMTP 3.1.
+func (s *pubSocket) readSubscriptions(p *pubPeer) error {
+	more := false
+	for {
+		flags, body, err := zmtpReadFrame(p.conn, zmtpMaxRecvSize)
+		if err != nil {
+			return err
+		}
+		if flags&zmtpFlagCommand != 0 {
+			name, data, err := zmtpParseCommand(body)
+			if err != nil {
+				return err
+			}
+			switch name {
+			case "SUBSCRIBE":
+				p.subscribe(string(data), true)
+			case "CANCEL":
+				p.subscribe(string(data), false)
+			case "PING":
+				// The context follows the 2 byte TTL of the ping.
+				if len(data) >= 2 {
+					p.writeMtx.Lock()
+					err := zmtpWriteFrame(p.conn, zmtpFlagCommand,
+						zmtpCommand("PONG", data[2:]))
+					p.writeMtx.Unlock()
+					if err != nil {
+						return err
+					}
+				}
+			}
+			continue
+		}
+
+		// Only the first frame of a message is a subscription.
+		if !more && len(body) > 0 && body[0] <= 1 {
+			p.subscribe(string(body[1:]), body[0] == 1)
+		}
+		more = flags&zmtpFlagMore != 0
+	}
+}
+
+// writeHandler writes the queued messages to the peer until the queue is
+// closed.
+//
+// It must be run as a goroutine.
+func (s *pubSocket) writeHandler(p *pubPeer) {
+	defer s.wg.Done()
+	for frames := range p.send {
+		p.writeMtx.Lock()
+		err := zmtpWriteMessage(p.conn, frames)
+		p.writeMtx.Unlock()
+		if err != nil {
+			// Closing the connection makes the peer handler remove the
+			// peer and close the queue.
+			p.conn.Close()
+		}
+	}
+}
+
+// Send queues the multipart message for the subscribers of its first frame.
+func (s *pubSocket) Send(frames [][]byte) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for p := range s.peers {
+		if !p.subscribed(frames[0]) {
+			continue
+		}
+		select {
+		case p.send <- frames:
+		default:
+			log.Trace(fmt.Sprintf("ZMQ %s dropped message for %s",
+				s.endpoint, p.conn.RemoteAddr()))
+		}
+	}
+}
+
+// Close disconnects the subscribers and stops listening.
+func (s *pubSocket) Close() {
+	s.mtx.Lock()
+	close(s.quit)
+	s.listener.Close()
+	for p := range s.peers {
+		p.conn.Close()
+	}
+	s.mtx.Unlock()
+	s.wg.Wait()
+}
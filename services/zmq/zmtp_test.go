@@ -0,0 +1,162 @@
+// +build !zmq
+
+// Copyright (c) 2020-2021 The bitcoinpay developers
+
+package zmq
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/btceasypay/bitcoinpay/common/hash"
+	"github.com/btceasypay/bitcoinpay/config"
+	"github.com/btceasypay/bitcoinpay/core/types"
+	"github.com/btceasypay/bitcoinpay/core/types/pow"
+)
+
+// subSocket is a ZeroMQ SUB socket connected to a publisher.
+type subSocket struct {
+	conn net.Conn
+}
+
+// dialSub connects a SUB socket to the address subscribing to the topics.
+func dialSub(t *testing.T, addr string, topics ...string) *subSocket {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := zmtpHandshake(conn, "SUB", "PUB", "XPUB"); err != nil {
+		t.Fatal(err)
+	}
+	for _, topic := range topics {
+		err := zmtpWriteFrame(conn, 0, append([]byte{1}, topic...))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &subSocket{conn}
+}
+
+// recv returns the frames of the next message.
+func (s *subSocket) recv(t *testing.T) [][]byte {
+	var frames [][]byte
+	for {
+		flags, body, err := zmtpReadFrame(s.conn, 1<<20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if flags&zmtpFlagCommand != 0 {
+			continue
+		}
+		frames = append(frames, body)
+		if flags&zmtpFlagMore == 0 {
+			return frames
+		}
+	}
+}
+
+// waitSubscribed waits until a subscriber of the socket subscribed to the
+// topics.
+func waitSubscribed(t *testing.T, sock *pubSocket, topics ...string) {
+	subscribed := func() bool {
+		sock.mtx.Lock()
+		defer sock.mtx.Unlock()
+		for p := range sock.peers {
+			all := true
+			for _, topic := range topics {
+				all = all && p.subscribed([]byte(topic))
+			}
+			if all {
+				return true
+			}
+		}
+		return false
+	}
+	for start := time.Now(); !subscribed(); time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("subscriptions not received")
+		}
+	}
+}
+
+func TestZMQNotification(t *testing.T) {
+	zn := NewZMQNotification(&config.Config{})
+	if zn.IsEnable() {
+		t.Fatal("notification enabled without endpoints")
+	}
+
+	const endpoint = "tcp://127.0.0.1:0"
+	zn = NewZMQNotification(&config.Config{
+		Zmqpubhashblock: endpoint,
+		Zmqpubhashtx:    endpoint,
+		Zmqpubrawtx:     endpoint,
+		Zmqpubsequence:  endpoint,
+	})
+	defer zn.Shutdown()
+	if !zn.IsEnable() {
+		t.Fatal("notification not enabled")
+	}
+	sock := zn.(*ZMQNotification).sockets[endpoint]
+	if sock == nil {
+		t.Fatal("topics do not share the socket of the endpoint")
+	}
+	sub := dialSub(t, sock.listener.Addr().String(), TopicHashBlock,
+		TopicHashTx, TopicSequence)
+	defer sub.conn.Close()
+	waitSubscribed(t, sock, TopicHashBlock, TopicHashTx, TopicSequence)
+
+	tx := types.NewTransaction()
+	tx.AddTxIn(types.NewTxInput(types.NewOutPoint(&hash.Hash{1}, 0), []byte{0x51}))
+	tx.AddTxOut(types.NewTxOutput(1, []byte{0x51}))
+	block := types.Block{Header: types.BlockHeader{
+		Pow: pow.GetInstance(pow.BLAKE2BD, 0, []byte{}),
+	}}
+	if err := block.AddTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	sblock := types.NewBlock(&block)
+	stx := types.NewTx(tx)
+
+	zn.BlockAccepted(sblock)
+	zn.TransactionAccepted(stx, 7)
+	zn.TransactionRemoved(stx, 8)
+	zn.BlockConnected(sblock)
+
+	mempoolEvent := func(h *hash.Hash, label byte, sequence uint64) string {
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], sequence)
+		return h.String() + hex.EncodeToString(append([]byte{label}, b[:]...))
+	}
+	// The raw transactions are not subscribed.
+	tests := []struct {
+		topic    string
+		body     string
+		sequence uint32
+	}{
+		{TopicHashBlock, sblock.Hash().String(), 0},
+		{TopicHashTx, stx.Hash().String(), 0},
+		{TopicSequence, mempoolEvent(stx.Hash(), 'A', 7), 0},
+		{TopicSequence, mempoolEvent(stx.Hash(), 'R', 8), 1},
+		{TopicHashTx, stx.Hash().String(), 1},
+		{TopicSequence, sblock.Hash().String() + hex.EncodeToString([]byte{'C'}), 2},
+	}
+	for i, test := range tests {
+		frames := sub.recv(t)
+		if len(frames) != 3 {
+			t.Fatalf("message #%d has %d frames", i, len(frames))
+		}
+		var sequence [4]byte
+		binary.LittleEndian.PutUint32(sequence[:], test.sequence)
+		if string(frames[0]) != test.topic ||
+			hex.EncodeToString(frames[1]) != test.body ||
+			!bytes.Equal(frames[2], sequence[:]) {
+			t.Fatalf("message #%d is %s %x %x, want %s %s %x", i, frames[0],
+				frames[1], frames[2], test.topic, test.body, sequence)
+		}
+	}
+}
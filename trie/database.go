@@ -190,6 +190,40 @@ func gatherChildren(n node, children *[]hash.Hash) {
 	}
 }
 
+// NodeChildren returns the hashes of the nodes referenced by the RLP encoded
+// trie node, including the ones referenced by its embedded nodes.
+func NodeChildren(blob []byte) ([]hash.Hash, error) {
+	n, err := decodeNode(nil, blob, 0)
+	if err != nil {
+		return nil, err
+	}
+	var children []hash.Hash
+	gatherDecodedChildren(n, &children)
+	return children, nil
+}
+
+// gatherDecodedChildren traverses the node hierarchy of a decoded node and
+// retrieves all the hashnode children.
+func gatherDecodedChildren(n node, children *[]hash.Hash) {
+	switch n := n.(type) {
+	case *shortNode:
+		gatherDecodedChildren(n.Val, children)
+
+	case *fullNode:
+		for i := 0; i < 16; i++ {
+			gatherDecodedChildren(n.Children[i], children)
+		}
+	case hashNode:
+		*children = append(*children, hash.MustBytesToHash(n))
+	}
+}
+
+// PreimageKey returns the database key the preimage of the hashed key is
+// stored under.
+func PreimageKey(shaKey []byte) []byte {
+	return append(append([]byte{}, secureKeyPrefix...), shaKey...)
+}
+
 // simplifyNode traverses the hierarchy of an expanded memory node and discards
 // all the internal caches, returning a node that only contains the raw data.
 func simplifyNode(n node) node {